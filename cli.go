@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"coding-agent/pkg/agent"
+	"coding-agent/pkg/commands"
+	"coding-agent/pkg/config"
+	"coding-agent/pkg/conversation"
+	"coding-agent/pkg/mcp"
+	"coding-agent/pkg/sandbox"
+	"coding-agent/pkg/tools"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+	"coding-agent/pkg/upgrade"
+	"coding-agent/pkg/usage"
+)
+
+// subcommand is a `mcode <name>` command
+type subcommand struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+// runUsage is the usage line of mcode run
+const runUsage = "run [--model name] [--perf] [--add-dir dir]... [--allowed-tools t,...] [--disallowed-tools t,...] [--auto-approve] [--non-interactive] [--output-format text|json|stream-json] [--] <prompt>"
+
+// subcommands lists the commands runCLI dispatches to, in the order help shows them
+func subcommands() []subcommand {
+	return []subcommand{
+		{"run", runUsage, "Run a single prompt and exit", runRunCommand},
+		{"models", "models", "List the configured models", runModelsCommand},
+		{"sessions", "sessions [--limit N]", "List saved sessions", runSessionsCommand},
+		{"replay", "replay <session|file|last> [--step] [--speed N]", "Play back a saved session", commands.Replay},
+		{"usage", "usage [--today|--week|--month|--days N] [--by-model]", "Summarize token usage and cost across sessions", runUsageCommand},
+		{"version", "version", "Show the version, commit and build date", func([]string) error { fmt.Println(versionString()); return nil }},
+		{"upgrade", "upgrade [--check] [--yes]", "Install the latest release from GitHub", runUpgradeCommand},
+		{"config", "config [show|path]", "Show the configuration (API keys masked) or its path", runConfigCommand},
+		{"mcp-serve", "mcp-serve [--allow dirs] [--read-only | --allow-bash]", "Serve the built-in tools to other agents over MCP (stdio)", runMCPServeCommand},
+		{"help", "help", "Show this help", func([]string) error { printUsage(os.Stdout); return nil }},
+	}
+}
+
+// runCLI dispatches the command line. Without arguments, or with only root flags, it starts the
+// interactive session. Arguments that do not start with a subcommand are a prompt, as before
+// subcommands existed; `mcode run` is the way to pass prompts that look like a subcommand or flag.
+func runCLI(args []string) error {
+	if len(args) > 0 && args[0] == sandbox.HelperCommand {
+		return sandbox.RunHelper(args[1:])
+	}
+	if len(args) > 0 {
+		for _, sub := range subcommands() {
+			if args[0] == sub.name {
+				return sub.run(args[1:])
+			}
+		}
+		if !strings.HasPrefix(args[0], "-") {
+			return runPrompt(strings.Join(args, " "), runOptions{})
+		}
+	}
+
+	fs := newFlagSet("mcode")
+	var opts runOptions
+	fs.StringVar(&opts.model, "model", "", "model to use for this session (a key from the config)")
+	version := fs.Bool("version", false, "print the version and exit")
+	fs.BoolVar(&opts.perf, "perf", false, "show where the time of each turn went: queueing, time to first token, generation, tools and approvals")
+	sessionFlags(fs, &opts)
+	promptFlags(fs, &opts)
+	if err := fs.Parse(args); err != nil {
+		return ignoreHelp(err)
+	}
+	if *version {
+		fmt.Println(versionString())
+		return nil
+	}
+	if fs.NArg() > 0 || stdinPiped() {
+		return runPrompt(strings.Join(fs.Args(), " "), opts)
+	}
+	if opts.headless || opts.outputFormat != outputText {
+		return fmt.Errorf("--non-interactive and --output-format need a prompt\nUsage: mcode run [--non-interactive] [--output-format json] <prompt>")
+	}
+	return runREPL(opts)
+}
+
+func runRunCommand(args []string) error {
+	fs := newFlagSet("run")
+	var opts runOptions
+	fs.StringVar(&opts.model, "model", "", "model to use (a key from the config)")
+	fs.BoolVar(&opts.perf, "perf", false, "show where the time of each turn went")
+	sessionFlags(fs, &opts)
+	promptFlags(fs, &opts)
+	if err := fs.Parse(args); err != nil {
+		return ignoreHelp(err)
+	}
+	return runPrompt(strings.TrimSpace(strings.Join(fs.Args(), " ")), opts)
+}
+
+// sessionFlags defines the flags interactive sessions and single-prompt runs share
+func sessionFlags(fs *flag.FlagSet, opts *runOptions) {
+	fs.Var(&opts.addDirs, "add-dir", "approve a folder for tool access for this session; repeat for more")
+	fs.Var(&opts.allowedTools, "allowed-tools", "offer the model only these tools, comma-separated")
+	fs.Var(&opts.disallowedTools, "disallowed-tools", "do not offer the model these tools, comma-separated")
+	fs.BoolVar(&opts.autoApprove, "auto-approve", false, "run tool calls without asking, except outside approved folders, denied commands and past the edit cap")
+}
+
+// promptFlags defines the flags single-prompt runs share between mcode and mcode run
+func promptFlags(fs *flag.FlagSet, opts *runOptions) {
+	fs.BoolVar(&opts.headless, "non-interactive", false, "never ask: tool calls that need approval are refused, for scripts and CI")
+	fs.BoolVar(&opts.headless, "print", false, "same as --non-interactive")
+	fs.StringVar(&opts.outputFormat, "output-format", outputText, "text, json (the final result as one JSON object) or stream-json (one JSON event per line)")
+}
+
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// nameList is a flag of comma-separated names that can also be given several times
+type nameList []string
+
+func (l *nameList) String() string { return strings.Join(*l, ",") }
+
+func (l *nameList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*l = append(*l, name)
+		}
+	}
+	return nil
+}
+
+func runModelsCommand(args []string) error {
+	if err := newFlagSet("models").Parse(args); err != nil {
+		return ignoreHelp(err)
+	}
+	cfg, err := config.LoadOrCreateConfig(config.GetConfigPath())
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(cfg.Models))
+	for key := range cfg.Models {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		model := cfg.Models[key]
+		marker := " "
+		if key == cfg.CurrentModel {
+			marker = "*"
+		}
+		location := model.BaseURL
+		if model.Provider != "" {
+			location = model.Provider + " " + location
+		}
+		fmt.Printf("%s %-20s %-40s %s\n", marker, key, model.Name, strings.TrimSpace(location))
+	}
+	return nil
+}
+
+func runSessionsCommand(args []string) error {
+	fs := newFlagSet("sessions")
+	limit := fs.Int("limit", 20, "number of sessions to show, most recent first (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return ignoreHelp(err)
+	}
+	dir, err := conversation.GetDefaultConversationDir()
+	if err != nil {
+		return err
+	}
+	convs, err := conversation.NewManager(dir).List()
+	if err != nil {
+		return err
+	}
+	if len(convs) == 0 {
+		fmt.Println("No saved sessions.")
+		return nil
+	}
+
+	shown := 0
+	for i := len(convs) - 1; i >= 0 && (*limit <= 0 || shown < *limit); i-- {
+		conv := convs[i]
+		fmt.Printf("%3d. %s  %-28s %4d msgs  %s\n", i+1, conv.UpdatedAt.Format("2006-01-02 15:04"), conv.ID, len(conv.Messages), conv.Title)
+		shown++
+	}
+	if shown < len(convs) {
+		fmt.Printf("(%d older sessions; use --limit 0 to show all)\n", len(convs)-shown)
+	}
+	return nil
+}
+
+func runUsageCommand(args []string) error {
+	fs := newFlagSet("usage")
+	today := fs.Bool("today", false, "show today's usage")
+	week := fs.Bool("week", false, "show the last 7 days (the default)")
+	month := fs.Bool("month", false, "show the last 30 days")
+	days := fs.Int("days", 0, "show the last N days")
+	byModel := fs.Bool("by-model", false, "total each model over the period instead of per day")
+	if err := fs.Parse(args); err != nil {
+		return ignoreHelp(err)
+	}
+
+	n := 7
+	switch {
+	case *days > 0:
+		n = *days
+	case *today:
+		n = 1
+	case *month:
+		n = 30
+	case *week:
+		n = 7
+	}
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day()-(n-1), 0, 0, 0, 0, time.Local)
+	entries, err := usage.Load(since)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No usage recorded since %s.\n", since.Format("2006-01-02"))
+		return nil
+	}
+
+	rows, total := usage.Summarize(entries, !*byModel)
+	fmt.Printf("Usage since %s\n\n", since.Format("2006-01-02"))
+	fmt.Printf("%-10s  %-24s %8s %9s %9s %9s %9s\n", "Date", "Model", "Requests", "Prompt", "Generated", "Cost", "Time")
+	for _, row := range rows {
+		day := row.Day
+		if day == "" {
+			day = "-"
+		}
+		printUsageRow(day, row.Model, row.Total)
+	}
+	printUsageRow("Total", "", total)
+	return nil
+}
+
+func printUsageRow(day, model string, t usage.Total) {
+	elapsed := time.Duration(t.Seconds * float64(time.Second)).Round(time.Second)
+	fmt.Printf("%-10s  %-24s %8d %9s %9s %9s %9s\n", day, model, t.Requests,
+		formatTokenCount(t.PromptTokens), formatTokenCount(t.CompletionTokens), fmt.Sprintf("$%.2f", t.Cost), elapsed)
+}
+
+// formatTokenCount abbreviates a token count: 950, 12.3k, 4.1M
+func formatTokenCount(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	}
+	return fmt.Sprint(n)
+}
+
+func runConfigCommand(args []string) error {
+	action := "show"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	path := config.GetConfigPath()
+	switch action {
+	case "path":
+		fmt.Println(path)
+		return nil
+	case "show":
+		cfg, err := config.LoadOrCreateConfig(path)
+		if err != nil {
+			return err
+		}
+		masked := *cfg
+		masked.Models = make(map[string]types.Model, len(cfg.Models))
+		for key, model := range cfg.Models {
+			if model.APIKey != "" {
+				model.APIKey = "***"
+			}
+			masked.Models[key] = model
+		}
+		data, err := json.MarshalIndent(masked, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("# %s\n%s\n", path, data)
+		return nil
+	default:
+		return fmt.Errorf("unknown config action %q\nUsage: mcode config [show|path]", action)
+	}
+}
+
+// runMCPServeCommand serves tools over MCP on stdin and stdout. The current directory, the
+// approved folders from the config and --allow are the folders tools may access, and change files
+// in unless they are approved for reading only; nobody can be asked about others.
+func runMCPServeCommand(args []string) error {
+	fs := newFlagSet("mcp-serve")
+	allow := fs.String("allow", "", "further folders tools may access, comma-separated")
+	readOnly := fs.Bool("read-only", false, "serve only read_file, list_files and search_code")
+	allowBash := fs.Bool("allow-bash", false, "also serve bash_command, which runs any command in the current directory")
+	if err := fs.Parse(args); err != nil {
+		return ignoreHelp(err)
+	}
+	if *readOnly && *allowBash {
+		return fmt.Errorf("--allow-bash cannot be combined with --read-only")
+	}
+
+	// Stdout carries the protocol, so everything tools and the agent print goes to stderr
+	protocol := os.Stdout
+	os.Stdout = os.Stderr
+
+	ag := agent.New()
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	// Tools may change files in the current directory, --allow and approved_write_folders; the
+	// other approved folders stay read-only
+	writable := map[string]bool{cwd: true}
+	folders := map[string]bool{cwd: true}
+	for _, folder := range ag.ApprovedFolderList() {
+		folders[folder] = true
+	}
+	for _, folder := range strings.Split(*allow, ",") {
+		if folder = strings.TrimSpace(folder); folder != "" {
+			abs, err := filepath.Abs(folder)
+			if err != nil {
+				return err
+			}
+			folders[abs] = true
+			writable[abs] = true
+		}
+	}
+	ag.SetApprovedFolders(folders)
+	if !*readOnly {
+		for folder := range writable {
+			ag.ApproveWriteFolder(folder)
+		}
+	}
+
+	toolManager := tools.NewManager(ag)
+	toolManager.RegisterTools()
+	names := mcp.DefaultTools
+	if *readOnly {
+		names = mcp.ReadOnlyTools
+	} else if *allowBash {
+		names = append(slices.Clone(names), mcp.ShellTool)
+	}
+	server := mcp.NewServer(ag, toolManager, names, BuildVersion)
+	fmt.Fprintf(os.Stderr, "mcode MCP server %s: serving %s in %s\n", BuildVersion, strings.Join(server.Tools(), ", "), cwd)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer tools.KillProcessGroups()
+	return server.Serve(ctx, os.Stdin, protocol)
+}
+
+func runUpgradeCommand(args []string) error {
+	fs := newFlagSet("upgrade")
+	check := fs.Bool("check", false, "only report whether a newer release exists")
+	yes := fs.Bool("yes", false, "install without asking for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return ignoreHelp(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	release, err := upgrade.Latest(ctx)
+	if err != nil {
+		return err
+	}
+	if !upgrade.Newer(release.Tag, BuildVersion) {
+		fmt.Printf("mcode %s is up to date (latest release: %s)\n", BuildVersion, release.Tag)
+		return nil
+	}
+	fmt.Printf("A new release is available: %s (running %s)\n", release.Tag, BuildVersion)
+	if release.URL != "" {
+		fmt.Printf("Release notes: %s\n", release.URL)
+	}
+	if *check {
+		return nil
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot locate the running binary: %v", err)
+	}
+	if !*yes {
+		fmt.Printf("Replace %s with %s? (y/N): ", path, release.Tag)
+		if ui.ReadConfirmation() != "y" {
+			fmt.Println("\nUpgrade cancelled")
+			return nil
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Downloading %s...\n", upgrade.AssetName())
+	if err := upgrade.Install(ctx, release, path); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Upgraded to %s\n", release.Tag)
+	return nil
+}
+
+// versionString describes the build. Builds without -ldflags fall back to the VCS information
+// the Go toolchain embeds.
+func versionString() string {
+	commit, date, modified := BuildCommit, BuildDate, false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if commit == "" {
+					commit = setting.Value[:min(len(setting.Value), 12)]
+				}
+			case "vcs.time":
+				if date == "" {
+					date = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	} else if modified && BuildCommit == "" {
+		commit += "-dirty"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("mcode %s (commit %s, built %s, %s %s/%s)", BuildVersion, commit, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		if name == "mcode" {
+			printUsage(os.Stderr)
+			return
+		}
+		for _, sub := range subcommands() {
+			if sub.name == name {
+				fmt.Fprintf(os.Stderr, "Usage: mcode %s\n", sub.usage)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// ignoreHelp turns the error flag returns for -h into a normal exit; the usage was already printed
+func ignoreHelp(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "MCode CLI %s\n\n", BuildVersion)
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintf(w, "  mcode %s\n  %32s %s\n", "[--model name] [--perf] [--add-dir dir]... [--allowed-tools t,...] [--disallowed-tools t,...] [--auto-approve]", "", "Start an interactive session")
+	fmt.Fprintf(w, "  mcode %-26s %s\n", "--version", "Show the version and exit")
+	for _, sub := range subcommands() {
+		if len(sub.usage) > 26 {
+			fmt.Fprintf(w, "  mcode %s\n  %32s %s\n", sub.usage, "", sub.summary)
+			continue
+		}
+		fmt.Fprintf(w, "  mcode %-26s %s\n", sub.usage, sub.summary)
+	}
+	fmt.Fprintln(w, "\nArguments that are not a subcommand are run as a prompt: mcode \"fix the failing test\"")
+	fmt.Fprintln(w, "With --non-interactive (or --print) a prompt never waits for input: tool calls that need approval are refused.")
+	fmt.Fprintln(w, "--add-dir approves a folder and its subfolders for tool access up front; give it once per folder.")
+	fmt.Fprintln(w, "--allowed-tools and --disallowed-tools choose the tools the model sees, e.g. --disallowed-tools bash_command.")
+}
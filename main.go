@@ -5,12 +5,21 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"coding-agent/pkg/agent"
 	"coding-agent/pkg/commands"
+	"coding-agent/pkg/devcontainer"
+	"coding-agent/pkg/i18n"
 	"coding-agent/pkg/project"
+	"coding-agent/pkg/recovery"
+	"coding-agent/pkg/tools"
 	"coding-agent/pkg/types"
 	"coding-agent/pkg/ui"
 
@@ -19,21 +28,73 @@ import (
 	"github.com/chzyer/readline"
 )
 
-var BuildVersion = "dev"
+// Build information, set with -ldflags "-X main.BuildVersion=..." (see the Makefile)
+var (
+	BuildVersion = "dev"
+	BuildCommit  = ""
+	BuildDate    = ""
+)
 
 var completer = readline.NewPrefixCompleter(
 	readline.PcItem("/help"),
 	readline.PcItem("/init"),
 	readline.PcItem("/new"),
 	readline.PcItem("/export"),
-	readline.PcItem("/models"),
+	readline.PcItem("/share"),
+	readline.PcItem("/search"),
+	readline.PcItem("/explain"),
+	readline.PcItem("/doc"),
+	readline.PcItem("/voice"),
+	readline.PcItem("/models",
+		readline.PcItem("discover"),
+	),
+	readline.PcItem("/architect",
+		readline.PcItem("on"),
+		readline.PcItem("off"),
+	),
 	readline.PcItem("/permissions"),
+	readline.PcItem("/autoapprove",
+		readline.PcItem("on"),
+		readline.PcItem("off"),
+		readline.PcItem("status"),
+	),
+	readline.PcItem("/ping"),
+	readline.PcItem("/stats"),
+	readline.PcItem("/cost"),
 	readline.PcItem("/compact"),
+	readline.PcItem("/fork"),
 	readline.PcItem("/exit"),
 	readline.PcItem("/save"),
 	readline.PcItem("/resume"),
+	readline.PcItem("/sessions",
+		readline.PcItem("list"),
+		readline.PcItem("switch"),
+		readline.PcItem("rename"),
+		readline.PcItem("delete"),
+		readline.PcItem("prune"),
+	),
 	readline.PcItem("/conv"),
 	readline.PcItem("/del"),
+	readline.PcItem("/watch"),
+	readline.PcItem("/build"),
+	readline.PcItem("/workspace",
+		readline.PcItem("list"),
+		readline.PcItem("add"),
+		readline.PcItem("remove"),
+	),
+	readline.PcItem("/add-dir",
+		readline.PcItem("--save"),
+	),
+	readline.PcItem("/devcontainer",
+		readline.PcItem("on"),
+		readline.PcItem("off"),
+		readline.PcItem("status"),
+	),
+	readline.PcItem("/k8s",
+		readline.PcItem("exec"),
+		readline.PcItem("off"),
+		readline.PcItem("status"),
+	),
 	readline.PcItem("#"),
 )
 
@@ -55,49 +116,174 @@ func formatModelName(name string) string {
 }
 
 func main() {
+	if err := runCLI(os.Args[1:]); err != nil {
+		fmt.Println(i18n.T("error", err))
+		os.Exit(1)
+	}
+}
+
+// runOptions are the flags of a session or single-prompt run
+type runOptions struct {
+	model           string
+	perf            bool
+	addDirs         stringList // --add-dir: folders approved for tool access up front
+	allowedTools    nameList   // --allowed-tools: the only tools offered to the model
+	disallowedTools nameList   // --disallowed-tools: tools not offered to the model
+	autoApprove     bool       // --auto-approve: run tool calls without asking, within guardrails
+	headless        bool       // --non-interactive: never wait for an answer on the terminal
+	outputFormat    string     // --output-format: text, json or stream-json
+}
+
+// runPrompt executes a single prompt and returns. Input piped to mcode is added to the prompt.
+func runPrompt(message string, opts runOptions) error {
+	query := message
+	terminal := true
+	if stdinPiped() {
+		input, tty, err := readPipedInput()
+		if err != nil {
+			return err
+		}
+		message, terminal = withPipedInput(message, input), tty
+		if len(message) > len(query) {
+			query = strings.TrimSpace(fmt.Sprintf("%s (+%d bytes from stdin)", query, len(message)-len(query)))
+		}
+	}
+	if strings.TrimSpace(message) == "" {
+		return fmt.Errorf("no prompt given\nUsage: mcode %s", runUsage)
+	}
+	if !terminal && !opts.headless {
+		fmt.Fprintln(os.Stderr, "No terminal to ask for approvals on; running as with --non-interactive")
+		opts.headless = true
+	}
+
+	var events *eventWriter
+	if opts.outputFormat != "" && opts.outputFormat != outputText {
+		if err := validOutputFormat(opts.outputFormat); err != nil {
+			return err
+		}
+		// Stdout carries the events, so everything meant for people goes to stderr
+		events = newEventWriter(os.Stdout, opts.outputFormat)
+		os.Stdout = os.Stderr
+	}
+
+	ag := agent.New()
+	if opts.model != "" {
+		if err := agent.UseModel(ag, opts.model); err != nil {
+			return err
+		}
+	}
+	ag.Perf = opts.perf
+	if err := agent.RestrictTools(ag, opts.allowedTools, opts.disallowedTools); err != nil {
+		return err
+	}
+	if opts.headless {
+		ag.Headless = true
+		// Nobody can approve the working directory, so reads there are allowed up front
+		if cwd, err := os.Getwd(); err == nil {
+			ag.ApproveFolder(cwd)
+		}
+	}
+	commandHandler := commands.NewHandler(ag, project.NewManager(ag))
+
+	// Get current model info for display
+	currentModel, exists := ag.Config.Models[ag.ModelKey()]
+	if !exists {
+		currentModel = types.Model{Name: "unknown", BaseURL: "unknown"}
+	}
+
+	fmt.Println(i18n.T("startup.connected", BuildVersion, currentModel.BaseURL))
+	fmt.Println(i18n.T("startup.model", currentModel.Name, ag.ModelKey()))
+	if err := approveDirs(ag, opts.addDirs); err != nil {
+		return err
+	}
+	if opts.autoApprove {
+		ag.AutoApprove = true
+		fmt.Println(agent.AutoApproveStatus(ag))
+	}
+	fmt.Printf("%s\n\n", i18n.T("startup.query", query))
+	commandHandler.CheckModelEndpoint(false)
+
+	ui.CaptureTerminal()
+	trapSignals(ag, nil)
+	if events == nil {
+		return agent.Chat(ag, context.Background(), message)
+	}
+	ag.OnEvent = events.write
+	start := time.Now()
+	err := agent.Chat(ag, context.Background(), message)
+	events.finish(agent.FinalResult(ag, err, time.Since(start)))
+	return err
+}
+
+// approveDirs grants the folders of --add-dir for the session
+func approveDirs(ag *types.Agent, dirs []string) error {
+	for _, dir := range dirs {
+		abs, err := agent.ApproveDirectory(ag, dir, false)
+		if err != nil {
+			return fmt.Errorf("--add-dir: %v", err)
+		}
+		fmt.Printf("📂 Folder access granted for this session: %s\n", abs)
+	}
+	return nil
+}
+
+// runREPL runs the interactive session
+func runREPL(opts runOptions) error {
 	// Create agent instance
 	ag := agent.New()
+	if opts.model != "" {
+		if err := agent.UseModel(ag, opts.model); err != nil {
+			return err
+		}
+	}
+	ag.Perf = opts.perf
+	if err := agent.RestrictTools(ag, opts.allowedTools, opts.disallowedTools); err != nil {
+		return err
+	}
 	ctx := context.Background()
 
 	// Create managers
 	projectManager := project.NewManager(ag)
 	commandHandler := commands.NewHandler(ag, projectManager)
 
-	// Check if we have command line arguments for single command mode
-	if len(os.Args) > 1 {
-		// Join all arguments as the message
-		message := strings.Join(os.Args[1:], " ")
+	interrupts := &interruptState{}
+	ui.CaptureTerminal()
+	trapSignals(ag, interrupts)
 
-		// Get current model info for display
-		currentModel, exists := ag.Config.Models[ag.Config.CurrentModel]
-		if !exists {
-			currentModel = types.Model{Name: "unknown", BaseURL: "unknown"}
+	// A panic saves the session for recovery before exiting; see OfferRecovery
+	defer func() {
+		if r := recover(); r != nil {
+			reportCrash(ag, r)
+			os.Exit(2)
 		}
-
-		fmt.Printf("MCode CLI %s - Connected to %s\n", BuildVersion, currentModel.BaseURL)
-		fmt.Printf("Model: %s (%s)\n", currentModel.Name, ag.Config.CurrentModel)
-		fmt.Printf("Query: %s\n\n", message)
-
-		// Execute the single command and exit
-		if err := agent.Chat(ag, ctx, message); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
-		}
-		return
-	}
+	}()
 
 	// Clear terminal on startup for interactive mode
 	fmt.Print("\033[2J\033[H")
 
 	// Get current model info for display
-	currentModel, exists := ag.Config.Models[ag.Config.CurrentModel]
+	currentModel, exists := ag.Config.Models[ag.ModelKey()]
 	if !exists {
 		currentModel = types.Model{Name: "unknown", BaseURL: "unknown"}
 	}
 
-	fmt.Printf("MCode CLI %s - Connected to %s\n", BuildVersion, currentModel.BaseURL)
-	fmt.Printf("Model: %s (%s)\n", currentModel.Name, ag.Config.CurrentModel)
-	fmt.Println("Enter your message (type '/help' for commands, '#instruction' for permanent memory, 'exit' to quit):")
+	fmt.Println(i18n.T("startup.connected", BuildVersion, currentModel.BaseURL))
+	fmt.Println(i18n.T("startup.model", currentModel.Name, ag.ModelKey()))
+	if err := approveDirs(ag, opts.addDirs); err != nil {
+		return err
+	}
+	if opts.autoApprove {
+		ag.AutoApprove = true
+		fmt.Println(agent.AutoApproveStatus(ag))
+	}
+	commandHandler.CheckModelEndpoint(true)
+	commandHandler.OfferRecovery()
+	commandHandler.OfferLastSession()
+	ag.Recovery = true
+	if cwd, err := os.Getwd(); err == nil && devcontainer.Find(cwd) != "" {
+		fmt.Println(i18n.T("startup.devcontainer"))
+	}
+	fmt.Println(i18n.T("startup.enter"))
 
 	// Setup readline with history
 	var escState int
@@ -122,19 +308,22 @@ func main() {
 					ag.AutoApproveEdit = true
 					ag.AutoApproveEditRoot = "."
 				}
-				status := "Off"
+				status := i18n.T("prompt.off")
 				if ag.AutoApproveEdit {
-					status = "On"
+					status = i18n.T("prompt.on")
 				}
-				fmt.Printf("\r\n%s[Auto-approve edits: %s]%s\r\n", types.ColorCyan, status, types.ColorReset)
+				fmt.Printf("\r\n%s%s%s\r\n", types.ColorCyan, i18n.T("prompt.auto_approve", status), types.ColorReset)
 
 				// Update prompt dynamically
 				tokens := agent.GetContextTokens(ag)
-				modelName := formatModelName(ag.Config.CurrentModel)
+				modelName := formatModelName(ag.ModelKey())
 				autoApproveStr := ""
 				if ag.AutoApproveEdit {
 					autoApproveStr = " | 🔓"
 				}
+				if ag.AutoApprove {
+					autoApproveStr += " | ⚡"
+				}
 				prompt := fmt.Sprintf("[%s%s] > ", modelName, autoApproveStr)
 				if tokens > 0 {
 					if tokens >= 1000 {
@@ -164,19 +353,22 @@ func main() {
 					ag.AutoApproveEdit = true
 					ag.AutoApproveEditRoot = "."
 				}
-				status := "Off"
+				status := i18n.T("prompt.off")
 				if ag.AutoApproveEdit {
-					status = "On"
+					status = i18n.T("prompt.on")
 				}
-				fmt.Printf("\r\n%s[Auto-approve edits: %s]%s\r\n", types.ColorCyan, status, types.ColorReset)
+				fmt.Printf("\r\n%s%s%s\r\n", types.ColorCyan, i18n.T("prompt.auto_approve", status), types.ColorReset)
 
 				// Update prompt dynamically
 				tokens := agent.GetContextTokens(ag)
-				modelName := formatModelName(ag.Config.CurrentModel)
+				modelName := formatModelName(ag.ModelKey())
 				autoApproveStr := ""
 				if ag.AutoApproveEdit {
 					autoApproveStr = " | 🔓"
 				}
+				if ag.AutoApprove {
+					autoApproveStr += " | ⚡"
+				}
 				prompt := fmt.Sprintf("[%s%s] > ", modelName, autoApproveStr)
 				if tokens > 0 {
 					if tokens >= 1000 {
@@ -196,8 +388,7 @@ func main() {
 		},
 	})
 	if err != nil {
-		fmt.Printf("Error setting up readline: %v\n", err)
-		return
+		return fmt.Errorf("setting up readline: %v", err)
 	}
 	defer rl.Close()
 
@@ -207,12 +398,15 @@ func main() {
 
 		// Update prompt with model and token count
 		tokens := agent.GetContextTokens(ag)
-		modelName := formatModelName(ag.Config.CurrentModel)
+		modelName := formatModelName(ag.ModelKey())
 
 		autoApproveStr := ""
 		if ag.AutoApproveEdit {
 			autoApproveStr = " | 🔓"
 		}
+		if ag.AutoApprove {
+			autoApproveStr += " | ⚡"
+		}
 
 		prompt := fmt.Sprintf("[%s%s] > ", modelName, autoApproveStr)
 		if tokens > 0 {
@@ -224,10 +418,24 @@ func main() {
 		}
 		rl.SetPrompt(prompt)
 
-		line, err := rl.Readline()
-		if err != nil { // io.EOF or interrupt
+		// A /voice transcript waits at the prompt to be edited and sent
+		line, err := rl.ReadlineWithDefault(commandHandler.TakePrefill())
+		if errors.Is(err, readline.ErrInterrupt) {
+			// Ctrl+C discards the line being typed; on an empty line it quits when pressed twice
+			if strings.TrimSpace(line) != "" {
+				interrupts.reset()
+				continue
+			}
+			if interrupts.press() {
+				break
+			}
+			fmt.Println(i18n.T("prompt.quit_hint"))
+			continue
+		}
+		if err != nil { // io.EOF
 			break
 		}
+		interrupts.reset()
 
 		input := strings.TrimSpace(line)
 		if input == "exit" || input == "quit" {
@@ -238,11 +446,14 @@ func main() {
 			continue
 		}
 
+		// Pick up edits to AGENTS.md or the config made while the session was idle
+		agent.ReloadChangedFiles(ag)
+
 		// Handle slash commands
 		if strings.HasPrefix(input, "/") {
 			shouldExit, err := commandHandler.Handle(input)
 			if err != nil {
-				fmt.Printf("Error: %v\n", err)
+				fmt.Println(i18n.T("error", err))
 			}
 			if shouldExit {
 				break
@@ -254,26 +465,147 @@ func main() {
 		if strings.HasPrefix(input, "#") {
 			instruction := strings.TrimSpace(input[1:])
 			if instruction == "" {
-				fmt.Println("❌ Please provide an instruction after #")
+				fmt.Println(i18n.T("instruction.missing"))
 				continue
 			}
 
-			fmt.Printf("💾 Adding permanent instruction: %s\n", instruction)
+			fmt.Println(i18n.T("instruction.adding", instruction))
 			if err := projectManager.AddPermanentInstruction(instruction); err != nil {
-				fmt.Printf("Error saving instruction: %v\n", err)
+				fmt.Println(i18n.T("instruction.save_failed", err))
 			} else {
-				fmt.Printf("✅ Permanent instruction saved to AGENTS.md\n")
+				fmt.Println(i18n.T("instruction.saved"))
 			}
 			continue
 		}
 
 		// Regular chat message
-		if err := agent.Chat(ag, ctx, input); err != nil {
+		ui.TakeCtrlC()
+		opCtx, cancelOp := context.WithCancel(ctx)
+		interrupts.start(cancelOp)
+		err = agent.Chat(ag, opCtx, input)
+		interrupts.finish()
+		cancelOp()
+		if err != nil {
 			if errors.Is(err, ui.ErrInterrupted) {
-				fmt.Println("\n❌ Operation cancelled")
+				fmt.Println("\n" + i18n.T("prompt.cancelled"))
+				if ui.TakeCtrlC() {
+					interrupts.arm()
+					fmt.Println(i18n.T("prompt.quit_hint"))
+				}
+			} else {
+				fmt.Println(i18n.T("error", err))
+			}
+		}
+	}
+
+	if opts.perf && len(ag.PerfTurns) > 0 {
+		fmt.Printf("\n⏱️  Session latency by model\n%s", agent.FormatTurnTimings(ag.PerfTurns, true))
+	}
+
+	// Saved so the next session here can offer to continue it; a clean exit needs no recovery
+	commandHandler.SaveSession()
+	if cwd, err := os.Getwd(); err == nil {
+		recovery.Clear(cwd)
+	}
+	return nil
+}
+
+// interruptState tracks Ctrl+C in the interactive session: the first press cancels the operation
+// in progress or the line being typed, and only a second press in a row quits
+type interruptState struct {
+	mu       sync.Mutex
+	armed    bool               // The last input was a Ctrl+C, so another one quits
+	cancelOp context.CancelFunc // Cancels the running operation, nil at the prompt
+}
+
+// press handles a Ctrl+C and reports whether mcode should quit. Otherwise it cancels the running
+// operation, if any, and arms the next press to quit.
+func (s *interruptState) press() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.armed {
+		return true
+	}
+	s.armed = true
+	if s.cancelOp != nil {
+		s.cancelOp()
+	}
+	return false
+}
+
+func (s *interruptState) arm() {
+	s.mu.Lock()
+	s.armed = true
+	s.mu.Unlock()
+}
+
+// reset disarms quitting once the user does anything other than press Ctrl+C
+func (s *interruptState) reset() {
+	s.mu.Lock()
+	s.armed = false
+	s.mu.Unlock()
+}
+
+func (s *interruptState) start(cancel context.CancelFunc) {
+	s.mu.Lock()
+	s.cancelOp = cancel
+	s.mu.Unlock()
+}
+
+func (s *interruptState) finish() {
+	s.mu.Lock()
+	s.cancelOp = nil
+	s.mu.Unlock()
+}
+
+// trapSignals shuts mcode down cleanly on SIGINT, SIGTERM or SIGHUP: running commands are killed
+// with their children, the terminal is restored and the session is saved for recovery. With
+// interrupts, SIGINT (Ctrl+C while the terminal is not in raw mode) follows the same
+// cancel-then-quit rule as Ctrl+C pressed at the prompt.
+func trapSignals(ag *types.Agent, interrupts *interruptState) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-signals
+		for sig == os.Interrupt && interrupts != nil && !interrupts.press() {
+			fmt.Printf("\n%s\n", i18n.T("prompt.quit_hint"))
+			sig = <-signals
+		}
+		tools.KillProcessGroups()
+		ui.RestoreTerminal()
+		fmt.Printf("\n%sStopped by %v%s\n", types.ColorYellow, sig, types.ColorReset)
+		if ag.Recovery {
+			if err := recovery.Save(ag); err != nil {
+				fmt.Printf("The session could not be saved for recovery: %v\n", err)
 			} else {
-				fmt.Printf("Error: %v\n", err)
+				fmt.Println("The session was saved; start mcode in this directory again to restore it.")
 			}
 		}
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	}()
+}
+
+// reportCrash saves the session for recovery and appends the panic with its stack trace to
+// ~/.mcode/crash.log
+func reportCrash(ag *types.Agent, r interface{}) {
+	stack := debug.Stack()
+	saveErr := recovery.Save(ag)
+
+	logPath := "mcode-crash.log"
+	if home, err := os.UserHomeDir(); err == nil {
+		logPath = filepath.Join(home, ".mcode", "crash.log")
+		os.MkdirAll(filepath.Dir(logPath), 0755)
+	}
+	if f, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+		fmt.Fprintf(f, "=== %s mcode %s\npanic: %v\n\n%s\n", time.Now().Format(time.RFC3339), versionString(), r, stack)
+		f.Close()
+	}
+
+	fmt.Printf("\n%s💥 mcode crashed: %v%s\n", types.ColorRed, r, types.ColorReset)
+	fmt.Printf("   Details were written to %s; please include them when reporting the bug.\n", logPath)
+	if saveErr != nil {
+		fmt.Printf("   The session could not be saved for recovery: %v\n", saveErr)
+		return
 	}
+	fmt.Println("   The session was saved; start mcode in this directory again to restore it.")
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"coding-agent/pkg/types"
+)
+
+// Values of --output-format
+const (
+	outputText       = "text"
+	outputJSON       = "json"
+	outputStreamJSON = "stream-json"
+)
+
+// eventWriter writes the events of a run as JSON: with stream-json each event as one line as it
+// happens, with json only the final result
+type eventWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	stream bool
+}
+
+func newEventWriter(out io.Writer, format string) *eventWriter {
+	return &eventWriter{out: out, stream: format == outputStreamJSON}
+}
+
+// write is the agent's event listener
+func (w *eventWriter) write(e types.Event) {
+	if w.stream {
+		w.encode(e)
+	}
+}
+
+// finish writes the final result, which ends the output in both formats
+func (w *eventWriter) finish(e types.Event) {
+	w.encode(e)
+}
+
+func (w *eventWriter) encode(e types.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data, err := json.Marshal(e)
+	if err != nil {
+		data, _ = json.Marshal(types.Event{Type: e.Type, IsError: true, Error: err.Error()})
+	}
+	fmt.Fprintf(w.out, "%s\n", data)
+}
+
+// validOutputFormat checks a --output-format value
+func validOutputFormat(format string) error {
+	switch format {
+	case outputText, outputJSON, outputStreamJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q; use text, json or stream-json", format)
+}
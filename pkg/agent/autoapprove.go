@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+)
+
+// defaultAutoApproveEdits is how many edits auto-approve mode makes per session before asking again
+const defaultAutoApproveEdits = 50
+
+// deniedCommands are shell commands auto-approve mode never runs without asking: hard to undo, or
+// handing control to code nobody has read
+var deniedCommands = []struct {
+	re     *regexp.Regexp
+	reason string
+}{
+	{regexp.MustCompile(`\brm\s+([^\s;&|]+\s+)*(-[a-zA-Z]*[rR]|--recursive\b)`), "recursive rm"},
+	{regexp.MustCompile(`(^|[\s;&|(])(sudo|doas|su)(\s|$)`), "privilege escalation"},
+	{regexp.MustCompile(`\b(curl|wget)\b[^|]*\|\s*(sudo\s+)?(\w*sh|python\d*|perl|ruby|node)\b`), "a download piped into an interpreter"},
+	{regexp.MustCompile(`\bmkfs\b|\bdd\s[^|]*\bof=/dev/`), "writing to a device"},
+	{regexp.MustCompile(`\bgit\s+push\b[^;&|]*(\s-f\b|\s--force\b|\s\+)`), "a force push"},
+	{regexp.MustCompile(`\bchmod\s+(-\S+\s+)*0?777\b`), "making files world-writable"},
+}
+
+// AutoApproveEditLimit is the number of edits auto-approve mode makes per session
+func AutoApproveEditLimit(a *types.Agent) int {
+	if a.Config != nil && a.Config.AutoApprove.MaxEdits > 0 {
+		return a.Config.AutoApprove.MaxEdits
+	}
+	return defaultAutoApproveEdits
+}
+
+// deniedCommand returns why auto-approve mode may not run a shell command, or "" when it may.
+// The user's denied_commands are matched like always_allow commands.
+func deniedCommand(a *types.Agent, command string) string {
+	for _, denied := range deniedCommands {
+		if denied.re.MatchString(command) {
+			return denied.reason
+		}
+	}
+	if a.Config != nil {
+		for _, pattern := range a.Config.AutoApprove.DeniedCommands {
+			if commandMatches(pattern, command) {
+				return fmt.Sprintf("denied_commands: %s", pattern)
+			}
+		}
+	}
+	return ""
+}
+
+// autoApproveBlock returns why auto-approve mode may not run a tool call without asking, or ""
+// when it may. Calls must stay in approved folders, which for shell tools means the current
+// folder and every word of the command that looks like a path, commands must not be denied, and
+// edits are capped per session.
+func autoApproveBlock(a *types.Agent, name string, params map[string]interface{}, folder string, isEdit bool) string {
+	if folder != "" && !IsFolderApproved(a, folder) {
+		return fmt.Sprintf("%s is outside the approved folders", folder)
+	}
+	if shellTools[name] {
+		if !IsFolderApproved(a, ".") {
+			return "the current folder is not approved"
+		}
+		command, _ := params["command"].(string)
+		for _, path := range commandPaths(command) {
+			if path != os.DevNull && !IsFolderApproved(a, expandHome(path)) {
+				return fmt.Sprintf("%s is outside the approved folders", path)
+			}
+		}
+		if reason := deniedCommand(a, command); reason != "" {
+			return reason
+		}
+	}
+	if limit := AutoApproveEditLimit(a); isEdit && a.AutoApprovedEdits >= limit {
+		return fmt.Sprintf("the %d edits auto-approve mode may make this session are used up", limit)
+	}
+	return ""
+}
+
+// autoApproveCall reports whether auto-approve mode runs a tool call without asking. A blocked
+// call is explained, and then goes to the usual prompt.
+func autoApproveCall(a *types.Agent, name string, params map[string]interface{}, folder string, isEdit bool) bool {
+	if reason := autoApproveBlock(a, name, params, folder, isEdit); reason != "" {
+		ui.PrintfSafe("%s⚡ Auto-approve stopped at this call: %s%s\n", types.ColorYellow, reason, types.ColorReset)
+		return false
+	}
+	if isEdit {
+		a.AutoApprovedEdits++
+	}
+	return true
+}
+
+// AutoApproveStatus describes auto-approve mode and what it still asks about
+func AutoApproveStatus(a *types.Agent) string {
+	if !a.AutoApprove {
+		return "Auto-approve is off: tool calls ask as usual"
+	}
+	limit := AutoApproveEditLimit(a)
+	return fmt.Sprintf("⚡ Auto-approve is on: tool calls run without asking, except outside the approved folders, "+
+		"denied commands (recursive rm, sudo, curl | sh, force pushes, ...) and edits after %d this session (%d made)",
+		limit, a.AutoApprovedEdits)
+}
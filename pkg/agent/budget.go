@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+	"coding-agent/pkg/usage"
+)
+
+// budgetReached describes the spend budget a model has used up, or returns "" while it is within
+// its budgets. Spending comes from the usage log, so it covers every session.
+func budgetReached(a *types.Agent, modelKey string) string {
+	model := a.Config.Models[modelKey]
+	if model.DailyBudget <= 0 && model.MonthlyBudget <= 0 {
+		return ""
+	}
+	day, month, err := usage.Spent(modelKey, time.Now())
+	if err != nil {
+		ui.PrintfSafe("⚠️  Could not check the spend budget of '%s': %v\n", modelKey, err)
+		return ""
+	}
+	if model.DailyBudget > 0 && day >= model.DailyBudget {
+		return fmt.Sprintf("daily budget of $%.2f ($%.2f spent today)", model.DailyBudget, day)
+	}
+	if model.MonthlyBudget > 0 && month >= model.MonthlyBudget {
+		return fmt.Sprintf("monthly budget of $%.2f ($%.2f spent this month)", model.MonthlyBudget, month)
+	}
+	return ""
+}
+
+// EnforceBudget is checked before each request. Once the current model has reached a spend budget
+// the session switches to the budget_fallback model, typically a local one, if that is within its
+// own budgets; otherwise the request is refused. The switch is for the session only: current_model
+// in the config stays as the user set it.
+func EnforceBudget(a *types.Agent) error {
+	current := a.ModelKey()
+	reached := budgetReached(a, current)
+	if reached == "" {
+		return nil
+	}
+
+	fallback := a.Config.BudgetFallback
+	if _, ok := a.Config.Models[fallback]; ok && fallback != current && budgetReached(a, fallback) == "" {
+		if err := UseModel(a, fallback); err == nil {
+			ui.PrintfSafe("%s💸 Model '%s' reached its %s; switched to '%s'%s\n", types.ColorYellow, current, reached, fallback, types.ColorReset)
+			return nil
+		}
+	}
+	return fmt.Errorf("model '%s' reached its %s. Switch models with /models, set budget_fallback, or raise the budget in the config", current, reached)
+}
+
+// sessionTokens is the prompt and completion tokens of the session's responses, over all models
+func sessionTokens(a *types.Agent) int {
+	total := 0
+	for _, stats := range a.ModelCost {
+		total += stats.PromptTokens + stats.CompletionTokens
+	}
+	return total
+}
+
+// sessionLimitReached describes the session limit the session has used up, or returns "" while it
+// is within them. Each time the user chose to go on, the limits allow their amount once more.
+func sessionLimitReached(a *types.Agent) string {
+	rounds := 1 + a.SessionLimitRounds
+	if limit := a.Config.MaxSessionCost * float64(rounds); limit > 0 {
+		if spent := SessionCost(a); spent >= limit {
+			return fmt.Sprintf("session cost limit of %s (%s spent)", FormatCost(limit), FormatCost(spent))
+		}
+	}
+	if limit := a.Config.MaxSessionTokens * rounds; limit > 0 {
+		if used := sessionTokens(a); used >= limit {
+			return fmt.Sprintf("session token limit of %d (%d used)", limit, used)
+		}
+	}
+	return ""
+}
+
+// EnforceSessionLimits is checked before each request. Once the session has reached
+// max_session_cost or max_session_tokens, it asks whether to continue, compact the conversation
+// and continue, or stop. Without a terminal to ask on, as in unattended single-command runs, it
+// stops.
+func EnforceSessionLimits(a *types.Agent) error {
+	reached := sessionLimitReached(a)
+	if reached == "" {
+		return nil
+	}
+
+	ui.PrintfSafe("\n%s🛑 The session reached its %s.%s\n", types.ColorYellow, reached, types.ColorReset)
+	ui.PrintfSafe("❓ Continue (c), compact the conversation and continue (k), or stop (s)? ")
+	answer := readApproval(a)
+	ui.PrintlnSafe()
+	switch answer {
+	case "c", "y":
+		a.SessionLimitRounds++
+		return nil
+	case "k":
+		a.SessionLimitRounds++
+		if err := CompactContext(a); err != nil {
+			ui.PrintfSafe("⚠️  Compaction failed: %v\n", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("stopped at the %s. Raise max_session_cost or max_session_tokens in the config to allow more", reached)
+}
@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"fmt"
+
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// minDedupeLength is the shortest tool result replaced by a reference; shorter ones cost less than
+// the reference would save
+const minDedupeLength = 300
+
+// dedupeTools are the read-only tools whose repeated results are replaced by a reference
+var dedupeTools = map[string]bool{
+	"read_file": true, "list_files": true, "search_code": true, "web_fetch": true,
+	"preview_data": true, "dependencies": true, "env_info": true,
+}
+
+// dedupeToolResult returns a short reference instead of result when the same tool already returned
+// exactly this result earlier in the conversation, e.g. when an unchanged file is read again, and
+// the index of that message (1-based). Otherwise it returns result and 0.
+func dedupeToolResult(messages []types.Message, toolName, result string) (string, int) {
+	if !dedupeTools[toolName] || len(result) < minDedupeLength {
+		return result, 0
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Role == openai.ChatMessageRoleTool && msg.Name == toolName && msg.Content == result {
+			return fmt.Sprintf("[Unchanged since message #%d: this %s result is identical to the result of tool call %s. Use that result; if it is no longer in your context, call the tool again.]",
+				i+1, toolName, msg.ToolCallID), i + 1
+		}
+	}
+	return result, 0
+}
@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"strings"
+
+	"coding-agent/pkg/llm"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// repetitionWindow is how much of the end of a response is checked for a repeating loop
+	repetitionWindow = 4000
+	// maxRepeatPeriod is the longest repeating unit detected, e.g. a paragraph
+	maxRepeatPeriod = 400
+	// minRepeatSpan is the shortest run of repetition that counts as a loop
+	minRepeatSpan = 400
+	// minRepeats is how many times the unit must repeat in a row
+	minRepeats = 6
+)
+
+// degenerateKind is a failure mode of a response that is worth one retry with other sampling
+type degenerateKind string
+
+const (
+	degenerateNone       degenerateKind = ""
+	degenerateEmpty      degenerateKind = "an empty response"
+	degenerateRepetition degenerateKind = "endless repetition"
+	degenerateBadJSON    degenerateKind = "truncated tool call JSON"
+)
+
+// detectDegenerate classifies a response. Tool calls cut off by the output cap are not degenerate:
+// they are handled by continuing or asking the model to re-emit the call.
+func detectDegenerate(content string, toolCalls []openai.ToolCall, truncated bool) degenerateKind {
+	if !truncated && len(toolCalls) == 0 && strings.TrimSpace(content) == "" {
+		return degenerateEmpty
+	}
+	if repeatsAtEnd(content) {
+		return degenerateRepetition
+	}
+	for _, tc := range toolCalls {
+		if repeatsAtEnd(tc.Function.Arguments) {
+			return degenerateRepetition
+		}
+	}
+	if !truncated && len(toolCalls) > 0 && countMalformedToolCalls(toolCalls) == len(toolCalls) {
+		return degenerateBadJSON
+	}
+	return degenerateNone
+}
+
+// repeatsAtEnd reports whether a response ends in the same unit of text repeated over and over,
+// the loop local models fall into
+func repeatsAtEnd(s string) bool {
+	if len(s) > repetitionWindow {
+		s = s[len(s)-repetitionWindow:]
+	}
+	if len(s) < minRepeatSpan {
+		return false
+	}
+	for period := 1; period <= maxRepeatPeriod && period*minRepeats <= len(s); period++ {
+		// Length of the run at the end where every byte equals the one a period earlier
+		run := 0
+		for i := len(s) - 1; i >= period && s[i] == s[i-period]; i-- {
+			run++
+		}
+		span := run + period
+		if span >= max(minRepeatSpan, period*minRepeats) && strings.TrimSpace(s[len(s)-span:]) != "" && !uniformRun(s[len(s)-span:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniformRun reports whether s is a single repeated character, like a long rule of dashes, which is
+// decoration rather than a loop
+func uniformRun(s string) bool {
+	s = strings.TrimSpace(s)
+	return s != "" && strings.Count(s, s[:1]) == len(s)
+}
+
+// retrySampling adjusts a request for a retry after a degenerate response: penalties and a lower
+// temperature break repetition, a lower temperature keeps the output well-formed, and a higher one
+// gets a stuck model to say something.
+func retrySampling(req *llm.Request, kind degenerateKind) {
+	switch kind {
+	case degenerateRepetition:
+		req.Temperature = 0.5
+		req.FrequencyPenalty = 0.6
+		req.PresencePenalty = 0.3
+	case degenerateBadJSON:
+		req.Temperature = 0.2
+	case degenerateEmpty:
+		req.Temperature = 0.9
+	}
+}
+
+// degenerateNote is the corrective system note sent with the retry
+func degenerateNote(kind degenerateKind) string {
+	switch kind {
+	case degenerateRepetition:
+		return "Your previous response got stuck repeating the same text and was discarded. Answer again concisely and do not repeat yourself."
+	case degenerateBadJSON:
+		return "Your previous response contained tool calls whose arguments were not valid JSON and was discarded. Call the tool again with complete, valid JSON arguments."
+	default:
+		return "Your previous response was empty and was discarded. Reply to the user, or call a tool if you need more information."
+	}
+}
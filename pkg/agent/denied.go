@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"coding-agent/pkg/types"
+)
+
+// DefaultDeniedFolders hold credentials and system configuration. They apply until the config
+// lists denied_folders of its own.
+var DefaultDeniedFolders = []string{"~/.ssh", "~/.aws", "~/.gnupg", "~/.kube", "/etc"}
+
+// commandWord splits a command line into words, dropping quotes, operators and the name of an
+// option=value pair
+var commandWord = regexp.MustCompile("[^\\s;&|<>()'\"`=]+")
+
+// DeniedFolders returns the folders no tool may access
+func DeniedFolders(a *types.Agent) []string {
+	if a.Config == nil || a.Config.DeniedFolders == nil {
+		return DefaultDeniedFolders
+	}
+	return a.Config.DeniedFolders
+}
+
+// deniedAccess returns the denied folder a tool call would access, or "" when it stays out of them.
+// File and folder tools are checked by their path; shell tools by the current folder and every
+// word of the command that looks like a path, which catches cat ~/.ssh/id_rsa but not a path a
+// script builds. SQL queries are checked the same way, as SQLite can read and write files, and so
+// is every other single-line argument or list of them, such as the target of open_in_browser, the
+// files of lint or the arguments of custom tools and plugins. Multi-line arguments are file
+// content rather than paths.
+func deniedAccess(a *types.Agent, name string, params map[string]interface{}) string {
+	var paths []string
+	if shellTools[name] {
+		command, _ := params["command"].(string)
+		paths = append([]string{"."}, commandPaths(command)...)
+	} else if name == "sql_query" {
+		query, _ := params["query"].(string)
+		paths = commandPaths(query)
+	} else {
+		if path := toolPath(name, params); path != "" {
+			paths = []string{path}
+		}
+		paths = append(paths, argumentPaths(params)...)
+	}
+	for _, path := range paths {
+		if folder := deniedFolder(a, path); folder != "" {
+			return folder
+		}
+	}
+	return ""
+}
+
+// deniedFolder returns the denied folder path is in, or "". Both are compared as written and with
+// symlinks resolved, so a link cannot lead into a denied folder.
+func deniedFolder(a *types.Agent, path string) string {
+	abs, err := filepath.Abs(expandHome(path))
+	if err != nil {
+		return ""
+	}
+	for _, folder := range DeniedFolders(a) {
+		root, err := filepath.Abs(expandHome(folder))
+		if err != nil {
+			continue
+		}
+		if isPathWithinRoot(abs, root) || isPathWithinRoot(realPath(abs), realPath(root)) {
+			return folder
+		}
+	}
+	return ""
+}
+
+// argumentPaths returns the words that look like paths in the single-line string arguments of a
+// call, and in lists of them
+func argumentPaths(params map[string]interface{}) []string {
+	var paths []string
+	add := func(value interface{}) {
+		if s, ok := value.(string); ok && !strings.Contains(s, "\n") {
+			paths = append(paths, commandPaths(s)...)
+		}
+	}
+	for _, value := range params {
+		if list, ok := value.([]interface{}); ok {
+			for _, item := range list {
+				add(item)
+			}
+			continue
+		}
+		add(value)
+	}
+	return paths
+}
+
+// commandPaths returns the words of a command line that look like paths: those containing a / or
+// starting with ~, with environment variables such as $HOME expanded and file:// URLs read as
+// their path
+func commandPaths(command string) []string {
+	var paths []string
+	for _, word := range commandWord.FindAllString(command, -1) {
+		word = strings.TrimPrefix(os.ExpandEnv(word), "file://")
+		if strings.ContainsRune(word, '/') || strings.HasPrefix(word, "~") {
+			paths = append(paths, word)
+		}
+	}
+	return paths
+}
+
+// DenyFolder adds a folder to denied_folders, starting from the defaults when the config has none
+// yet. Relative folders are made absolute; ~ is kept so the entry reads as the user wrote it. It
+// reports whether the folder was added.
+func DenyFolder(a *types.Agent, folder string) bool {
+	if !strings.HasPrefix(folder, "~") {
+		if abs, err := filepath.Abs(folder); err == nil {
+			folder = abs
+		}
+	}
+	folders := slices.Clone(DeniedFolders(a))
+	if deniedIndex(folders, folder) >= 0 {
+		return false
+	}
+	a.Config.DeniedFolders = append(folders, folder)
+	return true
+}
+
+// UndenyFolder removes a folder from denied_folders. It reports whether the folder was listed.
+func UndenyFolder(a *types.Agent, folder string) bool {
+	folders := slices.Clone(DeniedFolders(a))
+	i := deniedIndex(folders, folder)
+	if i < 0 {
+		return false
+	}
+	a.Config.DeniedFolders = slices.Delete(folders, i, i+1)
+	return true
+}
+
+// deniedIndex finds a folder in a deny list, where ~/.ssh and its absolute path are the same
+func deniedIndex(folders []string, folder string) int {
+	want, err := filepath.Abs(expandHome(folder))
+	if err != nil {
+		return -1
+	}
+	return slices.IndexFunc(folders, func(f string) bool {
+		abs, err := filepath.Abs(expandHome(f))
+		return err == nil && abs == want
+	})
+}
@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/tools"
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Event types of --output-format
+const (
+	EventAssistantText = "assistant_text"
+	EventToolCall      = "tool_call"
+	EventToolResult    = "tool_result"
+	EventUsage         = "usage"
+	EventFinalResult   = "final_result"
+)
+
+// emit passes an event to the run's listener, if there is one
+func emit(a *types.Agent, e types.Event) {
+	if a.OnEvent != nil {
+		a.OnEvent(e)
+	}
+}
+
+// emitAssistantText reports the text of a response of a model
+func emitAssistantText(a *types.Agent, modelKey, content string) {
+	if strings.TrimSpace(content) != "" {
+		emit(a, types.Event{Type: EventAssistantText, Model: modelKey, Text: content})
+	}
+}
+
+// emitToolCalls reports the tool calls of a response
+func emitToolCalls(a *types.Agent, toolCalls []openai.ToolCall) {
+	if a.OnEvent == nil {
+		return
+	}
+	for _, tc := range toolCalls {
+		args := json.RawMessage(tc.Function.Arguments)
+		if !json.Valid(args) {
+			// Malformed arguments are passed on as a JSON string so the event stays valid
+			args = json.RawMessage(jsonString(tc.Function.Arguments))
+		}
+		emit(a, types.Event{Type: EventToolCall, ID: tc.ID, Name: tc.Function.Name, Arguments: args})
+	}
+}
+
+// emitToolResults reports the tool results added to the conversation from message index from on
+func emitToolResults(a *types.Agent, from int) {
+	if a.OnEvent == nil {
+		return
+	}
+	msgs := a.Messages()
+	names := make(map[string]string)
+	for _, m := range msgs {
+		for _, tc := range m.ToolCalls {
+			names[tc.ID] = tc.Function.Name
+		}
+	}
+	for _, m := range msgs[min(from, len(msgs)):] {
+		if m.Role != openai.ChatMessageRoleTool {
+			continue
+		}
+		name := m.Name
+		if name == "" {
+			name = names[m.ToolCallID]
+		}
+		emit(a, types.Event{Type: EventToolResult, ID: m.ToolCallID, Name: name, Content: m.Content, IsError: strings.HasPrefix(m.Content, "Error:")})
+	}
+}
+
+// runToolCalls runs the tool calls of a response, reporting them and their results as events
+func runToolCalls(ctx context.Context, a *types.Agent, toolCalls []openai.ToolCall, toolManager *tools.Manager, tokenStats string, truncated bool) error {
+	emitToolCalls(a, toolCalls)
+	answered := len(a.Messages())
+	toolsStart := time.Now()
+	err := handleToolCalls(ctx, a, toolCalls, toolManager, tokenStats, truncated)
+	recordToolTiming(a, toolsStart)
+	emitToolResults(a, answered)
+	return err
+}
+
+// FinalResult sums up a run that ended with err after duration: the last answer of the model and
+// the tokens and cost of the session
+func FinalResult(a *types.Agent, err error, duration time.Duration) types.Event {
+	e := types.Event{Type: EventFinalResult, Model: a.ModelKey(), DurationMS: duration.Milliseconds(), CostUSD: SessionCost(a)}
+	msgs := a.Messages()
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == openai.ChatMessageRoleAssistant && strings.TrimSpace(msgs[i].Content) != "" {
+			e.Text = msgs[i].Content
+			break
+		}
+	}
+	for _, stats := range a.ModelCost {
+		e.PromptTokens += stats.PromptTokens
+		e.CompletionTokens += stats.CompletionTokens
+	}
+	if err != nil {
+		e.IsError = true
+		e.Error = err.Error()
+	}
+	return e
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"fmt"
+
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// fallbackAttempts is how many requests in a row a model may fail before the turn moves on to the
+// next model of fallback_models
+const fallbackAttempts = 2
+
+// modelFailover tracks the failed requests of one turn for the fallback chain
+type modelFailover struct {
+	failures int             // Failed requests in a row to the current model
+	failed   map[string]bool // Models that used up their attempts this turn
+}
+
+// succeeded resets the count once the current model answered
+func (f *modelFailover) succeeded() {
+	f.failures = 0
+}
+
+// retry records a failed request and reports whether the turn should be tried again. Without
+// fallback_models it never is. With them, the same model is retried until it failed
+// fallbackAttempts times in a row, then the session switches to the next model of the chain and
+// the switch is noted in the conversation. Like --model, the switch does not change current_model
+// in the config. It returns false once no model is left to try.
+func (f *modelFailover) retry(a *types.Agent, err error) bool {
+	if len(a.Config.FallbackModels) == 0 {
+		return false
+	}
+	current := a.ModelKey()
+	f.failures++
+	if f.failures < fallbackAttempts {
+		ui.PrintfSafe("\n%s⚠️  Request to '%s' failed: %v. Retrying...%s\n", types.ColorYellow, current, err, types.ColorReset)
+		return true
+	}
+
+	if f.failed == nil {
+		f.failed = make(map[string]bool)
+	}
+	f.failed[current] = true
+	next := nextFallbackModel(a, current, f.failed)
+	if next == "" || UseModel(a, next) != nil {
+		return false
+	}
+	f.failures = 0
+
+	ui.PrintfSafe("\n%s🔀 '%s' failed %d times in a row (%v); retrying the turn with '%s'%s\n", types.ColorYellow, current, fallbackAttempts, err, next, types.ColorReset)
+	a.AddMessage(types.Message{
+		Role: openai.ChatMessageRoleSystem,
+		Content: fmt.Sprintf("The session switched from model '%s' to '%s' because '%s' kept failing (%v). "+
+			"Continue the task from where the conversation stands.", current, next, current, err),
+	})
+	return true
+}
+
+// nextFallbackModel picks the model to switch to after current failed: the first model listed
+// after current in fallback_models (from the start when current is not listed) that is configured,
+// has not failed this turn and is within its spend budgets. It returns "" when there is none.
+func nextFallbackModel(a *types.Agent, current string, failed map[string]bool) string {
+	chain := a.Config.FallbackModels
+	start := 0
+	for i, key := range chain {
+		if key == current {
+			start = i + 1
+		}
+	}
+	for _, key := range chain[start:] {
+		if _, ok := a.Config.Models[key]; !ok || key == current || failed[key] {
+			continue
+		}
+		if budgetReached(a, key) != "" {
+			continue
+		}
+		return key
+	}
+	return ""
+}
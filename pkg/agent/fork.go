@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxPinnedFileBytes limits how much of each pinned file a fork carries over
+const maxPinnedFileBytes = 64 * 1024
+
+const forkPrompt = "Summarize the above conversation for a fresh session that will continue the work without seeing it. \n" +
+	"Include: the user's goal and any instructions or constraints they gave; what has been done so far and which files were changed; " +
+	"key technical decisions and why; what was tried and did not work; and the concrete next steps. \n" +
+	"Be specific about file paths, function names and commands. Leave out tool output and code that is no longer needed."
+
+// ForkContext replaces the conversation with a fresh one that starts from a summary of the current
+// one and the current content of the pinned files
+func ForkContext(a *types.Agent, pinned []string) error {
+	var toSummarize []types.Message
+	for _, msg := range a.Messages() {
+		if msg.Role != openai.ChatMessageRoleSystem {
+			toSummarize = append(toSummarize, msg)
+		}
+	}
+	if len(toSummarize) < 2 {
+		return fmt.Errorf("conversation too short to fork")
+	}
+
+	// Read the pinned files first, so a typo does not cost a summary
+	var files strings.Builder
+	for _, path := range pinned {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot pin %s: %v", path, err)
+		}
+		content := string(data)
+		if len(content) > maxPinnedFileBytes {
+			content = content[:maxPinnedFileBytes] + "\n... (truncated; read the file for the rest)"
+		}
+		fmt.Fprintf(&files, "\n\n### %s\n```\n%s\n```", path, strings.TrimRight(content, "\n"))
+	}
+
+	ui.PrintfSafe("\n🍴 Forking the session... please wait\n")
+	summary, err := summarize(a, toSummarize, forkPrompt, "Summarizing the session...")
+	if err != nil {
+		return err
+	}
+
+	context := "This session continues an earlier one. Here is a summary of it:\n\n" + summary
+	if files.Len() > 0 {
+		context += "\n\nThe user pinned these files; their current content is:" + files.String()
+	}
+	InitConversation(a)
+	a.AddMessage(types.Message{Role: openai.ChatMessageRoleSystem, Content: context})
+
+	ui.PrintfSafe("✅ Forked into a new session: %d messages → %d (%d tokens)\n", len(toSummarize), len(a.Messages()), tokenCounter(a).CountMessages(a.Messages()))
+	UpdateStatusDisplay(a)
+	return nil
+}
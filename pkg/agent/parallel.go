@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"coding-agent/pkg/imageutil"
+	"coding-agent/pkg/tools"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// parallelTools only read files and keep no per-call state in the tool manager, so several calls
+// can run at once
+var parallelTools = map[string]bool{
+	"read_file": true, "list_files": true, "search_code": true, "preview_data": true, "dependencies": true,
+}
+
+// maxParallelTools is how many tool calls run at the same time
+const maxParallelTools = 4
+
+// prefetchParallelTools runs the calls of a turn that only read and would run without asking
+// concurrently, before handleToolCalls goes through the calls in order. It returns their results
+// keyed by index in toolCalls (call IDs can repeat, as Gemini's do), formatted as executeToolBasedOnResponse formats them; handleToolCalls then shows
+// and records them in order instead of running the calls again. Only the reads before the first
+// call that needs a prompt, failed to parse, attaches images or may write are prefetched, so no
+// read runs ahead of an edit or command that comes before it in the turn.
+func prefetchParallelTools(ctx context.Context, a *types.Agent, toolCalls []openai.ToolCall, toolManager *tools.Manager) map[int]string {
+	if a.Config.SequentialTools {
+		return nil
+	}
+
+	type job struct {
+		index  int
+		call   openai.ToolCall
+		params map[string]interface{}
+	}
+	var jobs []job
+	for i, tc := range toolCalls {
+		params, ok := runsUnattendedReadOnly(a, tc, toolManager)
+		if !ok {
+			break
+		}
+		jobs = append(jobs, job{i, tc, params})
+	}
+	if len(jobs) < 2 {
+		return nil
+	}
+
+	spinner := ui.NewSpinner(fmt.Sprintf("Running %d read-only tool calls in parallel...", len(jobs)))
+	spinner.Start()
+
+	results := make(map[int]string, len(jobs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, maxParallelTools)
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if ctx.Err() != nil {
+				return
+			}
+			tool, _ := toolManager.GetTool(j.call.Function.Name)
+			result, err := tool.Execute(ctx, j.params)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				result = fmt.Sprintf("Error: %v", err)
+			}
+			mu.Lock()
+			results[j.index] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	spinner.Stop()
+	return results
+}
+
+// runsUnattendedReadOnly reports whether a call would run in handleToolCalls without any prompt and
+// only reads: a parallel tool whose arguments are valid, whose folder is approved or allowed by a
+// permission rule and whose policy and rules do not ask or deny. It returns the call's arguments.
+func runsUnattendedReadOnly(a *types.Agent, tc openai.ToolCall, toolManager *tools.Manager) (map[string]interface{}, bool) {
+	name := tc.Function.Name
+	if !parallelTools[name] {
+		return nil, false
+	}
+	if _, ok := toolManager.GetTool(name); !ok {
+		return nil, false
+	}
+	if policy := toolPolicy(a, name); policy == types.ToolPolicyDeny || policy == types.ToolPolicyConfirm {
+		return nil, false
+	}
+	params, repaired, err := parseToolArguments(tc.Function.Arguments)
+	if err != nil || repaired || params == nil || toolManager.ValidateParams(name, params) != nil {
+		return nil, false
+	}
+	if deniedAccess(a, name, params) != "" {
+		return nil, false
+	}
+	rule, ruled := permissionRule(a, name, params)
+	if ruled && rule.Action != types.PermissionAllow {
+		return nil, false
+	}
+	folder := toolFolder(name, params)
+	if folder == "" || !(ruled || IsFolderApproved(a, folder)) {
+		return nil, false
+	}
+	// Attached images belong to the call that is executing, so image reads run on their own
+	if path, _ := params["path"].(string); name == "read_file" && imageutil.IsImagePath(path) {
+		return nil, false
+	}
+	return params, true
+}
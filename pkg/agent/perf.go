@@ -0,0 +1,275 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/llm"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+	"coding-agent/pkg/usage"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// logUsage adds a response to the session's cost and to the cross-session usage log read by
+// `mcode usage`. Failing to record is not worth interrupting the session for.
+func logUsage(a *types.Agent, modelKey string, requestStart time.Time, promptTokens, completionTokens int) {
+	cost := addCost(a, modelKey, promptTokens, completionTokens)
+	emit(a, types.Event{Type: EventUsage, Model: modelKey, PromptTokens: promptTokens, CompletionTokens: completionTokens, CostUSD: cost})
+	usage.Record(usage.Entry{
+		Time:             time.Now(),
+		Model:            modelKey,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Cost:             cost,
+		Seconds:          time.Since(requestStart).Seconds(),
+	})
+}
+
+// addCost adds a response to the model's session totals and returns what it cost
+func addCost(a *types.Agent, modelKey string, promptTokens, completionTokens int) float64 {
+	cost := usage.Cost(a.Config.Models[modelKey], promptTokens, completionTokens)
+	if a.ModelCost == nil {
+		a.ModelCost = make(map[string]*types.CostStats)
+	}
+	stats, ok := a.ModelCost[modelKey]
+	if !ok {
+		stats = &types.CostStats{}
+		a.ModelCost[modelKey] = stats
+	}
+	stats.Responses++
+	stats.PromptTokens += promptTokens
+	stats.CompletionTokens += completionTokens
+	stats.Cost += cost
+	return cost
+}
+
+// SessionCost is what the session's responses cost in USD, over all models
+func SessionCost(a *types.Agent) float64 {
+	total := 0.0
+	for _, stats := range a.ModelCost {
+		total += stats.Cost
+	}
+	return total
+}
+
+// FormatCost renders a USD amount, with more decimals for the fractions of a cent a turn can cost
+func FormatCost(cost float64) string {
+	if cost < 1 {
+		return fmt.Sprintf("$%.4f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
+
+// recordGeneration stores the speed of a streamed response. The token rate is measured from the
+// first token, so prompt processing time shows up only in the time to first token.
+func recordGeneration(a *types.Agent, modelKey string, requestStart, firstToken time.Time, tokens int) {
+	if firstToken.IsZero() {
+		return
+	}
+	stats := types.GenerationStats{TimeToFirstToken: firstToken.Sub(requestStart)}
+	if elapsed := time.Since(firstToken).Seconds(); elapsed > 0 && tokens > 1 {
+		stats.TokensPerSecond = float64(tokens-1) / elapsed
+	}
+
+	a.LastGeneration = &stats
+	if a.ModelPerf == nil {
+		a.ModelPerf = make(map[string]*types.ModelPerf)
+	}
+	perf, ok := a.ModelPerf[modelKey]
+	if !ok {
+		perf = &types.ModelPerf{}
+		a.ModelPerf[modelKey] = perf
+	}
+	perf.Add(stats)
+}
+
+// recordCache adds a provider-reported usage to the model's prompt cache statistics
+func recordCache(a *types.Agent, modelKey string, usage *openai.Usage) {
+	if usage == nil || usage.PromptTokens == 0 {
+		return
+	}
+	if a.ModelCache == nil {
+		a.ModelCache = make(map[string]*types.CacheStats)
+	}
+	stats, ok := a.ModelCache[modelKey]
+	if !ok {
+		stats = &types.CacheStats{}
+		a.ModelCache[modelKey] = stats
+	}
+	stats.Responses++
+	stats.PromptTokens += usage.PromptTokens
+	stats.CachedTokens += llm.CachedTokens(usage)
+}
+
+// FormatCacheStats renders prompt cache statistics as "12.3k of 40.1k prompt tokens cached (31%)"
+func FormatCacheStats(stats types.CacheStats) string {
+	return fmt.Sprintf("%s of %s prompt tokens cached (%.0f%%)", formatTokenCount(stats.CachedTokens), formatTokenCount(stats.PromptTokens), stats.HitRate()*100)
+}
+
+func formatTokenCount(n int) string {
+	if n >= 1000 {
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+// FormatGenerationStats renders generation speed as "42.1 t/s | TTFT 0.82s"
+func FormatGenerationStats(stats types.GenerationStats) string {
+	return fmt.Sprintf("%.1f t/s | TTFT %.2fs", stats.TokensPerSecond, stats.TimeToFirstToken.Seconds())
+}
+
+// startTurn begins the latency breakdown of a response of a model when --perf is on
+func startTurn(a *types.Agent, modelKey string) {
+	if a.Perf {
+		a.PerfTurns = append(a.PerfTurns, types.TurnTiming{Model: modelKey})
+	}
+}
+
+// currentTurn returns the breakdown being recorded, nil without --perf
+func currentTurn(a *types.Agent) *types.TurnTiming {
+	if !a.Perf || len(a.PerfTurns) == 0 {
+		return nil
+	}
+	return &a.PerfTurns[len(a.PerfTurns)-1]
+}
+
+// recordResponseTiming splits the time of a response into queueing, time to first token and
+// generation. A response that produced no tokens counts as time to first token.
+func recordResponseTiming(a *types.Agent, requestStart, responseStart, firstToken, end time.Time) {
+	turn := currentTurn(a)
+	if turn == nil {
+		return
+	}
+	if firstToken.IsZero() {
+		firstToken = end
+	}
+	turn.Queue = responseStart.Sub(requestStart)
+	turn.TTFT = firstToken.Sub(responseStart)
+	turn.Generation = end.Sub(firstToken)
+}
+
+// recordToolTiming records the time since start as tool execution. Approval prompts are all
+// answered while the tools of a turn run, so their wait is taken out.
+func recordToolTiming(a *types.Agent, start time.Time) {
+	if turn := currentTurn(a); turn != nil {
+		turn.Tools = max(0, time.Since(start)-turn.Approval)
+	}
+}
+
+// readApproval reads the answer to a prompt, counting the wait as approval time with --perf. In
+// non-interactive mode nothing is read and every prompt is answered with no.
+func readApproval(a *types.Agent) string {
+	if a.Headless {
+		return "n"
+	}
+	start := time.Now()
+	ui.PauseInterruptMonitor()
+	response := ui.ReadConfirmation()
+	ui.ResumeInterruptMonitor()
+	if turn := currentTurn(a); turn != nil {
+		turn.Approval += time.Since(start)
+	}
+	return response
+}
+
+// FormatTurnTimings renders latency breakdowns as a table with a total and the share of each
+// phase. With byModel the turns are totalled per model instead of listed one by one.
+func FormatTurnTimings(turns []types.TurnTiming, byModel bool) string {
+	type row struct {
+		label  string
+		timing types.TurnTiming
+	}
+	var rows []row
+	var total types.TurnTiming
+	index := make(map[string]int)
+	for i, t := range turns {
+		total = addTiming(total, t)
+		if !byModel {
+			rows = append(rows, row{fmt.Sprintf("%d %s", i+1, t.Model), t})
+			continue
+		}
+		if j, ok := index[t.Model]; ok {
+			rows[j].timing = addTiming(rows[j].timing, t)
+			continue
+		}
+		index[t.Model] = len(rows)
+		rows = append(rows, row{fmt.Sprintf("%s (%d turns)", t.Model, countTurns(turns, t.Model)), t})
+	}
+
+	var b strings.Builder
+	line := func(label string, values ...string) {
+		fmt.Fprintf(&b, "  %-28s", label)
+		for _, v := range values {
+			fmt.Fprintf(&b, " %9s", v)
+		}
+		b.WriteString("\n")
+	}
+	header := "Turn"
+	if byModel {
+		header = "Model"
+	}
+	line(header, "Queue", "TTFT", "Generate", "Tools", "Approval", "Total")
+	for _, r := range rows {
+		line(r.label, timingColumns(r.timing)...)
+	}
+	line("Total", timingColumns(total)...)
+
+	if all := total.Total(); all > 0 {
+		share := func(d time.Duration) string {
+			return fmt.Sprintf("%.0f%%", float64(d)/float64(all)*100)
+		}
+		line("Share", share(total.Queue), share(total.TTFT), share(total.Generation), share(total.Tools), share(total.Approval), "")
+		b.WriteString("  " + perfVerdict(total) + "\n")
+	}
+	return b.String()
+}
+
+func timingColumns(t types.TurnTiming) []string {
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	}
+	return []string{format(t.Queue), format(t.TTFT), format(t.Generation), format(t.Tools), format(t.Approval), format(t.Total())}
+}
+
+func addTiming(a, b types.TurnTiming) types.TurnTiming {
+	a.Queue += b.Queue
+	a.TTFT += b.TTFT
+	a.Generation += b.Generation
+	a.Tools += b.Tools
+	a.Approval += b.Approval
+	return a
+}
+
+func countTurns(turns []types.TurnTiming, model string) int {
+	n := 0
+	for _, t := range turns {
+		if t.Model == model {
+			n++
+		}
+	}
+	return n
+}
+
+// perfVerdict names where most of the time went
+func perfVerdict(t types.TurnTiming) string {
+	all := float64(t.Total())
+	percent := func(d time.Duration) float64 { return float64(d) / all * 100 }
+
+	switch {
+	case t.Approval >= t.ModelTime() && t.Approval >= t.Tools:
+		return fmt.Sprintf("Most of the time (%.0f%%) went to waiting for your answers.", percent(t.Approval))
+	case t.Tools >= t.ModelTime():
+		return fmt.Sprintf("Most of the time (%.0f%%) went to running tools.", percent(t.Tools))
+	}
+	detail := "generating the response"
+	switch {
+	case t.Queue >= t.TTFT && t.Queue >= t.Generation:
+		detail = "before the provider started responding; the endpoint may be busy or far away"
+	case t.TTFT >= t.Generation:
+		detail = "processing the prompt; a smaller context or prompt caching helps"
+	}
+	return fmt.Sprintf("Most of the time (%.0f%%) went to the model, mostly %s.", percent(t.ModelTime()), detail)
+}
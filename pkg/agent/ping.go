@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/llm"
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// PingCheck is the outcome of one step of an endpoint health check
+type PingCheck struct {
+	Name    string
+	OK      bool
+	Skipped bool // The check could not be run; not a failure
+	Detail  string
+	Latency time.Duration
+}
+
+// pingTool is offered to the model by the tool calling probe
+var pingTool = openai.Tool{
+	Type: openai.ToolTypeFunction,
+	Function: &openai.FunctionDefinition{
+		Name:        "ping",
+		Description: "Health check. Call it with reply set to \"pong\".",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"reply": map[string]interface{}{"type": "string"}},
+			"required":   []string{"reply"},
+		},
+	},
+}
+
+// Ping checks that a model's endpoint is reachable and serves the model. With probe set it also
+// sends a tiny request asking for a tool call, which verifies generation and tool calling.
+// Checks after a failed connection are not run.
+func Ping(ctx context.Context, model types.Model, probe bool) []PingCheck {
+	var checks []PingCheck
+
+	if model.BaseURL != "" {
+		start := time.Now()
+		reachable := llm.Reachable(model.BaseURL, 3*time.Second)
+		check := PingCheck{Name: "Endpoint reachable", OK: reachable, Latency: time.Since(start), Detail: model.BaseURL}
+		if !reachable {
+			check.Detail = model.BaseURL + " refused or timed out"
+			return append(checks, check)
+		}
+		checks = append(checks, check)
+
+		listCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		checks = append(checks, checkModelListed(listCtx, model))
+		cancel()
+	}
+
+	if probe {
+		checks = append(checks, probeToolCall(ctx, model))
+	}
+	return checks
+}
+
+// checkModelListed looks for the model in the endpoint's model list. Servers that do not
+// list models (or need a different key for it) skip the check rather than fail it.
+func checkModelListed(ctx context.Context, model types.Model) PingCheck {
+	check := PingCheck{Name: "Model available"}
+	start := time.Now()
+	models, err := llm.ListModels(ctx, model.BaseURL, model.APIKey)
+	check.Latency = time.Since(start)
+	if err != nil {
+		check.Skipped = true
+		check.Detail = fmt.Sprintf("could not list models: %v", err)
+		return check
+	}
+
+	ids := make([]string, 0, len(models))
+	for _, m := range models {
+		if m.ID == model.Name {
+			check.OK = true
+			check.Detail = model.Name
+			return check
+		}
+		ids = append(ids, m.ID)
+	}
+	if len(ids) > 5 {
+		ids = append(ids[:5], "...")
+	}
+	check.Detail = fmt.Sprintf("%s is not loaded; the server has: %s", model.Name, strings.Join(ids, ", "))
+	if len(models) == 0 {
+		check.Detail = fmt.Sprintf("%s is not loaded; the server reports no models", model.Name)
+	}
+	return check
+}
+
+// probeToolCall asks the model to call pingTool
+func probeToolCall(ctx context.Context, model types.Model) PingCheck {
+	check := PingCheck{Name: "Tool calling"}
+	req := llm.Request{
+		Model: model.Name,
+		Messages: []llm.Message{
+			{Role: openai.ChatMessageRoleUser, Content: "This is a connectivity test. Call the ping tool with reply \"pong\" and nothing else."},
+		},
+		Tools:     []openai.Tool{pingTool},
+		MaxTokens: 256,
+	}
+	if strings.EqualFold(model.ToolMode, types.ToolModeReAct) {
+		// Text-mode models get no tool schema; a plain completion shows the model responds
+		check.Name = "Completion"
+		req.Tools = nil
+		req.Messages[0].Content = "This is a connectivity test. Reply with the single word pong."
+	}
+	if usesPromptTools(model) {
+		// The tool is described in the prompt and its call parsed from the text
+		probe := promptToolMessages([]types.Message{{Role: openai.ChatMessageRoleUser, Content: req.Messages[0].Content}}, req.Tools)
+		req.Messages = convertToLLMMessages(probe)
+		req.Tools = nil
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	start := time.Now()
+	resp, err := NewProvider(model).CreateCompletion(probeCtx, req)
+	check.Latency = time.Since(start)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+
+	if usesPromptTools(model) {
+		_, resp.ToolCalls = parseTextToolCalls(resp.Content)
+	}
+
+	switch {
+	case usesPromptTools(model) && len(resp.ToolCalls) > 0:
+		check.OK = true
+		check.Detail = "model called the test tool (tool_mode prompt)"
+	case usesPromptTools(model):
+		check.Detail = "the model answered without a <tool_call> block; try \"tool_mode\": \"react\""
+	case req.Tools == nil:
+		check.OK = strings.TrimSpace(resp.Content) != "" || resp.Reasoning != ""
+		check.Detail = "model responded (tool_mode react, native tool calling not probed)"
+		if !check.OK {
+			check.Detail = "empty response"
+		}
+	case len(resp.ToolCalls) > 0:
+		check.OK = true
+		check.Detail = "model called the test tool"
+	default:
+		check.Detail = "the model answered without calling the tool; if it does not support function calling, set \"tool_mode\": \"prompt\" or \"react\""
+	}
+	return check
+}
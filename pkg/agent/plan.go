@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"coding-agent/pkg/i18n"
+	"coding-agent/pkg/tools"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// readOnlyTools never change files, run programs or act outside mcode
+var readOnlyTools = map[string]bool{
+	"read_file": true, "list_files": true, "search_code": true, "preview_edit": true, "preview_data": true,
+	"dependencies": true, "env_info": true, "web_search": true, "web_fetch": true, "clipboard_read": true,
+}
+
+// readOnlyCommands are shell commands that only inspect; a command is safe when every part of
+// its pipeline is one of them
+var readOnlyCommands = map[string]bool{
+	"ls": true, "cat": true, "head": true, "tail": true, "grep": true, "rg": true, "find": true, "wc": true,
+	"pwd": true, "echo": true, "which": true, "file": true, "stat": true, "du": true, "df": true,
+	"cut": true, "diff": true, "whoami": true, "uname": true,
+}
+
+// readOnlyGit are the git subcommands that do not change the repository
+var readOnlyGit = map[string]bool{"status": true, "log": true, "diff": true, "show": true, "blame": true, "rev-parse": true, "ls-files": true}
+
+// commandSeparators split a shell command at its separators whether or not they are quoted, which
+// also finds commands a line hands to another shell, as in bash -c 'rm -r src'
+var commandSeparators = regexp.MustCompile(`&&|\|\||[;|&\n]`)
+
+// splitCommands splits a shell command line into the commands it runs, at the &&, ||, ;, |, & and
+// newlines outside quotes. plain reports that the line has no redirection to a file, no command or
+// process substitution and no unclosed quote, any of which could write or run what the parts do not
+// show.
+func splitCommands(command string) (parts []string, plain bool) {
+	plain = true
+	var current strings.Builder
+	flush := func() {
+		if part := strings.TrimSpace(current.String()); part != "" {
+			parts = append(parts, part)
+		}
+		current.Reset()
+	}
+	var quote byte
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		next := byte(0)
+		if i+1 < len(command) {
+			next = command[i+1]
+		}
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '\\' && next != 0:
+			current.WriteByte(c)
+			i++
+			c = next
+		case c == '`' || c == '$' && next == '(':
+			plain = false
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '>' || c == '<' && next == '(':
+			plain = false
+		case c == ';' || c == '\n' || c == '&' || c == '|':
+			if next == c && c != ';' && c != '\n' {
+				i++
+			}
+			flush()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	flush()
+	return parts, plain && quote == 0
+}
+
+// isSafeToolCall reports whether a tool call only reads: it changes no files and runs nothing that could
+func isSafeToolCall(name string, params map[string]interface{}) bool {
+	switch {
+	case readOnlyTools[name]:
+		return true
+	case name == "sql_query":
+		query, _ := params["query"].(string)
+		return tools.IsReadOnlySQL(query)
+	case name == "bash_command":
+		command, _ := params["command"].(string)
+		return isReadOnlyCommand(command)
+	}
+	return false
+}
+
+// isReadOnlyCommand reports whether every command in a shell command line only inspects
+func isReadOnlyCommand(command string) bool {
+	parts, plain := splitCommands(command)
+	if !plain || len(parts) == 0 {
+		return false
+	}
+	for _, part := range parts {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case fields[0] == "git":
+			if len(fields) < 2 || !readOnlyGit[fields[1]] {
+				return false
+			}
+			// --output writes the diff or log to a file
+			for _, f := range fields[2:] {
+				if f == "-o" || f == "--output" || strings.HasPrefix(f, "--output=") {
+					return false
+				}
+			}
+		case fields[0] == "rg":
+			// --pre runs a program on every file searched
+			for _, f := range fields[1:] {
+				if f == "--pre" || f == "--pre-glob" || strings.HasPrefix(f, "--pre=") || strings.HasPrefix(f, "--pre-glob=") {
+					return false
+				}
+			}
+		case fields[0] == "find":
+			for _, f := range fields[1:] {
+				if f == "-delete" || strings.HasPrefix(f, "-exec") || strings.HasPrefix(f, "-ok") || strings.HasPrefix(f, "-fprint") || f == "-fls" {
+					return false
+				}
+			}
+		case !readOnlyCommands[fields[0]]:
+			return false
+		}
+	}
+	return true
+}
+
+// planStep is one tool call of a turn as shown in the plan
+type planStep struct {
+	name    string
+	info    string
+	safe    bool
+	invalid bool
+}
+
+// formatToolPlan renders the numbered plan of a turn's tool calls
+func formatToolPlan(steps []planStep) string {
+	width := 0
+	for _, s := range steps {
+		width = max(width, len(s.name))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s%s\n", types.ColorCyan, i18n.T("approval.plan", len(steps)), types.ColorReset)
+	for i, s := range steps {
+		class, color := "safe", types.ColorGreen
+		switch {
+		case s.invalid:
+			class, color = "invalid", types.ColorYellow
+		case !s.safe:
+			class, color = "destructive", types.ColorRed
+		}
+		info := strings.TrimSpace(s.info)
+		if len(info) > 80 {
+			info = info[:77] + "..."
+		}
+		fmt.Fprintf(&b, "  %d. %-*s  %s%-11s%s %s\n", i+1, width, s.name, color, class, types.ColorReset, info)
+	}
+	return b.String()
+}
+
+// planToolCalls classifies the tool calls of a turn for its plan. It returns the steps, the
+// indexes in toolCalls of the safe ones and how many are destructive. Steps are identified by
+// index because call IDs need not be unique: Gemini names calls after their tool, and some local
+// servers send empty or repeated IDs.
+func planToolCalls(toolCalls []openai.ToolCall, toolManager *tools.Manager) (steps []planStep, safe []int, destructive int) {
+	for i, tc := range toolCalls {
+		if tc.Function.Name == tools.ScratchpadToolName {
+			continue
+		}
+		step := planStep{name: tc.Function.Name}
+		params, _, err := parseToolArguments(tc.Function.Arguments)
+		if err != nil {
+			step.invalid = true
+		} else {
+			step.info = toolManager.GetDisplayInfo(tc.Function.Name, params)
+			step.safe = isSafeToolCall(tc.Function.Name, params)
+		}
+		if step.safe {
+			safe = append(safe, i)
+		} else if !step.invalid {
+			destructive++
+		}
+		steps = append(steps, step)
+	}
+	return steps, safe, destructive
+}
+
+// previewToolPlan shows the plan of a turn with several tool calls before the first approval
+// prompt. When it mixes safe and destructive steps, the user can let the safe ones run without
+// asking; their indexes in toolCalls are returned. Destructive steps are still confirmed one by one.
+func previewToolPlan(a *types.Agent, toolCalls []openai.ToolCall, toolManager *tools.Manager) (map[int]bool, error) {
+	steps, safe, destructive := planToolCalls(toolCalls, toolManager)
+	if len(steps) < 2 {
+		return nil, nil
+	}
+
+	ui.PrintfSafe("\n%s", formatToolPlan(steps))
+	if len(safe) == 0 || destructive == 0 || a.AutoApprove {
+		return nil, nil
+	}
+
+	ui.PrintSafe(i18n.T("approval.plan.prompt", len(safe)))
+	playNotificationSound()
+	announce(a, i18n.T("speech.plan", len(steps)))
+	response := readApproval(a)
+	// Enter declines: the safe steps are then confirmed like the others
+	if response == "\r" || response == "\n" || response == "" {
+		response = "n"
+	}
+	switch response {
+	case "i":
+		ui.PrintlnSafe("cancel")
+		return nil, ui.ErrInterrupted
+	case "y", "yes":
+		ui.PrintlnSafe("y")
+		approved := make(map[int]bool, len(safe))
+		for _, i := range safe {
+			approved[i] = true
+		}
+		return approved, nil
+	}
+	ui.PrintlnSafe(response)
+	return nil, nil
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// usesPromptTools reports whether tool calls are emulated with <tool_call> markup described in the
+// system prompt
+func usesPromptTools(model types.Model) bool {
+	return strings.EqualFold(model.ToolMode, types.ToolModePrompt)
+}
+
+// emulatesTools reports whether a model gets its tools through the prompt instead of natively
+func emulatesTools(model types.Model) bool {
+	return usesReActTools(model) || usesPromptTools(model)
+}
+
+// emulatedToolMessages rewrites the conversation for a model whose tool calling is emulated
+func emulatedToolMessages(model types.Model, messages []types.Message, toolDefs []openai.Tool) []types.Message {
+	if usesReActTools(model) {
+		return reactMessages(messages, toolDefs)
+	}
+	return promptToolMessages(messages, toolDefs)
+}
+
+// promptToolPrompt lists the tools in the Hermes format most open chat templates were trained on,
+// so models whose server breaks on OpenAI tools can still call them
+func promptToolPrompt(toolDefs []openai.Tool) string {
+	var sb strings.Builder
+	sb.WriteString("# Tools\n\n")
+	sb.WriteString("You may call one or more functions to assist with the user query. ")
+	sb.WriteString("The function signatures are given as JSON schemas within <tools></tools> XML tags:\n<tools>\n")
+	for _, tool := range toolDefs {
+		if tool.Function == nil {
+			continue
+		}
+		signature, err := json.Marshal(map[string]interface{}{
+			"name":        tool.Function.Name,
+			"description": tool.Function.Description,
+			"parameters":  tool.Function.Parameters,
+		})
+		if err != nil {
+			continue
+		}
+		sb.Write(signature)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("</tools>\n\n")
+	sb.WriteString("For each function call, return a JSON object with the function name and arguments within <tool_call></tool_call> XML tags:\n")
+	sb.WriteString("<tool_call>\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"main.go\"}}\n</tool_call>\n\n")
+	sb.WriteString("After your tool calls, stop and wait: the results arrive in the next message within <tool_response></tool_response> tags. ")
+	sb.WriteString("Never write tool responses yourself. When no tool is needed, answer normally without tool calls.")
+	return sb.String()
+}
+
+// formatPromptToolCalls renders tool calls as <tool_call> blocks
+func formatPromptToolCalls(toolCalls []openai.ToolCall) string {
+	blocks := make([]string, 0, len(toolCalls))
+	for _, tc := range toolCalls {
+		args := strings.TrimSpace(tc.Function.Arguments)
+		if args == "" {
+			args = "{}"
+		}
+		blocks = append(blocks, fmt.Sprintf("<tool_call>\n{\"name\": %q, \"arguments\": %s}\n</tool_call>", tc.Function.Name, args))
+	}
+	return strings.Join(blocks, "\n")
+}
+
+// promptToolMessages rewrites the conversation for tool calls emulated in the prompt. The tool
+// list is appended to the system prompt, assistant tool calls are sent as <tool_call> blocks and
+// tool results become user messages with <tool_response> blocks, so no OpenAI tool fields are sent.
+func promptToolMessages(messages []types.Message, toolDefs []openai.Tool) []types.Message {
+	res := make([]types.Message, 0, len(messages))
+	toolPrompt := promptToolPrompt(toolDefs)
+	injected := false
+	callNames := make(map[string]string)
+
+	for _, m := range messages {
+		switch {
+		case m.Role == openai.ChatMessageRoleSystem && !injected:
+			m.Content = m.Content + "\n\n" + toolPrompt
+			injected = true
+		case m.Role == openai.ChatMessageRoleAssistant:
+			for _, tc := range m.ToolCalls {
+				callNames[tc.ID] = tc.Function.Name
+			}
+			// The markup was removed from the content when the calls were parsed
+			if len(m.ToolCalls) > 0 {
+				m.Content = strings.TrimSpace(m.Content + "\n" + formatPromptToolCalls(m.ToolCalls))
+			}
+			m.ToolCalls = nil
+		case m.Role == openai.ChatMessageRoleTool:
+			name := m.Name
+			if name == "" {
+				name = callNames[m.ToolCallID]
+			}
+			response := fmt.Sprintf("<tool_response>\n{\"name\": %q, \"content\": %s}\n</tool_response>", name, jsonString(m.Content))
+			// Consecutive results are merged so roles keep alternating for strict chat templates
+			if n := len(res); n > 0 && res[n-1].Role == openai.ChatMessageRoleUser && strings.HasPrefix(res[n-1].Content, "<tool_response>") {
+				res[n-1].Content += "\n" + response
+				res[n-1].Images = append(res[n-1].Images, m.Images...)
+				continue
+			}
+			m = types.Message{Role: openai.ChatMessageRoleUser, Content: response, Images: m.Images}
+		}
+		res = append(res, m)
+	}
+
+	if !injected {
+		res = append([]types.Message{{Role: openai.ChatMessageRoleSystem, Content: toolPrompt}}, res...)
+	}
+	return res
+}
+
+// jsonString encodes s as a JSON string
+func jsonString(s string) string {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return `""`
+	}
+	return string(encoded)
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// reactActionBlock matches fenced ```action blocks holding a single JSON tool call
+var reactActionBlock = regexp.MustCompile("(?s)```action[ \\t]*\\n(.*?)\\n?```")
+
+// reactAction is the JSON shape a model emits inside an action block
+type reactAction struct {
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// usesReActTools reports whether tools should be described in the prompt instead of sent natively
+func usesReActTools(model types.Model) bool {
+	return strings.EqualFold(model.ToolMode, types.ToolModeReAct)
+}
+
+// reactToolPrompt describes the available tools and the action block format the model must use
+func reactToolPrompt(toolDefs []openai.Tool) string {
+	var sb strings.Builder
+	sb.WriteString("--- TOOLS ---\n")
+	sb.WriteString("You can call tools. To call one, reply with a fenced code block tagged `action` containing a single JSON object:\n\n")
+	sb.WriteString("```action\n{\"tool\": \"read_file\", \"arguments\": {\"path\": \"main.go\"}}\n```\n\n")
+	sb.WriteString("Rules:\n")
+	sb.WriteString("- Use one action block per tool call. You may include several blocks in one reply.\n")
+	sb.WriteString("- After your action blocks, stop and wait. Results arrive in the next message as OBSERVATION blocks.\n")
+	sb.WriteString("- Never invent observations. When no tool is needed, answer normally without an action block.\n\n")
+	sb.WriteString("Available tools:\n")
+
+	for _, tool := range toolDefs {
+		if tool.Function == nil {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n### %s\n%s\n", tool.Function.Name, tool.Function.Description))
+		if tool.Function.Parameters != nil {
+			if params, err := json.Marshal(tool.Function.Parameters); err == nil {
+				sb.WriteString(fmt.Sprintf("Arguments (JSON schema): %s\n", params))
+			}
+		}
+	}
+	sb.WriteString("--- END TOOLS ---")
+	return sb.String()
+}
+
+// parseReActToolCalls extracts tool calls from action blocks in a text response.
+// Blocks that are not valid JSON or name no tool are ignored.
+func parseReActToolCalls(content string) []openai.ToolCall {
+	var toolCalls []openai.ToolCall
+	for _, match := range reactActionBlock.FindAllStringSubmatch(content, -1) {
+		var action reactAction
+		if err := json.Unmarshal([]byte(strings.TrimSpace(match[1])), &action); err != nil || action.Tool == "" {
+			continue
+		}
+		if action.Arguments == nil {
+			action.Arguments = map[string]interface{}{}
+		}
+		args, err := json.Marshal(action.Arguments)
+		if err != nil {
+			continue
+		}
+		toolCalls = append(toolCalls, openai.ToolCall{
+			ID:   fmt.Sprintf("react_%d", len(toolCalls)+1),
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      action.Tool,
+				Arguments: string(args),
+			},
+		})
+	}
+	return toolCalls
+}
+
+// formatReActActions renders tool calls as action blocks
+func formatReActActions(toolCalls []openai.ToolCall) string {
+	blocks := make([]string, 0, len(toolCalls))
+	for _, tc := range toolCalls {
+		args := strings.TrimSpace(tc.Function.Arguments)
+		if args == "" {
+			args = "{}"
+		}
+		blocks = append(blocks, fmt.Sprintf("```action\n{\"tool\": %q, \"arguments\": %s}\n```", tc.Function.Name, args))
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// reactMessages rewrites the conversation for a model without native tool calling.
+// The tool catalogue is appended to the system prompt, assistant tool calls are sent as
+// their text (which already holds the action blocks) and tool results become user observations.
+func reactMessages(messages []types.Message, toolDefs []openai.Tool) []types.Message {
+	res := make([]types.Message, 0, len(messages))
+	toolPrompt := reactToolPrompt(toolDefs)
+	injected := false
+	callNames := make(map[string]string)
+
+	for _, m := range messages {
+		switch {
+		case m.Role == openai.ChatMessageRoleSystem && !injected:
+			m.Content = m.Content + "\n\n" + toolPrompt
+			injected = true
+		case m.Role == openai.ChatMessageRoleAssistant:
+			for _, tc := range m.ToolCalls {
+				callNames[tc.ID] = tc.Function.Name
+			}
+			// Calls that were not made through action blocks (native or parsed from markup) are shown as such
+			if len(m.ToolCalls) > 0 && !reactActionBlock.MatchString(m.Content) {
+				m.Content = strings.TrimSpace(m.Content + "\n\n" + formatReActActions(m.ToolCalls))
+			}
+			m.ToolCalls = nil
+		case m.Role == openai.ChatMessageRoleTool:
+			name := m.Name
+			if name == "" {
+				name = callNames[m.ToolCallID]
+			}
+			observation := fmt.Sprintf("OBSERVATION (%s):\n%s", name, m.Content)
+			// Consecutive results are merged so roles keep alternating for strict chat templates
+			if n := len(res); n > 0 && res[n-1].Role == openai.ChatMessageRoleUser && strings.HasPrefix(res[n-1].Content, "OBSERVATION") {
+				res[n-1].Content += "\n\n" + observation
+				res[n-1].Images = append(res[n-1].Images, m.Images...)
+				continue
+			}
+			m = types.Message{Role: openai.ChatMessageRoleUser, Content: observation, Images: m.Images}
+		}
+		res = append(res, m)
+	}
+
+	if !injected {
+		res = append([]types.Message{{Role: openai.ChatMessageRoleSystem, Content: toolPrompt}}, res...)
+	}
+	return res
+}
@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"coding-agent/pkg/config"
+	"coding-agent/pkg/i18n"
+	"coding-agent/pkg/tools"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// agentsFile is the project instructions file loaded into the system prompt
+const agentsFile = "AGENTS.md"
+
+// recordReloadState remembers the current AGENTS.md, config and tool settings contents so later edits can be detected
+func recordReloadState(a *types.Agent) {
+	a.ReloadHashes = map[string]string{
+		a.ConfigPath:            fileHash(a.ConfigPath),
+		config.ToolSettingsPath: fileHash(config.ToolSettingsPath),
+	}
+	for _, path := range agentsFiles(a) {
+		a.ReloadHashes[path] = fileHash(path)
+	}
+}
+
+// agentsFiles lists the AGENTS.md of the current directory and of each workspace root
+func agentsFiles(a *types.Agent) []string {
+	files := []string{agentsFile}
+	for _, root := range a.WorkspaceRoots {
+		files = append(files, filepath.Join(root, agentsFile))
+	}
+	return files
+}
+
+// ReloadChangedFiles applies edits made to AGENTS.md, the config file or .mcode/tools.json since they were last loaded,
+// so they take effect in the running session. It is checked before each turn rather than watched,
+// which keeps reload announcements from interrupting the prompt.
+func ReloadChangedFiles(a *types.Agent) {
+	if a.ReloadHashes == nil {
+		recordReloadState(a)
+		return
+	}
+
+	for _, path := range agentsFiles(a) {
+		if hash := fileHash(path); hash != a.ReloadHashes[path] {
+			a.ReloadHashes[path] = hash
+			if refreshSystemPrompt(a) {
+				ui.PrintfSafe("%s🔄 %s changed, project instructions reloaded%s\n", types.ColorCyan, path, types.ColorReset)
+			}
+		}
+	}
+
+	if a.ConfigPath != "" {
+		if hash := fileHash(a.ConfigPath); hash != a.ReloadHashes[a.ConfigPath] {
+			a.ReloadHashes[a.ConfigPath] = hash
+			reloadConfig(a)
+		}
+	}
+
+	if hash := fileHash(config.ToolSettingsPath); hash != a.ReloadHashes[config.ToolSettingsPath] {
+		a.ReloadHashes[config.ToolSettingsPath] = hash
+		if loadToolSettings(a) {
+			ui.PrintfSafe("%s🔄 %s reloaded%s\n", types.ColorCyan, config.ToolSettingsPath, types.ColorReset)
+		}
+	}
+}
+
+// noteStaleFiles tells the model which files it read have changed on disk since, so it re-reads
+// them instead of editing against the outdated copies in the conversation
+func noteStaleFiles(a *types.Agent, toolManager *tools.Manager) {
+	stale := toolManager.StaleContextFiles()
+	if len(stale) == 0 {
+		return
+	}
+	a.AddMessage(types.Message{
+		Role: openai.ChatMessageRoleSystem,
+		Content: "These files changed since you read them, so their contents earlier in the conversation are outdated. " +
+			"Re-read them before editing or relying on their line numbers: " + strings.Join(stale, ", "),
+	})
+	ui.PrintfSafe("%sℹ️  Marked as stale for the model: %s%s\n", types.ColorGray, strings.Join(stale, ", "), types.ColorReset)
+}
+
+// loadToolSettings applies the project's .mcode/tools.json, keeping the current settings when
+// the file is invalid. It reports whether the settings were loaded.
+func loadToolSettings(a *types.Agent) bool {
+	settings, err := config.LoadToolSettings(config.ToolSettingsPath)
+	if err != nil {
+		ui.PrintfSafe("%s⚠️  Ignoring tool settings: %v%s\n", types.ColorYellow, err, types.ColorReset)
+		return false
+	}
+	a.ToolSettings = settings
+	return true
+}
+
+// refreshSystemPrompt rebuilds the system prompt of the current conversation, reporting whether there was one
+func refreshSystemPrompt(a *types.Agent) bool {
+	prompt := systemPrompt(a)
+	refreshed := false
+	a.UpdateMessages(func(msgs []types.Message) []types.Message {
+		if len(msgs) > 0 && msgs[0].Role == openai.ChatMessageRoleSystem {
+			msgs[0].Content = prompt
+			refreshed = true
+		}
+		return msgs
+	})
+	return refreshed
+}
+
+// reloadConfig replaces the session's config with the file's contents. Writes made by mcode itself
+// leave the config unchanged and are applied silently. A model the session switched to with
+// --model or /model is kept while the file still defines it.
+func reloadConfig(a *types.Agent) {
+	data, err := os.ReadFile(a.ConfigPath)
+	if err != nil {
+		return
+	}
+	var cfg types.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		ui.PrintfSafe("%s⚠️  %s has errors, keeping the current settings: %v%s\n", types.ColorYellow, a.ConfigPath, err, types.ColorReset)
+		return
+	}
+	if sameConfig(&cfg, a.Config) {
+		return
+	}
+
+	key := a.Model
+	if _, ok := cfg.Models[key]; !ok {
+		if key != "" {
+			ui.PrintfSafe("%s⚠️  %s no longer defines model '%s'; using current model '%s'%s\n", types.ColorYellow, a.ConfigPath, key, cfg.CurrentModel, types.ColorReset)
+		}
+		key = cfg.CurrentModel
+	}
+	if _, ok := cfg.Models[key]; !ok {
+		ui.PrintfSafe("%s⚠️  %s: current model '%s' is not defined, keeping the current settings%s\n", types.ColorYellow, a.ConfigPath, cfg.CurrentModel, types.ColorReset)
+		return
+	}
+
+	previousModel := a.Config.Models[a.ModelKey()]
+	previousKey := a.ModelKey()
+	a.Config = &cfg
+	if key != cfg.CurrentModel {
+		a.Model = key
+	} else {
+		a.Model = ""
+	}
+	applyApprovals(a)
+	i18n.SetLocale(i18n.Detect(cfg.Locale))
+
+	model := cfg.Models[key]
+	if key != previousKey || !reflect.DeepEqual(model, previousModel) {
+		a.LLM = NewProvider(model)
+		ApplyEndpointContextLimit(a, key)
+	}
+	ui.PrintfSafe("%s🔄 Config reloaded from %s (model: %s)%s\n", types.ColorCyan, a.ConfigPath, key, types.ColorReset)
+}
+
+func sameConfig(x, y *types.Config) bool {
+	xData, err1 := json.Marshal(x)
+	yData, err2 := json.Marshal(y)
+	return err1 == nil && err2 == nil && string(xData) == string(yData)
+}
+
+// fileHash returns a hash of the file's content, or "" when it cannot be read
+func fileHash(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxArgumentRepairAttempts bounds how many consecutive turns with malformed tool arguments
+// are sent back to the model before the turn is ended
+const maxArgumentRepairAttempts = 3
+
+// parseToolArguments decodes tool call arguments, applying only repairs that cannot change
+// their meaning: empty arguments, code fences, trailing commas and double-encoded JSON.
+// Truncated payloads are never completed here since guessing the rest could write partial content.
+func parseToolArguments(raw string) (map[string]interface{}, bool, error) {
+	var params map[string]interface{}
+	err := json.Unmarshal([]byte(raw), &params)
+	if err == nil {
+		return params, false, nil
+	}
+
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return map[string]interface{}{}, true, nil
+	}
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s, "```json")
+		s = strings.TrimPrefix(s, "```")
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+	}
+
+	var encoded string
+	if json.Unmarshal([]byte(s), &encoded) == nil {
+		s = encoded
+	}
+
+	s = stripTrailingCommas(s)
+	if json.Unmarshal([]byte(s), &params) == nil {
+		return params, true, nil
+	}
+	return nil, false, err
+}
+
+// stripTrailingCommas drops commas directly before a closing brace or bracket. Commas inside
+// string literals are content, such as a list literal in a file being written, and are kept.
+func stripTrailingCommas(s string) string {
+	var sb strings.Builder
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ',':
+			j := i + 1
+			for j < len(s) && strings.IndexByte(" \t\r\n", s[j]) >= 0 {
+				j++
+			}
+			if j < len(s) && (s[j] == '}' || s[j] == ']') {
+				continue
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// malformedArgumentsResult is the tool result that asks the model to re-emit a call with valid JSON
+func malformedArgumentsResult(toolCall openai.ToolCall, err error, truncated bool) string {
+	payload := toolCall.Function.Arguments
+	if len(payload) > 500 {
+		payload = payload[:250] + "\n... [" + fmt.Sprint(len(payload)-500) + " chars omitted] ...\n" + payload[len(payload)-250:]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Error: the arguments for %s are not valid JSON (%v), so the tool was not run.\n", toolCall.Function.Name, err))
+	sb.WriteString(fmt.Sprintf("Received:\n%s\n", payload))
+	if truncated {
+		sb.WriteString("Your response hit the output token limit before the arguments were complete. Re-emit the call with smaller arguments, e.g. split a large file into several edits.")
+	} else {
+		sb.WriteString("Re-emit the tool call with a single, complete JSON object as its arguments. Escape quotes, backslashes and newlines inside strings.")
+	}
+	return sb.String()
+}
+
+// countMalformedToolCalls returns how many tool calls carry arguments that cannot be decoded
+func countMalformedToolCalls(toolCalls []openai.ToolCall) int {
+	count := 0
+	for _, tc := range toolCalls {
+		if _, _, err := parseToolArguments(tc.Function.Arguments); err != nil {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"coding-agent/pkg/llm"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+)
+
+// Defaults of the retry settings
+const (
+	defaultRetryAttempts = 4
+	defaultRetryBase     = time.Second
+	defaultRetryMax      = 30 * time.Second
+)
+
+// maxRetryAfter is the longest Retry-After that is waited for; a server asking for more is not
+// retried
+const maxRetryAfter = 5 * time.Minute
+
+// requestRetry sends requests that failed transiently again, with exponential backoff. One is
+// used per turn; a successful response or a switch to another model resets it.
+type requestRetry struct {
+	attempts int    // Retries since the last successful response
+	model    string // Model the attempts were made with
+}
+
+// succeeded resets the count once a request got through
+func (r *requestRetry) succeeded() {
+	r.attempts = 0
+}
+
+// wait reports whether a failed request should be sent again and, if so, waits before returning:
+// the Retry-After the server asked for, or a jittered delay that doubles with each attempt. It
+// returns false for errors that are not transient and once the configured attempts are used up.
+// An interrupt ends the wait early; the caller then finds the context cancelled.
+func (r *requestRetry) wait(ctx context.Context, a *types.Agent, err error) bool {
+	settings := a.Config.Retry
+	attempts := settings.Attempts
+	if attempts == 0 {
+		attempts = defaultRetryAttempts
+	}
+	if r.model != a.ModelKey() {
+		r.attempts, r.model = 0, a.ModelKey()
+	}
+	if r.attempts >= attempts || !llm.IsTransient(err) {
+		return false
+	}
+
+	delay, fromServer := llm.RetryAfter(err)
+	if fromServer && delay > maxRetryAfter {
+		return false
+	}
+	if !fromServer {
+		delay = backoffDelay(settings, r.attempts)
+	}
+	r.attempts++
+
+	ui.PrintfSafe("\n%s⚠️  Request failed: %v. Retrying in %s (attempt %d/%d)...%s\n",
+		types.ColorYellow, err, delay.Round(100*time.Millisecond), r.attempts, attempts, types.ColorReset)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return true
+}
+
+// backoffDelay is the wait before retry number attempt+1: the base delay doubled for each earlier
+// attempt and capped at the maximum, of which a random half to all is used so clients that failed
+// together do not retry together
+func backoffDelay(settings types.RetrySettings, attempt int) time.Duration {
+	base, limit := defaultRetryBase, defaultRetryMax
+	if settings.BaseDelay > 0 {
+		base = time.Duration(settings.BaseDelay * float64(time.Second))
+	}
+	if settings.MaxDelay > 0 {
+		limit = time.Duration(settings.MaxDelay * float64(time.Second))
+	}
+	delay := base
+	for i := 0; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+	return delay/2 + rand.N(delay/2+1)
+}
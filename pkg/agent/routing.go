@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"sort"
+
+	"coding-agent/pkg/llm"
+	"coding-agent/pkg/types"
+)
+
+// Internal operations whose model can be chosen with model_routing
+const (
+	TaskSummarize = "summarize" // Compaction and /fork summaries
+	TaskSpeech    = "speech"    // One-sentence summaries of answers read aloud
+)
+
+// routedModel is a model chosen for an internal operation
+type routedModel struct {
+	key      string
+	model    types.Model
+	provider llm.Provider
+}
+
+// taskModels returns the models to try for an internal operation, in order: the one model_routing
+// names for the task, then the current model. Without a route, or with a route to a model that is
+// not configured, only the current model is returned.
+func taskModels(a *types.Agent, task string) []routedModel {
+	current := routedModel{key: a.ModelKey(), model: currentModelConfig(a), provider: a.LLM}
+	key := a.Config.ModelRouting[task]
+	model, ok := a.Config.Models[key]
+	if !ok || key == a.ModelKey() {
+		return []routedModel{current}
+	}
+	return []routedModel{{key: key, model: model, provider: NewProvider(model)}, current}
+}
+
+// ModelTasks returns the internal operations routed to a model key, sorted
+func ModelTasks(cfg *types.Config, modelKey string) []string {
+	var tasks []string
+	for task, key := range cfg.ModelRouting {
+		if key == modelKey {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Strings(tasks)
+	return tasks
+}
@@ -0,0 +1,235 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"coding-agent/pkg/types"
+)
+
+// permissionStrictness orders the actions of permission rules; rules with other actions are ignored
+var permissionStrictness = map[string]int{
+	types.PermissionAllow: 1,
+	types.PermissionAsk:   2,
+	types.PermissionDeny:  3,
+}
+
+// permissionRule returns the strictest permission rule that matches a tool call, and whether any
+// rule matched
+func permissionRule(a *types.Agent, name string, params map[string]interface{}) (types.PermissionRule, bool) {
+	var match types.PermissionRule
+	found := false
+	if a.Config == nil {
+		return match, false
+	}
+	for _, rule := range a.Config.Permissions {
+		strictness, ok := permissionStrictness[rule.Action]
+		if !ok || !ruleMatches(rule, name, params) {
+			continue
+		}
+		if !found || strictness > permissionStrictness[match.Action] {
+			match, found = rule, true
+		}
+	}
+	return match, found
+}
+
+// ruleMatches reports whether a rule applies to a tool call. So that a symlink cannot lead out of
+// an allowed path or around a denied one, allow rules must match a path both as written and with
+// symlinks resolved, and the other rules match either.
+func ruleMatches(rule types.PermissionRule, name string, params map[string]interface{}) bool {
+	if rule.Tool != "" && rule.Tool != "*" && rule.Tool != name {
+		return false
+	}
+	if rule.Pattern != "" {
+		subject, ok := ruleSubject(name, params)
+		if !ok || !patternMatches(rule, name, subject) {
+			return false
+		}
+	}
+	if rule.Path != "" {
+		path := toolPath(name, params)
+		if path == "" {
+			return false
+		}
+		abs, err := filepath.Abs(expandHome(path))
+		if err != nil {
+			return false
+		}
+		written, resolved := pathMatches(rule.Path, abs), pathMatches(rule.Path, realPath(abs))
+		if rule.Action == types.PermissionAllow {
+			return written && resolved
+		}
+		return written || resolved
+	}
+	return true
+}
+
+// patternMatches matches a rule's pattern. A shell command line is matched command by command: an
+// allow rule must match every command and the line may not substitute or redirect, so "git *"
+// does not allow "git status && rm -r src" or "git status & rm -r src"; the other rules match when
+// any command does, including one quoted inside another or handed to another shell with
+// sh -c 'rm -r src'.
+func patternMatches(rule types.PermissionRule, name, subject string) bool {
+	if !shellTools[name] {
+		return commandMatches(rule.Pattern, subject)
+	}
+	if rule.Action == types.PermissionAllow {
+		parts, plain := splitCommands(subject)
+		if !plain || len(parts) == 0 {
+			return false
+		}
+		for _, part := range parts {
+			if !commandMatches(rule.Pattern, part) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, part := range append(commandSeparators.Split(subject, -1), subject) {
+		part = strings.TrimSpace(part)
+		if commandMatches(rule.Pattern, part) {
+			return true
+		}
+		if inner, ok := shellCommand(part); ok && patternMatches(rule, name, inner) {
+			return true
+		}
+	}
+	return false
+}
+
+// shellInvocation matches a command that hands its argument to another shell, such as
+// sh -c 'rm -r src' or /bin/bash -lc "make clean"
+var shellInvocation = regexp.MustCompile(`^(?:\S*/)?(?:sh|bash|zsh)\s+(?:-[a-zA-Z]+\s+)*?-[a-zA-Z]*c[a-zA-Z]*\s+(.+)$`)
+
+// shellCommand returns the command line a sh, bash or zsh -c command runs, without its quotes
+func shellCommand(command string) (string, bool) {
+	m := shellInvocation.FindStringSubmatch(command)
+	if m == nil {
+		return "", false
+	}
+	inner := m[1]
+	if quote := inner[0]; quote == '\'' || quote == '"' {
+		inner = strings.TrimSuffix(inner[1:], string(quote))
+	}
+	return strings.TrimSpace(inner), true
+}
+
+// ruleSubject is the argument a rule's pattern is matched against: the command of shell tools, the
+// URL of web_fetch and the query of sql_query. Other tools have none.
+func ruleSubject(name string, params map[string]interface{}) (string, bool) {
+	key := ""
+	switch {
+	case shellTools[name]:
+		key = "command"
+	case name == "web_fetch":
+		key = "url"
+	case name == "sql_query":
+		key = "query"
+	default:
+		return "", false
+	}
+	subject, ok := params[key].(string)
+	return subject, ok
+}
+
+// toolPath is the file or folder a tool call accesses: the file of file tools, otherwise the folder
+func toolPath(name string, params map[string]interface{}) string {
+	if fileTools[name] {
+		if path, _ := params["path"].(string); path != "" {
+			return path
+		}
+		if path, _ := params["filePath"].(string); path != "" {
+			return path
+		}
+	}
+	return toolFolder(name, params)
+}
+
+// pathMatches matches an absolute path against a rule's path pattern. In the pattern * and ?
+// match within a folder name, ** matches across folders, and a trailing /** also matches the
+// folder itself. Patterns starting with ** match anywhere, other relative ones in the current
+// directory. The pattern's folder is tried as written and with symlinks resolved, so /tmp/**
+// works where /tmp is a link.
+func pathMatches(pattern, path string) bool {
+	pattern = expandHome(pattern)
+	if !strings.HasPrefix(pattern, "**") {
+		abs, err := filepath.Abs(pattern)
+		if err != nil {
+			return false
+		}
+		pattern = abs
+	}
+	for _, p := range []string{pattern, resolvePatternBase(pattern)} {
+		if re, err := regexp.Compile(globRegexp(p)); err == nil && re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePatternBase resolves symlinks in the part of a path pattern before its first wildcard
+func resolvePatternBase(pattern string) string {
+	i := strings.IndexAny(pattern, "*?")
+	if !filepath.IsAbs(pattern) {
+		return pattern
+	}
+	if i < 0 {
+		return realPath(pattern)
+	}
+	base := filepath.Dir(pattern[:i+1])
+	return filepath.Join(realPath(base), pattern[len(base):])
+}
+
+// globRegexp translates a path pattern into an anchored regular expression
+func globRegexp(pattern string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	sep := regexp.QuoteMeta(string(os.PathSeparator))
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], string(os.PathSeparator)+"**"):
+			b.WriteString("(" + sep + ".*)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^" + sep + "]*")
+		case pattern[i] == '?':
+			b.WriteString("[^" + sep + "]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+// DescribeRule shows a rule as its tool and what it matches, e.g. bash_command "git *"
+func DescribeRule(rule types.PermissionRule) string {
+	tool := rule.Tool
+	if tool == "" {
+		tool = "*"
+	}
+	if rule.Pattern != "" {
+		tool += fmt.Sprintf(" %q", rule.Pattern)
+	}
+	if rule.Path != "" {
+		tool += " " + rule.Path
+	}
+	return tool
+}
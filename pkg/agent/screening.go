@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+
+	"coding-agent/pkg/i18n"
+	"coding-agent/pkg/screening"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+)
+
+// untrustedTools return content written by people other than the user: web pages and search
+// results, and files that may have come from anyone with access to the repository
+var untrustedTools = []string{"web_fetch", "web_search", "read_file", "search_code", "preview_data", "sql_query"}
+
+// screenToolResult checks the result of a tool from an untrusted source for prompt injection.
+// Flagged results are wrapped in a warning to the model; in confirm mode the user decides whether
+// the result reaches the model at all.
+func screenToolResult(a *types.Agent, toolName, result string) string {
+	settings := a.Config.Screening
+	if settings.Mode == types.ScreeningOff || (!slices.Contains(untrustedTools, toolName) && !slices.Contains(settings.Tools, toolName)) {
+		return result
+	}
+	findings := screening.Scan(result)
+	if len(findings) == 0 {
+		return result
+	}
+
+	ui.PrintfSafe("%s%s%s\n", types.ColorYellow, i18n.T("approval.injection", toolName), types.ColorReset)
+	for _, f := range findings {
+		ui.PrintfSafe("   - %s: %q\n", f.Rule, f.Excerpt)
+	}
+
+	if settings.Mode == types.ScreeningConfirm {
+		ui.PrintSafe(i18n.T("approval.injection.prompt"))
+		response := readApproval(a)
+		if response != "y" {
+			ui.PrintlnSafe("no")
+			return fmt.Sprintf("The %s result was withheld: it contained text that looks like a prompt injection (%s) and the user chose not to pass it on.", toolName, screening.Summary(findings))
+		}
+		ui.PrintlnSafe("y")
+	}
+	return screening.Wrap(toolName, result, findings)
+}
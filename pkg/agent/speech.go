@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/llm"
+	"coding-agent/pkg/speech"
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxSpokenLength is the longest answer read aloud as it is; longer ones are summarized first
+const maxSpokenLength = 160
+
+// spokenSummaryPrompt asks for the sentence read aloud at the end of a run
+const spokenSummaryPrompt = "The following is the final message of a coding assistant to its user, who is not looking at the screen. " +
+	"Write one short sentence (at most 25 words) to be read aloud that tells them what was done or what the answer is, " +
+	"and whether anything needs their attention. No code, file paths, markdown or quotes."
+
+// announce reads an approval request aloud when speech is enabled, so a user who looked away
+// knows mcode is waiting for them
+func announce(a *types.Agent, message string) {
+	if a.Config.Speech.Enabled {
+		speech.Speak(a.Config.Speech, message)
+	}
+}
+
+// spokenToolName turns a tool name into words, e.g. "bash_command" into "bash command"
+func spokenToolName(name string) string {
+	return strings.ReplaceAll(name, "_", " ")
+}
+
+// speakSummary reads a one-sentence summary of the final answer of a run aloud when speech is
+// enabled. Summarizing happens in the background so the prompt is not held up.
+func speakSummary(a *types.Agent, content string) {
+	if !a.Config.Speech.Enabled || strings.TrimSpace(content) == "" {
+		return
+	}
+	// The routed model, if any, is tried alone: a spoken summary is not worth a second request
+	routed := taskModels(a, TaskSpeech)[0]
+	settings, provider, model := a.Config.Speech, routed.provider, routed.model.Name
+	go func() {
+		speech.Speak(settings, spokenSummary(provider, model, content))
+	}()
+}
+
+// spokenSummary returns the sentence to read aloud for a final answer: short plain answers as they
+// are, anything else condensed by the model, or its first sentence if that fails
+func spokenSummary(provider llm.Provider, model, content string) string {
+	plain := speech.Plain(content)
+	if len(plain) <= maxSpokenLength && !strings.Contains(content, "```") {
+		return plain
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	resp, err := provider.CreateCompletion(ctx, llm.Request{
+		Model: model,
+		Messages: []llm.Message{
+			{Role: openai.ChatMessageRoleSystem, Content: spokenSummaryPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: content},
+		},
+		MaxTokens:   100,
+		Temperature: 0.3,
+	})
+	if err == nil {
+		if sentence := speech.Plain(resp.Content); sentence != "" {
+			return sentence
+		}
+	}
+	return firstSentence(plain)
+}
+
+// firstSentence returns the first sentence of text, cut to maxSpokenLength
+func firstSentence(text string) string {
+	if i := strings.IndexAny(text, ".!?"); i >= 0 {
+		text = text[:i+1]
+	}
+	if len(text) > maxSpokenLength {
+		text = text[:maxSpokenLength]
+		if i := strings.LastIndex(text, " "); i > 0 {
+			text = text[:i]
+		}
+	}
+	return text
+}
@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Tool call markup some local models emit as plain content instead of native tool calls:
+//
+//	<tool_call>{"name": "read_file", "arguments": {"path": "main.go"}}</tool_call>       (Hermes, Qwen2.5)
+//	<tool_call><function=read_file><parameter=path>main.go</parameter></function></tool_call>  (Qwen3 Coder)
+//	<invoke name="read_file"><parameter name="path">main.go</parameter></invoke>        (XML function calls)
+var (
+	toolCallBlock      = regexp.MustCompile(`(?s)<tool_call>(.*?)</tool_call>`)
+	functionBlock      = regexp.MustCompile(`(?s)<function=([^>\s]+)>(.*?)</function>`)
+	functionParam      = regexp.MustCompile(`(?s)<parameter=([^>\s]+)>(.*?)</parameter>`)
+	invokeBlock        = regexp.MustCompile(`(?s)<invoke name="([^"]+)">(.*?)</invoke>`)
+	invokeParam        = regexp.MustCompile(`(?s)<parameter name="([^"]+)">(.*?)</parameter>`)
+	functionCallsBlock = regexp.MustCompile(`(?s)</?function_calls>`)
+)
+
+// textToolCallOpeners mark the start of tool call markup that may still be streaming in
+var textToolCallOpeners = []string{"<tool_call>", "<function=", "<function_calls>", "<invoke name="}
+
+// hermesToolCall is the JSON body of a <tool_call> block
+type hermesToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// parsesTextToolCalls reports whether tool call markup in a model's content is run as tool calls:
+// for models whose tools are emulated, and for native models with text_tool_calls set because
+// their server passes the markup through. Other models may quote markup without it being run.
+func parsesTextToolCalls(model types.Model) bool {
+	return emulatesTools(model) || model.TextToolCalls
+}
+
+// fencedSegment is a stretch of content either inside or outside a fenced code block
+type fencedSegment struct {
+	text   string
+	fenced bool
+}
+
+// splitFences splits content at ``` and ~~~ fences. Fence lines belong to their block, and a block
+// that is not closed yet runs to the end.
+func splitFences(content string) []fencedSegment {
+	var segments []fencedSegment
+	var current strings.Builder
+	fenced := false
+	flush := func() {
+		if current.Len() > 0 {
+			segments = append(segments, fencedSegment{current.String(), fenced})
+			current.Reset()
+		}
+	}
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		fence := strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")
+		if fence && !fenced {
+			flush()
+			fenced = true
+			current.WriteString(line)
+			continue
+		}
+		current.WriteString(line)
+		if fence {
+			flush()
+			fenced = false
+		}
+	}
+	flush()
+	return segments
+}
+
+// parseTextToolCalls converts tool call markup found in plain content into ToolCall structs.
+// It returns the content with the markup removed alongside the parsed calls. Markup inside fenced
+// code is an example rather than a call and is left alone.
+func parseTextToolCalls(content string) (string, []openai.ToolCall) {
+	var toolCalls []openai.ToolCall
+	add := func(name string, args map[string]interface{}) {
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		encoded, err := json.Marshal(args)
+		if err != nil {
+			return
+		}
+		toolCalls = append(toolCalls, openai.ToolCall{
+			ID:   fmt.Sprintf("call_%d", len(toolCalls)+1),
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      name,
+				Arguments: string(encoded),
+			},
+		})
+	}
+
+	var cleaned strings.Builder
+	for _, segment := range splitFences(content) {
+		if segment.fenced {
+			cleaned.WriteString(segment.text)
+			continue
+		}
+		before := len(toolCalls)
+		text := replaceToolMarkup(segment.text, add)
+		if len(toolCalls) > before {
+			text = functionCallsBlock.ReplaceAllString(text, "")
+		}
+		cleaned.WriteString(text)
+	}
+
+	if len(toolCalls) == 0 {
+		return content, nil
+	}
+	return strings.TrimSpace(cleaned.String()), toolCalls
+}
+
+// replaceToolMarkup removes the tool call markup from content, passing each call to add
+func replaceToolMarkup(content string, add func(name string, args map[string]interface{})) string {
+	cleaned := toolCallBlock.ReplaceAllStringFunc(content, func(block string) string {
+		inner := strings.TrimSpace(toolCallBlock.FindStringSubmatch(block)[1])
+		if strings.HasPrefix(inner, "{") {
+			var call hermesToolCall
+			if err := json.Unmarshal([]byte(inner), &call); err != nil || call.Name == "" {
+				return block
+			}
+			add(call.Name, decodeHermesArguments(call.Arguments))
+			return ""
+		}
+		if !functionBlock.MatchString(inner) {
+			return block
+		}
+		for _, m := range functionBlock.FindAllStringSubmatch(inner, -1) {
+			add(m[1], parseXMLParams(functionParam, m[2]))
+		}
+		return ""
+	})
+
+	cleaned = functionBlock.ReplaceAllStringFunc(cleaned, func(block string) string {
+		m := functionBlock.FindStringSubmatch(block)
+		add(m[1], parseXMLParams(functionParam, m[2]))
+		return ""
+	})
+
+	return invokeBlock.ReplaceAllStringFunc(cleaned, func(block string) string {
+		m := invokeBlock.FindStringSubmatch(block)
+		add(m[1], parseXMLParams(invokeParam, m[2]))
+		return ""
+	})
+}
+
+// decodeHermesArguments accepts arguments given either as a JSON object or as a JSON-encoded string
+func decodeHermesArguments(raw json.RawMessage) map[string]interface{} {
+	var args map[string]interface{}
+	if err := json.Unmarshal(raw, &args); err == nil {
+		return args
+	}
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		if err := json.Unmarshal([]byte(encoded), &args); err == nil {
+			return args
+		}
+	}
+	return nil
+}
+
+// parseXMLParams collects parameter values. Values are kept as strings (the tool decoder
+// converts weakly typed input) unless they hold a JSON object or array.
+func parseXMLParams(param *regexp.Regexp, body string) map[string]interface{} {
+	args := make(map[string]interface{})
+	for _, m := range param.FindAllStringSubmatch(body, -1) {
+		value := strings.Trim(m[2], "\n")
+		trimmed := strings.TrimSpace(value)
+		if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(trimmed), &decoded); err == nil {
+				args[m[1]] = decoded
+				continue
+			}
+		}
+		args[m[1]] = value
+	}
+	return args
+}
+
+// stripTextToolCalls hides tool call markup from streamed output, including a block that is still
+// incomplete. Fenced code is shown as written.
+func stripTextToolCalls(content string) string {
+	stripped, _ := parseTextToolCalls(content)
+	offset := 0
+	for _, segment := range splitFences(stripped) {
+		if !segment.fenced {
+			cut := -1
+			for _, opener := range textToolCallOpeners {
+				if idx := strings.Index(segment.text, opener); idx >= 0 && (cut < 0 || idx < cut) {
+					cut = idx
+				}
+			}
+			if cut >= 0 {
+				return stripped[:offset+cut]
+			}
+		}
+		offset += len(segment.text)
+	}
+	return stripped
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"coding-agent/pkg/config"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+)
+
+// projectCommands lists the shell commands .mcode/tools.json would have mcode run: formatters after
+// every edit, and custom tools the model may call. A cloned repository could put anything there, so
+// they only run once the user trusted the file.
+func projectCommands(settings types.ToolSettings) []string {
+	var commands []string
+	for ext, command := range settings.Formatters {
+		commands = append(commands, fmt.Sprintf("formatter for %s: %s", ext, command))
+	}
+	for _, tool := range settings.CustomTools {
+		commands = append(commands, fmt.Sprintf("tool %s: %s", tool.Name, tool.Command))
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// checkToolSettingsTrust decides whether the commands of the project's .mcode/tools.json may run.
+// The user is asked once per version of the file; a yes is saved in the config against the file's
+// sha256, so an edited file asks again. Without a terminal to ask on, the commands do not run.
+func checkToolSettingsTrust(a *types.Agent) {
+	commands := projectCommands(a.ToolSettings)
+	if len(commands) == 0 {
+		a.ToolSettingsTrusted = false
+		return
+	}
+	hash := fileHash(config.ToolSettingsPath)
+	if hash == a.ToolSettingsHash {
+		return
+	}
+	a.ToolSettingsHash = hash
+	path, err := filepath.Abs(config.ToolSettingsPath)
+	if err != nil {
+		a.ToolSettingsTrusted = false
+		return
+	}
+	if a.Config.TrustedToolSettings[path] == hash {
+		a.ToolSettingsTrusted = true
+		return
+	}
+
+	ui.PrintfSafe("\n%s⚠️  %s wants to run these commands on its own:%s\n", types.ColorYellow, path, types.ColorReset)
+	for _, command := range commands {
+		ui.PrintfSafe("  - %s\n", command)
+	}
+	ui.PrintSafe("❓ Trust this file and run them? Until you do, your own settings are used (y/N): ")
+	response := readApproval(a)
+	a.ToolSettingsTrusted = response == "y" || response == "yes"
+	if !a.ToolSettingsTrusted {
+		ui.PrintlnSafe("n")
+		return
+	}
+	ui.PrintlnSafe("y")
+	if a.Config.TrustedToolSettings == nil {
+		a.Config.TrustedToolSettings = make(map[string]string)
+	}
+	a.Config.TrustedToolSettings[path] = hash
+	if err := config.Save(a.ConfigPath, a.Config); err != nil {
+		ui.PrintfSafe("⚠️  Warning: Failed to save the trust: %v\n", err)
+	}
+}
@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"coding-agent/pkg/tools"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultMaxTurns is how many rounds of tool calls one prompt may run when max_turns is not set
+const defaultMaxTurns = 50
+
+// repeatedCallLimit is how often the same tool call may be made during one prompt before the
+// user is asked whether the model is stuck
+const repeatedCallLimit = 3
+
+// Outcomes of turnGuard.check
+type guardAction int
+
+const (
+	guardRun      guardAction = iota // Run the tool calls
+	guardRedirect                    // Skip the calls and tell the model to try something else
+	guardStop                        // Skip the calls and end the prompt
+)
+
+// redirectNote answers tool calls the user skipped because the model was repeating itself
+const redirectNote = "Not run: you already made this exact call %d times during this task and it did not get you further. " +
+	"Do not repeat it; try a different approach, or stop and explain what is blocking you."
+
+// turnGuard keeps one prompt from running forever: it counts the rounds of tool calls against
+// max_turns, notices when the model keeps making the same call and stops after too many rounds of
+// malformed arguments in a row
+type turnGuard struct {
+	turns     int            // Rounds of tool calls so far
+	limit     int            // Rounds allowed before asking again
+	calls     map[string]int // Times each call (name and arguments) was made
+	malformed int            // Rounds in a row with malformed tool arguments
+}
+
+func newTurnGuard(a *types.Agent) *turnGuard {
+	limit := a.Config.MaxTurns
+	if limit <= 0 {
+		limit = defaultMaxTurns
+	}
+	return &turnGuard{limit: limit, calls: make(map[string]int)}
+}
+
+// check is called with each response's tool calls before they run. Once the prompt used up
+// max_turns rounds, or a call was made repeatedCallLimit times, it asks how to go on. Without a
+// terminal to ask on, or in a headless run, it stops.
+func (g *turnGuard) check(a *types.Agent, toolCalls []openai.ToolCall) guardAction {
+	g.turns++
+	if g.turns > g.limit {
+		ui.PrintfSafe("\n%s🛑 This prompt has run %d rounds of tool calls (max_turns).%s\n", types.ColorYellow, g.limit, types.ColorReset)
+		if a.Headless {
+			return guardStop
+		}
+		ui.PrintfSafe("❓ Continue for another %d rounds (c) or stop (s)? ", g.limit)
+		answer := readApproval(a)
+		ui.PrintlnSafe(answer)
+		if answer != "c" && answer != "y" {
+			return guardStop
+		}
+		g.limit += g.limit
+	}
+
+	var repeated []string
+	for _, tc := range toolCalls {
+		sig := callSignature(tc)
+		g.calls[sig]++
+		if g.calls[sig] == repeatedCallLimit {
+			repeated = append(repeated, sig)
+		}
+	}
+	if len(repeated) == 0 {
+		return guardRun
+	}
+
+	name, _, _ := strings.Cut(repeated[0], "\x00")
+	ui.PrintfSafe("\n%s🔁 The model called %s with the same arguments %d times; it may be stuck in a loop.%s\n", types.ColorYellow, name, repeatedCallLimit, types.ColorReset)
+	// A headless run has nobody to answer, and its "n" would redirect rather than stop
+	if a.Headless {
+		return guardStop
+	}
+	ui.PrintfSafe("❓ Continue (c), tell it to try something else (n), or stop (s)? ")
+	answer := readApproval(a)
+	ui.PrintlnSafe(answer)
+	switch answer {
+	case "c", "y":
+		// Ask again only if the call keeps coming back as often
+		for _, sig := range repeated {
+			g.calls[sig] = 0
+		}
+		return guardRun
+	case "n":
+		return guardRedirect
+	}
+	return guardStop
+}
+
+// run checks a response's tool calls and runs them unless the guard skips them. Every response
+// with tool calls goes through it, streamed or not. It reports whether the prompt should end: the
+// guard stopped it, or the model kept sending malformed arguments.
+func (g *turnGuard) run(ctx context.Context, a *types.Agent, toolCalls []openai.ToolCall, toolManager *tools.Manager, tokenStats string, truncated bool) (bool, error) {
+	if action := g.check(a, toolCalls); action != guardRun {
+		emitToolCalls(a, toolCalls)
+		answered := len(a.Messages())
+		skipToolCalls(a, toolCalls, guardSkipNote(action))
+		emitToolResults(a, answered)
+		return action == guardStop, nil
+	}
+	malformed := countMalformedToolCalls(toolCalls)
+	if err := runToolCalls(ctx, a, toolCalls, toolManager, tokenStats, truncated); err != nil {
+		return false, err
+	}
+	if malformed == 0 {
+		g.malformed = 0
+		return false, nil
+	}
+	g.malformed++
+	if g.malformed >= maxArgumentRepairAttempts {
+		ui.PrintfSafe("\n⚠️  The model sent malformed tool arguments %d times in a row. Stopping here; try rephrasing or a model with better tool support.\n", g.malformed)
+		return true, nil
+	}
+	return false, nil
+}
+
+// callSignature identifies a tool call by its name and arguments, ignoring the order of the
+// argument keys and whitespace
+func callSignature(tc openai.ToolCall) string {
+	args := strings.TrimSpace(tc.Function.Arguments)
+	var parsed interface{}
+	if json.Unmarshal([]byte(args), &parsed) == nil {
+		if canonical, err := json.Marshal(parsed); err == nil {
+			args = string(canonical)
+		}
+	}
+	return tc.Function.Name + "\x00" + args
+}
+
+// skipToolCalls answers each call with content instead of running it, so the conversation stays
+// valid for the next request
+func skipToolCalls(a *types.Agent, toolCalls []openai.ToolCall, content string) {
+	for _, tc := range toolCalls {
+		a.AddMessage(types.Message{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    content,
+			ToolCallID: tc.ID,
+		})
+	}
+}
+
+// guardSkipNote is the tool result of calls the guard kept from running
+func guardSkipNote(action guardAction) string {
+	if action == guardRedirect {
+		return fmt.Sprintf(redirectNote, repeatedCallLimit)
+	}
+	return "Tool call skipped: the user stopped the task"
+}
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"coding-agent/pkg/config"
+	"coding-agent/pkg/tools"
+	"coding-agent/pkg/types"
+)
+
+// ApproveDirectory grants tool access to a directory and its subfolders up front, reading and
+// changing files, so its first tool calls do not stop for the folder and write prompts. The grant
+// lasts for the session or, with save, is kept in the config as answering y at the prompts does.
+// A leading ~ is the home directory.
+func ApproveDirectory(a *types.Agent, path string, save bool) (string, error) {
+	abs, err := filepath.Abs(expandHome(path))
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %v", err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", abs)
+	}
+
+	a.ApproveFolder(abs)
+	a.ApproveWriteFolder(abs)
+	// Kept on the agent so reloading the config does not drop the grant
+	if !slices.Contains(a.SessionFolders, abs) {
+		a.SessionFolders = append(a.SessionFolders, abs)
+	}
+	if save && a.Config != nil && (!slices.Contains(a.Config.ApprovedFolders, abs) || !slices.Contains(a.Config.ApprovedWriteFolders, abs)) {
+		if !slices.Contains(a.Config.ApprovedFolders, abs) {
+			a.Config.ApprovedFolders = append(a.Config.ApprovedFolders, abs)
+		}
+		if !slices.Contains(a.Config.ApprovedWriteFolders, abs) {
+			a.Config.ApprovedWriteFolders = append(a.Config.ApprovedWriteFolders, abs)
+		}
+		if err := config.Save(a.ConfigPath, a.Config); err != nil {
+			return abs, fmt.Errorf("approved for this session only; saving the config failed: %v", err)
+		}
+	}
+	return abs, nil
+}
+
+// AddWorkspaceRoot registers another project root for the session. The root is approved for
+// tool access, reads and changes, until the session ends and its AGENTS.md joins the system prompt.
+func AddWorkspaceRoot(a *types.Agent, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %v", err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", abs)
+	}
+
+	cwd, _ := os.Getwd()
+	if abs == cwd {
+		return "", fmt.Errorf("%s is already the main root", abs)
+	}
+	name := tools.WorkspaceRootName(abs)
+	for _, root := range a.WorkspaceRoots {
+		if root == abs {
+			return "", fmt.Errorf("%s is already in the workspace", abs)
+		}
+		if tools.WorkspaceRootName(root) == name {
+			return "", fmt.Errorf("a root named %q already exists (%s)", name, root)
+		}
+	}
+
+	a.WorkspaceRoots = append(a.WorkspaceRoots, abs)
+	a.ApproveFolder(abs)
+	a.ApproveWriteFolder(abs)
+	refreshSystemPrompt(a)
+	recordReloadState(a)
+	return name, nil
+}
+
+// RemoveWorkspaceRoot removes a root added with AddWorkspaceRoot, by name or path
+func RemoveWorkspaceRoot(a *types.Agent, nameOrPath string) (string, error) {
+	abs, _ := filepath.Abs(nameOrPath)
+	for i, root := range a.WorkspaceRoots {
+		if root != abs && tools.WorkspaceRootName(root) != nameOrPath {
+			continue
+		}
+		a.WorkspaceRoots = append(a.WorkspaceRoots[:i], a.WorkspaceRoots[i+1:]...)
+		// Drop the session approvals unless the folder is also approved in the config
+		if a.Config == nil || !slices.Contains(a.Config.ApprovedFolders, root) {
+			a.RevokeFolder(root)
+		}
+		a.RevokeWriteFolder(root)
+		refreshSystemPrompt(a)
+		recordReloadState(a)
+		return root, nil
+	}
+	return "", fmt.Errorf("no workspace root named %q", nameOrPath)
+}
+
+// workspacePrompt describes the extra roots and includes their AGENTS.md, so the model knows
+// how to address files outside the current directory
+func workspacePrompt(a *types.Agent) string {
+	if len(a.WorkspaceRoots) == 0 {
+		return ""
+	}
+
+	cwd, _ := os.Getwd()
+	var b strings.Builder
+	b.WriteString("\n\n--- WORKSPACE ROOTS ---\n")
+	fmt.Fprintf(&b, "- main: %s (current directory; relative paths and bash_command resolve here)\n", cwd)
+	for _, root := range a.WorkspaceRoots {
+		fmt.Fprintf(&b, "- %s: %s\n", tools.WorkspaceRootName(root), root)
+	}
+	b.WriteString("Address files in other roots as @<root>/<path> (e.g. @")
+	b.WriteString(tools.WorkspaceRootName(a.WorkspaceRoots[0]))
+	b.WriteString("/README.md) or by absolute path. Always say which root a file belongs to.\n--- END WORKSPACE ROOTS ---")
+
+	for _, root := range a.WorkspaceRoots {
+		content, err := os.ReadFile(filepath.Join(root, agentsFile))
+		if err != nil || strings.TrimSpace(string(content)) == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "\n\n--- PROJECT CONTEXT (@%s/AGENTS.md) ---\n%s\n--- END PROJECT CONTEXT ---", tools.WorkspaceRootName(root), content)
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"fmt"
+
+	"coding-agent/pkg/config"
+	"coding-agent/pkg/types"
+)
+
+// handleArchitectCommand handles /architect [on|off|<editor>|<architect> <editor>]: it shows or
+// changes architect mode, where one model plans each prompt and another makes the edits
+func (h *Handler) handleArchitectCommand(parts []string) error {
+	settings := &h.agent.Config.Architect
+	switch {
+	case len(parts) == 1:
+		h.showArchitect()
+		return nil
+	case len(parts) == 2 && parts[1] == "off":
+		settings.Enabled = false
+	case len(parts) == 2 && parts[1] == "on":
+		if settings.Editor == "" {
+			fmt.Println("Choose the editor model first: /architect <editor> or /architect <architect> <editor>")
+			return nil
+		}
+		settings.Enabled = true
+	case len(parts) == 2 || len(parts) == 3:
+		architect, editor := "", parts[1]
+		if len(parts) == 3 {
+			architect, editor = parts[1], parts[2]
+		}
+		for _, key := range []string{architect, editor} {
+			if _, ok := h.agent.Config.Models[key]; key != "" && !ok {
+				fmt.Printf("❌ Model '%s' not found\n", key)
+				return nil
+			}
+		}
+		settings.Model, settings.Editor, settings.Enabled = architect, editor, true
+	default:
+		fmt.Println("Usage: /architect [on|off|<editor>|<architect> <editor>]")
+		return nil
+	}
+
+	if err := config.Save(h.agent.ConfigPath, h.agent.Config); err != nil {
+		return fmt.Errorf("failed to save config: %v", err)
+	}
+	h.showArchitect()
+	return nil
+}
+
+func (h *Handler) showArchitect() {
+	settings := h.agent.Config.Architect
+	if !settings.Enabled {
+		fmt.Println("🏛️  Architect mode is off. Turn it on with /architect <editor> or /architect <architect> <editor>.")
+		return
+	}
+	architect := settings.Model
+	if architect == "" {
+		architect = h.agent.ModelKey() + " (the current model)"
+	}
+	fmt.Printf("🏛️  Architect mode is on: %s plans with the read-only tools, %s makes the edits.\n", architect, settings.Editor)
+	fmt.Printf("%s   /architect off turns it off.%s\n", types.ColorGray, types.ColorReset)
+}
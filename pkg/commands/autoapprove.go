@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"fmt"
+
+	"coding-agent/pkg/agent"
+)
+
+// handleAutoApproveCommand handles /autoapprove [on | off | status]: while on, tool calls run
+// without asking, within the guardrails of auto-approve mode
+func (h *Handler) handleAutoApproveCommand(parts []string) error {
+	action := "status"
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+
+	switch action {
+	case "on":
+		h.agent.AutoApprove = true
+	case "off":
+		h.agent.AutoApprove = false
+	case "status":
+	default:
+		fmt.Println("Usage: /autoapprove [on | off | status]")
+		return nil
+	}
+	fmt.Println(agent.AutoApproveStatus(h.agent))
+	return nil
+}
@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"coding-agent/pkg/agent"
+	"coding-agent/pkg/diagnostics"
+	"coding-agent/pkg/project"
+	"coding-agent/pkg/ui"
+)
+
+const (
+	// maxBuildFixAttempts is how many times the agent is asked to fix the build before /build gives up
+	maxBuildFixAttempts = 5
+	// maxBuildDiagnostics bounds the errors listed in one fix request
+	maxBuildDiagnostics = 30
+)
+
+// handleBuildCommand handles /build [build command]: it builds the project and, while the build
+// fails, sends the compiler errors to the agent and rebuilds, up to maxBuildFixAttempts times
+func (h *Handler) handleBuildCommand(parts []string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %v", err)
+	}
+
+	buildCommand := strings.TrimSpace(strings.Join(parts[1:], " "))
+	if buildCommand == "" {
+		buildCommand = project.ResolveCommands(cwd, h.agent.Config.Commands).Build
+	}
+	if buildCommand == "" {
+		fmt.Println("❌ No build command configured or detected.")
+		fmt.Println("Usage: /build <build command>, or set \"commands\": {\"build\": \"...\"} in ~/.mcode-config.json")
+		return nil
+	}
+
+	lastFailure := ""
+	for attempt := 0; ; attempt++ {
+		fmt.Printf("🔨 Building: %s\n", buildCommand)
+		ctx, stop := ui.StartInterruptMonitor(context.Background(), nil)
+		output, passed := h.runShellCommand(ctx, buildCommand)
+		stop()
+		if ctx.Err() != nil {
+			fmt.Println("⏹️  Build interrupted")
+			return nil
+		}
+
+		if passed {
+			if attempt == 0 {
+				fmt.Println("✅ Build succeeded")
+			} else {
+				fmt.Printf("✅ Build succeeded after %d fix attempt(s)\n", attempt)
+			}
+			return nil
+		}
+
+		diags := diagnostics.Parse(output)
+		fmt.Printf("❌ Build failed with %s\n", describeDiagnostics(diags))
+
+		signature := failureSignature(output)
+		if signature == lastFailure {
+			fmt.Println("⚠️  The last fix attempt did not change the errors; stopping")
+			return nil
+		}
+		lastFailure = signature
+
+		if attempt == maxBuildFixAttempts {
+			fmt.Printf("⚠️  Build still failing after %d fix attempts; stopping\n", maxBuildFixAttempts)
+			return nil
+		}
+
+		if err := agent.Chat(h.agent, context.Background(), buildFixPrompt(buildCommand, output, diags)); err != nil {
+			return err
+		}
+	}
+}
+
+// buildFixPrompt asks the agent to fix the parsed errors, falling back to the raw output
+// when the compiler's format was not recognized
+func buildFixPrompt(command, output string, diags []diagnostics.Diagnostic) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The build (`%s`) failed. ", command)
+	if len(diags) == 0 {
+		output = strings.TrimSpace(output)
+		if len(output) > maxWatchFailureChars {
+			output = "...\n" + output[len(output)-maxWatchFailureChars:]
+		}
+		fmt.Fprintf(&b, "Output:\n```\n%s\n```\n", output)
+	} else {
+		b.WriteString("Compiler errors:\n")
+		for i, d := range diags {
+			if i == maxBuildDiagnostics {
+				fmt.Fprintf(&b, "... and %d more\n", len(diags)-maxBuildDiagnostics)
+				break
+			}
+			fmt.Fprintf(&b, "- %s\n", d)
+		}
+	}
+	b.WriteString("Fix these errors with minimal changes. The build will be rerun afterwards; do not run it yourself.")
+	return b.String()
+}
+
+func describeDiagnostics(diags []diagnostics.Diagnostic) string {
+	if len(diags) == 0 {
+		return "errors that could not be parsed"
+	}
+	files := make(map[string]bool)
+	for _, d := range diags {
+		files[d.File] = true
+	}
+	return fmt.Sprintf("%d error(s) in %d file(s)", len(diags), len(files))
+}
@@ -1,18 +1,20 @@
 package commands
 
 import (
-	"context"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"coding-agent/pkg/agent"
 	"coding-agent/pkg/config"
 	"coding-agent/pkg/conversation"
-	"coding-agent/pkg/llm"
+	"coding-agent/pkg/i18n"
 	"coding-agent/pkg/markdown"
 	"coding-agent/pkg/project"
 	"coding-agent/pkg/types"
@@ -25,6 +27,7 @@ type Handler struct {
 	agent           *types.Agent
 	projectManager  *project.Manager
 	conversationMgr *conversation.Manager
+	prefill         string // Text the next prompt starts with, see TakePrefill
 }
 
 // NewHandler creates a new command handler
@@ -52,7 +55,7 @@ func (h *Handler) Handle(command string) (bool, error) {
 
 	switch parts[0] {
 	case "/exit", "/quit":
-		fmt.Println("👋 Goodbye!")
+		fmt.Println(i18n.T("command.goodbye"))
 		return true, nil
 	case "/init":
 		err := h.projectManager.Initialize()
@@ -63,18 +66,30 @@ func (h *Handler) Handle(command string) (bool, error) {
 	case "/export":
 		err := h.projectManager.ExportContext(parts)
 		return false, err
+	case "/share":
+		err := h.handleShareCommand(parts)
+		return false, err
+	case "/search":
+		err := h.handleSearchCommand(parts)
+		return false, err
 	case "/prompt":
 		h.handlePromptCommand()
 		return false, nil
 	case "/models":
 		err := h.handleModelsCommand(parts)
 		return false, err
+	case "/architect":
+		err := h.handleArchitectCommand(parts)
+		return false, err
 	case "/permissions":
 		err := h.handlePermissionsCommand(parts)
 		return false, err
 	case "/compact":
 		err := agent.CompactContext(h.agent)
 		return false, err
+	case "/fork":
+		err := h.handleForkCommand(parts[1:])
+		return false, err
 	case "/help":
 		h.showHelp()
 		return false, nil
@@ -90,18 +105,62 @@ func (h *Handler) Handle(command string) (bool, error) {
 	case "/del":
 		err := h.handleDelCommand(parts)
 		return false, err
+	case "/sessions":
+		err := h.handleSessionsCommand(parts)
+		return false, err
+	case "/watch":
+		err := h.handleWatchCommand(parts)
+		return false, err
+	case "/build":
+		err := h.handleBuildCommand(parts)
+		return false, err
+	case "/workspace":
+		err := h.handleWorkspaceCommand(parts)
+		return false, err
+	case "/autoapprove":
+		err := h.handleAutoApproveCommand(parts)
+		return false, err
+	case "/add-dir", "/add_directory":
+		err := h.handleAddDirCommand(parts)
+		return false, err
+	case "/devcontainer":
+		err := h.handleDevcontainerCommand(parts)
+		return false, err
+	case "/k8s":
+		err := h.handleK8sCommand(parts)
+		return false, err
+	case "/ping":
+		err := h.handlePingCommand(parts)
+		return false, err
+	case "/stats":
+		h.showStats()
+		return false, nil
+	case "/cost":
+		h.showCost()
+		return false, nil
+	case "/explain":
+		err := h.handleExplainCommand(parts)
+		return false, err
+	case "/doc":
+		err := h.handleDocCommand(parts)
+		return false, err
+	case "/voice":
+		err := h.handleVoiceCommand(parts)
+		return false, err
 	default:
-		fmt.Printf("❌ Unknown command: %s\n", parts[0])
-		fmt.Println("Available commands: /exit, /init, /new, /export, /models, /permissions, /help, /compact, /save, /resume, /conv, /del")
+		fmt.Println(i18n.T("command.unknown", parts[0]))
+		fmt.Println(i18n.T("command.available", "/exit, /init, /new, /export, /share, /search, /models, /architect, /permissions, /autoapprove, /help, /compact, /fork, /save, /resume, /sessions, /conv, /del, /watch, /build, /workspace, /add-dir, /devcontainer, /k8s, /ping, /stats, /cost, /explain, /doc, /voice"))
 		return false, nil
 	}
 }
 
 // clearContext clears the conversation context
 func (h *Handler) clearContext() {
-	h.agent.Conversation = []types.Message{}
-	h.agent.LastTokenUsage = nil
+	h.agent.SetMessages([]types.Message{})
+	h.agent.RecordUsage(nil, 0)
 	h.agent.CurrentConvID = ""
+	h.agent.FileHashes = nil
+	h.agent.ContextFiles = nil
 
 	// Clear terminal
 	fmt.Print("\033[2J\033[H")
@@ -109,6 +168,21 @@ func (h *Handler) clearContext() {
 	fmt.Printf("%s🔄 Conversation context cleared - Starting fresh!%s\n", types.ColorGreen, types.ColorReset)
 }
 
+// handleForkCommand saves the conversation, then continues in a new one that starts from its summary
+// and the pinned files
+func (h *Handler) handleForkCommand(pinned []string) error {
+	// The original stays available to /resume
+	if err := h.handleSaveCommand(); err != nil {
+		return err
+	}
+	if err := agent.ForkContext(h.agent, pinned); err != nil {
+		return err
+	}
+	h.agent.RecordUsage(nil, 0)
+	h.agent.CurrentConvID = ""
+	return nil
+}
+
 // handlePromptCommand handles /prompt command
 func (h *Handler) handlePromptCommand() {
 	fmt.Println("\n🧠 Current System Prompt(s)")
@@ -117,7 +191,7 @@ func (h *Handler) handlePromptCommand() {
 	renderer, _ := markdown.NewTermRenderer()
 
 	found := false
-	for _, msg := range h.agent.Conversation {
+	for _, msg := range h.agent.Messages() {
 		if msg.Role == openai.ChatMessageRoleSystem {
 			found = true
 			fmt.Printf("\n%s[System Message]%s\n", types.ColorCyan, types.ColorReset)
@@ -142,14 +216,28 @@ func (h *Handler) handleModelsCommand(parts []string) error {
 		return h.listModels()
 	}
 
+	if parts[1] == "discover" && len(parts) <= 3 {
+		endpoint := ""
+		if len(parts) == 3 {
+			endpoint = parts[2]
+		}
+		return h.handleModelsDiscover(endpoint)
+	}
+
+	if parts[1] == "openrouter" {
+		return h.handleModelsOpenRouter(strings.Join(parts[2:], " "))
+	}
+
 	if len(parts) == 2 {
 		// Switch to model
 		return h.switchModel(parts[1])
 	}
 
 	fmt.Println("Usage:")
-	fmt.Println("  /models           - List available models")
-	fmt.Println("  /models <name>    - Switch to model")
+	fmt.Println("  /models                      - List available models")
+	fmt.Println("  /models <name>               - Switch to model")
+	fmt.Println("  /models discover [endpoint]  - Add models served by the configured endpoints (or the given one)")
+	fmt.Println("  /models openrouter [search]  - Browse OpenRouter's catalog and switch to a hosted model")
 	return nil
 }
 
@@ -160,7 +248,7 @@ func (h *Handler) listModels() error {
 
 	for key, model := range h.agent.Config.Models {
 		status := ""
-		if key == h.agent.Config.CurrentModel {
+		if key == h.agent.ModelKey() {
 			status = " (current)"
 		}
 
@@ -170,6 +258,24 @@ func (h *Handler) listModels() error {
 		if model.Provider != "" {
 			fmt.Printf("   Provider: %s\n", model.Provider)
 		}
+		if model.MaxTokens > 0 {
+			fmt.Printf("   Context: %d tokens\n", model.MaxTokens)
+		}
+		if maxOutput, _ := agent.OutputTokenLimit(model, 0); maxOutput > 0 {
+			fmt.Printf("   Max output: %d tokens\n", maxOutput)
+		}
+		if model.ToolMode != "" {
+			fmt.Printf("   Tool mode: %s\n", model.ToolMode)
+		}
+		if model.Vision {
+			fmt.Println("   Vision: yes")
+		}
+		if tasks := agent.ModelTasks(h.agent.Config, key); len(tasks) > 0 {
+			fmt.Printf("   Used for: %s\n", strings.Join(tasks, ", "))
+		}
+		if perf, ok := h.agent.ModelPerf[key]; ok {
+			fmt.Printf("   Speed: %s (average of last %d responses)\n", agent.FormatGenerationStats(perf.Average()), len(perf.Samples))
+		}
 		if model.APIKey != "" {
 			if len(model.APIKey) > 4 {
 				fmt.Printf("   API Key: ***%s\n", model.APIKey[len(model.APIKey)-4:])
@@ -199,6 +305,7 @@ func (h *Handler) switchModel(modelKey string) error {
 
 	// Update config
 	h.agent.Config.CurrentModel = modelKey
+	h.agent.Model = modelKey
 
 	// Save config
 	if err := config.Save(h.agent.ConfigPath, h.agent.Config); err != nil {
@@ -206,29 +313,15 @@ func (h *Handler) switchModel(modelKey string) error {
 	}
 
 	// Update provider
-	var provider llm.Provider
-	if model.Provider == "gemini" || strings.Contains(strings.ToLower(model.Name), "gemini") {
-		geminiProvider, err := llm.NewGeminiProvider(context.Background(), model.APIKey)
-		if err != nil {
-			fmt.Printf("Error initializing Gemini provider: %v. Falling back to OpenAI.\n", err)
-			clientConfig := openai.DefaultConfig(model.APIKey)
-			clientConfig.BaseURL = model.BaseURL
-			provider = llm.NewOpenAIProvider(openai.NewClientWithConfig(clientConfig))
-		} else {
-			provider = geminiProvider
-		}
-	} else {
-		clientConfig := openai.DefaultConfig(model.APIKey)
-		clientConfig.BaseURL = model.BaseURL
-		provider = llm.NewOpenAIProvider(openai.NewClientWithConfig(clientConfig))
-	}
-	h.agent.LLM = provider
+	h.agent.LLM = agent.NewProvider(model)
+	agent.ApplyEndpointContextLimit(h.agent, modelKey)
 
 	fmt.Printf("✅ Switched to model: %s\n", modelKey)
 	fmt.Printf("📱 Name: %s\n", model.Name)
 	if model.BaseURL != "" {
 		fmt.Printf("🌐 URL: %s\n", model.BaseURL)
 	}
+	h.checkSwitchedModel(model)
 
 	return nil
 }
@@ -247,15 +340,35 @@ func (h *Handler) handlePermissionsCommand(parts []string) error {
 		return h.removeWebDomainPermission(parts[2])
 	}
 
+	if len(parts) == 3 && parts[1] == "remove-rule" {
+		return h.removeApprovalRule(parts[2])
+	}
+
+	if len(parts) == 3 && parts[1] == "remove-permission" {
+		return h.removePermissionRule(parts[2])
+	}
+
+	if len(parts) == 3 && parts[1] == "deny" {
+		return h.denyFolder(parts[2])
+	}
+
+	if len(parts) == 3 && parts[1] == "remove-deny" {
+		return h.removeDeniedFolder(parts[2])
+	}
+
 	if len(parts) == 2 && parts[1] == "disable-web-search" {
 		return h.disableWebSearchPermission()
 	}
 
 	fmt.Println("Usage:")
 	fmt.Println("  /permissions                    - List approved folder and web permissions")
-	fmt.Println("  /permissions remove <path>      - Remove folder permission")
+	fmt.Println("  /permissions remove <path>      - Remove folder permission, read and write")
 	fmt.Println("  /permissions remove-domain <d>  - Remove approved web domain")
 	fmt.Println("  /permissions disable-web-search - Disable saved web search permission")
+	fmt.Println("  /permissions remove-rule <n>    - Remove an always-allow rule")
+	fmt.Println("  /permissions remove-permission <n> - Remove a permission rule")
+	fmt.Println("  /permissions deny <path>        - Deny all tool access to a folder")
+	fmt.Println("  /permissions remove-deny <path> - Take a folder off the denied list")
 	return nil
 }
 
@@ -268,11 +381,46 @@ func (h *Handler) listPermissions() error {
 		fmt.Println("No folders have been approved yet.")
 	} else {
 		for i, folder := range h.agent.Config.ApprovedFolders {
-			fmt.Printf("%d. %s\n", i+1, folder)
+			fmt.Printf("%d. %s (%s)\n", i+1, folder, agent.FolderAccess(h.agent, folder))
 		}
 
 		fmt.Printf("\nTotal: %d folder(s)\n", len(h.agent.Config.ApprovedFolders))
 	}
+	var sessionFolders []string
+	for _, folder := range h.agent.ApprovedFolderList() {
+		if !slices.Contains(h.agent.Config.ApprovedFolders, folder) {
+			sessionFolders = append(sessionFolders, folder)
+		}
+	}
+	if len(sessionFolders) > 0 {
+		sort.Strings(sessionFolders)
+		fmt.Println("\nApproved for this session only:")
+		for _, folder := range sessionFolders {
+			fmt.Printf("  %s (%s)\n", folder, agent.FolderAccess(h.agent, folder))
+		}
+	}
+	var writeOnly []string
+	for _, folder := range append(slices.Clone(h.agent.Config.ApprovedWriteFolders), h.agent.WriteFolderList()...) {
+		if !agent.IsFolderApproved(h.agent, folder) && !slices.Contains(writeOnly, folder) {
+			writeOnly = append(writeOnly, folder)
+		}
+	}
+	if len(writeOnly) > 0 {
+		fmt.Println("\nApproved for writes, reads still ask:")
+		for _, folder := range writeOnly {
+			fmt.Printf("  %s (write)\n", folder)
+		}
+	}
+
+	fmt.Println("\n⛔ Denied Folders")
+	fmt.Println("=================")
+	if denied := agent.DeniedFolders(h.agent); len(denied) == 0 {
+		fmt.Println("No folders are denied.")
+	} else {
+		for _, folder := range denied {
+			fmt.Printf("  %s\n", folder)
+		}
+	}
 
 	fmt.Println("\n🌐 Web Permissions")
 	fmt.Println("==================")
@@ -284,13 +432,101 @@ func (h *Handler) listPermissions() error {
 
 	if len(h.agent.Config.ApprovedWebDomains) == 0 {
 		fmt.Println("Approved web domains: none")
+	} else {
+		fmt.Println("Approved web domains:")
+		for i, domain := range h.agent.Config.ApprovedWebDomains {
+			fmt.Printf("%d. %s\n", i+1, domain)
+		}
+	}
+
+	if len(h.agent.Config.ToolPolicy) > 0 || len(h.agent.ToolSettings.ToolPolicy) > 0 {
+		fmt.Println("\n📋 Tool Policy")
+		fmt.Println("==============")
+		printPolicies := func(policies map[string]string, source string) {
+			names := make([]string, 0, len(policies))
+			for name := range policies {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("%s: %s (%s)\n", name, policies[name], source)
+			}
+		}
+		printPolicies(h.agent.Config.ToolPolicy, "config")
+		printPolicies(h.agent.ToolSettings.ToolPolicy, ".mcode/tools.json")
+	}
+
+	if len(h.agent.Config.Permissions) > 0 {
+		fmt.Println("\n📜 Permission Rules")
+		fmt.Println("===================")
+		for i, rule := range h.agent.Config.Permissions {
+			fmt.Printf("%d. %s: %s\n", i+1, rule.Action, agent.DescribeRule(rule))
+		}
+	}
+
+	fmt.Println("\n✅ Always Allowed")
+	fmt.Println("=================")
+	if len(h.agent.Config.AlwaysAllow) == 0 && len(h.agent.SessionAllow) == 0 {
+		fmt.Println("No always-allow rules yet. Answer 'a' at a tool prompt to add one.")
+		return nil
+	}
+	for i, rule := range h.agent.Config.AlwaysAllow {
+		fmt.Printf("%d. %s\n", i+1, agent.DescribeApproval(rule))
+	}
+	if len(h.agent.SessionAllow) > 0 {
+		fmt.Println("\nAllowed for this session only:")
+		for i, rule := range h.agent.SessionAllow {
+			fmt.Printf("%d. %s\n", len(h.agent.Config.AlwaysAllow)+i+1, agent.DescribeApproval(rule))
+		}
+	}
+	return nil
+}
+
+// removeApprovalRule removes the always-allow rule with the number shown by /permissions; the
+// session's rules are numbered after the saved ones
+func (h *Handler) removeApprovalRule(arg string) error {
+	n, err := strconv.Atoi(arg)
+	rules := h.agent.Config.AlwaysAllow
+	if err != nil || n < 1 || n > len(rules)+len(h.agent.SessionAllow) {
+		fmt.Printf("❌ No always-allow rule number %s\n", arg)
+		return nil
+	}
+
+	if n > len(rules) {
+		session := h.agent.SessionAllow
+		i := n - len(rules) - 1
+		removed := session[i]
+		h.agent.SessionAllow = append(session[:i:i], session[i+1:]...)
+		fmt.Printf("✅ Removed always-allow rule: %s\n", agent.DescribeApproval(removed))
+		return nil
+	}
+
+	removed := rules[n-1]
+	h.agent.Config.AlwaysAllow = append(rules[:n-1:n-1], rules[n:]...)
+	if err := config.Save(h.agent.ConfigPath, h.agent.Config); err != nil {
+		return fmt.Errorf("failed to save config: %v", err)
+	}
+
+	fmt.Printf("✅ Removed always-allow rule: %s\n", agent.DescribeApproval(removed))
+	return nil
+}
+
+// removePermissionRule removes the permission rule with the number shown by /permissions
+func (h *Handler) removePermissionRule(arg string) error {
+	n, err := strconv.Atoi(arg)
+	rules := h.agent.Config.Permissions
+	if err != nil || n < 1 || n > len(rules) {
+		fmt.Printf("❌ No permission rule number %s\n", arg)
 		return nil
 	}
 
-	fmt.Println("Approved web domains:")
-	for i, domain := range h.agent.Config.ApprovedWebDomains {
-		fmt.Printf("%d. %s\n", i+1, domain)
+	removed := rules[n-1]
+	h.agent.Config.Permissions = append(rules[:n-1:n-1], rules[n:]...)
+	if err := config.Save(h.agent.ConfigPath, h.agent.Config); err != nil {
+		return fmt.Errorf("failed to save config: %v", err)
 	}
+
+	fmt.Printf("✅ Removed permission rule: %s %s\n", removed.Action, agent.DescribeRule(removed))
 	return nil
 }
 
@@ -302,15 +538,11 @@ func (h *Handler) removeFolderPermission(folderPath string) error {
 		return fmt.Errorf("error resolving path: %v", err)
 	}
 
-	// Check if folder is in approved list
-	found := false
-	newApproved := make([]string, 0, len(h.agent.Config.ApprovedFolders))
-	for _, folder := range h.agent.Config.ApprovedFolders {
-		if folder != absPath {
-			newApproved = append(newApproved, folder)
-		} else {
-			found = true
-		}
+	// Check if folder is in approved list; its write access goes with it
+	found := slices.Contains(h.agent.Config.ApprovedFolders, absPath) || slices.Contains(h.agent.Config.ApprovedWriteFolders, absPath) ||
+		slices.Contains(h.agent.SessionFolders, absPath)
+	without := func(folders []string) []string {
+		return slices.DeleteFunc(slices.Clone(folders), func(folder string) bool { return folder == absPath })
 	}
 
 	if !found {
@@ -319,8 +551,11 @@ func (h *Handler) removeFolderPermission(folderPath string) error {
 	}
 
 	// Update config and save
-	h.agent.Config.ApprovedFolders = newApproved
-	delete(h.agent.ApprovedFolders, absPath)
+	h.agent.Config.ApprovedFolders = without(h.agent.Config.ApprovedFolders)
+	h.agent.Config.ApprovedWriteFolders = without(h.agent.Config.ApprovedWriteFolders)
+	h.agent.SessionFolders = without(h.agent.SessionFolders)
+	h.agent.RevokeFolder(absPath)
+	h.agent.RevokeWriteFolder(absPath)
 
 	if err := config.Save(h.agent.ConfigPath, h.agent.Config); err != nil {
 		return fmt.Errorf("failed to save config: %v", err)
@@ -330,6 +565,32 @@ func (h *Handler) removeFolderPermission(folderPath string) error {
 	return nil
 }
 
+// denyFolder adds a folder to the denied folders, which no tool may access
+func (h *Handler) denyFolder(folderPath string) error {
+	if !agent.DenyFolder(h.agent, folderPath) {
+		fmt.Printf("⛔ Already denied: %s\n", folderPath)
+		return nil
+	}
+	if err := config.Save(h.agent.ConfigPath, h.agent.Config); err != nil {
+		return fmt.Errorf("failed to save config: %v", err)
+	}
+	fmt.Printf("⛔ Denied tool access to %s\n", folderPath)
+	return nil
+}
+
+// removeDeniedFolder takes a folder off the denied folders; it still needs approval as usual
+func (h *Handler) removeDeniedFolder(folderPath string) error {
+	if !agent.UndenyFolder(h.agent, folderPath) {
+		fmt.Printf("❌ Folder not found in denied list: %s\n", folderPath)
+		return nil
+	}
+	if err := config.Save(h.agent.ConfigPath, h.agent.Config); err != nil {
+		return fmt.Errorf("failed to save config: %v", err)
+	}
+	fmt.Printf("✅ Removed denied folder: %s\n", folderPath)
+	return nil
+}
+
 func (h *Handler) removeWebDomainPermission(domain string) error {
 	normalizedDomain := normalizeDomain(domain)
 	if normalizedDomain == "" {
@@ -403,15 +664,33 @@ func (h *Handler) showHelp() {
 	fmt.Println("Slash Commands:")
 	fmt.Println("  /init        - Initialize project and create AGENTS.md")
 	fmt.Println("  /new         - Clear conversation context (start fresh)")
-	fmt.Println("  /export      - Export conversation context to text file")
+	fmt.Println("  /export      - Export conversation context to text file (--no-tools, --last N, --role user,assistant)")
+	fmt.Println("  /share       - Upload the redacted transcript to a secret gist or paste service (same filters)")
+	fmt.Println("  /search      - Find text in the current conversation and saved sessions (/search <query>)")
 	fmt.Println("  /prompt      - List current system instructions/prompts")
-	fmt.Println("  /models      - List or switch between available models")
-	fmt.Println("  /permissions - Manage folder and web permissions")
+	fmt.Println("  /explain     - Explain a file, a line's definition or a symbol with its imports and uses (/explain <path[:line]|symbol>)")
+	fmt.Println("  /doc         - Write or update doc comments and README sections for a file or package (/doc <path|package>)")
+	fmt.Println("  /voice       - Dictate a message: record until Enter, then edit the transcript at the prompt")
+	fmt.Println("  /models      - List, switch or discover models (/models discover [endpoint], /models openrouter [search])")
+	fmt.Println("  /architect   - Plan with one model and edit with another (/architect [architect] <editor>, on, off)")
+	fmt.Println("  /ping [model] - Check the model endpoint, model availability and tool calling")
+	fmt.Println("  /permissions - Manage folder, web and always-allow permissions")
+	fmt.Println("  /autoapprove - Run tool calls without asking, within guardrails (on, off, status)")
+	fmt.Println("  /stats       - Show session token usage and generation speed per model")
+	fmt.Println("  /cost        - Show what this session cost per model, from the configured prices")
 	fmt.Println("  /compact     - Compact conversation context to save tokens")
+	fmt.Println("  /fork [files] - Save this session and continue in a fresh one from its summary and the given files")
 	fmt.Println("  /save        - Save current conversation to disk")
 	fmt.Println("  /resume      - List and resume saved conversations")
+	fmt.Println("  /sessions    - List, switch, rename, delete or prune saved sessions")
 	fmt.Println("  /conv        - Manage conversations (list, save, delete, info)")
 	fmt.Println("  /del <id>    - Delete a conversation by ID")
+	fmt.Println("  /watch [cmd] - Rerun tests on file changes and send new failures to the agent")
+	fmt.Println("  /build [cmd] - Build and let the agent fix compiler errors until the build is clean")
+	fmt.Println("  /workspace   - List, add or remove project roots (/workspace add ../shared-lib)")
+	fmt.Println("  /add-dir     - Approve a folder for tool access up front (/add-dir [--save] <path>)")
+	fmt.Println("  /devcontainer - Run shell commands in the project's devcontainer (on, off, status)")
+	fmt.Println("  /k8s         - Run shell commands (and optionally file tools) in a pod (/k8s exec <pod>)")
 	fmt.Println("  /exit        - Exit the agent")
 	fmt.Println("  /help        - Show this help message")
 	fmt.Println()
@@ -435,7 +714,7 @@ func (h *Handler) showHelp() {
 	fmt.Println()
 	fmt.Println("Usage:")
 	fmt.Println("  - Type natural language requests for coding tasks")
-	fmt.Println("  - Review and approve tool executions (Y/n/s/i/b)")
+	fmt.Println("  - Review and approve tool executions (Y/n/s/a/i/b)")
 	fmt.Println("    • Y/Enter: Execute tool (default)")
 	fmt.Println("    • n: Deny execution")
 	fmt.Println("    • s: Skip execution")
@@ -452,6 +731,43 @@ func (h *Handler) showHelp() {
 
 // handleSaveCommand handles /save command
 func (h *Handler) handleSaveCommand() error {
+	conv, isNew, err := h.saveConversation()
+	if err != nil {
+		return err
+	}
+
+	if isNew {
+		fmt.Printf("💾 Conversation saved as NEW: %s\n", conv.ID)
+	} else {
+		fmt.Printf("💾 Conversation UPDATED: %s\n", conv.ID)
+	}
+
+	if conv.Title != "Untitled Conversation" {
+		fmt.Printf("   Title: %s\n", conv.Title)
+	}
+	fmt.Printf("   Messages: %d\n", len(conv.Messages))
+	fmt.Printf("   Tokens: %d\n", conv.TokensUsed)
+	fmt.Printf("   Model: %s\n", conv.Model)
+
+	return nil
+}
+
+// SaveSession saves the conversation on exit, if there is one, so the next session in this
+// directory can offer to continue it
+func (h *Handler) SaveSession() {
+	for _, msg := range h.agent.Messages() {
+		if msg.Role == openai.ChatMessageRoleUser {
+			if _, _, err := h.saveConversation(); err != nil {
+				fmt.Printf("⚠️  %v\n", err)
+			}
+			return
+		}
+	}
+}
+
+// saveConversation saves the current conversation and records it as the latest one of the
+// current directory
+func (h *Handler) saveConversation() (*conversation.Conversation, bool, error) {
 	// Use existing ID if we are in a resumed session, otherwise generate new
 	id := h.agent.CurrentConvID
 	isNew := false
@@ -467,9 +783,12 @@ func (h *Handler) handleSaveCommand() error {
 		Title:      "Untitled Conversation",
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
-		Messages:   convertMessages(h.agent.Conversation),
-		TokensUsed: h.agent.TotalTokensUsed,
-		Model:      h.agent.Config.CurrentModel,
+		Messages:   conversation.FromAgentMessages(h.agent.Messages()),
+		TokensUsed: h.agent.SessionTokens(),
+		Model:      h.agent.ModelKey(),
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		conv.Dir = cwd
 	}
 
 	// If updating, try to preserve the original CreatedAt
@@ -495,23 +814,12 @@ func (h *Handler) handleSaveCommand() error {
 
 	// Save to disk
 	if err := h.conversationMgr.Save(conv); err != nil {
-		return fmt.Errorf("failed to save conversation: %v", err)
+		return nil, false, fmt.Errorf("failed to save conversation: %v", err)
 	}
-
-	if isNew {
-		fmt.Printf("💾 Conversation saved as NEW: %s\n", conv.ID)
-	} else {
-		fmt.Printf("💾 Conversation UPDATED: %s\n", conv.ID)
+	if conv.Dir != "" {
+		h.conversationMgr.SetLatest(conv.Dir, conv.ID)
 	}
-
-	if conv.Title != "Untitled Conversation" {
-		fmt.Printf("   Title: %s\n", conv.Title)
-	}
-	fmt.Printf("   Messages: %d\n", len(conv.Messages))
-	fmt.Printf("   Tokens: %d\n", conv.TokensUsed)
-	fmt.Printf("   Model: %s\n", conv.Model)
-
-	return nil
+	return conv, isNew, nil
 }
 
 // handleResumeCommand handles /resume command
@@ -679,12 +987,12 @@ func (h *Handler) resumeConversation(id string) error {
 	fmt.Println()
 
 	// Convert to agent conversation format
-	agentMessages := convertMessagesFromConversation(conv)
+	agentMessages := conversation.ToAgentMessages(conv.Messages)
 
 	// Update agent state
-	h.agent.Conversation = agentMessages
-	h.agent.TotalTokensUsed = conv.TokensUsed
-	h.agent.Config.CurrentModel = conv.Model
+	h.agent.SetMessages(agentMessages)
+	h.agent.SetSessionTokens(conv.TokensUsed)
+	h.agent.Model = conv.Model
 	h.agent.CurrentConvID = id
 
 	// Display all old messages to help user understand context
@@ -795,70 +1103,6 @@ func (h *Handler) showConvInfo(id string) error {
 	return nil
 }
 
-// convertMessages converts agent conversation to conversation manager format
-func convertMessages(agentMsgs []types.Message) []conversation.Message {
-	convMsgs := make([]conversation.Message, 0, len(agentMsgs))
-	for _, msg := range agentMsgs {
-		cm := conversation.Message{
-			Role:             msg.Role,
-			Content:          msg.Content,
-			Reasoning:        msg.Reasoning,
-			ThoughtSignature: msg.ThoughtSignature,
-		}
-		if msg.Role == openai.ChatMessageRoleTool {
-			cm.ToolID = msg.ToolCallID
-		}
-
-		if len(msg.ToolCalls) > 0 {
-			cm.ToolCalls = make([]conversation.ToolCall, len(msg.ToolCalls))
-			for i, tc := range msg.ToolCalls {
-				cm.ToolCalls[i] = conversation.ToolCall{
-					ID:   tc.ID,
-					Type: string(tc.Type),
-					Function: conversation.FunctionCall{
-						Name:      tc.Function.Name,
-						Arguments: tc.Function.Arguments,
-					},
-				}
-			}
-		}
-		convMsgs = append(convMsgs, cm)
-	}
-	return convMsgs
-}
-
-// convertMessagesFromConversation converts conversation manager format to agent format
-func convertMessagesFromConversation(conv *conversation.Conversation) []types.Message {
-	agentMsgs := make([]types.Message, 0, len(conv.Messages))
-	for _, msg := range conv.Messages {
-		am := types.Message{
-			Role:             msg.Role,
-			Content:          msg.Content,
-			Reasoning:        msg.Reasoning,
-			ThoughtSignature: msg.ThoughtSignature,
-		}
-		if msg.Role == openai.ChatMessageRoleTool {
-			am.ToolCallID = msg.ToolID
-		}
-
-		if len(msg.ToolCalls) > 0 {
-			am.ToolCalls = make([]openai.ToolCall, len(msg.ToolCalls))
-			for i, tc := range msg.ToolCalls {
-				am.ToolCalls[i] = openai.ToolCall{
-					ID:   tc.ID,
-					Type: openai.ToolType(tc.Type),
-					Function: openai.FunctionCall{
-						Name:      tc.Function.Name,
-						Arguments: tc.Function.Arguments,
-					},
-				}
-			}
-		}
-		agentMsgs = append(agentMsgs, am)
-	}
-	return agentMsgs
-}
-
 // truncateString truncates a string to a maximum length
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
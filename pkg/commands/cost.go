@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"coding-agent/pkg/agent"
+	"coding-agent/pkg/usage"
+)
+
+// showCost handles /cost: the tokens and cost of this session's responses per model, from the
+// models' configured prices, and what all sessions spent today
+func (h *Handler) showCost() {
+	fmt.Println("\n💰 Session Cost")
+	fmt.Println("===============")
+
+	if len(h.agent.ModelCost) == 0 {
+		fmt.Println("No responses yet.")
+	}
+	keys := make([]string, 0, len(h.agent.ModelCost))
+	for key := range h.agent.ModelCost {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	unpriced := false
+	for _, key := range keys {
+		stats := h.agent.ModelCost[key]
+		model := h.agent.Config.Models[key]
+		price := "no prices set"
+		if model.InputPrice > 0 || model.OutputPrice > 0 {
+			price = fmt.Sprintf("$%.2f in / $%.2f out per 1M", model.InputPrice, model.OutputPrice)
+		} else {
+			unpriced = true
+		}
+		fmt.Printf("  %-24s %4d responses  %8d in  %7d out  %10s  (%s)\n",
+			key, stats.Responses, stats.PromptTokens, stats.CompletionTokens, agent.FormatCost(stats.Cost), price)
+	}
+	if len(keys) > 0 {
+		fmt.Printf("Total this session: %s\n", agent.FormatCost(agent.SessionCost(h.agent)))
+	}
+
+	now := time.Now()
+	if entries, err := usage.Load(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())); err == nil && len(entries) > 0 {
+		_, today := usage.Summarize(entries, false)
+		fmt.Printf("Today, all sessions: %s over %d responses (see `mcode usage`)\n", agent.FormatCost(today.Cost), today.Requests)
+	}
+	if unpriced {
+		fmt.Println("\nSet input_price and output_price (USD per million tokens) on a model in the config to track its cost.")
+	}
+	fmt.Println()
+}
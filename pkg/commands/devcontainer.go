@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"coding-agent/pkg/devcontainer"
+)
+
+// handleDevcontainerCommand handles /devcontainer [on | off | status]: while on, bash_command,
+// /build, /watch and the linter, formatter and coverage commands run inside the project's devcontainer
+func (h *Handler) handleDevcontainerCommand(parts []string) error {
+	action := "status"
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+
+	switch action {
+	case "on":
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %v", err)
+		}
+		target, err := devcontainer.Attach(context.Background(), cwd)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return nil
+		}
+		h.agent.Exec = target
+		fmt.Printf("🐳 Shell commands now run in %s (%s)\n", target.Name, target.Workdir)
+	case "off":
+		if h.agent.Exec == nil {
+			fmt.Println("Shell commands already run on the host")
+			return nil
+		}
+		h.agent.Exec = nil
+		fmt.Println("✅ Shell commands now run on the host")
+	case "status":
+		if h.agent.Exec != nil {
+			fmt.Printf("🐳 Shell commands run in %s (%s)\n", h.agent.Exec.Name, h.agent.Exec.Workdir)
+			return nil
+		}
+		fmt.Println("Shell commands run on the host")
+		cwd, _ := os.Getwd()
+		if devcontainer.Find(cwd) != "" {
+			fmt.Println("This project has a devcontainer; use /devcontainer on to run commands inside it")
+		}
+	default:
+		fmt.Println("Usage: /devcontainer [on | off | status]")
+	}
+	return nil
+}
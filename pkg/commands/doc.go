@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"coding-agent/pkg/agent"
+	"coding-agent/pkg/project"
+)
+
+// handleDocCommand handles /doc <path|package>: it finds the undocumented declarations of the
+// target and asks the agent to document them with edit_file, in the style AGENTS.md describes
+func (h *Handler) handleDocCommand(parts []string) error {
+	target := strings.TrimSpace(strings.Join(parts[1:], " "))
+	if target == "" {
+		fmt.Println("Usage: /doc <path|package>, e.g. /doc pkg/agent/agent.go, /doc pkg/tools or /doc agent")
+		return nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %v", err)
+	}
+
+	t, err := project.ResolveDocTarget(cwd, target)
+	if err != nil {
+		return err
+	}
+	style := project.DocStyle(h.projectManager.LoadAgentsMD())
+	summary := fmt.Sprintf("%d file(s) in %s", len(t.Files), t.Dir)
+	if len(t.Files) == 1 {
+		summary = t.Files[0]
+	}
+	if len(t.Undocumented) > 0 {
+		summary += fmt.Sprintf(", %d undocumented declaration(s)", len(t.Undocumented))
+	}
+	if style != "" {
+		summary += ", following AGENTS.md"
+	}
+	fmt.Printf("📝 Documenting %s\n", summary)
+	return agent.Chat(h.agent, context.Background(), t.Prompt(style))
+}
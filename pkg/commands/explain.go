@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"coding-agent/pkg/agent"
+	"coding-agent/pkg/explain"
+)
+
+// handleExplainCommand handles /explain <path[:line]|symbol>: it gathers the code, what its file
+// imports and where it is used, and asks the agent for a structured explanation
+func (h *Handler) handleExplainCommand(parts []string) error {
+	target := strings.TrimSpace(strings.Join(parts[1:], " "))
+	if target == "" {
+		fmt.Println("Usage: /explain <path[:line]|symbol>, e.g. /explain main.go, /explain pkg/agent/agent.go:120 or /explain Server.Start")
+		return nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %v", err)
+	}
+
+	c, err := explain.Gather(cwd, target)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("📖 Explaining %s\n", c.Summary())
+	return agent.Chat(h.agent, context.Background(), c.Prompt())
+}
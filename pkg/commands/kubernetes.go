@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"coding-agent/pkg/kubernetes"
+)
+
+const k8sUsage = "Usage: /k8s exec <pod> [-l selector] [-n namespace] [-c container] [-w workdir] [--context name] [--files] | /k8s off | /k8s status"
+
+// handleK8sCommand handles /k8s: while attached, bash_command and the other shell-based tools run
+// inside a pod's container, and with --files the file tools read and write there too
+func (h *Handler) handleK8sCommand(parts []string) error {
+	action := "status"
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+
+	switch action {
+	case "exec":
+		opts, err := kubernetes.ParseArgs(parts[2:])
+		if err != nil {
+			fmt.Printf("❌ %v\n%s\n", err, k8sUsage)
+			return nil
+		}
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %v", err)
+		}
+		target, err := kubernetes.Attach(context.Background(), opts, cwd)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return nil
+		}
+		h.agent.Exec = target
+		fmt.Printf("☸️  Shell commands now run in %s\n", target.Name)
+		if target.RemoteFiles {
+			fmt.Println("   File tools read and write files in the pod; paths are relative to its working directory")
+		} else {
+			fmt.Println("   File tools still use the local copy; add --files to edit files in the pod")
+		}
+	case "off":
+		if h.agent.Exec == nil {
+			fmt.Println("Shell commands already run on the host")
+			return nil
+		}
+		h.agent.Exec = nil
+		fmt.Println("✅ Shell commands and file tools now run on the host")
+	case "status":
+		if h.agent.Exec == nil {
+			fmt.Println("Shell commands run on the host")
+			return nil
+		}
+		files := "host"
+		if h.agent.Exec.RemoteFiles {
+			files = "target"
+		}
+		fmt.Printf("Shell commands run in %s; files are read and written on the %s\n", h.agent.Exec.Name, files)
+	default:
+		fmt.Println(k8sUsage)
+	}
+	return nil
+}
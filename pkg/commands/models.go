@@ -0,0 +1,327 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/config"
+	"coding-agent/pkg/llm"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+)
+
+// discoverKeys are the keys that pick a discovered model. Letters ReadConfirmation gives another
+// meaning (i for Esc, t for Ctrl+T) and y/n/s are left out to avoid accidental picks.
+const discoverKeys = "123456789abcdefghjklmopqruvwxz"
+
+// discoveredModel is a model an endpoint serves that is not in the config yet
+type discoveredModel struct {
+	baseURL string
+	apiKey  string
+	info    llm.ModelInfo
+}
+
+// handleModelsDiscover handles /models discover [endpoint]: it lists the models served by the given
+// endpoint, or by every configured base URL, and adds the ones the user picks to the config
+func (h *Handler) handleModelsDiscover(endpoint string) error {
+	var found []discoveredModel
+	for _, target := range discoveryEndpoints(h.agent.Config, endpoint) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		baseURL, models, err := listEndpointModels(ctx, target.BaseURL, target.APIKey)
+		cancel()
+		if err != nil {
+			fmt.Printf("⚠️  %s: %v\n", target.BaseURL, err)
+			continue
+		}
+		for _, info := range models {
+			if !modelConfigured(h.agent.Config, baseURL, info.ID) {
+				found = append(found, discoveredModel{baseURL: baseURL, apiKey: target.APIKey, info: info})
+			}
+		}
+	}
+
+	if len(found) == 0 {
+		fmt.Println("No new models found; every model the endpoints report is already configured.")
+		return nil
+	}
+	if len(found) > len(discoverKeys) {
+		fmt.Printf("Showing the first %d of %d new models; pass an endpoint to narrow the list.\n", len(discoverKeys), len(found))
+		found = found[:len(discoverKeys)]
+	}
+
+	fmt.Println("\n🔎 Discovered Models")
+	fmt.Println("====================")
+	for i, d := range found {
+		window := ""
+		if d.info.ContextLength > 0 {
+			window = fmt.Sprintf(" (%d tokens)", d.info.ContextLength)
+		}
+		fmt.Printf("  [%c] %s%s  %s%s%s\n", discoverKeys[i], d.info.ID, window, types.ColorGray, d.baseURL, types.ColorReset)
+	}
+	fmt.Println("\nPress a key to add that model; Enter or Esc when done.")
+
+	added := 0
+	for {
+		key := ui.ReadConfirmation()
+		index := strings.Index(discoverKeys, key)
+		if len(key) != 1 || index < 0 || index >= len(found) {
+			break
+		}
+		d := found[index]
+		if modelConfigured(h.agent.Config, d.baseURL, d.info.ID) {
+			continue
+		}
+		name := modelKeyFor(d.info.ID, h.agent.Config.Models)
+		h.agent.Config.Models[name] = types.Model{
+			Name:      d.info.ID,
+			BaseURL:   d.baseURL,
+			APIKey:    d.apiKey,
+			MaxTokens: d.info.ContextLength,
+		}
+		added++
+		fmt.Printf("✅ Added %s as '%s'\n", d.info.ID, name)
+	}
+
+	if added == 0 {
+		return nil
+	}
+	if err := config.Save(h.agent.ConfigPath, h.agent.Config); err != nil {
+		return fmt.Errorf("failed to save config: %v", err)
+	}
+	fmt.Printf("Saved %d model(s) to %s. Switch with /models <name>.\n", added, h.agent.ConfigPath)
+	return nil
+}
+
+// discoveryEndpoints returns the endpoint to query, or the distinct base URLs of the configured
+// OpenAI-compatible models with the API key configured for each
+func discoveryEndpoints(cfg *types.Config, endpoint string) []types.Model {
+	if endpoint != "" {
+		for _, model := range cfg.Models {
+			if sameBaseURL(model.BaseURL, endpoint) {
+				return []types.Model{{BaseURL: endpoint, APIKey: model.APIKey}}
+			}
+		}
+		return []types.Model{{BaseURL: endpoint}}
+	}
+
+	seen := make(map[string]bool)
+	var endpoints []types.Model
+	for _, model := range cfg.Models {
+		// OpenRouter's catalog is too large to list here; /models openrouter searches it
+		if model.BaseURL == "" || model.Provider == "gemini" || model.Provider == types.ProviderOpenRouter {
+			continue
+		}
+		key := strings.TrimRight(model.BaseURL, "/")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		endpoints = append(endpoints, types.Model{BaseURL: key, APIKey: model.APIKey})
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].BaseURL < endpoints[j].BaseURL })
+	return endpoints
+}
+
+// listEndpointModels queries an endpoint, adding /v1 when the user gave the server's root URL
+func listEndpointModels(ctx context.Context, baseURL, apiKey string) (string, []llm.ModelInfo, error) {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	models, err := llm.ListModels(ctx, baseURL, apiKey)
+	if err != nil && !strings.HasSuffix(baseURL, "/v1") {
+		if v1Models, v1Err := llm.ListModels(ctx, baseURL+"/v1", apiKey); v1Err == nil {
+			return baseURL + "/v1", v1Models, nil
+		}
+	}
+	return baseURL, models, err
+}
+
+func modelConfigured(cfg *types.Config, baseURL, id string) bool {
+	for _, model := range cfg.Models {
+		if model.Name == id && sameBaseURL(model.BaseURL, baseURL) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameBaseURL(a, b string) bool {
+	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+}
+
+// modelKeyFor derives a short config key from a model identifier such as
+// "lmstudio-community/qwen3-coder-30b@8bit", keeping it unique among existing keys
+func modelKeyFor(id string, existing map[string]types.Model) string {
+	key := strings.ToLower(id[strings.LastIndex(id, "/")+1:])
+	if key == "" {
+		key = "model"
+	}
+	candidate := key
+	for i := 2; ; i++ {
+		if _, taken := existing[candidate]; !taken {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", key, i)
+	}
+}
+
+// CheckModelEndpoint warns when the current model's server cannot be reached and, when interactive,
+// offers to switch to a local inference server that is running instead of failing on the first chat
+func (h *Handler) CheckModelEndpoint(interactive bool) {
+	current := h.agent.ModelKey()
+	model, ok := h.agent.Config.Models[current]
+	if !ok || model.BaseURL == "" || model.Provider == "gemini" || llm.Reachable(model.BaseURL, time.Second) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	servers := llm.DetectLocalServers(ctx)
+	cancel()
+
+	fmt.Printf("%s⚠️  %s is not reachable (model '%s')%s\n", types.ColorYellow, model.BaseURL, current, types.ColorReset)
+	if len(servers) == 0 {
+		fmt.Println("   No local inference server found on the default ports of LM Studio, Ollama, llama.cpp or vLLM.")
+		return
+	}
+
+	fmt.Println("   Running local servers:")
+	for i, server := range servers {
+		fmt.Printf("   [%d] %s at %s (%s)\n", i+1, server.Name, server.BaseURL, h.serverModelLabel(server))
+	}
+	if !interactive {
+		fmt.Println("   Switch with /models or /models discover.")
+		return
+	}
+
+	fmt.Printf("   Press a number to switch, any other key to keep '%s'.\n", current)
+	key := ui.ReadConfirmation()
+	index := strings.Index("123456789", key)
+	if len(key) != 1 || index < 0 || index >= len(servers) {
+		return
+	}
+	if err := h.switchToServer(servers[index]); err != nil {
+		fmt.Printf("❌ %v\n", err)
+	}
+}
+
+// serverModel picks the model to use on a detected server: one already configured for it,
+// otherwise the first model it reports. The config key is "" when the model is not configured yet.
+func (h *Handler) serverModel(server llm.LocalServer) (string, llm.ModelInfo) {
+	for _, info := range server.Models {
+		for key, model := range h.agent.Config.Models {
+			if model.Name == info.ID && sameBaseURL(model.BaseURL, server.BaseURL) {
+				return key, info
+			}
+		}
+	}
+	return "", server.Models[0]
+}
+
+func (h *Handler) serverModelLabel(server llm.LocalServer) string {
+	key, info := h.serverModel(server)
+	if key != "" {
+		return fmt.Sprintf("configured as '%s'", key)
+	}
+	if len(server.Models) > 1 {
+		return fmt.Sprintf("%s and %d more", info.ID, len(server.Models)-1)
+	}
+	return info.ID
+}
+
+// switchToServer switches to the server's model, adding it to the config first if needed
+func (h *Handler) switchToServer(server llm.LocalServer) error {
+	key, info := h.serverModel(server)
+	if key == "" {
+		key = modelKeyFor(info.ID, h.agent.Config.Models)
+		h.agent.Config.Models[key] = types.Model{
+			Name:      info.ID,
+			BaseURL:   server.BaseURL,
+			MaxTokens: info.ContextLength,
+		}
+		fmt.Printf("✅ Added %s from %s as '%s'\n", info.ID, server.Name, key)
+	}
+	return h.switchModel(key)
+}
+
+// handleModelsOpenRouter handles /models openrouter [search]: it lists the OpenRouter models
+// matching the search with their context sizes and prices, and switches to the one the user picks,
+// adding it to the config first if needed
+func (h *Handler) handleModelsOpenRouter(query string) error {
+	apiKey := config.OpenRouterAPIKey(h.agent.Config)
+	requestKey := apiKey
+	if requestKey == "" {
+		requestKey = os.Getenv(config.OpenRouterEnvKey)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	catalog, err := config.FetchOpenRouterCatalog(ctx, "", requestKey)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	matches := config.SearchCatalog(catalog, query)
+	if len(matches) == 0 {
+		fmt.Printf("No OpenRouter model matches '%s'.\n", query)
+		return nil
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	if len(matches) > len(discoverKeys) {
+		fmt.Printf("Showing the first %d of %d models; add words to narrow the search.\n", len(discoverKeys), len(matches))
+		matches = matches[:len(discoverKeys)]
+	}
+
+	fmt.Println("\n🌐 OpenRouter Models")
+	fmt.Println("====================")
+	for i, m := range matches {
+		details := []string{fmt.Sprintf("%d tokens", m.ContextLength)}
+		if m.InputPrice == 0 && m.OutputPrice == 0 {
+			details = append(details, "free")
+		} else {
+			details = append(details, fmt.Sprintf("$%.2f in / $%.2f out per 1M", m.InputPrice, m.OutputPrice))
+		}
+		if m.Vision {
+			details = append(details, "vision")
+		}
+		if !m.Tools {
+			details = append(details, "no tool calling")
+		}
+		configured := ""
+		if key := h.openRouterModelKey(m.ID); key != "" {
+			configured = fmt.Sprintf("  %s(configured as '%s')%s", types.ColorGray, key, types.ColorReset)
+		}
+		fmt.Printf("  [%c] %s  %s%s%s%s\n", discoverKeys[i], m.ID, types.ColorGray, strings.Join(details, ", "), types.ColorReset, configured)
+	}
+	fmt.Println("\nPress a key to switch to that model; Enter or Esc to cancel.")
+
+	key := ui.ReadConfirmation()
+	index := strings.Index(discoverKeys, key)
+	if len(key) != 1 || index < 0 || index >= len(matches) {
+		return nil
+	}
+	picked := matches[index]
+	name := h.openRouterModelKey(picked.ID)
+	if name == "" {
+		name = modelKeyFor(picked.ID, h.agent.Config.Models)
+		h.agent.Config.Models[name] = picked.ModelConfig(apiKey)
+		fmt.Printf("✅ Added %s as '%s'\n", picked.ID, name)
+	}
+	if requestKey == "" {
+		fmt.Printf("%s⚠️  No OpenRouter API key: set %s or api_key for '%s' in %s%s\n", types.ColorYellow, config.OpenRouterEnvKey, name, h.agent.ConfigPath, types.ColorReset)
+	}
+	return h.switchModel(name)
+}
+
+// openRouterModelKey returns the config key of the OpenRouter model with the given ID, or ""
+func (h *Handler) openRouterModelKey(id string) string {
+	for key, model := range h.agent.Config.Models {
+		if model.Provider == types.ProviderOpenRouter && model.Name == id {
+			return key
+		}
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"coding-agent/pkg/agent"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+)
+
+// handlePingCommand handles /ping [model]: it checks the model's endpoint, that the model is
+// loaded and that tool calling works, reporting the latency of each step
+func (h *Handler) handlePingCommand(parts []string) error {
+	key := h.agent.ModelKey()
+	if len(parts) > 1 {
+		key = parts[1]
+	}
+	model, ok := h.agent.Config.Models[key]
+	if !ok {
+		fmt.Printf("❌ Model '%s' not found\n", key)
+		return nil
+	}
+
+	fmt.Printf("🏓 Pinging '%s' (%s)...\n", key, model.Name)
+	ctx, stop := ui.StartInterruptMonitor(context.Background(), nil)
+	checks := agent.Ping(ctx, model, true)
+	stop()
+	if ctx.Err() != nil {
+		fmt.Println("⏹️  Ping interrupted")
+		return nil
+	}
+	printPingChecks(checks)
+	return nil
+}
+
+// checkSwitchedModel runs the quick health check (no probe request) after a model switch
+func (h *Handler) checkSwitchedModel(model types.Model) {
+	if model.BaseURL == "" {
+		return
+	}
+	checks := agent.Ping(context.Background(), model, false)
+	for _, check := range checks {
+		if !check.OK && !check.Skipped {
+			printPingChecks(checks)
+			return
+		}
+	}
+}
+
+func printPingChecks(checks []agent.PingCheck) {
+	for _, check := range checks {
+		icon := "✅"
+		switch {
+		case check.Skipped:
+			icon = "➖"
+		case !check.OK:
+			icon = "❌"
+		}
+		fmt.Printf("  %s %-20s %8s  %s\n", icon, check.Name, check.Latency.Round(time.Millisecond), check.Detail)
+	}
+}
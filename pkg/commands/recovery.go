@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/agent"
+	"coding-agent/pkg/recovery"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OfferRecovery looks for a session in the current directory that did not exit cleanly and offers
+// to restore it. Declining discards the snapshot.
+func (h *Handler) OfferRecovery() {
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	snapshot, err := recovery.Load(dir)
+	if err != nil {
+		fmt.Printf("⚠️  %v\n", err)
+		recovery.Clear(dir)
+		return
+	}
+	if snapshot == nil || !snapshot.HasConversation() {
+		return
+	}
+
+	prompts := 0
+	lastPrompt := ""
+	for _, msg := range snapshot.Messages {
+		if msg.Role == openai.ChatMessageRoleUser {
+			prompts++
+			lastPrompt = msg.Content
+		}
+	}
+	fmt.Printf("\n%s⚠️  The last session here did not exit cleanly (saved %s, %d prompts, model %s)%s\n",
+		types.ColorYellow, snapshot.SavedAt.Format("2006-01-02 15:04:05"), prompts, snapshot.Model, types.ColorReset)
+	if lastPrompt != "" {
+		fmt.Printf("   Last prompt: %s\n", truncateString(strings.TrimSpace(lastPrompt), 100))
+	}
+	pending := snapshot.PendingCalls()
+	if len(pending) > 0 {
+		fmt.Println("   Tool calls that had not run yet:")
+		for _, call := range pending {
+			fmt.Printf("   - %s %s\n", call.Function.Name, truncateString(call.Function.Arguments, 120))
+		}
+	}
+	fmt.Print("❓ Restore it? (Y/n): ")
+	answer := ui.ReadConfirmation()
+	fmt.Println()
+	if answer == "n" || answer == "i" {
+		recovery.Clear(dir)
+		fmt.Println("Discarded the unfinished session.")
+		return
+	}
+
+	recovery.Restore(h.agent, snapshot)
+	if snapshot.Model != h.agent.ModelKey() {
+		if err := agent.UseModel(h.agent, snapshot.Model); err != nil {
+			fmt.Printf("⚠️  %v; continuing with '%s'\n", err, h.agent.ModelKey())
+		}
+	}
+	fmt.Printf("✅ Restored %d messages.", len(h.agent.Messages()))
+	if len(pending) > 0 {
+		fmt.Print(" The pending tool calls were not run; ask the agent to continue to retry them.")
+	}
+	fmt.Println()
+}
+
+// OfferLastSession offers to continue the latest saved conversation of the current directory,
+// unless a session was already restored
+func (h *Handler) OfferLastSession() {
+	for _, msg := range h.agent.Messages() {
+		if msg.Role != openai.ChatMessageRoleSystem {
+			return
+		}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	conv := h.conversationMgr.Latest(dir)
+	if conv == nil {
+		return
+	}
+	prompts := 0
+	for _, msg := range conv.Messages {
+		if msg.Role == openai.ChatMessageRoleUser {
+			prompts++
+		}
+	}
+	if prompts == 0 {
+		return
+	}
+
+	fmt.Printf("\n💬 Last session here: %s (%s, %d prompts)\n", conv.Title, sessionAge(conv.UpdatedAt), prompts)
+	fmt.Print("❓ Continue it? (y/N): ")
+	answer := ui.ReadConfirmation()
+	fmt.Println()
+	if answer != "y" {
+		return
+	}
+	if err := h.resumeConversation(conv.ID); err != nil {
+		fmt.Printf("⚠️  %v\n", err)
+	}
+}
+
+// sessionAge describes when a session was last saved, in the words a person would use
+func sessionAge(t time.Time) string {
+	now := time.Now()
+	days := int(startOfDay(now).Sub(startOfDay(t)).Hours() / 24)
+	switch {
+	case days == 0:
+		return "today at " + t.Format("15:04")
+	case days == 1:
+		return "yesterday at " + t.Format("15:04")
+	case days < 7:
+		return fmt.Sprintf("%d days ago", days)
+	}
+	return t.Format("2006-01-02")
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
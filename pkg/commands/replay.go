@@ -0,0 +1,198 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/conversation"
+	"coding-agent/pkg/markdown"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// maxReplayPause caps the recorded gap between two messages, so long waits (the user away,
+	// a slow build) do not stall the replay
+	maxReplayPause = 3 * time.Second
+	// defaultReplayPause is used between messages of sessions saved without timestamps
+	defaultReplayPause = time.Second
+)
+
+// replayOptions are the flags of `mcode replay`
+type replayOptions struct {
+	session string
+	step    bool    // Advance on key press instead of following the recorded timing
+	speed   float64 // Playback speed multiplier for timed replay
+}
+
+// Replay implements `mcode replay <session|file|last> [--step] [--speed N]`: it plays back a saved
+// session message by message, following the recorded timing or stepping on key press
+func Replay(args []string) error {
+	opts, err := parseReplayArgs(args)
+	if err != nil {
+		return fmt.Errorf("%v\nUsage: mcode replay <session id|file|last> [--step] [--speed N]", err)
+	}
+	conv, err := loadReplaySession(opts.session)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("▶️  Replaying %s%s%s (%s)\n", types.ColorCyan, conv.Title, types.ColorReset, conv.ID)
+	fmt.Printf("Model: %s | Recorded: %s | Messages: %d\n", conv.Model, conv.CreatedAt.Format("2006-01-02 15:04"), len(conv.Messages))
+	if opts.step {
+		fmt.Println("Press any key for the next message, q or Esc to stop.")
+	} else {
+		fmt.Printf("Speed %gx; press Esc to stop.\n", opts.speed)
+	}
+
+	renderer, _ := markdown.NewNoMarginTermRenderer()
+	var prev time.Time
+	shown := false
+	for _, msg := range conv.Messages {
+		if msg.Role == openai.ChatMessageRoleSystem {
+			prev = msg.Time
+			continue
+		}
+		if shown {
+			if opts.step {
+				key := ui.ReadConfirmation()
+				if key == "q" || key == "i" {
+					fmt.Println("⏹️  Replay stopped")
+					return nil
+				}
+			} else if !waitForReplay(replayPause(prev, msg.Time, opts.speed)) {
+				fmt.Println("\n⏹️  Replay stopped")
+				return nil
+			}
+		}
+		printReplayMessage(msg, renderer)
+		prev = msg.Time
+		shown = true
+	}
+	fmt.Println("\n⏹️  End of session")
+	return nil
+}
+
+func parseReplayArgs(args []string) (replayOptions, error) {
+	opts := replayOptions{speed: 1}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "--step":
+			opts.step = true
+		case "--speed":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("--speed needs a value")
+			}
+			i++
+			speed, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || speed <= 0 {
+				return opts, fmt.Errorf("--speed needs a positive number, got %q", args[i])
+			}
+			opts.speed = speed
+		default:
+			if strings.HasPrefix(arg, "--") {
+				return opts, fmt.Errorf("unknown option %s", arg)
+			}
+			if opts.session != "" {
+				return opts, fmt.Errorf("unexpected argument %s", arg)
+			}
+			opts.session = arg
+		}
+	}
+	if opts.session == "" {
+		return opts, fmt.Errorf("a session is required")
+	}
+	return opts, nil
+}
+
+// loadReplaySession loads a saved session by ID, from a JSON file, or the most recent one for "last"
+func loadReplaySession(session string) (*conversation.Conversation, error) {
+	if info, err := os.Stat(session); err == nil && !info.IsDir() {
+		dir, file := filepath.Split(session)
+		if dir == "" {
+			dir = "."
+		}
+		return conversation.NewManager(dir).Load(strings.TrimSuffix(file, ".json"))
+	}
+
+	dir, err := conversation.GetDefaultConversationDir()
+	if err != nil {
+		return nil, err
+	}
+	mgr := conversation.NewManager(dir)
+	if session == "last" {
+		convs, err := mgr.List()
+		if err != nil {
+			return nil, err
+		}
+		if len(convs) == 0 {
+			return nil, fmt.Errorf("no saved sessions in %s", dir)
+		}
+		return &convs[len(convs)-1], nil
+	}
+	conv, err := mgr.Load(session)
+	if err != nil {
+		return nil, fmt.Errorf("session %s not found; list saved sessions with /conv", session)
+	}
+	return conv, nil
+}
+
+// replayPause is the pause before a message recorded at cur when the previous one was recorded
+// at prev, scaled by speed
+func replayPause(prev, cur time.Time, speed float64) time.Duration {
+	pause := defaultReplayPause
+	if !prev.IsZero() && !cur.IsZero() {
+		pause = min(max(cur.Sub(prev), 0), maxReplayPause)
+	}
+	return time.Duration(float64(pause) / speed)
+}
+
+// waitForReplay sleeps for d and reports false when the user pressed Esc meanwhile
+func waitForReplay(d time.Duration) bool {
+	ctx, stop := ui.StartInterruptMonitor(context.Background(), nil)
+	defer stop()
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func printReplayMessage(msg conversation.Message, renderer *markdown.Renderer) {
+	switch msg.Role {
+	case openai.ChatMessageRoleUser:
+		fmt.Printf("\n%s> %s%s\n", types.ColorGreen, msg.Content, types.ColorReset)
+
+	case openai.ChatMessageRoleAssistant:
+		if msg.Reasoning != "" {
+			fmt.Printf("%s%s%s\n", types.ColorGray, truncateString(strings.TrimSpace(msg.Reasoning), 500), types.ColorReset)
+		}
+		if content := strings.TrimSpace(msg.Content); content != "" {
+			rendered := content
+			if renderer != nil {
+				if out, err := renderer.Render(content); err == nil {
+					rendered = strings.TrimRight(out, "\n")
+				}
+			}
+			fmt.Println(rendered)
+		}
+		for _, call := range msg.ToolCalls {
+			fmt.Printf("🔧 %s%s%s %s\n", types.ColorCyan, call.Function.Name, types.ColorReset, truncateString(call.Function.Arguments, 200))
+		}
+
+	case openai.ChatMessageRoleTool:
+		lines := strings.Split(strings.TrimRight(msg.Content, "\n"), "\n")
+		if len(lines) > 10 {
+			lines = append(lines[:10], fmt.Sprintf("... (%d more lines)", len(lines)-10))
+		}
+		fmt.Printf("%s> Tool Output:\n%s%s\n", types.ColorGray, strings.Join(lines, "\n"), types.ColorReset)
+	}
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"coding-agent/pkg/conversation"
+	"coding-agent/pkg/types"
+)
+
+const (
+	maxSearchMatchesPerSession = 5
+	maxSearchMatches           = 40
+)
+
+// handleSearchCommand handles /search <query>: it finds the query in the current conversation and
+// in the saved sessions, showing an excerpt of each matching message with its session and turn
+func (h *Handler) handleSearchCommand(parts []string) error {
+	query := strings.TrimSpace(strings.Join(parts[1:], " "))
+	if query == "" {
+		fmt.Println("Usage: /search <query>")
+		return nil
+	}
+
+	total := 0
+	current := conversation.Search(conversation.FromAgentMessages(h.agent.Messages()), query, maxSearchMatchesPerSession)
+	if len(current) > 0 {
+		fmt.Printf("\n🔎 Current conversation\n")
+		printSearchMatches(current)
+		total += len(current)
+	}
+
+	conversations, err := h.conversationMgr.List()
+	if err != nil {
+		return fmt.Errorf("failed to list conversations: %v", err)
+	}
+	sessions := 0
+	// Newest first; /resume numbers follow the oldest-first order of List
+	for i := len(conversations) - 1; i >= 0 && total < maxSearchMatches; i-- {
+		conv := conversations[i]
+		if conv.ID == h.agent.CurrentConvID {
+			continue // Already searched as the current conversation
+		}
+		matches := conversation.Search(conv.Messages, query, min(maxSearchMatchesPerSession, maxSearchMatches-total))
+		if len(matches) == 0 {
+			continue
+		}
+		fmt.Printf("\n🔎 %d. %s %s(%s, %s)%s\n", i+1, conv.Title, types.ColorGray, conv.ID, conv.UpdatedAt.Format("2006-01-02 15:04"), types.ColorReset)
+		printSearchMatches(matches)
+		total += len(matches)
+		sessions++
+	}
+
+	if total == 0 {
+		fmt.Printf("No messages mention %q\n", query)
+		return nil
+	}
+	if total >= maxSearchMatches {
+		fmt.Printf("\nShowing the first %d matches; refine the query to see others.\n", maxSearchMatches)
+	}
+	if sessions > 0 {
+		fmt.Println("\nOpen a session with /resume <number> or review it with `mcode replay <id>`.")
+	}
+	return nil
+}
+
+func printSearchMatches(matches []conversation.Match) {
+	for _, match := range matches {
+		fmt.Printf("  %sturn %d, %s:%s %s\n", types.ColorCyan, match.Turn, match.Role, types.ColorReset, match.Excerpt)
+	}
+}
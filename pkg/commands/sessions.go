@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/conversation"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+	"github.com/sashabaranov/go-openai"
+)
+
+// sessionsShown is how many sessions /sessions lists unless asked for all
+const sessionsShown = 20
+
+// handleSessionsCommand handles /sessions [list [all]|switch <n|id>|rename <n|id> <title>|delete <n|id>|prune <days>].
+// Sessions are numbered as in /resume, and IDs may be shortened to a unique prefix.
+func (h *Handler) handleSessionsCommand(parts []string) error {
+	if len(parts) < 2 {
+		return h.listSessions(false)
+	}
+
+	args := parts[2:]
+	switch parts[1] {
+	case "list", "ls":
+		return h.listSessions(len(args) > 0 && args[0] == "all")
+	case "switch", "open":
+		if len(args) != 1 {
+			break
+		}
+		return h.switchSession(args[0])
+	case "rename", "mv":
+		if len(args) < 2 {
+			break
+		}
+		return h.renameSession(args[0], strings.Join(args[1:], " "))
+	case "delete", "rm", "del":
+		if len(args) != 1 {
+			break
+		}
+		return h.deleteSession(args[0])
+	case "prune":
+		if len(args) != 1 {
+			break
+		}
+		days, err := strconv.Atoi(strings.TrimSuffix(args[0], "d"))
+		if err != nil || days < 1 {
+			fmt.Printf("❌ Invalid number of days: %s\n", args[0])
+			return nil
+		}
+		return h.pruneSessions(days)
+	default:
+		fmt.Printf("❌ Unknown subcommand: %s\n", parts[1])
+	}
+
+	fmt.Println("Usage:")
+	fmt.Println("  /sessions [list [all]]          - List saved sessions, most recent first")
+	fmt.Println("  /sessions switch <n|id>         - Save this session and continue a saved one")
+	fmt.Println("  /sessions rename <n|id> <title> - Change a session's title")
+	fmt.Println("  /sessions delete <n|id>         - Delete a session")
+	fmt.Println("  /sessions prune <days>          - Delete sessions not used for that many days")
+	return nil
+}
+
+// listSessions prints the saved sessions, most recent first, with the numbers /resume uses
+func (h *Handler) listSessions(all bool) error {
+	convs, err := h.conversationMgr.List()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %v", err)
+	}
+	if len(convs) == 0 {
+		fmt.Println("\n📋 No saved sessions found.")
+		return nil
+	}
+
+	home, _ := os.UserHomeDir()
+	fmt.Println("\n📋 Saved Sessions")
+	fmt.Println("=================")
+	shown := 0
+	for i := len(convs) - 1; i >= 0 && (all || shown < sessionsShown); i-- {
+		conv := convs[i]
+		marker := " "
+		if conv.ID == h.agent.CurrentConvID {
+			marker = "*"
+		}
+		title := conv.Title
+		if title == "Untitled Conversation" {
+			title = "(No title)"
+		}
+		fmt.Printf("%s%3d. %s  %s%s%s\n", marker, i+1, conv.UpdatedAt.Format("2006-01-02 15:04"), types.ColorCyan, title, types.ColorReset)
+
+		details := []string{conv.ID, fmt.Sprintf("%d msgs", len(conv.Messages)), fmt.Sprintf("%d tokens", conv.TokensUsed)}
+		if conv.Dir != "" {
+			details = append(details, shortenHome(conv.Dir, home))
+		}
+		fmt.Printf("      %s%s%s\n", types.ColorGray, strings.Join(details, " | "), types.ColorReset)
+		if prompt := conv.FirstPrompt(); prompt != "" && prompt != strings.TrimSuffix(conv.Title, "...") {
+			fmt.Printf("      %s\n", truncateString(strings.Join(strings.Fields(prompt), " "), 70))
+		}
+		shown++
+	}
+
+	fmt.Println()
+	if shown < len(convs) {
+		fmt.Printf("%d older session(s) not shown; use /sessions list all\n", len(convs)-shown)
+	}
+	fmt.Println("Use /sessions switch <n>, rename <n> <title>, delete <n> or prune <days>")
+	return nil
+}
+
+// shortenHome writes a path in the home directory as ~/...
+func shortenHome(path, home string) string {
+	if home == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join("~", rel)
+	}
+	return path
+}
+
+// resolveSession finds a saved session by number or ID
+func (h *Handler) resolveSession(ref string) (*conversation.Conversation, error) {
+	convs, err := h.conversationMgr.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %v", err)
+	}
+	return conversation.Resolve(convs, ref)
+}
+
+// switchSession saves the current session, if anything was asked in it, and resumes another one
+func (h *Handler) switchSession(ref string) error {
+	conv, err := h.resolveSession(ref)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return nil
+	}
+	if conv.ID == h.agent.CurrentConvID {
+		fmt.Println("ℹ️  That is the current session")
+		return nil
+	}
+
+	for _, msg := range h.agent.Messages() {
+		if msg.Role == openai.ChatMessageRoleUser {
+			saved, _, err := h.saveConversation()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("💾 Saved the current session as %s\n", saved.ID)
+			break
+		}
+	}
+	h.agent.FileHashes = nil
+	h.agent.ContextFiles = nil
+	if err := h.resumeConversation(conv.ID); err != nil {
+		return err
+	}
+	if cwd, err := os.Getwd(); err == nil && conv.Dir != "" && filepath.Clean(conv.Dir) != cwd {
+		fmt.Printf("%s⚠️  This session was saved in %s; tools still run in %s%s\n", types.ColorYellow, conv.Dir, cwd, types.ColorReset)
+	}
+	return nil
+}
+
+// renameSession sets a session's title
+func (h *Handler) renameSession(ref, title string) error {
+	conv, err := h.resolveSession(ref)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return nil
+	}
+	if err := h.conversationMgr.Rename(conv.ID, title); err != nil {
+		return fmt.Errorf("failed to rename session: %v", err)
+	}
+	fmt.Printf("✅ Renamed %s to %q\n", conv.ID, title)
+	return nil
+}
+
+// deleteSession deletes a session after asking. Deleting the current session keeps the
+// conversation; the next save writes it as a new session.
+func (h *Handler) deleteSession(ref string) error {
+	conv, err := h.resolveSession(ref)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return nil
+	}
+	fmt.Printf("❓ Delete session %s (%s, %d msgs)? (y/N): ", conv.ID, conv.Title, len(conv.Messages))
+	answer := ui.ReadConfirmation()
+	fmt.Println()
+	if answer != "y" {
+		fmt.Println("❌ Deletion cancelled")
+		return nil
+	}
+	if err := h.conversationMgr.Delete(conv.ID); err != nil {
+		return fmt.Errorf("failed to delete session: %v", err)
+	}
+	if conv.ID == h.agent.CurrentConvID {
+		h.agent.CurrentConvID = ""
+	}
+	fmt.Printf("✅ Session deleted: %s\n", conv.ID)
+	return nil
+}
+
+// pruneSessions deletes, after asking, the sessions not updated in the given number of days. The
+// current session is kept.
+func (h *Handler) pruneSessions(days int) error {
+	cutoff := time.Now().AddDate(0, 0, -days)
+	convs, err := h.conversationMgr.List()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %v", err)
+	}
+	old := 0
+	for _, conv := range convs {
+		if conv.ID != h.agent.CurrentConvID && conv.UpdatedAt.Before(cutoff) {
+			old++
+		}
+	}
+	if old == 0 {
+		fmt.Printf("ℹ️  No sessions older than %d days\n", days)
+		return nil
+	}
+
+	fmt.Printf("❓ Delete %d session(s) not used since %s? (y/N): ", old, cutoff.Format("2006-01-02"))
+	answer := ui.ReadConfirmation()
+	fmt.Println()
+	if answer != "y" {
+		fmt.Println("❌ Deletion cancelled")
+		return nil
+	}
+	deleted, err := h.conversationMgr.Prune(cutoff, h.agent.CurrentConvID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Deleted %d session(s)\n", len(deleted))
+	return nil
+}
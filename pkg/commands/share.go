@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"coding-agent/pkg/project"
+	"coding-agent/pkg/share"
+	"coding-agent/pkg/ui"
+)
+
+// handleShareCommand handles /share [--no-tools] [--last N] [--role user,assistant]: it redacts the
+// transcript, asks for confirmation and uploads it to a secret gist or the configured paste service
+func (h *Handler) handleShareCommand(parts []string) error {
+	conversation := h.agent.Messages()
+	if len(conversation) == 0 {
+		fmt.Println("❌ No conversation to share")
+		return nil
+	}
+	opts, err := project.ParseExportArgs(parts[1:])
+	if err == nil && opts.Filename != "" {
+		err = fmt.Errorf("/share takes no file name; use /export to write a file")
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		fmt.Println("Usage: /share [--no-tools] [--last N] [--role user,assistant]")
+		return nil
+	}
+	messages := project.FilterMessages(conversation, opts)
+	if len(messages) == 0 {
+		fmt.Println("❌ No messages match the filters")
+		return nil
+	}
+
+	var known []string
+	for _, model := range h.agent.Config.Models {
+		known = append(known, model.APIKey)
+	}
+	transcript, redacted := share.Redact(project.FormatTranscript(h.agent, messages), known)
+
+	destination := share.Destination(h.agent.Config.Share)
+	fmt.Printf("📤 Share %d messages (%d KB) to %s\n", len(messages), (len(transcript)+1023)/1024, destination)
+	if redacted > 0 {
+		fmt.Printf("🔒 Redacted %d secret(s); review the transcript before sharing it further\n", redacted)
+	}
+	fmt.Print("❓ Upload the transcript? Anyone with the link can read it. (y/N): ")
+	if ui.ReadConfirmation() != "y" {
+		fmt.Println("\n❌ Share cancelled")
+		return nil
+	}
+	fmt.Println()
+
+	ctx, stop := ui.StartInterruptMonitor(context.Background(), nil)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	filename := fmt.Sprintf("mcode-session-%s.txt", time.Now().Format("20060102-150405"))
+	url, err := share.Upload(ctx, h.agent.Config.Share, filename, "mcode session transcript", transcript)
+	if err != nil {
+		return fmt.Errorf("failed to share transcript: %v", err)
+	}
+	fmt.Printf("✅ Shared: %s\n", url)
+	return nil
+}
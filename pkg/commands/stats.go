@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+
+	"coding-agent/pkg/agent"
+)
+
+// showStats handles /stats: session token usage, the rolling generation speed and the prompt
+// cache hits per model
+func (h *Handler) showStats() {
+	fmt.Println("\n📊 Session Stats")
+	fmt.Println("================")
+	fmt.Printf("Tokens used: %d\n", agent.GetTotalTokensUsed(h.agent))
+	fmt.Printf("Current context: %d tokens\n", agent.GetContextTokens(h.agent))
+
+	if len(h.agent.ModelPerf) == 0 {
+		fmt.Println("\nNo responses measured yet.")
+		h.showCacheStats()
+		fmt.Println()
+		return
+	}
+
+	keys := make([]string, 0, len(h.agent.ModelPerf))
+	for key := range h.agent.ModelPerf {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Println("\nGeneration speed (average of recent responses):")
+	for _, key := range keys {
+		perf := h.agent.ModelPerf[key]
+		fmt.Printf("  %-24s %s  (%d responses)\n", key, agent.FormatGenerationStats(perf.Average()), perf.Requests)
+	}
+	h.showCacheStats()
+	fmt.Println()
+}
+
+// showCacheStats lists the prompt cache hits reported by the providers, per model
+func (h *Handler) showCacheStats() {
+	if len(h.agent.ModelCache) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(h.agent.ModelCache))
+	for key := range h.agent.ModelCache {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Println("\nPrompt cache (as reported by the provider):")
+	for _, key := range keys {
+		stats := h.agent.ModelCache[key]
+		fmt.Printf("  %-24s %s  (%d responses)\n", key, agent.FormatCacheStats(*stats), stats.Responses)
+	}
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"coding-agent/pkg/ui"
+	"coding-agent/pkg/voice"
+)
+
+// handleVoiceCommand handles /voice: it records from the microphone until Enter is pressed,
+// transcribes the recording and puts the text at the next prompt to be edited and sent
+func (h *Handler) handleVoiceCommand(parts []string) error {
+	if len(parts) > 1 {
+		fmt.Println("Usage: /voice (record until Enter, then edit the transcript at the prompt)")
+		return nil
+	}
+
+	recording, err := voice.Start()
+	if err != nil {
+		return err
+	}
+	fmt.Print("🎙️  Recording... press Enter to stop, Esc to cancel")
+	for {
+		key := ui.ReadConfirmation()
+		if key == "i" {
+			recording.Cancel()
+			fmt.Println("\n❌ Recording cancelled")
+			return nil
+		}
+		if key == "\r" || key == "\n" || key == "" {
+			break
+		}
+	}
+	fmt.Println()
+	path, err := recording.Stop()
+	if err != nil {
+		return err
+	}
+	defer recording.Remove()
+
+	settings := h.agent.Config.Voice
+	spinner := ui.NewSpinner("Transcribing with " + voice.Describe(settings))
+	spinner.Start()
+	ctx, stop := ui.StartInterruptMonitor(context.Background(), nil)
+	text, err := voice.Transcribe(ctx, settings, path)
+	stop()
+	spinner.Stop()
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Println("❌ Transcription cancelled")
+			return nil
+		}
+		return fmt.Errorf("transcription failed: %v", err)
+	}
+	if text == "" {
+		fmt.Println("❌ No speech recognized")
+		return nil
+	}
+
+	h.prefill = text
+	return nil
+}
+
+// TakePrefill returns the text to start the next prompt with, such as a /voice transcript, and
+// clears it
+func (h *Handler) TakePrefill() string {
+	text := h.prefill
+	h.prefill = ""
+	return text
+}
@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/agent"
+	"coding-agent/pkg/project"
+	"coding-agent/pkg/tools"
+	"coding-agent/pkg/ui"
+	"coding-agent/pkg/watch"
+)
+
+const (
+	watchPollInterval = time.Second
+	watchSettleDelay  = 300 * time.Millisecond
+	// maxWatchFailureChars bounds how much failing test output is sent to the agent
+	maxWatchFailureChars = 4000
+)
+
+// volatileOutput matches timings and similar noise that change between otherwise identical test runs
+var volatileOutput = regexp.MustCompile(`\(?\d+(\.\d+)?(ns|µs|ms|s)\)?|\b0x[0-9a-f]+\b`)
+
+// handleWatchCommand handles /watch [test command]: it reruns the tests whenever files change
+// and hands new failures to the agent until the user presses Esc
+func (h *Handler) handleWatchCommand(parts []string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %v", err)
+	}
+
+	testCommand := strings.TrimSpace(strings.Join(parts[1:], " "))
+	if testCommand == "" {
+		testCommand = project.ResolveCommands(cwd, h.agent.Config.Commands).Test
+	}
+	if testCommand == "" {
+		fmt.Println("❌ No test command configured or detected.")
+		fmt.Println("Usage: /watch <test command>, or set \"commands\": {\"test\": \"...\"} in ~/.mcode-config.json")
+		return nil
+	}
+
+	watcher, err := watch.New(cwd)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %v", cwd, err)
+	}
+
+	fmt.Printf("👀 Watching %s — running `%s` on changes. Press Esc to stop.\n", cwd, testCommand)
+
+	// Failures present when watching starts are the baseline, not something the agent broke
+	output, passed := h.runShellCommand(context.Background(), testCommand)
+	lastFailure := ""
+	if passed {
+		fmt.Println("✅ Tests passing")
+	} else {
+		lastFailure = failureSignature(output)
+		fmt.Println("❌ Tests currently failing; only new failures will be sent to the agent")
+	}
+
+	for {
+		ctx, stop := ui.StartInterruptMonitor(context.Background(), nil)
+		changed, err := waitForChanges(ctx, watcher)
+		if err != nil {
+			stop()
+			if ctx.Err() != nil {
+				fmt.Println("👋 Stopped watching")
+				return nil
+			}
+			return err
+		}
+
+		ui.PrintfSafe("🔄 %s changed, running tests...\n", describeChanges(changed))
+		output, passed = h.runShellCommand(ctx, testCommand)
+		stop()
+		if ctx.Err() != nil {
+			fmt.Println("👋 Stopped watching")
+			return nil
+		}
+
+		if passed {
+			fmt.Println("✅ Tests passing")
+			lastFailure = ""
+			continue
+		}
+
+		signature := failureSignature(output)
+		if signature == lastFailure {
+			fmt.Println("❌ Tests still failing (same failures)")
+			continue
+		}
+		lastFailure = signature
+
+		fmt.Println("❌ Tests broke, sending the failures to the agent")
+		if err := agent.Chat(h.agent, context.Background(), watchFailurePrompt(testCommand, output)); err != nil {
+			fmt.Printf("❌ Error: %v\n", err)
+		}
+		// The agent's own edits are picked up by the next poll, which reruns the tests
+		fmt.Println("👀 Watching for changes. Press Esc to stop.")
+	}
+}
+
+// waitForChanges polls until files change and then stay quiet briefly, so a burst of saves triggers one run
+func waitForChanges(ctx context.Context, watcher *watch.Watcher) ([]string, error) {
+	var changed []string
+	interval := watchPollInterval
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		paths, err := watcher.Poll()
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) > 0 {
+			changed = append(changed, paths...)
+			interval = watchSettleDelay
+			continue
+		}
+		if len(changed) > 0 {
+			return changed, nil
+		}
+	}
+}
+
+// runShellCommand runs a project command through the shell (inside the exec target, if any)
+// and reports whether it succeeded
+func (h *Handler) runShellCommand(ctx context.Context, command string) (string, bool) {
+	output, err := tools.ShellCommand(ctx, h.agent, command).CombinedOutput()
+	return string(output), err == nil
+}
+
+// failureSignature normalizes test output so reruns of the same failure compare equal
+func failureSignature(output string) string {
+	return volatileOutput.ReplaceAllString(strings.TrimSpace(output), "")
+}
+
+// watchFailurePrompt builds the message sent to the agent, keeping the tail of long output
+// where test runners print their failures and summary
+func watchFailurePrompt(command, output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > maxWatchFailureChars {
+		output = "...\n" + output[len(output)-maxWatchFailureChars:]
+	}
+	return fmt.Sprintf("Tests broke after your last edit: `%s` failed with:\n```\n%s\n```\nFix the failures.", command, output)
+}
+
+func describeChanges(changed []string) string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, path := range changed {
+		if !seen[path] {
+			seen[path] = true
+			unique = append(unique, path)
+		}
+	}
+	if len(unique) == 1 {
+		return unique[0]
+	}
+	return fmt.Sprintf("%d files", len(unique))
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"coding-agent/pkg/agent"
+	"coding-agent/pkg/tools"
+)
+
+// handleWorkspaceCommand handles /workspace [list | add <path> | remove <name>]
+func (h *Handler) handleWorkspaceCommand(parts []string) error {
+	if len(parts) < 2 || parts[1] == "list" {
+		h.listWorkspaceRoots()
+		return nil
+	}
+
+	switch parts[1] {
+	case "add":
+		if len(parts) < 3 {
+			fmt.Println("Usage: /workspace add <path>")
+			return nil
+		}
+		path := strings.Join(parts[2:], " ")
+		name, err := agent.AddWorkspaceRoot(h.agent, path)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return nil
+		}
+		fmt.Printf("✅ Added workspace root @%s (approved for this session)\n", name)
+	case "remove", "rm":
+		if len(parts) < 3 {
+			fmt.Println("Usage: /workspace remove <name|path>")
+			return nil
+		}
+		root, err := agent.RemoveWorkspaceRoot(h.agent, strings.TrimPrefix(strings.Join(parts[2:], " "), "@"))
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return nil
+		}
+		fmt.Printf("✅ Removed workspace root %s\n", root)
+	default:
+		fmt.Println("Usage: /workspace [list | add <path> | remove <name>]")
+	}
+	return nil
+}
+
+// handleAddDirCommand handles /add-dir [--save] <path>, which approves a folder before any tool
+// call asks for it
+func (h *Handler) handleAddDirCommand(parts []string) error {
+	save := len(parts) > 1 && parts[1] == "--save"
+	if save {
+		parts = append(parts[:1], parts[2:]...)
+	}
+	if len(parts) < 2 {
+		fmt.Println("Usage: /add-dir [--save] <path>")
+		return nil
+	}
+	dir, err := agent.ApproveDirectory(h.agent, strings.Join(parts[1:], " "), save)
+	if dir == "" {
+		fmt.Printf("❌ %v\n", err)
+		return nil
+	}
+	if err != nil {
+		fmt.Printf("⚠️  %s: %v\n", dir, err)
+		return nil
+	}
+	scope := "for this session"
+	if save {
+		scope = "and saved to the config"
+	}
+	fmt.Printf("✅ Folder access granted %s: %s (includes all subfolders)\n", scope, dir)
+	return nil
+}
+
+func (h *Handler) listWorkspaceRoots() {
+	cwd, _ := os.Getwd()
+	fmt.Println("\n📂 Workspace Roots")
+	fmt.Println("==================")
+	fmt.Printf("  main  %s (current directory)\n", cwd)
+	for _, root := range h.agent.WorkspaceRoots {
+		fmt.Printf("  @%s  %s\n", tools.WorkspaceRootName(root), root)
+	}
+	if len(h.agent.WorkspaceRoots) == 0 {
+		fmt.Println("\nAdd sibling projects with /workspace add <path>")
+	}
+	fmt.Println()
+}
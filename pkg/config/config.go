@@ -18,6 +18,28 @@ func GetConfigPath() string {
 	return filepath.Join(homeDir, ".mcode-config.json")
 }
 
+// ToolSettingsPath is the per-project tool settings file, relative to the project directory
+var ToolSettingsPath = filepath.Join(".mcode", "tools.json")
+
+// LoadToolSettings reads the project's tool settings. A missing file yields empty settings.
+func LoadToolSettings(path string) (types.ToolSettings, error) {
+	var settings types.ToolSettings
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if settings.BashTimeout < 0 {
+		return settings, fmt.Errorf("%s: bash_timeout_seconds must not be negative", path)
+	}
+	return settings, nil
+}
+
 // LoadOrCreateConfig loads existing config or creates a default one
 func LoadOrCreateConfig(configPath string) (*types.Config, error) {
 	// Try to load existing config
@@ -33,49 +55,49 @@ func LoadOrCreateConfig(configPath string) (*types.Config, error) {
 		CurrentModel: "qwen3-coder",
 		Models: map[string]types.Model{
 			"qwen3-coder": {
-				Name:                "lmstudio-community/qwen3-coder-30b-a3b-instruct-mlx@8bit",
-				BaseURL:             "http://localhost:1234/v1",
-				MaxTokens:           32768,
-				MaxCompletionTokens: 8192,
+				Name:            "lmstudio-community/qwen3-coder-30b-a3b-instruct-mlx@8bit",
+				BaseURL:         "http://localhost:1234/v1",
+				MaxTokens:       32768,
+				MaxOutputTokens: 8192,
 			},
 			"GLM-4.7-flash": {
-				Name:                "zai-org/glm-4.7-flash",
-				BaseURL:             "http://localhost:1234/v1",
-				MaxTokens:           32768,
-				MaxCompletionTokens: 8192,
+				Name:            "zai-org/glm-4.7-flash",
+				BaseURL:         "http://localhost:1234/v1",
+				MaxTokens:       32768,
+				MaxOutputTokens: 8192,
 			},
 			"hermes-3": {
-				Name:                "NousResearch/Hermes-3-Llama-3.1-8B-GGUF",
-				BaseURL:             "http://localhost:1234/v1",
-				MaxTokens:           32768,
-				MaxCompletionTokens: 4096,
+				Name:            "NousResearch/Hermes-3-Llama-3.1-8B-GGUF",
+				BaseURL:         "http://localhost:1234/v1",
+				MaxTokens:       32768,
+				MaxOutputTokens: 4096,
 			},
 			"llama-3.2": {
-				Name:                "bartowski/Llama-3.2-3B-Instruct-GGUF",
-				BaseURL:             "http://localhost:1234/v1",
-				MaxTokens:           131072,
-				MaxCompletionTokens: 4096,
+				Name:            "bartowski/Llama-3.2-3B-Instruct-GGUF",
+				BaseURL:         "http://localhost:1234/v1",
+				MaxTokens:       131072,
+				MaxOutputTokens: 4096,
 			},
 			"claude": {
-				Name:                "claude-3-5-sonnet-20241022",
-				BaseURL:             "https://api.anthropic.com/v1",
-				APIKey:              "",
-				MaxTokens:           200000,
-				MaxCompletionTokens: 8192,
+				Name:            "claude-3-5-sonnet-20241022",
+				BaseURL:         "https://api.anthropic.com/v1",
+				APIKey:          "",
+				MaxTokens:       200000,
+				MaxOutputTokens: 8192,
 			},
 			"openai": {
-				Name:                "gpt-4o",
-				BaseURL:             "https://api.openai.com/v1",
-				APIKey:              "",
-				MaxTokens:           128000,
-				MaxCompletionTokens: 16384,
+				Name:            "gpt-4o",
+				BaseURL:         "https://api.openai.com/v1",
+				APIKey:          "",
+				MaxTokens:       128000,
+				MaxOutputTokens: 16384,
 			},
 			"gemini-thinking": {
-				Name:                "gemini-2.0-flash-thinking-exp-01-21",
-				Provider:            "gemini",
-				APIKey:              "",
-				MaxTokens:           32768,
-				MaxCompletionTokens: 8192,
+				Name:            "gemini-2.0-flash-thinking-exp-01-21",
+				Provider:        "gemini",
+				APIKey:          "",
+				MaxTokens:       32768,
+				MaxOutputTokens: 8192,
 			},
 		},
 		ApprovedFolders:    []string{},
@@ -63,3 +63,34 @@ func TestSave(t *testing.T) {
 		t.Error("Save() did not create config file")
 	}
 }
+
+func TestLoadToolSettings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tools.json")
+
+	settings, err := LoadToolSettings(path)
+	if err != nil || settings.BashTimeout != 0 || settings.DisabledTools != nil {
+		t.Fatalf("missing file: got %+v, %v; want empty settings", settings, err)
+	}
+
+	data := `{"search_excludes": ["testdata"], "bash_timeout_seconds": 120, "disabled_tools": ["web_search"], "descriptions": {"bash_command": "Use make targets."}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings, err = LoadToolSettings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.BashTimeout != 120 || settings.SearchExcludes[0] != "testdata" || settings.DisabledTools[0] != "web_search" || settings.Descriptions["bash_command"] != "Use make targets." {
+		t.Errorf("LoadToolSettings() = %+v", settings)
+	}
+
+	for _, bad := range []string{`{"bash_timeout_seconds": "soon"`, `{"bash_timeout_seconds": -1}`} {
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadToolSettings(path); err == nil {
+			t.Errorf("LoadToolSettings(%s) succeeded, want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"coding-agent/pkg/types"
+)
+
+// OpenRouterBaseURL is the OpenAI-compatible API of OpenRouter, used for models with the
+// openrouter provider and no base URL of their own
+const OpenRouterBaseURL = "https://openrouter.ai/api/v1"
+
+// CatalogModel is a model hosted on OpenRouter as its catalog describes it
+type CatalogModel struct {
+	ID            string  // e.g. "anthropic/claude-sonnet-4"
+	Name          string  // Display name
+	ContextLength int     // Context window in tokens
+	MaxOutput     int     // Most tokens the model generates per response; 0 if not reported
+	InputPrice    float64 // USD per million prompt tokens
+	OutputPrice   float64 // USD per million generated tokens
+	Vision        bool    // Accepts image input
+	Tools         bool    // Supports native tool calling
+}
+
+type openRouterCatalog struct {
+	Data []struct {
+		ID            string `json:"id"`
+		Name          string `json:"name"`
+		ContextLength int    `json:"context_length"`
+		Pricing       struct {
+			Prompt     string `json:"prompt"`     // USD per token, as a decimal string
+			Completion string `json:"completion"` // USD per token
+		} `json:"pricing"`
+		Architecture struct {
+			InputModalities []string `json:"input_modalities"`
+		} `json:"architecture"`
+		TopProvider struct {
+			ContextLength       int `json:"context_length"`
+			MaxCompletionTokens int `json:"max_completion_tokens"`
+		} `json:"top_provider"`
+		SupportedParameters []string `json:"supported_parameters"`
+	} `json:"data"`
+}
+
+// OpenRouterAPIKey returns the API key of a configured OpenRouter model, so models added from the
+// catalog can share it. It is empty when none has a key; requests then use $OPENROUTER_API_KEY.
+func OpenRouterAPIKey(cfg *types.Config) string {
+	keys := make([]string, 0, len(cfg.Models))
+	for _, model := range cfg.Models {
+		if model.Provider == types.ProviderOpenRouter && model.APIKey != "" {
+			keys = append(keys, model.APIKey)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	// Map order is random; pick the same key every time
+	sort.Strings(keys)
+	return keys[0]
+}
+
+// OpenRouterEnvKey is the environment variable holding the OpenRouter API key for models without one
+const OpenRouterEnvKey = "OPENROUTER_API_KEY"
+
+// WithProviderDefaults fills in the base URL and API key an OpenRouter model leaves empty. Other
+// models are returned unchanged.
+func WithProviderDefaults(model types.Model) types.Model {
+	if model.Provider != types.ProviderOpenRouter {
+		return model
+	}
+	if model.BaseURL == "" {
+		model.BaseURL = OpenRouterBaseURL
+	}
+	if model.APIKey == "" {
+		model.APIKey = os.Getenv(OpenRouterEnvKey)
+	}
+	return model
+}
+
+// FetchOpenRouterCatalog lists the models hosted on OpenRouter with their context sizes and prices.
+// baseURL may be empty for OpenRouterBaseURL. The catalog is public; the key is sent when given.
+func FetchOpenRouterCatalog(ctx context.Context, baseURL, apiKey string) ([]CatalogModel, error) {
+	if baseURL == "" {
+		baseURL = OpenRouterBaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(baseURL, "/")+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("OpenRouter catalog request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OpenRouter catalog request failed with status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 20<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenRouter catalog: %v", err)
+	}
+	var catalog openRouterCatalog
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenRouter catalog: %v", err)
+	}
+
+	models := make([]CatalogModel, 0, len(catalog.Data))
+	for _, entry := range catalog.Data {
+		model := CatalogModel{
+			ID:            entry.ID,
+			Name:          entry.Name,
+			ContextLength: entry.ContextLength,
+			MaxOutput:     entry.TopProvider.MaxCompletionTokens,
+			InputPrice:    perMillion(entry.Pricing.Prompt),
+			OutputPrice:   perMillion(entry.Pricing.Completion),
+		}
+		if model.ContextLength == 0 {
+			model.ContextLength = entry.TopProvider.ContextLength
+		}
+		for _, modality := range entry.Architecture.InputModalities {
+			if modality == "image" {
+				model.Vision = true
+			}
+		}
+		for _, param := range entry.SupportedParameters {
+			if param == "tools" {
+				model.Tools = true
+			}
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// perMillion converts OpenRouter's per-token price to USD per million tokens. Unknown and negative
+// ("variable") prices count as 0.
+func perMillion(price string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(price), 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v * 1e6
+}
+
+// SearchCatalog returns the models whose ID or name contains every word of query, ignoring case
+func SearchCatalog(models []CatalogModel, query string) []CatalogModel {
+	words := strings.Fields(strings.ToLower(query))
+	var matches []CatalogModel
+	for _, m := range models {
+		text := strings.ToLower(m.ID + " " + m.Name)
+		matched := true
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// ModelConfig returns the config entry for a catalog model. Models without native tool calling use
+// ReAct. The output limit is only taken from the catalog when it is below the usual default, as
+// many models report their whole context window there.
+func (m CatalogModel) ModelConfig(apiKey string) types.Model {
+	model := types.Model{
+		Name:        m.ID,
+		BaseURL:     OpenRouterBaseURL,
+		APIKey:      apiKey,
+		Provider:    types.ProviderOpenRouter,
+		MaxTokens:   m.ContextLength,
+		InputPrice:  m.InputPrice,
+		OutputPrice: m.OutputPrice,
+		Vision:      m.Vision,
+	}
+	if m.MaxOutput > 0 && m.MaxOutput < 16384 {
+		model.MaxOutputTokens = m.MaxOutput
+	}
+	if !m.Tools {
+		model.ToolMode = types.ToolModeReAct
+	}
+	return model
+}
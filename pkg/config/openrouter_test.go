@@ -0,0 +1,93 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"coding-agent/pkg/types"
+)
+
+func TestFetchOpenRouterCatalog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/models" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-or-test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		_, _ = w.Write([]byte(`{"data":[
+			{"id":"anthropic/claude-sonnet-4","name":"Anthropic: Claude Sonnet 4","context_length":200000,
+			 "pricing":{"prompt":"0.000003","completion":"0.000015"},
+			 "architecture":{"input_modalities":["text","image"]},
+			 "top_provider":{"max_completion_tokens":64000},
+			 "supported_parameters":["tools","temperature"]},
+			{"id":"tiny/free-model","name":"Tiny (free)",
+			 "pricing":{"prompt":"0","completion":"-1"},
+			 "top_provider":{"context_length":8192,"max_completion_tokens":2048}}
+		]}`))
+	}))
+	defer server.Close()
+
+	models, err := FetchOpenRouterCatalog(context.Background(), server.URL+"/api/v1", "sk-or-test")
+	if err != nil {
+		t.Fatalf("FetchOpenRouterCatalog() error = %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("got %d models, want 2", len(models))
+	}
+
+	sonnet := models[0]
+	if sonnet.ContextLength != 200000 || sonnet.InputPrice != 3 || sonnet.OutputPrice != 15 || !sonnet.Vision || !sonnet.Tools {
+		t.Errorf("sonnet = %+v", sonnet)
+	}
+	tiny := models[1]
+	if tiny.ContextLength != 8192 || tiny.InputPrice != 0 || tiny.OutputPrice != 0 || tiny.Vision || tiny.Tools {
+		t.Errorf("tiny = %+v", tiny)
+	}
+
+	if got := SearchCatalog(models, "CLAUDE sonnet"); len(got) != 1 || got[0].ID != sonnet.ID {
+		t.Errorf("SearchCatalog(claude sonnet) = %+v", got)
+	}
+	if got := SearchCatalog(models, ""); len(got) != 2 {
+		t.Errorf("SearchCatalog(\"\") returned %d models, want 2", len(got))
+	}
+
+	model := sonnet.ModelConfig("sk-or-test")
+	if model.Provider != types.ProviderOpenRouter || model.Name != sonnet.ID || model.MaxTokens != 200000 || model.MaxOutputTokens != 0 || model.ToolMode != "" || model.APIKey != "sk-or-test" {
+		t.Errorf("sonnet ModelConfig() = %+v", model)
+	}
+	model = tiny.ModelConfig("")
+	if model.MaxOutputTokens != 2048 || model.ToolMode != types.ToolModeReAct {
+		t.Errorf("tiny ModelConfig() = %+v", model)
+	}
+}
+
+func TestWithProviderDefaults(t *testing.T) {
+	t.Setenv(OpenRouterEnvKey, "sk-or-env")
+
+	model := WithProviderDefaults(types.Model{Name: "openai/gpt-4o", Provider: types.ProviderOpenRouter})
+	if model.BaseURL != OpenRouterBaseURL || model.APIKey != "sk-or-env" {
+		t.Errorf("WithProviderDefaults() = %+v", model)
+	}
+
+	model = WithProviderDefaults(types.Model{Provider: types.ProviderOpenRouter, BaseURL: "http://proxy/v1", APIKey: "sk-own"})
+	if model.BaseURL != "http://proxy/v1" || model.APIKey != "sk-own" {
+		t.Errorf("configured values were replaced: %+v", model)
+	}
+
+	if model := WithProviderDefaults(types.Model{Name: "gpt-4o"}); model.BaseURL != "" || model.APIKey != "" {
+		t.Errorf("non-OpenRouter model changed: %+v", model)
+	}
+
+	cfg := &types.Config{Models: map[string]types.Model{
+		"local": {Name: "qwen", APIKey: "lm-studio"},
+		"b":     {Provider: types.ProviderOpenRouter, APIKey: "sk-or-b"},
+		"a":     {Provider: types.ProviderOpenRouter, APIKey: "sk-or-a"},
+	}}
+	if key := OpenRouterAPIKey(cfg); key != "sk-or-a" {
+		t.Errorf("OpenRouterAPIKey() = %q, want sk-or-a", key)
+	}
+}
@@ -17,6 +17,7 @@ type Message struct {
 	ThoughtSignature []byte     `json:"thought_signature,omitempty"`
 	ToolID           string     `json:"tool_call_id,omitempty"`
 	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
+	Time             time.Time  `json:"time,omitzero"`
 }
 
 // ToolCall represents a saved tool call
@@ -41,6 +42,7 @@ type Conversation struct {
 	Messages   []Message `json:"messages"`
 	TokensUsed int       `json:"tokens_used,omitempty"`
 	Model      string    `json:"model"`
+	Dir        string    `json:"dir,omitempty"` // Project directory the conversation was saved in
 }
 
 // Manager handles conversation save/load operations
@@ -70,7 +72,11 @@ func (m *Manager) Save(conv *Conversation) error {
 		conv.CreatedAt = now
 	}
 
-	// Save to file
+	return m.write(conv)
+}
+
+// write writes a conversation to its file as it is
+func (m *Manager) write(conv *Conversation) error {
 	filename := filepath.Join(m.ConversationDir, fmt.Sprintf("%s.json", conv.ID))
 	data, err := json.MarshalIndent(conv, "", "  ")
 	if err != nil {
@@ -117,7 +123,7 @@ func (m *Manager) List() ([]Conversation, error) {
 			continue
 		}
 
-		if filepath.Ext(file.Name()) != ".json" {
+		if filepath.Ext(file.Name()) != ".json" || file.Name() == registryFile {
 			continue
 		}
 
@@ -2,6 +2,7 @@ package conversation
 
 import (
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -16,13 +17,14 @@ func TestManager(t *testing.T) {
 
 	mgr := NewManager(tmpDir)
 
+	sent := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
 	conv := &Conversation{
 		ID:        "test-conv-1",
 		Title:     "Test Conversation",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		Messages: []Message{
-			{Role: "user", Content: "hello"},
+			{Role: "user", Content: "hello", Time: sent},
 			{Role: "assistant", Content: "hi there"},
 		},
 		Model: "test-model",
@@ -42,7 +44,10 @@ func TestManager(t *testing.T) {
 		t.Errorf("Load() title = %v, want %v", loaded.Title, "Test Conversation")
 	}
 	if len(loaded.Messages) != 2 {
-		t.Errorf("Load() messages len = %v, want 2", len(loaded.Messages))
+		t.Fatalf("Load() messages len = %v, want 2", len(loaded.Messages))
+	}
+	if !loaded.Messages[0].Time.Equal(sent) || !loaded.Messages[1].Time.IsZero() {
+		t.Errorf("Load() message times = %v, %v, want %v and zero", loaded.Messages[0].Time, loaded.Messages[1].Time, sent)
 	}
 
 	// Test List
@@ -64,3 +69,121 @@ func TestManager(t *testing.T) {
 		t.Error("Load() should have failed after Delete()")
 	}
 }
+
+func TestSearch(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "You can run database migrations."},
+		{Role: "user", Content: "How do we add the index?"},
+		{Role: "assistant", ToolCalls: []ToolCall{{Function: FunctionCall{Name: "read_file", Arguments: `{"path":"db/migrations/003.sql"}`}}}},
+		{Role: "tool", Content: "CREATE INDEX users_email ON users(email);"},
+		{Role: "user", Content: "Explain the migration"},
+		{Role: "assistant", Content: "The Migration adds an index.\nIt runs   inside a transaction."},
+	}
+
+	matches := Search(messages, "migration", 10)
+	if len(matches) != 3 {
+		t.Fatalf("Search() = %+v, want 3 matches", matches)
+	}
+	if matches[0].Role != "tool call" || matches[0].Turn != 1 || matches[0].Index != 2 {
+		t.Errorf("first match = %+v, want the tool call in turn 1", matches[0])
+	}
+	if matches[2].Turn != 2 || matches[2].Excerpt != "The Migration adds an index. It runs inside a transaction." {
+		t.Errorf("last match = %+v", matches[2])
+	}
+	if got := Search(messages, "migration", 1); len(got) != 1 {
+		t.Errorf("Search() with limit 1 returned %d matches", len(got))
+	}
+	if got := Search(messages, "  ", 10); got != nil {
+		t.Errorf("Search() with an empty query = %+v", got)
+	}
+
+	long := strings.Repeat("a", 100) + " needle " + strings.Repeat("b", 100)
+	got := Search([]Message{{Role: "tool", Content: long}}, "NEEDLE", 10)
+	if len(got) != 1 || !strings.HasPrefix(got[0].Excerpt, "...") || !strings.HasSuffix(got[0].Excerpt, "...") || !strings.Contains(got[0].Excerpt, "needle") {
+		t.Errorf("long match = %+v", got)
+	}
+}
+
+func TestLatest(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	if mgr.Latest("/work/app") != nil {
+		t.Fatal("expected no session for an unknown directory")
+	}
+
+	for _, id := range []string{"conv-1", "conv-2"} {
+		if err := mgr.Save(&Conversation{ID: id, Title: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mgr.SetLatest("/work/app", "conv-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.SetLatest("/work/app/", "conv-2"); err != nil {
+		t.Fatal(err)
+	}
+	mgr.SetLatest("/work/lib", "conv-1")
+
+	if conv := mgr.Latest("/work/app"); conv == nil || conv.ID != "conv-2" {
+		t.Errorf("Latest(/work/app) = %+v, want conv-2", conv)
+	}
+	if conv := mgr.Latest("/work/lib"); conv == nil || conv.ID != "conv-1" {
+		t.Errorf("Latest(/work/lib) = %+v, want conv-1", conv)
+	}
+
+	convs, err := mgr.List()
+	if err != nil || len(convs) != 2 {
+		t.Errorf("List() = %d conversations, %v; the registry must not be listed", len(convs), err)
+	}
+
+	mgr.Delete("conv-2")
+	if conv := mgr.Latest("/work/app"); conv != nil {
+		t.Errorf("expected no session once it is deleted, got %+v", conv)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	now := time.Now()
+	for i, id := range []string{"conv-100", "conv-200", "conv-201"} {
+		conv := &Conversation{
+			ID:        id,
+			Title:     "Untitled Conversation",
+			CreatedAt: now,
+			Messages:  []Message{{Role: "user", Content: "/models"}, {Role: "user", Content: "  fix the build  "}},
+		}
+		mgr.Save(conv)
+		// Save sets UpdatedAt, so age the sessions afterwards, the first one the most
+		conv.UpdatedAt = now.AddDate(0, 0, -10*(2-i))
+		mgr.write(conv)
+	}
+
+	convs, _ := mgr.List()
+	if got := convs[0].FirstPrompt(); got != "fix the build" {
+		t.Errorf("FirstPrompt() = %q", got)
+	}
+	for ref, want := range map[string]string{"1": "conv-100", "conv-200": "conv-200", "conv-1": "conv-100"} {
+		if conv, err := Resolve(convs, ref); err != nil || conv.ID != want {
+			t.Errorf("Resolve(%q) = %v, %v, want %s", ref, conv, err, want)
+		}
+	}
+	for _, ref := range []string{"0", "4", "conv-20", "other"} {
+		if _, err := Resolve(convs, ref); err == nil {
+			t.Errorf("Resolve(%q) should fail", ref)
+		}
+	}
+
+	if err := mgr.Rename("conv-100", "Build fixes"); err != nil {
+		t.Fatal(err)
+	}
+	if conv, _ := mgr.Load("conv-100"); conv.Title != "Build fixes" || !conv.UpdatedAt.Equal(convs[0].UpdatedAt) {
+		t.Errorf("Rename() should only change the title, got %q updated %v", conv.Title, conv.UpdatedAt)
+	}
+
+	deleted, err := mgr.Prune(now.AddDate(0, 0, -5), "conv-100")
+	if err != nil || len(deleted) != 1 || deleted[0].ID != "conv-200" {
+		t.Errorf("Prune() = %v, %v, want only conv-200 deleted", deleted, err)
+	}
+	if convs, _ := mgr.List(); len(convs) != 2 {
+		t.Errorf("expected 2 sessions left, got %d", len(convs))
+	}
+}
@@ -0,0 +1,73 @@
+package conversation
+
+import (
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// FromAgentMessages converts an agent conversation to the saved format
+func FromAgentMessages(agentMsgs []types.Message) []Message {
+	convMsgs := make([]Message, 0, len(agentMsgs))
+	for _, msg := range agentMsgs {
+		cm := Message{
+			Role:             msg.Role,
+			Content:          msg.Content,
+			Reasoning:        msg.Reasoning,
+			ThoughtSignature: msg.ThoughtSignature,
+			Time:             msg.Time,
+		}
+		if msg.Role == openai.ChatMessageRoleTool {
+			cm.ToolID = msg.ToolCallID
+		}
+
+		if len(msg.ToolCalls) > 0 {
+			cm.ToolCalls = make([]ToolCall, len(msg.ToolCalls))
+			for i, tc := range msg.ToolCalls {
+				cm.ToolCalls[i] = ToolCall{
+					ID:   tc.ID,
+					Type: string(tc.Type),
+					Function: FunctionCall{
+						Name:      tc.Function.Name,
+						Arguments: tc.Function.Arguments,
+					},
+				}
+			}
+		}
+		convMsgs = append(convMsgs, cm)
+	}
+	return convMsgs
+}
+
+// ToAgentMessages converts saved messages to the agent conversation format
+func ToAgentMessages(messages []Message) []types.Message {
+	agentMsgs := make([]types.Message, 0, len(messages))
+	for _, msg := range messages {
+		am := types.Message{
+			Role:             msg.Role,
+			Content:          msg.Content,
+			Reasoning:        msg.Reasoning,
+			ThoughtSignature: msg.ThoughtSignature,
+			Time:             msg.Time,
+		}
+		if msg.Role == openai.ChatMessageRoleTool {
+			am.ToolCallID = msg.ToolID
+		}
+
+		if len(msg.ToolCalls) > 0 {
+			am.ToolCalls = make([]openai.ToolCall, len(msg.ToolCalls))
+			for i, tc := range msg.ToolCalls {
+				am.ToolCalls[i] = openai.ToolCall{
+					ID:   tc.ID,
+					Type: openai.ToolType(tc.Type),
+					Function: openai.FunctionCall{
+						Name:      tc.Function.Name,
+						Arguments: tc.Function.Arguments,
+					},
+				}
+			}
+		}
+		agentMsgs = append(agentMsgs, am)
+	}
+	return agentMsgs
+}
@@ -0,0 +1,47 @@
+package conversation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// registryFile maps project directories to their latest conversation. It lives with the
+// conversations and is skipped when listing them.
+const registryFile = "directories.json"
+
+func (m *Manager) readRegistry() map[string]string {
+	registry := make(map[string]string)
+	if data, err := os.ReadFile(filepath.Join(m.ConversationDir, registryFile)); err == nil {
+		json.Unmarshal(data, &registry)
+	}
+	return registry
+}
+
+// SetLatest records id as the latest conversation of the project in dir
+func (m *Manager) SetLatest(dir, id string) error {
+	registry := m.readRegistry()
+	registry[filepath.Clean(dir)] = id
+	data, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.ConversationDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(m.ConversationDir, registryFile), data, 0644)
+}
+
+// Latest returns the latest conversation of the project in dir, or nil when there is none or it
+// was deleted
+func (m *Manager) Latest(dir string) *Conversation {
+	id, ok := m.readRegistry()[filepath.Clean(dir)]
+	if !ok {
+		return nil
+	}
+	conv, err := m.Load(id)
+	if err != nil {
+		return nil
+	}
+	return conv
+}
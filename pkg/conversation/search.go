@@ -0,0 +1,80 @@
+package conversation
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// excerptRadius is the number of bytes of context shown on each side of a search match
+const excerptRadius = 60
+
+// Match is a message that contains a search query
+type Match struct {
+	Index   int    // Index of the message in the conversation
+	Turn    int    // Number of user prompts up to and including this message; 0 before the first
+	Role    string // Role of the message, or "tool call" for matches in tool call arguments
+	Excerpt string // Single-line text around the first occurrence
+}
+
+// Search finds the messages whose content, reasoning or tool call arguments contain query,
+// case-insensitively. System messages are skipped. At most limit matches are returned.
+func Search(messages []Message, query string, limit int) []Match {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+
+	var matches []Match
+	turn := 0
+	for i, msg := range messages {
+		if msg.Role == "user" {
+			turn++
+		}
+		if msg.Role == "system" {
+			continue
+		}
+
+		role := msg.Role
+		texts := []string{msg.Content, msg.Reasoning}
+		for _, call := range msg.ToolCalls {
+			texts = append(texts, call.Function.Name+" "+call.Function.Arguments)
+		}
+		for j, text := range texts {
+			pos := strings.Index(strings.ToLower(text), query)
+			if pos < 0 {
+				continue
+			}
+			if j >= 2 {
+				role = "tool call"
+			}
+			matches = append(matches, Match{Index: i, Turn: turn, Role: role, Excerpt: excerpt(text, pos, len(query))})
+			break
+		}
+		if len(matches) >= limit {
+			break
+		}
+	}
+	return matches
+}
+
+// excerpt returns the text around text[pos:pos+n] on a single line
+func excerpt(text string, pos, n int) string {
+	start := max(pos-excerptRadius, 0)
+	end := min(pos+n+excerptRadius, len(text))
+	// Do not cut multi-byte characters in half
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	result := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		result = "..." + result
+	}
+	if end < len(text) {
+		result += "..."
+	}
+	return result
+}
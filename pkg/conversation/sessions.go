@@ -0,0 +1,78 @@
+package conversation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FirstPrompt returns the first message the user typed, or "" when there is none. Slash commands
+// are skipped, like they are for titles.
+func (c *Conversation) FirstPrompt() string {
+	for _, msg := range c.Messages {
+		if msg.Role == "user" && !strings.HasPrefix(msg.Content, "/") {
+			return strings.TrimSpace(msg.Content)
+		}
+	}
+	return ""
+}
+
+// Rename sets the title of a saved conversation, leaving its timestamps and place in the list
+// as they are
+func (m *Manager) Rename(id, title string) error {
+	conv, err := m.Load(id)
+	if err != nil {
+		return err
+	}
+	conv.Title = title
+	return m.write(conv)
+}
+
+// Resolve finds a conversation of a List result by its number in the list (starting at 1), its
+// ID or a prefix of the ID that only one conversation has
+func Resolve(convs []Conversation, ref string) (*Conversation, error) {
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > len(convs) {
+			return nil, fmt.Errorf("no session %d (there are %d)", n, len(convs))
+		}
+		return &convs[n-1], nil
+	}
+
+	var found *Conversation
+	for i := range convs {
+		if convs[i].ID == ref {
+			return &convs[i], nil
+		}
+		if strings.HasPrefix(convs[i].ID, ref) {
+			if found != nil {
+				return nil, fmt.Errorf("%q matches more than one session", ref)
+			}
+			found = &convs[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no session %q", ref)
+	}
+	return found, nil
+}
+
+// Prune deletes the conversations last updated before cutoff, except the one with the ID keep,
+// and returns the deleted ones
+func (m *Manager) Prune(cutoff time.Time, keep string) ([]Conversation, error) {
+	convs, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	var deleted []Conversation
+	for _, conv := range convs {
+		if conv.ID == keep || !conv.UpdatedAt.Before(cutoff) {
+			continue
+		}
+		if err := m.Delete(conv.ID); err != nil {
+			return deleted, fmt.Errorf("failed to delete %s: %w", conv.ID, err)
+		}
+		deleted = append(deleted, conv)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,292 @@
+// Package coverage parses coverage profiles (Go cover profiles and LCOV) into per-file summaries.
+package coverage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LineRange is an inclusive range of source lines
+type LineRange struct {
+	Start int
+	End   int
+}
+
+func (r LineRange) String() string {
+	if r.Start == r.End {
+		return strconv.Itoa(r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// FileCoverage summarizes one source file. Units are statements for Go profiles and lines for LCOV.
+type FileCoverage struct {
+	Path      string
+	Covered   int
+	Total     int
+	Uncovered []LineRange
+}
+
+// Percent returns the covered share of the file, 100 when there is nothing to cover
+func (f FileCoverage) Percent() float64 {
+	return percent(f.Covered, f.Total)
+}
+
+// PackageCoverage aggregates the files in one directory
+type PackageCoverage struct {
+	Path    string
+	Covered int
+	Total   int
+}
+
+// Percent returns the covered share of the package
+func (p PackageCoverage) Percent() float64 {
+	return percent(p.Covered, p.Total)
+}
+
+// Report is a parsed coverage profile, with files sorted by path
+type Report struct {
+	Files []FileCoverage
+}
+
+// Totals returns the covered and total units across all files
+func (r *Report) Totals() (covered, total int) {
+	for _, f := range r.Files {
+		covered += f.Covered
+		total += f.Total
+	}
+	return covered, total
+}
+
+// Percent returns the covered share of the whole report
+func (r *Report) Percent() float64 {
+	return percent(r.Totals())
+}
+
+// Packages aggregates files by directory, sorted by path
+func (r *Report) Packages() []PackageCoverage {
+	byDir := make(map[string]*PackageCoverage)
+	var dirs []string
+	for _, f := range r.Files {
+		dir := path.Dir(f.Path)
+		pkg, ok := byDir[dir]
+		if !ok {
+			pkg = &PackageCoverage{Path: dir}
+			byDir[dir] = pkg
+			dirs = append(dirs, dir)
+		}
+		pkg.Covered += f.Covered
+		pkg.Total += f.Total
+	}
+	sort.Strings(dirs)
+
+	packages := make([]PackageCoverage, 0, len(dirs))
+	for _, dir := range dirs {
+		packages = append(packages, *byDir[dir])
+	}
+	return packages
+}
+
+// Filter returns a report containing only files whose path contains substr
+func (r *Report) Filter(substr string) *Report {
+	if substr == "" {
+		return r
+	}
+	filtered := &Report{}
+	for _, f := range r.Files {
+		if strings.Contains(f.Path, substr) {
+			filtered.Files = append(filtered.Files, f)
+		}
+	}
+	return filtered
+}
+
+// Parse detects the profile format and parses it
+func Parse(data []byte) (*Report, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("mode:")):
+		return ParseGoProfile(data)
+	case bytes.Contains(trimmed, []byte("SF:")):
+		return ParseLCOV(data)
+	}
+	return nil, fmt.Errorf("unrecognized coverage format (expected a Go cover profile or LCOV)")
+}
+
+type goBlock struct {
+	file               string
+	startLine, endLine int
+	startCol, endCol   int
+	statements         int
+}
+
+// ParseGoProfile parses the output of go test -coverprofile. Blocks repeated across
+// packages (e.g. with -coverpkg) count as covered if any run covered them.
+func ParseGoProfile(data []byte) (*Report, error) {
+	counts := make(map[goBlock]int)
+	var order []goBlock
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		block, count, err := parseGoBlock(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		previous, seen := counts[block]
+		if !seen {
+			order = append(order, block)
+		}
+		if !seen || count > previous {
+			counts[block] = count
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*FileCoverage)
+	uncovered := make(map[string][]LineRange)
+	for _, block := range order {
+		f, ok := files[block.file]
+		if !ok {
+			f = &FileCoverage{Path: block.file}
+			files[block.file] = f
+		}
+		f.Total += block.statements
+		if counts[block] > 0 {
+			f.Covered += block.statements
+		} else if block.statements > 0 {
+			uncovered[block.file] = append(uncovered[block.file], LineRange{Start: block.startLine, End: block.endLine})
+		}
+	}
+
+	report := &Report{}
+	for name, f := range files {
+		f.Uncovered = mergeRanges(uncovered[name])
+		report.Files = append(report.Files, *f)
+	}
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].Path < report.Files[j].Path })
+	return report, nil
+}
+
+// parseGoBlock parses "file:startLine.startCol,endLine.endCol statements count"
+func parseGoBlock(line string) (goBlock, int, error) {
+	colon := strings.LastIndex(line, ":")
+	if colon < 0 {
+		return goBlock{}, 0, fmt.Errorf("malformed block %q", line)
+	}
+	fields := strings.Fields(line[colon+1:])
+	if len(fields) != 3 {
+		return goBlock{}, 0, fmt.Errorf("malformed block %q", line)
+	}
+
+	block := goBlock{file: line[:colon]}
+	if _, err := fmt.Sscanf(fields[0], "%d.%d,%d.%d", &block.startLine, &block.startCol, &block.endLine, &block.endCol); err != nil {
+		return goBlock{}, 0, fmt.Errorf("malformed position %q", fields[0])
+	}
+	statements, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return goBlock{}, 0, fmt.Errorf("malformed statement count %q", fields[1])
+	}
+	count, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return goBlock{}, 0, fmt.Errorf("malformed hit count %q", fields[2])
+	}
+	block.statements = statements
+	return block, count, nil
+}
+
+// ParseLCOV parses an LCOV tracefile, as written by jest, pytest-cov, cargo llvm-cov and others
+func ParseLCOV(data []byte) (*Report, error) {
+	files := make(map[string]map[int]int)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	current := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			current = strings.TrimPrefix(line, "SF:")
+			if files[current] == nil {
+				files[current] = make(map[int]int)
+			}
+		case strings.HasPrefix(line, "DA:") && current != "":
+			fields := strings.Split(strings.TrimPrefix(line, "DA:"), ",")
+			if len(fields) < 2 {
+				continue
+			}
+			lineNum, err1 := strconv.Atoi(fields[0])
+			hits, err2 := strconv.Atoi(fields[1])
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			if previous, ok := files[current][lineNum]; !ok || hits > previous {
+				files[current][lineNum] = hits
+			}
+		case line == "end_of_record":
+			current = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	for name, lines := range files {
+		f := FileCoverage{Path: name, Total: len(lines)}
+		var missed []LineRange
+		for lineNum, hits := range lines {
+			if hits > 0 {
+				f.Covered++
+			} else {
+				missed = append(missed, LineRange{Start: lineNum, End: lineNum})
+			}
+		}
+		f.Uncovered = mergeRanges(missed)
+		report.Files = append(report.Files, f)
+	}
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].Path < report.Files[j].Path })
+	return report, nil
+}
+
+// mergeRanges sorts ranges and joins overlapping or adjacent ones
+func mergeRanges(ranges []LineRange) []LineRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+
+	merged := []LineRange{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End+1 {
+			if r.End > last.End {
+				last.End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(covered) * 100 / float64(total)
+}
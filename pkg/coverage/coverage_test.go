@@ -0,0 +1,85 @@
+package coverage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGoProfile(t *testing.T) {
+	profile := `mode: set
+example.com/app/pkg/a/a.go:3.10,5.2 2 1
+example.com/app/pkg/a/a.go:7.10,9.2 1 0
+example.com/app/pkg/a/a.go:10.1,12.2 1 0
+example.com/app/pkg/a/a.go:20.1,21.2 1 0
+example.com/app/pkg/b/b.go:3.10,5.2 4 1
+example.com/app/pkg/a/a.go:20.1,21.2 1 1
+`
+	report, err := Parse([]byte(profile))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(report.Files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(report.Files))
+	}
+
+	a := report.Files[0]
+	if a.Path != "example.com/app/pkg/a/a.go" || a.Covered != 3 || a.Total != 5 {
+		t.Errorf("a.go = %+v, want 3/5 statements", a)
+	}
+	// The repeated block counts as covered; adjacent uncovered blocks merge
+	if want := []LineRange{{Start: 7, End: 12}}; !reflect.DeepEqual(a.Uncovered, want) {
+		t.Errorf("a.go uncovered = %v, want %v", a.Uncovered, want)
+	}
+
+	packages := report.Packages()
+	if len(packages) != 2 || packages[0].Path != "example.com/app/pkg/a" || packages[1].Percent() != 100 {
+		t.Errorf("unexpected packages: %+v", packages)
+	}
+	if covered, total := report.Totals(); covered != 7 || total != 9 {
+		t.Errorf("Totals() = %d/%d, want 7/9", covered, total)
+	}
+}
+
+func TestParseLCOV(t *testing.T) {
+	lcov := `TN:
+SF:/src/app/lib/util.js
+DA:1,1
+DA:2,0
+DA:3,0
+DA:5,0
+DA:6,4
+end_of_record
+SF:/src/app/lib/index.js
+DA:1,1
+end_of_record
+`
+	report, err := Parse([]byte(lcov))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(report.Files) != 2 || report.Files[1].Path != "/src/app/lib/util.js" {
+		t.Fatalf("unexpected files: %+v", report.Files)
+	}
+
+	util := report.Files[1]
+	if util.Covered != 2 || util.Total != 5 {
+		t.Errorf("util.js = %d/%d, want 2/5", util.Covered, util.Total)
+	}
+	want := []LineRange{{Start: 2, End: 3}, {Start: 5, End: 5}}
+	if !reflect.DeepEqual(util.Uncovered, want) {
+		t.Errorf("util.js uncovered = %v, want %v", util.Uncovered, want)
+	}
+
+	if filtered := report.Filter("index"); len(filtered.Files) != 1 {
+		t.Errorf("Filter() kept %d files, want 1", len(filtered.Files))
+	}
+}
+
+func TestParseRejectsUnknownFormats(t *testing.T) {
+	if _, err := Parse([]byte("ok  \texample.com/app\t0.1s\n")); err == nil {
+		t.Error("expected an error for non-profile input")
+	}
+	if _, err := Parse([]byte("mode: set\nbroken line\n")); err == nil {
+		t.Error("expected an error for a malformed Go profile")
+	}
+}
@@ -0,0 +1,498 @@
+// Package deps reads the dependency manifests of a project (go.mod, package.json, pyproject.toml and
+// Cargo.toml, with their lock files) and finds the source files that import each dependency.
+package deps
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxSourceFiles bounds the import scan in very large trees
+const maxSourceFiles = 20000
+
+// skipDirs are never searched for manifests or sources
+var skipDirs = map[string]bool{
+	".git": true, "node_modules": true, "vendor": true, "target": true, "dist": true, "build": true,
+	".venv": true, "venv": true, "__pycache__": true, ".tox": true, ".mypy_cache": true,
+}
+
+// Dependency is one package a manifest depends on, directly or through another dependency
+type Dependency struct {
+	Name     string
+	Version  string // As declared: an exact version for Go, a range for the others
+	Locked   string // The version the lock file resolved, when it differs from Version
+	Kind     string // "" for normal dependencies, otherwise "dev", "build", "peer", "optional" or a group name
+	Indirect bool
+	Note     string   // Replacements and path or git sources
+	Files    []string // Source files importing it, relative to the scanned root
+}
+
+// Manifest is a parsed manifest file and its dependencies
+type Manifest struct {
+	Path      string // Relative to the scanned root
+	Ecosystem string // "go", "npm", "python" or "rust"
+	Name      string
+	Deps      []*Dependency
+}
+
+// manifestFiles maps manifest file names to their ecosystem
+var manifestFiles = map[string]string{
+	"go.mod": "go", "package.json": "npm", "pyproject.toml": "python", "Cargo.toml": "rust",
+}
+
+// sourceExts maps source file extensions to the ecosystem whose dependencies they import
+var sourceExts = map[string]string{
+	".go": "go", ".js": "npm", ".jsx": "npm", ".ts": "npm", ".tsx": "npm", ".mjs": "npm", ".cjs": "npm",
+	".vue": "npm", ".svelte": "npm", ".py": "python", ".rs": "rust",
+}
+
+// Scan finds the manifests under root, parses them and records which source files import each
+// dependency. Every source file is matched against the nearest manifest of its ecosystem above it.
+func Scan(root string) ([]*Manifest, error) {
+	var manifests []*Manifest
+	var sources []string
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (skipDirs[d.Name()] || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if eco, ok := manifestFiles[d.Name()]; ok {
+			if m := parseManifest(root, path, eco); m != nil {
+				manifests = append(manifests, m)
+			}
+		} else if _, ok := sourceExts[filepath.Ext(path)]; ok && len(sources) < maxSourceFiles {
+			sources = append(sources, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range sources {
+		m := nearestManifest(root, manifests, path)
+		if m == nil || len(m.Deps) == 0 {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || len(data) > 1<<20 {
+			continue
+		}
+		rel := relPath(root, path)
+		seen := map[*Dependency]bool{}
+		for _, imp := range importsOf(m.Ecosystem, path, data) {
+			if dep := m.match(imp); dep != nil && !seen[dep] {
+				seen[dep] = true
+				dep.Files = append(dep.Files, rel)
+			}
+		}
+	}
+
+	for _, m := range manifests {
+		sort.SliceStable(m.Deps, func(i, j int) bool {
+			a, b := m.Deps[i], m.Deps[j]
+			if a.Indirect != b.Indirect {
+				return !a.Indirect
+			}
+			if a.Kind != b.Kind {
+				return a.Kind < b.Kind
+			}
+			return a.Name < b.Name
+		})
+		for _, d := range m.Deps {
+			sort.Strings(d.Files)
+		}
+	}
+	return manifests, nil
+}
+
+func relPath(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
+
+// nearestManifest returns the deepest manifest of the file's ecosystem in a directory above it
+func nearestManifest(root string, manifests []*Manifest, path string) *Manifest {
+	eco := sourceExts[filepath.Ext(path)]
+	rel := relPath(root, path)
+	var best *Manifest
+	bestDepth := -1
+	for _, m := range manifests {
+		if m.Ecosystem != eco {
+			continue
+		}
+		dir := filepath.ToSlash(filepath.Dir(m.Path))
+		if dir != "." && !strings.HasPrefix(rel, dir+"/") {
+			continue
+		}
+		depth := 0
+		if dir != "." {
+			depth = strings.Count(dir, "/") + 1
+		}
+		if depth > bestDepth {
+			best, bestDepth = m, depth
+		}
+	}
+	return best
+}
+
+func parseManifest(root, path, eco string) *Manifest {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	m := &Manifest{Path: relPath(root, path), Ecosystem: eco}
+	dir := filepath.Dir(path)
+	switch eco {
+	case "go":
+		parseGoMod(m, string(data))
+	case "npm":
+		if parsePackageJSON(m, data) != nil {
+			return nil
+		}
+		if lock, err := os.ReadFile(filepath.Join(dir, "package-lock.json")); err == nil {
+			applyPackageLock(m, lock)
+		}
+	case "python":
+		parsePyproject(m, string(data))
+		for _, name := range []string{"uv.lock", "poetry.lock"} {
+			if lock, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+				applyTOMLLock(m, string(lock), normalizePython)
+				break
+			}
+		}
+	case "rust":
+		parseCargo(m, string(data))
+		if lock, err := os.ReadFile(filepath.Join(dir, "Cargo.lock")); err == nil {
+			applyTOMLLock(m, string(lock), func(s string) string { return s })
+		}
+	}
+	return m
+}
+
+// add records a dependency, keeping the first declaration of a name
+func (m *Manifest) add(dep *Dependency) {
+	for _, d := range m.Deps {
+		if d.Name == dep.Name {
+			return
+		}
+	}
+	m.Deps = append(m.Deps, dep)
+}
+
+// match returns the dependency an import refers to
+func (m *Manifest) match(imp string) *Dependency {
+	var best *Dependency
+	for _, d := range m.Deps {
+		switch m.Ecosystem {
+		case "go":
+			// The longest module path that the package is in
+			if (imp == d.Name || strings.HasPrefix(imp, d.Name+"/")) && (best == nil || len(d.Name) > len(best.Name)) {
+				best = d
+			}
+		case "npm":
+			if imp == d.Name {
+				return d
+			}
+		case "python":
+			if strings.EqualFold(imp, pythonModule(d.Name)) {
+				return d
+			}
+		case "rust":
+			if imp == strings.ReplaceAll(d.Name, "-", "_") {
+				return d
+			}
+		}
+	}
+	return best
+}
+
+var (
+	goRequire = regexp.MustCompile(`^(\S+)\s+(\S+)`)
+	goReplace = regexp.MustCompile(`^(\S+)(?:\s+\S+)?\s+=>\s+(.+)$`)
+)
+
+func parseGoMod(m *Manifest, data string) {
+	block := ""
+	replaces := map[string]string{}
+	for _, line := range strings.Split(data, "\n") {
+		line, comment, _ := strings.Cut(line, "//")
+		line = strings.TrimSpace(line)
+		directive := block
+		if block == "" {
+			name, rest, _ := strings.Cut(line, " ")
+			rest = strings.TrimSpace(rest)
+			switch name {
+			case "module":
+				m.Name = strings.Trim(rest, `"`)
+				continue
+			case "require", "replace":
+				if rest == "(" {
+					block = name
+					continue
+				}
+				directive, line = name, rest
+			default:
+				continue
+			}
+		} else if line == ")" {
+			block = ""
+			continue
+		}
+
+		switch directive {
+		case "require":
+			if match := goRequire.FindStringSubmatch(line); match != nil {
+				m.add(&Dependency{Name: match[1], Version: match[2], Indirect: strings.TrimSpace(comment) == "indirect"})
+			}
+		case "replace":
+			if match := goReplace.FindStringSubmatch(line); match != nil {
+				replaces[match[1]] = strings.TrimSpace(match[2])
+			}
+		}
+	}
+	for _, d := range m.Deps {
+		if to, ok := replaces[d.Name]; ok {
+			d.Note = "replaced by " + to
+		}
+	}
+}
+
+func parsePackageJSON(m *Manifest, data []byte) error {
+	var pkg struct {
+		Name                 string            `json:"name"`
+		Dependencies         map[string]string `json:"dependencies"`
+		DevDependencies      map[string]string `json:"devDependencies"`
+		PeerDependencies     map[string]string `json:"peerDependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return err
+	}
+	m.Name = pkg.Name
+	for _, group := range []struct {
+		kind string
+		deps map[string]string
+	}{{"", pkg.Dependencies}, {"dev", pkg.DevDependencies}, {"peer", pkg.PeerDependencies}, {"optional", pkg.OptionalDependencies}} {
+		for name, version := range group.deps {
+			m.add(&Dependency{Name: name, Version: version, Kind: group.kind})
+		}
+	}
+	return nil
+}
+
+// applyPackageLock adds the installed versions from package-lock.json, and the packages only
+// installed as dependencies of dependencies
+func applyPackageLock(m *Manifest, data []byte) {
+	var lock struct {
+		Packages map[string]struct {
+			Version string `json:"version"`
+		} `json:"packages"`
+		Dependencies map[string]struct {
+			Version string `json:"version"`
+		} `json:"dependencies"`
+	}
+	if json.Unmarshal(data, &lock) != nil {
+		return
+	}
+	locked := map[string]string{}
+	for key, p := range lock.Packages {
+		i := strings.LastIndex(key, "node_modules/")
+		if i < 0 {
+			continue
+		}
+		name := key[i+len("node_modules/"):]
+		// The hoisted copy at the top level is the one the project resolves
+		if _, ok := locked[name]; !ok || !strings.Contains(key[:i], "node_modules/") {
+			locked[name] = p.Version
+		}
+	}
+	if len(lock.Packages) == 0 {
+		for name, p := range lock.Dependencies {
+			locked[name] = p.Version
+		}
+	}
+	applyLocked(m, locked)
+}
+
+// applyLocked sets the resolved versions of direct dependencies and adds the rest as indirect
+func applyLocked(m *Manifest, locked map[string]string) {
+	direct := map[string]bool{}
+	for _, d := range m.Deps {
+		direct[d.Name] = true
+		if v, ok := locked[d.Name]; ok && v != d.Version {
+			d.Locked = v
+		}
+	}
+	for name, version := range locked {
+		if !direct[name] && name != m.Name {
+			m.add(&Dependency{Name: name, Version: version, Indirect: true})
+		}
+	}
+}
+
+// pep508Name splits a requirement such as "requests[socks]>=2.0; python_version>'3.8'"
+var pep508Name = regexp.MustCompile(`^\s*([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[[^\]]*\])?\s*([^;]*)`)
+
+func parsePyproject(m *Manifest, data string) {
+	doc := parseTOML(data)
+	requirement := func(req, kind string) {
+		if match := pep508Name.FindStringSubmatch(req); match != nil {
+			m.add(&Dependency{Name: normalizePython(match[1]), Version: strings.TrimSpace(match[2]), Kind: kind})
+		}
+	}
+
+	project := doc.tables["project"]
+	m.Name = tomlString(project["name"])
+	for _, req := range tomlStrings(project["dependencies"]) {
+		requirement(req, "")
+	}
+	for _, table := range []string{"project.optional-dependencies", "dependency-groups"} {
+		for _, group := range doc.order[table] {
+			kind := "optional"
+			if table == "dependency-groups" {
+				kind = group
+			}
+			for _, req := range tomlStrings(doc.tables[table][group]) {
+				requirement(req, kind)
+			}
+		}
+	}
+
+	// Poetry keeps its own tables, keyed by package name
+	if m.Name == "" {
+		m.Name = tomlString(doc.tables["tool.poetry"]["name"])
+	}
+	poetryTables := []string{"tool.poetry.dependencies", "tool.poetry.dev-dependencies"}
+	for table := range doc.tables {
+		if strings.HasPrefix(table, "tool.poetry.group.") && strings.HasSuffix(table, ".dependencies") {
+			poetryTables = append(poetryTables, table)
+		}
+	}
+	sort.Strings(poetryTables[2:])
+	for _, table := range poetryTables {
+		kind := ""
+		switch {
+		case table == "tool.poetry.dev-dependencies":
+			kind = "dev"
+		case strings.HasPrefix(table, "tool.poetry.group."):
+			kind = strings.TrimSuffix(strings.TrimPrefix(table, "tool.poetry.group."), ".dependencies")
+		}
+		for _, name := range doc.order[table] {
+			if strings.EqualFold(name, "python") {
+				continue
+			}
+			version, note := tableVersion(doc.tables[table][name])
+			m.add(&Dependency{Name: normalizePython(name), Version: version, Kind: kind, Note: note})
+		}
+	}
+}
+
+func parseCargo(m *Manifest, data string) {
+	doc := parseTOML(data)
+	m.Name = tomlString(doc.tables["package"]["name"])
+
+	kinds := map[string]string{"dependencies": "", "dev-dependencies": "dev", "build-dependencies": "build", "workspace.dependencies": ""}
+	var tables []string
+	for table := range doc.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		section := table
+		if strings.HasPrefix(table, "target.") {
+			// [target.'cfg(unix)'.dependencies]
+			section = table[strings.LastIndex(table, ".")+1:]
+		}
+		kind, ok := kinds[section]
+		if !ok {
+			// [dependencies.serde] declares one dependency as a table
+			for prefix, k := range kinds {
+				if name, found := strings.CutPrefix(table, prefix+"."); found && !strings.Contains(name, ".") {
+					version, note := tableVersion(inlineOf(doc.tables[table]))
+					m.add(&Dependency{Name: name, Version: version, Kind: k, Note: note})
+				}
+			}
+			continue
+		}
+		for _, name := range doc.order[table] {
+			if strings.Contains(name, ".") {
+				continue
+			}
+			version, note := tableVersion(doc.tables[table][name])
+			m.add(&Dependency{Name: name, Version: version, Kind: kind, Note: note})
+		}
+	}
+}
+
+// inlineOf turns a table back into inline form for tableVersion
+func inlineOf(table map[string]string) string {
+	var parts []string
+	for k, v := range table {
+		parts = append(parts, k+" = "+v)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// tableVersion reads a dependency given as a version string or as a table with a version, path or git source
+func tableVersion(raw string) (version, note string) {
+	if s := tomlString(raw); s != "" {
+		return s, ""
+	}
+	fields := tomlInline(raw)
+	version = tomlString(fields["version"])
+	switch {
+	case fields["path"] != "":
+		note = "path " + tomlString(fields["path"])
+	case fields["git"] != "":
+		note = "git " + tomlString(fields["git"])
+	case fields["workspace"] == "true":
+		note = "from the workspace"
+	}
+	return version, note
+}
+
+// applyTOMLLock reads the [[package]] entries of Cargo.lock, poetry.lock or uv.lock
+func applyTOMLLock(m *Manifest, data string, normalize func(string) string) {
+	locked := map[string]string{}
+	for _, pkg := range parseTOML(data).arrays["package"] {
+		if name := tomlString(pkg["name"]); name != "" {
+			locked[normalize(name)] = tomlString(pkg["version"])
+		}
+	}
+	applyLocked(m, locked)
+}
+
+var pythonSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizePython normalizes a distribution name as pip does (PEP 503)
+func normalizePython(name string) string {
+	return pythonSeparators.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// pythonModules are distributions whose import name differs from the distribution name
+var pythonModules = map[string]string{
+	"pyyaml": "yaml", "beautifulsoup4": "bs4", "pillow": "PIL", "scikit-learn": "sklearn",
+	"opencv-python": "cv2", "opencv-python-headless": "cv2", "python-dateutil": "dateutil",
+	"python-dotenv": "dotenv", "protobuf": "google", "pyjwt": "jwt", "attrs": "attr",
+	"psycopg2-binary": "psycopg2", "pymysql": "pymysql", "typing-extensions": "typing_extensions",
+}
+
+// pythonModule is the top-level module a distribution is usually imported as
+func pythonModule(name string) string {
+	if module, ok := pythonModules[name]; ok {
+		return module
+	}
+	return strings.ReplaceAll(name, "-", "_")
+}
@@ -0,0 +1,229 @@
+package deps
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func find(m *Manifest, name string) *Dependency {
+	for _, d := range m.Deps {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+func scanOne(t *testing.T, files map[string]string) *Manifest {
+	t.Helper()
+	root := t.TempDir()
+	writeFiles(t, root, files)
+	manifests, err := Scan(root)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(manifests) != 1 {
+		t.Fatalf("expected 1 manifest, got %d", len(manifests))
+	}
+	return manifests[0]
+}
+
+func TestScanGo(t *testing.T) {
+	m := scanOne(t, map[string]string{
+		"go.mod": `module example.com/app
+
+go 1.22
+
+require github.com/solo/lib v0.1.0
+
+require (
+	github.com/acme/widgets v1.4.2
+	github.com/acme/widgets/v2 v2.0.1
+	golang.org/x/sys v0.20.0 // indirect
+)
+
+replace github.com/solo/lib => ../lib
+`,
+		"main.go":            "package main\n\nimport (\n\t\"fmt\"\n\t\"github.com/acme/widgets/gears\"\n\tw2 \"github.com/acme/widgets/v2\"\n)\n",
+		"pkg/util/util.go":   "package util\n\nimport \"github.com/solo/lib\"\n",
+		"vendor/x/vendor.go": "package x\n\nimport \"github.com/acme/widgets\"\n",
+	})
+	if m.Name != "example.com/app" || m.Ecosystem != "go" {
+		t.Errorf("manifest = %+v", m)
+	}
+
+	widgets := find(m, "github.com/acme/widgets")
+	if widgets == nil || widgets.Version != "v1.4.2" || widgets.Indirect || !reflect.DeepEqual(widgets.Files, []string{"main.go"}) {
+		t.Errorf("widgets = %+v", widgets)
+	}
+	if v2 := find(m, "github.com/acme/widgets/v2"); v2 == nil || !reflect.DeepEqual(v2.Files, []string{"main.go"}) {
+		t.Errorf("widgets/v2 = %+v, want the longest matching module", v2)
+	}
+	if lib := find(m, "github.com/solo/lib"); lib == nil || lib.Note != "replaced by ../lib" || !reflect.DeepEqual(lib.Files, []string{"pkg/util/util.go"}) {
+		t.Errorf("lib = %+v", lib)
+	}
+	if sys := find(m, "golang.org/x/sys"); sys == nil || !sys.Indirect {
+		t.Errorf("x/sys = %+v, want indirect", sys)
+	}
+	if last := m.Deps[len(m.Deps)-1]; last.Name != "golang.org/x/sys" {
+		t.Errorf("indirect dependencies should sort last, got %s", last.Name)
+	}
+}
+
+func TestScanNpm(t *testing.T) {
+	m := scanOne(t, map[string]string{
+		"package.json": `{"name": "web", "dependencies": {"react": "^18.2.0", "@scope/ui": "1.0.0"}, "devDependencies": {"vitest": "^1.0.0"}}`,
+		"package-lock.json": `{"lockfileVersion": 3, "packages": {
+			"": {"name": "web"},
+			"node_modules/react": {"version": "18.3.1"},
+			"node_modules/@scope/ui": {"version": "1.0.0"},
+			"node_modules/loose-envify": {"version": "1.4.0"},
+			"node_modules/vitest/node_modules/loose-envify": {"version": "1.2.0"}
+		}}`,
+		"src/App.tsx":         "import React, { useState } from 'react';\nimport { Button } from \"@scope/ui/button\";\nimport './App.css';\n",
+		"src/App.test.ts":     "const { test } = require('vitest')\nconst App = await import('./App')\n",
+		"node_modules/r/a.js": "import 'react'\n",
+	})
+
+	react := find(m, "react")
+	if react == nil || react.Version != "^18.2.0" || react.Locked != "18.3.1" || !reflect.DeepEqual(react.Files, []string{"src/App.tsx"}) {
+		t.Errorf("react = %+v", react)
+	}
+	if ui := find(m, "@scope/ui"); ui == nil || ui.Locked != "" || !reflect.DeepEqual(ui.Files, []string{"src/App.tsx"}) {
+		t.Errorf("@scope/ui = %+v", ui)
+	}
+	if vitest := find(m, "vitest"); vitest == nil || vitest.Kind != "dev" || !reflect.DeepEqual(vitest.Files, []string{"src/App.test.ts"}) {
+		t.Errorf("vitest = %+v", vitest)
+	}
+	if envify := find(m, "loose-envify"); envify == nil || !envify.Indirect || envify.Version != "1.4.0" {
+		t.Errorf("loose-envify = %+v, want the hoisted indirect version", envify)
+	}
+}
+
+func TestScanPython(t *testing.T) {
+	m := scanOne(t, map[string]string{
+		"pyproject.toml": `[project]
+name = "tool"
+dependencies = [
+    "requests[socks]>=2.31",  # HTTP
+    "PyYAML>=6",
+    "Typing_Extensions; python_version < '3.11'",
+]
+
+[project.optional-dependencies]
+test = ["pytest>=8"]
+`,
+		"poetry.lock": `[[package]]
+name = "requests"
+version = "2.32.3"
+
+[[package]]
+name = "urllib3"
+version = "2.2.1"
+`,
+		"tool/cli.py":       "import os, yaml as y\nfrom requests.adapters import HTTPAdapter\n",
+		"tests/test_cli.py": "import pytest\nfrom typing_extensions import Self\n",
+	})
+
+	if requests := find(m, "requests"); requests == nil || requests.Version != ">=2.31" || requests.Locked != "2.32.3" || !reflect.DeepEqual(requests.Files, []string{"tool/cli.py"}) {
+		t.Errorf("requests = %+v", requests)
+	}
+	if yaml := find(m, "pyyaml"); yaml == nil || !reflect.DeepEqual(yaml.Files, []string{"tool/cli.py"}) {
+		t.Errorf("pyyaml = %+v", yaml)
+	}
+	if te := find(m, "typing-extensions"); te == nil || te.Version != "" || !reflect.DeepEqual(te.Files, []string{"tests/test_cli.py"}) {
+		t.Errorf("typing-extensions = %+v", te)
+	}
+	if pytest := find(m, "pytest"); pytest == nil || pytest.Kind != "optional" {
+		t.Errorf("pytest = %+v", pytest)
+	}
+	if urllib3 := find(m, "urllib3"); urllib3 == nil || !urllib3.Indirect {
+		t.Errorf("urllib3 = %+v, want indirect", urllib3)
+	}
+}
+
+func TestScanPoetryAndCargo(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"py/pyproject.toml": `[tool.poetry]
+name = "svc"
+
+[tool.poetry.dependencies]
+python = "^3.11"
+fastapi = { version = "^0.110", extras = ["all"] }
+
+[tool.poetry.group.dev.dependencies]
+black = "^24"
+`,
+		"rs/Cargo.toml": `[package]
+name = "engine"
+
+[dependencies]
+serde = { version = "1.0", features = ["derive"] }
+serde-json = "1"
+local-util = { path = "../util" }
+
+[dependencies.tokio]
+version = "1.37"
+features = ["full"]
+
+[dev-dependencies]
+criterion = "0.5"
+`,
+		"rs/Cargo.lock":  "[[package]]\nname = \"serde\"\nversion = \"1.0.200\"\n\n[[package]]\nname = \"itoa\"\nversion = \"1.0.11\"\n",
+		"rs/src/main.rs": "use serde::Serialize;\nfn main() { let _ = serde_json::to_string(&1); tokio::spawn(async {}); }\n",
+		"py/app.py":      "from fastapi import FastAPI\n",
+	})
+	manifests, err := Scan(root)
+	if err != nil || len(manifests) != 2 {
+		t.Fatalf("Scan() = %v, %v", manifests, err)
+	}
+	py, rs := manifests[0], manifests[1]
+
+	if py.Name != "svc" || find(py, "python") != nil {
+		t.Errorf("poetry manifest = %+v", py)
+	}
+	if fastapi := find(py, "fastapi"); fastapi == nil || fastapi.Version != "^0.110" || !reflect.DeepEqual(fastapi.Files, []string{"py/app.py"}) {
+		t.Errorf("fastapi = %+v", fastapi)
+	}
+	if black := find(py, "black"); black == nil || black.Kind != "dev" {
+		t.Errorf("black = %+v", black)
+	}
+
+	if rs.Name != "engine" {
+		t.Errorf("cargo manifest = %+v", rs)
+	}
+	if serde := find(rs, "serde"); serde == nil || serde.Version != "1.0" || serde.Locked != "1.0.200" || !reflect.DeepEqual(serde.Files, []string{"rs/src/main.rs"}) {
+		t.Errorf("serde = %+v", serde)
+	}
+	if sj := find(rs, "serde-json"); sj == nil || !reflect.DeepEqual(sj.Files, []string{"rs/src/main.rs"}) {
+		t.Errorf("serde-json = %+v", sj)
+	}
+	if tokio := find(rs, "tokio"); tokio == nil || tokio.Version != "1.37" || len(tokio.Files) != 1 {
+		t.Errorf("tokio = %+v", tokio)
+	}
+	if util := find(rs, "local-util"); util == nil || util.Note != "path ../util" {
+		t.Errorf("local-util = %+v", util)
+	}
+	if criterion := find(rs, "criterion"); criterion == nil || criterion.Kind != "dev" {
+		t.Errorf("criterion = %+v", criterion)
+	}
+	if itoa := find(rs, "itoa"); itoa == nil || !itoa.Indirect {
+		t.Errorf("itoa = %+v, want indirect", itoa)
+	}
+}
@@ -0,0 +1,76 @@
+package deps
+
+import (
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// import x from 'pkg', import 'pkg', export * from 'pkg', require('pkg') and import('pkg')
+	jsImport = regexp.MustCompile(`(?:\bfrom|\bimport|\brequire\s*\()\s*\(?\s*['"]([^'"\s]+)['"]`)
+	// from pkg.sub import x, and import a.b, c as d
+	pyFrom   = regexp.MustCompile(`(?m)^[ \t]*from[ \t]+([A-Za-z_]\w*)`)
+	pyImport = regexp.MustCompile(`(?m)^[ \t]*import[ \t]+([\w., \t]+)`)
+	// use serde::Serialize, serde_json::to_string(...) and extern crate log
+	rustPath  = regexp.MustCompile(`\b([A-Za-z_]\w*)::`)
+	rustCrate = regexp.MustCompile(`\bextern\s+crate\s+(\w+)`)
+)
+
+// importsOf returns the packages a source file imports, in the form match compares against:
+// import paths for Go, package names for npm, top-level modules for Python and crate names for Rust
+func importsOf(ecosystem, path string, data []byte) []string {
+	var imports []string
+	switch ecosystem {
+	case "go":
+		file, err := parser.ParseFile(token.NewFileSet(), path, data, parser.ImportsOnly)
+		if err != nil {
+			return nil
+		}
+		for _, spec := range file.Imports {
+			if p, err := strconv.Unquote(spec.Path.Value); err == nil {
+				imports = append(imports, p)
+			}
+		}
+	case "npm":
+		for _, match := range jsImport.FindAllSubmatch(data, -1) {
+			if name := npmPackage(string(match[1])); name != "" {
+				imports = append(imports, name)
+			}
+		}
+	case "python":
+		for _, match := range pyFrom.FindAllSubmatch(data, -1) {
+			imports = append(imports, string(match[1]))
+		}
+		for _, match := range pyImport.FindAllSubmatch(data, -1) {
+			for _, part := range strings.Split(string(match[1]), ",") {
+				module, _, _ := strings.Cut(strings.TrimSpace(part), ".")
+				if fields := strings.Fields(module); len(fields) > 0 {
+					imports = append(imports, fields[0])
+				}
+			}
+		}
+	case "rust":
+		for _, match := range rustPath.FindAllSubmatch(data, -1) {
+			imports = append(imports, string(match[1]))
+		}
+		for _, match := range rustCrate.FindAllSubmatch(data, -1) {
+			imports = append(imports, string(match[1]))
+		}
+	}
+	return imports
+}
+
+// npmPackage returns the package a module specifier is in, or "" for relative and absolute paths
+func npmPackage(specifier string) string {
+	if strings.HasPrefix(specifier, ".") || strings.HasPrefix(specifier, "/") || strings.Contains(specifier, ":") {
+		return ""
+	}
+	parts := strings.SplitN(specifier, "/", 3)
+	if strings.HasPrefix(specifier, "@") && len(parts) >= 2 {
+		return parts[0] + "/" + parts[1]
+	}
+	return parts[0]
+}
@@ -0,0 +1,189 @@
+package deps
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// tomlDoc is the subset of TOML found in manifests and lock files: tables, arrays of tables, and
+// keys whose values are kept as raw text for the helpers below to decode
+type tomlDoc struct {
+	tables map[string]map[string]string   // [table] -> key -> raw value
+	arrays map[string][]map[string]string // [[table]] -> entries
+	order  map[string][]string            // Keys of each table in file order
+}
+
+func parseTOML(data string) *tomlDoc {
+	doc := &tomlDoc{tables: map[string]map[string]string{"": {}}, arrays: map[string][]map[string]string{}, order: map[string][]string{}}
+	current := doc.tables[""]
+	currentName := ""
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var pendingKey, pending string
+	for scanner.Scan() {
+		line := stripTOMLComment(scanner.Text())
+		if pendingKey != "" {
+			pending += "\n" + line
+			if balanced(pending) {
+				current[pendingKey] = strings.TrimSpace(pending)
+				pendingKey = ""
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "[["):
+			currentName = unquoteKey(strings.TrimSuffix(strings.TrimPrefix(trimmed, "[["), "]]"))
+			current = map[string]string{}
+			doc.arrays[currentName] = append(doc.arrays[currentName], current)
+		case strings.HasPrefix(trimmed, "["):
+			currentName = unquoteKey(strings.TrimSuffix(strings.TrimPrefix(trimmed, "["), "]"))
+			if doc.tables[currentName] == nil {
+				doc.tables[currentName] = map[string]string{}
+			}
+			current = doc.tables[currentName]
+		default:
+			key, value, ok := strings.Cut(trimmed, "=")
+			if !ok {
+				continue
+			}
+			key, value = unquoteKey(key), strings.TrimSpace(value)
+			doc.order[currentName] = append(doc.order[currentName], key)
+			if !balanced(value) {
+				pendingKey, pending = key, value
+				continue
+			}
+			current[key] = value
+		}
+	}
+	return doc
+}
+
+// stripTOMLComment removes a # comment that is not inside a string
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// balanced reports whether the brackets and braces of a value are closed
+func balanced(value string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+func unquoteKey(key string) string {
+	parts := strings.Split(strings.TrimSpace(key), ".")
+	for i, p := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(p), `"'`)
+	}
+	return strings.Join(parts, ".")
+}
+
+// tomlString decodes a string value, or returns "" for other values
+func tomlString(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "'") && strings.HasSuffix(raw, "'") && len(raw) >= 2 {
+		return raw[1 : len(raw)-1]
+	}
+	if s, err := strconv.Unquote(raw); err == nil {
+		return s
+	}
+	return ""
+}
+
+// tomlStrings decodes an array of strings
+func tomlStrings(raw string) []string {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "[") {
+		return nil
+	}
+	var out []string
+	for _, item := range splitTopLevel(raw[1 : len(raw)-1]) {
+		if s := tomlString(item); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// tomlInline decodes an inline table such as { version = "1", features = ["x"] }
+func tomlInline(raw string) map[string]string {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "{") || !strings.HasSuffix(raw, "}") {
+		return nil
+	}
+	out := map[string]string{}
+	for _, item := range splitTopLevel(raw[1 : len(raw)-1]) {
+		if key, value, ok := strings.Cut(item, "="); ok {
+			out[unquoteKey(key)] = strings.TrimSpace(value)
+		}
+	}
+	return out
+}
+
+// splitTopLevel splits on commas outside strings, arrays and tables
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		parts = append(parts, rest)
+	}
+	return parts
+}
@@ -0,0 +1,233 @@
+// Package devcontainer locates a project's devcontainer and runs commands inside it with docker exec
+package devcontainer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"coding-agent/pkg/types"
+)
+
+// configPaths are the locations the devcontainer spec allows for the config file
+var configPaths = []string{
+	filepath.Join(".devcontainer", "devcontainer.json"),
+	".devcontainer.json",
+}
+
+// Config holds the devcontainer.json fields needed to exec into a running container
+type Config struct {
+	Name            string `json:"name"`
+	WorkspaceFolder string `json:"workspaceFolder"`
+	RemoteUser      string `json:"remoteUser"`
+	ContainerUser   string `json:"containerUser"`
+}
+
+// Find returns the devcontainer config in dir, or "" if the project has none
+func Find(dir string) string {
+	for _, rel := range configPaths {
+		p := filepath.Join(dir, rel)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+// Load reads a devcontainer.json, which may contain comments and trailing commas
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(StripJSONC(data), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return &config, nil
+}
+
+// Attach finds the running devcontainer for the project in dir and returns an exec target for it
+func Attach(ctx context.Context, dir string) (*types.ExecTarget, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	root := dir
+	for Find(root) == "" {
+		parent := filepath.Dir(root)
+		if parent == root {
+			return nil, fmt.Errorf("no .devcontainer/devcontainer.json found in %s or its parents", dir)
+		}
+		root = parent
+	}
+	config, err := Load(Find(root))
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := docker(ctx, "ps", "-q", "--filter", "label=devcontainer.local_folder="+root)
+	if err != nil {
+		return nil, err
+	}
+	ids := strings.Fields(output)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no running devcontainer for %s; start it with `devcontainer up --workspace-folder %s`", root, root)
+	}
+	id := ids[0]
+
+	workspace := strings.ReplaceAll(config.WorkspaceFolder, "${localWorkspaceFolderBasename}", filepath.Base(root))
+	if workspace == "" {
+		workspace = mountedAt(ctx, id, root)
+	}
+	if workspace == "" {
+		workspace = "/workspaces/" + filepath.Base(root)
+	}
+
+	target := &types.ExecTarget{
+		Name:    "devcontainer " + displayName(config, root),
+		HostDir: root,
+		Workdir: workspace,
+	}
+	// Commands start in the container's view of the current directory, not the project root
+	target.Prefix = ExecPrefix(id, target.Path(dir), user(config))
+	return target, nil
+}
+
+// ExecPrefix builds the docker exec command that runs a shell command in the container.
+// A login shell is used so the toolchain set up by the image's profile is on PATH.
+func ExecPrefix(container, workdir, user string) []string {
+	prefix := []string{"docker", "exec", "-i", "-w", workdir}
+	if user != "" {
+		prefix = append(prefix, "-u", user)
+	}
+	return append(prefix, container, "bash", "-lc")
+}
+
+// StripJSONC removes // and /* */ comments and trailing commas so JSONC parses as JSON
+func StripJSONC(data []byte) []byte {
+	var out bytes.Buffer
+	inString, escaped := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			out.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out.WriteByte('\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(data)
+			} else {
+				i += end + 3
+			}
+		case c == ',':
+			// Drop the comma if only whitespace and comments remain before the closing bracket
+			if next := nextSignificant(data[i+1:]); next == '}' || next == ']' {
+				continue
+			}
+			out.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+// nextSignificant returns the first byte that is not whitespace or part of a comment
+func nextSignificant(data []byte) byte {
+	for i := 0; i < len(data); i++ {
+		switch {
+		case data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r':
+		case data[i] == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case data[i] == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return 0
+			}
+			i += end + 3
+		default:
+			return data[i]
+		}
+	}
+	return 0
+}
+
+// mountedAt returns where the container mounts hostDir, or "" if it is not mounted directly
+func mountedAt(ctx context.Context, container, hostDir string) string {
+	output, err := docker(ctx, "inspect", "--format", "{{json .Mounts}}", container)
+	if err != nil {
+		return ""
+	}
+	var mounts []struct {
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+	}
+	if err := json.Unmarshal([]byte(output), &mounts); err != nil {
+		return ""
+	}
+	for _, m := range mounts {
+		if filepath.Clean(m.Source) == hostDir {
+			return path.Clean(m.Destination)
+		}
+	}
+	return ""
+}
+
+func user(config *Config) string {
+	if config.RemoteUser != "" {
+		return config.RemoteUser
+	}
+	return config.ContainerUser
+}
+
+func displayName(config *Config, root string) string {
+	if config.Name != "" {
+		return config.Name
+	}
+	return filepath.Base(root)
+}
+
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("docker %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("docker %s: %v", args[0], err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,70 @@
+package devcontainer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStripJSONC(t *testing.T) {
+	input := `{
+	// The image name
+	"name": "app", /* inline */
+	"workspaceFolder": "/workspaces/app",
+	"url": "http://example.com/a//b",
+	"quote": "say \"//hi\"",
+	"forwardPorts": [3000, 8080,],
+	"remoteUser": "vscode", // trailing comment
+}`
+	var got map[string]interface{}
+	if err := json.Unmarshal(StripJSONC([]byte(input)), &got); err != nil {
+		t.Fatalf("stripped JSONC does not parse: %v\n%s", err, StripJSONC([]byte(input)))
+	}
+	want := map[string]interface{}{
+		"name":            "app",
+		"workspaceFolder": "/workspaces/app",
+		"url":             "http://example.com/a//b",
+		"quote":           `say "//hi"`,
+		"forwardPorts":    []interface{}{3000.0, 8080.0},
+		"remoteUser":      "vscode",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFindAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	if Find(dir) != "" {
+		t.Fatal("Find() reported a config in an empty directory")
+	}
+
+	path := filepath.Join(dir, ".devcontainer", "devcontainer.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{\n  // comment\n  \"name\": \"app\",\n  \"containerUser\": \"dev\",\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := Find(dir); got != path {
+		t.Fatalf("Find() = %q, want %q", got, path)
+	}
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "app" || user(config) != "dev" {
+		t.Errorf("Load() = %+v", config)
+	}
+}
+
+func TestExecPrefix(t *testing.T) {
+	got := ExecPrefix("abc123", "/workspaces/app/pkg", "vscode")
+	want := []string{"docker", "exec", "-i", "-w", "/workspaces/app/pkg", "-u", "vscode", "abc123", "bash", "-lc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExecPrefix() = %v, want %v", got, want)
+	}
+}
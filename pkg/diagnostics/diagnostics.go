@@ -0,0 +1,103 @@
+// Package diagnostics extracts file/line/message triples from compiler and linter output.
+package diagnostics
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is a single error or warning reported against a source location
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+}
+
+var (
+	// file:line[:col]: message (Go, gcc/clang, tsc --pretty false, eslint -f unix, ruff, mypy)
+	colonFormat = regexp.MustCompile(`^([^\s:][^:]*\.[A-Za-z0-9]+):(\d+)(?::(\d+))?:\s*(.+)$`)
+	// file(line,col): message (tsc, MSBuild)
+	parenFormat = regexp.MustCompile(`^([^\s(][^(]*\.[A-Za-z0-9]+)\((\d+),(\d+)\):\s*(.+)$`)
+	// [ERROR] file:[line,col] message (maven)
+	mavenFormat = regexp.MustCompile(`^\[(?:ERROR|WARNING)\]\s+(\S+\.[A-Za-z0-9]+):\[(\d+),(\d+)\]\s*(.+)$`)
+	// error[E0308]: message, followed by "--> file:line:col" (rustc)
+	rustHeader   = regexp.MustCompile(`^(error|warning)(\[\w+\])?:\s*(.+)$`)
+	rustLocation = regexp.MustCompile(`^\s*-->\s*(\S+):(\d+):(\d+)`)
+	// A path on its own line, followed by indented "line:col  severity  message  rule" entries (eslint's default format)
+	stylishFile  = regexp.MustCompile(`^(\S+\.[A-Za-z0-9]+)$`)
+	stylishEntry = regexp.MustCompile(`^\s+(\d+):(\d+)\s+((?:error|warning)\s+.+?)\s*$`)
+)
+
+// Parse extracts diagnostics from tool output, in order and without duplicates.
+// Lines that match no known format are ignored.
+func Parse(output string) []Diagnostic {
+	var diags []Diagnostic
+	seen := make(map[Diagnostic]bool)
+	add := func(d Diagnostic) {
+		d.File = strings.TrimPrefix(d.File, "./")
+		if !seen[d] {
+			seen[d] = true
+			diags = append(diags, d)
+		}
+	}
+
+	pendingRust := ""
+	stylishPath := ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if m := stylishFile.FindStringSubmatch(line); m != nil {
+			stylishPath = m[1]
+			continue
+		}
+		if m := stylishEntry.FindStringSubmatch(line); m != nil && stylishPath != "" {
+			add(Diagnostic{File: stylishPath, Line: atoi(m[1]), Column: atoi(m[2]), Message: strings.Join(strings.Fields(m[3]), " ")})
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			stylishPath = ""
+		}
+
+		if m := rustHeader.FindStringSubmatch(line); m != nil {
+			pendingRust = m[1] + m[2] + ": " + m[3]
+			continue
+		}
+		if m := rustLocation.FindStringSubmatch(line); m != nil {
+			if pendingRust != "" {
+				add(Diagnostic{File: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Message: pendingRust})
+				pendingRust = ""
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		var m []string
+		switch {
+		case mavenFormat.MatchString(trimmed):
+			m = mavenFormat.FindStringSubmatch(trimmed)
+		case parenFormat.MatchString(trimmed):
+			m = parenFormat.FindStringSubmatch(trimmed)
+		case colonFormat.MatchString(trimmed):
+			m = colonFormat.FindStringSubmatch(trimmed)
+		default:
+			continue
+		}
+		add(Diagnostic{File: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Message: strings.TrimSpace(m[4])})
+	}
+	return diags
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,79 @@
+package diagnostics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []Diagnostic
+	}{
+		{
+			name: "Go",
+			output: `# example.com/app/pkg/tools
+pkg/tools/tools.go:42:9: undefined: foo
+./main.go:7: missing return
+pkg/tools/tools.go:42:9: undefined: foo`,
+			want: []Diagnostic{
+				{File: "pkg/tools/tools.go", Line: 42, Column: 9, Message: "undefined: foo"},
+				{File: "main.go", Line: 7, Message: "missing return"},
+			},
+		},
+		{
+			name:   "TypeScript",
+			output: "src/index.ts(3,7): error TS2322: Type 'string' is not assignable to type 'number'.",
+			want: []Diagnostic{
+				{File: "src/index.ts", Line: 3, Column: 7, Message: "error TS2322: Type 'string' is not assignable to type 'number'."},
+			},
+		},
+		{
+			name: "Rust",
+			output: `error[E0308]: mismatched types
+  --> src/main.rs:4:18
+   |
+4  |     let x: i32 = "a";
+warning: unused variable: ` + "`y`" + `
+ --> src/lib.rs:10:9`,
+			want: []Diagnostic{
+				{File: "src/main.rs", Line: 4, Column: 18, Message: "error[E0308]: mismatched types"},
+				{File: "src/lib.rs", Line: 10, Column: 9, Message: "warning: unused variable: `y`"},
+			},
+		},
+		{
+			name:   "Maven",
+			output: "[ERROR] /src/main/java/App.java:[12,5] cannot find symbol",
+			want: []Diagnostic{
+				{File: "/src/main/java/App.java", Line: 12, Column: 5, Message: "cannot find symbol"},
+			},
+		},
+		{
+			name: "ESLint stylish",
+			output: `
+/app/src/index.js
+   3:7   error    'x' is assigned a value but never used  no-unused-vars
+  10:1   warning  Unexpected console statement            no-console
+
+✖ 2 problems (1 error, 1 warning)`,
+			want: []Diagnostic{
+				{File: "/app/src/index.js", Line: 3, Column: 7, Message: "error 'x' is assigned a value but never used no-unused-vars"},
+				{File: "/app/src/index.js", Line: 10, Column: 1, Message: "warning Unexpected console statement no-console"},
+			},
+		},
+		{
+			name:   "No diagnostics",
+			output: "ok  \texample.com/app\t0.1s\nFAIL\n",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
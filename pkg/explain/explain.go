@@ -0,0 +1,499 @@
+// Package explain gathers what an explanation of a file or symbol needs: the code itself, what its
+// file imports and where it is used in the project
+package explain
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxCodeLines     = 200 // Longer definitions and files are cut off
+	maxReferences    = 20
+	maxImports       = 40
+	maxFileBytes     = 1024 * 1024
+	maxScannedFiles  = 5000
+	maxDocLines      = 20 // Comment lines kept above a definition
+	contextLines     = 30 // Lines shown around a line that is not inside a definition
+	maxEnclosingScan = 500
+)
+
+// sourceExts are the files searched for definitions and references
+var sourceExts = map[string]bool{
+	".go": true, ".ts": true, ".tsx": true, ".js": true, ".jsx": true, ".mjs": true, ".cjs": true,
+	".py": true, ".rs": true, ".java": true, ".kt": true, ".rb": true, ".php": true, ".cs": true,
+	".swift": true, ".c": true, ".h": true, ".cpp": true, ".cc": true, ".hpp": true,
+}
+
+var skipDirs = map[string]bool{"node_modules": true, "vendor": true, "target": true, "dist": true, "build": true, "__pycache__": true}
+
+// definitionPrefix matches the keywords that start a declaration, up to the declared name
+const definitionPrefix = `^[ \t]*(?:(?:export|pub(?:\([^)]*\))?|public|private|protected|static|abstract|final|async|default|override|open|internal|unsafe)[ \t]+)*` +
+	`(?:func(?:[ \t]*\([^)]*\))?|type|def|class|function\*?|interface|struct|enum|trait|fn|const|let|var|impl|module|object|fun|record)[ \t]+`
+
+var (
+	anyDefinition = regexp.MustCompile(definitionPrefix + `([A-Za-z_$][\w$]*)`)
+	lineTarget    = regexp.MustCompile(`^(.+):(\d+)$`)
+
+	jsImport     = regexp.MustCompile(`(?:\bfrom|^[ \t]*import|\brequire\s*\()\s*\(?\s*['"]([^'"\s]+)['"]`)
+	pyImport     = regexp.MustCompile(`(?m)^[ \t]*(?:from[ \t]+(\S+)[ \t]+import|import[ \t]+([\w., \t]+))`)
+	rustImport   = regexp.MustCompile(`(?m)^[ \t]*(?:pub[ \t]+)?use[ \t]+([^;]+);`)
+	cImport      = regexp.MustCompile(`(?m)^[ \t]*#[ \t]*include[ \t]*[<"]([^>"]+)[>"]`)
+	javaImport   = regexp.MustCompile(`(?m)^[ \t]*import[ \t]+(?:static[ \t]+)?([\w.*]+)`)
+	importLine   = regexp.MustCompile(`^[ \t]*(?:import\b|from[ \t]+\S+[ \t]+import\b|#[ \t]*include\b|(?:pub[ \t]+)?use[ \t]|.*\brequire\s*\(|.*\bfrom[ \t]+['"]|"[^"]+"$|\w+[ \t]+"[^"]+"$)`)
+	commentStart = regexp.MustCompile(`^[ \t]*(?://|#|/\*|\*|""")`)
+)
+
+// Reference is a line that uses the explained code
+type Reference struct {
+	File string // Relative to the root
+	Line int
+	Text string
+}
+
+// Context is the material for an explanation
+type Context struct {
+	Target     string      // As given
+	Symbol     string      // Symbol explained; empty for a whole file or a range of lines
+	File       string      // File holding the code, relative to the root
+	StartLine  int         // 1-based, inclusive
+	EndLine    int         // 1-based, inclusive
+	Code       string      // Lines StartLine to EndLine
+	Truncated  bool        // The definition or file continues past EndLine
+	Imports    []string    // What the file imports
+	References []Reference // Uses of the symbol, or imports of the file, elsewhere
+	MoreRefs   int         // References found beyond the ones listed
+}
+
+// Gather collects the code for a target under root: a file, path:line for the definition that
+// contains the line, or the name of a symbol (optionally qualified, e.g. Server.Start)
+func Gather(root, target string) (*Context, error) {
+	c := &Context{Target: target}
+	path, line := target, 0
+	if m := lineTarget.FindStringSubmatch(target); m != nil {
+		if n, err := strconv.Atoi(m[2]); err == nil && isFile(resolve(root, m[1])) {
+			path, line = m[1], n
+		}
+	}
+
+	full := resolve(root, path)
+	if isFile(full) {
+		data, err := os.ReadFile(full)
+		if err != nil {
+			return nil, err
+		}
+		c.File = relative(root, full)
+		lines := splitLines(string(data))
+		if line > 0 {
+			if line > len(lines) {
+				return nil, fmt.Errorf("%s has %d lines", c.File, len(lines))
+			}
+			c.fromLine(lines, line)
+		} else {
+			c.setCode(lines, 1, len(lines))
+		}
+		c.Imports = imports(full, string(data))
+		files := sourceFiles(root)
+		if c.Symbol != "" {
+			c.findReferences(root, files, c.Symbol)
+		} else {
+			c.findImporters(root, files, full)
+		}
+		return c, nil
+	}
+
+	if !regexp.MustCompile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)?$`).MatchString(target) {
+		return nil, fmt.Errorf("%s is neither a file nor a symbol name", target)
+	}
+	qualifier, name := "", target
+	if i := strings.LastIndex(target, "."); i >= 0 {
+		qualifier, name = target[:i], target[i+1:]
+	}
+	files := sourceFiles(root)
+	if err := c.findDefinition(root, files, name, qualifier); err != nil {
+		return nil, err
+	}
+	c.Imports = imports(filepath.Join(root, c.File), "")
+	c.findReferences(root, files, name)
+	return c, nil
+}
+
+// fromLine sets the code to the definition enclosing line, or to the lines around it
+func (c *Context) fromLine(lines []string, line int) {
+	for i := line - 1; i >= 0 && i >= line-1-maxEnclosingScan; i-- {
+		m := anyDefinition.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		if end := blockEnd(lines, i, c.File); end >= line-1 {
+			c.Symbol = m[1]
+			c.setCode(lines, docStart(lines, i)+1, end+1)
+			return
+		}
+	}
+	c.setCode(lines, max(1, line-contextLines), min(len(lines), line+contextLines))
+}
+
+// findDefinition looks for the declaration of name, preferring one whose line or file mentions
+// the qualifier
+func (c *Context) findDefinition(root string, files []string, name, qualifier string) error {
+	def := regexp.MustCompile(definitionPrefix + regexp.QuoteMeta(name) + `\b`)
+	type candidate struct {
+		file  string
+		lines []string
+		index int
+		score int
+	}
+	var best *candidate
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil || !strings.Contains(string(data), name) {
+			continue
+		}
+		lines := splitLines(string(data))
+		for i, l := range lines {
+			if !def.MatchString(l) {
+				continue
+			}
+			score := 1
+			if qualifier != "" && strings.Contains(l, qualifier) {
+				score = 3
+			} else if qualifier != "" && strings.Contains(string(data), qualifier) {
+				score = 2
+			}
+			if best == nil || score > best.score {
+				best = &candidate{file, lines, i, score}
+			}
+		}
+	}
+	if best == nil {
+		return fmt.Errorf("no definition of %s found", name)
+	}
+	c.Symbol = name
+	c.File = relative(root, best.file)
+	end := blockEnd(best.lines, best.index, best.file)
+	c.setCode(best.lines, docStart(best.lines, best.index)+1, end+1)
+	return nil
+}
+
+// findReferences lists the lines that mention name outside the explained code
+func (c *Context) findReferences(root string, files []string, name string) {
+	word := regexp.MustCompile(`(^|[^\w$])` + regexp.QuoteMeta(name) + `($|[^\w$])`)
+	c.scan(root, files, func(file string, n int, text string) bool {
+		if file == c.File && n >= c.StartLine && n <= c.EndLine {
+			return false
+		}
+		return word.MatchString(text)
+	})
+}
+
+// findImporters lists the import lines of other files that name the file's package or module
+func (c *Context) findImporters(root string, files []string, full string) {
+	name := strings.TrimSuffix(filepath.Base(full), filepath.Ext(full))
+	if filepath.Ext(full) == ".go" {
+		// Go imports name the package directory; the root package is not imported
+		if relative(root, filepath.Dir(full)) == "." {
+			return
+		}
+		name = filepath.Base(filepath.Dir(full))
+	}
+	word := regexp.MustCompile(`[/"'.\s]` + regexp.QuoteMeta(name) + `(?:\.\w+)?['"\s;]|[/"'.\s]` + regexp.QuoteMeta(name) + `$`)
+	c.scan(root, files, func(file string, n int, text string) bool {
+		return file != c.File && importLine.MatchString(text) && word.MatchString(text)
+	})
+}
+
+func (c *Context) scan(root string, files []string, match func(file string, line int, text string) bool) {
+	for _, full := range files {
+		data, err := os.ReadFile(full)
+		if err != nil {
+			continue
+		}
+		file := relative(root, full)
+		for i, text := range splitLines(string(data)) {
+			if !match(file, i+1, text) {
+				continue
+			}
+			if len(c.References) == maxReferences {
+				c.MoreRefs++
+				continue
+			}
+			c.References = append(c.References, Reference{File: file, Line: i + 1, Text: strings.TrimSpace(text)})
+		}
+	}
+}
+
+func (c *Context) setCode(lines []string, start, end int) {
+	if end-start+1 > maxCodeLines {
+		end = start + maxCodeLines - 1
+		c.Truncated = true
+	}
+	c.StartLine, c.EndLine = start, end
+	c.Code = strings.Join(lines[start-1:end], "\n")
+}
+
+// Prompt asks for a structured explanation of the gathered code
+func (c *Context) Prompt() string {
+	var b strings.Builder
+	subject := c.File
+	if c.Symbol != "" {
+		subject = fmt.Sprintf("`%s` in %s", c.Symbol, c.File)
+	} else if c.StartLine > 1 || c.Truncated {
+		subject = fmt.Sprintf("lines %d-%d of %s", c.StartLine, c.EndLine, c.File)
+	}
+	fmt.Fprintf(&b, "Explain %s. Structure the explanation with these sections:\n", subject)
+	b.WriteString("1. **Purpose**: what it is for, in two or three sentences\n")
+	b.WriteString("2. **How it works**: the main steps, citing line numbers\n")
+	b.WriteString("3. **Inputs, outputs and side effects**\n")
+	b.WriteString("4. **Dependencies**: what it relies on, from the imports below\n")
+	b.WriteString("5. **Usage**: who uses it and how, from the references below\n")
+	b.WriteString("6. **Caveats**: edge cases, error handling and anything surprising\n")
+	b.WriteString("The relevant code is included below; read other files only if something essential is missing, and do not change any files.\n")
+
+	fmt.Fprintf(&b, "\n### %s (lines %d-%d)\n```\n", c.File, c.StartLine, c.EndLine)
+	for i, line := range strings.Split(c.Code, "\n") {
+		fmt.Fprintf(&b, "%5d | %s\n", c.StartLine+i, line)
+	}
+	b.WriteString("```\n")
+	if c.Truncated {
+		b.WriteString("(continues beyond the lines shown)\n")
+	}
+
+	if len(c.Imports) > 0 {
+		fmt.Fprintf(&b, "\n### Imports of %s\n%s\n", c.File, strings.Join(c.Imports, "\n"))
+	}
+	if len(c.References) > 0 {
+		if c.Symbol != "" {
+			fmt.Fprintf(&b, "\n### References to %s\n", c.Symbol)
+		} else {
+			fmt.Fprintf(&b, "\n### Files importing %s\n", c.File)
+		}
+		for _, r := range c.References {
+			fmt.Fprintf(&b, "%s:%d: %s\n", r.File, r.Line, r.Text)
+		}
+		if c.MoreRefs > 0 {
+			fmt.Fprintf(&b, "... and %d more\n", c.MoreRefs)
+		}
+	} else {
+		b.WriteString("\nNo uses were found elsewhere in the project.\n")
+	}
+	return b.String()
+}
+
+// Summary describes what was gathered, e.g. "Server.Start in server.go:40-72, 6 imports, 3 references"
+func (c *Context) Summary() string {
+	what := c.File
+	if c.Symbol != "" {
+		what = c.Symbol + " in " + c.File
+	}
+	refs := len(c.References) + c.MoreRefs
+	return fmt.Sprintf("%s:%d-%d, %d imports, %d reference(s)", what, c.StartLine, c.EndLine, len(c.Imports), refs)
+}
+
+// blockEnd returns the index of the last line of the definition starting at start: the indented
+// block for Python, otherwise up to the brace closing the first one opened
+func blockEnd(lines []string, start int, file string) int {
+	if filepath.Ext(file) == ".py" {
+		indent := indentation(lines[start])
+		end := start
+		for i := start + 1; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "" {
+				continue
+			}
+			if indentation(lines[i]) <= indent {
+				break
+			}
+			end = i
+		}
+		return end
+	}
+
+	depth, opened := 0, false
+	for i := start; i < len(lines) && i < start+maxCodeLines*5; i++ {
+		for _, r := range stripStrings(lines[i]) {
+			switch r {
+			case '{':
+				depth++
+				opened = true
+			case '}':
+				depth--
+			}
+		}
+		if opened && depth <= 0 {
+			return i
+		}
+		if !opened && i-start >= 3 {
+			// A declaration without a body, e.g. a type alias or constant
+			return start
+		}
+	}
+	if !opened {
+		return start
+	}
+	return min(len(lines)-1, start+maxCodeLines*5)
+}
+
+// docStart extends a definition upwards over the comment lines directly above it
+func docStart(lines []string, start int) int {
+	for i := start - 1; i >= 0 && start-i <= maxDocLines; i-- {
+		if !commentStart.MatchString(lines[i]) {
+			return i + 1
+		}
+	}
+	return max(0, start-maxDocLines)
+}
+
+// stripStrings removes string and rune literals and line comments, so braces inside them are not counted
+func stripStrings(line string) string {
+	var b strings.Builder
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if escaped {
+				escaped = false
+			} else if r == '\\' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '/' && strings.HasPrefix(line[i:], "//"):
+			return b.String()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// imports lists what a source file imports; content is read from path when empty
+func imports(path, content string) []string {
+	if content == "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		content = string(data)
+	}
+	var list []string
+	switch filepath.Ext(path) {
+	case ".go":
+		file, err := parser.ParseFile(token.NewFileSet(), path, content, parser.ImportsOnly)
+		if err != nil {
+			return nil
+		}
+		for _, spec := range file.Imports {
+			if p, err := strconv.Unquote(spec.Path.Value); err == nil {
+				list = append(list, p)
+			}
+		}
+	case ".py":
+		for _, m := range pyImport.FindAllStringSubmatch(content, -1) {
+			if m[1] != "" {
+				list = append(list, m[1])
+			} else {
+				for _, part := range strings.Split(m[2], ",") {
+					if fields := strings.Fields(part); len(fields) > 0 {
+						list = append(list, fields[0])
+					}
+				}
+			}
+		}
+	case ".rs":
+		for _, m := range rustImport.FindAllStringSubmatch(content, -1) {
+			list = append(list, strings.Join(strings.Fields(m[1]), " "))
+		}
+	case ".c", ".h", ".cpp", ".cc", ".hpp":
+		for _, m := range cImport.FindAllStringSubmatch(content, -1) {
+			list = append(list, m[1])
+		}
+	case ".java", ".kt":
+		for _, m := range javaImport.FindAllStringSubmatch(content, -1) {
+			list = append(list, m[1])
+		}
+	default:
+		for _, line := range splitLines(content) {
+			if m := jsImport.FindStringSubmatch(line); m != nil {
+				list = append(list, m[1])
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	unique := list[:0]
+	for _, imp := range list {
+		if imp != "" && !seen[imp] {
+			seen[imp] = true
+			unique = append(unique, imp)
+		}
+	}
+	if len(unique) > maxImports {
+		unique = append(unique[:maxImports], fmt.Sprintf("... and %d more", len(unique)-maxImports))
+	}
+	return unique
+}
+
+// sourceFiles lists the source files under root, sorted
+func sourceFiles(root string) []string {
+	var files []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (skipDirs[d.Name()] || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(files) >= maxScannedFiles {
+			return filepath.SkipAll
+		}
+		if sourceExts[filepath.Ext(path)] {
+			if info, err := d.Info(); err == nil && info.Size() <= maxFileBytes {
+				files = append(files, path)
+			}
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+func splitLines(content string) []string {
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+func resolve(root, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(root, path)
+}
+
+func relative(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
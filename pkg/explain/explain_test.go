@@ -0,0 +1,107 @@
+package explain
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var project = map[string]string{
+	"go.mod": "module example.com/app\n",
+	"store/store.go": `package store
+
+import (
+	"errors"
+	"strings"
+)
+
+// Store keeps values by key
+type Store struct{ values map[string]string }
+
+// Get returns the value of a key
+func (s *Store) Get(key string) (string, error) {
+	if v, ok := s.values[strings.ToLower(key)]; ok {
+		return v, nil
+	}
+	return "", errors.New("not found: {key}")
+}
+
+func helper() {}
+`,
+	"main.go": `package main
+
+import "example.com/app/store"
+
+func main() {
+	s := &store.Store{}
+	s.Get("a")
+}
+`,
+}
+
+func TestGatherSymbol(t *testing.T) {
+	root := writeFiles(t, project)
+	c, err := Gather(root, "Store.Get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.File != filepath.Join("store", "store.go") || c.Symbol != "Get" || c.StartLine != 11 || c.EndLine != 17 {
+		t.Fatalf("Gather() = %s %s:%d-%d, want Get in store/store.go:11-17 with its doc comment", c.Symbol, c.File, c.StartLine, c.EndLine)
+	}
+	if strings.Join(c.Imports, ",") != "errors,strings" {
+		t.Errorf("Imports = %v", c.Imports)
+	}
+	if len(c.References) != 1 || c.References[0].File != "main.go" || c.References[0].Line != 7 {
+		t.Errorf("References = %+v, want the call in main.go", c.References)
+	}
+
+	prompt := c.Prompt()
+	for _, want := range []string{"Explain `Get` in store", "**Purpose**", "   12 | func (s *Store) Get", "main.go:7: s.Get(\"a\")"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+
+	if _, err := Gather(root, "Missing"); err == nil {
+		t.Error("an unknown symbol should fail")
+	}
+}
+
+func TestGatherFile(t *testing.T) {
+	root := writeFiles(t, project)
+
+	// A line inside a function explains the whole function
+	c, err := Gather(root, "store/store.go:14")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Symbol != "Get" || c.StartLine != 11 || c.EndLine != 17 {
+		t.Errorf("Gather(store.go:14) = %s:%d-%d, want Get at 11-17", c.Symbol, c.StartLine, c.EndLine)
+	}
+
+	c, err = Gather(root, "store/store.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Symbol != "" || c.StartLine != 1 || c.EndLine != 19 {
+		t.Errorf("Gather(store.go) = %q %d-%d, want the whole file", c.Symbol, c.StartLine, c.EndLine)
+	}
+	if len(c.References) != 1 || c.References[0].Text != `import "example.com/app/store"` {
+		t.Errorf("References = %+v, want the import in main.go", c.References)
+	}
+}
@@ -0,0 +1,64 @@
+package i18n
+
+// german translates the English catalog. The answer keys in prompts (y, n, s, a, b, l) stay the
+// same in every language.
+var german = map[string]string{
+	// Startup and the interactive prompt
+	"startup.connected":    "MCode CLI %s - Verbunden mit %s",
+	"startup.model":        "Modell: %s (%s)",
+	"startup.query":        "Anfrage: %s",
+	"startup.devcontainer": "💡 Devcontainer-Konfiguration gefunden; mit /devcontainer on laufen Tools darin",
+	"startup.enter":        "Nachricht eingeben ('/help' für Befehle, '#Anweisung' für dauerhafte Anweisungen, 'exit' zum Beenden):",
+	"prompt.auto_approve":  "[Änderungen automatisch freigeben: %s]",
+	"prompt.on":            "An",
+	"prompt.off":           "Aus",
+	"prompt.quit_hint":     "(Erneut Strg+C drücken oder /exit eingeben zum Beenden)",
+	"prompt.cancelled":     "❌ Vorgang abgebrochen",
+	"error":                "Fehler: %v",
+
+	// Permanent instructions
+	"instruction.missing":     "❌ Bitte nach # eine Anweisung angeben",
+	"instruction.adding":      "💾 Dauerhafte Anweisung wird hinzugefügt: %s",
+	"instruction.save_failed": "Fehler beim Speichern der Anweisung: %v",
+	"instruction.saved":       "✅ Dauerhafte Anweisung in AGENTS.md gespeichert",
+
+	// Approval prompts
+	"approval.web_search":          "🌐 Zugriff auf die Websuche angefragt",
+	"approval.web_search.prompt":   "❓ Darf der Agent die öffentliche Websuche nach aktuellen Informationen abfragen? (Y/n/Esc zum Abbrechen): ",
+	"approval.web_fetch":           "🌐 Webzugriff angefragt: %s",
+	"approval.web_fetch.prompt":    "❓ Tool-Zugriff auf diese Domain und ihre Subdomains erlauben? (Y/n/Esc zum Abbrechen): ",
+	"approval.folder":              "🔒 Ordnerzugriff angefragt: %s",
+	"approval.folder.prompt":       "❓ Tool-Zugriff auf diesen Ordner und alle Unterordner erlauben? Das umfasst Lesen, Suchen und Vorschauen; Änderungen an Dateien brauchen Schreibzugriff. (Y/n/l zeigt den Inhalt/Esc zum Abbrechen): ",
+	"approval.write_folder":        "✏️  Schreibzugriff angefragt: %s",
+	"approval.write_folder.prompt": "❓ Tools erlauben, Dateien in diesem Ordner und allen Unterordnern zu ändern? (Y/n/Esc zum Abbrechen): ",
+	"approval.requested_by":        "   Angefragt von: %s",
+	"approval.continue":            "❓ An der abgebrochenen Stelle weiter generieren? (Y/n): ",
+	"approval.tool":                "❓ Dieses Tool ausführen? (Y/n/s überspringen/a immer erlauben/Esc zum Abbrechen): ",
+	"approval.tool.background":     "❓ Dieses Tool ausführen? (Y/n/s überspringen/a immer erlauben/Esc zum Abbrechen/b im Hintergrund): ",
+	"approval.tool.edit":           "❓ Dieses Tool ausführen? (Y/n/s überspringen/a immer erlauben/Esc zum Abbrechen/⇥/Strg+T Änderungen automatisch freigeben [%s]): ",
+	"approval.always.save":         "💾 %s auch in der Konfiguration für spätere Sitzungen merken? (y/N): ",
+	"approval.long_running":        "⚠️  Das sieht nach einem lang laufenden Befehl aus!",
+	"approval.plan":                "📋 Plan: %d Tool-Aufrufe",
+	"approval.plan.prompt":         "❓ Die %d sicheren Schritte ohne Nachfrage ausführen? Schritte mit Änderungen werden weiterhin einzeln bestätigt. (y/N/Esc zum Abbrechen): ",
+	"approval.injection":           "🛡️  Mögliche Prompt-Injection im Ergebnis von %s:",
+	"approval.injection.prompt":    "❓ Dieses Ergebnis an das Modell weitergeben? Es wird als nicht vertrauenswürdig markiert (y/N): ",
+
+	// Spoken notifications
+	"speech.web_search":   "mcode möchte im Web suchen.",
+	"speech.web_fetch":    "mcode möchte Seiten von %s abrufen.",
+	"speech.folder":       "mcode bittet um Zugriff auf den Ordner %s.",
+	"speech.write_folder": "mcode möchte Dateien im Ordner %s ändern.",
+	"speech.continue":     "Die Antwort wurde abgeschnitten. Soll mcode weitermachen?",
+	"speech.tool":         "mcode braucht eine Freigabe für %s.",
+	"speech.plan":         "mcode hat einen Plan mit %d Schritten, der auf Freigabe wartet.",
+
+	// Slash commands
+	"command.goodbye":   "👋 Auf Wiedersehen!",
+	"command.unknown":   "❌ Unbekannter Befehl: %s",
+	"command.available": "Verfügbare Befehle: %s",
+
+	// Tools
+	"tool.executing":      "Ausführen%s: %s",
+	"tool.interrupt_hint": "(Strg+C/Esc unterbricht, falls es hängt)",
+	"tool.background":     "Wird im Hintergrund gestartet: %s",
+}
@@ -0,0 +1,64 @@
+package i18n
+
+// english is the reference catalog: every key has a message here, and the other catalogs are
+// translations of it
+var english = map[string]string{
+	// Startup and the interactive prompt
+	"startup.connected":    "MCode CLI %s - Connected to %s",
+	"startup.model":        "Model: %s (%s)",
+	"startup.query":        "Query: %s",
+	"startup.devcontainer": "💡 Found a devcontainer config; use /devcontainer on to run tools inside it",
+	"startup.enter":        "Enter your message (type '/help' for commands, '#instruction' for permanent memory, 'exit' to quit):",
+	"prompt.auto_approve":  "[Auto-approve edits: %s]",
+	"prompt.on":            "On",
+	"prompt.off":           "Off",
+	"prompt.quit_hint":     "(Press Ctrl+C again or type /exit to quit)",
+	"prompt.cancelled":     "❌ Operation cancelled",
+	"error":                "Error: %v",
+
+	// Permanent instructions
+	"instruction.missing":     "❌ Please provide an instruction after #",
+	"instruction.adding":      "💾 Adding permanent instruction: %s",
+	"instruction.save_failed": "Error saving instruction: %v",
+	"instruction.saved":       "✅ Permanent instruction saved to AGENTS.md",
+
+	// Approval prompts
+	"approval.web_search":          "🌐 Request web search access",
+	"approval.web_search.prompt":   "❓ Allow the agent to query the public web search backend for current information? (Y/n/Esc to cancel): ",
+	"approval.web_fetch":           "🌐 Request web fetch access: %s",
+	"approval.web_fetch.prompt":    "❓ Allow tool access to this domain and its subdomains? (Y/n/Esc to cancel): ",
+	"approval.folder":              "🔒 Request folder access: %s",
+	"approval.folder.prompt":       "❓ Allow tool access in this folder and all subfolders? This covers reading, searching and previews; changing files needs write access. (Y/n/l to list its contents/Esc to cancel): ",
+	"approval.write_folder":        "✏️  Request write access: %s",
+	"approval.write_folder.prompt": "❓ Allow tools to change files in this folder and all subfolders? (Y/n/Esc to cancel): ",
+	"approval.requested_by":        "   Requested by: %s",
+	"approval.continue":            "❓ Continue generating from where it stopped? (Y/n): ",
+	"approval.tool":                "❓ Execute this tool? (Y/n/s to skip/a to always allow/Esc to cancel): ",
+	"approval.tool.background":     "❓ Execute this tool? (Y/n/s to skip/a to always allow/Esc to cancel/b for background): ",
+	"approval.tool.edit":           "❓ Execute this tool? (Y/n/s to skip/a to always allow/Esc to cancel/⇥/Ctrl+T Auto-approve edits [%s]): ",
+	"approval.always.save":         "💾 Also remember %s in the config for later sessions? (y/N): ",
+	"approval.long_running":        "⚠️  This looks like a long-running command!",
+	"approval.plan":                "📋 Plan: %d tool calls",
+	"approval.plan.prompt":         "❓ Run the %d safe step(s) without asking? Destructive steps are still confirmed one by one. (y/N/Esc to cancel): ",
+	"approval.injection":           "🛡️  Possible prompt injection in the %s result:",
+	"approval.injection.prompt":    "❓ Pass this result to the model? It will be marked as untrusted (y/N): ",
+
+	// Spoken notifications
+	"speech.web_search":   "mcode asks to search the web.",
+	"speech.web_fetch":    "mcode asks to fetch pages from %s.",
+	"speech.folder":       "mcode asks for access to the folder %s.",
+	"speech.write_folder": "mcode asks to change files in the folder %s.",
+	"speech.continue":     "The response was cut off. Should mcode continue?",
+	"speech.tool":         "mcode needs approval to run %s.",
+	"speech.plan":         "mcode has a plan of %d steps waiting for approval.",
+
+	// Slash commands
+	"command.goodbye":   "👋 Goodbye!",
+	"command.unknown":   "❌ Unknown command: %s",
+	"command.available": "Available commands: %s",
+
+	// Tools
+	"tool.executing":      "Executing%s: %s",
+	"tool.interrupt_hint": "(Press Ctrl+C/Esc to interrupt if it hangs)",
+	"tool.background":     "Starting in background: %s",
+}
@@ -0,0 +1,94 @@
+// Package i18n translates the messages mcode shows to the user. Messages are looked up by key in
+// the catalog of the selected locale and fall back to English, so a catalog can be partial.
+// Text sent to the model is not translated.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultLocale is used when no supported locale is configured
+const DefaultLocale = "en"
+
+// catalogs holds the messages of each supported locale by key
+var catalogs = map[string]map[string]string{
+	"en": english,
+	"de": german,
+}
+
+var locale atomic.Value
+
+// Detect returns the locale asked for: the configured one, else the first of MCODE_LANG, LC_ALL,
+// LC_MESSAGES and LANG that is set
+func Detect(configured string) string {
+	for _, tag := range []string{configured, os.Getenv("MCODE_LANG"), os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")} {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			return tag
+		}
+	}
+	return DefaultLocale
+}
+
+// SetLocale selects the catalog for a locale such as "de", "de-AT" or "de_DE.UTF-8" and returns
+// the locale used, which is DefaultLocale when there is no catalog for it
+func SetLocale(tag string) string {
+	resolved := resolve(tag)
+	locale.Store(resolved)
+	return resolved
+}
+
+// Locale returns the selected locale
+func Locale() string {
+	if l, ok := locale.Load().(string); ok {
+		return l
+	}
+	return DefaultLocale
+}
+
+// Supported lists the locales that have a catalog
+func Supported() []string {
+	var locales []string
+	for l := range catalogs {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// T returns the message for key in the selected locale, formatted with args like fmt.Sprintf.
+// Keys missing from the catalog fall back to English, and unknown keys are returned as they are.
+func T(key string, args ...interface{}) string {
+	message, ok := catalogs[Locale()][key]
+	if !ok {
+		message, ok = english[key]
+	}
+	if !ok {
+		message = key
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// resolve maps a locale tag to a catalog: the full tag if there is one for it, else its language
+func resolve(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, ".@"); i >= 0 {
+		tag = tag[:i] // Encoding and modifier, as in de_DE.UTF-8@euro
+	}
+	tag = strings.ReplaceAll(tag, "-", "_")
+	if _, ok := catalogs[tag]; ok {
+		return tag
+	}
+	if language, _, found := strings.Cut(tag, "_"); found {
+		if _, ok := catalogs[language]; ok {
+			return language
+		}
+	}
+	return DefaultLocale
+}
@@ -0,0 +1,68 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// verbs matches the fmt verbs of a message
+var verbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestCatalogsMatchEnglish(t *testing.T) {
+	for locale, catalog := range catalogs {
+		for key, message := range catalog {
+			reference, ok := english[key]
+			if !ok {
+				t.Errorf("%s: key %q is not in the English catalog", locale, key)
+				continue
+			}
+			if got, want := verbs.FindAllString(message, -1), verbs.FindAllString(reference, -1); !slices.Equal(got, want) {
+				t.Errorf("%s: %q has verbs %v, the English message has %v", locale, key, got, want)
+			}
+		}
+	}
+}
+
+func TestSetLocale(t *testing.T) {
+	defer SetLocale(DefaultLocale)
+
+	tests := map[string]string{
+		"de":               "de",
+		"de-AT":            "de",
+		"de_DE.UTF-8@euro": "de",
+		"EN_us":            "en",
+		"fr_FR.UTF-8":      "en",
+		"C":                "en",
+	}
+	for tag, want := range tests {
+		if got := SetLocale(tag); got != want {
+			t.Errorf("SetLocale(%q) = %q, want %q", tag, got, want)
+		}
+	}
+
+	SetLocale("de")
+	if got := T("command.unknown", "/foo"); got != "❌ Unbekannter Befehl: /foo" {
+		t.Errorf("got %q", got)
+	}
+	if got := T("no.such.key"); got != "no.such.key" {
+		t.Errorf("unknown keys should be returned as they are, got %q", got)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Setenv("MCODE_LANG", "")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "de_DE.UTF-8")
+	if got := Detect(""); got != "de_DE.UTF-8" {
+		t.Errorf("expected LANG to be used, got %q", got)
+	}
+	t.Setenv("MCODE_LANG", "en")
+	if got := Detect(""); got != "en" {
+		t.Errorf("expected MCODE_LANG to override LANG, got %q", got)
+	}
+	if got := Detect("de"); got != "de" {
+		t.Errorf("expected the configured locale to win, got %q", got)
+	}
+}
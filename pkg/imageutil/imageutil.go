@@ -0,0 +1,125 @@
+package imageutil
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register GIF decoding
+	"image/jpeg"
+	_ "image/png" // register PNG decoding
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// MaxDimension is the longest edge an image is scaled down to before it is sent to a model
+	MaxDimension = 1568
+	// maxPassthroughBytes is the largest image sent unchanged; bigger ones are re-encoded as JPEG
+	maxPassthroughBytes = 1 << 20
+	jpegQuality         = 85
+)
+
+// imageExtensions lists the file types treated as images
+var imageExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true,
+}
+
+// IsImagePath reports whether a file name has an image extension
+func IsImagePath(path string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// Prepare downscales an image so its longest edge is at most MaxDimension and keeps the payload small.
+// It returns the MIME type and bytes to send together with the resulting dimensions.
+func Prepare(data []byte) (string, []byte, int, int, error) {
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", nil, 0, 0, fmt.Errorf("not an image (detected %s)", mimeType)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		// Formats the standard library cannot decode (e.g. WebP) are passed through when small enough
+		if len(data) <= maxPassthroughBytes {
+			return mimeType, data, 0, 0, nil
+		}
+		return "", nil, 0, 0, fmt.Errorf("cannot decode %s image: %v", mimeType, err)
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= MaxDimension && height <= MaxDimension && len(data) <= maxPassthroughBytes {
+		return mimeType, data, width, height, nil
+	}
+
+	if width > MaxDimension || height > MaxDimension {
+		img = downscale(img, MaxDimension)
+		width, height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+
+	// JPEG has no alpha channel, so transparent areas are flattened onto white
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return "", nil, 0, 0, fmt.Errorf("failed to encode image: %v", err)
+	}
+	return "image/jpeg", buf.Bytes(), width, height, nil
+}
+
+// downscale shrinks img so its longest edge equals maxDim, averaging the source pixels each target pixel covers
+func downscale(img image.Image, maxDim int) image.Image {
+	src := img.Bounds()
+	sw, sh := src.Dx(), src.Dy()
+
+	dw, dh := maxDim, sh*maxDim/sw
+	if sh > sw {
+		dw, dh = sw*maxDim/sh, maxDim
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0 := src.Min.Y + y*sh/dh
+		y1 := src.Min.Y + (y+1)*sh/dh
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0 := src.Min.X + x*sw/dw
+			x1 := src.Min.X + (x+1)*sw/dw
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,68 @@
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestPrepareKeepsSmallImages(t *testing.T) {
+	data := encodePNG(t, 200, 100)
+
+	mimeType, out, width, height, err := Prepare(data)
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	if mimeType != "image/png" || !bytes.Equal(out, data) {
+		t.Errorf("expected small PNG to pass through unchanged, got %s (%d bytes)", mimeType, len(out))
+	}
+	if width != 200 || height != 100 {
+		t.Errorf("dimensions = %dx%d, want 200x100", width, height)
+	}
+}
+
+func TestPrepareDownscalesLargeImages(t *testing.T) {
+	data := encodePNG(t, 3136, 1000)
+
+	mimeType, out, width, height, err := Prepare(data)
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	if mimeType != "image/jpeg" {
+		t.Errorf("mimeType = %s, want image/jpeg", mimeType)
+	}
+	if width != MaxDimension || height != 500 {
+		t.Errorf("dimensions = %dx%d, want %dx500", width, height, MaxDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("output is not a decodable image: %v", err)
+	}
+	if img.Bounds().Dx() != width || img.Bounds().Dy() != height {
+		t.Errorf("encoded size %v does not match reported %dx%d", img.Bounds(), width, height)
+	}
+}
+
+func TestPrepareRejectsNonImages(t *testing.T) {
+	if _, _, _, _, err := Prepare([]byte("package main\n")); err == nil {
+		t.Error("expected an error for non-image data")
+	}
+}
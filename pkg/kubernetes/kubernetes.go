@@ -0,0 +1,155 @@
+// Package kubernetes runs commands inside a pod's container through kubectl exec
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"coding-agent/pkg/types"
+)
+
+// Options selects the pod and container commands run in
+type Options struct {
+	Pod         string // Pod name; empty to pick a running pod matching Selector
+	Selector    string // Label selector, e.g. "app=dev-env"
+	Namespace   string
+	Container   string
+	Context     string // kubeconfig context; empty uses the current one
+	Workdir     string // Directory commands start in; empty uses the container's default
+	RemoteFiles bool   // Also read and write files in the pod instead of on the host
+}
+
+// ParseArgs parses `<pod> [-l selector] [-n namespace] [-c container] [-w workdir] [--context name] [--files]`
+func ParseArgs(args []string) (Options, error) {
+	var opts Options
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--files" {
+			opts.RemoteFiles = true
+			continue
+		}
+
+		var field *string
+		switch arg {
+		case "-l", "--selector":
+			field = &opts.Selector
+		case "-n", "--namespace":
+			field = &opts.Namespace
+		case "-c", "--container":
+			field = &opts.Container
+		case "-w", "--workdir":
+			field = &opts.Workdir
+		case "--context":
+			field = &opts.Context
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return opts, fmt.Errorf("unknown option %s", arg)
+			}
+			if opts.Pod != "" {
+				return opts, fmt.Errorf("unexpected argument %s", arg)
+			}
+			opts.Pod = arg
+			continue
+		}
+		if i+1 >= len(args) {
+			return opts, fmt.Errorf("%s needs a value", arg)
+		}
+		i++
+		*field = args[i]
+	}
+
+	if opts.Pod == "" && opts.Selector == "" {
+		return opts, fmt.Errorf("a pod name or -l selector is required")
+	}
+	return opts, nil
+}
+
+// Attach checks that the pod is reachable and returns an exec target for it. hostDir is the
+// local project directory that opts.Workdir corresponds to.
+func Attach(ctx context.Context, opts Options, hostDir string) (*types.ExecTarget, error) {
+	if opts.Pod == "" {
+		pod, err := kubectl(ctx, opts, "get", "pods", "-l", opts.Selector, "--field-selector=status.phase=Running",
+			"-o", "jsonpath={.items[0].metadata.name}")
+		if err != nil {
+			return nil, err
+		}
+		if pod == "" {
+			return nil, fmt.Errorf("no running pod matches %s", opts.Selector)
+		}
+		opts.Pod = pod
+	}
+
+	prefix := ExecPrefix(opts)
+	// Run a trivial command so a wrong pod, container or missing shell is reported now
+	check := append(append([]string{}, prefix...), "true")
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, check[0], check[1:]...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("cannot exec into pod %s: %s", opts.Pod, errorText(err, &stderr))
+	}
+
+	name := "pod " + opts.Pod
+	if opts.Container != "" {
+		name += "/" + opts.Container
+	}
+	return &types.ExecTarget{
+		Name:        name,
+		Prefix:      prefix,
+		HostDir:     hostDir,
+		Workdir:     opts.Workdir,
+		RemoteFiles: opts.RemoteFiles,
+	}, nil
+}
+
+// ExecPrefix builds the kubectl exec command that runs a shell command in the pod. kubectl exec has
+// no working directory flag, so the shell changes into Workdir before evaluating the command,
+// which is passed as $0.
+func ExecPrefix(opts Options) []string {
+	prefix := append([]string{"kubectl"}, globalFlags(opts)...)
+	prefix = append(prefix, "exec", "-i", opts.Pod)
+	if opts.Container != "" {
+		prefix = append(prefix, "-c", opts.Container)
+	}
+	script := `eval "$0"`
+	if opts.Workdir != "" {
+		script = "cd " + shellQuote(opts.Workdir) + " && " + script
+	}
+	return append(prefix, "--", "sh", "-c", script)
+}
+
+func globalFlags(opts Options) []string {
+	var flags []string
+	if opts.Context != "" {
+		flags = append(flags, "--context", opts.Context)
+	}
+	if opts.Namespace != "" {
+		flags = append(flags, "-n", opts.Namespace)
+	}
+	return flags
+}
+
+func kubectl(ctx context.Context, opts Options, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "kubectl", append(globalFlags(opts), args...)...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("kubectl %s: %s", args[0], errorText(err, &stderr))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func errorText(err error, stderr *bytes.Buffer) string {
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return msg
+	}
+	return err.Error()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,50 @@
+package kubernetes
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	opts, err := ParseArgs([]string{"dev-0", "-n", "team", "-c", "tools", "-w", "/src/app", "--files"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Options{Pod: "dev-0", Namespace: "team", Container: "tools", Workdir: "/src/app", RemoteFiles: true}
+	if opts != want {
+		t.Errorf("ParseArgs() = %+v, want %+v", opts, want)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"-n", "team"},
+		{"dev-0", "-c"},
+		{"dev-0", "--bogus"},
+		{"dev-0", "dev-1"},
+	} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Errorf("ParseArgs(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestExecPrefix(t *testing.T) {
+	got := ExecPrefix(Options{Pod: "dev-0", Namespace: "team", Container: "tools", Workdir: "/src/it's"})
+	want := []string{"kubectl", "-n", "team", "exec", "-i", "dev-0", "-c", "tools", "--", "sh", "-c", `cd '/src/it'\''s' && eval "$0"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ExecPrefix() = %q, want %q", got, want)
+	}
+
+	// The script must run the command passed after it, from the working directory
+	dir := t.TempDir()
+	prefix := ExecPrefix(Options{Pod: "p", Workdir: dir})
+	script := prefix[len(prefix)-1]
+	output, err := exec.Command("sh", "-c", script, "pwd && echo \"$((1 + 2))\"").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != dir+"\n3\n" {
+		t.Errorf("script output = %q", output)
+	}
+}
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// CachedTokens returns the prompt tokens the provider served from its prompt cache, 0 when it
+// did not report any
+func CachedTokens(usage *openai.Usage) int {
+	if usage == nil || usage.PromptTokensDetails == nil {
+		return 0
+	}
+	return usage.PromptTokensDetails.CachedTokens
+}
+
+// cacheReadPattern matches the usage field Anthropic-style APIs and proxies report cache hits in
+var cacheReadPattern = regexp.MustCompile(`"cache_read_input_tokens"\s*:\s*(\d+)`)
+
+// cacheReadDoer picks up usage.cache_read_input_tokens, which go-openai does not decode, from
+// response bodies as the client reads them
+type cacheReadDoer struct {
+	base   openai.HTTPDoer
+	tokens atomic.Int64 // Latest value seen in the current response
+}
+
+func (d *cacheReadDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.base.Do(req)
+	if err == nil {
+		d.tokens.Store(0)
+		resp.Body = &cacheReadBody{ReadCloser: resp.Body, doer: d}
+	}
+	return resp, err
+}
+
+// take returns the cache reads seen since the last call
+func (d *cacheReadDoer) take() int {
+	return int(d.tokens.Swap(0))
+}
+
+type cacheReadBody struct {
+	io.ReadCloser
+	doer *cacheReadDoer
+	tail []byte // End of the previous read, in case the field is split between reads
+}
+
+func (b *cacheReadBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		window := append(b.tail, p[:n]...)
+		if matches := cacheReadPattern.FindAllSubmatch(window, -1); len(matches) > 0 {
+			if tokens, err := strconv.Atoi(string(matches[len(matches)-1][1])); err == nil {
+				b.doer.tokens.Store(int64(tokens))
+			}
+		}
+		b.tail = append(b.tail[:0], window[max(0, len(window)-64):]...)
+	}
+	return n, err
+}
@@ -35,6 +35,18 @@ func buildGenAIConfig(req Request) *genai.GenerateContentConfig {
 		},
 	}
 
+	if req.FrequencyPenalty != 0 {
+		config.FrequencyPenalty = genai.Ptr(req.FrequencyPenalty)
+	}
+	if req.PresencePenalty != 0 {
+		config.PresencePenalty = genai.Ptr(req.PresencePenalty)
+	}
+
+	if req.ResponseSchema != nil {
+		config.ResponseMIMEType = "application/json"
+		config.ResponseJsonSchema = req.ResponseSchema.Schema
+	}
+
 	if len(req.Tools) > 0 {
 		var functionDecls []*genai.FunctionDeclaration
 		for _, t := range req.Tools {
@@ -122,10 +134,27 @@ func (p *GeminiProvider) CreateCompletion(ctx context.Context, req Request) (*Re
 		Reasoning:        reasoning,
 		ThoughtSignature: thoughtSignature,
 		ToolCalls:        toolCalls,
+		Usage:            geminiUsage(resp.UsageMetadata),
 		FinishReason:     string(candidate.FinishReason),
 	}, nil
 }
 
+// geminiUsage converts Gemini usage metadata, including implicit and explicit cache hits
+func geminiUsage(meta *genai.GenerateContentResponseUsageMetadata) *openai.Usage {
+	if meta == nil {
+		return nil
+	}
+	usage := &openai.Usage{
+		PromptTokens:     int(meta.PromptTokenCount),
+		CompletionTokens: int(meta.CandidatesTokenCount + meta.ThoughtsTokenCount),
+		TotalTokens:      int(meta.TotalTokenCount),
+	}
+	if meta.CachedContentTokenCount > 0 {
+		usage.PromptTokensDetails = &openai.PromptTokensDetails{CachedTokens: int(meta.CachedContentTokenCount)}
+	}
+	return usage
+}
+
 func (p *GeminiProvider) CreateStream(ctx context.Context, req Request) (<-chan StreamResponse, error) {
 	config := buildGenAIConfig(req)
 
@@ -154,6 +183,7 @@ func (p *GeminiProvider) CreateStream(ctx context.Context, req Request) (<-chan
 					Reasoning:        reasoning,
 					ThoughtSignature: thoughtSignature,
 					ToolCalls:        toolCalls,
+					Usage:            geminiUsage(resp.UsageMetadata),
 					FinishReason:     string(candidate.FinishReason),
 				}
 			}
@@ -205,13 +235,21 @@ func convertToContent(m Message) *genai.Content {
 	if m.Role == openai.ChatMessageRoleTool {
 		var result map[string]any
 		json.Unmarshal([]byte(m.Content), &result)
-		content.Parts = []*genai.Part{
-			{
-				FunctionResponse: &genai.FunctionResponse{
-					Name:     m.Name,
-					Response: result,
-				},
-			},
+		response := &genai.FunctionResponse{
+			Name:     m.Name,
+			Response: result,
+		}
+		for _, img := range m.Images {
+			response.Parts = append(response.Parts, &genai.FunctionResponsePart{
+				InlineData: &genai.FunctionResponseBlob{MIMEType: img.MIMEType, Data: img.Data},
+			})
+		}
+		content.Parts = []*genai.Part{{FunctionResponse: response}}
+	} else {
+		for _, img := range m.Images {
+			content.Parts = append(content.Parts, &genai.Part{
+				InlineData: &genai.Blob{MIMEType: img.MIMEType, Data: img.Data},
+			})
 		}
 	}
 
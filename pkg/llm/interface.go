@@ -15,6 +15,13 @@ type Message struct {
 	Name             string
 	ToolCallID       string
 	ToolCalls        []openai.ToolCall
+	Images           []Image
+}
+
+// Image is an inline image attached to a message, e.g. produced by a tool
+type Image struct {
+	MIMEType string `json:"mime_type"`
+	Data     []byte `json:"data"`
 }
 
 // Request represents an LLM request
@@ -26,6 +33,24 @@ type Request struct {
 	MaxTokens   int
 	TopP        float32
 	Stream      bool
+
+	// FrequencyPenalty and PresencePenalty discourage repeating tokens; zero leaves the provider default
+	FrequencyPenalty float32
+	PresencePenalty  float32
+
+	// ResponseSchema requests JSON output matching a schema from providers that support it
+	ResponseSchema *ResponseSchema
+
+	// HostedTools are built-in tools run by the provider, e.g. "web_search_preview"; only the
+	// Responses API provider supports them
+	HostedTools []string
+}
+
+// ResponseSchema describes the JSON document a structured request must return
+type ResponseSchema struct {
+	Name   string
+	Schema map[string]interface{}
+	Strict bool // Every property required and no additional properties, as OpenAI strict mode demands
 }
 
 // Response represents a standardized LLM response
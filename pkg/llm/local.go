@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// LocalServer is an OpenAI-compatible inference server found running on this machine
+type LocalServer struct {
+	Name    string
+	BaseURL string
+	Models  []ModelInfo
+}
+
+// localServers are the default addresses of the common local inference servers
+var localServers = []LocalServer{
+	{Name: "LM Studio", BaseURL: "http://localhost:1234/v1"},
+	{Name: "Ollama", BaseURL: "http://localhost:11434/v1"},
+	{Name: "llama.cpp", BaseURL: "http://localhost:8080/v1"},
+	{Name: "vLLM", BaseURL: "http://localhost:8000/v1"},
+}
+
+// DetectLocalServers probes the default ports of LM Studio, Ollama, llama.cpp and vLLM and
+// returns the servers that answer with at least one model
+func DetectLocalServers(ctx context.Context) []LocalServer {
+	return detectServers(ctx, localServers)
+}
+
+func detectServers(ctx context.Context, candidates []LocalServer) []LocalServer {
+	results := make([]*LocalServer, len(candidates))
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			models, err := ListModels(ctx, candidate.BaseURL, "")
+			if err == nil && len(models) > 0 {
+				candidate.Models = models
+				results[i] = &candidate
+			}
+		}()
+	}
+	wg.Wait()
+
+	var servers []LocalServer
+	for _, server := range results {
+		if server != nil {
+			servers = append(servers, *server)
+		}
+	}
+	return servers
+}
+
+// Reachable reports whether a TCP connection to the endpoint's host can be opened.
+// It does not check that the server speaks the API, only that something is listening.
+func Reachable(baseURL string, timeout time.Duration) bool {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", host, timeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
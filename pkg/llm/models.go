@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelInfo describes a model as reported by an OpenAI-compatible /models endpoint
+type ModelInfo struct {
+	ID            string
+	ContextLength int
+}
+
+// modelListEntry covers the context length fields used by the common OpenAI-compatible servers
+type modelListEntry struct {
+	ID                  string `json:"id"`
+	ContextLength       int    `json:"context_length"`        // OpenRouter, LM Studio
+	MaxContextLength    int    `json:"max_context_length"`    // LM Studio /api/v0
+	LoadedContextLength int    `json:"loaded_context_length"` // LM Studio /api/v0
+	MaxModelLen         int    `json:"max_model_len"`         // vLLM
+	ContextWindow       int    `json:"context_window"`
+	TopProvider         *struct {
+		ContextLength int `json:"context_length"`
+	} `json:"top_provider,omitempty"` // OpenRouter
+}
+
+type modelListResponse struct {
+	Data []modelListEntry `json:"data"`
+}
+
+var (
+	modelCacheMu sync.Mutex
+	modelCache   = make(map[string][]ModelInfo)
+)
+
+// contextLength picks the most specific context length reported for a model.
+// A loaded context length wins over the maximum since it is what the server will actually accept.
+func (e modelListEntry) contextLength() int {
+	for _, v := range []int{e.LoadedContextLength, e.MaxModelLen, e.ContextLength, e.MaxContextLength, e.ContextWindow} {
+		if v > 0 {
+			return v
+		}
+	}
+	if e.TopProvider != nil {
+		return e.TopProvider.ContextLength
+	}
+	return 0
+}
+
+// ListModels queries the /models endpoint of an OpenAI-compatible server.
+// LM Studio only reports context lengths on its native API, so that is consulted as a fallback.
+func ListModels(ctx context.Context, baseURL, apiKey string) ([]ModelInfo, error) {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		return nil, fmt.Errorf("base URL is required")
+	}
+
+	models, err := fetchModelList(ctx, baseURL+"/models", apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasContextLengths(models) && strings.HasSuffix(baseURL, "/v1") {
+		nativeURL := strings.TrimSuffix(baseURL, "/v1") + "/api/v0/models"
+		if native, err := fetchModelList(ctx, nativeURL, apiKey); err == nil && hasContextLengths(native) {
+			return native, nil
+		}
+	}
+
+	return models, nil
+}
+
+func fetchModelList(ctx context.Context, endpoint, apiKey string) ([]ModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("models request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("models request failed with status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read models response: %v", err)
+	}
+
+	var list modelListResponse
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse models response: %v", err)
+	}
+
+	models := make([]ModelInfo, 0, len(list.Data))
+	for _, entry := range list.Data {
+		models = append(models, ModelInfo{
+			ID:            entry.ID,
+			ContextLength: entry.contextLength(),
+		})
+	}
+	return models, nil
+}
+
+func hasContextLengths(models []ModelInfo) bool {
+	for _, m := range models {
+		if m.ContextLength > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CachedModels returns the models for an endpoint, querying it only the first time
+func CachedModels(ctx context.Context, baseURL, apiKey string) ([]ModelInfo, error) {
+	modelCacheMu.Lock()
+	models, ok := modelCache[baseURL]
+	modelCacheMu.Unlock()
+	if ok {
+		return models, nil
+	}
+
+	models, err := ListModels(ctx, baseURL, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	modelCacheMu.Lock()
+	modelCache[baseURL] = models
+	modelCacheMu.Unlock()
+	return models, nil
+}
+
+// LookupContextLength returns the context window the endpoint reports for a model, or 0 if unknown
+func LookupContextLength(baseURL, apiKey, modelName string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	models, err := CachedModels(ctx, baseURL, apiKey)
+	if err != nil {
+		return 0
+	}
+
+	for _, m := range models {
+		if m.ID == modelName {
+			return m.ContextLength
+		}
+	}
+	return 0
+}
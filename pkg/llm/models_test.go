@@ -0,0 +1,99 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListModelsContextLengths(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[
+			{"id":"openrouter/model","context_length":200000},
+			{"id":"vllm/model","max_model_len":32768},
+			{"id":"lmstudio/model","max_context_length":131072,"loaded_context_length":8192},
+			{"id":"plain/model"}
+		]}`))
+	}))
+	defer server.Close()
+
+	models, err := ListModels(context.Background(), server.URL+"/v1", "")
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+
+	want := map[string]int{
+		"openrouter/model": 200000,
+		"vllm/model":       32768,
+		"lmstudio/model":   8192,
+		"plain/model":      0,
+	}
+	if len(models) != len(want) {
+		t.Fatalf("ListModels() returned %d models, want %d", len(models), len(want))
+	}
+	for _, m := range models {
+		if m.ContextLength != want[m.ID] {
+			t.Errorf("context length for %s = %d, want %d", m.ID, m.ContextLength, want[m.ID])
+		}
+	}
+}
+
+func TestListModelsFallsBackToLMStudioNativeAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/models":
+			_, _ = w.Write([]byte(`{"data":[{"id":"qwen3-coder"}]}`))
+		case "/api/v0/models":
+			_, _ = w.Write([]byte(`{"data":[{"id":"qwen3-coder","max_context_length":262144}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	models, err := ListModels(context.Background(), server.URL+"/v1", "")
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if len(models) != 1 || models[0].ContextLength != 262144 {
+		t.Fatalf("expected native API context length, got %+v", models)
+	}
+}
+
+func TestDetectServers(t *testing.T) {
+	running := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":[{"id":"qwen3-coder"}]}`))
+	}))
+	defer running.Close()
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":[]}`))
+	}))
+	defer empty.Close()
+	stopped := httptest.NewServer(http.NotFoundHandler())
+	stoppedURL := stopped.URL
+	stopped.Close()
+
+	servers := detectServers(context.Background(), []LocalServer{
+		{Name: "stopped", BaseURL: stoppedURL + "/v1"},
+		{Name: "running", BaseURL: running.URL + "/v1"},
+		{Name: "empty", BaseURL: empty.URL + "/v1"},
+	})
+	if len(servers) != 1 || servers[0].Name != "running" || servers[0].Models[0].ID != "qwen3-coder" {
+		t.Errorf("detectServers() = %+v, want only the running server", servers)
+	}
+
+	if !Reachable(running.URL+"/v1", time.Second) {
+		t.Error("Reachable() = false for a running server")
+	}
+	if Reachable(stoppedURL+"/v1", time.Second) {
+		t.Error("Reachable() = true for a stopped server")
+	}
+}
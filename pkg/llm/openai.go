@@ -2,24 +2,57 @@ package llm
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"sync/atomic"
 
 	"github.com/sashabaranov/go-openai"
 )
 
 type OpenAIProvider struct {
-	client *openai.Client
+	client     *openai.Client
+	cacheReads *cacheReadDoer  // nil when the provider was given a client
+	retryAfter *retryAfterDoer // nil when the provider was given a client
+
+	// noStreamUsage is set once the server rejected stream_options, so usage is no longer asked for
+	noStreamUsage atomic.Bool
 }
 
 func NewOpenAIProvider(client *openai.Client) *OpenAIProvider {
 	return &OpenAIProvider{client: client}
 }
 
+// NewOpenAIProviderWithConfig creates a provider whose client also reports cache hits from
+// servers that put them in cache_read_input_tokens instead of prompt_tokens_details, and the
+// Retry-After delay of failed requests
+func NewOpenAIProviderWithConfig(config openai.ClientConfig) *OpenAIProvider {
+	cacheReads := &cacheReadDoer{base: config.HTTPClient}
+	retryAfter := &retryAfterDoer{base: cacheReads}
+	config.HTTPClient = retryAfter
+	return &OpenAIProvider{client: openai.NewClientWithConfig(config), cacheReads: cacheReads, retryAfter: retryAfter}
+}
+
+// withCacheReads fills in the cached prompt tokens picked up from the response body
+func (p *OpenAIProvider) withCacheReads(usage *openai.Usage) *openai.Usage {
+	if usage == nil || p.cacheReads == nil || CachedTokens(usage) > 0 {
+		return usage
+	}
+	if cached := p.cacheReads.take(); cached > 0 {
+		withCache := *usage
+		withCache.PromptTokensDetails = &openai.PromptTokensDetails{CachedTokens: cached}
+		return &withCache
+	}
+	return usage
+}
+
 func (p *OpenAIProvider) CreateCompletion(ctx context.Context, req Request) (*Response, error) {
 	resp, err := p.client.CreateChatCompletion(ctx, convertToOpenAIRequest(req))
 	if err != nil {
-		return nil, err
+		return nil, p.retryAfter.wrap(err)
 	}
 
 	if len(resp.Choices) == 0 {
@@ -30,15 +63,27 @@ func (p *OpenAIProvider) CreateCompletion(ctx context.Context, req Request) (*Re
 	return &Response{
 		Content:      choice.Message.Content,
 		ToolCalls:    choice.Message.ToolCalls,
-		Usage:        &resp.Usage,
+		Usage:        p.withCacheReads(&resp.Usage),
 		FinishReason: string(choice.FinishReason),
 	}, nil
 }
 
+// CreateStream streams a chat completion. The usage of the response is asked for with
+// stream_options.include_usage; servers that reject the option get the request again without it.
 func (p *OpenAIProvider) CreateStream(ctx context.Context, req Request) (<-chan StreamResponse, error) {
-	stream, err := p.client.CreateChatCompletionStream(ctx, convertToOpenAIRequest(req))
+	chatReq := convertToOpenAIRequest(req)
+	if !p.noStreamUsage.Load() {
+		chatReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	stream, err := p.client.CreateChatCompletionStream(ctx, chatReq)
+	if err != nil && chatReq.StreamOptions != nil && isBadRequest(err) {
+		chatReq.StreamOptions = nil
+		if stream, err = p.client.CreateChatCompletionStream(ctx, chatReq); err == nil {
+			p.noStreamUsage.Store(true)
+		}
+	}
 	if err != nil {
-		return nil, err
+		return nil, p.retryAfter.wrap(err)
 	}
 
 	out := make(chan StreamResponse)
@@ -62,9 +107,12 @@ func (p *OpenAIProvider) CreateStream(ctx context.Context, req Request) (<-chan
 				out <- StreamResponse{
 					Content:      choice.Delta.Content,
 					ToolCalls:    choice.Delta.ToolCalls,
-					Usage:        response.Usage,
+					Usage:        p.withCacheReads(response.Usage),
 					FinishReason: string(choice.FinishReason),
 				}
+			} else if response.Usage != nil {
+				// Usage often comes in a final chunk of its own
+				out <- StreamResponse{Usage: p.withCacheReads(response.Usage)}
 			}
 		}
 	}()
@@ -72,19 +120,61 @@ func (p *OpenAIProvider) CreateStream(ctx context.Context, req Request) (<-chan
 	return out, nil
 }
 
+// isBadRequest reports whether the server refused a request as invalid, as servers that do not know
+// a field do
+func isBadRequest(err error) bool {
+	code := StatusCode(err)
+	return code == http.StatusBadRequest || code == http.StatusUnprocessableEntity
+}
+
 func convertToOpenAIRequest(req Request) openai.ChatCompletionRequest {
 	var messages []openai.ChatCompletionMessage
-	for _, m := range req.Messages {
+	// Tool messages can only carry text, so their images follow in a user message once the
+	// run of tool results that answers an assistant turn is complete
+	var pendingImages []openai.ChatMessagePart
+	flushImages := func() {
+		if len(pendingImages) == 0 {
+			return
+		}
 		messages = append(messages, openai.ChatCompletionMessage{
+			Role:         openai.ChatMessageRoleUser,
+			MultiContent: pendingImages,
+		})
+		pendingImages = nil
+	}
+
+	for _, m := range req.Messages {
+		if m.Role != openai.ChatMessageRoleTool {
+			flushImages()
+		}
+
+		msg := openai.ChatCompletionMessage{
 			Role:       m.Role,
 			Content:    m.Content,
 			Name:       m.Name,
 			ToolCallID: m.ToolCallID,
 			ToolCalls:  m.ToolCalls,
-		})
+		}
+
+		if len(m.Images) > 0 {
+			if m.Role == openai.ChatMessageRoleTool {
+				pendingImages = append(pendingImages, openai.ChatMessagePart{
+					Type: openai.ChatMessagePartTypeText,
+					Text: fmt.Sprintf("Image output of the %s tool call:", m.Name),
+				})
+				pendingImages = append(pendingImages, imageParts(m.Images)...)
+			} else {
+				parts := []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: m.Content}}
+				msg.Content = ""
+				msg.MultiContent = append(parts, imageParts(m.Images)...)
+			}
+		}
+
+		messages = append(messages, msg)
 	}
+	flushImages()
 
-	return openai.ChatCompletionRequest{
+	chatReq := openai.ChatCompletionRequest{
 		Model:       req.Model,
 		Messages:    messages,
 		Tools:       req.Tools,
@@ -92,5 +182,42 @@ func convertToOpenAIRequest(req Request) openai.ChatCompletionRequest {
 		MaxTokens:   req.MaxTokens,
 		TopP:        req.TopP,
 		Stream:      req.Stream,
+
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
 	}
+
+	if req.ResponseSchema != nil {
+		chatReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   req.ResponseSchema.Name,
+				Schema: jsonSchema(req.ResponseSchema.Schema),
+				Strict: req.ResponseSchema.Strict,
+			},
+		}
+	}
+
+	return chatReq
+}
+
+// imageParts encodes images as data URL content parts
+func imageParts(images []Image) []openai.ChatMessagePart {
+	parts := make([]openai.ChatMessagePart, 0, len(images))
+	for _, img := range images {
+		parts = append(parts, openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{
+				URL: "data:" + img.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(img.Data),
+			},
+		})
+	}
+	return parts
+}
+
+// jsonSchema adapts a schema map to the json.Marshaler the OpenAI client expects
+type jsonSchema map[string]interface{}
+
+func (s jsonSchema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}(s))
 }
@@ -0,0 +1,192 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestConvertToOpenAIRequestImages(t *testing.T) {
+	img := Image{MIMEType: "image/png", Data: []byte("png")}
+	req := Request{
+		Model: "vision-model",
+		Messages: []Message{
+			{Role: openai.ChatMessageRoleUser, Content: "What is in these files?"},
+			{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "a"}, {ID: "b"}}},
+			{Role: openai.ChatMessageRoleTool, Name: "read_file", ToolCallID: "a", Content: "Image attached.", Images: []Image{img}},
+			{Role: openai.ChatMessageRoleTool, Name: "read_file", ToolCallID: "b", Content: "plain text"},
+			{Role: openai.ChatMessageRoleUser, Content: "Describe it", Images: []Image{img}},
+		},
+	}
+
+	messages := convertToOpenAIRequest(req).Messages
+	if len(messages) != 6 {
+		t.Fatalf("expected 6 messages, got %d", len(messages))
+	}
+
+	// Both tool results must directly follow the assistant turn, images afterwards
+	if messages[2].Role != openai.ChatMessageRoleTool || messages[3].Role != openai.ChatMessageRoleTool {
+		t.Fatalf("tool results were separated: %s, %s", messages[2].Role, messages[3].Role)
+	}
+	if len(messages[2].MultiContent) != 0 || messages[2].Content != "Image attached." {
+		t.Errorf("tool message should stay text-only, got %+v", messages[2])
+	}
+
+	imageMsg := messages[4]
+	if imageMsg.Role != openai.ChatMessageRoleUser || len(imageMsg.MultiContent) != 2 {
+		t.Fatalf("expected user message with caption and image, got %+v", imageMsg)
+	}
+	if url := imageMsg.MultiContent[1].ImageURL.URL; !strings.HasPrefix(url, "data:image/png;base64,") {
+		t.Errorf("unexpected image URL %q", url)
+	}
+
+	last := messages[5]
+	if last.Content != "" || len(last.MultiContent) != 2 || last.MultiContent[0].Text != "Describe it" {
+		t.Errorf("expected user text and image parts, got %+v", last)
+	}
+}
+
+func TestCacheReadDoer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"usage":{"prompt_tokens":1200,"cache_read_input_tokens":1024}}`)
+	}))
+	defer server.Close()
+
+	doer := &cacheReadDoer{base: http.DefaultClient}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := doer.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Read a few bytes at a time so the field is split between reads
+	buf := make([]byte, 7)
+	for {
+		if _, err := resp.Body.Read(buf); err != nil {
+			break
+		}
+	}
+	resp.Body.Close()
+
+	if got := doer.take(); got != 1024 {
+		t.Errorf("expected 1024 cache reads, got %d", got)
+	}
+	if got := doer.take(); got != 0 {
+		t.Errorf("take should reset the count, got %d", got)
+	}
+
+	usage := &openai.Usage{PromptTokens: 1200, PromptTokensDetails: &openai.PromptTokensDetails{CachedTokens: 512}}
+	if got := CachedTokens(usage); got != 512 {
+		t.Errorf("expected 512 cached tokens, got %d", got)
+	}
+	if got := CachedTokens(&openai.Usage{PromptTokens: 10}); got != 0 {
+		t.Errorf("expected 0 cached tokens without details, got %d", got)
+	}
+}
+
+func TestCreateStreamUsage(t *testing.T) {
+	var withOptions []bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			StreamOptions *struct {
+				IncludeUsage bool `json:"include_usage"`
+			} `json:"stream_options"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		withOptions = append(withOptions, body.StreamOptions != nil)
+		// The first request is refused, like servers that do not know the field do
+		if body.StreamOptions != nil && len(withOptions) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"message":"Unrecognized request argument: stream_options"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":42,\"completion_tokens\":3,\"total_tokens\":45}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("")
+	config.BaseURL = server.URL
+	provider := NewOpenAIProviderWithConfig(config)
+
+	for range 2 {
+		stream, err := provider.CreateStream(context.Background(), Request{Model: "m", Stream: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var usage *openai.Usage
+		for chunk := range stream {
+			if chunk.Error != nil {
+				t.Fatal(chunk.Error)
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+		}
+		if usage == nil || usage.PromptTokens != 42 || usage.CompletionTokens != 3 {
+			t.Errorf("expected the reported usage, got %+v", usage)
+		}
+	}
+
+	// Refused with the option, retried without it, and not asked for again
+	if want := []bool{true, false, false}; !slices.Equal(withOptions, want) {
+		t.Errorf("stream_options sent %v, want %v", withOptions, want)
+	}
+}
+
+func TestTransientErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimSuffix(r.URL.Path, "/chat/completions") {
+		case "/quota":
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"You exceeded your current quota","code":"insufficient_quota"}}`)
+		case "/invalid":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"message":"bad request"}}`)
+		default:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"Rate limit reached"}}`)
+		}
+	}))
+	defer server.Close()
+
+	request := func(path string) error {
+		config := openai.DefaultConfig("")
+		config.BaseURL = server.URL + path
+		_, err := NewOpenAIProviderWithConfig(config).CreateStream(context.Background(), Request{Model: "m", Stream: true})
+		return err
+	}
+
+	err := request("/rate")
+	if !IsTransient(err) || StatusCode(err) != http.StatusTooManyRequests {
+		t.Errorf("rate limit should be transient, got %v (status %d)", err, StatusCode(err))
+	}
+	if delay, ok := RetryAfter(err); !ok || delay != 7*time.Second {
+		t.Errorf("RetryAfter = %v, %v; want 7s", delay, ok)
+	}
+	if err := request("/quota"); IsTransient(err) {
+		t.Errorf("exhausted quota should not be transient: %v", err)
+	}
+	if err := request("/invalid"); IsTransient(err) {
+		t.Errorf("bad request should not be transient: %v", err)
+	}
+	if !IsTransient(fmt.Errorf("reading stream: %w", syscall.ECONNRESET)) {
+		t.Error("connection reset should be transient")
+	}
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	if d := parseRetryAfter("Thu, 01 Jan 2026 12:00:30 GMT", now); d != 30*time.Second {
+		t.Errorf("HTTP-date Retry-After = %v, want 30s", d)
+	}
+}
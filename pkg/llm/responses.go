@@ -0,0 +1,407 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultOpenAIBaseURL is used by the Responses provider when a model sets no base_url
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// ResponsesProvider talks to the OpenAI Responses API (/v1/responses), which some models need for
+// reasoning summaries and hosted tools. The conversation is sent in full with every request
+// (store: false), so the Chat loop works the same as with Chat Completions.
+type ResponsesProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewResponsesProvider creates a Responses API provider for an OpenAI-compatible base URL
+func NewResponsesProvider(baseURL, apiKey string) *ResponsesProvider {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	return &ResponsesProvider{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, client: http.DefaultClient}
+}
+
+// responsesRequest is the body of POST /responses
+type responsesRequest struct {
+	Model           string                   `json:"model"`
+	Input           []map[string]interface{} `json:"input"`
+	Tools           []map[string]interface{} `json:"tools,omitempty"`
+	MaxOutputTokens int                      `json:"max_output_tokens,omitempty"`
+	Temperature     *float32                 `json:"temperature,omitempty"`
+	TopP            *float32                 `json:"top_p,omitempty"`
+	Reasoning       map[string]interface{}   `json:"reasoning,omitempty"`
+	Text            map[string]interface{}   `json:"text,omitempty"`
+	Stream          bool                     `json:"stream,omitempty"`
+	Store           bool                     `json:"store"`
+}
+
+// responsesOutput is an item of a response's output
+type responsesOutput struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Content   []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Summary []struct {
+		Text string `json:"text"`
+	} `json:"summary"`
+}
+
+// responsesResult is a complete response, returned directly or in the last stream event
+type responsesResult struct {
+	Status            string            `json:"status"`
+	Output            []responsesOutput `json:"output"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+	Error *responsesError `json:"error"`
+	Usage *struct {
+		InputTokens        int `json:"input_tokens"`
+		OutputTokens       int `json:"output_tokens"`
+		TotalTokens        int `json:"total_tokens"`
+		InputTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
+		OutputTokensDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"output_tokens_details"`
+	} `json:"usage"`
+}
+
+type responsesError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// responsesEvent is a server-sent event of a streamed response
+type responsesEvent struct {
+	Type        string           `json:"type"`
+	Delta       string           `json:"delta"`
+	OutputIndex int              `json:"output_index"`
+	Item        *responsesOutput `json:"item"`
+	Response    *responsesResult `json:"response"`
+	Message     string           `json:"message"` // error events
+	Code        string           `json:"code"`
+}
+
+func (p *ResponsesProvider) CreateCompletion(ctx context.Context, req Request) (*Response, error) {
+	req.Stream = false
+	resp, err := p.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result responsesResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding the response: %v", err)
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("responses API error: %s", result.Error.Message)
+	}
+
+	out := &Response{Usage: result.usage(), FinishReason: result.finishReason()}
+	for _, item := range result.Output {
+		switch item.Type {
+		case "message":
+			for _, c := range item.Content {
+				if c.Type == "output_text" {
+					out.Content += c.Text
+				}
+			}
+		case "reasoning":
+			for _, s := range item.Summary {
+				out.Reasoning += s.Text
+			}
+		case "function_call":
+			out.ToolCalls = append(out.ToolCalls, openai.ToolCall{
+				ID:       item.CallID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			})
+		}
+	}
+	if len(out.ToolCalls) > 0 && out.FinishReason == "stop" {
+		out.FinishReason = "tool_calls"
+	}
+	return out, nil
+}
+
+func (p *ResponsesProvider) CreateStream(ctx context.Context, req Request) (<-chan StreamResponse, error) {
+	req.Stream = true
+	resp, err := p.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan StreamResponse)
+	go func() {
+		defer close(out)
+		defer resp.Body.Close()
+
+		// Function calls get consecutive tool call indexes in the order they appear in the output
+		callIndex := make(map[int]int)
+		hasArgDeltas := make(map[int]bool)
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue
+			}
+			data = strings.TrimSpace(data)
+			if data == "" || data == "[DONE]" {
+				continue
+			}
+			var event responsesEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				continue
+			}
+
+			switch event.Type {
+			case "response.output_text.delta":
+				out <- StreamResponse{Content: event.Delta}
+			case "response.reasoning_summary_text.delta", "response.reasoning_text.delta":
+				out <- StreamResponse{Reasoning: event.Delta}
+			case "response.reasoning_summary_part.done":
+				out <- StreamResponse{Reasoning: "\n\n"}
+			case "response.output_item.added":
+				if event.Item != nil && event.Item.Type == "function_call" {
+					index := len(callIndex)
+					callIndex[event.OutputIndex] = index
+					out <- StreamResponse{ToolCalls: []openai.ToolCall{{
+						Index:    &index,
+						ID:       event.Item.CallID,
+						Type:     openai.ToolTypeFunction,
+						Function: openai.FunctionCall{Name: event.Item.Name},
+					}}}
+				}
+			case "response.function_call_arguments.delta":
+				if index, ok := callIndex[event.OutputIndex]; ok {
+					hasArgDeltas[event.OutputIndex] = true
+					out <- StreamResponse{ToolCalls: []openai.ToolCall{{Index: &index, Function: openai.FunctionCall{Arguments: event.Delta}}}}
+				}
+			case "response.output_item.done":
+				// Servers that do not stream the arguments send them with the finished item
+				if index, ok := callIndex[event.OutputIndex]; ok && !hasArgDeltas[event.OutputIndex] && event.Item != nil {
+					out <- StreamResponse{ToolCalls: []openai.ToolCall{{Index: &index, Function: openai.FunctionCall{Arguments: event.Item.Arguments}}}}
+				}
+			case "response.completed", "response.incomplete":
+				if event.Response != nil {
+					reason := event.Response.finishReason()
+					if reason == "stop" && len(callIndex) > 0 {
+						reason = "tool_calls"
+					}
+					out <- StreamResponse{Usage: event.Response.usage(), FinishReason: reason}
+				}
+				return
+			case "response.failed":
+				message := "the response failed"
+				if event.Response != nil && event.Response.Error != nil {
+					message = event.Response.Error.Message
+				}
+				out <- StreamResponse{Error: fmt.Errorf("responses API error: %s", message)}
+				return
+			case "error":
+				out <- StreamResponse{Error: fmt.Errorf("responses API error: %s", event.Message)}
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			out <- StreamResponse{Error: err}
+		}
+	}()
+	return out, nil
+}
+
+// post sends a request and returns the response when the server accepted it
+func (p *ResponsesProvider) post(ctx context.Context, req Request) (*http.Response, error) {
+	body, err := json.Marshal(convertToResponsesRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/responses", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	if req.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var apiErr struct {
+			Error *responsesError `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != nil {
+			message = apiErr.Error.Message
+		}
+		return nil, &StatusError{
+			Code:       resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			Err:        fmt.Errorf("responses API error (status %d): %s", resp.StatusCode, message),
+		}
+	}
+	return resp, nil
+}
+
+// convertToResponsesRequest translates a request to the Responses API: system, user and assistant
+// messages become input messages, tool calls function_call items and tool results
+// function_call_output items
+func convertToResponsesRequest(req Request) responsesRequest {
+	r := responsesRequest{
+		Model:           req.Model,
+		MaxOutputTokens: req.MaxTokens,
+		Stream:          req.Stream,
+	}
+	if IsReasoningModel(req.Model) {
+		// Reasoning models reject sampling parameters; ask for summaries of their reasoning instead
+		r.Reasoning = map[string]interface{}{"summary": "auto"}
+	} else {
+		if req.Temperature != 0 {
+			r.Temperature = &req.Temperature
+		}
+		if req.TopP != 0 {
+			r.TopP = &req.TopP
+		}
+	}
+
+	// Like in Chat Completions, images from tool results follow the run of results in a user message
+	var pendingImages []map[string]interface{}
+	flushImages := func() {
+		if len(pendingImages) > 0 {
+			r.Input = append(r.Input, map[string]interface{}{"role": "user", "content": pendingImages})
+			pendingImages = nil
+		}
+	}
+	for _, m := range req.Messages {
+		if m.Role != openai.ChatMessageRoleTool {
+			flushImages()
+		}
+		switch m.Role {
+		case openai.ChatMessageRoleTool:
+			r.Input = append(r.Input, map[string]interface{}{"type": "function_call_output", "call_id": m.ToolCallID, "output": m.Content})
+			pendingImages = append(pendingImages, responsesImages(m.Images)...)
+		case openai.ChatMessageRoleAssistant:
+			if strings.TrimSpace(m.Content) != "" {
+				r.Input = append(r.Input, map[string]interface{}{"role": "assistant", "content": m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				r.Input = append(r.Input, map[string]interface{}{"type": "function_call", "call_id": tc.ID, "name": tc.Function.Name, "arguments": tc.Function.Arguments})
+			}
+		default:
+			if len(m.Images) == 0 {
+				r.Input = append(r.Input, map[string]interface{}{"role": m.Role, "content": m.Content})
+				continue
+			}
+			content := []map[string]interface{}{{"type": "input_text", "text": m.Content}}
+			r.Input = append(r.Input, map[string]interface{}{"role": m.Role, "content": append(content, responsesImages(m.Images)...)})
+		}
+	}
+	flushImages()
+
+	for _, t := range req.Tools {
+		if t.Function == nil {
+			continue
+		}
+		r.Tools = append(r.Tools, map[string]interface{}{
+			"type":        "function",
+			"name":        t.Function.Name,
+			"description": t.Function.Description,
+			"parameters":  t.Function.Parameters,
+		})
+	}
+	for _, hosted := range req.HostedTools {
+		r.Tools = append(r.Tools, map[string]interface{}{"type": hosted})
+	}
+
+	if req.ResponseSchema != nil {
+		r.Text = map[string]interface{}{"format": map[string]interface{}{
+			"type":   "json_schema",
+			"name":   req.ResponseSchema.Name,
+			"schema": req.ResponseSchema.Schema,
+			"strict": req.ResponseSchema.Strict,
+		}}
+	}
+	return r
+}
+
+func responsesImages(images []Image) []map[string]interface{} {
+	parts := make([]map[string]interface{}, 0, len(images))
+	for _, img := range images {
+		parts = append(parts, map[string]interface{}{
+			"type":      "input_image",
+			"image_url": "data:" + img.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(img.Data),
+		})
+	}
+	return parts
+}
+
+// IsReasoningModel reports whether an OpenAI model is a reasoning model (o-series, gpt-5), which
+// takes reasoning settings instead of temperature and top_p
+func IsReasoningModel(name string) bool {
+	name = strings.ToLower(name[strings.LastIndex(name, "/")+1:])
+	if strings.HasPrefix(name, "gpt-5") && !strings.Contains(name, "chat") {
+		return true
+	}
+	return len(name) > 1 && name[0] == 'o' && name[1] >= '1' && name[1] <= '9'
+}
+
+// usage converts the Responses API usage to the Chat Completions form the agent records
+func (r *responsesResult) usage() *openai.Usage {
+	if r.Usage == nil {
+		return nil
+	}
+	usage := &openai.Usage{
+		PromptTokens:     r.Usage.InputTokens,
+		CompletionTokens: r.Usage.OutputTokens,
+		TotalTokens:      r.Usage.TotalTokens,
+	}
+	if r.Usage.InputTokensDetails.CachedTokens > 0 {
+		usage.PromptTokensDetails = &openai.PromptTokensDetails{CachedTokens: r.Usage.InputTokensDetails.CachedTokens}
+	}
+	if r.Usage.OutputTokensDetails.ReasoningTokens > 0 {
+		usage.CompletionTokensDetails = &openai.CompletionTokensDetails{ReasoningTokens: r.Usage.OutputTokensDetails.ReasoningTokens}
+	}
+	return usage
+}
+
+// finishReason maps the status of a response to a Chat Completions finish reason
+func (r *responsesResult) finishReason() string {
+	if r.Status == "incomplete" && r.IncompleteDetails != nil && r.IncompleteDetails.Reason == "max_output_tokens" {
+		return "length"
+	}
+	if r.Status == "incomplete" && r.IncompleteDetails != nil {
+		return r.IncompleteDetails.Reason
+	}
+	return "stop"
+}
@@ -0,0 +1,130 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestConvertToResponsesRequest(t *testing.T) {
+	req := Request{
+		Model:       "gpt-5-mini",
+		Temperature: 0.7,
+		Messages: []Message{
+			{Role: openai.ChatMessageRoleSystem, Content: "You are mcode."},
+			{Role: openai.ChatMessageRoleUser, Content: "List the files"},
+			{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "call_1", Function: openai.FunctionCall{Name: "list_files", Arguments: `{"path":"."}`}}}},
+			{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: "main.go", Images: []Image{{MIMEType: "image/png", Data: []byte("png")}}},
+		},
+		Tools:       []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "list_files"}}},
+		HostedTools: []string{"web_search_preview"},
+	}
+
+	r := convertToResponsesRequest(req)
+	if r.Temperature != nil || r.Reasoning["summary"] != "auto" {
+		t.Errorf("reasoning model should get reasoning settings instead of temperature, got %+v", r)
+	}
+	if len(r.Input) != 5 {
+		t.Fatalf("expected 5 input items, got %d: %+v", len(r.Input), r.Input)
+	}
+	if r.Input[2]["type"] != "function_call" || r.Input[2]["call_id"] != "call_1" || r.Input[2]["name"] != "list_files" {
+		t.Errorf("unexpected function call item %+v", r.Input[2])
+	}
+	if r.Input[3]["type"] != "function_call_output" || r.Input[3]["output"] != "main.go" {
+		t.Errorf("unexpected function call output item %+v", r.Input[3])
+	}
+	if r.Input[4]["role"] != "user" {
+		t.Errorf("tool result images should follow in a user message, got %+v", r.Input[4])
+	}
+	if len(r.Tools) != 2 || r.Tools[0]["name"] != "list_files" || r.Tools[1]["type"] != "web_search_preview" {
+		t.Errorf("unexpected tools %+v", r.Tools)
+	}
+
+	if r := convertToResponsesRequest(Request{Model: "gpt-4.1", Temperature: 0.7}); r.Temperature == nil || r.Reasoning != nil {
+		t.Errorf("non-reasoning model should keep its temperature, got %+v", r)
+	}
+}
+
+func TestResponsesProviderStream(t *testing.T) {
+	events := []string{
+		`{"type":"response.reasoning_summary_text.delta","delta":"Thinking"}`,
+		`{"type":"response.output_text.delta","delta":"Let me look."}`,
+		`{"type":"response.output_item.added","output_index":2,"item":{"type":"function_call","call_id":"call_9","name":"read_file"}}`,
+		`{"type":"response.function_call_arguments.delta","output_index":2,"delta":"{\"path\":"}`,
+		`{"type":"response.function_call_arguments.delta","output_index":2,"delta":"\"a.go\"}"}`,
+		`{"type":"response.completed","response":{"status":"completed","usage":{"input_tokens":100,"output_tokens":20,"total_tokens":120,"input_tokens_details":{"cached_tokens":64}}}}`,
+	}
+	var body responsesRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/responses" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			fmt.Fprintf(w, "event: x\ndata: %s\n\n", e)
+		}
+	}))
+	defer server.Close()
+
+	stream, err := NewResponsesProvider(server.URL, "key").CreateStream(context.Background(), Request{Model: "o4-mini"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content, reasoning, args, finish string
+	var calls []openai.ToolCall
+	var usage *openai.Usage
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatal(chunk.Error)
+		}
+		content += chunk.Content
+		reasoning += chunk.Reasoning
+		for _, tc := range chunk.ToolCalls {
+			if tc.ID != "" {
+				calls = append(calls, tc)
+			}
+			args += tc.Function.Arguments
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+		}
+	}
+
+	if !body.Stream || body.Store {
+		t.Errorf("expected a streamed, unstored request, got %+v", body)
+	}
+	if content != "Let me look." || reasoning != "Thinking" {
+		t.Errorf("got content %q, reasoning %q", content, reasoning)
+	}
+	if len(calls) != 1 || calls[0].ID != "call_9" || *calls[0].Index != 0 || args != `{"path":"a.go"}` {
+		t.Errorf("unexpected tool calls %+v with arguments %q", calls, args)
+	}
+	if finish != "tool_calls" {
+		t.Errorf("expected finish reason tool_calls, got %q", finish)
+	}
+	if usage == nil || usage.PromptTokens != 100 || CachedTokens(usage) != 64 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
+
+func TestResponsesProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"message":"Unsupported parameter: 'temperature'"}}`)
+	}))
+	defer server.Close()
+
+	_, err := NewResponsesProvider(server.URL, "").CreateCompletion(context.Background(), Request{Model: "o3"})
+	if err == nil || err.Error() != "responses API error (status 400): Unsupported parameter: 'temperature'" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/genai"
+)
+
+// StatusError is a request the server answered with an error status
+type StatusError struct {
+	Code       int           // HTTP status code
+	RetryAfter time.Duration // Delay the server asked for with Retry-After; 0 when it did not
+	Err        error
+}
+
+func (e *StatusError) Error() string { return e.Err.Error() }
+
+func (e *StatusError) Unwrap() error { return e.Err }
+
+// StatusCode returns the HTTP status of a failed request, 0 when the error did not come from a
+// response
+func StatusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code != 0 {
+		return statusErr.Code
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	var genaiErr genai.APIError
+	if errors.As(err, &genaiErr) {
+		return genaiErr.Code
+	}
+	var genaiErrPtr *genai.APIError
+	if errors.As(err, &genaiErrPtr) {
+		return genaiErrPtr.Code
+	}
+	return 0
+}
+
+// RetryAfter returns the delay the server asked for before the request is sent again
+func RetryAfter(err error) (time.Duration, bool) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// IsTransient reports whether a request failed in a way that sending it again may fix: rate
+// limits, overloaded or restarting servers, timeouts and dropped connections. Exhausted quotas
+// are not transient even though they come as 429.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch StatusCode(err) {
+	case http.StatusTooManyRequests:
+		var apiErr *openai.APIError
+		return !errors.As(err, &apiErr) || apiErr.Code != "insufficient_quota"
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooEarly,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+		529: // Overloaded, as Anthropic-compatible APIs report it
+		return true
+	case 0:
+	default:
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// parseRetryAfter reads a Retry-After header, given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// retryAfterDoer remembers the Retry-After header of the latest response, which go-openai drops
+// from its errors
+type retryAfterDoer struct {
+	base  openai.HTTPDoer
+	delay atomic.Int64 // Of the latest response; 0 when it had none
+}
+
+func (d *retryAfterDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.base.Do(req)
+	d.delay.Store(0)
+	if err == nil && resp.StatusCode >= http.StatusBadRequest {
+		d.delay.Store(int64(parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())))
+	}
+	return resp, err
+}
+
+// wrap adds the Retry-After delay of the response that failed to err
+func (d *retryAfterDoer) wrap(err error) error {
+	if err == nil || d == nil {
+		return err
+	}
+	if delay := time.Duration(d.delay.Load()); delay > 0 {
+		return &StatusError{Code: StatusCode(err), RetryAfter: delay, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"coding-agent/pkg/schema"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxStructuredAttempts bounds how often an invalid structured response is sent back for correction
+const maxStructuredAttempts = 3
+
+// CompleteStructured requests a JSON response matching format and decodes it into out.
+// Providers that reject response_format get the schema in the prompt instead, and every
+// response is validated so invalid output is returned to the model for another attempt.
+func CompleteStructured(ctx context.Context, p Provider, req Request, format ResponseSchema, out interface{}) error {
+	req.Stream = false
+	req.Tools = nil
+	req.ResponseSchema = &format
+	req.Messages = append([]Message(nil), req.Messages...)
+
+	var lastErr error
+	for attempt := 0; attempt < maxStructuredAttempts; {
+		resp, err := p.CreateCompletion(ctx, req)
+		if err != nil {
+			if ctx.Err() != nil || req.ResponseSchema == nil {
+				return err
+			}
+			// The server does not support response_format; describe the schema in the prompt and retry
+			req.ResponseSchema = nil
+			req.Messages = append(req.Messages, Message{
+				Role:    openai.ChatMessageRoleUser,
+				Content: schemaInstruction(format),
+			})
+			continue
+		}
+		attempt++
+
+		raw := ExtractJSON(resp.Content)
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			lastErr = fmt.Errorf("response is not valid JSON: %v", err)
+		} else if err := schema.Validate(format.Schema, value); err != nil {
+			lastErr = fmt.Errorf("response does not match the schema: %v", err)
+		} else {
+			return json.Unmarshal([]byte(raw), out)
+		}
+
+		req.Messages = append(req.Messages,
+			Message{Role: openai.ChatMessageRoleAssistant, Content: resp.Content},
+			Message{
+				Role:    openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf("Your previous reply was rejected: %v. Reply again with only a JSON object that matches the schema.", lastErr),
+			},
+		)
+	}
+
+	return fmt.Errorf("no valid structured response after %d attempts: %v", maxStructuredAttempts, lastErr)
+}
+
+// schemaInstruction asks for schema-conforming JSON when the provider cannot enforce it
+func schemaInstruction(format ResponseSchema) string {
+	data, _ := json.MarshalIndent(format.Schema, "", "  ")
+	return fmt.Sprintf("Respond with only a JSON object (no prose, no code fences) that matches this JSON schema:\n%s", data)
+}
+
+// ExtractJSON returns the JSON document in a model response, dropping code fences and surrounding prose
+func ExtractJSON(content string) string {
+	s := strings.TrimSpace(content)
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s, "```json")
+		s = strings.TrimPrefix(s, "```")
+		s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+		s = strings.TrimSpace(s)
+	}
+	if strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[") {
+		return s
+	}
+
+	start := strings.Index(s, "{")
+	end := strings.LastIndex(s, "}")
+	if start >= 0 && end > start {
+		return s[start : end+1]
+	}
+	return s
+}
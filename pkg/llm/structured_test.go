@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// scriptedProvider replays canned completions and records the requests it received
+type scriptedProvider struct {
+	replies  []string
+	rejectRF bool
+	requests []Request
+}
+
+func (p *scriptedProvider) CreateCompletion(ctx context.Context, req Request) (*Response, error) {
+	p.requests = append(p.requests, req)
+	if p.rejectRF && req.ResponseSchema != nil {
+		return nil, errors.New("response_format is not supported")
+	}
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return &Response{Content: reply}, nil
+}
+
+func (p *scriptedProvider) CreateStream(ctx context.Context, req Request) (<-chan StreamResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+var testFormat = ResponseSchema{
+	Name: "summary",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"title"},
+	},
+}
+
+func TestCompleteStructuredRetriesInvalidResponses(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{
+		"Sure! Here you go",
+		`{"name": "wrong field"}`,
+		"```json\n{\"title\": \"Fixed\"}\n```",
+	}}
+
+	var out struct {
+		Title string `json:"title"`
+	}
+	if err := CompleteStructured(context.Background(), provider, Request{Model: "m"}, testFormat, &out); err != nil {
+		t.Fatalf("CompleteStructured() error = %v", err)
+	}
+	if out.Title != "Fixed" {
+		t.Errorf("Title = %q, want %q", out.Title, "Fixed")
+	}
+	if len(provider.requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(provider.requests))
+	}
+	last := provider.requests[2].Messages
+	if !strings.Contains(last[len(last)-1].Content, `missing required field "title"`) {
+		t.Errorf("expected validation error to be fed back, got %q", last[len(last)-1].Content)
+	}
+}
+
+func TestCompleteStructuredFallsBackToPromptSchema(t *testing.T) {
+	provider := &scriptedProvider{rejectRF: true, replies: []string{`{"title": "Prompted"}`}}
+
+	var out struct {
+		Title string `json:"title"`
+	}
+	if err := CompleteStructured(context.Background(), provider, Request{Model: "m"}, testFormat, &out); err != nil {
+		t.Fatalf("CompleteStructured() error = %v", err)
+	}
+	if out.Title != "Prompted" {
+		t.Errorf("Title = %q, want %q", out.Title, "Prompted")
+	}
+	retry := provider.requests[1]
+	if retry.ResponseSchema != nil || !strings.Contains(retry.Messages[len(retry.Messages)-1].Content, "JSON schema") {
+		t.Errorf("expected retry without response_format and with schema in the prompt")
+	}
+}
+
+func TestCompleteStructuredGivesUp(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{"no", "still no", "never"}}
+
+	var out map[string]interface{}
+	err := CompleteStructured(context.Background(), provider, Request{Model: "m"}, testFormat, &out)
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("expected attempts error, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Offset converts a position to a byte offset in content. Characters count UTF-16 code units.
+func Offset(content string, pos Position) (int, error) {
+	start := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(content[start:], '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("line %d is past the end of the document", pos.Line+1)
+		}
+		start += i + 1
+	}
+	end := len(content)
+	if i := strings.IndexByte(content[start:], '\n'); i >= 0 {
+		end = start + i
+	}
+
+	units := 0
+	offset := start
+	for offset < end && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(content[offset:])
+		units += utf16Len(r)
+		offset += size
+	}
+	return offset, nil
+}
+
+// PositionAt converts a byte offset in content to a position
+func PositionAt(content string, offset int) Position {
+	offset = min(offset, len(content))
+	lineStart := strings.LastIndexByte(content[:offset], '\n') + 1
+	units := 0
+	for _, r := range content[lineStart:offset] {
+		units += utf16Len(r)
+	}
+	return Position{Line: strings.Count(content[:offset], "\n"), Character: units}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// ApplyEdits applies text edits to content. Edits must not overlap.
+func ApplyEdits(content string, edits []TextEdit) (string, error) {
+	type span struct {
+		start, end int
+		text       string
+	}
+	spans := make([]span, 0, len(edits))
+	for _, e := range edits {
+		start, err := Offset(content, e.Range.Start)
+		if err != nil {
+			return "", err
+		}
+		end, err := Offset(content, e.Range.End)
+		if err != nil {
+			return "", err
+		}
+		if end < start {
+			return "", fmt.Errorf("edit range ends before it starts")
+		}
+		spans = append(spans, span{start, end, e.NewText})
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		if s.start < last {
+			return "", fmt.Errorf("overlapping edits")
+		}
+		b.WriteString(content[last:s.start])
+		b.WriteString(s.text)
+		last = s.end
+	}
+	b.WriteString(content[last:])
+	return b.String(), nil
+}
@@ -0,0 +1,336 @@
+// Package lsp is a minimal Language Server Protocol client for one-off requests such as renames.
+// It starts a server, opens the files a request needs and shuts the server down again; there is
+// no long-lived session or document sync.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Position is a zero-based line and UTF-16 character offset, as LSP counts them
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a span of a document, end exclusive
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// TextEdit replaces a range of a document
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// WorkspaceEdit is the result of a rename. Servers use either Changes or DocumentChanges.
+type WorkspaceEdit struct {
+	Changes         map[string][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []json.RawMessage     `json:"documentChanges,omitempty"`
+}
+
+// FileEdits returns the edits per file path. Renaming or creating files is not supported.
+func (e *WorkspaceEdit) FileEdits() (map[string][]TextEdit, error) {
+	edits := make(map[string][]TextEdit)
+	for uri, changes := range e.Changes {
+		path, err := URIToPath(uri)
+		if err != nil {
+			return nil, err
+		}
+		edits[path] = append(edits[path], changes...)
+	}
+	for _, raw := range e.DocumentChanges {
+		var change struct {
+			Kind         string `json:"kind"`
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			Edits []TextEdit `json:"edits"`
+		}
+		if err := json.Unmarshal(raw, &change); err != nil {
+			return nil, err
+		}
+		if change.Kind != "" {
+			return nil, fmt.Errorf("the language server also wants to %s a file, which is not supported", change.Kind)
+		}
+		path, err := URIToPath(change.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		edits[path] = append(edits[path], change.Edits...)
+	}
+	return edits, nil
+}
+
+// PathToURI returns the file:// URI of a path
+func PathToURI(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+}
+
+// URIToPath returns the path of a file:// URI
+func URIToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported document URI %q", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// LanguageID returns the LSP language identifier for a file name
+func LanguageID(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		return "go"
+	case ".ts":
+		return "typescript"
+	case ".tsx":
+		return "typescriptreact"
+	case ".js", ".mjs", ".cjs":
+		return "javascript"
+	case ".jsx":
+		return "javascriptreact"
+	case ".py":
+		return "python"
+	case ".rs":
+		return "rust"
+	case ".java":
+		return "java"
+	case ".c", ".h":
+		return "c"
+	case ".cpp", ".cc", ".hpp":
+		return "cpp"
+	}
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+}
+
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Client speaks JSON-RPC with Content-Length framing over a server's stdin and stdout. Calls are
+// made one at a time.
+type Client struct {
+	r      *bufio.Reader
+	w      io.Writer
+	nextID int
+}
+
+// NewClient returns a client reading responses from r and writing requests to w
+func NewClient(r io.Reader, w io.Writer) *Client {
+	return &Client{r: bufio.NewReader(r), w: w}
+}
+
+// Call sends a request and decodes its result into result. Requests the server makes meanwhile
+// get empty answers and notifications are dropped.
+func (c *Client) Call(method string, params, result interface{}) error {
+	c.nextID++
+	id := c.nextID
+	if err := c.send(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return err
+	}
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return err
+		}
+		if msg.ID == nil {
+			continue
+		}
+		if msg.Method != "" {
+			if err := c.reply(msg); err != nil {
+				return err
+			}
+			continue
+		}
+		if got, err := strconv.Atoi(string(*msg.ID)); err != nil || got != id {
+			continue
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("%s: %s", method, msg.Error.Message)
+		}
+		if result == nil || len(msg.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	}
+}
+
+// Notify sends a notification
+func (c *Client) Notify(method string, params interface{}) error {
+	return c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// reply answers a server request. workspace/configuration expects one value per item.
+func (c *Client) reply(req *message) error {
+	var result interface{}
+	if req.Method == "workspace/configuration" {
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(req.Params, &params)
+		result = make([]interface{}, len(params.Items))
+	}
+	return c.send(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+}
+
+func (c *Client) send(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+func (c *Client) read() (*message, error) {
+	length := -1
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("bad Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("bad message from the language server: %v", err)
+	}
+	return &msg, nil
+}
+
+// Server is a running language server
+type Server struct {
+	*Client
+	cmd *exec.Cmd
+}
+
+// Start runs a language server command and initializes it for the workspace at root. The server
+// is killed when ctx ends.
+func Start(ctx context.Context, command []string, root string) (*Server, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no language server command")
+	}
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = root
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting %s: %v", command[0], err)
+	}
+	s := &Server{Client: NewClient(stdout, stdin), cmd: cmd}
+
+	rootURI := PathToURI(root)
+	params := map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   rootURI,
+		"capabilities": map[string]interface{}{
+			"workspace": map[string]interface{}{
+				"workspaceEdit":    map[string]interface{}{"documentChanges": true},
+				"configuration":    true,
+				"workspaceFolders": true,
+			},
+			"textDocument": map[string]interface{}{
+				"rename": map[string]interface{}{"prepareSupport": false},
+			},
+		},
+		"workspaceFolders": []map[string]string{{"uri": rootURI, "name": filepath.Base(root)}},
+	}
+	if err := s.Call("initialize", params, nil); err != nil {
+		s.kill()
+		s.cmd.Wait()
+		return nil, fmt.Errorf("%s did not initialize: %v", command[0], err)
+	}
+	if err := s.Notify("initialized", map[string]interface{}{}); err != nil {
+		s.kill()
+		s.cmd.Wait()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Open tells the server about a document and its current content
+func (s *Server) Open(path, content string) error {
+	return s.Notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": PathToURI(path), "languageId": LanguageID(path), "version": 1, "text": content},
+	})
+}
+
+// Rename asks for the edits that rename the symbol at pos in path to newName
+func (s *Server) Rename(path string, pos Position, newName string) (*WorkspaceEdit, error) {
+	var edit WorkspaceEdit
+	err := s.Call("textDocument/rename", map[string]interface{}{
+		"textDocument": map[string]string{"uri": PathToURI(path)},
+		"position":     pos,
+		"newName":      newName,
+	}, &edit)
+	return &edit, err
+}
+
+// Close shuts the server down, killing it if it does not exit promptly
+func (s *Server) Close() {
+	done := make(chan struct{})
+	go func() {
+		if s.Call("shutdown", nil, nil) == nil {
+			s.Notify("exit", nil)
+		}
+		s.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		s.kill()
+	}
+}
+
+func (s *Server) kill() {
+	if s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+}
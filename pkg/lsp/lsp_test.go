@@ -0,0 +1,92 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// fakeServer answers the requests of a Client: it first asks the client for its configuration,
+// then replies to each request with the result of handle
+func fakeServer(t *testing.T, r io.Reader, w io.Writer, handle func(method string) interface{}) {
+	c := NewClient(r, w)
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return
+		}
+		if msg.ID == nil || msg.Method == "" {
+			continue
+		}
+		c.send(map[string]interface{}{"jsonrpc": "2.0", "id": 99, "method": "workspace/configuration", "params": map[string]interface{}{"items": []int{1, 2}}})
+		answer, err := c.read()
+		if err != nil {
+			return
+		}
+		var config []interface{}
+		if json.Unmarshal(answer.Result, &config); len(config) != 2 {
+			t.Errorf("workspace/configuration answered with %s, want two values", answer.Result)
+		}
+		c.Notify("window/logMessage", map[string]string{"message": "working"})
+		c.send(map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": handle(msg.Method)})
+	}
+}
+
+func TestClientRename(t *testing.T) {
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+	defer clientWrite.Close()
+	path, _ := filepath.Abs("main.go")
+	go fakeServer(t, serverRead, serverWrite, func(method string) interface{} {
+		if method != "textDocument/rename" {
+			return nil
+		}
+		return map[string]interface{}{"documentChanges": []interface{}{map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": PathToURI(path), "version": 1},
+			"edits":        []TextEdit{{Range: Range{Start: Position{0, 5}, End: Position{0, 8}}, NewText: "Bar"}},
+		}}}
+	})
+
+	c := NewClient(clientRead, clientWrite)
+	var edit WorkspaceEdit
+	if err := c.Call("textDocument/rename", map[string]interface{}{"newName": "Bar"}, &edit); err != nil {
+		t.Fatal(err)
+	}
+	edits, err := edit.FileEdits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits[path]) != 1 || edits[path][0].NewText != "Bar" {
+		t.Fatalf("FileEdits() = %+v, want one edit of %s", edits, path)
+	}
+
+	renameFile := WorkspaceEdit{DocumentChanges: []json.RawMessage{json.RawMessage(`{"kind":"rename","oldUri":"file:///a","newUri":"file:///b"}`)}}
+	if _, err := renameFile.FileEdits(); err == nil {
+		t.Error("file operations should be rejected")
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	// 😀 is two UTF-16 code units, so Foo on the second line starts at character 8
+	content := "func Foo() {}\n// 😀 x Foo()\n"
+	pos := PositionAt(content, len("func Foo() {}\n// 😀 x "))
+	if pos != (Position{Line: 1, Character: 8}) {
+		t.Fatalf("PositionAt() = %+v, want line 1 character 8", pos)
+	}
+
+	got, err := ApplyEdits(content, []TextEdit{
+		{Range: Range{Start: pos, End: Position{1, 11}}, NewText: "Bar"},
+		{Range: Range{Start: Position{0, 5}, End: Position{0, 8}}, NewText: "Bar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "func Bar() {}\n// 😀 x Bar()\n"; got != want {
+		t.Errorf("ApplyEdits() = %q, want %q", got, want)
+	}
+
+	if _, err := ApplyEdits(content, []TextEdit{{Range: Range{Start: Position{5, 0}, End: Position{5, 1}}}}); err == nil {
+		t.Error("an edit past the end should fail")
+	}
+}
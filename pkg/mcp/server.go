@@ -0,0 +1,208 @@
+// Package mcp serves mcode's built-in tools to other agents and editors over the Model Context
+// Protocol, using the stdio transport: one JSON-RPC 2.0 message per line.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"coding-agent/pkg/agent"
+	"coding-agent/pkg/tools"
+	"coding-agent/pkg/types"
+)
+
+// ProtocolVersion is the MCP revision the server implements
+const ProtocolVersion = "2024-11-05"
+
+// knownVersions are the revisions whose tool methods are the same, so a client asking for one of
+// them gets it
+var knownVersions = []string{"2024-11-05", "2025-03-26", "2025-06-18"}
+
+// DefaultTools are the tools served by default. Shell commands are only served with --allow-bash,
+// as nothing checks what a command does.
+var DefaultTools = []string{"read_file", "list_files", "search_code", "edit_file"}
+
+// ShellTool is the tool --allow-bash adds
+const ShellTool = "bash_command"
+
+// ReadOnlyTools are the tools served with --read-only
+var ReadOnlyTools = []string{"read_file", "list_files", "search_code"}
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Server answers MCP requests with the tools of a tool manager. Tool calls are checked with
+// agent.UnattendedAccessError, as nobody can be asked to approve them.
+type Server struct {
+	agent   *types.Agent
+	tools   *tools.Manager
+	names   []string
+	version string
+}
+
+// NewServer creates a server for the named tools; names the manager does not have are skipped
+func NewServer(a *types.Agent, toolManager *tools.Manager, names []string, version string) *Server {
+	var served []string
+	for _, name := range names {
+		if _, ok := toolManager.GetTool(name); ok {
+			served = append(served, name)
+		}
+	}
+	return &Server{agent: a, tools: toolManager, names: served, version: version}
+}
+
+// Tools returns the names of the served tools
+func (s *Server) Tools() []string {
+	return s.names
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Serve answers the requests read from in, writing the responses to out, until in is closed or
+// ctx is cancelled. Requests are handled one at a time, in order.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 32*1024*1024)
+	encoder := json.NewEncoder(out)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			encoder.Encode(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{codeParseError, "parse error: " + err.Error()}})
+			continue
+		}
+		result, rpcErr := s.handle(ctx, req)
+		if len(req.ID) == 0 {
+			continue // Notifications get no response
+		}
+		if err := encoder.Encode(response{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *Server) handle(ctx context.Context, req request) (interface{}, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		version := ProtocolVersion
+		if slices.Contains(knownVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "mcode", "version": s.version},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": s.listTools()}, nil
+	case "tools/call":
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{codeInvalidParams, "invalid params: " + err.Error()}
+		}
+		if !slices.Contains(s.names, params.Name) {
+			return nil, &rpcError{codeInvalidParams, fmt.Sprintf("unknown tool %q", params.Name)}
+		}
+		if params.Arguments == nil {
+			params.Arguments = map[string]interface{}{}
+		}
+		return s.callTool(ctx, params.Name, params.Arguments), nil
+	}
+	if len(req.ID) == 0 {
+		return nil, nil // Notifications such as notifications/initialized need no handling
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not found: " + req.Method}
+}
+
+// listTools describes the served tools with their JSON schemas
+func (s *Server) listTools() []map[string]interface{} {
+	list := make([]map[string]interface{}, 0, len(s.names))
+	for _, name := range s.names {
+		tool, _ := s.tools.GetTool(name)
+		def := tool.Definition().Function
+		list = append(list, map[string]interface{}{
+			"name":        def.Name,
+			"description": def.Description,
+			"inputSchema": def.Parameters,
+		})
+	}
+	return list
+}
+
+// callTool runs a tool call and returns its MCP result. Failures are reported in the result, with
+// isError set, so the calling model sees them like any other tool output.
+func (s *Server) callTool(ctx context.Context, name string, args map[string]interface{}) map[string]interface{} {
+	if err := s.tools.ValidateParams(name, args); err != nil {
+		return toolResult(err.Error(), true, nil)
+	}
+	if err := agent.UnattendedAccessError(s.agent, name, args); err != nil {
+		return toolResult("Permission denied: "+err.Error(), true, nil)
+	}
+
+	tool, _ := s.tools.GetTool(name)
+	output, err := tool.Execute(ctx, args)
+	images := s.tools.TakeImages()
+	if err != nil {
+		if output != "" {
+			return toolResult(output+"\n"+err.Error(), true, nil)
+		}
+		return toolResult(err.Error(), true, nil)
+	}
+	content := []map[string]interface{}{}
+	for _, img := range images {
+		content = append(content, map[string]interface{}{
+			"type":     "image",
+			"data":     base64.StdEncoding.EncodeToString(img.Data),
+			"mimeType": img.MIMEType,
+		})
+	}
+	return toolResult(output, false, content)
+}
+
+func toolResult(text string, isError bool, extra []map[string]interface{}) map[string]interface{} {
+	content := append([]map[string]interface{}{{"type": "text", "text": text}}, extra...)
+	return map[string]interface{}{"content": content, "isError": isError}
+}
@@ -0,0 +1,91 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"coding-agent/pkg/tools"
+	"coding-agent/pkg/types"
+)
+
+// testResponse is the part of a response the test looks at
+type testResponse struct {
+	ID     int `json:"id"`
+	Result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		Tools           []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	} `json:"result"`
+	Error *rpcError `json:"error"`
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	os.WriteFile(path, []byte("hello from mcode\n"), 0o644)
+
+	a := &types.Agent{
+		Tools:  make(map[string]func(map[string]interface{}) (string, error)),
+		Config: &types.Config{CurrentModel: "m", Models: map[string]types.Model{"m": {Name: "m"}}},
+	}
+	a.SetApprovedFolders(map[string]bool{dir: true})
+	m := tools.NewManager(a)
+	m.RegisterTools()
+	server := NewServer(a, m, ReadOnlyTools, "test")
+
+	requests := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"1999-01-01"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"read_file","arguments":{"path":"` + path + `"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"read_file","arguments":{"path":"` + filepath.Join(filepath.Dir(dir), "elsewhere.txt") + `"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"bash_command","arguments":{"command":"ls"}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"resources/list"}`,
+	}
+	var out bytes.Buffer
+	if err := server.Serve(context.Background(), strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []testResponse
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var r testResponse
+		if err := decoder.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, r)
+	}
+	if len(responses) != 6 {
+		t.Fatalf("expected 6 responses (none for the notification), got %d:\n%s", len(responses), out.String())
+	}
+
+	if responses[0].Result.ProtocolVersion != ProtocolVersion {
+		t.Errorf("unknown client versions should get %s, got %q", ProtocolVersion, responses[0].Result.ProtocolVersion)
+	}
+	if got := len(responses[1].Result.Tools); got != len(ReadOnlyTools) {
+		t.Errorf("expected %d tools, got %d", len(ReadOnlyTools), got)
+	}
+	if r := responses[2].Result; r.IsError || len(r.Content) == 0 || !strings.Contains(r.Content[0].Text, "hello from mcode") {
+		t.Errorf("unexpected read_file result %+v", r)
+	}
+	if r := responses[3].Result; !r.IsError || !strings.Contains(r.Content[0].Text, "not approved") {
+		t.Errorf("reads outside the approved folders should be refused, got %+v", r)
+	}
+	if responses[4].Error == nil || responses[4].Error.Code != codeInvalidParams {
+		t.Errorf("tools that are not served should be an invalid params error, got %+v", responses[4])
+	}
+	if responses[5].Error == nil || responses[5].Error.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %+v", responses[5])
+	}
+}
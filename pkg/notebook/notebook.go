@@ -0,0 +1,272 @@
+// Package notebook reads and edits Jupyter notebooks (.ipynb). Models see the cells rendered as
+// text and edit cell sources; everything else in the file, such as outputs and metadata, is kept
+// as it was.
+package notebook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxOutputChars caps the rendered outputs of one cell
+const maxOutputChars = 2000
+
+// IsNotebookPath reports whether a file name is a Jupyter notebook
+func IsNotebookPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".ipynb")
+}
+
+// Notebook is a parsed notebook. Fields other than the cells, and cell fields other than the
+// source, are kept raw so they are written back unchanged.
+type Notebook struct {
+	fields map[string]json.RawMessage
+	Cells  []Cell
+}
+
+// Cell is one notebook cell
+type Cell struct {
+	fields map[string]json.RawMessage
+	Type   string // code, markdown or raw
+	Source string
+}
+
+// Parse reads notebook JSON
+func Parse(data []byte) (*Notebook, error) {
+	var nb Notebook
+	if err := json.Unmarshal(data, &nb.fields); err != nil {
+		return nil, fmt.Errorf("invalid notebook: %v", err)
+	}
+	var cells []map[string]json.RawMessage
+	if raw, ok := nb.fields["cells"]; ok {
+		if err := json.Unmarshal(raw, &cells); err != nil {
+			return nil, fmt.Errorf("invalid notebook cells: %v", err)
+		}
+	}
+	for i, fields := range cells {
+		cell := Cell{fields: fields}
+		json.Unmarshal(fields["cell_type"], &cell.Type)
+		source, err := joinSource(fields["source"])
+		if err != nil {
+			return nil, fmt.Errorf("cell %d: %v", i, err)
+		}
+		cell.Source = source
+		nb.Cells = append(nb.Cells, cell)
+	}
+	return &nb, nil
+}
+
+// joinSource decodes a cell source, which notebooks store as a string or a list of lines
+func joinSource(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err != nil {
+		return "", fmt.Errorf("invalid source: %v", err)
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// splitSource encodes a source the way Jupyter writes it: lines keeping their newlines
+func splitSource(source string) []string {
+	lines := strings.SplitAfter(source, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// NewCell returns a cell to add to the notebook
+func (nb *Notebook) NewCell(cellType, source string) (Cell, error) {
+	cell, err := newCell(cellType, source)
+	if err != nil {
+		return cell, err
+	}
+	// Cell ids are required from format 4.5 on and not allowed before
+	var minor int
+	json.Unmarshal(nb.fields["nbformat_minor"], &minor)
+	if minor >= 5 {
+		id := make([]byte, 4)
+		rand.Read(id)
+		cell.fields["id"], _ = encode(hex.EncodeToString(id))
+	}
+	return cell, nil
+}
+
+func newCell(cellType, source string) (Cell, error) {
+	fields := map[string]json.RawMessage{"metadata": json.RawMessage("{}")}
+	switch cellType {
+	case "code":
+		fields["execution_count"] = json.RawMessage("null")
+		fields["outputs"] = json.RawMessage("[]")
+	case "markdown", "raw":
+	default:
+		return Cell{}, fmt.Errorf("cell type must be code, markdown or raw, not %q", cellType)
+	}
+	return Cell{fields: fields, Type: cellType, Source: source}, nil
+}
+
+// SetType changes the cell type, adding or dropping the fields only code cells have
+func (c *Cell) SetType(cellType string) error {
+	if cellType == c.Type {
+		return nil
+	}
+	fresh, err := newCell(cellType, c.Source)
+	if err != nil {
+		return err
+	}
+	fields := make(map[string]json.RawMessage, len(c.fields))
+	for k, v := range c.fields {
+		if k != "outputs" && k != "execution_count" {
+			fields[k] = v
+		}
+	}
+	for k, v := range fresh.fields {
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+	c.fields, c.Type = fields, cellType
+	return nil
+}
+
+// Marshal writes the notebook as Jupyter does: sorted keys, one-space indent, a trailing newline
+func (nb *Notebook) Marshal() ([]byte, error) {
+	cells := make([]map[string]json.RawMessage, len(nb.Cells))
+	for i, cell := range nb.Cells {
+		fields := make(map[string]json.RawMessage, len(cell.fields)+2)
+		for k, v := range cell.fields {
+			fields[k] = v
+		}
+		var err error
+		if fields["cell_type"], err = encode(cell.Type); err != nil {
+			return nil, err
+		}
+		if fields["source"], err = encode(splitSource(cell.Source)); err != nil {
+			return nil, err
+		}
+		cells[i] = fields
+	}
+
+	fields := make(map[string]json.RawMessage, len(nb.fields)+1)
+	for k, v := range nb.fields {
+		fields[k] = v
+	}
+	var err error
+	if fields["cells"], err = encode(cells); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	if err := enc.Encode(fields); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(v interface{}) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
+
+// Render shows the notebook as text, one header per cell followed by its source and outputs
+func (nb *Notebook) Render() string {
+	var b strings.Builder
+	kernel := nb.kernel()
+	if kernel != "" {
+		kernel = ", kernel " + kernel
+	}
+	fmt.Fprintf(&b, "Jupyter notebook: %d cells%s. Edit a cell with edit_file and cell_index.\n", len(nb.Cells), kernel)
+	for i, cell := range nb.Cells {
+		header := fmt.Sprintf("\n### cell %d [%s]", i, cell.Type)
+		var count *int
+		if json.Unmarshal(cell.fields["execution_count"], &count) == nil && count != nil {
+			header += fmt.Sprintf(" (execution count %d)", *count)
+		}
+		b.WriteString(header + "\n")
+		b.WriteString(strings.TrimSuffix(cell.Source, "\n"))
+		b.WriteString("\n")
+		if outputs := cell.renderOutputs(); outputs != "" {
+			b.WriteString("--- output ---\n")
+			b.WriteString(outputs)
+		}
+	}
+	return b.String()
+}
+
+func (nb *Notebook) kernel() string {
+	var meta struct {
+		Kernelspec struct {
+			Name string `json:"name"`
+		} `json:"kernelspec"`
+	}
+	json.Unmarshal(nb.fields["metadata"], &meta)
+	return meta.Kernelspec.Name
+}
+
+// renderOutputs shows a cell's text outputs and names the others, such as images
+func (c Cell) renderOutputs() string {
+	var outputs []struct {
+		OutputType string                     `json:"output_type"`
+		Text       json.RawMessage            `json:"text"`
+		Data       map[string]json.RawMessage `json:"data"`
+		Ename      string                     `json:"ename"`
+		Evalue     string                     `json:"evalue"`
+	}
+	if json.Unmarshal(c.fields["outputs"], &outputs) != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, out := range outputs {
+		switch out.OutputType {
+		case "stream":
+			text, _ := joinSource(out.Text)
+			b.WriteString(text)
+		case "error":
+			fmt.Fprintf(&b, "%s: %s\n", out.Ename, out.Evalue)
+		default:
+			if raw, ok := out.Data["text/plain"]; ok {
+				text, _ := joinSource(raw)
+				b.WriteString(strings.TrimSuffix(text, "\n") + "\n")
+			}
+			mimes := make([]string, 0, len(out.Data))
+			for mime := range out.Data {
+				if mime != "text/plain" {
+					mimes = append(mimes, mime)
+				}
+			}
+			sort.Strings(mimes)
+			for _, mime := range mimes {
+				fmt.Fprintf(&b, "[%s output]\n", mime)
+			}
+		}
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+	}
+
+	s := b.String()
+	if len(s) > maxOutputChars {
+		s = strings.ToValidUTF8(s[:maxOutputChars], "") + fmt.Sprintf("\n[... %d more characters of output ...]\n", len(s)-maxOutputChars)
+	}
+	return s
+}
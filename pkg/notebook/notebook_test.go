@@ -0,0 +1,106 @@
+package notebook
+
+import (
+	"strings"
+	"testing"
+)
+
+const sample = `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": ["# Title\n", "Some <b>text</b>"]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": 2,
+   "metadata": {"tags": ["keep"]},
+   "outputs": [
+    {"name": "stdout", "output_type": "stream", "text": ["hello\n"]},
+    {"data": {"image/png": "iVBOR", "text/plain": ["<Figure>"]}, "metadata": {}, "output_type": "display_data"}
+   ],
+   "source": "print('hello')\nplot()"
+  }
+ ],
+ "metadata": {"kernelspec": {"display_name": "Python 3", "language": "python", "name": "python3"}},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}
+`
+
+func TestRender(t *testing.T) {
+	nb, err := Parse([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := nb.Render()
+	for _, want := range []string{
+		"2 cells, kernel python3",
+		"### cell 0 [markdown]\n# Title\nSome <b>text</b>\n",
+		"### cell 1 [code] (execution count 2)\nprint('hello')\nplot()\n--- output ---\nhello\n<Figure>\n[image/png output]\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Render() is missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestMarshalKeepsOtherFields(t *testing.T) {
+	nb, err := Parse([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nb.Cells[1].Source = "print('bye')\n"
+	cell, err := nb.NewCell("markdown", "Notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nb.Cells = append(nb.Cells, cell)
+
+	data, err := nb.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		`"source": [
+    "print('bye')\n"
+   ]`,
+		`"tags": [`,
+		`"image/png": "iVBOR"`,
+		`"execution_count": 2`,
+		`"display_name": "Python 3"`,
+		`Some <b>text</b>`,
+		`"id": "`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Marshal() is missing %q:\n%s", want, out)
+		}
+	}
+
+	again, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Cells) != 3 || again.Cells[0].Source != "# Title\nSome <b>text</b>" {
+		t.Errorf("round trip changed the cells: %+v", again.Cells)
+	}
+}
+
+func TestSetType(t *testing.T) {
+	nb, err := Parse([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nb.Cells[1].SetType("markdown"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := nb.Marshal()
+	if strings.Contains(string(data), "outputs") || !strings.Contains(string(data), `"keep"`) {
+		t.Errorf("a markdown cell should drop outputs and keep metadata:\n%s", data)
+	}
+	if err := nb.Cells[0].SetType("python"); err == nil {
+		t.Error("expected an unknown cell type to be rejected")
+	}
+}
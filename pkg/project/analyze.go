@@ -0,0 +1,174 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/llm"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// projectManifests are read (truncated) to give the analysis something concrete to work from
+var projectManifests = []string{
+	"README.md", "go.mod", "package.json", "Cargo.toml", "pyproject.toml",
+	"requirements.txt", "pom.xml", "build.gradle", "Makefile", "Dockerfile",
+}
+
+const manifestPreviewLines = 60
+
+// projectAnalysis is the structured result of the /init analysis
+type projectAnalysis struct {
+	Overview  string   `json:"overview"`
+	Languages []string `json:"languages"`
+	Structure []struct {
+		Path    string `json:"path"`
+		Purpose string `json:"purpose"`
+	} `json:"structure"`
+	BuildCommands []string `json:"build_commands"`
+	Conventions   []string `json:"conventions"`
+}
+
+// projectAnalysisSchema is strict-mode compatible: every property required, nothing extra
+var projectAnalysisSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"overview":  map[string]interface{}{"type": "string", "description": "Two or three sentences on what the project does"},
+		"languages": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		"structure": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":    map[string]interface{}{"type": "string"},
+					"purpose": map[string]interface{}{"type": "string"},
+				},
+				"required":             []string{"path", "purpose"},
+				"additionalProperties": false,
+			},
+		},
+		"build_commands": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		"conventions":    map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+	},
+	"required":             []string{"overview", "languages", "structure", "build_commands", "conventions"},
+	"additionalProperties": false,
+}
+
+// analyzeProject asks the current model for a structured description of the project in cwd
+// and renders it as AGENTS.md sections
+func (m *Manager) analyzeProject(cwd string) (string, error) {
+	if m.agent.LLM == nil || m.agent.Config == nil {
+		return "", fmt.Errorf("no model configured")
+	}
+	model, ok := m.agent.Config.Models[m.agent.ModelKey()]
+	if !ok {
+		return "", fmt.Errorf("current model '%s' not found in configuration", m.agent.ModelKey())
+	}
+
+	snapshot, err := projectSnapshot(cwd)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	req := llm.Request{
+		Model: model.Name,
+		Messages: []llm.Message{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "You analyze software projects and describe them for AI coding agents. Be specific and concise; only state what the files support.",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: "Describe this project: its purpose, languages, the role of its top-level files and directories, how to build and test it, and the coding conventions it follows.\n\n" + snapshot,
+			},
+		},
+		MaxTokens:   4000,
+		Temperature: 0.2,
+		TopP:        1.0,
+	}
+
+	var analysis projectAnalysis
+	format := llm.ResponseSchema{Name: "project_analysis", Schema: projectAnalysisSchema, Strict: true}
+	if err := llm.CompleteStructured(ctx, m.agent.LLM, req, format, &analysis); err != nil {
+		return "", err
+	}
+
+	return renderAnalysis(analysis), nil
+}
+
+// projectSnapshot lists the top-level entries and previews the manifest files in dir
+func projectSnapshot(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("error reading project directory: %v", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("Top-level entries:\n")
+	for _, name := range names {
+		sb.WriteString("- " + name + "\n")
+	}
+
+	for _, manifest := range projectManifests {
+		data, err := os.ReadFile(filepath.Join(dir, manifest))
+		if err != nil {
+			continue
+		}
+		lines := strings.Split(string(data), "\n")
+		if len(lines) > manifestPreviewLines {
+			lines = append(lines[:manifestPreviewLines], "...")
+		}
+		sb.WriteString(fmt.Sprintf("\n--- %s ---\n%s\n", manifest, strings.Join(lines, "\n")))
+	}
+
+	return sb.String(), nil
+}
+
+// renderAnalysis formats the analysis as markdown sections for AGENTS.md
+func renderAnalysis(a projectAnalysis) string {
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSpace(a.Overview) + "\n")
+	if len(a.Languages) > 0 {
+		sb.WriteString(fmt.Sprintf("\n**Languages:** %s\n", strings.Join(a.Languages, ", ")))
+	}
+
+	sb.WriteString("\n## Project Structure\n")
+	for _, entry := range a.Structure {
+		sb.WriteString(fmt.Sprintf("- `%s` - %s\n", entry.Path, entry.Purpose))
+	}
+
+	if len(a.BuildCommands) > 0 {
+		sb.WriteString("\n## Build and Test\n")
+		for _, cmd := range a.BuildCommands {
+			sb.WriteString(fmt.Sprintf("- `%s`\n", cmd))
+		}
+	}
+
+	sb.WriteString("\n## Development Guidelines\n")
+	for _, convention := range a.Conventions {
+		sb.WriteString("- " + convention + "\n")
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,81 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+
+	"coding-agent/pkg/types"
+)
+
+// projectKind maps a marker file to the commands conventionally used for that ecosystem
+type projectKind struct {
+	marker   string
+	commands types.ProjectCommands
+}
+
+// projectKinds is checked in order; the first marker found in the project root wins
+var projectKinds = []projectKind{
+	{marker: "go.mod", commands: types.ProjectCommands{
+		Test:     "go test ./...",
+		Build:    "go build ./... && go vet ./...",
+		Coverage: "go test -coverprofile={profile} ./...",
+		Lint:     "golangci-lint run {dirs}",
+	}},
+	{marker: "Cargo.toml", commands: types.ProjectCommands{
+		Test:     "cargo test",
+		Build:    "cargo build",
+		Coverage: "cargo llvm-cov --lcov --output-path {profile}",
+		Lint:     "cargo clippy --quiet",
+	}},
+	{marker: "package.json", commands: types.ProjectCommands{
+		Test:  "npm test",
+		Build: "npm run build --if-present",
+		Lint:  "npx eslint {files}",
+	}},
+	{marker: "pyproject.toml", commands: types.ProjectCommands{
+		Test:     "pytest",
+		Coverage: "pytest --cov --cov-report=lcov:{profile}",
+		Lint:     "ruff check --output-format=concise {files}",
+	}},
+	{marker: "setup.py", commands: types.ProjectCommands{
+		Test:     "pytest",
+		Coverage: "pytest --cov --cov-report=lcov:{profile}",
+		Lint:     "ruff check --output-format=concise {files}",
+	}},
+	{marker: "pom.xml", commands: types.ProjectCommands{
+		Test:  "mvn -q test",
+		Build: "mvn -q compile",
+	}},
+	{marker: "build.gradle", commands: types.ProjectCommands{
+		Test:  "./gradlew test",
+		Build: "./gradlew build -x test",
+	}},
+}
+
+// DetectCommands infers the project's commands from the build files in dir
+func DetectCommands(dir string) types.ProjectCommands {
+	for _, kind := range projectKinds {
+		if _, err := os.Stat(filepath.Join(dir, kind.marker)); err == nil {
+			return kind.commands
+		}
+	}
+	return types.ProjectCommands{}
+}
+
+// ResolveCommands returns the configured commands, filling unset ones with those detected in dir
+func ResolveCommands(dir string, configured types.ProjectCommands) types.ProjectCommands {
+	detected := DetectCommands(dir)
+	if configured.Test == "" {
+		configured.Test = detected.Test
+	}
+	if configured.Build == "" {
+		configured.Build = detected.Build
+	}
+	if configured.Coverage == "" {
+		configured.Coverage = detected.Coverage
+	}
+	if configured.Lint == "" {
+		configured.Lint = detected.Lint
+	}
+	return configured
+}
@@ -0,0 +1,265 @@
+package project
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxDocFiles bounds the files one /doc run covers
+const maxDocFiles = 20
+
+// docSourceExts are the files /doc documents in a directory
+var docSourceExts = map[string]bool{
+	".go": true, ".ts": true, ".tsx": true, ".js": true, ".jsx": true, ".py": true, ".rs": true,
+	".java": true, ".kt": true, ".rb": true, ".php": true, ".cs": true, ".swift": true, ".c": true, ".h": true, ".cpp": true, ".hpp": true,
+}
+
+var docStyleTopic = regexp.MustCompile(`(?i)\b(doc|docs|docstrings?|documentation|comments?|jsdoc|godoc|readme)\b`)
+
+// DocTarget is what /doc documents
+type DocTarget struct {
+	Dir          string   // Directory of the target, relative to the project root
+	Files        []string // Source files to document, relative to the project root
+	Undocumented []string // Exported Go declarations without a doc comment, as "file:line kind name"
+	MissingPkg   bool     // A Go package without a package comment
+	Readme       string   // README.md next to the target, if any
+}
+
+// ResolveDocTarget finds the files for /doc: a file, a directory, or a package named by the last
+// element of its directory (e.g. agent for pkg/agent)
+func ResolveDocTarget(root, target string) (*DocTarget, error) {
+	path := target
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, target)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		dir := findPackageDir(root, target)
+		if dir == "" {
+			return nil, fmt.Errorf("%s is neither a file, a directory nor a package name", target)
+		}
+		path = dir
+		info, err = os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t := &DocTarget{}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !docSourceExts[filepath.Ext(name)] || isTestFile(name) {
+				continue
+			}
+			t.Files = append(t.Files, relativeTo(root, filepath.Join(path, name)))
+		}
+		if len(t.Files) == 0 {
+			return nil, fmt.Errorf("no source files in %s", relativeTo(root, path))
+		}
+		if len(t.Files) > maxDocFiles {
+			t.Files = t.Files[:maxDocFiles]
+		}
+		t.Dir = relativeTo(root, path)
+	} else {
+		t.Files = []string{relativeTo(root, path)}
+		t.Dir = relativeTo(root, filepath.Dir(path))
+	}
+	if readme := filepath.Join(root, t.Dir, "README.md"); fileExists(readme) {
+		t.Readme = relativeTo(root, readme)
+	}
+	t.findUndocumented(root, info.IsDir())
+	return t, nil
+}
+
+// findUndocumented lists the exported Go declarations of the target files that lack a doc comment
+func (t *DocTarget) findUndocumented(root string, wholePackage bool) {
+	fset := token.NewFileSet()
+	hasPackageDoc, goFiles := false, 0
+	for _, file := range t.Files {
+		if filepath.Ext(file) != ".go" {
+			continue
+		}
+		parsed, err := parser.ParseFile(fset, filepath.Join(root, file), nil, parser.ParseComments)
+		if err != nil {
+			continue
+		}
+		goFiles++
+		if parsed.Doc != nil {
+			hasPackageDoc = true
+		}
+		missing := func(pos token.Pos, kind, name string) {
+			t.Undocumented = append(t.Undocumented, fmt.Sprintf("%s:%d %s %s", file, fset.Position(pos).Line, kind, name))
+		}
+		for _, decl := range parsed.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Name.IsExported() && d.Doc == nil && exportedReceiver(d) {
+					kind := "func"
+					if d.Recv != nil {
+						kind = "method"
+					}
+					missing(d.Pos(), kind, d.Name.Name)
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						if s.Name.IsExported() && s.Doc == nil && d.Doc == nil {
+							missing(s.Pos(), "type", s.Name.Name)
+						}
+					case *ast.ValueSpec:
+						// A comment on a const or var group documents its members
+						if s.Doc != nil || d.Doc != nil || d.Lparen.IsValid() && s.Comment != nil {
+							continue
+						}
+						for _, name := range s.Names {
+							if name.IsExported() {
+								missing(name.Pos(), d.Tok.String(), name.Name)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	t.MissingPkg = wholePackage && goFiles > 0 && !hasPackageDoc
+}
+
+// exportedReceiver reports whether a function is not a method of an unexported type
+func exportedReceiver(d *ast.FuncDecl) bool {
+	if d.Recv == nil || len(d.Recv.List) == 0 {
+		return true
+	}
+	expr := d.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if index, ok := expr.(*ast.IndexExpr); ok {
+		expr = index.X
+	}
+	ident, ok := expr.(*ast.Ident)
+	return !ok || ident.IsExported()
+}
+
+// DocStyle extracts the parts of AGENTS.md about documentation: sections whose heading mentions
+// docs or comments, and bullet points elsewhere that do
+func DocStyle(agentsContent string) string {
+	var sections, bullets []string
+	var current []string
+	inSection := false
+	flush := func() {
+		if inSection && len(current) > 1 {
+			sections = append(sections, strings.TrimSpace(strings.Join(current, "\n")))
+		}
+		current = nil
+	}
+	for _, line := range strings.Split(agentsContent, "\n") {
+		if strings.HasPrefix(line, "#") {
+			flush()
+			inSection = docStyleTopic.MatchString(line)
+			current = []string{line}
+			continue
+		}
+		if inSection {
+			current = append(current, line)
+		} else if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "- ") && docStyleTopic.MatchString(trimmed) {
+			bullets = append(bullets, trimmed)
+		}
+	}
+	flush()
+	return strings.TrimSpace(strings.Join(append(sections, bullets...), "\n\n"))
+}
+
+// Prompt asks the agent to document the target, following the style guide when there is one
+func (t *DocTarget) Prompt(style string) string {
+	var b strings.Builder
+	subject := t.Dir
+	if len(t.Files) == 1 {
+		subject = t.Files[0]
+	}
+	fmt.Fprintf(&b, "Write or update the documentation of %s.\n\n", subject)
+	b.WriteString("- Add doc comments (or docstrings) to the public functions, types, methods and constants that lack them, and fix existing ones that no longer match the code.\n")
+	b.WriteString("- Describe what each item does and anything a caller must know; do not restate the signature or narrate the implementation.\n")
+	b.WriteString("- Only change comments and documentation, never code. Use edit_file for each change so it can be reviewed as a diff.\n")
+	if t.Readme != "" {
+		fmt.Fprintf(&b, "- Update the sections of %s that describe this code if they are out of date.\n", t.Readme)
+	}
+
+	if style != "" {
+		fmt.Fprintf(&b, "\nFollow the documentation conventions from AGENTS.md:\n%s\n", style)
+	} else {
+		b.WriteString("\nMatch the style of the existing doc comments in these files and their neighbours: length, tone, and whether comments are full sentences.\n")
+	}
+
+	fmt.Fprintf(&b, "\nFiles:\n")
+	for _, file := range t.Files {
+		fmt.Fprintf(&b, "- %s\n", file)
+	}
+	if t.MissingPkg {
+		b.WriteString("\nThe package has no package comment; add one to its main file.\n")
+	}
+	if len(t.Undocumented) > 0 {
+		b.WriteString("\nExported declarations without a doc comment:\n")
+		for _, item := range t.Undocumented {
+			fmt.Fprintf(&b, "- %s\n", item)
+		}
+	}
+	return b.String()
+}
+
+// findPackageDir finds the directory whose name is the package name, preferring the shallowest
+func findPackageDir(root, name string) string {
+	if strings.ContainsAny(name, `/\`) {
+		return ""
+	}
+	var found []string
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		base := d.Name()
+		if path != root && (strings.HasPrefix(base, ".") || base == "node_modules" || base == "vendor") {
+			return filepath.SkipDir
+		}
+		if base == name && path != root {
+			found = append(found, path)
+		}
+		return nil
+	})
+	sort.Slice(found, func(i, j int) bool {
+		return strings.Count(found[i], string(filepath.Separator)) < strings.Count(found[j], string(filepath.Separator))
+	})
+	if len(found) == 0 {
+		return ""
+	}
+	return found[0]
+}
+
+func isTestFile(name string) bool {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.HasSuffix(base, "_test") || strings.HasSuffix(base, ".test") || strings.HasSuffix(base, ".spec") || strings.HasPrefix(name, "test_")
+}
+
+func relativeTo(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,95 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveDocTarget(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "pkg", "store")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"store.go": `package store
+
+// Store keeps values
+type Store struct{}
+
+func (s *Store) Get(key string) string { return "" }
+
+type cache struct{}
+
+func (c *cache) Put() {}
+
+const (
+	// Limit bounds the store
+	Limit = 10
+)
+
+var Default = &Store{}
+`,
+		"store_test.go": "package store\n",
+		"README.md":     "# store\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	target, err := ResolveDocTarget(root, "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeFile := filepath.Join("pkg", "store", "store.go")
+	if len(target.Files) != 1 || target.Files[0] != storeFile {
+		t.Fatalf("Files = %v, want only %s", target.Files, storeFile)
+	}
+	if target.Readme != filepath.Join("pkg", "store", "README.md") {
+		t.Errorf("Readme = %q", target.Readme)
+	}
+	if !target.MissingPkg {
+		t.Error("expected the missing package comment to be reported")
+	}
+	want := []string{storeFile + ":6 method Get", storeFile + ":17 var Default"}
+	if strings.Join(target.Undocumented, "|") != strings.Join(want, "|") {
+		t.Errorf("Undocumented = %v, want %v", target.Undocumented, want)
+	}
+
+	if _, err := ResolveDocTarget(root, "missing"); err == nil {
+		t.Error("expected an error for an unknown target")
+	}
+}
+
+func TestDocStyle(t *testing.T) {
+	agents := `# Project
+
+- Run go test before committing
+- Doc comments are one line and have no trailing period
+
+## Documentation
+
+Start comments with the name of the item.
+
+## Build
+
+make build
+`
+	style := DocStyle(agents)
+	if !strings.Contains(style, "## Documentation\n\nStart comments with the name of the item.") {
+		t.Errorf("missing the documentation section: %q", style)
+	}
+	if !strings.Contains(style, "- Doc comments are one line") {
+		t.Errorf("missing the doc bullet: %q", style)
+	}
+	if strings.Contains(style, "make build") || strings.Contains(style, "go test") {
+		t.Errorf("unrelated lines included: %q", style)
+	}
+	if DocStyle("# Build\n\nmake\n") != "" {
+		t.Error("expected no style without documentation guidance")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -43,7 +45,7 @@ func (m *Manager) LoadProjectContext() {
 				Role:    openai.ChatMessageRoleSystem,
 				Content: "Project context from AGENTS.md:\n\n" + agentsContent,
 			}
-			m.agent.Conversation = append(m.agent.Conversation, systemMsg)
+			m.agent.AddMessage(systemMsg)
 		}
 	}
 }
@@ -148,37 +150,113 @@ func (m *Manager) AddPermanentInstruction(instruction string) error {
 	return os.WriteFile(agentsFile, []byte(content), 0644)
 }
 
-// ExportContext exports conversation context to a file
-func (m *Manager) ExportContext(parts []string) error {
-	if len(m.agent.Conversation) == 0 {
-		fmt.Println("❌ No conversation context to export")
-		return nil
-	}
+// ExportOptions select what /export writes
+type ExportOptions struct {
+	Filename string          // Empty when none was given
+	NoTools  bool            // Leave out tool calls and tool results
+	Last     int             // Only the last N exported messages; 0 for all
+	Roles    map[string]bool // Only these roles; nil for all
+}
 
-	// Determine filename
-	filename := "context.txt"
-	if len(parts) > 1 {
-		filename = parts[1]
-		if !strings.HasSuffix(filename, ".txt") {
-			filename += ".txt"
+// exportRoles are the roles --role accepts
+var exportRoles = []string{
+	openai.ChatMessageRoleSystem,
+	openai.ChatMessageRoleUser,
+	openai.ChatMessageRoleAssistant,
+	openai.ChatMessageRoleTool,
+}
+
+// ParseExportArgs parses `[filename] [--no-tools] [--last N] [--role user,assistant]`
+func ParseExportArgs(args []string) (ExportOptions, error) {
+	var opts ExportOptions
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "--no-tools":
+			opts.NoTools = true
+		case "--last":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("--last needs a number of messages")
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				return opts, fmt.Errorf("--last needs a positive number, got %q", args[i])
+			}
+			opts.Last = n
+		case "--role", "--roles":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("--role needs a comma-separated list of roles")
+			}
+			i++
+			opts.Roles = make(map[string]bool)
+			for _, role := range strings.Split(args[i], ",") {
+				role = strings.ToLower(strings.TrimSpace(role))
+				if !slices.Contains(exportRoles, role) {
+					return opts, fmt.Errorf("unknown role %q (use %s)", role, strings.Join(exportRoles, ", "))
+				}
+				opts.Roles[role] = true
+			}
+		default:
+			if strings.HasPrefix(arg, "--") {
+				return opts, fmt.Errorf("unknown option %s", arg)
+			}
+			if opts.Filename != "" {
+				return opts, fmt.Errorf("unexpected argument %s", arg)
+			}
+			opts.Filename = arg
+			if !strings.HasSuffix(opts.Filename, ".txt") {
+				opts.Filename += ".txt"
+			}
 		}
 	}
+	return opts, nil
+}
 
-	fmt.Printf("📤 Exporting context to %s...\n", filename)
+// FilterMessages returns the messages an export with opts includes
+func FilterMessages(messages []types.Message, opts ExportOptions) []types.Message {
+	var result []types.Message
+	for _, msg := range messages {
+		if opts.Roles != nil && !opts.Roles[msg.Role] {
+			continue
+		}
+		if opts.NoTools {
+			if msg.Role == openai.ChatMessageRoleTool {
+				continue
+			}
+			if len(msg.ToolCalls) > 0 {
+				msg.ToolCalls = nil
+				// Assistant turns that only called tools have nothing left to show
+				if strings.TrimSpace(msg.Content) == "" {
+					continue
+				}
+			}
+		}
+		result = append(result, msg)
+	}
+	if opts.Last > 0 && len(result) > opts.Last {
+		result = result[len(result)-opts.Last:]
+	}
+	return result
+}
 
-	// Format the conversation
+// FormatTranscript renders messages as the plain-text transcript /export writes. The header
+// notes when messages is a filtered subset of the agent's conversation.
+func FormatTranscript(agent *types.Agent, messages []types.Message) string {
 	var content strings.Builder
 	content.WriteString(fmt.Sprintf("# MCode CLI Context Export\n"))
 	content.WriteString(fmt.Sprintf("Exported: %s\n", time.Now().Format("2006-01-02 15:04:05")))
 
-	if m.agent.LastTokenUsage != nil {
-		content.WriteString(fmt.Sprintf("Context Tokens: %d\n", m.agent.LastTokenUsage.PromptTokens))
-		content.WriteString(fmt.Sprintf("Total Session Tokens: %d\n", m.agent.TotalTokensUsed))
+	if usage := agent.TokenUsage(); usage != nil {
+		content.WriteString(fmt.Sprintf("Context Tokens: %d\n", usage.PromptTokens))
+		content.WriteString(fmt.Sprintf("Total Session Tokens: %d\n", agent.SessionTokens()))
+	}
+	if total := len(agent.Messages()); len(messages) < total {
+		content.WriteString(fmt.Sprintf("Filtered: %d of %d messages\n", len(messages), total))
 	}
 
 	content.WriteString("\n" + strings.Repeat("=", 80) + "\n\n")
 
-	for i, msg := range m.agent.Conversation {
+	for i, msg := range messages {
 		// Add separator between messages
 		if i > 0 {
 			content.WriteString("\n" + strings.Repeat("-", 40) + "\n\n")
@@ -216,19 +294,50 @@ func (m *Manager) ExportContext(parts []string) error {
 	}
 
 	content.WriteString("\n" + strings.Repeat("=", 80) + "\n")
-	content.WriteString(fmt.Sprintf("End of context export (%d messages)\n", len(m.agent.Conversation)))
+	content.WriteString(fmt.Sprintf("End of context export (%d messages)\n", len(messages)))
+
+	return content.String()
+}
+
+// ExportContext exports conversation context to a file
+func (m *Manager) ExportContext(parts []string) error {
+	conversation := m.agent.Messages()
+	if len(conversation) == 0 {
+		fmt.Println("❌ No conversation context to export")
+		return nil
+	}
+
+	opts, err := ParseExportArgs(parts[1:])
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		fmt.Println("Usage: /export [filename] [--no-tools] [--last N] [--role user,assistant]")
+		return nil
+	}
+	filename := opts.Filename
+	if filename == "" {
+		filename = "context.txt"
+	}
+	messages := FilterMessages(conversation, opts)
+	if len(messages) == 0 {
+		fmt.Println("❌ No messages match the export filters")
+		return nil
+	}
+
+	fmt.Printf("📤 Exporting context to %s...\n", filename)
+
+	content := FormatTranscript(m.agent, messages)
 
 	// Write to file
-	err := os.WriteFile(filename, []byte(content.String()), 0644)
+	err = os.WriteFile(filename, []byte(content), 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write export file: %v", err)
 	}
 
 	fmt.Printf("✅ Context exported successfully!\n")
 	fmt.Printf("📄 File: %s\n", filename)
-	fmt.Printf("📊 Messages: %d\n", len(m.agent.Conversation))
-	if m.agent.LastTokenUsage != nil {
-		fmt.Printf("🔢 Context tokens: %d\n", m.agent.LastTokenUsage.PromptTokens)
+	fmt.Printf("📊 Messages: %d\n", len(messages))
+	if usage := m.agent.TokenUsage(); usage != nil {
+		fmt.Printf("🔢 Context tokens: %d\n", usage.PromptTokens)
 	}
 
 	return nil
@@ -260,11 +369,13 @@ func (m *Manager) Initialize() error {
 
 	fmt.Println("🔍 Analyzing project structure and inferring coding standards...")
 
-	// For now, use basic template - LLM analysis can be added later
-	llmAnalysis := ""
-
+	llmAnalysis, err := m.analyzeProject(cwd)
+	if err != nil {
+		fmt.Printf("⚠️  Project analysis failed (%v), using basic template\n", err)
+		return m.CreateBasicAgentsMD(projectName, cwd)
+	}
 	if llmAnalysis == "" {
-		fmt.Println("⚠️  Using basic template - LLM analysis can be implemented later")
+		fmt.Println("⚠️  Project analysis came back empty, using basic template")
 		return m.CreateBasicAgentsMD(projectName, cwd)
 	}
 
@@ -0,0 +1,70 @@
+package project
+
+import (
+	"testing"
+
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestExportFilters(t *testing.T) {
+	conversation := []types.Message{
+		{Role: openai.ChatMessageRoleSystem, Content: "system prompt"},
+		{Role: openai.ChatMessageRoleUser, Content: "fix the bug"},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "1"}}},
+		{Role: openai.ChatMessageRoleTool, Content: "file contents", ToolCallID: "1"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "Looking closer.", ToolCalls: []openai.ToolCall{{ID: "2"}}},
+		{Role: openai.ChatMessageRoleTool, Content: "more output", ToolCallID: "2"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "Fixed."},
+		{Role: openai.ChatMessageRoleUser, Content: "thanks"},
+	}
+
+	contents := func(args ...string) []string {
+		t.Helper()
+		opts, err := ParseExportArgs(args)
+		if err != nil {
+			t.Fatalf("ParseExportArgs(%v): %v", args, err)
+		}
+		var result []string
+		for _, msg := range FilterMessages(conversation, opts) {
+			if len(msg.ToolCalls) > 0 {
+				result = append(result, msg.Content+"+calls")
+				continue
+			}
+			result = append(result, msg.Content)
+		}
+		return result
+	}
+	expect := func(got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		}
+	}
+
+	expect(contents("--no-tools"), "system prompt", "fix the bug", "Looking closer.", "Fixed.", "thanks")
+	expect(contents("--role", "user"), "fix the bug", "thanks")
+	expect(contents("--role", "user,assistant", "--no-tools", "--last", "2"), "Fixed.", "thanks")
+	expect(contents("--last", "3"), "more output", "Fixed.", "thanks")
+	expect(contents("--role", "assistant"), "+calls", "Looking closer.+calls", "Fixed.")
+
+	if len(conversation[4].ToolCalls) == 0 {
+		t.Error("filtering modified the conversation")
+	}
+
+	opts, err := ParseExportArgs([]string{"notes", "--no-tools"})
+	if err != nil || opts.Filename != "notes.txt" || !opts.NoTools {
+		t.Errorf("ParseExportArgs(notes --no-tools) = %+v, %v", opts, err)
+	}
+	for _, bad := range [][]string{{"--last"}, {"--last", "0"}, {"--role", "robot"}, {"--verbose"}, {"a", "b"}} {
+		if _, err := ParseExportArgs(bad); err == nil {
+			t.Errorf("ParseExportArgs(%q) should fail", bad)
+		}
+	}
+}
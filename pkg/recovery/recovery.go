@@ -0,0 +1,175 @@
+// Package recovery keeps a copy of the in-flight session on disk so it can be restored after a
+// crash. The interactive session saves a snapshot every turn and removes it on a clean exit, so a
+// snapshot found at startup means the previous session in that directory did not exit normally.
+package recovery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"coding-agent/pkg/conversation"
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Snapshot is the state saved for recovery
+type Snapshot struct {
+	Dir        string                 `json:"dir"`
+	SavedAt    time.Time              `json:"saved_at"`
+	Model      string                 `json:"model"`
+	ConvID     string                 `json:"conversation_id,omitempty"` // Saved conversation the session continued
+	TokensUsed int                    `json:"tokens_used,omitempty"`
+	Messages   []conversation.Message `json:"messages"`
+}
+
+// NotExecuted is the tool result recorded on restore for tool calls that never ran
+const NotExecuted = "Not executed: mcode exited before this tool call ran. Check the current state of the files and repeat the call if it is still needed."
+
+// recoveryDir returns ~/.mcode/recovery
+func recoveryDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".mcode", "recovery"), nil
+}
+
+// Path returns the recovery file for sessions started in dir
+func Path(dir string) (string, error) {
+	base, err := recoveryDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(filepath.Clean(dir)))
+	return filepath.Join(base, hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// Save writes a snapshot of the agent's session for the current directory. The file is replaced
+// atomically so a crash while saving keeps the previous snapshot.
+func Save(a *types.Agent) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	path, err := Path(dir)
+	if err != nil {
+		return err
+	}
+	snapshot := Snapshot{
+		Dir:        dir,
+		SavedAt:    time.Now(),
+		Model:      a.ModelKey(),
+		ConvID:     a.CurrentConvID,
+		TokensUsed: a.SessionTokens(),
+		Messages:   conversation.FromAgentMessages(a.Messages()),
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load returns the snapshot left for dir, or nil when there is none
+func Load(dir string) (*Snapshot, error) {
+	path, err := Path(dir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("corrupt recovery file %s: %v", path, err)
+	}
+	return &snapshot, nil
+}
+
+// Clear removes the snapshot for dir
+func Clear(dir string) {
+	if path, err := Path(dir); err == nil {
+		os.Remove(path)
+	}
+}
+
+// HasConversation reports whether the snapshot holds anything beyond the system prompt
+func (s *Snapshot) HasConversation() bool {
+	for _, msg := range s.Messages {
+		if msg.Role != openai.ChatMessageRoleSystem {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingCalls returns the tool calls that were requested but have no result, such as an edit
+// that was waiting for approval when the session ended
+func (s *Snapshot) PendingCalls() []conversation.ToolCall {
+	answered := make(map[string]bool)
+	for _, msg := range s.Messages {
+		if msg.Role == openai.ChatMessageRoleTool {
+			answered[msg.ToolID] = true
+		}
+	}
+	var pending []conversation.ToolCall
+	for _, msg := range s.Messages {
+		for _, call := range msg.ToolCalls {
+			if !answered[call.ID] {
+				pending = append(pending, call)
+			}
+		}
+	}
+	return pending
+}
+
+// Restore loads the snapshot's conversation into the agent; switching to s.Model is left to the
+// caller. Pending tool calls get a NotExecuted result right
+// after the message that requested them, so the conversation stays valid for the model.
+func Restore(a *types.Agent, s *Snapshot) {
+	pending := make(map[string]bool)
+	for _, call := range s.PendingCalls() {
+		pending[call.ID] = true
+	}
+
+	var messages []conversation.Message
+	for i := 0; i < len(s.Messages); i++ {
+		msg := s.Messages[i]
+		messages = append(messages, msg)
+		if len(msg.ToolCalls) == 0 {
+			continue
+		}
+		// Keep the results of the calls that did run, then add the missing ones
+		for i+1 < len(s.Messages) && s.Messages[i+1].Role == openai.ChatMessageRoleTool {
+			i++
+			messages = append(messages, s.Messages[i])
+		}
+		for _, call := range msg.ToolCalls {
+			if pending[call.ID] {
+				messages = append(messages, conversation.Message{Role: openai.ChatMessageRoleTool, ToolID: call.ID, Content: NotExecuted})
+			}
+		}
+	}
+	a.SetMessages(conversation.ToAgentMessages(messages))
+	a.SetSessionTokens(s.TokensUsed)
+	a.CurrentConvID = s.ConvID
+}
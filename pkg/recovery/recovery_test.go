@@ -0,0 +1,59 @@
+package recovery
+
+import (
+	"os"
+	"testing"
+
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestSaveLoadRestore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir, _ := os.Getwd()
+
+	if s, err := Load(dir); s != nil || err != nil {
+		t.Fatalf("Load() without a snapshot = %v, %v", s, err)
+	}
+
+	call := func(id string) openai.ToolCall {
+		return openai.ToolCall{ID: id, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "edit_file", Arguments: "{}"}}
+	}
+	a := &types.Agent{Config: &types.Config{CurrentModel: "local"}, TotalTokensUsed: 42}
+	a.Conversation = []types.Message{
+		{Role: openai.ChatMessageRoleSystem, Content: "system"},
+		{Role: openai.ChatMessageRoleUser, Content: "fix the bug"},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{call("a"), call("b")}},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "a", Content: "done"},
+	}
+	if err := Save(a); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+
+	s, err := Load(dir)
+	if err != nil || s == nil {
+		t.Fatalf("Load() = %v, %v", s, err)
+	}
+	if !s.HasConversation() || s.Model != "local" || s.TokensUsed != 42 {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+	if pending := s.PendingCalls(); len(pending) != 1 || pending[0].ID != "b" {
+		t.Fatalf("PendingCalls() = %+v", pending)
+	}
+
+	restored := &types.Agent{Config: &types.Config{}}
+	Restore(restored, s)
+	if len(restored.Conversation) != 5 || restored.TotalTokensUsed != 42 {
+		t.Fatalf("restored %d messages", len(restored.Conversation))
+	}
+	last := restored.Conversation[4]
+	if last.Role != openai.ChatMessageRoleTool || last.ToolCallID != "b" || last.Content != NotExecuted {
+		t.Errorf("missing result for the pending call: %+v", last)
+	}
+
+	Clear(dir)
+	if s, _ := Load(dir); s != nil {
+		t.Error("snapshot still present after Clear")
+	}
+}
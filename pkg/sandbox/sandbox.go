@@ -0,0 +1,128 @@
+// Package sandbox runs commands under operating-system restrictions, so the folder permission model
+// holds for whatever a shell command does rather than only for the paths mcode can see. Linux uses
+// Landlock for the file system and a seccomp filter for the network; macOS uses sandbox-exec.
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Policy is what a sandboxed command may access
+type Policy struct {
+	Writable    []string `json:"writable"`               // Folders (or files) the command may modify
+	Readable    []string `json:"readable,omitempty"`     // When set, the only folders besides Writable it may read
+	DenyNetwork bool     `json:"deny_network,omitempty"` // Block IP networking; local sockets keep working
+}
+
+// HelperCommand is the hidden mcode subcommand that applies a policy to itself and then executes
+// the command. Landlock and seccomp only restrict the calling process and what it executes, so on
+// Linux the restrictions are applied by mcode re-executing itself in front of the command.
+const HelperCommand = "__sandbox"
+
+// SystemReadable are the folders programs need to read when reads are restricted. /etc is a denied
+// folder by default, so only the files in it that programs need to start, look up users and hosts
+// and verify certificates are readable rather than all of it.
+var SystemReadable = []string{
+	"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/opt", "/nix", "/proc", "/sys", "/dev", "/run",
+	"/var/lib", "/System", "/Library", "/Applications", "/private/var/db", "/var/select",
+	"/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d", "/etc/alternatives", "/etc/localtime",
+	"/etc/passwd", "/etc/group", "/etc/nsswitch.conf", "/etc/hosts", "/etc/resolv.conf", "/etc/ssl",
+	"/etc/pki", "/etc/ca-certificates", "/etc/profile", "/etc/bash.bashrc", "/etc/inputrc",
+	"/private/etc/passwd", "/private/etc/group", "/private/etc/hosts", "/private/etc/ssl", "/private/etc/localtime",
+}
+
+// DeviceWritable are the devices commands commonly write to
+var DeviceWritable = []string{"/dev/null", "/dev/zero", "/dev/tty", "/dev/pts", "/dev/ptmx", "/dev/shm", "/dev/fd"}
+
+// normalize makes paths absolute, resolves symlinks (sandbox rules apply to real paths) and drops
+// paths that do not exist and duplicates
+func normalize(paths []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if strings.HasPrefix(p, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				p = filepath.Join(home, p[2:])
+			}
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		real, err := filepath.EvalSymlinks(abs)
+		if err != nil {
+			continue
+		}
+		if !seen[real] {
+			seen[real] = true
+			out = append(out, real)
+		}
+	}
+	return out
+}
+
+// Allows reports whether the policy lets a command write path, or read it when write is false.
+// Paths are compared with symlinks resolved; one that does not exist yet is judged by the folder it
+// would be created in.
+func (p Policy) Allows(path string, write bool) bool {
+	real := resolve(path)
+	if real == "" {
+		return false
+	}
+	folders := p.Writable
+	if !write {
+		if p.Readable == nil {
+			return true
+		}
+		folders = append(append([]string{}, p.Writable...), p.Readable...)
+	}
+	for _, folder := range normalize(folders) {
+		if real == folder || strings.HasPrefix(real, strings.TrimSuffix(folder, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns path made absolute with the symlinks of its existing part resolved, or "" when
+// that fails
+func resolve(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	var rest []string
+	for {
+		real, err := filepath.EvalSymlinks(abs)
+		if err == nil {
+			return filepath.Join(append([]string{real}, rest...)...)
+		}
+		parent := filepath.Dir(abs)
+		if !os.IsNotExist(err) || parent == abs {
+			return ""
+		}
+		rest = append([]string{filepath.Base(abs)}, rest...)
+		abs = parent
+	}
+}
+
+// encode serializes a policy for the helper's command line
+func (p Policy) encode() string {
+	data, _ := json.Marshal(p)
+	return string(data)
+}
+
+func decodePolicy(s string) (Policy, error) {
+	var p Policy
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return p, fmt.Errorf("invalid sandbox policy: %v", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,57 @@
+package sandbox
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Available reports why commands cannot be sandboxed here, or nil if they can
+func Available() error {
+	if _, err := exec.LookPath("sandbox-exec"); err != nil {
+		return fmt.Errorf("sandbox-exec was not found")
+	}
+	return nil
+}
+
+// Wrap returns argv changed to run under policy
+func Wrap(policy Policy, argv []string) ([]string, error) {
+	if err := Available(); err != nil {
+		return nil, err
+	}
+	return append([]string{"sandbox-exec", "-p", profile(policy)}, argv...), nil
+}
+
+// RunHelper is only needed on Linux
+func RunHelper(args []string) error {
+	return fmt.Errorf("mcode %s is only used on Linux", HelperCommand)
+}
+
+// profile renders policy in the sandbox profile language
+func profile(policy Policy) string {
+	var b strings.Builder
+	b.WriteString("(version 1)\n(allow default)\n")
+
+	b.WriteString("(deny file-write*)\n(allow file-write*")
+	for _, path := range normalize(policy.Writable) {
+		fmt.Fprintf(&b, " (subpath %s)", quote(path))
+	}
+	b.WriteString(" (regex #\"^/dev/(null|zero|tty|ttys[0-9]+|fd/[0-9]+|dtracehelper)$\"))\n")
+
+	if len(policy.Readable) > 0 {
+		b.WriteString("(deny file-read*)\n(allow file-read* (literal \"/\")")
+		for _, path := range normalize(append(append([]string{}, policy.Readable...), policy.Writable...)) {
+			fmt.Fprintf(&b, " (subpath %s)", quote(path))
+		}
+		b.WriteString(")\n")
+	}
+
+	if policy.DenyNetwork {
+		b.WriteString("(deny network-outbound (remote ip))\n(deny network-bind (local ip))\n")
+	}
+	return b.String()
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,190 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Landlock file system rights, by the ABI version that introduced them
+const (
+	fsRead  = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR
+	fsWrite = unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_REMOVE_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR | unix.LANDLOCK_ACCESS_FS_MAKE_DIR | unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SOCK | unix.LANDLOCK_ACCESS_FS_MAKE_FIFO | unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM
+	fsReferV2    = unix.LANDLOCK_ACCESS_FS_REFER
+	fsTruncateV3 = unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	fsIoctlV5    = unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+	// Rights that can be granted on a file rather than a directory
+	fsFileRights = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE | unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+)
+
+// landlockABI returns the Landlock version the kernel supports, 0 without Landlock
+func landlockABI() int {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return 0
+	}
+	return int(abi)
+}
+
+// Available reports why commands cannot be sandboxed here, or nil if they can
+func Available() error {
+	if landlockABI() < 1 {
+		return fmt.Errorf("the kernel does not support Landlock (Linux 5.13 or later with Landlock enabled is required)")
+	}
+	return nil
+}
+
+// Wrap returns argv changed to run under policy
+func Wrap(policy Policy, argv []string) ([]string, error) {
+	if err := Available(); err != nil {
+		return nil, err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate mcode to apply the sandbox: %v", err)
+	}
+	return append([]string{self, HelperCommand, policy.encode(), "--"}, argv...), nil
+}
+
+// RunHelper implements HelperCommand: `<policy> -- <command...>`. It only returns on failure.
+func RunHelper(args []string) error {
+	if len(args) < 3 || args[1] != "--" {
+		return fmt.Errorf("usage: mcode %s <policy> -- <command...>", HelperCommand)
+	}
+	policy, err := decodePolicy(args[0])
+	if err != nil {
+		return err
+	}
+	argv := args[2:]
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+
+	// Both restrictions apply to the calling thread, which must be the one that executes the command
+	runtime.LockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("sandbox: %v", err)
+	}
+	if err := restrictFiles(policy); err != nil {
+		return fmt.Errorf("sandbox: %v", err)
+	}
+	if policy.DenyNetwork {
+		if err := denyNetwork(); err != nil {
+			return fmt.Errorf("sandbox: %v", err)
+		}
+	}
+	return unix.Exec(path, argv, os.Environ())
+}
+
+// restrictFiles limits writing to policy.Writable and, when policy.Readable is set, reading to
+// Readable and Writable
+func restrictFiles(policy Policy) error {
+	abi := landlockABI()
+	write := uint64(fsWrite)
+	if abi >= 2 {
+		write |= fsReferV2
+	}
+	if abi >= 3 {
+		write |= fsTruncateV3
+	}
+	if abi >= 5 {
+		write |= fsIoctlV5
+	}
+	handled := write
+	if len(policy.Readable) > 0 {
+		handled |= fsRead
+	}
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	// Older kernels only know the file system field
+	size := unsafe.Sizeof(attr.Access_fs)
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), size, 0)
+	if errno != 0 {
+		return fmt.Errorf("creating the Landlock ruleset: %v", errno)
+	}
+	ruleset := int(fd)
+	defer unix.Close(ruleset)
+
+	for _, path := range normalize(policy.Readable) {
+		if err := addPathRule(ruleset, path, fsRead&handled); err != nil {
+			return err
+		}
+	}
+	for _, path := range normalize(policy.Writable) {
+		if err := addPathRule(ruleset, path, handled); err != nil {
+			return err
+		}
+	}
+
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("applying the Landlock ruleset: %v", errno)
+	}
+	return nil
+}
+
+func addPathRule(ruleset int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil // Gone since it was normalized; nothing to allow
+	}
+	defer unix.Close(fd)
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err == nil && st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= fsFileRights
+	}
+	if access == 0 {
+		return nil
+	}
+	rule := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+	_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("allowing %s: %v", path, errno)
+	}
+	return nil
+}
+
+// denyNetwork installs a seccomp filter that makes creating IPv4 and IPv6 sockets fail with
+// EACCES. Unix sockets keep working.
+func denyNetwork() error {
+	var arch uint32
+	switch runtime.GOARCH {
+	case "amd64":
+		arch = unix.AUDIT_ARCH_X86_64
+	case "arm64":
+		arch = unix.AUDIT_ARCH_AARCH64
+	default:
+		return fmt.Errorf("denying network access is not supported on %s", runtime.GOARCH)
+	}
+
+	const (
+		archOffset = 4  // seccomp_data.arch
+		nrOffset   = 0  // seccomp_data.nr
+		arg0Offset = 16 // seccomp_data.args[0], low half on little-endian
+		x32Bit     = 0x40000000
+	)
+	deny := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EACCES))
+	filter := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: archOffset},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, Jf: 0, K: arch},
+		{Code: unix.BPF_RET | unix.BPF_K, K: deny}, // Other syscall ABIs could bypass the checks below
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: nrOffset},
+		{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jt: 5, Jf: 0, K: x32Bit},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 3, K: unix.SYS_SOCKET},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: arg0Offset},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 2, Jf: 0, K: unix.AF_INET},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, Jf: 0, K: unix.AF_INET6},
+		{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ALLOW},
+		{Code: unix.BPF_RET | unix.BPF_K, K: deny},
+	}
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	return unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0)
+}
@@ -0,0 +1,94 @@
+package sandbox
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// The test binary stands in for mcode as the sandbox helper
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == HelperCommand {
+		if err := RunHelper(os.Args[2:]); err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(126)
+		}
+	}
+	os.Exit(m.Run())
+}
+
+func runSandboxed(t *testing.T, policy Policy, script string) error {
+	t.Helper()
+	argv, err := Wrap(policy, []string{"bash", "-c", script})
+	if err != nil {
+		t.Fatalf("Wrap() = %v", err)
+	}
+	out, err := exec.Command(argv[0], argv[1:]...).CombinedOutput()
+	if err != nil {
+		t.Logf("%s", out)
+	}
+	return err
+}
+
+func TestSandbox(t *testing.T) {
+	if err := Available(); err != nil {
+		t.Skip(err)
+	}
+	allowed, denied := t.TempDir(), t.TempDir()
+	policy := Policy{Writable: append([]string{allowed}, DeviceWritable...)}
+
+	if err := runSandboxed(t, policy, "echo ok > "+filepath.Join(allowed, "f")+" && cat "+filepath.Join(allowed, "f")+" >/dev/null"); err != nil {
+		t.Errorf("writing to an allowed folder failed: %v", err)
+	}
+	if err := runSandboxed(t, policy, "echo no > "+filepath.Join(denied, "f")); err == nil {
+		t.Error("writing outside the allowed folders succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(denied, "f")); err == nil {
+		t.Error("file created outside the allowed folders")
+	}
+	os.WriteFile(filepath.Join(denied, "secret"), []byte("x"), 0644)
+	if err := runSandboxed(t, policy, "cat "+filepath.Join(denied, "secret")); err != nil {
+		t.Errorf("reading without read restrictions failed: %v", err)
+	}
+
+	readOnly := policy
+	readOnly.Readable = SystemReadable
+	if err := runSandboxed(t, readOnly, "cat "+filepath.Join(denied, "secret")); err == nil {
+		t.Error("reading outside the readable folders succeeded")
+	}
+	if _, err := os.Stat("/etc/hostname"); err == nil {
+		if err := runSandboxed(t, readOnly, "cat /etc/hostname"); err == nil {
+			t.Error("reading /etc beyond the files programs need succeeded")
+		}
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	connect := "exec 3<>/dev/tcp/127.0.0.1/" + portOf(listener)
+	if err := runSandboxed(t, policy, connect); err != nil {
+		t.Errorf("connecting with the network allowed failed: %v", err)
+	}
+	policy.DenyNetwork = true
+	if err := runSandboxed(t, policy, connect); err == nil {
+		t.Error("connecting with the network denied succeeded")
+	}
+}
+
+func portOf(l net.Listener) string {
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
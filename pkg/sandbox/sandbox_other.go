@@ -0,0 +1,23 @@
+//go:build !linux && !darwin
+
+package sandbox
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Available reports why commands cannot be sandboxed here, or nil if they can
+func Available() error {
+	return fmt.Errorf("sandboxing is not supported on %s", runtime.GOOS)
+}
+
+// Wrap returns argv changed to run under policy
+func Wrap(policy Policy, argv []string) ([]string, error) {
+	return nil, Available()
+}
+
+// RunHelper is only needed on Linux
+func RunHelper(args []string) error {
+	return Available()
+}
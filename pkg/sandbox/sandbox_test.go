@@ -0,0 +1,49 @@
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	root := t.TempDir()
+	work := filepath.Join(root, "work")
+	docs := filepath.Join(root, "docs")
+	for _, dir := range []string{work, docs} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(docs, filepath.Join(work, "docs-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := Policy{Writable: []string{work}}
+	tests := []struct {
+		path  string
+		write bool
+		want  bool
+	}{
+		{filepath.Join(work, "main.go"), true, true},
+		{filepath.Join(work, "new", "dir", "file.go"), true, true},
+		{filepath.Join(docs, "notes.md"), true, false},
+		{filepath.Join(work, "docs-link", "notes.md"), true, false},
+		{filepath.Join(work, "..", "docs", "notes.md"), true, false},
+		{work + "-other", true, false},
+		{filepath.Join(docs, "notes.md"), false, true},
+	}
+	for _, tt := range tests {
+		if got := policy.Allows(tt.path, tt.write); got != tt.want {
+			t.Errorf("Allows(%q, write=%v) = %v, want %v", tt.path, tt.write, got, tt.want)
+		}
+	}
+
+	policy.Readable = []string{filepath.Join(root, "nowhere")}
+	if policy.Allows(filepath.Join(docs, "notes.md"), false) {
+		t.Error("expected reads outside Writable and Readable to be refused once reads are restricted")
+	}
+	if !policy.Allows(filepath.Join(work, "main.go"), false) {
+		t.Error("expected writable folders to stay readable")
+	}
+}
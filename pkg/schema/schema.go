@@ -0,0 +1,212 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Validate checks a decoded JSON value against a JSON schema.
+// It covers the subset used by tool and response schemas: type, properties, required,
+// additionalProperties, items and enum. All problems are reported in a single error.
+func Validate(schema map[string]interface{}, value interface{}) error {
+	problems := validate(schema, value, "$")
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(problems, "; "))
+}
+
+func validate(schema map[string]interface{}, value interface{}, path string) []string {
+	if schema == nil {
+		return nil
+	}
+
+	types := stringList(schema["type"])
+	if len(types) > 0 && !matchesAnyType(types, value) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), TypeName(value))}
+	}
+
+	var problems []string
+
+	if enum, ok := schema["enum"]; ok && !inEnum(enum, value) {
+		problems = append(problems, fmt.Sprintf("%s: must be one of %s", path, formatEnum(enum)))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required field %q", path, name))
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			propSchema, known := properties[key].(map[string]interface{})
+			if !known {
+				if allowed, ok := schema["additionalProperties"].(bool); ok && !allowed {
+					problems = append(problems, fmt.Sprintf("%s: unknown field %q", path, key))
+				}
+				continue
+			}
+			problems = append(problems, validate(propSchema, v[key], path+"."+key)...)
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validate(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+
+	return problems
+}
+
+// TypeName returns the JSON type name of a decoded value
+func TypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case float32, int, int32, int64:
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func matchesAnyType(types []string, value interface{}) bool {
+	actual := TypeName(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+		if t == "integer" {
+			switch value.(type) {
+			case int, int32, int64:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inEnum(enum interface{}, value interface{}) bool {
+	switch e := enum.(type) {
+	case []string:
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		for _, option := range e {
+			if option == s {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, option := range e {
+			if option == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func formatEnum(enum interface{}) string {
+	var options []string
+	switch e := enum.(type) {
+	case []string:
+		options = e
+	case []interface{}:
+		for _, option := range e {
+			options = append(options, fmt.Sprintf("%v", option))
+		}
+	}
+	return "[" + strings.Join(options, ", ") + "]"
+}
+
+// stringList accepts both Go-built ([]string) and JSON-decoded ([]interface{}) lists, or a single string
+func stringList(v interface{}) []string {
+	switch list := v.(type) {
+	case string:
+		return []string{list}
+	case []string:
+		return list
+	case []interface{}:
+		res := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// Coerce converts string scalars to the boolean, integer or number type the schema declares.
+// Models frequently quote numbers and booleans; coercing first keeps validation from rejecting them.
+func Coerce(schema map[string]interface{}, value interface{}) interface{} {
+	if schema == nil {
+		return value
+	}
+
+	switch v := value.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		for _, t := range stringList(schema["type"]) {
+			switch t {
+			case "string":
+				return v
+			case "integer":
+				if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+					return float64(n)
+				}
+			case "number":
+				if n, err := strconv.ParseFloat(s, 64); err == nil {
+					return n
+				}
+			case "boolean":
+				if b, err := strconv.ParseBool(s); err == nil {
+					return b
+				}
+			}
+		}
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, item := range v {
+			if propSchema, ok := properties[key].(map[string]interface{}); ok {
+				v[key] = Coerce(propSchema, item)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				v[i] = Coerce(items, item)
+			}
+		}
+	}
+	return value
+}
@@ -0,0 +1,118 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path":  map[string]interface{}{"type": "string"},
+			"limit": map[string]interface{}{"type": "integer"},
+			"mode":  map[string]interface{}{"type": "string", "enum": []string{"read", "write"}},
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+		},
+		"required":             []string{"path"},
+		"additionalProperties": false,
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr []string
+	}{
+		{
+			name:  "valid",
+			input: `{"path": "main.go", "limit": 10, "mode": "read", "tags": ["a"]}`,
+		},
+		{
+			name:    "missing required",
+			input:   `{"limit": 10}`,
+			wantErr: []string{`$: missing required field "path"`},
+		},
+		{
+			name:    "wrong types",
+			input:   `{"path": 5, "limit": 1.5}`,
+			wantErr: []string{"$.path: expected string, got integer", "$.limit: expected integer, got number"},
+		},
+		{
+			name:    "enum and items",
+			input:   `{"path": "a", "mode": "delete", "tags": ["ok", 3]}`,
+			wantErr: []string{"$.mode: must be one of [read, write]", "$.tags[1]: expected string, got integer"},
+		},
+		{
+			name:    "unknown field",
+			input:   `{"path": "a", "extra": true}`,
+			wantErr: []string{`$: unknown field "extra"`},
+		},
+		{
+			name:    "not an object",
+			input:   `"main.go"`,
+			wantErr: []string{"$: expected object, got string"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.input), &value); err != nil {
+				t.Fatalf("bad test input: %v", err)
+			}
+
+			err := Validate(schema, value)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() expected error containing %v", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path":       map[string]interface{}{"type": "string"},
+			"offset":     map[string]interface{}{"type": "integer"},
+			"replaceAll": map[string]interface{}{"type": "boolean"},
+		},
+	}
+
+	params := map[string]interface{}{"path": "42", "offset": "10", "replaceAll": "true"}
+	Coerce(schema, params)
+
+	if params["path"] != "42" {
+		t.Errorf("string field changed: %#v", params["path"])
+	}
+	if params["offset"] != float64(10) {
+		t.Errorf("offset = %#v, want 10", params["offset"])
+	}
+	if params["replaceAll"] != true {
+		t.Errorf("replaceAll = %#v, want true", params["replaceAll"])
+	}
+	if err := Validate(schema, params); err != nil {
+		t.Errorf("coerced params should validate: %v", err)
+	}
+
+	params = map[string]interface{}{"offset": "ten"}
+	Coerce(schema, params)
+	if err := Validate(schema, params); err == nil || !strings.Contains(err.Error(), "$.offset: expected integer, got string") {
+		t.Errorf("expected type error for unparseable integer, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Package secrets finds credentials in source files with gitleaks-style rules: patterns for
+// well-known token formats plus a generic key = "value" rule limited to random-looking values.
+package secrets
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// AllowComment on a line suppresses findings on it, as with gitleaks
+const AllowComment = "gitleaks:allow"
+
+// Rule is one kind of secret
+type Rule struct {
+	ID          string
+	Description string
+	Pattern     *regexp.Regexp
+	// Group is the submatch holding the secret itself; 0 for the whole match
+	Group int
+	// MinEntropy filters out values that are words or placeholders rather than random tokens
+	MinEntropy float64
+}
+
+// Rules are checked in order, most specific first; each line reports at most one finding
+var Rules = []Rule{
+	{ID: "private-key", Description: "private key", Pattern: regexp.MustCompile(`-----BEGIN[ A-Z0-9_-]*PRIVATE KEY( BLOCK)?-----`)},
+	{ID: "aws-access-key", Description: "AWS access key ID", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{ID: "github-token", Description: "GitHub token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{82})\b`)},
+	{ID: "gitlab-token", Description: "GitLab token", Pattern: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20}\b`)},
+	{ID: "anthropic-api-key", Description: "Anthropic API key", Pattern: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{32,}`)},
+	{ID: "openai-api-key", Description: "OpenAI API key", Pattern: regexp.MustCompile(`\bsk-(?:proj-|svcacct-)?[A-Za-z0-9_-]{20,}T3BlbkFJ[A-Za-z0-9_-]{20,}|\bsk-[A-Za-z0-9]{48}\b`)},
+	{ID: "google-api-key", Description: "Google API key", Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{ID: "slack-token", Description: "Slack token", Pattern: regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}`)},
+	{ID: "slack-webhook", Description: "Slack webhook URL", Pattern: regexp.MustCompile(`https://hooks\.slack\.com/(?:services|workflows)/[A-Za-z0-9+/]{40,}`)},
+	{ID: "stripe-key", Description: "Stripe secret key", Pattern: regexp.MustCompile(`\b(?:sk|rk)_(?:live|test)_[0-9A-Za-z]{24,}\b`)},
+	{ID: "npm-token", Description: "npm access token", Pattern: regexp.MustCompile(`\bnpm_[A-Za-z0-9]{36}\b`)},
+	{ID: "jwt", Description: "JSON Web Token", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{ID: "url-password", Description: "password in a connection URL", Pattern: regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^/\s:@'"]+:([^/\s:@'"]{6,})@`), Group: 1, MinEntropy: 2.5},
+	{
+		ID:          "generic-secret",
+		Description: "hardcoded secret",
+		Pattern:     regexp.MustCompile(`(?i)\b[\w.-]*(?:api[_-]?key|secret|token|passw(?:or)?d|credentials?|auth[_-]?key|private[_-]?key)[\w.-]*["']?\s*(?::=|=>|[:=])\s*["'` + "`" + `]([^"'` + "`" + `\s]{12,})["'` + "`" + `]`),
+		Group:       1,
+		MinEntropy:  3.2,
+	},
+}
+
+// placeholders are values that stand for a secret in examples and templates
+var placeholders = regexp.MustCompile(`(?i)example|sample|dummy|placeholder|changeme|change[_-]me|your[_-]|redacted|xxxx|\*\*\*|<[^>]*>|\$\{|\{\{|%s|process\.env|os\.getenv|environ`)
+
+// Finding is a suspected secret
+type Finding struct {
+	File   string
+	Line   int
+	RuleID string
+	Rule   string // Description of the rule
+	Secret string // The matched value, masked
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d: %s (%s)", f.File, f.Line, f.Rule, f.Secret)
+}
+
+// Scan returns the suspected secrets in a file's content
+func Scan(file string, data []byte) []Finding {
+	var findings []Finding
+	for i, line := range strings.Split(string(data), "\n") {
+		if len(line) > 4096 || strings.Contains(line, AllowComment) {
+			continue
+		}
+		for _, rule := range Rules {
+			match := rule.Pattern.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			secret := match[rule.Group]
+			if placeholders.MatchString(secret) || (rule.MinEntropy > 0 && entropy(secret) < rule.MinEntropy) {
+				continue
+			}
+			findings = append(findings, Finding{File: file, Line: i + 1, RuleID: rule.ID, Rule: rule.Description, Secret: Mask(secret)})
+			// The specific rules come first; a line with a known token needs no generic finding too
+			break
+		}
+	}
+	return findings
+}
+
+// Mask keeps the start of a secret so it can be recognized, and hides the rest
+func Mask(secret string) string {
+	r := []rune(secret)
+	keep := min(4, len(r)/4)
+	return string(r[:keep]) + strings.Repeat("*", min(8, len(r)-keep))
+}
+
+// entropy is the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
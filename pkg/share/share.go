@@ -0,0 +1,182 @@
+// Package share redacts session transcripts and uploads them to a secret gist or a paste service
+package share
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"coding-agent/pkg/types"
+)
+
+// gistAPI is the GitHub endpoint gists are created at
+var gistAPI = "https://api.github.com/gists"
+
+// maxResponseSize bounds how much of an upload response is read
+const maxResponseSize = 1 << 20
+
+// secretPatterns match credentials commonly found in tool output. When a pattern has a group, only
+// the text after the group is redacted, so the key name stays readable.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{30,}`),
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}`),
+	regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]{16,}`),
+	regexp.MustCompile(`(?i)((?:api[_-]?key|secret|token|passw(?:or)?d)["']?\s*[:=]\s*["']?)[^\s"',;]{8,}`),
+}
+
+// Redacted replaces each secret in a redacted transcript
+const Redacted = "[REDACTED]"
+
+// Redact replaces credentials in text with Redacted and returns the number of replacements.
+// known lists values that are secret regardless of their shape, such as configured API keys.
+func Redact(text string, known []string) (string, int) {
+	count := 0
+	for _, secret := range known {
+		if len(secret) < 8 {
+			continue
+		}
+		count += strings.Count(text, secret)
+		text = strings.ReplaceAll(text, secret, Redacted)
+	}
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if strings.HasSuffix(match, Redacted) {
+				return match // Already redacted by an earlier pattern
+			}
+			count++
+			if groups := pattern.FindStringSubmatch(match); len(groups) > 1 {
+				return groups[1] + Redacted
+			}
+			return Redacted
+		})
+	}
+	return text, count
+}
+
+// Destination describes where Upload sends a transcript with these settings
+func Destination(settings types.ShareSettings) string {
+	if settings.Endpoint != "" {
+		return settings.Endpoint
+	}
+	return "a secret GitHub gist"
+}
+
+// Upload publishes content and returns its URL. Without a configured endpoint it creates a secret
+// gist with the token from GITHUB_TOKEN, GH_TOKEN or the GitHub CLI.
+func Upload(ctx context.Context, settings types.ShareSettings, filename, description, content string) (string, error) {
+	if settings.Endpoint != "" {
+		return uploadPaste(ctx, settings, content)
+	}
+	token := githubToken(ctx)
+	if token == "" {
+		return "", fmt.Errorf("no GitHub token: set GITHUB_TOKEN, run `gh auth login`, or configure a paste endpoint under \"share\" in the config")
+	}
+	return createGist(ctx, token, filename, description, content)
+}
+
+func githubToken(ctx context.Context) string {
+	for _, name := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if token := strings.TrimSpace(os.Getenv(name)); token != "" {
+			return token
+		}
+	}
+	if _, err := exec.LookPath("gh"); err != nil {
+		return ""
+	}
+	output, err := exec.CommandContext(ctx, "gh", "auth", "token").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func createGist(ctx context.Context, token, filename, description, content string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"description": description,
+		"public":      false,
+		"files":       map[string]interface{}{filename: map[string]string{"content": content}},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, gistAPI, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	data, err := send(req)
+	if err != nil {
+		return "", err
+	}
+	var gist struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.Unmarshal(data, &gist); err != nil || gist.HTMLURL == "" {
+		return "", fmt.Errorf("unexpected response from GitHub: %s", strings.TrimSpace(string(data)))
+	}
+	return gist.HTMLURL, nil
+}
+
+// uploadPaste posts content to a paste service. The response is either the URL itself or a JSON
+// object with a url or link field.
+func uploadPaste(ctx context.Context, settings types.ShareSettings, content string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, settings.Endpoint, strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	for key, value := range settings.Headers {
+		req.Header.Set(key, os.ExpandEnv(value))
+	}
+
+	data, err := send(req)
+	if err != nil {
+		return "", err
+	}
+	response := strings.TrimSpace(string(data))
+	var fields struct {
+		URL  string `json:"url"`
+		Link string `json:"link"`
+	}
+	if json.Unmarshal(data, &fields) == nil {
+		response = fields.URL
+		if response == "" {
+			response = fields.Link
+		}
+	}
+	if !strings.HasPrefix(response, "http://") && !strings.HasPrefix(response, "https://") {
+		return "", fmt.Errorf("the paste service did not answer with a URL: %s", strings.TrimSpace(string(data)))
+	}
+	return response, nil
+}
+
+func send(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("upload failed: %s %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
@@ -0,0 +1,187 @@
+// Package speech reads short messages aloud with the system's speech command or an
+// OpenAI-compatible speech endpoint
+package speech
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"coding-agent/pkg/types"
+)
+
+// defaultModel and defaultVoice are requested from an endpoint when none are configured
+const (
+	defaultModel = "tts-1"
+	defaultVoice = "alloy"
+)
+
+var (
+	mu      sync.Mutex
+	current context.CancelFunc // Stops the message being spoken
+)
+
+// Speak reads text aloud in the background. A new message interrupts the one being spoken, so a
+// quick succession of prompts does not queue up. Errors are ignored: speech is a convenience and
+// everything spoken is also on screen.
+func Speak(settings types.SpeechSettings, text string) {
+	text = Plain(text)
+	if text == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	mu.Lock()
+	if current != nil {
+		current()
+	}
+	current = cancel
+	mu.Unlock()
+
+	go func() {
+		defer cancel()
+		if settings.Endpoint != "" {
+			speakEndpoint(ctx, settings, text)
+			return
+		}
+		argv, err := speechCommand(runtime.GOOS, settings, exec.LookPath)
+		if err != nil {
+			return
+		}
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		cmd.Run()
+	}()
+}
+
+// Stop silences the message being spoken, if any
+func Stop() {
+	mu.Lock()
+	defer mu.Unlock()
+	if current != nil {
+		current()
+		current = nil
+	}
+}
+
+// speechCommand returns the command that speaks the text on its stdin: the configured one, say on
+// macOS, espeak-ng or espeak on Linux, or PowerShell's speech synthesizer on Windows
+func speechCommand(goos string, settings types.SpeechSettings, lookPath func(string) (string, error)) ([]string, error) {
+	if settings.Command != "" {
+		return strings.Fields(settings.Command), nil
+	}
+	switch goos {
+	case "darwin":
+		if settings.Voice != "" {
+			return []string{"say", "-v", settings.Voice}, nil
+		}
+		return []string{"say"}, nil
+	case "linux":
+		for _, name := range []string{"espeak-ng", "espeak"} {
+			if _, err := lookPath(name); err == nil {
+				if settings.Voice != "" {
+					return []string{name, "--stdin", "-v", settings.Voice}, nil
+				}
+				return []string{name, "--stdin"}, nil
+			}
+		}
+		return nil, fmt.Errorf("no speech synthesizer found; install espeak-ng or set speech.command")
+	case "windows":
+		return []string{"powershell", "-NoProfile", "-Command",
+			"Add-Type -AssemblyName System.Speech; (New-Object System.Speech.Synthesis.SpeechSynthesizer).Speak([Console]::In.ReadToEnd())"}, nil
+	}
+	return nil, fmt.Errorf("speech is not supported on %s; set speech.command", goos)
+}
+
+// speakEndpoint synthesizes text with an OpenAI-compatible /audio/speech endpoint and plays it
+func speakEndpoint(ctx context.Context, settings types.SpeechSettings, text string) error {
+	model, voice := settings.Model, settings.Voice
+	if model == "" {
+		model = defaultModel
+	}
+	if voice == "" {
+		voice = defaultVoice
+	}
+	body, _ := json.Marshal(map[string]string{"model": model, "voice": voice, "input": text, "response_format": "wav"})
+
+	url := strings.TrimRight(settings.Endpoint, "/") + "/audio/speech"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key := os.ExpandEnv(settings.APIKey); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("speech synthesis failed with status %d", resp.StatusCode)
+	}
+
+	dir, err := os.MkdirTemp("", "mcode-speech-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "speech.wav")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	argv, err := playerCommand(runtime.GOOS, path, exec.LookPath)
+	if err != nil {
+		return err
+	}
+	return exec.CommandContext(ctx, argv[0], argv[1:]...).Run()
+}
+
+// playerCommand returns the command that plays a WAV file
+func playerCommand(goos, path string, lookPath func(string) (string, error)) ([]string, error) {
+	switch goos {
+	case "darwin":
+		return []string{"afplay", path}, nil
+	case "windows":
+		return []string{"powershell", "-NoProfile", "-Command", "(New-Object Media.SoundPlayer '" + path + "').PlaySync()"}, nil
+	}
+	for _, argv := range [][]string{{"paplay", path}, {"aplay", "-q", path}, {"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet", path}} {
+		if _, err := lookPath(argv[0]); err == nil {
+			return argv, nil
+		}
+	}
+	return nil, fmt.Errorf("no audio player found; install pulseaudio-utils, alsa-utils or ffmpeg")
+}
+
+var (
+	codeBlock    = regexp.MustCompile("(?s)```.*?```")
+	markdownLink = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	markup       = regexp.MustCompile("[`*_#>|]+")
+)
+
+// Plain turns markdown into text worth reading aloud: code blocks are dropped, links keep their
+// text and formatting characters are removed
+func Plain(text string) string {
+	text = codeBlock.ReplaceAllString(text, " ")
+	text = markdownLink.ReplaceAllString(text, "$1")
+	text = markup.ReplaceAllString(text, " ")
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,49 @@
+package speech
+
+import (
+	"fmt"
+	"testing"
+
+	"coding-agent/pkg/types"
+)
+
+func TestPlain(t *testing.T) {
+	text := "## Done\n\nI fixed `parseArgs` in [main.go](main.go):\n```go\nfunc parseArgs() {}\n```\n- **All** tests pass"
+	if got, want := Plain(text), "Done I fixed parseArgs in main.go: - All tests pass"; got != want {
+		t.Errorf("Plain() = %q, want %q", got, want)
+	}
+}
+
+func TestSpeechCommand(t *testing.T) {
+	espeak := func(name string) (string, error) {
+		if name == "espeak" {
+			return "/usr/bin/espeak", nil
+		}
+		return "", fmt.Errorf("%s not found", name)
+	}
+	none := func(name string) (string, error) { return "", fmt.Errorf("%s not found", name) }
+
+	tests := []struct {
+		goos     string
+		settings types.SpeechSettings
+		lookPath func(string) (string, error)
+		want     string
+	}{
+		{"darwin", types.SpeechSettings{Voice: "Samantha"}, none, "say -v Samantha"},
+		{"linux", types.SpeechSettings{}, espeak, "espeak --stdin"},
+		{"linux", types.SpeechSettings{Command: "piper-say --fast"}, none, "piper-say --fast"},
+		{"linux", types.SpeechSettings{}, none, ""},
+	}
+	for _, tt := range tests {
+		argv, err := speechCommand(tt.goos, tt.settings, tt.lookPath)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", tt.goos, argv)
+			}
+			continue
+		}
+		if got := fmt.Sprint(argv); err != nil || got != "["+tt.want+"]" {
+			t.Errorf("%s %+v: got %v, %v; want %s", tt.goos, tt.settings, argv, err, tt.want)
+		}
+	}
+}
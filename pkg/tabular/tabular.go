@@ -0,0 +1,197 @@
+// Package tabular summarizes tabular data for preview_data: the columns and their types, the
+// number of rows and the first few rows, so a model can work with a data file without reading it all
+package tabular
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCellWidth shortens long values in the sample rows
+const maxCellWidth = 40
+
+// Column is a column name and its type, as declared by the source or inferred from the values
+type Column struct {
+	Name  string
+	Type  string
+	Empty int // Values that are empty or NULL, when known
+}
+
+// Preview summarizes a table
+type Preview struct {
+	Columns []Column
+	Rows    int // -1 when unknown
+	Sample  [][]string
+}
+
+// ReadCSV previews delimited text, reading all rows to count them and infer column types. The
+// first row is taken as the header.
+func ReadCSV(r io.Reader, comma rune, sampleRows int) (*Preview, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return &Preview{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := &Preview{}
+	for _, name := range header {
+		p.Columns = append(p.Columns, Column{Name: name})
+	}
+	kinds := make([]kind, len(header))
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", p.Rows+2, err)
+		}
+		for i, value := range record {
+			if i >= len(kinds) {
+				break
+			}
+			if strings.TrimSpace(value) == "" {
+				p.Columns[i].Empty++
+				continue
+			}
+			kinds[i] = kinds[i].merge(inferKind(value))
+		}
+		if p.Rows < sampleRows {
+			p.Sample = append(p.Sample, append([]string{}, record...))
+		}
+		p.Rows++
+	}
+
+	for i := range p.Columns {
+		p.Columns[i].Type = kinds[i].String()
+	}
+	return p, nil
+}
+
+// kind is an inferred column type; merging two kinds gives the narrowest that fits both
+type kind int
+
+const (
+	kindNone kind = iota // No values seen
+	kindBool
+	kindInt
+	kindFloat
+	kindDate
+	kindTimestamp
+	kindText
+)
+
+func (k kind) String() string {
+	return [...]string{"empty", "boolean", "integer", "decimal", "date", "timestamp", "text"}[k]
+}
+
+func (k kind) merge(other kind) kind {
+	switch {
+	case k == kindNone || k == other:
+		return other
+	case other == kindNone:
+		return k
+	case (k == kindInt && other == kindFloat) || (k == kindFloat && other == kindInt):
+		return kindFloat
+	case (k == kindDate && other == kindTimestamp) || (k == kindTimestamp && other == kindDate):
+		return kindTimestamp
+	}
+	return kindText
+}
+
+func inferKind(value string) kind {
+	value = strings.TrimSpace(value)
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return kindInt
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return kindFloat
+	}
+	switch strings.ToLower(value) {
+	case "true", "false":
+		return kindBool
+	}
+	if _, err := time.Parse("2006-01-02", value); err == nil {
+		return kindDate
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if _, err := time.Parse(layout, value); err == nil {
+			return kindTimestamp
+		}
+	}
+	return kindText
+}
+
+// Format renders the preview under a title line
+func (p *Preview) Format(title string) string {
+	var b strings.Builder
+	b.WriteString(title)
+	if p.Rows >= 0 {
+		fmt.Fprintf(&b, ", %d columns, %d rows", len(p.Columns), p.Rows)
+	} else {
+		fmt.Fprintf(&b, ", %d columns", len(p.Columns))
+	}
+	b.WriteString("\n")
+	if len(p.Columns) == 0 {
+		return b.String()
+	}
+
+	width := 0
+	for _, col := range p.Columns {
+		width = max(width, len(col.Name))
+	}
+	b.WriteString("\nColumns:\n")
+	for _, col := range p.Columns {
+		fmt.Fprintf(&b, "  %-*s  %s", width, col.Name, col.Type)
+		if col.Empty > 0 {
+			fmt.Fprintf(&b, " (%d empty)", col.Empty)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(p.Sample) == 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, "\nFirst %d rows:\n", len(p.Sample))
+	names := make([]string, len(p.Columns))
+	for i, col := range p.Columns {
+		names[i] = col.Name
+	}
+	b.WriteString(Table(names, p.Sample))
+	return b.String()
+}
+
+// Table renders rows as a Markdown table, shortening long values
+func Table(header []string, rows [][]string) string {
+	var b strings.Builder
+	writeRow(&b, header)
+	b.WriteString("|" + strings.Repeat("---|", len(header)) + "\n")
+	for _, row := range rows {
+		writeRow(&b, row)
+	}
+	return b.String()
+}
+
+func writeRow(b *strings.Builder, values []string) {
+	b.WriteString("|")
+	for _, v := range values {
+		v = strings.Join(strings.Fields(v), " ")
+		if r := []rune(v); len(r) > maxCellWidth {
+			v = string(r[:maxCellWidth-1]) + "…"
+		}
+		b.WriteString(" " + strings.ReplaceAll(v, "|", `\|`) + " |")
+	}
+	b.WriteString("\n")
+}
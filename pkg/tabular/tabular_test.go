@@ -0,0 +1,40 @@
+package tabular
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadCSV(t *testing.T) {
+	data := "id,name,price,added,active\n" +
+		"1,Widget,9.99,2024-01-02,true\n" +
+		"2,\"Gadget, large\",10,2024-01-03 10:00:00,false\n" +
+		"3,,12.5,,true\n"
+	p, err := ReadCSV(strings.NewReader(data), ',', 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Rows != 3 || len(p.Sample) != 2 {
+		t.Fatalf("Rows = %d, sample = %d, want 3 and 2", p.Rows, len(p.Sample))
+	}
+	want := []Column{
+		{Name: "id", Type: "integer"},
+		{Name: "name", Type: "text", Empty: 1},
+		{Name: "price", Type: "decimal"},
+		{Name: "added", Type: "timestamp", Empty: 1},
+		{Name: "active", Type: "boolean"},
+	}
+	for i, col := range want {
+		if p.Columns[i] != col {
+			t.Errorf("column %d = %+v, want %+v", i, p.Columns[i], col)
+		}
+	}
+
+	out := p.Format("data.csv: CSV")
+	for _, s := range []string{"data.csv: CSV, 5 columns, 3 rows", "name    text (1 empty)", "| 2 | Gadget, large | 10 |"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Format() is missing %q:\n%s", s, out)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package tokens
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// downloadTimeout bounds the one-time download of an encoding, so a machine without network access
+// falls back to estimates instead of hanging
+const downloadTimeout = 15 * time.Second
+
+// cl100kPattern is the pre-tokenizer split of cl100k_base, used for BPE files, as most tiktoken
+// vocabularies of open models were trained with it
+const cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+
+func init() {
+	tiktoken.SetBpeLoader(bpeLoader{})
+}
+
+// bpeLoader loads tiktoken's encodings from the tokenizer cache, downloading them there the first
+// time, and BPE files from disk
+type bpeLoader struct{}
+
+func (bpeLoader) LoadTiktokenBpe(source string) (map[string]int, error) {
+	if !strings.HasPrefix(source, "https://") && !strings.HasPrefix(source, "http://") {
+		return readBPEFile(source)
+	}
+
+	dir := cacheDir()
+	cached := filepath.Join(dir, path.Base(source))
+	if ranks, err := readBPEFile(cached); err == nil {
+		return ranks, nil
+	}
+
+	client := &http.Client{Timeout: downloadTimeout}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", source, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	ranks, err := parseBPE(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err == nil {
+		tmp := cached + ".tmp"
+		if os.WriteFile(tmp, data, 0644) == nil {
+			os.Rename(tmp, cached)
+		}
+	}
+	return ranks, nil
+}
+
+// cacheDir is where downloaded encodings are kept: TIKTOKEN_CACHE_DIR, as for tiktoken, or
+// ~/.mcode/tokenizers
+func cacheDir() string {
+	if dir := strings.TrimSpace(os.Getenv("TIKTOKEN_CACHE_DIR")); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "mcode-tokenizers")
+	}
+	return filepath.Join(home, ".mcode", "tokenizers")
+}
+
+func readBPEFile(name string) (map[string]int, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseBPE(data)
+}
+
+// parseBPE reads the tiktoken format: one base64 token and its rank per line
+func parseBPE(data []byte) (map[string]int, error) {
+	ranks := make(map[string]int)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected a token and a rank", i+1)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		ranks[string(decoded)] = n
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("no tokens")
+	}
+	return ranks, nil
+}
+
+// isBPEFile reports whether a tokenizer setting names a file rather than an encoding
+func isBPEFile(tokenizer string) bool {
+	return strings.HasSuffix(tokenizer, ".tiktoken") || strings.ContainsAny(tokenizer, `/\`)
+}
+
+// fileEncoding builds a tokenizer from a .tiktoken BPE file
+func fileEncoding(name string) (*tiktoken.Tiktoken, error) {
+	if strings.HasPrefix(name, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			name = filepath.Join(home, name[2:])
+		}
+	}
+	ranks, err := readBPEFile(name)
+	if err != nil {
+		return nil, err
+	}
+	bpe, err := tiktoken.NewCoreBPE(ranks, map[string]int{}, cl100kPattern)
+	if err != nil {
+		return nil, err
+	}
+	encoding := &tiktoken.Encoding{Name: filepath.Base(name), PatStr: cl100kPattern, MergeableRanks: ranks, SpecialTokens: map[string]int{}}
+	return tiktoken.NewTiktoken(bpe, encoding, map[string]any{}), nil
+}
@@ -1,45 +1,118 @@
 package tokens
 
 import (
+	"encoding/json"
 	"strings"
+	"sync"
 
 	"coding-agent/pkg/types"
 	"github.com/pkoukk/tiktoken-go"
+	"github.com/sashabaranov/go-openai"
 )
 
-// CountTokens returns the number of tokens in a string for a given model
-func CountTokens(modelName, text string) int {
-	// tiktoken-go doesn't always have all latest models, so we map them to common ones
-	encodingModel := modelName
-	if strings.Contains(modelName, "gpt-4") {
-		encodingModel = "gpt-4o"
-	} else if strings.Contains(modelName, "gpt-3.5") {
-		encodingModel = "gpt-3.5-turbo"
-	} else if strings.Contains(modelName, "qwen") {
-		// Qwen models use a similar tokenizer to gpt-4 or cl100k_base
-		encodingModel = "gpt-4"
+// EstimateTokenizer in a model's tokenizer setting turns tokenizing off, so counts are estimated
+// from the text length
+const EstimateTokenizer = "estimate"
+
+// Counter counts tokens with the tokenizer of one model. Tokenizers are loaded once per process;
+// when one cannot be loaded (no network for the first download, a missing file), counts are
+// estimated from the text length instead.
+type Counter struct {
+	model string
+	enc   *tiktoken.Tiktoken
+}
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = map[string]*tiktoken.Tiktoken{} // By tokenizer setting; nil when it failed to load
+)
+
+// NewCounter returns the counter for a model. The tokenizer is the model's tokenizer setting (an
+// encoding name such as "o200k_base", the path to a .tiktoken BPE file, or "estimate"), or when
+// that is empty the encoding its name suggests, falling back to cl100k_base.
+func NewCounter(model types.Model) *Counter {
+	tokenizer := model.Tokenizer
+	if tokenizer == "" {
+		tokenizer = encodingForModel(model.Name)
 	}
+	return &Counter{model: model.Name, enc: loadEncoding(tokenizer)}
+}
 
-	tkm, err := tiktoken.EncodingForModel(encodingModel)
-	if err != nil {
-		// Fallback to cl100k_base which is common for modern LLMs
-		tkm, err = tiktoken.GetEncoding("cl100k_base")
-		if err != nil {
-			// Absolute fallback
-			return len(text) / 4
+// encodingForModel picks the encoding of a model name. tiktoken-go doesn't always have the latest
+// models, so they are mapped to common ones.
+func encodingForModel(modelName string) string {
+	name := strings.ToLower(modelName)
+	switch {
+	case strings.Contains(name, "gpt-4o"), strings.Contains(name, "gpt-4.1"), strings.Contains(name, "gpt-4.5"),
+		strings.Contains(name, "gpt-5"), strings.HasPrefix(name, "o1"), strings.HasPrefix(name, "o3"), strings.HasPrefix(name, "o4"):
+		return tiktoken.MODEL_O200K_BASE
+	case strings.Contains(name, "gpt-4"), strings.Contains(name, "gpt-3.5"):
+		return tiktoken.MODEL_CL100K_BASE
+	}
+	if encoding, ok := tiktoken.MODEL_TO_ENCODING[name]; ok {
+		return encoding
+	}
+	for prefix, encoding := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(name, prefix) {
+			return encoding
 		}
 	}
+	// Qwen, Llama and most other open models are closer to cl100k_base than to a length estimate
+	return tiktoken.MODEL_CL100K_BASE
+}
+
+// loadEncoding returns the tokenizer for a setting, loading it the first time
+func loadEncoding(tokenizer string) *tiktoken.Tiktoken {
+	if tokenizer == EstimateTokenizer {
+		return nil
+	}
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	if enc, ok := encodings[tokenizer]; ok {
+		return enc
+	}
+
+	var enc *tiktoken.Tiktoken
+	var err error
+	if isBPEFile(tokenizer) {
+		enc, err = fileEncoding(tokenizer)
+	} else {
+		enc, err = tiktoken.GetEncoding(tokenizer)
+	}
+	if err != nil {
+		enc = nil
+	}
+	encodings[tokenizer] = enc
+	return enc
+}
 
-	token := tkm.Encode(text, nil, nil)
-	return len(token)
+// Exact reports whether the counter tokenizes, rather than estimating from the text length
+func (c *Counter) Exact() bool {
+	return c.enc != nil
 }
 
-// CountMessagesTokens returns the total number of tokens for a list of messages
-func CountMessagesTokens(modelName string, messages []types.Message) int {
+// Count returns the number of tokens in a string
+func (c *Counter) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	if c.enc == nil {
+		return Estimate(text)
+	}
+	return len(c.enc.EncodeOrdinary(text))
+}
+
+// Estimate approximates the number of tokens in a string without a tokenizer
+func Estimate(text string) int {
+	return len(text) / 4
+}
+
+// CountMessages returns the total number of tokens for a list of messages
+func (c *Counter) CountMessages(messages []types.Message) int {
 	var tokensPerMessage int
 	var tokensPerName int
 
-	if strings.Contains(modelName, "gpt-3.5-turbo") {
+	if strings.Contains(c.model, "gpt-3.5-turbo") {
 		tokensPerMessage = 4
 		tokensPerName = -1
 	} else {
@@ -51,23 +124,56 @@ func CountMessagesTokens(modelName string, messages []types.Message) int {
 	numTokens := 0
 	for _, message := range messages {
 		numTokens += tokensPerMessage
-		numTokens += CountTokens(modelName, message.Content)
-		numTokens += CountTokens(modelName, message.Reasoning)
-		numTokens += CountTokens(modelName, message.Role)
+		numTokens += c.Count(message.Content)
+		numTokens += c.Count(message.Reasoning)
+		numTokens += c.Count(message.Role)
 		if message.Name != "" {
 			numTokens += tokensPerName
-			numTokens += CountTokens(modelName, message.Name)
+			numTokens += c.Count(message.Name)
 		}
 
+		// Image token cost depends on the provider and resolution; use a conservative flat estimate
+		numTokens += len(message.Images) * ImageTokenEstimate
+
 		// Count tool calls tokens
-		if len(message.ToolCalls) > 0 {
-			for _, tc := range message.ToolCalls {
-				numTokens += CountTokens(modelName, tc.Function.Name)
-				numTokens += CountTokens(modelName, tc.Function.Arguments)
-			}
+		for _, tc := range message.ToolCalls {
+			numTokens += c.Count(tc.Function.Name)
+			numTokens += c.Count(tc.Function.Arguments)
 		}
 	}
 
 	numTokens += 3 // every reply is primed with <|start|>assistant<|message|>
 	return numTokens
 }
+
+// CountTools returns the number of tokens the tool definitions add to a request
+func (c *Counter) CountTools(tools []openai.Tool) int {
+	if len(tools) == 0 {
+		return 0
+	}
+
+	// Providers serialize the tool schemas into the prompt, so the JSON form is a close approximation
+	data, err := json.Marshal(tools)
+	if err != nil {
+		return 0
+	}
+	return c.Count(string(data))
+}
+
+// ImageTokenEstimate approximates the prompt tokens of one downscaled image
+const ImageTokenEstimate = 1600
+
+// CountTokens returns the number of tokens in a string for a given model
+func CountTokens(modelName, text string) int {
+	return NewCounter(types.Model{Name: modelName}).Count(text)
+}
+
+// CountMessagesTokens returns the total number of tokens for a list of messages
+func CountMessagesTokens(modelName string, messages []types.Message) int {
+	return NewCounter(types.Model{Name: modelName}).CountMessages(messages)
+}
+
+// CountToolsTokens returns the number of tokens the tool definitions add to a request
+func CountToolsTokens(modelName string, tools []openai.Tool) int {
+	return NewCounter(types.Model{Name: modelName}).CountTools(tools)
+}
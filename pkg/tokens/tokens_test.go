@@ -1,6 +1,11 @@
 package tokens
 
 import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"coding-agent/pkg/types"
@@ -65,3 +70,79 @@ func TestCountMessagesTokens(t *testing.T) {
 		t.Errorf("CountMessagesTokens() = %v, want between 10 and 30", got)
 	}
 }
+
+func TestCountToolsTokens(t *testing.T) {
+	if got := CountToolsTokens("gpt-4", nil); got != 0 {
+		t.Errorf("CountToolsTokens(nil) = %v, want 0", got)
+	}
+
+	tools := []openai.Tool{
+		{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "read_file",
+				Description: "Read the contents of a file",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"path": map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+
+	if got := CountToolsTokens("gpt-4", tools); got < 10 {
+		t.Errorf("CountToolsTokens() = %v, want at least 10", got)
+	}
+}
+
+func TestCounterWithBPEFile(t *testing.T) {
+	// Every single byte, then the merges "ab" and "abc"
+	var bpe strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&bpe, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	fmt.Fprintf(&bpe, "%s 256\n%s 257\n", base64.StdEncoding.EncodeToString([]byte("ab")), base64.StdEncoding.EncodeToString([]byte("abc")))
+	path := filepath.Join(t.TempDir(), "tiny.tiktoken")
+	if err := os.WriteFile(path, []byte(bpe.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	counter := NewCounter(types.Model{Name: "local-model", Tokenizer: path})
+	if !counter.Exact() {
+		t.Fatal("expected the BPE file to load")
+	}
+	// "abc" and " abc" split by the pre-tokenizer: abc, " ", abc
+	if got := counter.Count("abc abc"); got != 3 {
+		t.Errorf("Count() = %d, want 3", got)
+	}
+
+	missing := NewCounter(types.Model{Name: "local-model", Tokenizer: filepath.Join(t.TempDir(), "missing.tiktoken")})
+	if missing.Exact() || missing.Count("abcdefgh") != 2 {
+		t.Errorf("a missing BPE file should fall back to estimates, got %d", missing.Count("abcdefgh"))
+	}
+}
+
+func TestEstimateTokenizer(t *testing.T) {
+	counter := NewCounter(types.Model{Name: "gpt-4o", Tokenizer: EstimateTokenizer})
+	if counter.Exact() || counter.Count(strings.Repeat("x", 40)) != 10 {
+		t.Errorf("expected a length estimate, got %d", counter.Count(strings.Repeat("x", 40)))
+	}
+}
+
+func TestEncodingForModel(t *testing.T) {
+	tests := map[string]string{
+		"gpt-4o-mini":          "o200k_base",
+		"gpt-5":                "o200k_base",
+		"o3-mini":              "o200k_base",
+		"gpt-4-turbo":          "cl100k_base",
+		"gpt-3.5-turbo":        "cl100k_base",
+		"qwen/qwen3-coder-30b": "cl100k_base",
+	}
+	for model, want := range tests {
+		if got := encodingForModel(model); got != want {
+			t.Errorf("encodingForModel(%q) = %q, want %q", model, got, want)
+		}
+	}
+}
@@ -7,8 +7,9 @@ import (
 	"io"
 	"os/exec"
 	"sync"
-	"syscall"
+	"time"
 
+	"coding-agent/pkg/i18n"
 	"coding-agent/pkg/types"
 	"coding-agent/pkg/ui"
 	"github.com/sashabaranov/go-openai"
@@ -64,29 +65,49 @@ func (t *BashCommandTool) Execute(ctx context.Context, params map[string]interfa
 	if args.Command == "" {
 		return "", fmt.Errorf("command parameter is required")
 	}
+	warning, err := t.manager.checkSecrets(args.Command)
+	if err != nil {
+		return "", err
+	}
+
+	timeout := t.manager.agent.ToolSettings.BashTimeout
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
 
 	// Use provided context which handles cancellation
-	ui.PrintfSafe("%sExecuting: %s%s\n", types.ColorYellow, args.Command, types.ColorReset)
-	ui.PrintfSafe("%s(Press Ctrl+C/Esc to interrupt if it hangs)%s\n", types.ColorBlue, types.ColorReset)
+	ui.PrintfSafe("%s%s%s\n", types.ColorYellow, i18n.T("tool.executing", t.manager.execLabel(), args.Command), types.ColorReset)
+	ui.PrintfSafe("%s%s%s\n", types.ColorBlue, i18n.T("tool.interrupt_hint"), types.ColorReset)
 
-	cmd := exec.CommandContext(ctx, "bash", "-c", args.Command)
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd := ShellCommand(ctx, t.manager.agent, args.Command)
+	output, err := runStreaming(ctx, cmd, timeout)
+	return output + warning, err
+}
 
+// runStreaming runs a shell command, streaming its output to the terminal, and returns the
+// combined output. timeout is the limit ctx was given, for the error message.
+func runStreaming(ctx context.Context, cmd *exec.Cmd, timeout int) (string, error) {
 	var stdoutBuf, stderrBuf bytes.Buffer
 	safeOut := &safeWriter{}
 	safeErr := &safeWriter{}
 	cmd.Stdout = io.MultiWriter(safeOut, &stdoutBuf)
 	cmd.Stderr = io.MultiWriter(safeErr, &stderrBuf)
 
-	if err := cmd.Start(); err != nil {
+	if err := startTracked(cmd); err != nil {
 		return "", fmt.Errorf("failed to start command: %v", err)
 	}
+	defer untrack(cmd)
 
 	err := cmd.Wait()
 	output := stdoutBuf.String() + stderrBuf.String()
 
 	if ctx.Err() == context.DeadlineExceeded {
-		return output, fmt.Errorf("command timed out after 30 seconds. Output so far: %s", output)
+		return output, fmt.Errorf("command timed out after %d seconds. Output so far: %s", timeout, output)
+	}
+	if ctx.Err() != nil {
+		return output, fmt.Errorf("command interrupted by the user")
 	}
 
 	if err != nil {
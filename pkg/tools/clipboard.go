@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxClipboardChars bounds how much clipboard text is returned to the model
+const maxClipboardChars = 20000
+
+type ClipboardReadTool struct {
+	BaseTool
+}
+
+func (t *ClipboardReadTool) Name() string {
+	return "clipboard_read"
+}
+
+func (t *ClipboardReadTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name(),
+			Description: "Read the text currently on the user's clipboard, e.g. a snippet or error they just copied.",
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+	}
+}
+
+func (t *ClipboardReadTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	argv, err := clipboardCommand(runtime.GOOS, false, os.Getenv("WAYLAND_DISPLAY") != "", exec.LookPath)
+	if err != nil {
+		return "", err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("failed to read clipboard: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	text := string(output)
+	if strings.TrimSpace(text) == "" {
+		return "The clipboard is empty (or holds no text).", nil
+	}
+	if len(text) > maxClipboardChars {
+		text = text[:maxClipboardChars] + fmt.Sprintf("\n\n[... clipboard truncated, %d of %d chars shown ...]", maxClipboardChars, len(output))
+	}
+	return text, nil
+}
+
+func (t *ClipboardReadTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *ClipboardReadTool) GetDisplayInfo(params map[string]interface{}) string {
+	return ""
+}
+
+type ClipboardWriteTool struct {
+	BaseTool
+}
+
+func (t *ClipboardWriteTool) Name() string {
+	return "clipboard_write"
+}
+
+func (t *ClipboardWriteTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name(),
+			Description: "Place text on the user's clipboard so they can paste it elsewhere, e.g. a generated snippet or command.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"text": map[string]interface{}{
+						"type":        "string",
+						"description": "The text to copy",
+					},
+				},
+				"required": []string{"text"},
+			},
+		},
+	}
+}
+
+func (t *ClipboardWriteTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	var args ClipboardWriteArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+
+	argv, err := clipboardCommand(runtime.GOOS, true, os.Getenv("WAYLAND_DISPLAY") != "", exec.LookPath)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = strings.NewReader(args.Text)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("failed to write clipboard: %v %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return fmt.Sprintf("Copied %d characters to the clipboard.", len(args.Text)), nil
+}
+
+func (t *ClipboardWriteTool) Preview(params map[string]interface{}) (string, error) {
+	var args ClipboardWriteArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+	return truncatePreview(args.Text, 2000), nil
+}
+
+func (t *ClipboardWriteTool) GetDisplayInfo(params map[string]interface{}) string {
+	var args ClipboardWriteArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("<%d chars>", len(args.Text))
+}
+
+// clipboardCommand returns the command that reads (or, with write, fills from stdin) the clipboard:
+// pbpaste/pbcopy on macOS, wl-clipboard on Wayland and xclip or xsel on X11
+func clipboardCommand(goos string, write, wayland bool, lookPath func(string) (string, error)) ([]string, error) {
+	switch goos {
+	case "darwin":
+		if write {
+			return []string{"pbcopy"}, nil
+		}
+		return []string{"pbpaste"}, nil
+
+	case "linux":
+		if wayland {
+			if write {
+				if _, err := lookPath("wl-copy"); err == nil {
+					return []string{"wl-copy"}, nil
+				}
+			} else if _, err := lookPath("wl-paste"); err == nil {
+				return []string{"wl-paste", "--no-newline"}, nil
+			}
+		}
+		if _, err := lookPath("xclip"); err == nil {
+			if write {
+				return []string{"xclip", "-selection", "clipboard", "-in"}, nil
+			}
+			return []string{"xclip", "-selection", "clipboard", "-out"}, nil
+		}
+		if _, err := lookPath("xsel"); err == nil {
+			if write {
+				return []string{"xsel", "--clipboard", "--input"}, nil
+			}
+			return []string{"xsel", "--clipboard", "--output"}, nil
+		}
+		return nil, fmt.Errorf("no clipboard utility found; install wl-clipboard, xclip or xsel")
+	}
+
+	return nil, fmt.Errorf("clipboard access is not supported on %s", goos)
+}
@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// recordFileVersion remembers the content of path as the agent last saw it
+func (m *Manager) recordFileVersion(path string) {
+	if m.agent == nil {
+		return
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	data, err := m.readFile(abs)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.agent.FileHashes == nil {
+		m.agent.FileHashes = make(map[string]string)
+	}
+	m.agent.FileHashes[abs] = hashContent(data)
+}
+
+// recordRead remembers the content of path both as the agent last saw it and as it now appears in
+// the conversation
+func (m *Manager) recordRead(path string) {
+	m.recordFileVersion(path)
+	if m.agent == nil {
+		return
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hash, ok := m.agent.FileHashes[abs]; ok {
+		if m.agent.ContextFiles == nil {
+			m.agent.ContextFiles = make(map[string]string)
+		}
+		m.agent.ContextFiles[abs] = hash
+	}
+}
+
+// StaleContextFiles lists the files whose content in the conversation no longer matches the disk,
+// each with what happened to it, and forgets them so each change is reported once. Reading a file
+// again makes it tracked again.
+func (m *Manager) StaleContextFiles() []string {
+	if m.agent == nil || len(m.agent.ContextFiles) == 0 {
+		return nil
+	}
+	var stale []string
+	for abs, readHash := range m.agent.ContextFiles {
+		data, err := m.readFile(abs)
+		var reason string
+		switch {
+		case os.IsNotExist(err):
+			reason = "deleted"
+		case err != nil:
+			continue
+		case hashContent(data) == readHash:
+			continue
+		case hashContent(data) == m.agent.FileHashes[abs]:
+			reason = "you edited it"
+		default:
+			reason = "changed outside mcode"
+		}
+		stale = append(stale, fmt.Sprintf("%s (%s)", displayPath(abs), reason))
+		delete(m.agent.ContextFiles, abs)
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// hasFileVersion reports whether the agent has read or written path
+func (m *Manager) hasFileVersion(path string) bool {
+	if m.agent == nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	_, ok := m.agent.FileHashes[abs]
+	return ok
+}
+
+// checkFileUnchanged refuses to modify a file whose content differs from what the agent last
+// read or wrote, so edits made meanwhile (e.g. in the user's editor) are not clobbered.
+// Files the agent has not seen yet are not checked.
+func (m *Manager) checkFileUnchanged(path string) error {
+	if m.agent == nil || m.agent.FileHashes == nil {
+		return nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	recorded, ok := m.agent.FileHashes[abs]
+	if !ok {
+		return nil
+	}
+
+	data, err := m.readFile(abs)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s was deleted since you last read it; check with the user before recreating it", path)
+	}
+	if err != nil {
+		return nil
+	}
+	if hashContent(data) != recorded {
+		return fmt.Errorf("%s changed on disk since you last read it (probably edited outside mcode); re-read it with read_file before editing", path)
+	}
+	return nil
+}
+
+func hashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
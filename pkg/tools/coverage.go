@@ -0,0 +1,246 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"coding-agent/pkg/coverage"
+	"coding-agent/pkg/i18n"
+	"coding-agent/pkg/project"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultCoverageFiles = 20
+	// maxUncoveredRanges bounds the ranges listed per file; the rest are summarized
+	maxUncoveredRanges = 15
+)
+
+// coverageProfiles are read when the coverage command does not use the {profile} placeholder
+var coverageProfiles = []string{"coverage.out", "cover.out", "lcov.info", "coverage/lcov.info"}
+
+type CoverageTool struct {
+	BaseTool
+}
+
+func (t *CoverageTool) Name() string {
+	return "coverage"
+}
+
+func (t *CoverageTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name(),
+			Description: "Run the project's tests with coverage and summarize the result: total and per-package percentages, and the least covered files with their uncovered line ranges. Use it to decide where new tests are needed.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Optional: only report files whose path contains this string (e.g. a package directory)",
+					},
+					"max_files": map[string]interface{}{
+						"type":        "integer",
+						"description": "Optional: maximum number of files to list, least covered first (default 20)",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *CoverageTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	var args CoverageArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %v", err)
+	}
+
+	var configured types.ProjectCommands
+	if t.manager.agent != nil && t.manager.agent.Config != nil {
+		configured = t.manager.agent.Config.Commands
+	}
+	command := project.ResolveCommands(cwd, configured).Coverage
+	if command == "" {
+		return "", fmt.Errorf("no coverage command configured or detected; set \"commands\": {\"coverage\": \"...\"} in ~/.mcode-config.json")
+	}
+
+	dir, err := os.MkdirTemp("", "mcode-coverage")
+	if err != nil {
+		return "", fmt.Errorf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	profilePath := filepath.Join(dir, "coverage.profile")
+	if t.manager.agent != nil && t.manager.agent.Exec != nil {
+		// The exec target only shares the project directory
+		profilePath = filepath.Join(cwd, fmt.Sprintf(".mcode-coverage-%d.out", os.Getpid()))
+		defer os.Remove(profilePath)
+	}
+	usesPlaceholder := strings.Contains(command, "{profile}")
+	command = strings.ReplaceAll(command, "{profile}", t.manager.execPath(profilePath))
+
+	ui.PrintfSafe("%s%s%s\n", types.ColorYellow, i18n.T("tool.executing", t.manager.execLabel(), command), types.ColorReset)
+	output, runErr := ShellCommand(ctx, t.manager.agent, command).CombinedOutput()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	if !usesPlaceholder {
+		profilePath = findCoverageProfile(cwd)
+	}
+	data, err := os.ReadFile(profilePath)
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		if runErr != nil {
+			return "", fmt.Errorf("coverage command failed: %v\n%s", runErr, tailLines(string(output), 40))
+		}
+		return "", fmt.Errorf("coverage command produced no profile")
+	}
+
+	report, err := coverage.Parse(data)
+	if err != nil {
+		return "", err
+	}
+	relativizeCoveragePaths(report, cwd)
+
+	summary := formatCoverage(report.Filter(args.Path), args.MaxFiles)
+	if runErr != nil {
+		summary = fmt.Sprintf("Note: the command failed (%v), so coverage may be incomplete.\n%s\n\n%s", runErr, tailLines(string(output), 20), summary)
+	}
+	return summary, nil
+}
+
+// findCoverageProfile returns the first conventional profile in dir, or "" when none exists
+func findCoverageProfile(dir string) string {
+	for _, name := range coverageProfiles {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// relativizeCoveragePaths rewrites Go import paths and absolute LCOV paths relative to the project root
+func relativizeCoveragePaths(report *coverage.Report, root string) {
+	module := goModulePath(root)
+	for i := range report.Files {
+		path := report.Files[i].Path
+		switch {
+		case module != "" && strings.HasPrefix(path, module+"/"):
+			path = strings.TrimPrefix(path, module+"/")
+		case filepath.IsAbs(path):
+			if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = filepath.ToSlash(rel)
+			}
+		}
+		report.Files[i].Path = path
+	}
+}
+
+// goModulePath reads the module path from dir/go.mod, returning "" when there is none
+func goModulePath(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module ")), `"`)
+		}
+	}
+	return ""
+}
+
+// formatCoverage renders the report with the least covered files first
+func formatCoverage(report *coverage.Report, maxFiles int) string {
+	if len(report.Files) == 0 {
+		return "No coverage data for the requested files."
+	}
+	if maxFiles <= 0 {
+		maxFiles = defaultCoverageFiles
+	}
+
+	var b strings.Builder
+	covered, total := report.Totals()
+	fmt.Fprintf(&b, "Total coverage: %.1f%% (%d/%d)\n", report.Percent(), covered, total)
+
+	packages := report.Packages()
+	if len(packages) > 1 {
+		b.WriteString("\nPackages:\n")
+		for _, pkg := range packages {
+			fmt.Fprintf(&b, "  %-50s %5.1f%% (%d/%d)\n", pkg.Path, pkg.Percent(), pkg.Covered, pkg.Total)
+		}
+	}
+
+	files := make([]coverage.FileCoverage, 0, len(report.Files))
+	for _, f := range report.Files {
+		if f.Covered < f.Total {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		b.WriteString("\nAll files are fully covered.")
+		return b.String()
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Percent() < files[j].Percent() })
+
+	b.WriteString("\nLeast covered files (uncovered lines):\n")
+	for i, f := range files {
+		if i == maxFiles {
+			fmt.Fprintf(&b, "  ... %d more files below 100%%\n", len(files)-maxFiles)
+			break
+		}
+		fmt.Fprintf(&b, "  %s %.1f%% (%d/%d)", f.Path, f.Percent(), f.Covered, f.Total)
+		if len(f.Uncovered) > 0 {
+			ranges := make([]string, 0, maxUncoveredRanges)
+			for j, r := range f.Uncovered {
+				if j == maxUncoveredRanges {
+					ranges = append(ranges, fmt.Sprintf("+%d more", len(f.Uncovered)-maxUncoveredRanges))
+					break
+				}
+				ranges = append(ranges, r.String())
+			}
+			fmt.Fprintf(&b, ": %s", strings.Join(ranges, ", "))
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// tailLines returns the last n lines of s
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = append([]string{"..."}, lines[len(lines)-n:]...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t *CoverageTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *CoverageTool) GetDisplayInfo(params map[string]interface{}) string {
+	var args CoverageArgs
+	if err := t.Unmarshal(params, &args); err != nil || args.Path == "" {
+		return ""
+	}
+	return fmt.Sprintf("<%s>", args.Path)
+}
@@ -0,0 +1,218 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"coding-agent/pkg/i18n"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+var (
+	customToolName    = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	customPlaceholder = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_-]+)\s*\}\}`)
+
+	// reportedCustomToolErrors keeps invalid definitions from being reported on every turn
+	reportedCustomToolErrors sync.Map
+)
+
+// CustomCommandTool is a tool defined in config that runs a templated shell command
+type CustomCommandTool struct {
+	BaseTool
+	def types.CustomTool
+}
+
+// registerCustomTools adds the tools defined in the user config and, once the user trusted the
+// file, in .mcode/tools.json. Neither can replace a built-in tool, and a project tool cannot
+// replace a user tool, whose tool policy and always-allow rules it would otherwise inherit.
+func (m *Manager) registerCustomTools() {
+	taken := make(map[string]bool, len(m.tools))
+	for name := range m.tools {
+		taken[name] = true
+	}
+	var userDefs []types.CustomTool
+	if m.agent.Config != nil {
+		userDefs = m.agent.Config.CustomTools
+	}
+	for _, def := range userDefs {
+		if err := validateCustomTool(def, taken); err != nil {
+			reportToolError(err)
+			continue
+		}
+		m.addTool(&CustomCommandTool{def: def})
+	}
+	if !m.agent.ToolSettingsTrusted {
+		return
+	}
+
+	for _, def := range userDefs {
+		taken[def.Name] = true
+	}
+	for _, def := range m.agent.ToolSettings.CustomTools {
+		if err := validateCustomTool(def, taken); err != nil {
+			reportToolError(err)
+			continue
+		}
+		m.addTool(&CustomCommandTool{def: def})
+	}
+}
+
+// reportToolError reports a problem with a configured tool once per session
+func reportToolError(err error) {
+	if _, reported := reportedCustomToolErrors.LoadOrStore(err.Error(), true); !reported {
+		ui.PrintfSafe("%s⚠️  Skipping configured tool: %v%s\n", types.ColorYellow, err, types.ColorReset)
+	}
+}
+
+// validateCustomTool checks a definition before it is offered to the model. taken are the names of
+// the tools it may not replace.
+func validateCustomTool(def types.CustomTool, taken map[string]bool) error {
+	if !customToolName.MatchString(def.Name) {
+		return fmt.Errorf("%q is not a valid tool name (letters, digits, _ and - only)", def.Name)
+	}
+	if taken[def.Name] {
+		return fmt.Errorf("%s: a built-in or user tool already has this name", def.Name)
+	}
+	if strings.TrimSpace(def.Command) == "" {
+		return fmt.Errorf("%s: command is empty", def.Name)
+	}
+	if def.Timeout < 0 {
+		return fmt.Errorf("%s: timeout_seconds must not be negative", def.Name)
+	}
+	if t, ok := def.Parameters["type"]; ok && t != "object" {
+		return fmt.Errorf("%s: parameters must be an object schema", def.Name)
+	}
+
+	properties, _ := def.Parameters["properties"].(map[string]interface{})
+	for _, match := range customPlaceholder.FindAllStringSubmatch(def.Command, -1) {
+		if _, ok := properties[match[1]]; !ok {
+			return fmt.Errorf("%s: command uses {{%s}}, which is not a declared parameter", def.Name, match[1])
+		}
+	}
+	if name := quotedPlaceholder(def.Command); name != "" {
+		return fmt.Errorf("%s: {{%s}} is inside quotes; placeholders are quoted when expanded, so leave them unquoted", def.Name, name)
+	}
+	return nil
+}
+
+// quotedPlaceholder returns the name of the first placeholder inside single or double quotes in a
+// command template, or "". Expansion quotes each argument itself; inside double quotes those
+// single quotes would be literal characters, and $(...) in the argument would run.
+func quotedPlaceholder(command string) string {
+	var quote byte
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote == 0 && c == '\\':
+			i++
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0 && c == '{':
+			if loc := customPlaceholder.FindStringSubmatchIndex(command[i:]); loc != nil && loc[0] == 0 {
+				return command[i+loc[2] : i+loc[3]]
+			}
+		}
+	}
+	return ""
+}
+
+func (t *CustomCommandTool) Name() string {
+	return t.def.Name
+}
+
+func (t *CustomCommandTool) Definition() openai.Tool {
+	parameters := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	for key, value := range t.def.Parameters {
+		parameters[key] = value
+	}
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.def.Name,
+			Description: t.def.Description,
+			Parameters:  parameters,
+		},
+	}
+}
+
+func (t *CustomCommandTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	if t.def.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(t.def.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	command := expandCustomCommand(t.def.Command, params)
+	ui.PrintfSafe("%s%s%s\n", types.ColorYellow, i18n.T("tool.executing", t.manager.execLabel(), command), types.ColorReset)
+
+	cmd := ShellCommand(ctx, t.manager.agent, command)
+	var outputBuf bytes.Buffer
+	cmd.Stdout = io.MultiWriter(&safeWriter{}, &outputBuf)
+	cmd.Stderr = cmd.Stdout
+	err := cmd.Run()
+	output := outputBuf.String()
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, fmt.Errorf("%s timed out after %d seconds. Output so far: %s", t.def.Name, t.def.Timeout, output)
+	}
+	if err != nil {
+		return output, fmt.Errorf("command failed: %v", err)
+	}
+	return output, nil
+}
+
+// expandCustomCommand replaces each {{name}} with the shell-quoted argument, so arguments
+// cannot inject shell syntax. Omitted optional arguments become empty strings.
+func expandCustomCommand(command string, params map[string]interface{}) string {
+	return customPlaceholder.ReplaceAllStringFunc(command, func(match string) string {
+		name := customPlaceholder.FindStringSubmatch(match)[1]
+		switch v := params[name].(type) {
+		case nil:
+			return "''"
+		case string:
+			return shellQuote(v)
+		case []interface{}:
+			quoted := make([]string, 0, len(v))
+			for _, item := range v {
+				quoted = append(quoted, shellQuote(customArgString(item)))
+			}
+			return strings.Join(quoted, " ")
+		default:
+			return shellQuote(customArgString(v))
+		}
+	})
+}
+
+func customArgString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (t *CustomCommandTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *CustomCommandTool) GetDisplayInfo(params map[string]interface{}) string {
+	return fmt.Sprintf(" `%s`", expandCustomCommand(t.def.Command, params))
+}
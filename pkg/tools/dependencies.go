@@ -0,0 +1,199 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"coding-agent/pkg/deps"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// maxDependencyFiles is how many importing files are listed per dependency in the overview
+	maxDependencyFiles = 5
+	// maxIndirectDependencies is how many indirect dependencies the overview names
+	maxIndirectDependencies = 50
+)
+
+type DependenciesTool struct {
+	BaseTool
+}
+
+func (t *DependenciesTool) Name() string {
+	return "dependencies"
+}
+
+func (t *DependenciesTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name(),
+			Description: "List a project's dependencies from go.mod, package.json, pyproject.toml and Cargo.toml (with their lock files): direct and indirect, declared and locked versions, and the source files that import each one. Use it before upgrading, replacing or removing a library instead of grepping for imports.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Optional: project directory to scan (default: current directory)",
+					},
+					"package": map[string]interface{}{
+						"type":        "string",
+						"description": "Optional: show only dependencies whose name contains this text, with every file that imports them",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *DependenciesTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	var args DependenciesArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+	root := args.Path
+	if root == "" {
+		root = "."
+	}
+
+	manifests, err := deps.Scan(root)
+	if err != nil {
+		return "", fmt.Errorf("error scanning %s: %v", root, err)
+	}
+	if len(manifests) == 0 {
+		return fmt.Sprintf("No go.mod, package.json, pyproject.toml or Cargo.toml found under %s", root), nil
+	}
+	if args.Package != "" {
+		return formatDependencyMatches(manifests, args.Package), nil
+	}
+
+	var b strings.Builder
+	for i, m := range manifests {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		writeManifestHeader(&b, m)
+		var indirect []*deps.Dependency
+		direct := 0
+		for _, d := range m.Deps {
+			if d.Indirect {
+				indirect = append(indirect, d)
+				continue
+			}
+			if direct == 0 {
+				b.WriteString("Direct dependencies:\n")
+			}
+			direct++
+			writeDependency(&b, d, maxDependencyFiles)
+		}
+		if direct == 0 {
+			b.WriteString("No direct dependencies\n")
+		}
+		if len(indirect) > 0 {
+			names := make([]string, 0, min(len(indirect), maxIndirectDependencies))
+			for _, d := range indirect[:min(len(indirect), maxIndirectDependencies)] {
+				names = append(names, d.Name+" "+d.Version)
+			}
+			fmt.Fprintf(&b, "Indirect dependencies (%d): %s", len(indirect), strings.Join(names, ", "))
+			if len(indirect) > maxIndirectDependencies {
+				fmt.Fprintf(&b, ", ... (pass package to look one up)")
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// formatDependencyMatches describes every dependency whose name contains the filter, in full
+func formatDependencyMatches(manifests []*deps.Manifest, filter string) string {
+	var b strings.Builder
+	found := 0
+	for _, m := range manifests {
+		wroteHeader := false
+		for _, d := range m.Deps {
+			if !strings.Contains(strings.ToLower(d.Name), strings.ToLower(filter)) {
+				continue
+			}
+			if !wroteHeader {
+				if found > 0 {
+					b.WriteString("\n")
+				}
+				writeManifestHeader(&b, m)
+				wroteHeader = true
+			}
+			found++
+			writeDependency(&b, d, -1)
+		}
+	}
+	if found == 0 {
+		return fmt.Sprintf("No dependency matching %q in %d manifest(s)", filter, len(manifests))
+	}
+	return b.String()
+}
+
+func writeManifestHeader(b *strings.Builder, m *deps.Manifest) {
+	fmt.Fprintf(b, "%s (%s", m.Path, m.Ecosystem)
+	if m.Name != "" {
+		fmt.Fprintf(b, " %s", m.Name)
+	}
+	b.WriteString(")\n")
+}
+
+// writeDependency writes one dependency line and the files importing it, up to limit (-1 for all)
+func writeDependency(b *strings.Builder, d *deps.Dependency, limit int) {
+	fmt.Fprintf(b, "  %s", d.Name)
+	if d.Version != "" {
+		fmt.Fprintf(b, " %s", d.Version)
+	}
+	if d.Locked != "" {
+		fmt.Fprintf(b, " (locked %s)", d.Locked)
+	}
+	var tags []string
+	if d.Kind != "" {
+		tags = append(tags, d.Kind)
+	}
+	if d.Indirect {
+		tags = append(tags, "indirect")
+	}
+	if d.Note != "" {
+		tags = append(tags, d.Note)
+	}
+	if len(tags) > 0 {
+		fmt.Fprintf(b, " [%s]", strings.Join(tags, ", "))
+	}
+
+	switch {
+	case len(d.Files) == 0:
+		b.WriteString(" - not imported by any source file\n")
+	case limit < 0 || len(d.Files) <= limit:
+		fmt.Fprintf(b, " - %d file(s): %s\n", len(d.Files), strings.Join(d.Files, ", "))
+	default:
+		fmt.Fprintf(b, " - %d file(s): %s, +%d more\n", len(d.Files), strings.Join(d.Files[:limit], ", "), len(d.Files)-limit)
+	}
+}
+
+func (t *DependenciesTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *DependenciesTool) GetDisplayInfo(params map[string]interface{}) string {
+	var args DependenciesArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return ""
+	}
+	info := ""
+	if args.Path != "" {
+		path := args.Path
+		if rel, err := filepath.Rel(".", path); err == nil {
+			path = rel
+		}
+		info = fmt.Sprintf(" <%s>", path)
+	}
+	if args.Package != "" {
+		info += " " + args.Package
+	}
+	return info
+}
@@ -3,7 +3,6 @@ package tools
 import (
 	"context"
 	"fmt"
-	"os"
 	"path/filepath"
 
 	"github.com/sashabaranov/go-openai"
@@ -21,8 +20,9 @@ func (t *EditFileTool) Definition() openai.Tool {
 	return openai.Tool{
 		Type: openai.ToolTypeFunction,
 		Function: &openai.FunctionDefinition{
-			Name:        t.Name(),
-			Description: "Perform incremental edits to a file using find-and-replace. MUCH FASTER than full file rewrites. For new files, use newString only. For edits, use oldString+newString.",
+			Name: t.Name(),
+			Description: "Perform incremental edits to a file using find-and-replace. MUCH FASTER than full file rewrites. For new files, use newString only. For edits, use oldString+newString. " +
+				"When oldString is ambiguous (repeated code) or keeps failing to match, replace lines by number instead with start_line+end_line+newString, after reading the file with read_file.",
 			Parameters: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -42,6 +42,28 @@ func (t *EditFileTool) Definition() openai.Tool {
 						"type":        "boolean",
 						"description": "Replace all occurrences of oldString (default: false - only replace if unique match)",
 					},
+					"start_line": map[string]interface{}{
+						"type":        "integer",
+						"description": "Line mode: first line to replace, 1-based (line N is at read_file offset N-1). Numbers refer to the file as it is now, after earlier edits.",
+					},
+					"end_line": map[string]interface{}{
+						"type":        "integer",
+						"description": "Line mode: last line to replace, inclusive. Use start_line-1 to insert newString before start_line; an empty newString deletes the lines.",
+					},
+					"cell_index": map[string]interface{}{
+						"type":        "integer",
+						"description": "Jupyter notebooks (.ipynb): the 0-based cell to edit, as numbered by read_file. newString replaces its source, or oldString+newString edits within it. Outputs and metadata are kept.",
+					},
+					"cell_mode": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"replace", "insert", "delete"},
+						"description": "Notebooks: replace the cell (default), insert a new cell with newString before cell_index (the cell count appends), or delete it",
+					},
+					"cell_type": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"code", "markdown", "raw"},
+						"description": "Notebooks: type of an inserted cell (default code), or a new type for the edited cell",
+					},
 				},
 				"required": []string{"filePath", "newString"},
 			},
@@ -49,6 +71,15 @@ func (t *EditFileTool) Definition() openai.Tool {
 	}
 }
 
+// NormalizeParams maps the path alias onto filePath so schema validation accepts either
+func (t *EditFileTool) NormalizeParams(params map[string]interface{}) {
+	if _, ok := params["filePath"]; !ok {
+		if path, ok := params["path"]; ok {
+			params["filePath"] = path
+		}
+	}
+}
+
 func (t *EditFileTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
 	var args EditFileArgs
 	if err := t.Unmarshal(params, &args); err != nil {
@@ -64,6 +95,34 @@ func (t *EditFileTool) Execute(ctx context.Context, params map[string]interface{
 		return "", ctx.Err()
 	}
 
+	if isNotebookEdit(path, args) {
+		result, err := t.manager.performNotebookEdit(path, args)
+		if err != nil {
+			return "", err
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "Notebook updated\n" + result + t.manager.afterEdit(ctx, path), nil
+	}
+
+	if args.StartLine != 0 {
+		if args.OldString != "" {
+			return "", fmt.Errorf("use either oldString or start_line/end_line, not both")
+		}
+		if _, ok := params["end_line"]; !ok {
+			return "", fmt.Errorf("end_line is required with start_line")
+		}
+		result, err := t.manager.performLineEdit(path, args.StartLine, args.EndLine, args.NewString)
+		if err != nil {
+			return "", err
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return fmt.Sprintf("Replaced lines %d-%d\n%s", args.StartLine, args.EndLine, result) + t.manager.afterEdit(ctx, path), nil
+	}
+
 	// Check for incremental edit (oldString + newString)
 	if args.OldString != "" {
 		result, err := t.manager.performIncrementalEdit(path, args.OldString, args.NewString, args.ReplaceAll)
@@ -73,7 +132,7 @@ func (t *EditFileTool) Execute(ctx context.Context, params map[string]interface{
 		if ctx.Err() != nil {
 			return "", ctx.Err()
 		}
-		return fmt.Sprintf("🚀🚀🚀 INCREMENTAL EDIT MODE (FAST!) 🚀🚀🚀\n%s", result), nil
+		return fmt.Sprintf("🚀🚀🚀 INCREMENTAL EDIT MODE (FAST!) 🚀🚀🚀\n%s", result) + t.manager.afterEdit(ctx, path), nil
 	}
 
 	// For new file creation, use newString parameter
@@ -85,7 +144,7 @@ func (t *EditFileTool) Execute(ctx context.Context, params map[string]interface{
 		if ctx.Err() != nil {
 			return "", ctx.Err()
 		}
-		return fmt.Sprintf("🚀🚀🚀 NEW FILE CREATION (FAST!) 🚀🚀🚀\n%s", result), nil
+		return fmt.Sprintf("🚀🚀🚀 NEW FILE CREATION (FAST!) 🚀🚀🚀\n%s", result) + t.manager.afterEdit(ctx, path), nil
 	}
 
 	return "", fmt.Errorf("either newString (for new files) or oldString+newString (for edits) must be provided")
@@ -102,8 +161,32 @@ func (t *EditFileTool) Preview(params map[string]interface{}) (string, error) {
 		return "", nil
 	}
 
+	if isNotebookEdit(path, args) {
+		content, err := t.manager.readFile(path)
+		if err != nil {
+			return fmt.Sprintf("⚠️  Preview Failed: Error reading file %s: %v", path, err), nil
+		}
+		updated, err := editNotebook(content, args)
+		if err != nil {
+			return fmt.Sprintf("⚠️  Preview Failed: %v\n(The tool will likely fail if executed)", err), nil
+		}
+		return notebookDiff(content, updated, path), nil
+	}
+
+	if args.StartLine != 0 {
+		content, err := t.manager.readFile(path)
+		if err != nil {
+			return fmt.Sprintf("⚠️  Preview Failed: Error reading file %s: %v", path, err), nil
+		}
+		newContent, err := ReplaceLines(string(content), args.StartLine, args.EndLine, args.NewString)
+		if err != nil {
+			return fmt.Sprintf("⚠️  Preview Failed: %v\n(The tool will likely fail if executed)", err), nil
+		}
+		return GenerateDiff(string(content), newContent, path), nil
+	}
+
 	if args.OldString != "" {
-		content, err := os.ReadFile(path)
+		content, err := t.manager.readFile(path)
 		if err != nil {
 			return fmt.Sprintf("⚠️  Preview Failed: Error reading file %s: %v", path, err), nil
 		}
@@ -140,7 +223,11 @@ func (t *EditFileTool) GetDisplayInfo(params map[string]interface{}) string {
 		path = relPath
 	}
 
-	if args.OldString != "" {
+	if args.CellIndex != nil {
+		return fmt.Sprintf(" 🚀 %s [CELL %d]", path, *args.CellIndex)
+	} else if args.StartLine != 0 {
+		return fmt.Sprintf(" 🚀 %s [LINES %d-%d]", path, args.StartLine, args.EndLine)
+	} else if args.OldString != "" {
 		return fmt.Sprintf(" 🚀 %s [INCREMENTAL]", path)
 	} else if args.NewString != "" {
 		return fmt.Sprintf(" 🚀 %s [NEW FILE]", path)
@@ -0,0 +1,112 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// envRuntimes are the commands env_info reports, with the arguments that print their version
+var envRuntimes = [][2]string{
+	{"go", "version"}, {"node", "--version"}, {"npm", "--version"}, {"bun", "--version"}, {"deno", "--version"},
+	{"python3", "--version"}, {"python", "--version"}, {"uv", "--version"}, {"ruby", "--version"},
+	{"java", "-version"}, {"rustc", "--version"}, {"cargo", "--version"}, {"gcc", "--version"}, {"clang", "--version"},
+	{"dotnet", "--version"}, {"php", "--version"}, {"docker", "--version"}, {"podman", "--version"},
+	{"kubectl", "version --client"}, {"git", "--version"}, {"make", "--version"},
+}
+
+// envScript prints the facts env_info reports. It is a shell script so it also works inside a
+// devcontainer or pod.
+var envScript = `echo "os: $(uname -s) $(uname -r)"
+echo "arch: $(uname -m)"
+if [ -r /etc/os-release ]; then (. /etc/os-release; echo "distribution: $PRETTY_NAME"); fi
+if command -v sw_vers >/dev/null 2>&1; then echo "distribution: macOS $(sw_vers -productVersion)"; fi
+echo "cpus: $(getconf _NPROCESSORS_ONLN 2>/dev/null || sysctl -n hw.ncpu 2>/dev/null)"
+if [ -r /proc/meminfo ]; then
+  awk '/^MemTotal/ {t=$2} /^MemAvailable/ {a=$2} END {printf "memory: %.1f GB total, %.1f GB available\n", t/1048576, a/1048576}' /proc/meminfo
+elif command -v sysctl >/dev/null 2>&1; then
+  echo "memory: $(sysctl -n hw.memsize | awk '{printf "%.1f GB total", $1/1073741824}')"
+fi
+echo "shell: ${SHELL:-unknown}"
+echo "working directory: $(pwd)"
+echo
+echo "Runtimes and tools:"
+missing=""
+probe() {
+  if command -v "$1" >/dev/null 2>&1; then
+    echo "$1: $("$@" 2>&1 | grep -v '^[[:space:]]*$' | head -n 1)"
+  else
+    missing="$missing $1"
+  fi
+}
+` + envProbes() + `if [ -n "$missing" ]; then echo; echo "Not installed:$missing"; fi
+`
+
+func envProbes() string {
+	var b strings.Builder
+	for _, r := range envRuntimes {
+		fmt.Fprintf(&b, "probe %s %s\n", r[0], r[1])
+	}
+	return b.String()
+}
+
+type EnvInfoTool struct {
+	BaseTool
+}
+
+func (t *EnvInfoTool) Name() string {
+	return "env_info"
+}
+
+func (t *EnvInfoTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name(),
+			Description: "Describe the environment commands run in: OS and distribution, architecture, CPUs and memory, shell, and the installed runtimes and tools with their versions (go, node, python, docker, ...). Call it once instead of probing with several bash commands.",
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+	}
+}
+
+func (t *EnvInfoTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	// The environment rarely changes within a session, except when commands move to another target
+	target := "host"
+	if t.manager.agent != nil && t.manager.agent.Exec != nil {
+		target = t.manager.agent.Exec.Name
+	}
+	if info, ok := t.manager.envInfo[target]; ok {
+		return info, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	out, err := ShellCommand(ctx, t.manager.agent, envScript).Output()
+	if err != nil && len(out) == 0 {
+		return "", fmt.Errorf("failed to inspect the environment: %v", err)
+	}
+
+	info := strings.TrimSpace(string(out))
+	if target != "host" {
+		info = fmt.Sprintf("target: %s\n%s", target, info)
+	}
+	if t.manager.envInfo == nil {
+		t.manager.envInfo = make(map[string]string)
+	}
+	t.manager.envInfo[target] = info
+	return info, nil
+}
+
+func (t *EnvInfoTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *EnvInfoTool) GetDisplayInfo(params map[string]interface{}) string {
+	return ""
+}
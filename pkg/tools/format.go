@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// maxFormatDiffChars bounds the formatting diff reported back to the model
+const maxFormatDiffChars = 3000
+
+// afterEdit runs the post-edit hooks (formatting, then linting) on a file the agent changed
+// and returns text to append to the edit result
+func (m *Manager) afterEdit(ctx context.Context, path string) string {
+	formatted := m.formatAfterEdit(ctx, path)
+	// The formatter may have rewritten the file; the model has seen the result in the diff
+	m.recordFileVersion(path)
+	return formatted + m.lintAfterEdit(ctx, path)
+}
+
+// formatAfterEdit runs the formatter configured for the file's extension. When formatting changes
+// the file, the model is shown the difference so its next oldString matches the content on disk.
+func (m *Manager) formatAfterEdit(ctx context.Context, path string) string {
+	command := m.formatterFor(path)
+	if command == "" {
+		return ""
+	}
+
+	before, err := m.readFile(path)
+	if err != nil {
+		return ""
+	}
+
+	if output, err := ShellCommand(ctx, m.agent, expandFormatterCommand(command, m.execPath(path))).CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return ""
+		}
+		return fmt.Sprintf("\n\nFormatter failed (the edit was kept unformatted): %v\n%s", err, tailLines(string(output), 10))
+	}
+
+	after, err := m.readFile(path)
+	if err != nil || string(after) == string(before) {
+		return ""
+	}
+
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(before)),
+		B:        difflib.SplitLines(string(after)),
+		FromFile: path + " (as written)",
+		ToFile:   path + " (formatted)",
+		Context:  1,
+	})
+	if len(diff) > maxFormatDiffChars {
+		diff = diff[:maxFormatDiffChars] + "\n... (diff truncated; re-read the file before editing it again)"
+	}
+	return fmt.Sprintf("\n\nThe formatter (%s) changed the file. Base further edits on the formatted content:\n%s", strings.Fields(command)[0], diff)
+}
+
+// formatterFor returns the formatter configured for path's extension, if any
+func (m *Manager) formatterFor(path string) string {
+	if m.agent == nil || m.agent.Config == nil {
+		return ""
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return ""
+	}
+	// Project formatters from .mcode/tools.json take precedence over the user's, but a cloned
+	// repository's commands only run once the user trusted the file
+	sources := []map[string]string{m.agent.Config.Formatters}
+	if m.agent.ToolSettingsTrusted {
+		sources = append([]map[string]string{m.agent.ToolSettings.Formatters}, sources...)
+	}
+	for _, formatters := range sources {
+		for key, command := range formatters {
+			if "."+strings.TrimPrefix(strings.ToLower(key), ".") == ext {
+				return strings.TrimSpace(command)
+			}
+		}
+	}
+	return ""
+}
+
+// expandFormatterCommand substitutes {file}, or appends the path when the command has no placeholder
+func expandFormatterCommand(command, path string) string {
+	if strings.Contains(command, "{file}") {
+		return strings.ReplaceAll(command, "{file}", shellQuote(path))
+	}
+	return command + " " + shellQuote(path)
+}
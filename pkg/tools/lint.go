@@ -0,0 +1,258 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"coding-agent/pkg/diagnostics"
+	"coding-agent/pkg/project"
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxLintFindings bounds the findings returned to the model
+const maxLintFindings = 50
+
+// lintExtensions restricts the files passed to well-known linters to the languages they check
+var lintExtensions = map[string][]string{
+	"golangci-lint": {".go"},
+	"go vet":        {".go"},
+	"eslint":        {".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs"},
+	"ruff":          {".py", ".pyi"},
+	"clippy":        {".rs"},
+}
+
+type LintTool struct {
+	BaseTool
+}
+
+func (t *LintTool) Name() string {
+	return "lint"
+}
+
+func (t *LintTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name(),
+			Description: "Run the project's linter (golangci-lint, eslint, ruff, ...) and return findings as file:line:col: message. By default lints the files changed in git.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"files": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Optional: files to lint instead of the files changed in git",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *LintTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	var args LintArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+
+	files := args.Files
+	if len(files) == 0 {
+		changed, err := changedFiles(ctx, t.manager.agent)
+		if err != nil {
+			return "", fmt.Errorf("could not determine changed files (%v); pass files explicitly", err)
+		}
+		if len(changed) == 0 {
+			return "No changed files to lint.", nil
+		}
+		files = changed
+	}
+	return t.manager.lint(ctx, files)
+}
+
+// lint runs the configured lint command on files and formats its findings
+func (m *Manager) lint(ctx context.Context, files []string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %v", err)
+	}
+
+	var configured types.ProjectCommands
+	if m.agent != nil && m.agent.Config != nil {
+		configured = m.agent.Config.Commands
+	}
+	command := project.ResolveCommands(cwd, configured).Lint
+	if command == "" {
+		return "", fmt.Errorf("no lint command configured or detected; set \"commands\": {\"lint\": \"...\"} in ~/.mcode-config.json")
+	}
+
+	files = lintableFiles(command, cwd, files)
+	if len(files) == 0 {
+		return "No files for this linter to check.", nil
+	}
+	command = expandLintCommand(command, files)
+
+	output, runErr := ShellCommand(ctx, m.agent, command).CombinedOutput()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	all := diagnostics.Parse(string(output))
+	diags := filterDiagnostics(all, cwd, files)
+	if len(diags) == 0 {
+		// Linters exit non-zero when they report findings, so a failure is only an error without any
+		if runErr != nil && len(all) == 0 {
+			return "", fmt.Errorf("lint command failed: %v\n%s", runErr, tailLines(string(output), 20))
+		}
+		return fmt.Sprintf("No lint findings in %d file(s).", len(files)), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d lint finding(s):\n", len(diags))
+	for i, d := range diags {
+		if i == maxLintFindings {
+			fmt.Fprintf(&b, "... and %d more\n", len(diags)-maxLintFindings)
+			break
+		}
+		fmt.Fprintf(&b, "%s\n", d)
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// lintAfterEdit lints a file the agent just changed when lint_after_edit is enabled,
+// returning text to append to the edit result
+func (m *Manager) lintAfterEdit(ctx context.Context, path string) string {
+	if m.agent == nil || m.agent.Config == nil || !m.agent.Config.LintAfterEdit {
+		return ""
+	}
+	result, err := m.lint(ctx, []string{path})
+	if err != nil {
+		return fmt.Sprintf("\n\nLint: %v", err)
+	}
+	return "\n\nLint: " + result
+}
+
+// changedFiles lists modified and untracked files in the git work tree, relative to the current directory
+func changedFiles(ctx context.Context, a *types.Agent) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, args := range [][]string{
+		{"diff", "--name-only", "--relative", "HEAD"},
+		{"ls-files", "--others", "--exclude-standard"},
+	} {
+		var stderr bytes.Buffer
+		cmd := hostCommand(ctx, a, append([]string{"git"}, args...))
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("git %s: %v %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		for _, file := range strings.Split(string(output), "\n") {
+			file = strings.TrimSpace(file)
+			if file == "" || seen[file] {
+				continue
+			}
+			// Deleted files show up in the diff but cannot be linted
+			if _, err := os.Stat(file); err != nil {
+				continue
+			}
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// lintableFiles makes files relative to cwd and drops those the linter does not check
+func lintableFiles(command, cwd string, files []string) []string {
+	var extensions []string
+	for name, exts := range lintExtensions {
+		if strings.Contains(command, name) {
+			extensions = exts
+			break
+		}
+	}
+
+	var result []string
+	for _, file := range files {
+		if filepath.IsAbs(file) {
+			if rel, err := filepath.Rel(cwd, file); err == nil && !strings.HasPrefix(rel, "..") {
+				file = rel
+			}
+		}
+		file = filepath.Clean(file)
+		if len(extensions) > 0 && !slices.Contains(extensions, filepath.Ext(file)) {
+			continue
+		}
+		result = append(result, file)
+	}
+	return result
+}
+
+// expandLintCommand substitutes the {files} and {dirs} placeholders
+func expandLintCommand(command string, files []string) string {
+	quoted := make([]string, 0, len(files))
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		quoted = append(quoted, shellQuote(file))
+		dir := filepath.Dir(file)
+		if !seen[dir] {
+			seen[dir] = true
+			if !filepath.IsAbs(dir) && dir != "." {
+				dir = "./" + dir
+			}
+			dirs = append(dirs, shellQuote(dir))
+		}
+	}
+	command = strings.ReplaceAll(command, "{files}", strings.Join(quoted, " "))
+	return strings.ReplaceAll(command, "{dirs}", strings.Join(dirs, " "))
+}
+
+// filterDiagnostics keeps findings for the linted files, since some linters always check the whole project
+func filterDiagnostics(diags []diagnostics.Diagnostic, cwd string, files []string) []diagnostics.Diagnostic {
+	wanted := make(map[string]bool)
+	for _, file := range files {
+		wanted[filepath.Clean(file)] = true
+	}
+
+	var result []diagnostics.Diagnostic
+	for _, d := range diags {
+		file := d.File
+		if filepath.IsAbs(file) {
+			if rel, err := filepath.Rel(cwd, file); err == nil {
+				file = rel
+			}
+		}
+		file = filepath.Clean(file)
+		if wanted[file] {
+			d.File = file
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (t *LintTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *LintTool) GetDisplayInfo(params map[string]interface{}) string {
+	var args LintArgs
+	if err := t.Unmarshal(params, &args); err != nil || len(args.Files) == 0 {
+		return "<changed files>"
+	}
+	return fmt.Sprintf("<%s>", strings.Join(args.Files, ", "))
+}
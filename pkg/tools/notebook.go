@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"coding-agent/pkg/notebook"
+)
+
+// readNotebook renders a notebook's cells for the model instead of its raw JSON
+func readNotebook(data []byte, offset, limit int) (string, error) {
+	nb, err := notebook.Parse(data)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimSuffix(nb.Render(), "\n"), "\n")
+	total := len(lines)
+	lines = lines[min(offset, len(lines)):]
+	if limit > 0 && len(lines) > limit {
+		lines = lines[:limit]
+	}
+	return formatFileLines(lines, total, offset, limit), nil
+}
+
+// isNotebookEdit reports whether an edit_file call changes notebook cells. Creating a notebook
+// with newString alone writes the JSON as given.
+func isNotebookEdit(path string, args EditFileArgs) bool {
+	return notebook.IsNotebookPath(path) && (args.CellIndex != nil || args.OldString != "" || args.StartLine != 0)
+}
+
+// editNotebook applies an edit_file call to a notebook's cells and returns the new file. Outputs
+// and metadata of the cells are kept.
+func editNotebook(data []byte, args EditFileArgs) ([]byte, error) {
+	nb, err := notebook.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if args.StartLine != 0 {
+		return nil, fmt.Errorf("notebooks are edited by cell: use cell_index instead of start_line")
+	}
+
+	if args.CellIndex == nil {
+		if args.OldString == "" {
+			return nil, fmt.Errorf("give cell_index, or oldString to find the cell to edit")
+		}
+		if err := replaceInCells(nb, args); err != nil {
+			return nil, err
+		}
+		return nb.Marshal()
+	}
+
+	index := *args.CellIndex
+	switch args.CellMode {
+	case "insert":
+		if index < 0 || index > len(nb.Cells) {
+			return nil, fmt.Errorf("cell_index %d is out of range for inserting into %d cells", index, len(nb.Cells))
+		}
+		cellType := args.CellType
+		if cellType == "" {
+			cellType = "code"
+		}
+		cell, err := nb.NewCell(cellType, args.NewString)
+		if err != nil {
+			return nil, err
+		}
+		nb.Cells = append(nb.Cells[:index], append([]notebook.Cell{cell}, nb.Cells[index:]...)...)
+	case "delete":
+		if index < 0 || index >= len(nb.Cells) {
+			return nil, fmt.Errorf("cell_index %d is out of range; the notebook has %d cells", index, len(nb.Cells))
+		}
+		nb.Cells = append(nb.Cells[:index], nb.Cells[index+1:]...)
+	case "", "replace":
+		if index < 0 || index >= len(nb.Cells) {
+			return nil, fmt.Errorf("cell_index %d is out of range; the notebook has %d cells", index, len(nb.Cells))
+		}
+		cell := &nb.Cells[index]
+		if args.OldString != "" {
+			source, err := ReplaceInContent(cell.Source, args.OldString, args.NewString, args.ReplaceAll)
+			if err != nil {
+				return nil, fmt.Errorf("cell %d: %v", index, err)
+			}
+			cell.Source = source
+		} else {
+			cell.Source = args.NewString
+		}
+		if args.CellType != "" {
+			if err := cell.SetType(args.CellType); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("cell_mode must be replace, insert or delete, not %q", args.CellMode)
+	}
+	return nb.Marshal()
+}
+
+// replaceInCells replaces oldString in the one cell that contains it, or in all cells that do
+// with replaceAll
+func replaceInCells(nb *notebook.Notebook, args EditFileArgs) error {
+	var matched []int
+	sources := make([]string, len(nb.Cells))
+	for i, cell := range nb.Cells {
+		source, err := ReplaceInContent(cell.Source, args.OldString, args.NewString, args.ReplaceAll)
+		if err != nil {
+			if strings.HasPrefix(err.Error(), "ambiguous") {
+				return fmt.Errorf("cell %d: %v", i, err)
+			}
+			continue
+		}
+		sources[i] = source
+		matched = append(matched, i)
+	}
+
+	if len(matched) == 0 {
+		return fmt.Errorf("text not found: the provided 'oldString' does not match any cell of the notebook")
+	}
+	if len(matched) > 1 && !args.ReplaceAll {
+		return fmt.Errorf("ambiguous replacement: 'oldString' is in cells %s. Pass cell_index to pick one", strings.ReplaceAll(strings.Trim(fmt.Sprint(matched), "[]"), " ", ", "))
+	}
+	for _, i := range matched {
+		nb.Cells[i].Source = sources[i]
+	}
+	return nil
+}
+
+// performNotebookEdit edits a notebook file on disk
+func (m *Manager) performNotebookEdit(path string, args EditFileArgs) (string, error) {
+	if err := m.checkFileUnchanged(path); err != nil {
+		return "", err
+	}
+	data, err := m.readFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %v", err)
+	}
+	updated, err := editNotebook(data, args)
+	if err != nil {
+		return "", err
+	}
+	if err := m.writeFile(path, updated); err != nil {
+		return "", fmt.Errorf("error writing file: %v", err)
+	}
+	m.recordFileVersion(path)
+	return notebookDiff(data, updated, path), nil
+}
+
+// notebookDiff compares the rendered notebooks rather than their JSON
+func notebookDiff(before, after []byte, path string) string {
+	old, err := notebook.Parse(before)
+	if err != nil {
+		return GenerateDiff(string(before), string(after), path)
+	}
+	updated, err := notebook.Parse(after)
+	if err != nil {
+		return GenerateDiff(string(before), string(after), path)
+	}
+	return GenerateDiff(old.Render(), updated.Render(), path)
+}
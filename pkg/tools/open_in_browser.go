@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+type OpenInBrowserTool struct {
+	BaseTool
+}
+
+func (t *OpenInBrowserTool) Name() string {
+	return "open_in_browser"
+}
+
+func (t *OpenInBrowserTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name(),
+			Description: "Open a URL or a local file (e.g. a generated coverage or HTML report) in the user's default browser.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"target": map[string]interface{}{
+						"type":        "string",
+						"description": "An http(s) URL or a path to a local file",
+					},
+				},
+				"required": []string{"target"},
+			},
+		},
+	}
+}
+
+func (t *OpenInBrowserTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	var args OpenInBrowserArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+
+	target, err := resolveBrowserTarget(args.Target)
+	if err != nil {
+		return "", err
+	}
+
+	argv, err := openCommand(runtime.GOOS, target)
+	if err != nil {
+		return "", err
+	}
+
+	if output, err := hostCommand(ctx, t.manager.agent, argv).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to open %s: %v %s", target, err, strings.TrimSpace(string(output)))
+	}
+	return fmt.Sprintf("Opened %s in the default browser.", target), nil
+}
+
+// resolveBrowserTarget accepts http(s) and file URLs or an existing local file, returned as an absolute path
+func resolveBrowserTarget(target string) (string, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return "", fmt.Errorf("target parameter is required")
+	}
+
+	if u, err := url.Parse(target); err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+		switch strings.ToLower(u.Scheme) {
+		case "http", "https":
+			if u.Host == "" {
+				return "", fmt.Errorf("invalid URL: %s", target)
+			}
+			return target, nil
+		case "file":
+			target = u.Path
+		default:
+			return "", fmt.Errorf("unsupported URL scheme %q; only http, https and local files can be opened", u.Scheme)
+		}
+	}
+
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %v", err)
+	}
+	if _, err := os.Stat(abs); err != nil {
+		return "", fmt.Errorf("file not found: %s", abs)
+	}
+	return abs, nil
+}
+
+// openCommand returns the command that opens target with the desktop's default handler
+func openCommand(goos, target string) ([]string, error) {
+	switch goos {
+	case "darwin":
+		return []string{"open", target}, nil
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return []string{"xdg-open", target}, nil
+	}
+	return nil, fmt.Errorf("opening a browser is not supported on %s", goos)
+}
+
+func (t *OpenInBrowserTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *OpenInBrowserTool) GetDisplayInfo(params map[string]interface{}) string {
+	var args OpenInBrowserArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("<%s>", args.Target)
+}
@@ -0,0 +1,290 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// maxPluginOutput bounds the plugin output returned to the model
+const maxPluginOutput = 100000
+
+// maxPluginFetch bounds a response body read for a plugin through mcode.http_get
+const maxPluginFetch = 4 << 20
+
+// pluginCache keeps compiled plugin modules, so only a plugin's first call pays for compilation
+var pluginCache = wazero.NewCompilationCache()
+
+// PluginTool is a tool implemented by a sandboxed WebAssembly module
+type PluginTool struct {
+	BaseTool
+	def types.Plugin
+}
+
+// registerPlugins adds the plugins defined in the user config and in .mcode/tools.json.
+// Relative paths in the user config resolve from ~/.mcode/plugins, in the project settings from
+// the current directory. A checked-out project cannot grant its plugins directories outside itself.
+func (m *Manager) registerPlugins() {
+	type source struct {
+		plugins []types.Plugin
+		baseDir string
+		confine bool // Only grant directories inside baseDir
+	}
+	var sources []source
+	if m.agent.Config != nil && len(m.agent.Config.Plugins) > 0 {
+		home, _ := os.UserHomeDir()
+		sources = append(sources, source{m.agent.Config.Plugins, filepath.Join(home, ".mcode", "plugins"), false})
+	}
+	if len(m.agent.ToolSettings.Plugins) > 0 {
+		cwd, _ := os.Getwd()
+		sources = append(sources, source{m.agent.ToolSettings.Plugins, cwd, true})
+	}
+	if len(sources) == 0 {
+		return
+	}
+
+	existing := make(map[string]bool, len(m.tools))
+	for name := range m.tools {
+		existing[name] = true
+	}
+	for _, src := range sources {
+		for _, def := range src.plugins {
+			def, err := resolvePlugin(def, src.baseDir, src.confine)
+			if err == nil {
+				err = validatePlugin(def, existing)
+			}
+			if err != nil {
+				reportToolError(err)
+				continue
+			}
+			m.addTool(&PluginTool{def: def})
+		}
+	}
+}
+
+// resolvePlugin makes the module and granted directories absolute. Project plugins are confined
+// to the project, compared with symlinks resolved so a link cannot lead out of it, and cannot be
+// granted the network.
+func resolvePlugin(def types.Plugin, baseDir string, confine bool) (types.Plugin, error) {
+	resolve := func(path string) string {
+		if filepath.IsAbs(path) {
+			return filepath.Clean(path)
+		}
+		return filepath.Join(baseDir, path)
+	}
+
+	if def.Module == "" {
+		return def, fmt.Errorf("plugin %s: module is required", def.Name)
+	}
+	if confine && def.Network {
+		return def, fmt.Errorf("plugin %s: project plugins cannot be granted network access; define the plugin in ~/.mcode-config.json instead", def.Name)
+	}
+	root := baseDir
+	if confine {
+		real, err := filepath.EvalSymlinks(baseDir)
+		if err != nil {
+			return def, fmt.Errorf("plugin %s: %v", def.Name, err)
+		}
+		root = real
+	}
+	def.Module = resolve(def.Module)
+	dirs := make([]string, 0, len(def.Dirs))
+	for _, dir := range def.Dirs {
+		dir = resolve(dir)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return def, fmt.Errorf("plugin %s: granted directory %s does not exist", def.Name, dir)
+		}
+		if confine {
+			real, err := filepath.EvalSymlinks(dir)
+			rel, relErr := filepath.Rel(root, real)
+			if err != nil || relErr != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return def, fmt.Errorf("plugin %s: project plugins can only be granted directories inside the project, not %s", def.Name, dir)
+			}
+			dir = real
+		}
+		dirs = append(dirs, dir)
+	}
+	def.Dirs = dirs
+	return def, nil
+}
+
+// validatePlugin checks a resolved definition before it is offered to the model
+func validatePlugin(def types.Plugin, existing map[string]bool) error {
+	if !customToolName.MatchString(def.Name) {
+		return fmt.Errorf("%q is not a valid plugin name (letters, digits, _ and - only)", def.Name)
+	}
+	if existing[def.Name] {
+		return fmt.Errorf("plugin %s: another tool already has this name", def.Name)
+	}
+	if info, err := os.Stat(def.Module); err != nil || info.IsDir() {
+		return fmt.Errorf("plugin %s: module %s not found", def.Name, def.Module)
+	}
+	if def.Timeout < 0 {
+		return fmt.Errorf("plugin %s: timeout_seconds must not be negative", def.Name)
+	}
+	if t, ok := def.Parameters["type"]; ok && t != "object" {
+		return fmt.Errorf("plugin %s: parameters must be an object schema", def.Name)
+	}
+	return nil
+}
+
+// pluginModuleConfig grants a plugin run its capabilities: the arguments on stdin, its granted
+// directories mounted at the same path and nothing else of the host
+func pluginModuleConfig(def types.Plugin, input []byte, stdout, stderr io.Writer) wazero.ModuleConfig {
+	fsConfig := wazero.NewFSConfig()
+	for _, dir := range def.Dirs {
+		fsConfig = fsConfig.WithDirMount(dir, dir)
+	}
+	return wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(def.Name).
+		WithEnv("MCODE_TOOL", def.Name).
+		WithStdin(bytes.NewReader(input)).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithFSConfig(fsConfig).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+}
+
+// instantiatePluginNetwork adds the mcode host module with http_get, the only way a plugin with
+// the network grant reaches the network: WASI preview 1 has no outbound sockets. The plugin
+// passes a URL and a buffer, and gets the number of body bytes written, or -1 on failure.
+func instantiatePluginNetwork(ctx context.Context, r wazero.Runtime) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	httpGet := func(ctx context.Context, m api.Module, urlPtr, urlLen, bufPtr, bufLen uint32) int32 {
+		raw, ok := m.Memory().Read(urlPtr, urlLen)
+		if !ok {
+			return -1
+		}
+		target := string(raw)
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+			return -1
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return -1
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return -1
+		}
+		defer resp.Body.Close()
+		limit := int64(bufLen)
+		if limit > maxPluginFetch {
+			limit = maxPluginFetch
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+		if err != nil || !m.Memory().Write(bufPtr, body) {
+			return -1
+		}
+		return int32(len(body))
+	}
+	_, err := r.NewHostModuleBuilder("mcode").
+		NewFunctionBuilder().WithFunc(httpGet).Export("http_get").
+		Instantiate(ctx)
+	return err
+}
+
+func (t *PluginTool) Name() string {
+	return t.def.Name
+}
+
+func (t *PluginTool) Definition() openai.Tool {
+	parameters := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	for key, value := range t.def.Parameters {
+		parameters[key] = value
+	}
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.def.Name,
+			Description: t.def.Description,
+			Parameters:  parameters,
+		},
+	}
+}
+
+func (t *PluginTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	input, err := json.Marshal(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode arguments: %v", err)
+	}
+
+	if t.def.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(t.def.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	module, err := os.ReadFile(t.def.Module)
+	if err != nil {
+		return "", fmt.Errorf("plugin %s: %v", t.def.Name, err)
+	}
+
+	// The module runs in-process; closing the runtime when the context ends stops it
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCompilationCache(pluginCache).WithCloseOnContextDone(true))
+	defer r.Close(context.Background())
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+	if t.def.Network {
+		if err := instantiatePluginNetwork(ctx, r); err != nil {
+			return "", fmt.Errorf("plugin %s: %v", t.def.Name, err)
+		}
+	}
+	compiled, err := r.CompileModule(ctx, module)
+	if err != nil {
+		return "", fmt.Errorf("plugin %s: invalid module: %v", t.def.Name, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	_, err = r.InstantiateModule(ctx, compiled, pluginModuleConfig(t.def, input, &stdout, &stderr))
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 0 {
+		err = nil
+	}
+
+	output := stdout.String()
+	if len(output) > maxPluginOutput {
+		output = output[:maxPluginOutput] + "\n[... plugin output truncated ...]"
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, fmt.Errorf("plugin %s timed out after %d seconds", t.def.Name, t.def.Timeout)
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return output, fmt.Errorf("plugin %s failed: %v %s", t.def.Name, err, strings.TrimSpace(tailLines(stderr.String(), 20)))
+	}
+	return output, nil
+}
+
+func (t *PluginTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *PluginTool) GetDisplayInfo(params map[string]interface{}) string {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(" (plugin) %s", truncatePreview(string(data), 200))
+}
@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"coding-agent/pkg/i18n"
+	"coding-agent/pkg/types"
+	"coding-agent/pkg/ui"
+	"github.com/sashabaranov/go-openai"
+)
+
+var (
+	powerShellOnce sync.Once
+	powerShellPath string
+)
+
+// findPowerShell returns the PowerShell executable on the host: pwsh (PowerShell 7, on every
+// platform), or Windows PowerShell. It is empty when neither is installed.
+func findPowerShell() string {
+	powerShellOnce.Do(func() {
+		for _, name := range []string{"pwsh", "powershell"} {
+			if path, err := exec.LookPath(name); err == nil {
+				powerShellPath = path
+				return
+			}
+		}
+	})
+	return powerShellPath
+}
+
+// PowerShellCommand prepares command to run through PowerShell. On an exec target it runs pwsh
+// there through the target's shell.
+func PowerShellCommand(ctx context.Context, a *types.Agent, command string) *exec.Cmd {
+	if a != nil && a.Exec != nil && len(a.Exec.Prefix) > 0 {
+		return ShellCommand(ctx, a, "pwsh -NoProfile -NonInteractive -Command "+shellQuote(command))
+	}
+	return hostCommand(ctx, a, []string{findPowerShell(), "-NoProfile", "-NonInteractive", "-Command", command})
+}
+
+type PowerShellCommandTool struct {
+	BaseTool
+}
+
+func (t *PowerShellCommandTool) Name() string {
+	return "powershell_command"
+}
+
+func (t *PowerShellCommandTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name(),
+			Description: "Execute a PowerShell command or script (.ps1) with pwsh. Use it for PowerShell cmdlets and scripts; use bash_command for POSIX shell commands.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"command": map[string]interface{}{
+						"type":        "string",
+						"description": "PowerShell command to execute, e.g. \"Get-ChildItem -Recurse *.ps1\" or \"./build.ps1 -Configuration Release\"",
+					},
+				},
+				"required": []string{"command"},
+			},
+		},
+	}
+}
+
+func (t *PowerShellCommandTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	var args PowerShellCommandArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+
+	if args.Command == "" {
+		return "", fmt.Errorf("command parameter is required")
+	}
+	warning, err := t.manager.checkSecrets(args.Command)
+	if err != nil {
+		return "", err
+	}
+
+	timeout := t.manager.agent.ToolSettings.BashTimeout
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	ui.PrintfSafe("%s%s%s\n", types.ColorYellow, i18n.T("tool.executing", t.manager.execLabel(), "PS> "+args.Command), types.ColorReset)
+	ui.PrintfSafe("%s%s%s\n", types.ColorBlue, i18n.T("tool.interrupt_hint"), types.ColorReset)
+
+	cmd := PowerShellCommand(ctx, t.manager.agent, args.Command)
+	output, err := runStreaming(ctx, cmd, timeout)
+	return output + warning, err
+}
+
+func (t *PowerShellCommandTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *PowerShellCommandTool) GetDisplayInfo(params map[string]interface{}) string {
+	var args PowerShellCommandArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return ""
+	}
+	return fmt.Sprintf(" `PS> %s`", args.Command)
+}
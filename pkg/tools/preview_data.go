@@ -0,0 +1,300 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"coding-agent/pkg/tabular"
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultPreviewRows = 10
+	maxPreviewRows     = 100
+)
+
+type PreviewDataTool struct {
+	BaseTool
+}
+
+func (t *PreviewDataTool) Name() string {
+	return "preview_data"
+}
+
+func (t *PreviewDataTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name(),
+			Description: "Preview a tabular data file: column names and types, the row count and the first rows. Supports CSV, TSV, Parquet (needs the duckdb CLI) and SQLite databases (needs the sqlite3 CLI). Use it instead of read_file for data files, which can be far too large to read.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path to the data file",
+					},
+					"rows": map[string]interface{}{
+						"type":        "integer",
+						"description": "Optional: number of rows to show (default 10, at most 100)",
+					},
+					"table": map[string]interface{}{
+						"type":        "string",
+						"description": "Optional: for SQLite, the table to show rows from. Without it all tables are listed with their columns and row counts.",
+					},
+				},
+				"required": []string{"path"},
+			},
+		},
+	}
+}
+
+func (t *PreviewDataTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	var args PreviewDataArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+	if args.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+	rows := defaultPreviewRows
+	if args.Rows > 0 {
+		rows = min(args.Rows, maxPreviewRows)
+	}
+
+	switch format := dataFormat(args.Path); format {
+	case "csv", "tsv":
+		return t.previewDelimited(args.Path, format, rows)
+	case "sqlite", "parquet":
+		// Absolute, so the path cannot be taken for a command-line option
+		path, err := filepath.Abs(args.Path)
+		if err != nil {
+			return "", err
+		}
+		if format == "sqlite" {
+			return previewSQLite(ctx, t.manager.agent, path, args.Table, rows)
+		}
+		return previewParquet(ctx, t.manager.agent, path, rows)
+	default:
+		return "", fmt.Errorf("%s is not a CSV, TSV, Parquet or SQLite file", args.Path)
+	}
+}
+
+// dataFormat tells the format of a data file from its extension, or for SQLite its header
+func dataFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".tsv", ".tab":
+		return "tsv"
+	case ".parquet", ".pq":
+		return "parquet"
+	case ".sqlite", ".sqlite3", ".db", ".db3":
+		return "sqlite"
+	}
+	if f, err := os.Open(path); err == nil {
+		defer f.Close()
+		header := make([]byte, 16)
+		if n, _ := io.ReadFull(f, header); n == 16 && string(header) == "SQLite format 3\x00" {
+			return "sqlite"
+		}
+	}
+	return ""
+}
+
+func (t *PreviewDataTool) previewDelimited(path, format string, rows int) (string, error) {
+	var r io.Reader
+	if t.manager.remoteFiles() {
+		data, err := t.manager.readFile(path)
+		if err != nil {
+			return "", fmt.Errorf("error opening file: %v", err)
+		}
+		r = bytes.NewReader(data)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("error opening file: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	comma := ','
+	if format == "tsv" {
+		comma = '\t'
+	} else {
+		// Some locales write CSV with semicolons; guess from the header line
+		buffered := bufio.NewReader(r)
+		r = buffered
+		if line, _ := buffered.Peek(4096); bytes.Count(firstLine(line), []byte(";")) > bytes.Count(firstLine(line), []byte(",")) {
+			comma = ';'
+		}
+	}
+
+	preview, err := tabular.ReadCSV(r, comma, rows)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return preview.Format(fmt.Sprintf("%s: %s", path, strings.ToUpper(format))), nil
+}
+
+func firstLine(data []byte) []byte {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[:i]
+	}
+	return data
+}
+
+// previewSQLite lists the tables of a database, or previews one of them, with the sqlite3 CLI
+func previewSQLite(ctx context.Context, a *types.Agent, path, table string, rows int) (string, error) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return "", fmt.Errorf("previewing SQLite databases needs the sqlite3 command-line tool")
+	}
+	sqlite := func(query string) ([][]string, error) {
+		return queryCSV(ctx, a, "sqlite3", "-readonly", "-bail", "-csv", "-header", path, query)
+	}
+
+	tables, err := sqlite("SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return "", err
+	}
+	if len(tables) <= 1 {
+		return fmt.Sprintf("%s: SQLite database with no tables\n", path), nil
+	}
+	names := make([]string, 0, len(tables)-1)
+	for _, row := range tables[1:] {
+		names = append(names, row[0])
+	}
+	if table == "" && len(names) == 1 {
+		table = names[0]
+	}
+
+	describe := func(name string, sampleRows int) (*tabular.Preview, error) {
+		p := &tabular.Preview{Rows: -1}
+		columns, err := sqlite(fmt.Sprintf("SELECT name, type FROM pragma_table_info(%s)", sqlString(name)))
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range columns[min(1, len(columns)):] {
+			p.Columns = append(p.Columns, tabular.Column{Name: col[0], Type: strings.ToLower(col[1])})
+		}
+		if count, err := sqlite("SELECT COUNT(*) FROM " + sqlIdent(name)); err == nil && len(count) == 2 {
+			p.Rows, _ = strconv.Atoi(count[1][0])
+		}
+		if sampleRows > 0 {
+			sample, err := sqlite(fmt.Sprintf("SELECT * FROM %s LIMIT %d", sqlIdent(name), sampleRows))
+			if err != nil {
+				return nil, err
+			}
+			if len(sample) > 1 {
+				p.Sample = sample[1:]
+			}
+		}
+		return p, nil
+	}
+
+	if table != "" {
+		p, err := describe(table, rows)
+		if err != nil {
+			return "", err
+		}
+		return p.Format(fmt.Sprintf("%s: SQLite table %s", path, table)), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: SQLite database with %d tables. Pass table to see rows.\n", path, len(names))
+	for _, name := range names {
+		p, err := describe(name, 0)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("\n" + p.Format("Table "+name))
+	}
+	return b.String(), nil
+}
+
+// previewParquet describes a Parquet file with the duckdb CLI
+func previewParquet(ctx context.Context, a *types.Agent, path string, rows int) (string, error) {
+	if _, err := exec.LookPath("duckdb"); err != nil {
+		return "", fmt.Errorf("previewing Parquet files needs the duckdb command-line tool")
+	}
+	source := "read_parquet(" + sqlString(path) + ")"
+	duckdb := func(query string) ([][]string, error) {
+		return queryCSV(ctx, a, "duckdb", "-csv", "-c", query)
+	}
+
+	p := &tabular.Preview{Rows: -1}
+	columns, err := duckdb("DESCRIBE SELECT * FROM " + source)
+	if err != nil {
+		return "", err
+	}
+	for _, col := range columns[min(1, len(columns)):] {
+		if len(col) >= 2 {
+			p.Columns = append(p.Columns, tabular.Column{Name: col[0], Type: strings.ToLower(col[1])})
+		}
+	}
+	if count, err := duckdb("SELECT COUNT(*) FROM " + source); err == nil && len(count) == 2 {
+		p.Rows, _ = strconv.Atoi(count[1][0])
+	}
+	sample, err := duckdb(fmt.Sprintf("SELECT * FROM %s LIMIT %d", source, rows))
+	if err != nil {
+		return "", err
+	}
+	if len(sample) > 1 {
+		p.Sample = sample[1:]
+	}
+	return p.Format(path + ": Parquet"), nil
+}
+
+// queryCSV runs a command that prints CSV and parses its output
+func queryCSV(ctx context.Context, a *types.Agent, name string, args ...string) ([][]string, error) {
+	var stderr bytes.Buffer
+	cmd := hostCommand(ctx, a, append([]string{name}, args...))
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	reader := csv.NewReader(bytes.NewReader(out))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader.ReadAll()
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sqlIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func (t *PreviewDataTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *PreviewDataTool) GetDisplayInfo(params map[string]interface{}) string {
+	var args PreviewDataArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return ""
+	}
+	path := args.Path
+	if rel, err := filepath.Rel(".", path); err == nil {
+		path = rel
+	}
+	if args.Table != "" {
+		return fmt.Sprintf(" <%s> table %s", path, args.Table)
+	}
+	return fmt.Sprintf(" <%s>", path)
+}
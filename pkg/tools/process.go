@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Process groups of the commands that are running, so they can be stopped when mcode is
+var (
+	processMu     sync.Mutex
+	processGroups = make(map[int]bool)
+)
+
+// interruptGrace is how long an interrupted command has to exit after SIGINT before its process
+// group is killed
+const interruptGrace = 2 * time.Second
+
+// killGroupOnCancel makes cancelling the command's context stop its whole process group rather
+// than only the shell, so servers and other children started by the command stop with it. The
+// group gets SIGINT first, as Ctrl+C in a terminal would send, so commands can clean up and
+// print what they have; whatever is still running after interruptGrace is killed.
+func killGroupOnCancel(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		pgid := cmd.Process.Pid
+		time.AfterFunc(interruptGrace, func() { syscall.Kill(-pgid, syscall.SIGKILL) })
+		return syscall.Kill(-pgid, syscall.SIGINT)
+	}
+	// Stop waiting for output held open by a child that left the group
+	cmd.WaitDelay = interruptGrace + 2*time.Second
+}
+
+// startTracked starts cmd and records its process group until untrack is called
+func startTracked(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	processMu.Lock()
+	processGroups[cmd.Process.Pid] = true
+	processMu.Unlock()
+	return nil
+}
+
+func untrack(cmd *exec.Cmd) {
+	processMu.Lock()
+	delete(processGroups, cmd.Process.Pid)
+	processMu.Unlock()
+}
+
+// KillProcessGroups stops every running command started by a tool, including background
+// commands, together with their children
+func KillProcessGroups() {
+	processMu.Lock()
+	defer processMu.Unlock()
+	for pgid := range processGroups {
+		syscall.Kill(-pgid, syscall.SIGKILL)
+		delete(processGroups, pgid)
+	}
+}
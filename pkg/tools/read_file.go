@@ -5,10 +5,11 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"coding-agent/pkg/imageutil"
+	"coding-agent/pkg/notebook"
 	"coding-agent/pkg/types"
 	"github.com/sashabaranov/go-openai"
 )
@@ -65,11 +66,15 @@ func (t *ReadFileTool) Execute(ctx context.Context, params map[string]interface{
 	}
 	offset := args.Offset
 
+	if t.manager.remoteFiles() {
+		return t.readRemote(args.Path, offset, limit)
+	}
+
 	// Smart path resolution: if file doesn't exist, try to find it
 	filePath := args.Path
 	if _, err := os.Stat(filePath); os.IsNotExist(err) && !filepath.IsAbs(filePath) {
 		// Try to find the file recursively
-		cmd := exec.CommandContext(ctx, "find", ".", "-name", filepath.Base(filePath), "-not", "-path", "*/.*")
+		cmd := hostCommand(ctx, t.manager.agent, []string{"find", ".", "-name", filepath.Base(filePath), "-not", "-path", "*/.*"})
 		output, _ := cmd.Output()
 		if ctx.Err() != nil {
 			return "", ctx.Err()
@@ -81,6 +86,25 @@ func (t *ReadFileTool) Execute(ctx context.Context, params map[string]interface{
 		}
 	}
 
+	if err := t.manager.sandboxAccess(filePath, false); err != nil {
+		return "", err
+	}
+
+	if imageutil.IsImagePath(filePath) {
+		return t.readImage(filePath)
+	}
+	if notebook.IsNotebookPath(filePath) {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return "", fmt.Errorf("error opening file: %v", err)
+		}
+		if result, err := readNotebook(data, offset, limit); err == nil {
+			t.manager.recordRead(filePath)
+			return result, nil
+		}
+		// Not valid notebook JSON; show it as it is
+	}
+
 	f, err := os.Open(filePath)
 	if err != nil {
 		return "", fmt.Errorf("error opening file: %v", err)
@@ -125,12 +149,62 @@ func (t *ReadFileTool) Execute(ctx context.Context, params map[string]interface{
 		return "", fmt.Errorf("error reading file: %v", err)
 	}
 
+	t.manager.recordRead(filePath)
+
+	return formatFileLines(lines, totalLines, offset, limit), nil
+}
+
+// readRemote reads a file that lives on the exec target rather than the host
+func (t *ReadFileTool) readRemote(path string, offset, limit int) (string, error) {
+	data, err := t.manager.readFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %v", err)
+	}
+	t.manager.recordRead(path)
+	if notebook.IsNotebookPath(path) {
+		if result, err := readNotebook(data, offset, limit); err == nil {
+			return result, nil
+		}
+	}
+
+	all := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		all = nil
+	}
+	lines := all[min(offset, len(all)):]
+	if limit > 0 && len(lines) > limit {
+		lines = lines[:limit]
+	}
+	return formatFileLines(lines, len(all), offset, limit), nil
+}
+
+func formatFileLines(lines []string, totalLines, offset, limit int) string {
 	content := strings.Join(lines, "\n")
 	if limit > 0 && (offset+len(lines) < totalLines) {
 		content += fmt.Sprintf("\n\n[... File truncated. %d/%d lines read starting from line %d. Use offset and limit to read more. ...]", len(lines), totalLines, offset)
 	}
+	return content
+}
+
+// readImage attaches an image file to the tool result when the model can see it
+func (t *ReadFileTool) readImage(path string) (string, error) {
+	if !t.manager.SupportsVision() {
+		return fmt.Sprintf("%s is an image file. The current model does not accept images (set \"vision\": true on a model that does).", path), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %v", err)
+	}
 
-	return content, nil
+	width, height, err := t.manager.AttachImage(data)
+	if err != nil {
+		return "", fmt.Errorf("error loading image: %v", err)
+	}
+	if width > 0 {
+		return fmt.Sprintf("Image %s attached (%dx%d).", path, width, height), nil
+	}
+	return fmt.Sprintf("Image %s attached.", path), nil
 }
 
 func (t *ReadFileTool) Preview(params map[string]interface{}) (string, error) {
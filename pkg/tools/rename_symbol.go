@@ -0,0 +1,263 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"coding-agent/pkg/lsp"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// renameTimeout bounds a rename, including the time the language server takes to load the project
+const renameTimeout = 2 * time.Minute
+
+// defaultLanguageServers are used for extensions the config does not set, when installed
+var defaultLanguageServers = map[string]string{
+	".go":  "gopls",
+	".ts":  "typescript-language-server --stdio",
+	".tsx": "typescript-language-server --stdio",
+	".js":  "typescript-language-server --stdio",
+	".jsx": "typescript-language-server --stdio",
+	".py":  "pylsp",
+	".rs":  "rust-analyzer",
+}
+
+type RenameSymbolTool struct {
+	BaseTool
+	planned *renamePlan // Computed for the approval preview, reused by Execute while the files are unchanged
+}
+
+// renamePlan is the outcome of asking the language server for a rename
+type renamePlan struct {
+	args    RenameSymbolArgs
+	server  string
+	changes []fileReplacement
+}
+
+func (t *RenameSymbolTool) Name() string {
+	return "rename_symbol"
+}
+
+func (t *RenameSymbolTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name: t.Name(),
+			Description: "Rename a function, type, variable, field or method everywhere it is used, through the language server (gopls, typescript-language-server, pylsp, rust-analyzer). " +
+				"Unlike text replacement it only touches references to that symbol, so prefer it for identifiers that are common words or shared by unrelated symbols. Returns the changed files.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "A file where the symbol is declared or used",
+					},
+					"line": map[string]interface{}{
+						"type":        "integer",
+						"description": "1-based line in that file where the symbol appears",
+					},
+					"symbol": map[string]interface{}{
+						"type":        "string",
+						"description": "The current name of the symbol, as written on that line",
+					},
+					"new_name": map[string]interface{}{
+						"type":        "string",
+						"description": "The new name",
+					},
+				},
+				"required": []string{"path", "line", "symbol", "new_name"},
+			},
+		},
+	}
+}
+
+func (t *RenameSymbolTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	var args RenameSymbolArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+
+	plan := t.planned
+	t.planned = nil
+	if plan == nil || plan.args != args || !plan.current() {
+		var err error
+		if plan, err = t.manager.planRename(ctx, args); err != nil {
+			return "", err
+		}
+	}
+	if len(plan.changes) == 0 {
+		return "", fmt.Errorf("%s found nothing to rename", plan.server)
+	}
+
+	result, err := t.manager.applyChanges(ctx, plan.changes)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Renamed %s to %s with %s: %d edit(s) in %d file(s):\n", args.Symbol, args.NewName, plan.server, countReplacements(plan.changes), len(plan.changes)) + result, nil
+}
+
+func (t *RenameSymbolTool) Preview(params map[string]interface{}) (string, error) {
+	var args RenameSymbolArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), renameTimeout)
+	defer cancel()
+	plan, err := t.manager.planRename(ctx, args)
+	if err != nil {
+		return fmt.Sprintf("⚠️  Preview Failed: %v\n(The tool will likely fail if executed)", err), nil
+	}
+	t.planned = plan
+	return fmt.Sprintf("%s: %d edit(s) in %d file(s):\n", plan.server, countReplacements(plan.changes), len(plan.changes)) + previewChanges(plan.changes), nil
+}
+
+func (t *RenameSymbolTool) GetDisplayInfo(params map[string]interface{}) string {
+	var args RenameSymbolArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return ""
+	}
+	return fmt.Sprintf(" %s → %s (%s:%d)", args.Symbol, args.NewName, displayPath(args.Path), args.Line)
+}
+
+// current reports whether the planned files still have the content the rename was computed for
+func (p *renamePlan) current() bool {
+	for _, c := range p.changes {
+		data, err := os.ReadFile(c.Path)
+		if err != nil || string(data) != c.OldContent {
+			return false
+		}
+	}
+	return true
+}
+
+// planRename asks the language server for the edits of a rename, without writing anything
+func (m *Manager) planRename(ctx context.Context, args RenameSymbolArgs) (*renamePlan, error) {
+	if args.Path == "" || args.Symbol == "" || args.NewName == "" {
+		return nil, fmt.Errorf("path, symbol and new_name are required")
+	}
+	if m.remoteFiles() {
+		return nil, fmt.Errorf("rename_symbol only works on local files")
+	}
+	path, err := filepath.Abs(args.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.sandboxAccess(path, false); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	content := string(data)
+	offset, err := symbolOffset(content, args.Line, args.Symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	command, err := m.languageServerFor(path)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, renameTimeout)
+	defer cancel()
+	server, err := lsp.Start(ctx, command, renameRoot(path))
+	if err != nil {
+		return nil, err
+	}
+	defer server.Close()
+
+	if err := server.Open(path, content); err != nil {
+		return nil, err
+	}
+	edit, err := server.Rename(path, lsp.PositionAt(content, offset), args.NewName)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s did not answer within %s", command[0], renameTimeout)
+		}
+		return nil, err
+	}
+	fileEdits, err := edit.FileEdits()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &renamePlan{args: args, server: command[0]}
+	for file, edits := range fileEdits {
+		if err := m.sandboxAccess(file, true); err != nil {
+			return nil, err
+		}
+		old, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", file, err)
+		}
+		updated, err := lsp.ApplyEdits(string(old), edits)
+		if err != nil {
+			return nil, fmt.Errorf("applying the edits to %s: %v", file, err)
+		}
+		if updated != string(old) {
+			plan.changes = append(plan.changes, fileReplacement{Path: file, OldContent: string(old), NewContent: updated, Count: len(edits)})
+		}
+	}
+	sort.Slice(plan.changes, func(i, j int) bool { return plan.changes[i].Path < plan.changes[j].Path })
+	return plan, nil
+}
+
+// symbolOffset returns the byte offset of the first whole-word occurrence of symbol on a 1-based line
+func symbolOffset(content string, line int, symbol string) (int, error) {
+	lines := strings.SplitAfter(content, "\n")
+	if line < 1 || line > len(lines) {
+		return 0, fmt.Errorf("line %d is out of range (the file has %d lines)", line, len(lines))
+	}
+	start := 0
+	for _, l := range lines[:line-1] {
+		start += len(l)
+	}
+	text := lines[line-1]
+	loc := regexp.MustCompile(`(^|[^\pL\pN_$])` + regexp.QuoteMeta(symbol) + `($|[^\pL\pN_$])`).FindStringSubmatchIndex(text)
+	if loc == nil {
+		return 0, fmt.Errorf("%s does not appear on line %d: %s", symbol, line, strings.TrimSpace(text))
+	}
+	return start + loc[3], nil
+}
+
+// languageServerFor returns the language server command for a file: the configured one for its
+// extension, or an installed default
+func (m *Manager) languageServerFor(path string) ([]string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if m.agent != nil && m.agent.Config != nil {
+		for key, command := range m.agent.Config.LanguageServers {
+			if "."+strings.TrimPrefix(strings.ToLower(key), ".") == ext && strings.TrimSpace(command) != "" {
+				return strings.Fields(command), nil
+			}
+		}
+	}
+	command, ok := defaultLanguageServers[ext]
+	if !ok {
+		return nil, fmt.Errorf("no language server is configured for %s files; set one in \"language_servers\" in the config", ext)
+	}
+	fields := strings.Fields(command)
+	if _, err := exec.LookPath(fields[0]); err != nil {
+		return nil, fmt.Errorf("%s is not installed; install it or set another server for %s files in \"language_servers\"", fields[0], ext)
+	}
+	return fields, nil
+}
+
+// renameRoot is the workspace the language server loads: the working directory, or the file's
+// directory when the file is outside it
+func renameRoot(path string) string {
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return cwd
+		}
+	}
+	return filepath.Dir(path)
+}
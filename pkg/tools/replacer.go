@@ -184,7 +184,7 @@ func ReplaceInContent(content, oldString, newString string, replaceAll bool) (st
 
 		// If we found matches, handle them
 		if !replaceAll && len(matches) > 1 {
-			return "", fmt.Errorf("ambiguous replacement: found %d matches for the provided text. Please provide more context (more surrounding lines) to make the match unique", len(matches))
+			return "", fmt.Errorf("ambiguous replacement: found %d matches for the provided text. Please provide more context (more surrounding lines) to make the match unique, or edit by line number with start_line and end_line", len(matches))
 		}
 
 		// Check for uniqueness of the specific match string in the whole content
@@ -195,7 +195,7 @@ func ReplaceInContent(content, oldString, newString string, replaceAll bool) (st
 			if firstIndex != lastIndex {
 				// Count occurrences
 				count := strings.Count(content, match)
-				return "", fmt.Errorf("ambiguous replacement: the text matches %d different locations in the file. Please include more surrounding lines in 'oldString' to uniquely identify the target", count)
+				return "", fmt.Errorf("ambiguous replacement: the text matches %d different locations in the file. Please include more surrounding lines in 'oldString' to uniquely identify the target, or edit by line number with start_line and end_line", count)
 			}
 		}
 
@@ -208,3 +208,41 @@ func ReplaceInContent(content, oldString, newString string, replaceAll bool) (st
 
 	return "", fmt.Errorf("text not found: the provided 'oldString' does not match any content in the file. Check for typos, indentation, or missing lines")
 }
+
+// ReplaceLines replaces lines start to end (1-based, inclusive) of content with replacement. An
+// end of start-1 inserts before line start and an empty replacement deletes the lines. Replacement
+// lines take the file's line endings.
+func ReplaceLines(content string, start, end int, replacement string) (string, error) {
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+	if start < 1 || start > len(lines)+1 {
+		return "", fmt.Errorf("start_line %d is outside the file, which has %d lines", start, len(lines))
+	}
+	if end < start-1 || end > len(lines) {
+		return "", fmt.Errorf("end_line %d must be between start_line-1 (to insert) and %d, the last line", end, len(lines))
+	}
+
+	var added []string
+	if replacement != "" {
+		added = strings.Split(strings.TrimSuffix(replacement, "\n"), "\n")
+	}
+	if strings.Contains(content, "\r\n") {
+		for i, line := range added {
+			if !strings.HasSuffix(line, "\r") {
+				added[i] = line + "\r"
+			}
+		}
+	}
+
+	result := append(append(append([]string{}, lines[:start-1]...), added...), lines[end:]...)
+	if len(result) == 0 {
+		return "", nil
+	}
+	out := strings.Join(result, "\n")
+	if content == "" || strings.HasSuffix(content, "\n") {
+		out += "\n"
+	}
+	return out, nil
+}
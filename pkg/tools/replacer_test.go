@@ -87,3 +87,37 @@ func TestReplaceInContent(t *testing.T) {
 		})
 	}
 }
+
+func TestReplaceLines(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		start, end  int
+		replacement string
+		want        string
+		wantErr     bool
+	}{
+		{name: "Replace one line", content: "a\nb\nc\n", start: 2, end: 2, replacement: "B", want: "a\nB\nc\n"},
+		{name: "Replace with more lines", content: "a\nb\nc\n", start: 1, end: 2, replacement: "x\ny\nz\n", want: "x\ny\nz\nc\n"},
+		{name: "Insert before a line", content: "a\nb\n", start: 2, end: 1, replacement: "new", want: "a\nnew\nb\n"},
+		{name: "Append after the last line", content: "a\nb\n", start: 3, end: 2, replacement: "c", want: "a\nb\nc\n"},
+		{name: "Delete lines", content: "a\nb\nc\n", start: 2, end: 3, replacement: "", want: "a\n"},
+		{name: "No trailing newline", content: "a\nb", start: 2, end: 2, replacement: "c", want: "a\nc"},
+		{name: "CRLF line endings", content: "a\r\nb\r\n", start: 1, end: 1, replacement: "x\ny", want: "x\r\ny\r\nb\r\n"},
+		{name: "Start past the end", content: "a\n", start: 3, end: 3, wantErr: true},
+		{name: "End before start", content: "a\nb\n", start: 2, end: 0, wantErr: true},
+		{name: "End past the end", content: "a\nb\n", start: 1, end: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReplaceLines(tt.content, tt.start, tt.end, tt.replacement)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReplaceLines() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ReplaceLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,6 +17,11 @@ type BashCommandArgs struct {
 	Command string `json:"command"`
 }
 
+// PowerShellCommandArgs defines the arguments for the powershell_command tool
+type PowerShellCommandArgs struct {
+	Command string `json:"command"`
+}
+
 // EditFileArgs defines the arguments for the edit_file tool
 type EditFileArgs struct {
 	FilePath   string `json:"filePath"`
@@ -24,6 +29,11 @@ type EditFileArgs struct {
 	OldString  string `json:"oldString,omitempty"`
 	NewString  string `json:"newString"`
 	ReplaceAll bool   `json:"replaceAll,omitempty"`
+	StartLine  int    `json:"start_line,omitempty"` // Line mode: first line to replace, 1-based
+	EndLine    int    `json:"end_line,omitempty"`   // Line mode: last line to replace; start_line-1 inserts before start_line
+	CellIndex  *int   `json:"cell_index,omitempty"` // Notebooks: the cell to edit, 0-based
+	CellMode   string `json:"cell_mode,omitempty"`  // Notebooks: replace (the default), insert or delete
+	CellType   string `json:"cell_type,omitempty"`  // Notebooks: code, markdown or raw for inserted or changed cells
 }
 
 // GetFilePath returns either FilePath or Path, whichever is provided
@@ -46,6 +56,23 @@ type SearchCodeArgs struct {
 	Directory string `json:"directory,omitempty"`
 }
 
+// SearchAndReplaceArgs defines the arguments for the search_and_replace tool
+type SearchAndReplaceArgs struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Regex       bool   `json:"regex,omitempty"`
+	Directory   string `json:"directory,omitempty"`
+	Include     string `json:"include,omitempty"`
+}
+
+// RenameSymbolArgs defines the arguments for the rename_symbol tool
+type RenameSymbolArgs struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line"`
+	Symbol  string `json:"symbol"`
+	NewName string `json:"new_name"`
+}
+
 // WebSearchArgs defines the arguments for the web_search tool
 type WebSearchArgs struct {
 	Query          string   `json:"query"`
@@ -61,3 +88,55 @@ type WebFetchArgs struct {
 	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
 	MaxChars       int    `json:"max_chars,omitempty"`
 }
+
+// ScreenshotArgs defines the arguments for the screenshot tool
+type ScreenshotArgs struct {
+	Mode  string `json:"mode,omitempty"`
+	Delay int    `json:"delay,omitempty"`
+}
+
+// ClipboardWriteArgs defines the arguments for the clipboard_write tool
+type ClipboardWriteArgs struct {
+	Text string `json:"text"`
+}
+
+// OpenInBrowserArgs defines the arguments for the open_in_browser tool
+type OpenInBrowserArgs struct {
+	Target string `json:"target"`
+}
+
+// CoverageArgs defines the arguments for the coverage tool
+type CoverageArgs struct {
+	Path     string `json:"path,omitempty"`
+	MaxFiles int    `json:"max_files,omitempty"`
+}
+
+// LintArgs defines the arguments for the lint tool
+type LintArgs struct {
+	Files []string `json:"files,omitempty"`
+}
+
+// PreviewDataArgs defines the arguments for the preview_data tool
+type PreviewDataArgs struct {
+	Path  string `json:"path"`
+	Rows  int    `json:"rows,omitempty"`
+	Table string `json:"table,omitempty"`
+}
+
+// DependenciesArgs defines the arguments for the dependencies tool
+type DependenciesArgs struct {
+	Path    string `json:"path,omitempty"`
+	Package string `json:"package,omitempty"`
+}
+
+// SQLQueryArgs defines the arguments for the sql_query tool
+type SQLQueryArgs struct {
+	Connection string `json:"connection,omitempty"`
+	Query      string `json:"query"`
+	MaxRows    int    `json:"max_rows,omitempty"`
+}
+
+// ScratchpadArgs defines the arguments for the scratchpad tool
+type ScratchpadArgs struct {
+	Note string `json:"note"`
+}
@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ScratchpadToolName is handled silently by the agent: notes are not shown in the chat
+const ScratchpadToolName = "scratchpad"
+
+type ScratchpadTool struct {
+	BaseTool
+}
+
+func (t *ScratchpadTool) Name() string {
+	return ScratchpadToolName
+}
+
+func (t *ScratchpadTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name: t.Name(),
+			Description: "Write a private working note: a plan, a hypothesis, what you ruled out, or facts to remember for later steps. " +
+				"The user does not see notes, so use this instead of thinking out loud in your replies. Notes stay in your context and are kept when the conversation is compacted. " +
+				"Keep each note short; call it again with an empty note to read back all notes.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"note": map[string]interface{}{
+						"type":        "string",
+						"description": "The note to add; empty to list the notes so far",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *ScratchpadTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	var args ScratchpadArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Note) != "" {
+		return "Noted.", nil
+	}
+
+	var notes []string
+	if t.manager.agent != nil {
+		notes = ScratchpadNotes(t.manager.agent.Messages())
+	}
+	if len(notes) == 0 {
+		return "No notes yet (notes from before the last compaction are in the conversation summary).", nil
+	}
+	var b strings.Builder
+	for i, note := range notes {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, note)
+	}
+	return b.String(), nil
+}
+
+func (t *ScratchpadTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *ScratchpadTool) GetDisplayInfo(params map[string]interface{}) string {
+	return ""
+}
+
+// ScratchpadNotes returns the notes written with the scratchpad tool in messages, oldest first.
+// The notes are only stored as the arguments of the tool calls.
+func ScratchpadNotes(messages []types.Message) []string {
+	var notes []string
+	for _, msg := range messages {
+		for _, call := range msg.ToolCalls {
+			if call.Function.Name != ScratchpadToolName {
+				continue
+			}
+			var args ScratchpadArgs
+			if json.Unmarshal([]byte(call.Function.Arguments), &args) == nil && strings.TrimSpace(args.Note) != "" {
+				notes = append(notes, strings.TrimSpace(args.Note))
+			}
+		}
+	}
+	return notes
+}
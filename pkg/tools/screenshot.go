@@ -0,0 +1,179 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Screenshot capture modes
+const (
+	screenshotScreen = "screen" // The whole screen
+	screenshotWindow = "window" // A window (the focused one where the tool supports it, otherwise picked by the user)
+	screenshotSelect = "select" // A region or window selected interactively by the user
+)
+
+type ScreenshotTool struct {
+	BaseTool
+}
+
+func (t *ScreenshotTool) Name() string {
+	return "screenshot"
+}
+
+func (t *ScreenshotTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name(),
+			Description: "Capture the screen or a window and attach the image so you can see it. Use it to inspect UI problems the user describes.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"mode": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{screenshotScreen, screenshotWindow, screenshotSelect},
+						"description": "What to capture: the whole screen (default), a window, or a region the user selects.",
+					},
+					"delay": map[string]interface{}{
+						"type":        "integer",
+						"description": "Optional: seconds to wait before capturing, so the user can bring the right window forward.",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *ScreenshotTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	var args ScreenshotArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+
+	if !t.manager.SupportsVision() {
+		return "", fmt.Errorf("the current model does not accept images")
+	}
+
+	mode := args.Mode
+	if mode == "" {
+		mode = screenshotScreen
+	}
+	if args.Delay < 0 || args.Delay > 30 {
+		return "", fmt.Errorf("delay must be between 0 and 30 seconds")
+	}
+
+	dir, err := os.MkdirTemp("", "mcode-screenshot")
+	if err != nil {
+		return "", fmt.Errorf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "screenshot.png")
+
+	argv, err := screenshotCommand(runtime.GOOS, mode, args.Delay, path, os.Getenv("WAYLAND_DISPLAY") != "", exec.LookPath)
+	if err != nil {
+		return "", err
+	}
+
+	// grim has no delay option, so wait here for it
+	if args.Delay > 0 && (argv[0] == "grim" || argv[0] == "sh") {
+		select {
+		case <-time.After(time.Duration(args.Delay) * time.Second):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	if output, err := hostCommand(ctx, t.manager.agent, argv).CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("screenshot failed: %v %s", err, output)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// Interactive captures leave no file when the user cancels the selection
+		return "", fmt.Errorf("no screenshot was taken (selection cancelled?)")
+	}
+
+	width, height, err := t.manager.AttachImage(data)
+	if err != nil {
+		return "", fmt.Errorf("error loading screenshot: %v", err)
+	}
+	return fmt.Sprintf("Screenshot of the %s attached (%dx%d).", mode, width, height), nil
+}
+
+// screenshotCommand returns the capture command for the platform: screencapture on macOS,
+// grim (with slurp for selections) on Wayland and scrot on X11
+func screenshotCommand(goos, mode string, delay int, path string, wayland bool, lookPath func(string) (string, error)) ([]string, error) {
+	if mode != screenshotScreen && mode != screenshotWindow && mode != screenshotSelect {
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+
+	switch goos {
+	case "darwin":
+		argv := []string{"screencapture", "-x"}
+		if delay > 0 {
+			argv = append(argv, "-T", strconv.Itoa(delay))
+		}
+		switch mode {
+		case screenshotWindow:
+			argv = append(argv, "-W")
+		case screenshotSelect:
+			argv = append(argv, "-i")
+		}
+		return append(argv, path), nil
+
+	case "linux":
+		if wayland {
+			if _, err := lookPath("grim"); err != nil {
+				return nil, fmt.Errorf("grim is required to take screenshots on Wayland")
+			}
+			if mode == screenshotScreen {
+				return []string{"grim", path}, nil
+			}
+			if _, err := lookPath("slurp"); err != nil {
+				return nil, fmt.Errorf("slurp is required to capture a window or region on Wayland")
+			}
+			// Delays are handled by the caller; the selection runs through a shell so slurp's output feeds grim
+			return []string{"sh", "-c", `grim -g "$(slurp)" "$1"`, "sh", path}, nil
+		}
+
+		if _, err := lookPath("scrot"); err != nil {
+			return nil, fmt.Errorf("scrot is required to take screenshots on X11")
+		}
+		argv := []string{"scrot", "--overwrite"}
+		if delay > 0 {
+			argv = append(argv, "-d", strconv.Itoa(delay))
+		}
+		switch mode {
+		case screenshotWindow:
+			argv = append(argv, "-u")
+		case screenshotSelect:
+			argv = append(argv, "-s")
+		}
+		return append(argv, path), nil
+	}
+
+	return nil, fmt.Errorf("screenshots are not supported on %s", goos)
+}
+
+func (t *ScreenshotTool) Preview(params map[string]interface{}) (string, error) {
+	return "", nil
+}
+
+func (t *ScreenshotTool) GetDisplayInfo(params map[string]interface{}) string {
+	var args ScreenshotArgs
+	if err := t.Unmarshal(params, &args); err != nil || args.Mode == "" {
+		return "<screen>"
+	}
+	return fmt.Sprintf("<%s>", args.Mode)
+}
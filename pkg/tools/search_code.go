@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"os/exec"
@@ -41,6 +42,9 @@ func (t *SearchCodeTool) Definition() openai.Tool {
 	}
 }
 
+// maxSearchLines caps the matches search_code returns
+const maxSearchLines = 100
+
 func (t *SearchCodeTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
 	var args SearchCodeArgs
 	if err := t.Unmarshal(params, &args); err != nil {
@@ -56,26 +60,69 @@ func (t *SearchCodeTool) Execute(ctx context.Context, params map[string]interfac
 		directory = "."
 	}
 
-	// Use -E for extended regex support (e.g. | operator)
-	cmd := exec.CommandContext(ctx, "bash", "-c", fmt.Sprintf("grep -rEnI %q %s | head -n 100", args.Pattern, directory))
-	output, _ := cmd.CombinedOutput()
+	if err := t.manager.sandboxAccess(directory, false); err != nil {
+		return "", err
+	}
+
+	// Use -E for extended regex support (e.g. | operator). The pattern is an argument of its own
+	// rather than part of a shell command, so nothing in it is expanded.
+	argv := []string{"grep", "-rEnI"}
+	// Project excludes may name directories or files, so each is passed as both
+	for _, glob := range t.manager.agent.ToolSettings.SearchExcludes {
+		argv = append(argv, "--exclude-dir="+glob, "--exclude="+glob)
+	}
+	argv = append(argv, "-e", args.Pattern, "--", directory)
 
+	output, truncated, err := firstLines(hostCommand(ctx, t.manager.agent, argv), maxSearchLines)
 	if ctx.Err() != nil {
 		return "", ctx.Err()
 	}
+	if err != nil {
+		return "", fmt.Errorf("error running grep: %v", err)
+	}
 
 	result := string(output)
 	if result == "" {
 		return fmt.Sprintf("No results found for pattern %q in directory %s", args.Pattern, directory), nil
 	}
 
-	if strings.Count(result, "\n") >= 100 {
-		result += "\n\n[... Search results truncated to 100 lines. Use more specific patterns if needed. ...]"
+	if truncated {
+		result += fmt.Sprintf("\n[... Search results truncated to %d lines. Use more specific patterns if needed. ...]", maxSearchLines)
 	}
 
 	return result, nil
 }
 
+// firstLines runs cmd and returns the first n lines of its combined output, stopping it once there
+// are more
+func firstLines(cmd *exec.Cmd, n int) (output string, truncated bool, err error) {
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", false, err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return "", false, err
+	}
+	var b strings.Builder
+	reader := bufio.NewReader(pipe)
+	for lines := 0; ; lines++ {
+		line, readErr := reader.ReadString('\n')
+		if line != "" && lines == n {
+			truncated = true
+			cmd.Process.Kill()
+			break
+		}
+		b.WriteString(line)
+		if readErr != nil {
+			break
+		}
+	}
+	// grep exits 1 when nothing matches, which is not a failure here
+	cmd.Wait()
+	return b.String(), truncated, nil
+}
+
 func (t *SearchCodeTool) Preview(params map[string]interface{}) (string, error) {
 	return "", nil
 }
@@ -0,0 +1,315 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// maxReplaceFileBytes skips files too large to be source code
+	maxReplaceFileBytes = 2 * 1024 * 1024
+	// maxReplacePreviewFiles limits the diffs shown for approval; the rest are listed with their counts
+	maxReplacePreviewFiles = 20
+)
+
+// replaceSkipDirs are never searched, in addition to hidden directories
+var replaceSkipDirs = map[string]bool{"node_modules": true, "vendor": true, "target": true, "dist": true, "build": true, "__pycache__": true}
+
+type SearchAndReplaceTool struct {
+	BaseTool
+}
+
+// fileReplacement is the new content of a file and the number of matches (or edits) replaced in it
+type fileReplacement struct {
+	Path       string
+	OldContent string
+	NewContent string
+	Count      int
+}
+
+func (t *SearchAndReplaceTool) Name() string {
+	return "search_and_replace"
+}
+
+func (t *SearchAndReplaceTool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name: t.Name(),
+			Description: "Replace text across many files at once, e.g. to rename an identifier or update an import path everywhere. " +
+				"Use it instead of many edit_file calls for mechanical changes; check what matches with search_code first. " +
+				"The user approves one combined diff; the result lists the matches replaced per file.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"pattern": map[string]interface{}{
+						"type":        "string",
+						"description": "The text to find. Matched literally unless regex is true",
+					},
+					"replacement": map[string]interface{}{
+						"type":        "string",
+						"description": "The replacement text. With regex, $1 or ${name} insert capture groups",
+					},
+					"regex": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Treat pattern as a Go regular expression, e.g. \\bOldName\\b to match whole words (default: false)",
+					},
+					"directory": map[string]interface{}{
+						"type":        "string",
+						"description": "Directory to search recursively (defaults to current directory). Hidden directories, node_modules and vendor are skipped",
+					},
+					"include": map[string]interface{}{
+						"type":        "string",
+						"description": "Only change files whose name matches this glob, e.g. *.go or *.{ts,tsx}",
+					},
+				},
+				"required": []string{"pattern", "replacement"},
+			},
+		},
+	}
+}
+
+func (t *SearchAndReplaceTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	var args SearchAndReplaceArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", err
+	}
+
+	changes, err := t.manager.planReplacement(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	if len(changes) == 0 {
+		return fmt.Sprintf("No matches for %q in %s", args.Pattern, args.directory()), nil
+	}
+
+	result, err := t.manager.applyChanges(ctx, changes)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Replaced %d match(es) in %d file(s):\n", countReplacements(changes), len(changes)) + result, nil
+}
+
+func (t *SearchAndReplaceTool) Preview(params map[string]interface{}) (string, error) {
+	var args SearchAndReplaceArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return "", nil
+	}
+	changes, err := t.manager.planReplacement(context.Background(), args)
+	if err != nil {
+		return fmt.Sprintf("⚠️  Preview Failed: %v\n(The tool will likely fail if executed)", err), nil
+	}
+	if len(changes) == 0 {
+		return fmt.Sprintf("No matches for %q in %s", args.Pattern, args.directory()), nil
+	}
+
+	return fmt.Sprintf("%d match(es) in %d file(s):\n", countReplacements(changes), len(changes)) + previewChanges(changes), nil
+}
+
+func (t *SearchAndReplaceTool) GetDisplayInfo(params map[string]interface{}) string {
+	var args SearchAndReplaceArgs
+	if err := t.Unmarshal(params, &args); err != nil {
+		return ""
+	}
+	info := fmt.Sprintf(" %q → %q in %s", args.Pattern, args.Replacement, args.directory())
+	if args.Include != "" {
+		info += " (" + args.Include + ")"
+	}
+	return info
+}
+
+// planReplacement finds the files under the directory that the replacement changes, without
+// writing anything
+func (m *Manager) planReplacement(ctx context.Context, args SearchAndReplaceArgs) ([]fileReplacement, error) {
+	if args.Pattern == "" {
+		return nil, fmt.Errorf("pattern parameter is required")
+	}
+	if m.remoteFiles() {
+		return nil, fmt.Errorf("search_and_replace only works on local files; use edit_file for each file")
+	}
+	var re *regexp.Regexp
+	if args.Regex {
+		var err error
+		if re, err = regexp.Compile(args.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid regex: %v", err)
+		}
+	}
+	includes := expandBraces(args.Include)
+
+	var excludes []string
+	if m.agent != nil {
+		excludes = m.agent.ToolSettings.SearchExcludes
+	}
+	excluded := func(name string) bool {
+		for _, glob := range excludes {
+			if ok, _ := filepath.Match(glob, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	root := args.directory()
+	if err := m.sandboxAccess(root, false); err != nil {
+		return nil, err
+	}
+	var changes []fileReplacement
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (replaceSkipDirs[name] || strings.HasPrefix(name, ".") || excluded(name)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || excluded(name) || !matchesAny(includes, name) {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxReplaceFileBytes {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			return nil
+		}
+		content := string(data)
+		var updated string
+		var count int
+		if re != nil {
+			count = len(re.FindAllStringIndex(content, -1))
+			if count > 0 {
+				updated = re.ReplaceAllString(content, args.Replacement)
+			}
+		} else {
+			count = strings.Count(content, args.Pattern)
+			if count > 0 {
+				updated = strings.ReplaceAll(content, args.Pattern, args.Replacement)
+			}
+		}
+		if count > 0 && updated != content {
+			changes = append(changes, fileReplacement{Path: path, OldContent: content, NewContent: updated, Count: count})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// applyChanges writes the new content of several files, checking all of them first so a conflict
+// does not leave a change half done. It returns the per-file counts and the formatter and linter
+// output.
+func (m *Manager) applyChanges(ctx context.Context, changes []fileReplacement) (string, error) {
+	for _, c := range changes {
+		if err := m.checkFileUnchanged(c.Path); err != nil {
+			return "", err
+		}
+		if err := checkEditSyntax(c.Path, c.OldContent, c.NewContent, true); err != nil {
+			return "", err
+		}
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	var result strings.Builder
+	for _, c := range changes {
+		if err := m.writeFile(c.Path, []byte(c.NewContent)); err != nil {
+			return "", fmt.Errorf("error writing %s (files listed before it were already changed): %v\n%s", c.Path, err, result.String())
+		}
+		m.recordFileVersion(c.Path)
+		fmt.Fprintf(&result, "  %s: %d\n", displayPath(c.Path), c.Count)
+	}
+	for _, c := range changes {
+		result.WriteString(m.afterEdit(ctx, c.Path))
+	}
+	return result.String(), nil
+}
+
+// previewChanges lists the per-file counts and the diffs of the first files
+func previewChanges(changes []fileReplacement) string {
+	var b strings.Builder
+	for _, c := range changes {
+		fmt.Fprintf(&b, "  %s: %d\n", displayPath(c.Path), c.Count)
+	}
+	for i, c := range changes {
+		if i == maxReplacePreviewFiles {
+			fmt.Fprintf(&b, "\n... diffs of %d more file(s) not shown\n", len(changes)-i)
+			break
+		}
+		b.WriteString("\n" + GenerateDiff(c.OldContent, c.NewContent, displayPath(c.Path)))
+	}
+	return b.String()
+}
+
+func (a SearchAndReplaceArgs) directory() string {
+	if a.Directory == "" {
+		return "."
+	}
+	return a.Directory
+}
+
+// expandBraces turns a glob like *.{ts,tsx} into *.ts and *.tsx, which filepath.Match does not support
+func expandBraces(glob string) []string {
+	if glob == "" {
+		return nil
+	}
+	open := strings.Index(glob, "{")
+	end := strings.Index(glob, "}")
+	if open < 0 || end < open {
+		return []string{glob}
+	}
+	var globs []string
+	for _, alt := range strings.Split(glob[open+1:end], ",") {
+		globs = append(globs, expandBraces(glob[:open]+alt+glob[end+1:])...)
+	}
+	return globs
+}
+
+// matchesAny reports whether name matches one of the globs; no globs match everything
+func matchesAny(globs []string, name string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func countReplacements(changes []fileReplacement) int {
+	n := 0
+	for _, c := range changes {
+		n += c.Count
+	}
+	return n
+}
+
+// displayPath shows a path relative to the working directory when it is inside it
+func displayPath(path string) string {
+	if rel, err := filepath.Rel(".", path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"coding-agent/pkg/secrets"
+)
+
+// Values of the secret_scan setting
+const (
+	SecretScanBlock = "block"
+	SecretScanWarn  = "warn"
+	SecretScanOff   = "off"
+)
+
+// publishCommand matches commands that record or publish changes: git commit, git push and gh pr create
+var publishCommand = regexp.MustCompile(`\bgit\s+(?:-C\s+\S+\s+|-c\s+\S+\s+|--[\w-]+(?:=\S+)?\s+)*(?:commit|push)\b|\bgh\s+pr\s+create\b`)
+
+// recordModified remembers a file the agent wrote. The set is kept on the agent, as a manager
+// only lasts for one prompt.
+func (m *Manager) recordModified(path string) {
+	if m.agent == nil {
+		return
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.agent.ModifiedFiles == nil {
+		m.agent.ModifiedFiles = make(map[string]bool)
+	}
+	m.agent.ModifiedFiles[path] = true
+}
+
+// modifiedFiles returns the files the agent wrote, sorted
+func (m *Manager) modifiedFiles() []string {
+	if m.agent == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	paths := make([]string, 0, len(m.agent.ModifiedFiles))
+	for path := range m.agent.ModifiedFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// checkSecrets scans the files the agent wrote before a command commits or pushes them. When
+// secrets are found it returns an error, or with secret_scan set to warn, a warning to add to the
+// command output.
+func (m *Manager) checkSecrets(command string) (string, error) {
+	mode := ""
+	if m.agent != nil && m.agent.Config != nil {
+		mode = m.agent.Config.SecretScan
+	}
+	if mode == SecretScanOff || !publishCommand.MatchString(command) {
+		return "", nil
+	}
+	paths := m.modifiedFiles()
+	if len(paths) == 0 {
+		return "", nil
+	}
+
+	var findings []secrets.Finding
+	for _, path := range paths {
+		data, err := m.readFile(path)
+		if err != nil {
+			// Deleted or moved since
+			continue
+		}
+		name := path
+		if rel, err := filepath.Rel(".", path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+		findings = append(findings, secrets.Scan(name, data)...)
+	}
+	if len(findings) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "possible secrets in files you changed:\n")
+	for _, f := range findings {
+		fmt.Fprintf(&b, "  %s\n", f)
+	}
+	fmt.Fprintf(&b, "Read credentials from the environment or a secret store instead of hardcoding them. If a finding is not a secret, add a %q comment on its line.", secrets.AllowComment)
+	if mode == SecretScanWarn {
+		return "\n\nWarning: " + b.String(), nil
+	}
+	return "", fmt.Errorf("command not run, %s", b.String())
+}
@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"syscall"
+
+	"coding-agent/pkg/sandbox"
+	"coding-agent/pkg/types"
+)
+
+// ShellCommand prepares command to run through bash on the agent's exec target,
+// or on the host when there is none. The command gets its own process group, which is
+// killed when ctx is cancelled, so interrupting it also stops its children.
+func ShellCommand(ctx context.Context, a *types.Agent, command string) *exec.Cmd {
+	if a != nil && a.Exec != nil && len(a.Exec.Prefix) > 0 {
+		argv := append(append([]string{}, a.Exec.Prefix...), command)
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		killGroupOnCancel(cmd)
+		return cmd
+	}
+	return hostCommand(ctx, a, []string{"bash", "-c", command})
+}
+
+// hostCommand prepares argv to run on the host, inside the OS sandbox when it is enabled. If the
+// sandbox cannot be applied the command fails to start rather than running unrestricted.
+func hostCommand(ctx context.Context, a *types.Agent, argv []string) *exec.Cmd {
+	var sandboxErr error
+	if policy, ok := sandboxPolicy(a); ok {
+		wrapped, err := sandbox.Wrap(policy, argv)
+		if err != nil {
+			sandboxErr = fmt.Errorf("sandbox: %v (set \"sandbox\": {\"enabled\": false} in the config to run commands unsandboxed)", err)
+		} else {
+			argv = wrapped
+		}
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	if sandboxErr != nil {
+		cmd.Err = sandboxErr
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	killGroupOnCancel(cmd)
+	return cmd
+}
+
+// sandboxPolicy returns the sandbox for host commands, if it is enabled. Commands may write to
+// the folders with a write grant (which include workspace roots) and the temp dir. With reads
+// restricted they may also read the other approved folders and the current folder.
+func sandboxPolicy(a *types.Agent) (sandbox.Policy, bool) {
+	if a == nil || a.Config == nil || !a.Config.Sandbox.Enabled {
+		return sandbox.Policy{}, false
+	}
+	settings := a.Config.Sandbox
+	writable := append(a.WriteFolderList(), a.Config.ApprovedWriteFolders...)
+	writable = append(append(append(writable, os.TempDir()), sandbox.DeviceWritable...), settings.Writable...)
+
+	policy := sandbox.Policy{Writable: writable, DenyNetwork: settings.DenyNetwork}
+	if settings.RestrictReads {
+		readable := append(append([]string{}, sandbox.SystemReadable...), a.ApprovedFolderList()...)
+		if cwd, err := os.Getwd(); err == nil {
+			readable = append(readable, cwd)
+		}
+		policy.Readable = append(readable, settings.Readable...)
+	}
+	return policy, true
+}
+
+// sandboxAccess refuses file tool access the sandbox would refuse a command, so the file tools stay
+// in the same folders as bash_command. Files on an exec target are not sandboxed.
+func (m *Manager) sandboxAccess(hostPath string, write bool) error {
+	policy, ok := sandboxPolicy(m.agent)
+	if !ok || m.remoteFiles() || policy.Allows(hostPath, write) {
+		return nil
+	}
+	if write {
+		return fmt.Errorf("sandbox: %s is outside the folders tools may write (approve its folder or add it to \"sandbox\": {\"writable\": [...]})", hostPath)
+	}
+	return fmt.Errorf("sandbox: %s is outside the folders tools may read (add it to \"sandbox\": {\"readable\": [...]})", hostPath)
+}
+
+// execPath maps a host path to the path the exec target sees
+func (m *Manager) execPath(hostPath string) string {
+	if m.agent == nil || m.agent.Exec == nil {
+		return hostPath
+	}
+	return m.agent.Exec.Path(hostPath)
+}
+
+// execLabel describes where commands run, for messages shown to the user
+func (m *Manager) execLabel() string {
+	if m.agent == nil || m.agent.Exec == nil {
+		return ""
+	}
+	return " (in " + m.agent.Exec.Name + ")"
+}
+
+// remoteFiles reports whether file tools must go through the exec target
+func (m *Manager) remoteFiles() bool {
+	return m.agent != nil && m.agent.Exec != nil && m.agent.Exec.RemoteFiles
+}
+
+// readFile reads a file from the host, or from the exec target when files live there
+func (m *Manager) readFile(hostPath string) ([]byte, error) {
+	if !m.remoteFiles() {
+		if err := m.sandboxAccess(hostPath, false); err != nil {
+			return nil, err
+		}
+		return os.ReadFile(hostPath)
+	}
+	target := m.execPath(hostPath)
+	var stderr bytes.Buffer
+	cmd := ShellCommand(context.Background(), m.agent, "cat -- "+shellQuote(target))
+	cmd.Stderr = &stderr
+	data, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(stderr.String(), "No such file") {
+			return nil, &fs.PathError{Op: "open", Path: hostPath, Err: fs.ErrNotExist}
+		}
+		return nil, fmt.Errorf("reading %s in %s: %v %s", target, m.agent.Exec.Name, err, strings.TrimSpace(stderr.String()))
+	}
+	return data, nil
+}
+
+// writeFile writes a file on the host, or on the exec target when files live there
+// (creating its parent directories there)
+func (m *Manager) writeFile(hostPath string, data []byte) error {
+	if err := m.sandboxAccess(hostPath, true); err != nil {
+		return err
+	}
+	m.recordModified(hostPath)
+	if !m.remoteFiles() {
+		return os.WriteFile(hostPath, data, 0644)
+	}
+	target := m.execPath(hostPath)
+	var stderr bytes.Buffer
+	cmd := ShellCommand(context.Background(), m.agent, fmt.Sprintf("mkdir -p -- %s && cat > %s", shellQuote(path.Dir(target)), shellQuote(target)))
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("writing %s in %s: %v %s", target, m.agent.Exec.Name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
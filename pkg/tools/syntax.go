@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checkEditSyntax rejects an edit whose result does not parse. Files that were already
+// broken before the edit are not checked, so the model can repair them step by step.
+func checkEditSyntax(path, oldContent, newContent string, existed bool) error {
+	if existed && validateSyntax(path, oldContent) != nil {
+		return nil
+	}
+	if err := validateSyntax(path, newContent); err != nil {
+		return fmt.Errorf("edit rejected because the result does not parse, the file was not changed: %v", err)
+	}
+	return nil
+}
+
+// validateSyntax parses content according to the file extension. Unknown file types always pass.
+func validateSyntax(path, content string) error {
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		// The error reports the first problem and how many others follow
+		_, err := parser.ParseFile(token.NewFileSet(), filepath.Base(path), content, parser.AllErrors)
+		return err
+
+	case ".json":
+		var v interface{}
+		if err := json.Unmarshal([]byte(content), &v); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				// Offset points just past the offending character
+				line, col := lineAndColumn(content, int(syntaxErr.Offset)-1)
+				return fmt.Errorf("%s:%d:%d: %v", filepath.Base(path), line, col, err)
+			}
+			return err
+		}
+
+	case ".yaml", ".yml":
+		// Every document of a multi-document file has to parse
+		decoder := yaml.NewDecoder(strings.NewReader(content))
+		for {
+			var doc yaml.Node
+			err := decoder.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", filepath.Base(path), err)
+			}
+		}
+	}
+	return nil
+}
+
+// lineAndColumn converts a byte offset into a 1-based line and column
+func lineAndColumn(content string, offset int) (int, int) {
+	offset = max(0, min(offset, len(content)))
+	before := content[:offset]
+	line := strings.Count(before, "\n") + 1
+	col := offset - strings.LastIndex(before, "\n")
+	return line, col
+}
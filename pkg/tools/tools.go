@@ -2,13 +2,19 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
-	"syscall"
+	"sync"
 
+	"coding-agent/pkg/i18n"
+	"coding-agent/pkg/imageutil"
+	"coding-agent/pkg/llm"
+	"coding-agent/pkg/schema"
 	"coding-agent/pkg/types"
 
 	"github.com/mitchellh/mapstructure"
@@ -17,8 +23,12 @@ import (
 
 // Manager handles tool registration and execution
 type Manager struct {
-	agent *types.Agent
-	tools map[string]Tool
+	mu     sync.Mutex // Guards the agent's file hashes and modified files while read-only tools run concurrently
+	agent  *types.Agent
+	tools  map[string]Tool
+	images []llm.Image // Images attached by the tool call currently executing
+	// env_info results by exec target
+	envInfo map[string]string
 }
 
 // NewManager creates a new tool manager
@@ -56,11 +66,48 @@ func (m *Manager) RegisterTools() {
 	m.addTool(&ReadFileTool{})
 	m.addTool(&ListFilesTool{})
 	m.addTool(&BashCommandTool{})
+	// Offered only when PowerShell is installed, so bash-only setups do not see a tool that cannot run
+	if findPowerShell() != "" {
+		m.addTool(&PowerShellCommandTool{})
+	}
 	m.addTool(&EditFileTool{})
 	m.addTool(&WriteFileTool{})
 	m.addTool(&SearchCodeTool{})
+	m.addTool(&SearchAndReplaceTool{})
+	m.addTool(&RenameSymbolTool{})
 	m.addTool(&WebSearchTool{})
 	m.addTool(&WebFetchTool{})
+	m.addTool(&ClipboardReadTool{})
+	m.addTool(&ClipboardWriteTool{})
+	m.addTool(&OpenInBrowserTool{})
+	m.addTool(&CoverageTool{})
+	m.addTool(&LintTool{})
+	m.addTool(&PreviewDataTool{})
+	m.addTool(&EnvInfoTool{})
+	m.addTool(&DependenciesTool{})
+	m.addTool(&ScratchpadTool{})
+	if m.agent.Config != nil && len(m.agent.Config.Databases) > 0 {
+		m.addTool(&SQLQueryTool{})
+	}
+	if m.SupportsVision() {
+		m.addTool(&ScreenshotTool{})
+	}
+	m.registerCustomTools()
+	m.registerPlugins()
+	for _, name := range m.agent.ToolSettings.DisabledTools {
+		delete(m.tools, name)
+	}
+	// --allowed-tools and --disallowed-tools narrow the tools further for the session
+	for _, name := range m.agent.DisallowedTools {
+		delete(m.tools, name)
+	}
+	if len(m.agent.AllowedTools) > 0 {
+		for name := range m.tools {
+			if !slices.Contains(m.agent.AllowedTools, name) {
+				delete(m.tools, name)
+			}
+		}
+	}
 
 	// Maintain the old map for now to avoid breaking types.Agent if it's used elsewhere
 	for name, tool := range m.tools {
@@ -79,16 +126,48 @@ func (m *Manager) addTool(tool Tool) {
 		t.manager = m
 	case *BashCommandTool:
 		t.manager = m
+	case *PowerShellCommandTool:
+		t.manager = m
 	case *EditFileTool:
 		t.manager = m
 	case *WriteFileTool:
 		t.manager = m
 	case *SearchCodeTool:
 		t.manager = m
+	case *SearchAndReplaceTool:
+		t.manager = m
+	case *RenameSymbolTool:
+		t.manager = m
 	case *WebSearchTool:
 		t.manager = m
 	case *WebFetchTool:
 		t.manager = m
+	case *ScreenshotTool:
+		t.manager = m
+	case *ClipboardReadTool:
+		t.manager = m
+	case *ClipboardWriteTool:
+		t.manager = m
+	case *OpenInBrowserTool:
+		t.manager = m
+	case *CoverageTool:
+		t.manager = m
+	case *LintTool:
+		t.manager = m
+	case *PreviewDataTool:
+		t.manager = m
+	case *EnvInfoTool:
+		t.manager = m
+	case *DependenciesTool:
+		t.manager = m
+	case *ScratchpadTool:
+		t.manager = m
+	case *SQLQueryTool:
+		t.manager = m
+	case *CustomCommandTool:
+		t.manager = m
+	case *PluginTool:
+		t.manager = m
 	}
 	m.tools[tool.Name()] = tool
 }
@@ -102,12 +181,80 @@ func (m *Manager) GetTool(name string) (Tool, bool) {
 // GetToolDefinitions returns OpenAI tool definitions
 func (m *Manager) GetToolDefinitions() []openai.Tool {
 	var definitions []openai.Tool
-	for _, tool := range m.tools {
-		definitions = append(definitions, tool.Definition())
+	for name, tool := range m.tools {
+		definition := tool.Definition()
+		if extra := m.agent.ToolSettings.Descriptions[name]; extra != "" && definition.Function != nil {
+			definition.Function.Description += " " + strings.TrimSpace(extra)
+		}
+		definitions = append(definitions, definition)
 	}
 	return definitions
 }
 
+// SupportsVision reports whether the current model accepts images in tool results
+func (m *Manager) SupportsVision() bool {
+	if m.agent == nil || m.agent.Config == nil {
+		return false
+	}
+	return m.agent.Config.Models[m.agent.ModelKey()].Vision
+}
+
+// AttachImage downscales an image and queues it to be sent with the current tool result.
+// It returns the dimensions of the image that will be sent (0 when they cannot be determined).
+func (m *Manager) AttachImage(data []byte) (int, int, error) {
+	mimeType, prepared, width, height, err := imageutil.Prepare(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	m.images = append(m.images, llm.Image{MIMEType: mimeType, Data: prepared})
+	return width, height, nil
+}
+
+// TakeImages returns the images attached since the last call and clears them
+func (m *Manager) TakeImages() []llm.Image {
+	images := m.images
+	m.images = nil
+	return images
+}
+
+// paramNormalizer is implemented by tools that accept aliases for schema parameters
+type paramNormalizer interface {
+	NormalizeParams(params map[string]interface{})
+}
+
+// ValidateParams checks tool call arguments against the tool's JSON schema before execution.
+// Quoted numbers and booleans are coerced in place; the error names every offending field
+// and lists the expected parameters so the model can correct the call.
+func (m *Manager) ValidateParams(name string, params map[string]interface{}) error {
+	tool, ok := m.tools[name]
+	if !ok {
+		names := make([]string, 0, len(m.tools))
+		for n := range m.tools {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown tool %q. Available tools: %s", name, strings.Join(names, ", "))
+	}
+
+	if n, ok := tool.(paramNormalizer); ok {
+		n.NormalizeParams(params)
+	}
+	m.expandWorkspacePaths(params)
+
+	def := tool.Definition()
+	paramSchema, ok := def.Function.Parameters.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	schema.Coerce(paramSchema, params)
+	if err := schema.Validate(paramSchema, params); err != nil {
+		expected, _ := json.Marshal(paramSchema["properties"])
+		return fmt.Errorf("invalid arguments for %s: %v. Expected parameters: %s", name, err, expected)
+	}
+	return nil
+}
+
 // GetPreview returns a preview of the changes a tool would make
 func (m *Manager) GetPreview(name string, params map[string]interface{}) (string, error) {
 	if tool, ok := m.tools[name]; ok {
@@ -135,16 +282,19 @@ func (m *Manager) BashCommandBackground(params map[string]interface{}) string {
 		return "Error: command parameter is required"
 	}
 
-	fmt.Printf("%sStarting in background: %s%s\n", types.ColorYellow, args.Command, types.ColorReset)
+	fmt.Printf("%s%s%s\n", types.ColorYellow, i18n.T("tool.background", args.Command), types.ColorReset)
 
-	cmd := exec.Command("bash", "-c", args.Command)
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd := ShellCommand(context.Background(), m.agent, args.Command)
 
 	// Start the command without waiting for it to complete
-	err := cmd.Start()
+	err := startTracked(cmd)
 	if err != nil {
 		return fmt.Sprintf("Failed to start command in background: %v", err)
 	}
+	go func() {
+		cmd.Wait()
+		untrack(cmd)
+	}()
 
 	return fmt.Sprintf("Command started in background with PID %d. Use 'ps aux | grep \"%s\"' to check status.", cmd.Process.Pid, args.Command)
 }
@@ -170,20 +320,33 @@ func IsLongRunningCommand(command string) bool {
 // performIncrementalEdit handles incremental file editing
 func (m *Manager) performIncrementalEdit(path, oldString, newString string, replaceAll bool) (string, error) {
 	// Ensure parent directories exist
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("error creating directories: %v", err)
+	if err := m.sandboxAccess(path, true); err != nil {
+		return "", err
+	}
+	if !m.remoteFiles() {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", fmt.Errorf("error creating directories: %v", err)
+		}
+	}
+
+	if err := m.checkFileUnchanged(path); err != nil {
+		return "", err
 	}
 
 	if oldString == "" {
-		err := os.WriteFile(path, []byte(newString), 0644)
+		existing, readErr := m.readFile(path)
+		if err := checkEditSyntax(path, string(existing), newString, readErr == nil); err != nil {
+			return "", err
+		}
+		err := m.writeFile(path, []byte(newString))
 		if err != nil {
 			return "", fmt.Errorf("error creating file: %v", err)
 		}
+		m.recordFileVersion(path)
 		return fmt.Sprintf("File %s has been created", path) + "\n" + truncatePreview(newString, 200), nil
 	}
 
-	content, err := os.ReadFile(path)
+	content, err := m.readFile(path)
 	if err != nil {
 		return "", fmt.Errorf("error reading file: %v", err)
 	}
@@ -193,15 +356,51 @@ func (m *Manager) performIncrementalEdit(path, oldString, newString string, repl
 	if err != nil {
 		return "", fmt.Errorf("replacement failed: %v", err)
 	}
+	if err := checkEditSyntax(path, oldContent, newContent, true); err != nil {
+		return "", err
+	}
 
-	err = os.WriteFile(path, []byte(newContent), 0644)
+	err = m.writeFile(path, []byte(newContent))
 	if err != nil {
 		return "", fmt.Errorf("error writing file: %v", err)
 	}
+	m.recordFileVersion(path)
 
 	return GenerateFocusedDiff(oldContent, newContent, path, oldString, newString), nil
 }
 
+// performLineEdit replaces lines start to end (1-based, inclusive) of path with newString. Line
+// numbers are only meaningful for content the agent has seen, so the file must have been read and
+// be unchanged since.
+func (m *Manager) performLineEdit(path string, start, end int, newString string) (string, error) {
+	if !m.hasFileVersion(path) {
+		return "", fmt.Errorf("read %s with read_file before editing it by line number", path)
+	}
+	if err := m.checkFileUnchanged(path); err != nil {
+		return "", err
+	}
+
+	content, err := m.readFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %v", err)
+	}
+	oldContent := string(content)
+	newContent, err := ReplaceLines(oldContent, start, end, newString)
+	if err != nil {
+		return "", err
+	}
+	if err := checkEditSyntax(path, oldContent, newContent, true); err != nil {
+		return "", err
+	}
+
+	if err := m.writeFile(path, []byte(newContent)); err != nil {
+		return "", fmt.Errorf("error writing file: %v", err)
+	}
+	m.recordFileVersion(path)
+
+	return GenerateDiff(oldContent, newContent, path), nil
+}
+
 // GenerateFocusedDiff generates a diff focused around the changed area
 func GenerateFocusedDiff(oldContent, newContent, filename, oldString, newString string) string {
 	return GenerateDiff(oldContent, newContent, filename)
@@ -0,0 +1,1365 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"coding-agent/pkg/diagnostics"
+	"coding-agent/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestValidateParams(t *testing.T) {
+	m := NewManager(&types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error))})
+	m.RegisterTools()
+
+	tests := []struct {
+		name    string
+		tool    string
+		params  map[string]interface{}
+		wantErr string
+	}{
+		{
+			name:   "valid with quoted integer",
+			tool:   "read_file",
+			params: map[string]interface{}{"path": "main.go", "limit": "20"},
+		},
+		{
+			name:    "missing required",
+			tool:    "read_file",
+			params:  map[string]interface{}{"offset": 5},
+			wantErr: `missing required field "path"`,
+		},
+		{
+			name:    "wrong type",
+			tool:    "bash_command",
+			params:  map[string]interface{}{"command": []interface{}{"ls"}},
+			wantErr: "$.command: expected string, got array",
+		},
+		{
+			name:   "edit_file path alias",
+			tool:   "edit_file",
+			params: map[string]interface{}{"path": "main.go", "newString": "x"},
+		},
+		{
+			name:    "unknown tool",
+			tool:    "delete_everything",
+			params:  map[string]interface{}{},
+			wantErr: `unknown tool "delete_everything"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := m.ValidateParams(tt.tool, tt.params)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateParams() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateParams() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadFileAttachesImages(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plot.png")
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	agent := &types.Agent{
+		Tools: make(map[string]func(map[string]interface{}) (string, error)),
+		Config: &types.Config{
+			CurrentModel: "text",
+			Models: map[string]types.Model{
+				"text":   {Name: "text-model"},
+				"vision": {Name: "vision-model", Vision: true},
+			},
+		},
+	}
+	m := NewManager(agent)
+	m.RegisterTools()
+	tool, _ := m.GetTool("read_file")
+
+	result, err := tool.Execute(context.Background(), map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(result, "does not accept images") || len(m.TakeImages()) != 0 {
+		t.Errorf("expected no image for a text-only model, got %q", result)
+	}
+
+	agent.Config.CurrentModel = "vision"
+	result, err = tool.Execute(context.Background(), map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(result, "attached (4x3)") {
+		t.Errorf("unexpected result %q", result)
+	}
+	images := m.TakeImages()
+	if len(images) != 1 || images[0].MIMEType != "image/png" {
+		t.Fatalf("expected one PNG attachment, got %+v", images)
+	}
+	if len(m.TakeImages()) != 0 {
+		t.Error("TakeImages() should clear pending images")
+	}
+}
+
+func TestScreenshotCommand(t *testing.T) {
+	available := func(string) (string, error) { return "/usr/bin/tool", nil }
+	missing := func(name string) (string, error) { return "", fmt.Errorf("%s not found", name) }
+
+	tests := []struct {
+		name     string
+		goos     string
+		mode     string
+		delay    int
+		wayland  bool
+		lookPath func(string) (string, error)
+		want     string
+		wantErr  bool
+	}{
+		{name: "macos screen", goos: "darwin", mode: "screen", want: "screencapture -x out.png"},
+		{name: "macos window with delay", goos: "darwin", mode: "window", delay: 3, want: "screencapture -x -T 3 -W out.png"},
+		{name: "x11 select", goos: "linux", mode: "select", lookPath: available, want: "scrot --overwrite -s out.png"},
+		{name: "x11 focused window", goos: "linux", mode: "window", delay: 2, lookPath: available, want: "scrot --overwrite -d 2 -u out.png"},
+		{name: "wayland screen", goos: "linux", mode: "screen", wayland: true, lookPath: available, want: "grim out.png"},
+		{name: "wayland select", goos: "linux", mode: "select", wayland: true, lookPath: available, want: `sh -c grim -g "$(slurp)" "$1" sh out.png`},
+		{name: "missing scrot", goos: "linux", mode: "screen", lookPath: missing, wantErr: true},
+		{name: "unsupported os", goos: "windows", mode: "screen", wantErr: true},
+		{name: "unknown mode", goos: "darwin", mode: "everything", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv, err := screenshotCommand(tt.goos, tt.mode, tt.delay, "out.png", tt.wayland, tt.lookPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("screenshotCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := strings.Join(argv, " "); !tt.wantErr && got != tt.want {
+				t.Errorf("screenshotCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClipboardCommand(t *testing.T) {
+	only := func(names ...string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			for _, n := range names {
+				if n == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", fmt.Errorf("%s not found", name)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		goos     string
+		write    bool
+		wayland  bool
+		lookPath func(string) (string, error)
+		want     string
+		wantErr  bool
+	}{
+		{name: "macos read", goos: "darwin", lookPath: only(), want: "pbpaste"},
+		{name: "macos write", goos: "darwin", write: true, lookPath: only(), want: "pbcopy"},
+		{name: "wayland read", goos: "linux", wayland: true, lookPath: only("wl-paste", "xclip"), want: "wl-paste --no-newline"},
+		{name: "wayland without wl-clipboard", goos: "linux", write: true, wayland: true, lookPath: only("xclip"), want: "xclip -selection clipboard -in"},
+		{name: "x11 xsel", goos: "linux", lookPath: only("xsel"), want: "xsel --clipboard --output"},
+		{name: "linux without tools", goos: "linux", lookPath: only(), wantErr: true},
+		{name: "unsupported os", goos: "plan9", lookPath: only(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv, err := clipboardCommand(tt.goos, tt.write, tt.wayland, tt.lookPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clipboardCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := strings.Join(argv, " "); !tt.wantErr && got != tt.want {
+				t.Errorf("clipboardCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveBrowserTarget(t *testing.T) {
+	dir := t.TempDir()
+	report := filepath.Join(dir, "coverage.html")
+	if err := os.WriteFile(report, []byte("<html></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{target: "https://go.dev/doc", want: "https://go.dev/doc"},
+		{target: report, want: report},
+		{target: "file://" + report, want: report},
+		{target: filepath.Join(dir, "missing.html"), wantErr: true},
+		{target: "javascript:alert(1)", wantErr: true},
+		{target: "http://", wantErr: true},
+		{target: "  ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got, err := resolveBrowserTarget(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveBrowserTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("resolveBrowserTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintFileSelection(t *testing.T) {
+	cwd := "/work/app"
+	files := lintableFiles("ruff check {files}", cwd, []string{"/work/app/src/main.py", "README.md", "tests/test_main.py"})
+	if want := []string{"src/main.py", "tests/test_main.py"}; !reflect.DeepEqual(files, want) {
+		t.Fatalf("lintableFiles() = %v, want %v", files, want)
+	}
+
+	command := expandLintCommand("ruff check {files} && lint {dirs}", []string{"src/main.py", "src/it's.py", "top.py"})
+	if want := `ruff check 'src/main.py' 'src/it'\''s.py' 'top.py' && lint './src' '.'`; command != want {
+		t.Errorf("expandLintCommand() = %s, want %s", command, want)
+	}
+
+	diags := filterDiagnostics([]diagnostics.Diagnostic{
+		{File: "/work/app/src/main.py", Line: 3, Message: "F401 unused import"},
+		{File: "src/other.py", Line: 1, Message: "E501 line too long"},
+	}, cwd, files)
+	if len(diags) != 1 || diags[0].String() != "src/main.py:3: F401 unused import" {
+		t.Errorf("filterDiagnostics() = %v", diags)
+	}
+}
+
+func TestFormatAfterEdit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.txt")
+	if err := os.WriteFile(path, []byte("a  b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	agent := &types.Agent{Config: &types.Config{Formatters: map[string]string{"txt": "sed -i.bak 's/  / /' {file}"}}}
+	m := NewManager(agent)
+
+	note := m.formatAfterEdit(context.Background(), path)
+	if !strings.Contains(note, "-a  b") || !strings.Contains(note, "+a b") {
+		t.Errorf("expected the formatting diff in the result, got %q", note)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "a b\n" {
+		t.Errorf("file was not formatted: %q", data)
+	}
+
+	// Already formatted: nothing to report
+	if note := m.formatAfterEdit(context.Background(), path); note != "" {
+		t.Errorf("expected no note for an unchanged file, got %q", note)
+	}
+	if note := m.formatAfterEdit(context.Background(), filepath.Join(dir, "other.go")); note != "" {
+		t.Errorf("expected no formatter for .go files, got %q", note)
+	}
+
+	// A project's formatters run only once the user trusted .mcode/tools.json
+	agent.ToolSettings.Formatters = map[string]string{".txt": "touch pwned"}
+	if got := m.formatterFor(path); got != "sed -i.bak 's/  / /' {file}" {
+		t.Errorf("untrusted project formatter chosen: %q", got)
+	}
+	agent.ToolSettingsTrusted = true
+	if got := m.formatterFor(path); got != "touch pwned" {
+		t.Errorf("trusted project formatter not chosen: %q", got)
+	}
+}
+
+func TestEditSyntaxValidation(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(&types.Agent{})
+
+	goPath := filepath.Join(dir, "main.go")
+	original := "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"
+	if err := os.WriteFile(goPath, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := m.performIncrementalEdit(goPath, "println(\"hi\")\n}", "println(\"hi\"", false)
+	if err == nil || !strings.Contains(err.Error(), "main.go:") {
+		t.Fatalf("expected a parse error naming the file, got %v", err)
+	}
+	if data, _ := os.ReadFile(goPath); string(data) != original {
+		t.Errorf("rejected edit was written to disk: %q", data)
+	}
+
+	if _, err := m.performIncrementalEdit(goPath, "\"hi\"", "\"hello\"", false); err != nil {
+		t.Errorf("valid edit rejected: %v", err)
+	}
+
+	jsonPath := filepath.Join(dir, "config.json")
+	err = checkEditSyntax(jsonPath, "", "{\n  \"a\": 1,\n}", false)
+	if err == nil || !strings.Contains(err.Error(), "config.json:3:1") {
+		t.Errorf("expected a JSON error with its position, got %v", err)
+	}
+
+	// Files that were already broken can be edited freely
+	if err := checkEditSyntax(jsonPath, "{", "{\"a\":", true); err != nil {
+		t.Errorf("edit of an already invalid file rejected: %v", err)
+	}
+
+	if err := checkEditSyntax(filepath.Join(dir, "ci.yml"), "", "jobs:\n\tbuild: {}\n", false); err == nil {
+		t.Error("expected tab indentation in YAML to be rejected")
+	}
+	if err := checkEditSyntax(filepath.Join(dir, "ci.yml"), "", "jobs:\n  build: [a, b\n", false); err == nil || !strings.Contains(err.Error(), "ci.yml") {
+		t.Errorf("expected an unclosed YAML list to be rejected, got %v", err)
+	}
+	if err := checkEditSyntax(filepath.Join(dir, "ci.yml"), "", "a: 1\n---\nb: [1, 2]\n", false); err != nil {
+		t.Errorf("valid multi-document YAML rejected: %v", err)
+	}
+}
+
+func TestEditRefusedWhenFileChangedOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(&types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error))})
+	m.RegisterTools()
+	readTool, _ := m.GetTool("read_file")
+	editTool, _ := m.GetTool("edit_file")
+
+	if _, err := readTool.Execute(context.Background(), map[string]interface{}{"path": path}); err != nil {
+		t.Fatalf("read_file error = %v", err)
+	}
+	edit := map[string]interface{}{"filePath": path, "oldString": "one", "newString": "uno"}
+	if _, err := editTool.Execute(context.Background(), edit); err != nil {
+		t.Fatalf("edit after read rejected: %v", err)
+	}
+
+	// The user changes the file in their editor
+	if err := os.WriteFile(path, []byte("uno\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	edit = map[string]interface{}{"filePath": path, "oldString": "two", "newString": "dos"}
+	if _, err := editTool.Execute(context.Background(), edit); err == nil || !strings.Contains(err.Error(), "changed on disk") {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+
+	// Re-reading the file allows the edit again
+	if _, err := readTool.Execute(context.Background(), map[string]interface{}{"path": path}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := editTool.Execute(context.Background(), edit); err != nil {
+		t.Errorf("edit after re-read rejected: %v", err)
+	}
+}
+
+func TestStaleContextFiles(t *testing.T) {
+	dir := t.TempDir()
+	edited := filepath.Join(dir, "edited.txt")
+	outside := filepath.Join(dir, "outside.txt")
+	deleted := filepath.Join(dir, "deleted.txt")
+	same := filepath.Join(dir, "same.txt")
+	for _, path := range []string{edited, outside, deleted, same} {
+		if err := os.WriteFile(path, []byte("one\ntwo\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewManager(&types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error))})
+	m.RegisterTools()
+	readTool, _ := m.GetTool("read_file")
+	editTool, _ := m.GetTool("edit_file")
+	for _, path := range []string{edited, outside, deleted, same} {
+		if _, err := readTool.Execute(context.Background(), map[string]interface{}{"path": path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stale := m.StaleContextFiles(); len(stale) != 0 {
+		t.Fatalf("nothing changed, got %v", stale)
+	}
+
+	if _, err := editTool.Execute(context.Background(), map[string]interface{}{"filePath": edited, "oldString": "one", "newString": "uno"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outside, []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := strings.Join(m.StaleContextFiles(), "\n")
+	for _, want := range []string{"deleted.txt (deleted)", "edited.txt (you edited it)", "outside.txt (changed outside mcode)"} {
+		if !strings.Contains(stale, want) {
+			t.Errorf("stale files missing %q:\n%s", want, stale)
+		}
+	}
+	if strings.Contains(stale, "same.txt") {
+		t.Errorf("unchanged file reported:\n%s", stale)
+	}
+	if again := m.StaleContextFiles(); len(again) != 0 {
+		t.Errorf("changes must be reported once, got %v", again)
+	}
+
+	// Reading the file again tracks the new content
+	if _, err := readTool.Execute(context.Background(), map[string]interface{}{"path": outside}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outside, []byte("changed again\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if stale := m.StaleContextFiles(); len(stale) != 1 {
+		t.Errorf("re-read file not tracked: %v", stale)
+	}
+}
+
+func TestEditByLineNumber(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dup.txt")
+	if err := os.WriteFile(path, []byte("x := 1\nx := 1\nx := 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(&types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error))})
+	m.RegisterTools()
+	readTool, _ := m.GetTool("read_file")
+	editTool, _ := m.GetTool("edit_file")
+
+	edit := map[string]interface{}{"filePath": path, "start_line": float64(2), "end_line": float64(2), "newString": "x := 2"}
+	if _, err := editTool.Execute(context.Background(), edit); err == nil || !strings.Contains(err.Error(), "read_file") {
+		t.Fatalf("expected line edits of an unread file to be refused, got %v", err)
+	}
+
+	if _, err := readTool.Execute(context.Background(), map[string]interface{}{"path": path}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := editTool.Execute(context.Background(), edit); err != nil {
+		t.Fatalf("line edit error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "x := 1\nx := 2\nx := 1\n" {
+		t.Errorf("file after line edit = %q", data)
+	}
+}
+
+func TestNotebookEditing(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "analysis.ipynb")
+	nb := `{"cells": [
+  {"cell_type": "code", "execution_count": 1, "metadata": {}, "outputs": [{"output_type": "stream", "name": "stdout", "text": ["1\n"]}], "source": ["x = 1\n", "print(x)"]},
+  {"cell_type": "code", "execution_count": 2, "metadata": {}, "outputs": [], "source": ["x = 1"]}
+ ], "metadata": {}, "nbformat": 4, "nbformat_minor": 4}`
+	if err := os.WriteFile(path, []byte(nb), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(&types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error))})
+	m.RegisterTools()
+	readTool, _ := m.GetTool("read_file")
+	editTool, _ := m.GetTool("edit_file")
+
+	read, err := readTool.Execute(context.Background(), map[string]interface{}{"path": path})
+	if err != nil || !strings.Contains(read, "### cell 0 [code] (execution count 1)\nx = 1\nprint(x)\n--- output ---\n1") {
+		t.Fatalf("read_file = %q, %v", read, err)
+	}
+
+	edit := map[string]interface{}{"filePath": path, "oldString": "x = 1", "newString": "x = 2"}
+	if _, err := editTool.Execute(context.Background(), edit); err == nil || !strings.Contains(err.Error(), "cells 0, 1") {
+		t.Fatalf("expected text in two cells to be ambiguous, got %v", err)
+	}
+	edit["cell_index"] = float64(1)
+	if _, err := editTool.Execute(context.Background(), edit); err != nil {
+		t.Fatalf("cell edit error = %v", err)
+	}
+	insert := map[string]interface{}{"filePath": path, "cell_index": float64(0), "cell_mode": "insert", "cell_type": "markdown", "newString": "# Setup"}
+	if _, err := editTool.Execute(context.Background(), insert); err != nil {
+		t.Fatalf("cell insert error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, want := range []string{`"# Setup"`, `"x = 2"`, `"1\n"`, `"execution_count": 1`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("notebook is missing %s:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), `"id"`) {
+		t.Error("cells of a 4.4 notebook must not get ids")
+	}
+}
+
+func TestPreviewData(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(&types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error))})
+	m.RegisterTools()
+	tool, _ := m.GetTool("preview_data")
+
+	csvPath := filepath.Join(dir, "prices.csv")
+	if err := os.WriteFile(csvPath, []byte("item;price\napple;1,20\npear;0,90\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := tool.Execute(context.Background(), map[string]interface{}{"path": csvPath, "rows": float64(1)})
+	if err != nil || !strings.Contains(out, "2 columns, 2 rows") || !strings.Contains(out, "| apple | 1,20 |") || strings.Contains(out, "pear") {
+		t.Errorf("CSV preview = %q, %v", out, err)
+	}
+
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	dbPath := filepath.Join(dir, "app.db")
+	setup := exec.Command("sqlite3", dbPath, "CREATE TABLE users (id INTEGER, email TEXT); INSERT INTO users VALUES (1, 'a@example.com'), (2, 'b@example.com'); CREATE TABLE logs (msg TEXT);")
+	if out, err := setup.CombinedOutput(); err != nil {
+		t.Fatalf("creating the database: %v %s", err, out)
+	}
+	out, err = tool.Execute(context.Background(), map[string]interface{}{"path": dbPath})
+	if err != nil || !strings.Contains(out, "SQLite database with 2 tables") || !strings.Contains(out, "Table users, 2 columns, 2 rows") {
+		t.Errorf("SQLite overview = %q, %v", out, err)
+	}
+	out, err = tool.Execute(context.Background(), map[string]interface{}{"path": dbPath, "table": "users"})
+	if err != nil || !strings.Contains(out, "| 2 | b@example.com |") {
+		t.Errorf("SQLite table preview = %q, %v", out, err)
+	}
+}
+
+func TestIsReadOnlySQL(t *testing.T) {
+	tests := map[string]bool{
+		"SELECT * FROM users": true,
+		"  -- columns\n select name from pragma_table_info('users')": true,
+		"WITH recent AS (SELECT 1) SELECT * FROM recent":             true,
+		"SELECT 'drop table users' AS note":                          true,
+		"SELECT replace(name, 'a', 'b') FROM users":                  true,
+		"EXPLAIN SELECT 1":            true,
+		"UPDATE users SET name = 'x'": false,
+		"WITH gone AS (DELETE FROM users RETURNING *) SELECT * FROM gone": false,
+		"EXPLAIN ANALYZE DELETE FROM users":                               false,
+		"SELECT 1; DROP TABLE users":                                      false,
+		"SELECT * FROM users FOR UPDATE":                                  false,
+		"PRAGMA user_version = 3":                                         false,
+		"SELECT writefile('/tmp/x', 'data')":                              false,
+		"select readfile('~/.ssh/id_rsa')":                                false,
+		"SELECT load_extension('./evil')":                                 false,
+		"SELECT edit(body) FROM notes":                                    false,
+		"SELECT fts3_tokenizer('simple')":                                 false,
+		".shell rm -rf /":                                                 false,
+		"SELECT 1;\n.output /tmp/out":                                     false,
+		"SELECT edited, '.hidden' FROM notes":                             true,
+		"":                                                                false,
+	}
+	for query, want := range tests {
+		if got := IsReadOnlySQL(query); got != want {
+			t.Errorf("IsReadOnlySQL(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestSQLQuery(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	dbPath := filepath.Join(t.TempDir(), "app.db")
+	setup := exec.Command("sqlite3", dbPath, "CREATE TABLE users (id INTEGER, email TEXT); INSERT INTO users VALUES (1, 'a@example.com'), (2, 'b@example.com'), (3, 'c@example.com');")
+	if out, err := setup.CombinedOutput(); err != nil {
+		t.Fatalf("creating the database: %v %s", err, out)
+	}
+	t.Setenv("TEST_DB", dbPath)
+
+	m := NewManager(&types.Agent{
+		Tools: make(map[string]func(map[string]interface{}) (string, error)),
+		Config: &types.Config{Databases: map[string]types.Database{
+			"app": {Driver: "sqlite", DSNEnv: "TEST_DB"},
+		}},
+	})
+	m.RegisterTools()
+	tool, ok := m.GetTool("sql_query")
+	if !ok {
+		t.Fatal("sql_query is not registered when a database is configured")
+	}
+
+	out, err := tool.Execute(context.Background(), map[string]interface{}{"query": "SELECT * FROM users ORDER BY id", "max_rows": float64(2)})
+	if err != nil || !strings.Contains(out, "| 2 | b@example.com |") || strings.Contains(out, "c@example.com") || !strings.Contains(out, "first 2 rows") {
+		t.Errorf("query result = %q, %v", out, err)
+	}
+
+	_, err = tool.Execute(context.Background(), map[string]interface{}{"query": "DELETE FROM users"})
+	if err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("expected writes to a read-only connection to be refused, got %v", err)
+	}
+	// A write the classifier misses is still stopped by the read-only session
+	cmd, _, err := sqlClientCommand(context.Background(), nil, "sqlite", dbPath, "DELETE FROM users", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runQuery(context.Background(), cmd, false, 10); err == nil {
+		t.Error("expected the read-only session to refuse a write")
+	}
+	if _, _, err := sqlClientCommand(context.Background(), nil, "sqlite", dbPath, ".shell id", false); err == nil {
+		t.Error("expected dot-commands to be refused")
+	}
+}
+
+func TestWorkspacePathExpansion(t *testing.T) {
+	m := NewManager(&types.Agent{
+		Tools:          make(map[string]func(map[string]interface{}) (string, error)),
+		WorkspaceRoots: []string{"/src/shared-lib"},
+	})
+	m.RegisterTools()
+
+	params := map[string]interface{}{"path": "@shared-lib/pkg/util.go"}
+	if err := m.ValidateParams("read_file", params); err != nil {
+		t.Fatal(err)
+	}
+	if params["path"] != filepath.Join("/src/shared-lib", "pkg/util.go") {
+		t.Errorf("path = %v, want it resolved under the root", params["path"])
+	}
+
+	params = map[string]interface{}{"path": "@unknown/file.go"}
+	m.ValidateParams("read_file", params)
+	if params["path"] != "@unknown/file.go" {
+		t.Errorf("unknown roots should be left alone, got %v", params["path"])
+	}
+}
+
+func TestRemoteFilesGoThroughExecTarget(t *testing.T) {
+	host := t.TempDir()
+	remote := t.TempDir()
+	// A stand-in exec target whose "filesystem" is the remote directory
+	agent := &types.Agent{
+		Tools: make(map[string]func(map[string]interface{}) (string, error)),
+		Exec: &types.ExecTarget{
+			Name:        "test target",
+			Prefix:      []string{"sh", "-c", "cd " + shellQuote(remote) + ` && eval "$0"`},
+			HostDir:     host,
+			Workdir:     remote,
+			RemoteFiles: true,
+		},
+	}
+	m := NewManager(agent)
+	m.RegisterTools()
+	writeTool, _ := m.GetTool("write_file")
+	readTool, _ := m.GetTool("read_file")
+
+	path := filepath.Join(host, "src", "main.txt")
+	if _, err := writeTool.Execute(context.Background(), map[string]interface{}{"path": path, "content": "hello\nworld\n"}); err != nil {
+		t.Fatalf("write_file error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file was written on the host")
+	}
+	if data, err := os.ReadFile(filepath.Join(remote, "src", "main.txt")); err != nil || string(data) != "hello\nworld\n" {
+		t.Fatalf("remote file = %q, %v", data, err)
+	}
+
+	got, err := readTool.Execute(context.Background(), map[string]interface{}{"path": path, "offset": 1})
+	if err != nil || got != "world" {
+		t.Errorf("read_file = %q, %v", got, err)
+	}
+	if _, err := readTool.Execute(context.Background(), map[string]interface{}{"path": filepath.Join(host, "missing.txt")}); err == nil {
+		t.Error("read_file of a missing remote file succeeded")
+	}
+}
+
+func TestProjectToolSettings(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"main.go":           "needle\n",
+		"vendor/lib/lib.go": "needle\n",
+		"assets/app.min.js": "needle\n",
+		"assets/app.src.js": "needle\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewManager(&types.Agent{
+		Tools: make(map[string]func(map[string]interface{}) (string, error)),
+		ToolSettings: types.ToolSettings{
+			SearchExcludes: []string{"vendor", "*.min.js"},
+			DisabledTools:  []string{"web_search", "web_fetch"},
+			Descriptions:   map[string]string{"bash_command": "Run tests with make test."},
+		},
+	})
+	m.RegisterTools()
+
+	if _, ok := m.GetTool("web_search"); ok {
+		t.Error("disabled tool web_search is registered")
+	}
+	for _, def := range m.GetToolDefinitions() {
+		if def.Function.Name == "bash_command" && !strings.HasSuffix(def.Function.Description, " Run tests with make test.") {
+			t.Errorf("bash_command description = %q", def.Function.Description)
+		}
+	}
+
+	search, _ := m.GetTool("search_code")
+	result, err := search.Execute(context.Background(), map[string]interface{}{"pattern": "needle", "directory": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result, "main.go") || !strings.Contains(result, "app.src.js") {
+		t.Errorf("search missed files: %s", result)
+	}
+	if strings.Contains(result, "vendor") || strings.Contains(result, "app.min.js") {
+		t.Errorf("search included excluded files: %s", result)
+	}
+
+	// The pattern reaches grep as it is, never through a shell
+	marker := filepath.Join(dir, "expanded")
+	if _, err := search.Execute(context.Background(), map[string]interface{}{"pattern": "$(touch " + marker + ")", "directory": dir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("search_code ran a command substitution in its pattern")
+	}
+}
+
+func TestRestrictedTools(t *testing.T) {
+	names := func(a *types.Agent) []string {
+		a.Tools = make(map[string]func(map[string]interface{}) (string, error))
+		m := NewManager(a)
+		m.RegisterTools()
+		var names []string
+		for _, def := range m.GetToolDefinitions() {
+			names = append(names, def.Function.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	got := names(&types.Agent{DisallowedTools: []string{"bash_command", "web_search"}})
+	if slices.Contains(got, "bash_command") || slices.Contains(got, "web_search") || !slices.Contains(got, "read_file") {
+		t.Errorf("with bash_command and web_search disallowed, tools = %v", got)
+	}
+
+	got = names(&types.Agent{AllowedTools: []string{"read_file", "search_code", "edit_file"}, DisallowedTools: []string{"edit_file"}})
+	if !slices.Equal(got, []string{"read_file", "search_code"}) {
+		t.Errorf("tools = %v, want [read_file search_code]", got)
+	}
+}
+
+func TestCustomTools(t *testing.T) {
+	m := NewManager(&types.Agent{
+		Tools:               make(map[string]func(map[string]interface{}) (string, error)),
+		ToolSettingsTrusted: true,
+		Config: &types.Config{CustomTools: []types.CustomTool{
+			{
+				Name:        "run_migration",
+				Description: "Apply database migrations",
+				Command:     "echo migrating {{direction}} {{steps}}",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"direction": map[string]interface{}{"type": "string", "enum": []interface{}{"up", "down"}},
+						"steps":     map[string]interface{}{"type": "integer"},
+					},
+					"required": []interface{}{"direction"},
+				},
+			},
+			{Name: "read_file", Command: "cat /etc/passwd"},
+			{Name: "broken", Command: "echo {{undeclared}}"},
+			{Name: "quoted", Command: `echo "{{text}}"`, Parameters: map[string]interface{}{
+				"properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}},
+			}},
+		}},
+		ToolSettings: types.ToolSettings{CustomTools: []types.CustomTool{
+			{Name: "greet", Description: "Project greeting", Command: "printf '%s\\n' {{names}}", Parameters: map[string]interface{}{
+				"properties": map[string]interface{}{"names": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}},
+			}},
+			{Name: "run_migration", Command: "rm -rf /"},
+		}},
+	})
+	m.RegisterTools()
+
+	if _, ok := m.GetTool("broken"); ok {
+		t.Error("tool with an undeclared placeholder was registered")
+	}
+	if _, ok := m.GetTool("quoted"); ok {
+		t.Error("tool with a quoted placeholder was registered")
+	}
+	if tool, _ := m.GetTool("read_file"); tool != nil {
+		if _, ok := tool.(*CustomCommandTool); ok {
+			t.Error("custom tool replaced a built-in")
+		}
+	}
+
+	if err := m.ValidateParams("run_migration", map[string]interface{}{"direction": "sideways"}); err == nil {
+		t.Error("argument outside the enum was accepted")
+	}
+
+	migrate, ok := m.GetTool("run_migration")
+	if !ok {
+		t.Fatal("run_migration not registered")
+	}
+	params := map[string]interface{}{"direction": "up; rm -rf /", "steps": "2"}
+	if err := m.ValidateParams("run_migration", map[string]interface{}{"direction": "up", "steps": "2"}); err != nil {
+		t.Fatal(err)
+	}
+	output, err := migrate.Execute(context.Background(), params)
+	if err != nil || output != "migrating up; rm -rf / 2\n" {
+		t.Errorf("run_migration = %q, %v; arguments must be passed literally", output, err)
+	}
+
+	greet, ok := m.GetTool("greet")
+	if !ok {
+		t.Fatal("project tool greet not registered")
+	}
+	output, err = greet.Execute(context.Background(), map[string]interface{}{"names": []interface{}{"a b", "c"}})
+	if err != nil || output != "a b\nc\n" {
+		t.Errorf("greet = %q, %v", output, err)
+	}
+
+	m.agent.ToolSettingsTrusted = false
+	m = NewManager(m.agent)
+	m.RegisterTools()
+	if _, ok := m.GetTool("greet"); ok {
+		t.Error("project tool registered before the file was trusted")
+	}
+}
+
+func TestQuotedPlaceholder(t *testing.T) {
+	for command, want := range map[string]string{
+		"echo {{a}} {{b}}":             "",
+		`echo "{{a}}"`:                 "a",
+		"echo '--x={{b}}'":             "b",
+		`echo "it's" {{a}}`:            "",
+		`echo \"{{a}}\"`:               "",
+		`echo "a \" {{b}}"`:            "b",
+		"echo '{' {{a}} '}'":           "",
+		`grep -e "x" {{a}} "{{b}}.go"`: "b",
+	} {
+		if got := quotedPlaceholder(command); got != want {
+			t.Errorf("quotedPlaceholder(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestPluginCapabilities(t *testing.T) {
+	project := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(project, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	module := filepath.Join(project, "plugins", "stats.wasm")
+	if err := os.MkdirAll(filepath.Dir(module), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(module, []byte("\x00asm\x01\x00\x00\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	def, err := resolvePlugin(types.Plugin{Name: "stats", Module: "plugins/stats.wasm", Dirs: []string{"data"}}, project, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validatePlugin(def, map[string]bool{"read_file": true}); err != nil {
+		t.Fatal(err)
+	}
+	dataDir, _ := filepath.EvalSymlinks(filepath.Join(project, "data"))
+	if !reflect.DeepEqual(def.Dirs, []string{dataDir}) {
+		t.Errorf("granted directories = %q, want %q", def.Dirs, dataDir)
+	}
+
+	if _, err := resolvePlugin(types.Plugin{Name: "escape", Module: "plugins/stats.wasm", Dirs: []string{".."}}, project, true); err == nil {
+		t.Error("project plugin was granted a directory outside the project")
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join(project, "outside")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolvePlugin(types.Plugin{Name: "link", Module: "plugins/stats.wasm", Dirs: []string{"outside"}}, project, true); err == nil {
+		t.Error("project plugin was granted a directory outside the project through a symlink")
+	}
+	if _, err := resolvePlugin(types.Plugin{Name: "net", Module: "plugins/stats.wasm", Network: true}, project, true); err == nil {
+		t.Error("project plugin was granted network access")
+	}
+	if _, err := resolvePlugin(types.Plugin{Name: "user", Module: module, Dirs: []string{".."}}, project, false); err != nil {
+		t.Errorf("user plugin grant rejected: %v", err)
+	}
+	if err := validatePlugin(types.Plugin{Name: "read_file", Module: module}, map[string]bool{"read_file": true}); err == nil {
+		t.Error("plugin replaced a built-in tool")
+	}
+	if err := validatePlugin(types.Plugin{Name: "missing", Module: filepath.Join(project, "nope.wasm")}, nil); err == nil {
+		t.Error("plugin with a missing module was accepted")
+	}
+}
+
+func TestPluginExecute(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a WebAssembly module")
+	}
+	dir := t.TempDir()
+	granted := filepath.Join(dir, "granted")
+	if err := os.MkdirAll(granted, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{
+		filepath.Join(granted, "in.txt"): "granted",
+		filepath.Join(dir, "secret.txt"): "secret",
+		filepath.Join(dir, "go.mod"):     "module example.com/readplugin\n",
+		filepath.Join(dir, "main.go"): `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+func main() {
+	var args struct{ Path string }
+	json.NewDecoder(os.Stdin).Decode(&args)
+	data, err := os.ReadFile(args.Path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Print(string(data))
+}
+`,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	module := filepath.Join(dir, "read.wasm")
+	build := exec.Command("go", "build", "-o", module, ".")
+	build.Dir = dir
+	build.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm", "GOFLAGS=-mod=mod")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Skipf("cannot build a wasip1 module: %v %s", err, out)
+	}
+
+	tool := &PluginTool{def: types.Plugin{Name: "read", Module: module, Dirs: []string{granted}}}
+	out, err := tool.Execute(context.Background(), map[string]interface{}{"path": filepath.Join(granted, "in.txt")})
+	if err != nil || out != "granted" {
+		t.Errorf("read in a granted directory = %q, %v", out, err)
+	}
+	if out, err := tool.Execute(context.Background(), map[string]interface{}{"path": filepath.Join(dir, "secret.txt")}); err == nil {
+		t.Errorf("plugin read a file outside its granted directories: %q", out)
+	}
+}
+
+func TestPowerShellCommand(t *testing.T) {
+	cmd := PowerShellCommand(context.Background(), &types.Agent{Exec: &types.ExecTarget{Prefix: []string{"docker", "exec", "-i", "c", "bash", "-lc"}}}, "Get-ChildItem 'a b'")
+	want := `pwsh -NoProfile -NonInteractive -Command 'Get-ChildItem '\''a b'\'''`
+	if got := cmd.Args[len(cmd.Args)-1]; got != want {
+		t.Errorf("exec target command = %s, want %s", got, want)
+	}
+
+	if findPowerShell() == "" {
+		t.Skip("PowerShell is not installed")
+	}
+	cmd = PowerShellCommand(context.Background(), nil, "Write-Output ('mcode' + 1)")
+	output, err := cmd.Output()
+	if err != nil || strings.TrimSpace(string(output)) != "mcode1" {
+		t.Errorf("pwsh output = %q, %v", output, err)
+	}
+}
+
+func TestCancelKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := ShellCommand(ctx, nil, fmt.Sprintf("sleep 30 & echo $! > %s; wait", pidFile))
+	done := make(chan error, 1)
+	go func() {
+		_, err := runStreaming(ctx, cmd, 30)
+		done <- err
+	}()
+
+	var pid int
+	for i := 0; i < 100 && pid == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+		data, _ := os.ReadFile(pidFile)
+		fmt.Sscanf(string(data), "%d", &pid)
+	}
+	if pid == 0 {
+		t.Fatal("the command did not start its child")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled command did not return")
+	}
+	// The background sleep was in the command's group, so it must be gone too. A killed child
+	// can stay a zombie until its new parent reaps it, which counts as gone.
+	alive := func() bool {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			return syscall.Kill(pid, 0) == nil
+		}
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+		return len(fields) > 0 && fields[0] != "Z"
+	}
+	for i := 0; i < 50 && alive(); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if alive() {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("child %d outlived the cancelled command", pid)
+	}
+	processMu.Lock()
+	defer processMu.Unlock()
+	if len(processGroups) != 0 {
+		t.Errorf("finished command still tracked: %v", processGroups)
+	}
+}
+
+func TestInterruptKeepsOutput(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := ShellCommand(ctx, nil, "trap 'echo cleaned up; exit 130' INT; echo started; sleep 30 & wait")
+	done := make(chan struct{})
+	var output string
+	var err error
+	go func() {
+		output, err = runStreaming(ctx, cmd, 30)
+		close(done)
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(interruptGrace + 3*time.Second):
+		t.Fatal("interrupted command did not return")
+	}
+	// The shell got SIGINT and could run its trap; the output so far is returned
+	if !strings.Contains(output, "started") || !strings.Contains(output, "cleaned up") {
+		t.Errorf("output = %q", output)
+	}
+	if err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Errorf("err = %v, want an interruption", err)
+	}
+}
+
+func TestSandboxPolicy(t *testing.T) {
+	a := &types.Agent{Config: &types.Config{}}
+	if _, ok := sandboxPolicy(a); ok {
+		t.Fatal("sandbox applied while disabled")
+	}
+
+	a.ApproveFolder("/srv/project")
+	a.ApproveFolder("/srv/docs")
+	a.ApproveWriteFolder("/srv/project")
+	a.Config.ApprovedWriteFolders = []string{"~/notes"}
+	a.Config.Sandbox = types.SandboxSettings{Enabled: true, DenyNetwork: true, Writable: []string{"~/.cache"}}
+	policy, ok := sandboxPolicy(a)
+	cwd, _ := os.Getwd()
+	if !ok || !policy.DenyNetwork || policy.Readable != nil {
+		t.Fatalf("sandboxPolicy() = %+v, %v", policy, ok)
+	}
+	for _, want := range []string{"/srv/project", "~/notes", os.TempDir(), "~/.cache", "/dev/null"} {
+		if !slices.Contains(policy.Writable, want) {
+			t.Errorf("%s is not writable in %v", want, policy.Writable)
+		}
+	}
+	// Folders approved only for reading stay read-only
+	for _, folder := range []string{"/srv/docs", cwd} {
+		if slices.Contains(policy.Writable, folder) {
+			t.Errorf("%s is writable without a write grant: %v", folder, policy.Writable)
+		}
+	}
+
+	a.Config.Sandbox.RestrictReads = true
+	policy, _ = sandboxPolicy(a)
+	for _, want := range []string{"/usr", "/srv/docs", cwd} {
+		if !slices.Contains(policy.Readable, want) {
+			t.Errorf("%s is not readable: %v", want, policy.Readable)
+		}
+	}
+}
+
+func TestSandboxFileTools(t *testing.T) {
+	a := &types.Agent{Config: &types.Config{}, Tools: make(map[string]func(map[string]interface{}) (string, error))}
+	a.Config.Sandbox = types.SandboxSettings{Enabled: true, RestrictReads: true}
+	m := NewManager(a)
+	m.RegisterTools()
+
+	inside := filepath.Join(t.TempDir(), "notes.txt")
+	outside := "/mcode-sandbox-test/notes.txt"
+	write, _ := m.GetTool("write_file")
+	if _, err := write.Execute(context.Background(), map[string]interface{}{"path": inside, "content": "ok\n"}); err != nil {
+		t.Fatalf("write inside the sandbox: %v", err)
+	}
+	if _, err := write.Execute(context.Background(), map[string]interface{}{"path": outside, "content": "no\n"}); err == nil || !strings.Contains(err.Error(), "sandbox") {
+		t.Errorf("write outside the sandbox: err = %v", err)
+	}
+	read, _ := m.GetTool("read_file")
+	if _, err := read.Execute(context.Background(), map[string]interface{}{"path": outside}); err == nil || !strings.Contains(err.Error(), "sandbox") {
+		t.Errorf("read outside the sandbox: err = %v", err)
+	}
+}
+
+func TestEnvInfo(t *testing.T) {
+	m := NewManager(&types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error))})
+	m.RegisterTools()
+	tool, _ := m.GetTool("env_info")
+
+	out, err := tool.Execute(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"os: ", "arch: ", "cpus: ", "Runtimes and tools:", "go: go version"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("env_info is missing %q:\n%s", want, out)
+		}
+	}
+	if again, _ := tool.Execute(context.Background(), nil); again != out {
+		t.Error("expected the second call to return the cached result")
+	}
+}
+
+func TestDependenciesTool(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/app\n\nrequire (\n\tgithub.com/acme/widgets v1.4.2\n\tgolang.org/x/sys v0.20.0 // indirect\n)\n",
+		"main.go": "package main\n\nimport _ \"github.com/acme/widgets\"\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := NewManager(&types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error))})
+	m.RegisterTools()
+	tool, _ := m.GetTool("dependencies")
+
+	out, err := tool.Execute(context.Background(), map[string]interface{}{"path": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"go.mod (go example.com/app)", "github.com/acme/widgets v1.4.2 - 1 file(s): main.go", "Indirect dependencies (1): golang.org/x/sys v0.20.0"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+
+	out, _ = tool.Execute(context.Background(), map[string]interface{}{"path": dir, "package": "x/sys"})
+	if !strings.Contains(out, "golang.org/x/sys v0.20.0 [indirect] - not imported by any source file") || strings.Contains(out, "widgets") {
+		t.Errorf("unexpected filtered output:\n%s", out)
+	}
+}
+
+func TestSecretScanBeforeCommit(t *testing.T) {
+	agent := &types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error)), Config: &types.Config{}}
+	m := NewManager(agent)
+	m.RegisterTools()
+	tool, _ := m.GetTool("bash_command")
+
+	path := filepath.Join(t.TempDir(), "config.go")
+	if err := m.writeFile(path, []byte("package config\n\nconst apiKey = \"f3Kx9TqLm2ZvB8nW4rYh\"\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := tool.Execute(context.Background(), map[string]interface{}{"command": "echo build"}); err != nil || strings.Contains(out, "secret") {
+		t.Errorf("other commands should not be scanned, got %q, %v", out, err)
+	}
+	// Each prompt gets a new manager, so the commit is usually checked by another one
+	next := NewManager(agent)
+	next.RegisterTools()
+	tool, _ = next.GetTool("bash_command")
+	_, err := tool.Execute(context.Background(), map[string]interface{}{"command": "echo git commit -am wip"})
+	if err == nil || !strings.Contains(err.Error(), "config.go:3: hardcoded secret (f3Kx********)") {
+		t.Fatalf("expected the commit to be blocked, got %v", err)
+	}
+
+	agent.Config.SecretScan = SecretScanWarn
+	out, err := tool.Execute(context.Background(), map[string]interface{}{"command": "echo gh pr create"})
+	if err != nil || !strings.HasPrefix(out, "gh pr create\n") || !strings.Contains(out, "Warning: possible secrets") {
+		t.Errorf("expected the command to run with a warning, got %q, %v", out, err)
+	}
+
+	agent.Config.SecretScan = ""
+	if err := m.writeFile(path, []byte("package config\n\nvar apiKey = os.Getenv(\"API_KEY\")\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tool.Execute(context.Background(), map[string]interface{}{"command": "echo git push"}); err != nil {
+		t.Errorf("expected no findings once the secret is removed, got %v", err)
+	}
+}
+
+func TestSearchAndReplaceTool(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.go":               "package a\n\nfunc OldName() {}\n\nvar _ = OldName\n",
+		"b.go":               "package a\n\nfunc useOldNameTwice() { OldName() }\n",
+		"notes.md":           "OldName is documented here\n",
+		".git/config":        "OldName\n",
+		"node_modules/x.js":  "OldName\n",
+		"sub/c.ts":           "export const OldName = 1\n",
+		"sub/untouched.go":   "package sub\n",
+		"sub/binary.go.orig": "OldName\x00\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := NewManager(&types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error))})
+	m.RegisterTools()
+	tool, _ := m.GetTool("search_and_replace")
+
+	params := map[string]interface{}{"pattern": `\bOldName\b`, "replacement": "NewName", "regex": true, "directory": dir, "include": "*.{go,ts}"}
+	preview, _ := tool.Preview(params)
+	if !strings.Contains(preview, "4 match(es) in 3 file(s)") {
+		t.Errorf("unexpected preview:\n%s", preview)
+	}
+
+	out, err := tool.Execute(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Replaced 4 match(es) in 3 file(s)") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	read := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		return string(data)
+	}
+	if got := read("b.go"); got != "package a\n\nfunc useOldNameTwice() { NewName() }\n" {
+		t.Errorf("b.go = %q, the whole-word regex should keep useOldNameTwice", got)
+	}
+	if !strings.Contains(read("sub/c.ts"), "NewName") {
+		t.Error("sub/c.ts was not changed")
+	}
+	for _, name := range []string{"notes.md", ".git/config", "node_modules/x.js"} {
+		if read(name) != files[name] {
+			t.Errorf("%s should not have been changed", name)
+		}
+	}
+
+	// Literal mode matches the pattern as written
+	out, err = tool.Execute(context.Background(), map[string]interface{}{"pattern": "is documented", "replacement": "was documented", "directory": dir})
+	if err != nil || !strings.Contains(out, "in 1 file(s)") || !strings.Contains(read("notes.md"), "was documented") {
+		t.Errorf("literal replace: %v\n%s", err, out)
+	}
+}
+
+func TestRenameSymbolPosition(t *testing.T) {
+	content := "package a\n\n// Use runs use\nfunc use(user string) { use(user) }\n"
+	offset, err := symbolOffset(content, 4, "use")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Index(content, "use(user string)"); offset != want {
+		t.Errorf("symbolOffset() = %d, want %d (the whole word, not user)", offset, want)
+	}
+	if _, err := symbolOffset(content, 1, "use"); err == nil {
+		t.Error("a symbol missing from the line should fail")
+	}
+
+	m := NewManager(&types.Agent{Config: &types.Config{LanguageServers: map[string]string{"go": "my-gopls -remote=auto"}}})
+	if command, err := m.languageServerFor("main.go"); err != nil || strings.Join(command, " ") != "my-gopls -remote=auto" {
+		t.Errorf("languageServerFor() = %v, %v; want the configured server", command, err)
+	}
+	if _, err := m.languageServerFor("notes.txt"); err == nil {
+		t.Error("a file type without a language server should fail")
+	}
+}
+
+func TestScratchpadTool(t *testing.T) {
+	agent := &types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error))}
+	m := NewManager(agent)
+	m.RegisterTools()
+	tool, ok := m.GetTool(ScratchpadToolName)
+	if !ok {
+		t.Fatal("scratchpad is not registered")
+	}
+
+	empty, err := tool.Execute(context.Background(), map[string]interface{}{"note": ""})
+	if err != nil || !strings.HasPrefix(empty, "No notes yet") {
+		t.Fatalf("Execute(empty) = %q, %v", empty, err)
+	}
+
+	call := func(id, name, args string) types.Message {
+		return types.Message{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: id, Function: openai.FunctionCall{Name: name, Arguments: args}}}}
+	}
+	agent.AddMessage(call("1", ScratchpadToolName, `{"note":"bug is in the cache key"}`))
+	agent.AddMessage(call("2", "read_file", `{"path":"cache.go"}`))
+	agent.AddMessage(call("3", ScratchpadToolName, `{"note":" check eviction next "}`))
+	agent.AddMessage(call("4", ScratchpadToolName, `{"note":""}`))
+
+	notes := ScratchpadNotes(agent.Messages())
+	if want := []string{"bug is in the cache key", "check eviction next"}; !reflect.DeepEqual(notes, want) {
+		t.Errorf("ScratchpadNotes = %q, want %q", notes, want)
+	}
+	if result, _ := tool.Execute(context.Background(), map[string]interface{}{"note": "x"}); result != "Noted." {
+		t.Errorf("Execute(note) = %q", result)
+	}
+	if list, _ := tool.Execute(context.Background(), map[string]interface{}{}); list != "1. bug is in the cache key\n2. check eviction next\n" {
+		t.Errorf("Execute(list) = %q", list)
+	}
+}
+
+func TestPlanWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte("a\nb\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(&types.Agent{Tools: make(map[string]func(map[string]interface{}) (string, error))})
+
+	tests := []struct {
+		name   string
+		tool   string
+		params map[string]interface{}
+		want   PlannedWrite
+	}{
+		{"incremental edit", "edit_file", map[string]interface{}{"filePath": path, "oldString": "b\n", "newString": "b1\nb2\n"},
+			PlannedWrite{Path: path, Kind: WriteModify, Added: 2, Removed: 1, Bytes: 10}},
+		{"line edit", "edit_file", map[string]interface{}{"filePath": path, "start_line": 3, "end_line": 3, "newString": ""},
+			PlannedWrite{Path: path, Kind: WriteModify, Removed: 1, Bytes: 4}},
+		{"new file", "edit_file", map[string]interface{}{"filePath": filepath.Join(dir, "new.go"), "newString": "x\ny\n"},
+			PlannedWrite{Path: filepath.Join(dir, "new.go"), Kind: WriteCreate, Added: 2, Bytes: 4}},
+		{"overwrite", "write_file", map[string]interface{}{"path": path, "content": "a\n"},
+			PlannedWrite{Path: path, Kind: WriteOverwrite, Removed: 2, Bytes: 2}},
+	}
+	for _, tt := range tests {
+		got, err := m.PlanWrite(tt.tool, tt.params)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("%s: PlanWrite() = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+
+	if _, err := m.PlanWrite("edit_file", map[string]interface{}{"filePath": path, "oldString": "missing", "newString": "x"}); err == nil {
+		t.Error("expected an error for an edit that does not apply")
+	}
+}
@@ -0,0 +1,41 @@
+package tools
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// workspacePathParams are the tool parameters holding file or directory paths
+var workspacePathParams = []string{"path", "filePath", "directory"}
+
+// WorkspaceRootName is the name used to address a workspace root in @<root>/<path> paths
+func WorkspaceRootName(root string) string {
+	return filepath.Base(root)
+}
+
+// resolveWorkspacePath expands an @<root>/<path> reference to an absolute path under that root.
+// Other paths are returned unchanged.
+func resolveWorkspacePath(roots []string, path string) string {
+	if !strings.HasPrefix(path, "@") {
+		return path
+	}
+	name, rest, _ := strings.Cut(strings.TrimPrefix(path, "@"), "/")
+	for _, root := range roots {
+		if WorkspaceRootName(root) == name {
+			return filepath.Join(root, rest)
+		}
+	}
+	return path
+}
+
+// expandWorkspacePaths rewrites @<root>/<path> references in path parameters
+func (m *Manager) expandWorkspacePaths(params map[string]interface{}) {
+	if m.agent == nil || len(m.agent.WorkspaceRoots) == 0 {
+		return
+	}
+	for _, key := range workspacePathParams {
+		if value, ok := params[key].(string); ok {
+			params[key] = resolveWorkspacePath(m.agent.WorkspaceRoots, value)
+		}
+	}
+}
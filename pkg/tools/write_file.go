@@ -55,10 +55,15 @@ func (t *WriteFileTool) Execute(ctx context.Context, params map[string]interface
 		return "", ctx.Err()
 	}
 
+	if err := t.manager.sandboxAccess(args.Path, true); err != nil {
+		return "", err
+	}
+
 	// Ensure parent directories exist
-	dir := filepath.Dir(args.Path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("error creating directories: %v", err)
+	if !t.manager.remoteFiles() {
+		if err := os.MkdirAll(filepath.Dir(args.Path), 0755); err != nil {
+			return "", fmt.Errorf("error creating directories: %v", err)
+		}
 	}
 
 	if ctx.Err() != nil {
@@ -66,31 +71,39 @@ func (t *WriteFileTool) Execute(ctx context.Context, params map[string]interface
 	}
 
 	var oldContent string
-	if _, err := os.Stat(args.Path); err == nil {
-		existingContent, err := os.ReadFile(args.Path)
-		if err != nil {
-			return "", fmt.Errorf("error reading existing file: %v", err)
-		}
+	existed := false
+	if existingContent, err := t.manager.readFile(args.Path); err == nil {
 		oldContent = string(existingContent)
+		existed = true
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("error reading existing file: %v", err)
+	}
+
+	if err := t.manager.checkFileUnchanged(args.Path); err != nil {
+		return "", err
+	}
+	if err := checkEditSyntax(args.Path, oldContent, args.Content, existed); err != nil {
+		return "", err
 	}
 
 	if ctx.Err() != nil {
 		return "", ctx.Err()
 	}
 
-	err := os.WriteFile(args.Path, []byte(args.Content), 0644)
+	err := t.manager.writeFile(args.Path, []byte(args.Content))
 	if err != nil {
 		return "", fmt.Errorf("error writing file: %v", err)
 	}
+	t.manager.recordFileVersion(args.Path)
 
 	if ctx.Err() != nil {
 		return "", ctx.Err()
 	}
 
 	if oldContent == "" {
-		return fmt.Sprintf("✅ File created: %s\n%s", args.Path, truncatePreview(args.Content, 200)), nil
+		return fmt.Sprintf("✅ File created: %s\n%s", args.Path, truncatePreview(args.Content, 200)) + t.manager.afterEdit(ctx, args.Path), nil
 	} else if oldContent != args.Content {
-		return fmt.Sprintf("✅ File overwritten: %s\n%s", args.Path, truncatePreview(args.Content, 200)), nil
+		return fmt.Sprintf("✅ File overwritten: %s\n%s", args.Path, truncatePreview(args.Content, 200)) + t.manager.afterEdit(ctx, args.Path), nil
 	}
 
 	return fmt.Sprintf("✅ File unchanged: %s", args.Path), nil
@@ -107,7 +120,7 @@ func (t *WriteFileTool) Preview(params map[string]interface{}) (string, error) {
 	}
 
 	var oldContent string
-	if existingContent, err := os.ReadFile(args.Path); err == nil {
+	if existingContent, err := t.manager.readFile(args.Path); err == nil {
 		oldContent = string(existingContent)
 	}
 
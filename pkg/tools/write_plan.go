@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Write kinds reported by PlanWrite
+const (
+	WriteCreate    = "create"
+	WriteModify    = "modify"
+	WriteOverwrite = "overwrite"
+)
+
+// PlannedWrite describes what an edit_file or write_file call is about to do to the disk
+type PlannedWrite struct {
+	Path    string // Absolute path of the target
+	Kind    string // WriteCreate, WriteModify or WriteOverwrite
+	Added   int    // Lines added
+	Removed int    // Lines removed
+	Bytes   int    // Size of the file after the write
+}
+
+// PlanWrite computes the target and size of an edit_file or write_file call without writing
+func (m *Manager) PlanWrite(name string, params map[string]interface{}) (*PlannedWrite, error) {
+	var path, oldContent, newContent string
+	exists, whole := false, false // whole: the call replaces the entire file
+
+	switch name {
+	case "write_file":
+		var args WriteFileArgs
+		if err := m.UnmarshalParams(params, &args); err != nil {
+			return nil, err
+		}
+		path, newContent, whole = args.Path, args.Content, true
+		if data, err := m.readFile(path); err == nil {
+			oldContent, exists = string(data), true
+		}
+	case "edit_file":
+		var args EditFileArgs
+		if err := m.UnmarshalParams(params, &args); err != nil {
+			return nil, err
+		}
+		path = args.GetFilePath()
+		data, err := m.readFile(path)
+		if err == nil {
+			oldContent, exists = string(data), true
+		}
+		switch {
+		case exists && isNotebookEdit(path, args):
+			updated, err := editNotebook(data, args)
+			if err != nil {
+				return nil, err
+			}
+			newContent = string(updated)
+		case exists && args.StartLine != 0:
+			if newContent, err = ReplaceLines(oldContent, args.StartLine, args.EndLine, args.NewString); err != nil {
+				return nil, err
+			}
+		case exists && args.OldString != "":
+			if newContent, err = ReplaceInContent(oldContent, args.OldString, args.NewString, args.ReplaceAll); err != nil {
+				return nil, err
+			}
+		case args.OldString == "" && args.StartLine == 0:
+			// Without oldString the file is written whole, replacing any existing content
+			newContent, whole = args.NewString, true
+		default:
+			return nil, fmt.Errorf("cannot read %s: %v", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s does not write a single file", name)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no path given")
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &PlannedWrite{Path: abs, Kind: WriteModify, Bytes: len(newContent)}
+	switch {
+	case !exists:
+		w.Kind = WriteCreate
+	case whole:
+		w.Kind = WriteOverwrite
+	}
+	w.Added, w.Removed = lineChanges(oldContent, newContent)
+	return w, nil
+}
+
+// lineChanges counts the lines added and removed between two versions of a file
+func lineChanges(oldContent, newContent string) (added, removed int) {
+	split := func(s string) []string {
+		lines := strings.SplitAfter(s, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		return lines
+	}
+	matcher := difflib.NewMatcher(split(oldContent), split(newContent))
+	for _, op := range matcher.GetOpCodes() {
+		switch op.Tag {
+		case 'r':
+			removed += op.I2 - op.I1
+			added += op.J2 - op.J1
+		case 'd':
+			removed += op.I2 - op.I1
+		case 'i':
+			added += op.J2 - op.J1
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,37 @@
+package types
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// TestAgentConcurrentAccess is meant to be run with -race
+func TestAgentConcurrentAccess(t *testing.T) {
+	a := &Agent{}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				a.AddMessage(Message{Role: openai.ChatMessageRoleUser, Content: "hi"})
+				a.RecordUsage(&openai.Usage{PromptTokens: j}, 1)
+				a.ApproveFolder("/src")
+				a.UpdateMessages(func(msgs []Message) []Message { return msgs })
+				_ = a.Messages()
+				_ = a.TokenUsage()
+				_ = a.ApprovedFolderList()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(a.Messages()) != 400 || a.SessionTokens() != 400 {
+		t.Errorf("got %d messages and %d tokens, want 400 of each", len(a.Messages()), a.SessionTokens())
+	}
+	if folders := a.ApprovedFolderList(); len(folders) != 1 || folders[0] != "/src" {
+		t.Errorf("ApprovedFolderList() = %v", folders)
+	}
+}
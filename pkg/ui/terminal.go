@@ -20,6 +20,12 @@ var (
 	oldState  *term.State
 	outputMu  sync.Mutex
 
+	// startState is the terminal mode mcode started in, see CaptureTerminal
+	startState *term.State
+
+	// ctrlCPressed records that an interrupt came from Ctrl+C rather than Escape, see TakeCtrlC
+	ctrlCPressed atomic.Bool
+
 	// ErrInterrupted is returned when the user presses Escape or Ctrl+C
 	ErrInterrupted = fmt.Errorf("interrupted by user")
 )
@@ -104,6 +110,7 @@ func StartInterruptMonitor(ctx context.Context, onToggle func()) (context.Contex
 						}
 						// Handle Ctrl+C (ETX)
 						if buf[0] == 3 {
+							ctrlCPressed.Store(true)
 							return
 						}
 						// Handle Ctrl+T (20) for toggling
@@ -134,6 +141,29 @@ func StartInterruptMonitor(ctx context.Context, onToggle func()) (context.Contex
 	}
 }
 
+// TakeCtrlC reports whether Ctrl+C was pressed to interrupt an operation or answer a prompt since
+// the last call, and resets it
+func TakeCtrlC() bool {
+	return ctrlCPressed.Swap(false)
+}
+
+// CaptureTerminal records the current terminal mode for RestoreTerminal
+func CaptureTerminal() {
+	if state, err := term.GetState(int(os.Stdin.Fd())); err == nil {
+		startState = state
+	}
+}
+
+// RestoreTerminal puts the terminal back in the mode recorded by CaptureTerminal and clears a
+// half-drawn line such as a spinner. It is meant for exiting, while raw mode may still be active.
+func RestoreTerminal() {
+	if startState != nil {
+		term.Restore(int(os.Stdin.Fd()), startState)
+		isRawMode.Store(false)
+	}
+	PrintSafe("\r\033[K")
+}
+
 func inputAvailable(fd int) bool {
 	return inputAvailableTimeout(fd, 100000) // 100ms
 }
@@ -144,10 +174,10 @@ func inputAvailableShort(fd int) bool {
 
 func inputAvailableTimeout(fd int, usec int) bool {
 	var fds unix.FdSet
-	// Set bit for fd
-	fds.Bits[fd/32] |= 1 << (uint(fd) % 32)
+	fds.Set(fd)
 
-	tv := unix.Timeval{Sec: 0, Usec: int32(usec)}
+	// NsecToTimeval keeps this portable: Timeval field widths differ between macOS and Linux
+	tv := unix.NsecToTimeval(int64(usec) * 1000)
 
 	n, err := unix.Select(fd+1, &fds, nil, nil, &tv)
 	return n > 0 && err == nil
@@ -250,6 +280,7 @@ func ReadConfirmation() string {
 			return "i" // Standalone Escape -> interrupt
 		}
 		if key == 3 { // Ctrl+C
+			ctrlCPressed.Store(true)
 			return "i"
 		}
 		if key == 20 { // Ctrl+T
@@ -0,0 +1,224 @@
+// Package upgrade finds newer mcode releases on GitHub and replaces the running binary with one
+package upgrade
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Repository is the GitHub repository releases are published in
+const Repository = "mariuslacatus/mcode-cli"
+
+// ChecksumsAsset is the release asset listing the SHA-256 of every binary, in sha256sum format
+const ChecksumsAsset = "checksums.txt"
+
+// releasesAPI is the GitHub API base URL; tests point it at a local server
+var releasesAPI = "https://api.github.com/repos/" + Repository + "/releases"
+
+// maxBinarySize bounds a downloaded binary
+const maxBinarySize = 256 << 20
+
+// Release is a published release
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	URL    string  `json:"html_url"`
+	Assets []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// AssetName is the name of the release binary for this platform, e.g. mcode-linux-amd64
+func AssetName() string {
+	name := fmt.Sprintf("mcode-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Latest returns the most recent published release
+func Latest(ctx context.Context) (*Release, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, releasesAPI+"/latest", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	data, err := fetch(req, 1<<20)
+	if err != nil {
+		return nil, fmt.Errorf("checking for releases: %v", err)
+	}
+	var release Release
+	if err := json.Unmarshal(data, &release); err != nil || release.Tag == "" {
+		return nil, fmt.Errorf("unexpected release response: %s", strings.TrimSpace(string(data)))
+	}
+	return &release, nil
+}
+
+// Newer reports whether release version latest is newer than current. Versions are compared as
+// dotted numbers with an optional leading v; a current version that is not one (such as "dev")
+// is treated as older than any release.
+func Newer(latest, current string) bool {
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	c, ok := parseVersion(current)
+	if !ok {
+		return true
+	}
+	for i := 0; i < max(len(l), len(c)); i++ {
+		var a, b int
+		if i < len(l) {
+			a = l[i]
+		}
+		if i < len(c) {
+			b = c[i]
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	return false
+}
+
+func parseVersion(version string) ([]int, bool) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	// Pre-release and build suffixes (1.2.0-rc1, 1.2.0+abc) are ignored
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
+
+// Install downloads this platform's binary from release, verifies it against the release
+// checksums and replaces the executable at path with it. The old binary is only replaced once the
+// new one has been verified.
+func Install(ctx context.Context, release *Release, path string) error {
+	asset, checksums := findAsset(release, AssetName()), findAsset(release, ChecksumsAsset)
+	if asset == nil {
+		return fmt.Errorf("release %s has no binary for %s/%s (%s)", release.Tag, runtime.GOOS, runtime.GOARCH, AssetName())
+	}
+	if checksums == nil {
+		return fmt.Errorf("release %s has no %s; refusing to install an unverified binary", release.Tag, ChecksumsAsset)
+	}
+
+	want, err := expectedChecksum(ctx, checksums.URL, asset.Name)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.URL, nil)
+	if err != nil {
+		return err
+	}
+	binary, err := fetch(req, maxBinarySize)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %v", asset.Name, err)
+	}
+	sum := sha256.Sum256(binary)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", asset.Name, want, got)
+	}
+
+	return replaceExecutable(path, binary)
+}
+
+func findAsset(release *Release, name string) *Asset {
+	for i := range release.Assets {
+		if release.Assets[i].Name == name {
+			return &release.Assets[i]
+		}
+	}
+	return nil
+}
+
+// expectedChecksum reads the hash of name from a sha256sum-format checksums file
+func expectedChecksum(ctx context.Context, url, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	data, err := fetch(req, 1<<20)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %v", ChecksumsAsset, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s does not list %s", ChecksumsAsset, name)
+}
+
+// replaceExecutable writes binary next to path and renames it over path, so a failed write
+// never leaves a partial executable behind. Symlinks are followed to the real binary.
+func replaceExecutable(path string, binary []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".mcode-upgrade-*")
+	if err != nil {
+		return fmt.Errorf("cannot write next to %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0111); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func fetch(req *http.Request, limit int64) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", req.URL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", req.URL, limit)
+	}
+	return data, nil
+}
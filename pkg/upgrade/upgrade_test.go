@@ -0,0 +1,102 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v1.0.12", "v1.0.9", true},
+		{"v1.1", "v1.0.40", true},
+		{"v1.0.9", "v1.0.9", false},
+		{"v1.0.8", "v1.0.9", false},
+		{"1.2.0", "v1.2.0-rc1", false},
+		{"v1.0.0", "dev", true},
+		{"nightly", "v1.0.0", false},
+	}
+	for _, tt := range tests {
+		if got := Newer(tt.latest, tt.current); got != tt.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho new\n")
+	sum := sha256.Sum256(binary)
+	checksum := hex.EncodeToString(sum[:])
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tag_name": "v2.0.0", "assets": [
+			{"name": %q, "browser_download_url": %q},
+			{"name": "checksums.txt", "browser_download_url": %q},
+			{"name": "bad-checksums.txt", "browser_download_url": %q}]}`,
+			AssetName(), server.URL+"/binary", server.URL+"/checksums", server.URL+"/bad-checksums")
+	})
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) { w.Write(binary) })
+	mux.HandleFunc("/checksums", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  other-binary\n%s *%s\n", strings.Repeat("0", 64), checksum, AssetName())
+	})
+	mux.HandleFunc("/bad-checksums", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  %s\n", strings.Repeat("0", 64), AssetName())
+	})
+
+	oldAPI := releasesAPI
+	releasesAPI = server.URL + "/releases"
+	defer func() { releasesAPI = oldAPI }()
+
+	release, err := Latest(context.Background())
+	if err != nil || release.Tag != "v2.0.0" {
+		t.Fatalf("Latest() = %+v, %v", release, err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mcode")
+	os.WriteFile(path, []byte("old"), 0755)
+	link := filepath.Join(dir, "link")
+	os.Symlink(path, link)
+
+	// A checksum mismatch must leave the installed binary alone
+	bad := *release
+	bad.Assets = []Asset{release.Assets[0], {Name: ChecksumsAsset, URL: release.Assets[2].URL}}
+	if err := Install(context.Background(), &bad, link); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Install() with a wrong checksum = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Fatalf("binary replaced despite the checksum mismatch: %q", data)
+	}
+
+	if err := Install(context.Background(), release, link); err != nil {
+		t.Fatalf("Install() = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	info, _ := os.Lstat(link)
+	if string(data) != string(binary) || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("after Install the binary is %q and the link mode %v", data, info.Mode())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	noChecksums := *release
+	noChecksums.Assets = release.Assets[:1]
+	if err := Install(context.Background(), &noChecksums, path); err == nil {
+		t.Error("Install() without checksums should fail")
+	}
+}
@@ -0,0 +1,165 @@
+// Package usage keeps a log of the tokens, cost and generation time of every model response across
+// sessions, for `mcode usage`. Each response is one JSON line appended to ~/.mcode/usage.jsonl, so
+// concurrent mcode processes can record without coordinating.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"coding-agent/pkg/types"
+)
+
+// Entry is the usage of one model response
+type Entry struct {
+	Time             time.Time `json:"time"`
+	Model            string    `json:"model"` // Model key from the config
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost,omitempty"`    // USD, from the model's configured prices
+	Seconds          float64   `json:"seconds,omitempty"` // Time from sending the request to the end of the response
+}
+
+// Total sums usage over a set of entries
+type Total struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	Seconds          float64
+}
+
+func (t *Total) add(e Entry) {
+	t.Requests++
+	t.PromptTokens += e.PromptTokens
+	t.CompletionTokens += e.CompletionTokens
+	t.Cost += e.Cost
+	t.Seconds += e.Seconds
+}
+
+// Row is the usage of one model on one day, or over the whole period when grouping by model only
+type Row struct {
+	Day   string // YYYY-MM-DD in local time; empty when not grouped by day
+	Model string
+	Total
+}
+
+// logPath is the usage log; tests point it elsewhere
+var logPath = func() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".mcode", "usage.jsonl"), nil
+}
+
+// Cost returns the price in USD of a response from model, using its per-million-token prices.
+// Models without prices, such as local ones, cost nothing.
+func Cost(model types.Model, promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*model.InputPrice + float64(completionTokens)*model.OutputPrice) / 1e6
+}
+
+// Record appends an entry to the usage log
+func Record(e Entry) error {
+	path, err := logPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Load returns the entries recorded at or after since. Lines that do not parse are skipped.
+func Load(since time.Time) ([]Entry, error) {
+	path, err := logPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Time.Before(since) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Spent returns what model has cost since the start of the day and of the month containing now
+func Spent(model string, now time.Time) (day, month float64, err error) {
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	entries, err := Load(monthStart)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, e := range entries {
+		if e.Model != model {
+			continue
+		}
+		month += e.Cost
+		if !e.Time.Before(dayStart) {
+			day += e.Cost
+		}
+	}
+	return day, month, nil
+}
+
+// Summarize groups entries by model, and by day first when byDay is set (oldest day first, models
+// by name within a day), and returns the grand total
+func Summarize(entries []Entry, byDay bool) ([]Row, Total) {
+	type key struct{ day, model string }
+	totals := make(map[key]*Total)
+	var grand Total
+	for _, e := range entries {
+		k := key{model: e.Model}
+		if byDay {
+			k.day = e.Time.Local().Format("2006-01-02")
+		}
+		if totals[k] == nil {
+			totals[k] = &Total{}
+		}
+		totals[k].add(e)
+		grand.add(e)
+	}
+
+	rows := make([]Row, 0, len(totals))
+	for k, t := range totals {
+		rows = append(rows, Row{Day: k.day, Model: k.model, Total: *t})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Day != rows[j].Day {
+			return rows[i].Day < rows[j].Day
+		}
+		return rows[i].Model < rows[j].Model
+	})
+	return rows, grand
+}
@@ -0,0 +1,69 @@
+package usage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"coding-agent/pkg/types"
+)
+
+func TestRecordAndSummarize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	oldPath := logPath
+	logPath = func() (string, error) { return path, nil }
+	defer func() { logPath = oldPath }()
+
+	model := types.Model{InputPrice: 2.5, OutputPrice: 10}
+	if got := Cost(model, 1_000_000, 100_000); math.Abs(got-3.5) > 1e-9 {
+		t.Errorf("Cost() = %v, want 3.5", got)
+	}
+	if got := Cost(types.Model{}, 5000, 500); got != 0 {
+		t.Errorf("Cost() without prices = %v, want 0", got)
+	}
+
+	today := time.Now()
+	yesterday := today.AddDate(0, 0, -1)
+	entries := []Entry{
+		{Time: today.AddDate(0, 0, -10), Model: "gpt", PromptTokens: 999},
+		{Time: yesterday, Model: "gpt", PromptTokens: 100, CompletionTokens: 10, Cost: 0.5, Seconds: 2},
+		{Time: today, Model: "local", PromptTokens: 200, CompletionTokens: 20, Seconds: 4},
+		{Time: today, Model: "gpt", PromptTokens: 300, CompletionTokens: 30, Cost: 1, Seconds: 1},
+		{Time: today, Model: "gpt", PromptTokens: 400, CompletionTokens: 40, Cost: 1, Seconds: 1},
+	}
+	for _, e := range entries {
+		if err := Record(e); err != nil {
+			t.Fatalf("Record() = %v", err)
+		}
+	}
+	// A damaged line does not hide the rest of the log
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("{not json\n")
+	f.Close()
+
+	loaded, err := Load(today.AddDate(0, 0, -7))
+	if err != nil || len(loaded) != 4 {
+		t.Fatalf("Load() = %d entries, %v; want 4", len(loaded), err)
+	}
+
+	rows, total := Summarize(loaded, true)
+	if len(rows) != 3 {
+		t.Fatalf("Summarize() by day = %+v", rows)
+	}
+	if rows[0].Model != "gpt" || rows[0].Day != yesterday.Format("2006-01-02") || rows[0].Requests != 1 {
+		t.Errorf("first row = %+v", rows[0])
+	}
+	if rows[1].Model != "gpt" || rows[1].Requests != 2 || rows[1].PromptTokens != 700 || rows[1].Cost != 2 {
+		t.Errorf("second row = %+v", rows[1])
+	}
+	if total.Requests != 4 || total.PromptTokens != 1000 || total.CompletionTokens != 100 || total.Cost != 2.5 || total.Seconds != 8 {
+		t.Errorf("total = %+v", total)
+	}
+
+	rows, _ = Summarize(loaded, false)
+	if len(rows) != 2 || rows[0].Model != "gpt" || rows[0].Requests != 3 || rows[0].Day != "" {
+		t.Errorf("Summarize() by model = %+v", rows)
+	}
+}
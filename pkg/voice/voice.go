@@ -0,0 +1,237 @@
+// Package voice records speech from the microphone and transcribes it with whisper.cpp or an
+// OpenAI-compatible transcription endpoint
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"coding-agent/pkg/types"
+)
+
+// wavHeaderSize is the size of an empty WAV file; a recording no larger captured nothing
+const wavHeaderSize = 44
+
+// defaultModel is the transcription model requested from an endpoint when none is configured
+const defaultModel = "whisper-1"
+
+// Recording is a microphone recording in progress
+type Recording struct {
+	cmd    *exec.Cmd
+	path   string
+	stderr bytes.Buffer
+}
+
+// Start records the default microphone to a temporary WAV file in 16 kHz mono, the format
+// whisper expects
+func Start() (*Recording, error) {
+	dir, err := os.MkdirTemp("", "mcode-voice-")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "recording.wav")
+	argv, err := recorderCommand(runtime.GOOS, path, exec.LookPath)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	r := &Recording{cmd: exec.Command(argv[0], argv[1:]...), path: path}
+	r.cmd.Stderr = &r.stderr
+	if err := r.cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("starting %s: %v", argv[0], err)
+	}
+	return r, nil
+}
+
+// Stop ends the recording and returns the path of the WAV file. The caller removes it with Remove.
+func (r *Recording) Stop() (string, error) {
+	// Recorders finish the WAV header when interrupted; Windows has no interrupt to send
+	if runtime.GOOS == "windows" || r.cmd.Process.Signal(os.Interrupt) != nil {
+		r.cmd.Process.Kill()
+	}
+	r.cmd.Wait()
+
+	info, err := os.Stat(r.path)
+	if err != nil || info.Size() <= wavHeaderSize {
+		r.Remove()
+		if msg := strings.TrimSpace(r.stderr.String()); msg != "" {
+			return "", fmt.Errorf("nothing was recorded: %s", msg)
+		}
+		return "", fmt.Errorf("nothing was recorded; check that a microphone is connected and mcode may use it")
+	}
+	return r.path, nil
+}
+
+// Cancel ends the recording and discards it
+func (r *Recording) Cancel() {
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	r.Remove()
+}
+
+// Remove deletes the recorded file
+func (r *Recording) Remove() {
+	os.RemoveAll(filepath.Dir(r.path))
+}
+
+// recorderCommand returns the command that records the default microphone to path until it is
+// interrupted: sox's rec anywhere, arecord on Linux, or ffmpeg on macOS and Linux
+func recorderCommand(goos, path string, lookPath func(string) (string, error)) ([]string, error) {
+	if _, err := lookPath("rec"); err == nil {
+		return []string{"rec", "-q", "-c", "1", "-r", "16000", "-b", "16", path}, nil
+	}
+	if goos == "linux" {
+		if _, err := lookPath("arecord"); err == nil {
+			return []string{"arecord", "-q", "-f", "S16_LE", "-c", "1", "-r", "16000", path}, nil
+		}
+	}
+	if _, err := lookPath("ffmpeg"); err == nil {
+		switch goos {
+		case "darwin":
+			return []string{"ffmpeg", "-loglevel", "error", "-f", "avfoundation", "-i", ":0", "-ac", "1", "-ar", "16000", "-y", path}, nil
+		case "linux":
+			return []string{"ffmpeg", "-loglevel", "error", "-f", "pulse", "-i", "default", "-ac", "1", "-ar", "16000", "-y", path}, nil
+		}
+	}
+	return nil, fmt.Errorf("no audio recorder found; install sox (rec), arecord or ffmpeg")
+}
+
+// Describe says how Transcribe will turn speech into text with these settings
+func Describe(settings types.VoiceSettings) string {
+	if settings.Endpoint != "" {
+		return settings.Endpoint
+	}
+	return "whisper.cpp"
+}
+
+// Transcribe converts a recording to text, with the configured endpoint or else whisper.cpp
+func Transcribe(ctx context.Context, settings types.VoiceSettings, path string) (string, error) {
+	var text string
+	var err error
+	if settings.Endpoint != "" {
+		text, err = transcribeEndpoint(ctx, settings, path)
+	} else {
+		text, err = transcribeWhisperCpp(ctx, settings, path)
+	}
+	if err != nil {
+		return "", err
+	}
+	return cleanTranscript(text), nil
+}
+
+// transcribeWhisperCpp runs the whisper.cpp command line tool on a recording
+func transcribeWhisperCpp(ctx context.Context, settings types.VoiceSettings, path string) (string, error) {
+	model := settings.WhisperModel
+	if model == "" {
+		return "", fmt.Errorf("set voice.whisper_model to a whisper.cpp ggml model file, or voice.endpoint to a transcription API")
+	}
+	if strings.HasPrefix(model, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			model = filepath.Join(home, model[2:])
+		}
+	}
+
+	command := settings.WhisperCommand
+	if command == "" {
+		command = "whisper-cli"
+		if _, err := exec.LookPath(command); err != nil {
+			command = "whisper-cpp" // Homebrew's name for it
+		}
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		return "", fmt.Errorf("whisper.cpp (%s) is not installed; set voice.whisper_command to its path", command)
+	}
+
+	args := []string{"-m", model, "-f", path, "-nt", "-np"}
+	if settings.Language != "" {
+		args = append(args, "-l", settings.Language)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("%s failed: %v %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return string(output), nil
+}
+
+// transcribeEndpoint uploads a recording to an OpenAI-compatible /audio/transcriptions endpoint
+func transcribeEndpoint(ctx context.Context, settings types.VoiceSettings, path string) (string, error) {
+	audio, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	model := settings.Model
+	if model == "" {
+		model = defaultModel
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	part.Write(audio)
+	form.WriteField("model", model)
+	form.WriteField("response_format", "json")
+	if settings.Language != "" {
+		form.WriteField("language", settings.Language)
+	}
+	form.Close()
+
+	url := strings.TrimRight(settings.Endpoint, "/") + "/audio/transcriptions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if key := os.ExpandEnv(settings.APIKey); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcription failed (status %d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("unexpected transcription response: %v", err)
+	}
+	return result.Text, nil
+}
+
+// nonSpeech matches the markers whisper emits for silence and noise, like [BLANK_AUDIO]
+var nonSpeech = regexp.MustCompile(`\[[A-Z_ ]+\]|\((?i:music|silence|inaudible|noise)\)`)
+
+// cleanTranscript removes non-speech markers and joins the transcript into one line for the prompt
+func cleanTranscript(text string) string {
+	return strings.Join(strings.Fields(nonSpeech.ReplaceAllString(text, " ")), " ")
+}
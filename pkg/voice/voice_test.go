@@ -0,0 +1,85 @@
+package voice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"coding-agent/pkg/types"
+)
+
+func TestRecorderCommand(t *testing.T) {
+	installed := func(names ...string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			for _, n := range names {
+				if n == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", fmt.Errorf("%s not found", name)
+		}
+	}
+
+	tests := []struct {
+		goos      string
+		installed []string
+		want      string
+	}{
+		{"linux", []string{"arecord", "rec"}, "rec"},
+		{"linux", []string{"arecord", "ffmpeg"}, "arecord"},
+		{"darwin", []string{"arecord", "ffmpeg"}, "ffmpeg"},
+		{"windows", []string{"ffmpeg"}, ""},
+		{"linux", nil, ""},
+	}
+	for _, tt := range tests {
+		argv, err := recorderCommand(tt.goos, "out.wav", installed(tt.installed...))
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s %v: expected an error, got %v", tt.goos, tt.installed, argv)
+			}
+			continue
+		}
+		if err != nil || argv[0] != tt.want || argv[len(argv)-1] != "out.wav" {
+			t.Errorf("%s %v: got %v, %v; want %s writing out.wav", tt.goos, tt.installed, argv, err, tt.want)
+		}
+	}
+}
+
+func TestTranscribeEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("unexpected request %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		if r.FormValue("model") != "whisper-1" || r.FormValue("language") != "en" {
+			t.Errorf("unexpected form %v", r.Form)
+		}
+		if _, _, err := r.FormFile("file"); err != nil {
+			t.Errorf("missing audio file: %v", err)
+		}
+		fmt.Fprint(w, `{"text":" Add a test for\n the parser. [BLANK_AUDIO]"}`)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "recording.wav")
+	os.WriteFile(path, make([]byte, 100), 0o644)
+	t.Setenv("VOICE_KEY", "secret")
+
+	settings := types.VoiceSettings{Endpoint: server.URL + "/v1/", APIKey: "$VOICE_KEY", Language: "en"}
+	text, err := Transcribe(context.Background(), settings, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Add a test for the parser." {
+		t.Errorf("got %q", text)
+	}
+}
+
+func TestTranscribeWithoutModel(t *testing.T) {
+	if _, err := Transcribe(context.Background(), types.VoiceSettings{}, "recording.wav"); err == nil {
+		t.Error("expected an error asking for a whisper.cpp model or an endpoint")
+	}
+}
@@ -0,0 +1,97 @@
+package watch
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// skippedDirs are never scanned: VCS metadata, dependencies and common build output
+var skippedDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"target":       true,
+	"dist":         true,
+	"build":        true,
+	"__pycache__":  true,
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watcher detects file changes under a root directory by polling modification times.
+// Polling avoids a platform-specific notification dependency and is cheap for source trees.
+type Watcher struct {
+	root  string
+	files map[string]fileState
+}
+
+// New creates a watcher and records the current state of the tree
+func New(root string) (*Watcher, error) {
+	w := &Watcher{root: root}
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	w.files = files
+	return w, nil
+}
+
+// Poll returns the files created, modified or deleted since the previous call, sorted by path
+func (w *Watcher) Poll() ([]string, error) {
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for path, state := range files {
+		if old, ok := w.files[path]; !ok || old != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range w.files {
+		if _, ok := files[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+
+	w.files = files
+	return changed, nil
+}
+
+func (w *Watcher) scan() (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.WalkDir(w.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can disappear mid-scan; they show up as deleted on the next poll
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != w.root && (strings.HasPrefix(name, ".") || skippedDirs[name]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(w.root, path)
+		if err != nil {
+			rel = path
+		}
+		files[rel] = fileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return files, err
+}
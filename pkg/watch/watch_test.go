@@ -0,0 +1,62 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatcherPoll(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("main.go", "package main")
+	write("pkg/util.go", "package pkg")
+	write("node_modules/dep/index.js", "x")
+
+	w, err := New(root)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if changed, _ := w.Poll(); len(changed) != 0 {
+		t.Fatalf("expected no changes, got %v", changed)
+	}
+
+	write("main.go", "package main\n\nfunc main() {}")
+	write("pkg/new.go", "package pkg")
+	write("node_modules/dep/index.js", "changed")
+	write(".git/index", "changed")
+	if err := os.Remove(filepath.Join(root, "pkg/util.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := w.Poll()
+	if err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	want := []string{"main.go", filepath.Join("pkg", "new.go"), filepath.Join("pkg", "util.go")}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("Poll() = %v, want %v", changed, want)
+	}
+
+	// Same size, newer modification time
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "main.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := w.Poll(); !reflect.DeepEqual(changed, []string{"main.go"}) {
+		t.Errorf("expected touched file to be reported, got %v", changed)
+	}
+}
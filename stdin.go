@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxStdinBytes is how much piped input is attached to a prompt; the rest is dropped
+const maxStdinBytes = 256 * 1024
+
+// stdinPiped reports whether input is piped or redirected to mcode rather than typed on a terminal
+func stdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// readPipedInput reads what was piped to mcode. Approval prompts and Esc are read from stdin, so
+// it is then switched to the controlling terminal; terminal reports whether there is one.
+func readPipedInput() (input string, terminal bool, err error) {
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, maxStdinBytes+1))
+	if err != nil {
+		return "", false, fmt.Errorf("reading stdin: %v", err)
+	}
+	if len(data) > maxStdinBytes {
+		rest, _ := io.Copy(io.Discard, os.Stdin)
+		total := int64(len(data)) + rest
+		data = data[:maxStdinBytes]
+		input = fmt.Sprintf("%s\n[Input truncated to the first %d KB of %d KB]", data, maxStdinBytes/1024, total/1024)
+	} else {
+		input = string(data)
+	}
+
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		os.Stdin = tty
+		terminal = true
+	}
+	return input, terminal, nil
+}
+
+// withPipedInput adds piped input to a prompt. Without a prompt the input is the prompt.
+func withPipedInput(prompt, input string) string {
+	input = strings.TrimRight(input, "\n")
+	if strings.TrimSpace(input) == "" {
+		return prompt
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return input
+	}
+	return prompt + "\n\n<stdin>\n" + input + "\n</stdin>"
+}